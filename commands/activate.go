@@ -1,137 +1,474 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"cosm/logging"
 	"cosm/types"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
-// Activate computes the build list for the current project under development
+// Activate computes the build list for the current project under development,
+// or for all members when run in the root of a workspace. With --shell, an
+// activated interactive subshell is started. With --check, the build list is
+// only verified. With --export, the environment is also written for direnv,
+// dotenv, or GitHub Actions.
 func Activate(cmd *cobra.Command, args []string) error {
-	project, projectStat, err := validateActivate(args)
+	ctx := cmd.Context()
+	startShell, _ := cmd.Flags().GetBool("shell")
+	check, _ := cmd.Flags().GetBool("check")
+	exportFormat, _ := cmd.Flags().GetString("export")
+	if check {
+		if startShell {
+			return validationError("--check cannot be combined with --shell")
+		}
+		if exportFormat != "" {
+			return validationError("--check cannot be combined with --export")
+		}
+		return checkBuildList(args)
+	}
+	if exportFormat != "" {
+		if err := validateExportFormat(exportFormat); err != nil {
+			return err
+		}
+	}
+	if err := ensureNotActivated(startShell); err != nil {
+		return err
+	}
+	if _, err := os.Stat("Workspace.json"); err == nil && (cmd.Flags().Changed("with") || cmd.Flags().Changed("only")) {
+		return validationError("--with and --only cannot be used in a workspace; workspaces resolve all groups of their members")
+	}
+	env, err := prepareActivation(ctx, args, func(project *types.Project) ([]string, error) {
+		return parseGroupFlags(cmd, project)
+	})
 	if err != nil {
 		return err
 	}
 
+	if exportFormat != "" {
+		if err := exportEnvironment(exportFormat, env); err != nil {
+			return err
+		}
+	}
+
+	if !startShell {
+		shell := detectShell()
+		logging.Infof("Environment written to .cosm; activate it with '%s' or run 'cosm activate --shell'", sourceCommand(shell, activateFileForShell(shell)))
+		return nil
+	}
+
+	// Start a new interactive shell
+	return startInteractiveShell(detectShell())
+}
+
+// prepareActivation resolves the build list of the project, or of the workspace, in the current
+// directory if needed, writes its environment to .cosm and makes all of its packages available.
+// groupsOf selects the dependency groups of a project to resolve.
+func prepareActivation(ctx context.Context, args []string, groupsOf func(*types.Project) ([]string, error)) ([]envVar, error) {
+	if _, err := os.Stat("Workspace.json"); err == nil {
+		return prepareWorkspaceActivation(ctx, args)
+	}
+	project, err := validateActivate(args)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := groupsOf(project)
+	if err != nil {
+		return nil, err
+	}
+
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return fmt.Errorf("failed to get cosm directory: %v", err)
+		return nil, fmt.Errorf("failed to get cosm directory: %w", err)
 	}
 	registriesDir := setupRegistriesDir(cosmDir)
 	buildListFile := ".cosm/buildlist.json"
 
-	if err := generateOrVerifyBuildList(project, projectStat, registriesDir, buildListFile); err != nil {
-		return err
+	// A vendored project takes its build list from vendor/vendor.json instead of the registries
+	manifest, err := loadCurrentVendorManifest(project)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil {
+		if err := createEnvironmentFiles(); err != nil {
+			return nil, err
+		}
+		if err := writeLocalBuildList(&types.BuildList{Dependencies: manifest.Dependencies}); err != nil {
+			return nil, err
+		}
+		logging.Infof("Using vendored build list for %s in %s", project.Name, buildListFile)
+	} else if err := generateOrVerifyBuildList(project, groups, registriesDir, buildListFile); err != nil {
+		return nil, err
 	}
 
 	// Load build list
 	buildList, err := loadBuildListFile(buildListFile)
 	if err != nil {
-		return fmt.Errorf("failed to load buildlist.json: %v", err)
+		return nil, fmt.Errorf("failed to load buildlist.json: %w", err)
+	}
+	if manifest != nil {
+		if err := useVendoredPackages(&buildList, manifest); err != nil {
+			return nil, err
+		}
 	}
 
+	return activateEnvironment(ctx, cosmDir, []string{project.Language}, []string{"src"}, project.Env, &buildList)
+}
+
+// activateEnvironment writes the environment, with the variables defined in Project.json, fetches
+// all packages in the build list, and writes their paths for editors; it returns the variables of
+// the environment
+func activateEnvironment(ctx context.Context, cosmDir string, languages, srcDirs []string, projectEnv map[string]string, buildList *types.BuildList) ([]envVar, error) {
 	// Generate environment variables
-	if err := generateEnvironmentVariables(cosmDir, &buildList); err != nil {
-		return fmt.Errorf("failed to generate environment variables: %v", err)
+	env, err := generateEnvironmentVariables(cosmDir, languages, srcDirs, projectEnv, buildList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate environment variables: %w", err)
 	}
 
 	// Make all packages available
-	if err := makePackagesAvailable(&buildList, cosmDir); err != nil {
-		return fmt.Errorf("failed to make packages available: %v", err)
+	if err := makePackagesAvailable(ctx, buildList, cosmDir); err != nil {
+		return nil, fmt.Errorf("failed to make packages available: %w", err)
 	}
 
-	// Start a new interactive shell
-	if err := startInteractiveShell(); err != nil {
-		return err
+	if err := writeEditorPaths(cosmDir, languages, srcDirs, buildList); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// checkBuildList resolves the build list of the project or workspace in the current directory in
+// memory and compares it to .cosm/buildlist.json, without writing anything, so that CI can verify
+// that a committed build list is up to date
+func checkBuildList(args []string) error {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	buildListFile := ".cosm/buildlist.json"
+
+	var expected types.BuildList
+	if _, err := os.Stat("Workspace.json"); err == nil {
+		if len(args) != 0 {
+			return fmt.Errorf("cosm activate takes no arguments; run in workspace root with Workspace.json")
+		}
+		workspace, err := loadWorkspace("Workspace.json")
+		if err != nil {
+			return err
+		}
+		members, err := loadWorkspaceMembers(".", workspace)
+		if err != nil {
+			return err
+		}
+		if expected, err = generateWorkspaceBuildList(members, registriesDir); err != nil {
+			return fmt.Errorf("failed to generate build list for workspace %s: %w", workspace.Name, err)
+		}
+	} else {
+		project, err := validateActivate(args)
+		if err != nil {
+			return err
+		}
+		manifest, err := loadCurrentVendorManifest(project)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			expected = types.BuildList{Dependencies: manifest.Dependencies}
+		} else if expected, err = generateBuildList(selectGroups(project, recordedGroups("")), "", targetPlatform(), registriesDir); err != nil {
+			return fmt.Errorf("failed to generate build list for %s: %w", project.Name, err)
+		}
 	}
 
+	if _, err := os.Stat(buildListFile); os.IsNotExist(err) {
+		return notFoundError("%s does not exist; run cosm activate to generate it", buildListFile)
+	}
+	actual, err := loadBuildListFile(buildListFile)
+	if err != nil {
+		return err
+	}
+	if diff := diffBuildLists(expected, actual); diff != "" {
+		return fmt.Errorf("build list in %s is out of date: %s; run cosm activate to update it", buildListFile, diff)
+	}
+	logging.Infof("Build list up-to-date in %s", buildListFile)
 	return nil
 }
 
 // validateActivate checks if the command is run in a valid package root with no arguments
-func validateActivate(args []string) (*types.Project, os.FileInfo, error) {
+func validateActivate(args []string) (*types.Project, error) {
 	if len(args) != 0 {
-		return nil, nil, fmt.Errorf("cosm activate takes no arguments; run in package root with Project.json")
+		return nil, fmt.Errorf("cosm activate takes no arguments; run in package root with Project.json")
 	}
-	projectFile := "Project.json"
-	projectStat, err := os.Stat(projectFile)
-	if err != nil {
+	projectFile := projectFilePath("Project.json")
+	if _, err := os.Stat(projectFile); err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil, fmt.Errorf("Project.json not found in current directory")
+			return nil, notFoundError("Project.json not found in current directory")
 		}
-		return nil, nil, fmt.Errorf("failed to stat Project.json: %v", err)
+		return nil, fmt.Errorf("failed to stat Project.json: %w", err)
 	}
 	project, err := loadProject(projectFile)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse Project.json: %v", err)
+		return nil, fmt.Errorf("failed to parse Project.json: %w", err)
 	}
-	return project, projectStat, nil
+	return project, nil
 }
 
-// generateOrVerifyBuildList generates the build list if needed or verifies it’s up-to-date
-func generateOrVerifyBuildList(project *types.Project, projectStat os.FileInfo, registriesDir, buildListFile string) error {
-	needsBuildList, err := needsBuildListGeneration(projectStat)
+// generateOrVerifyBuildList generates the build list of the dependencies in the given groups if
+// needed or verifies it’s up-to-date
+func generateOrVerifyBuildList(project *types.Project, groups []string, registriesDir, buildListFile string) error {
+	needsBuildList, err := needsBuildListGeneration("", projectBuildListInputs(project, ""), groups)
 	if err != nil {
 		return err
 	}
+	if err := createEnvironmentFiles(); err != nil {
+		return err
+	}
 
 	if needsBuildList {
-		if err := createEnvironmentFiles(); err != nil {
-			return err
-		}
-		if err := generateLocalBuildList(project, registriesDir); err != nil {
+		if err := generateLocalBuildList(project, groups, registriesDir); err != nil {
 			return err
 		}
-		fmt.Printf("Generated build list for %s in %s\n", project.Name, buildListFile)
+		logging.Infof("Generated build list for %s in %s", project.Name, buildListFile)
 	} else {
-		fmt.Printf("Build list up-to-date in %s\n", buildListFile)
+		logging.Infof("Build list up-to-date in %s", buildListFile)
 	}
 	return nil
 }
 
-// needsBuildListGeneration checks if buildlist.json needs regeneration based on mod times
-func needsBuildListGeneration(projectStat os.FileInfo) (bool, error) {
-	buildListFile := ".cosm/buildlist.json"
-	buildListStat, err := os.Stat(buildListFile)
-	if err == nil {
-		return !buildListStat.ModTime().After(projectStat.ModTime()), nil
+// buildListMeta is the content of .cosm/buildlist.meta, which records what the build list in
+// .cosm/buildlist.json was resolved from
+type buildListMeta struct {
+	InputsHash string   `json:"inputshash"`       // Hash of the manifests the build list was resolved from
+	Groups     []string `json:"groups,omitempty"` // Dependency groups the build list was resolved for
+	Platform   string   `json:"platform"`         // Platform the build list was resolved for
+}
+
+// needsBuildListGeneration checks if the build list of a project directory needs regeneration,
+// because it does not exist or the content of the files it was resolved from changed. File times
+// are not used, since git checkouts and rewrites with the same content change them. It is also
+// regenerated if it was resolved for other dependency groups or another platform.
+func needsBuildListGeneration(projectDir string, inputs, groups []string) (bool, error) {
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+	if _, err := os.Stat(buildListFile); os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", buildListFile, err)
+	}
+	hash, err := hashBuildListInputs(inputs)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(filepath.Join(projectDir, ".cosm", "buildlist.meta"))
+	if err != nil {
+		return true, nil
 	}
-	if os.IsNotExist(err) {
+	var meta buildListMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
 		return true, nil
 	}
-	return false, fmt.Errorf("failed to stat %s: %v", buildListFile, err)
+	return meta.InputsHash != hash || !slices.Equal(meta.Groups, groups) || meta.Platform != targetPlatform(), nil
 }
 
-// generateLocalBuildList computes and writes the build list to .cosm/buildlist.json
-func generateLocalBuildList(project *types.Project, registriesDir string) error {
-	buildList, err := generateBuildList(project, registriesDir)
+// projectBuildListInputs returns the files that the build list of a project is resolved from:
+// its Project.json and the Project.json of every dependency in development mode
+func projectBuildListInputs(project *types.Project, projectDir string) []string {
+	inputs := []string{projectFilePath(filepath.Join(projectDir, "Project.json"))}
+	cosmDir, err := getCosmDir()
 	if err != nil {
-		return fmt.Errorf("failed to generate build list for %s: %v", project.Name, err)
+		return inputs
 	}
-	data, err := json.MarshalIndent(buildList, "", "  ")
+	for _, dep := range pathDependencies(project) {
+		inputs = append(inputs, projectFilePath(filepath.Join(projectDir, filepath.FromSlash(dep.Path), "Project.json")))
+	}
+	for _, key := range sortedDependencyKeys(project.Deps) {
+		dep := project.Deps[key]
+		if !dep.Develop {
+			continue
+		}
+		major, err := GetMajorVersion(dep.Version)
+		if err != nil {
+			continue
+		}
+		inputs = append(inputs, projectFilePath(filepath.Join(cosmDir, "dev", dep.Name+"@"+major, "Project.json")))
+	}
+	return inputs
+}
+
+// hashBuildListInputs hashes the names and contents of the files a build list is resolved from.
+// A missing file hashes differently from an empty one.
+func hashBuildListInputs(inputs []string) (string, error) {
+	hash := sha256.New()
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", input, err)
+		}
+		fmt.Fprintf(hash, "%s\x00%t\x00%d\x00", filepath.ToSlash(input), err == nil, len(data))
+		hash.Write(data)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeBuildListMeta records the files and the dependency groups that the build list of a project
+// directory was resolved from in .cosm/buildlist.meta; workspaces have no groups
+func writeBuildListMeta(projectDir string, inputs, groups []string) error {
+	hash, err := hashBuildListInputs(inputs)
 	if err != nil {
-		return fmt.Errorf("failed to marshal buildlist.json: %v", err)
+		return err
 	}
-	buildListFile := ".cosm/buildlist.json"
-	if err := os.WriteFile(buildListFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write %s: %v", buildListFile, err)
+	data, err := json.MarshalIndent(buildListMeta{InputsHash: hash, Groups: groups, Platform: targetPlatform()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal buildlist.meta: %w", err)
+	}
+	metaFile := filepath.Join(projectDir, ".cosm", "buildlist.meta")
+	if err := writeFileAtomically(metaFile, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", metaFile, err)
+	}
+	return nil
+}
+
+// ResolveOptions selects the project whose build list is resolved
+type ResolveOptions struct {
+	ProjectDir string   // Directory with the Project.json; the current directory if empty
+	Groups     []string // Dependency groups to resolve; the groups of the last activation if empty
+}
+
+// ResolveBuildList resolves the build list of a project with minimal version selection,
+// without writing it or fetching the packages. It reads the registries without running git, so the
+// context is only checked before it starts.
+func ResolveBuildList(ctx context.Context, opts ResolveOptions) (types.BuildList, error) {
+	if err := ctx.Err(); err != nil {
+		return types.BuildList{}, err
+	}
+	project, err := loadProject(filepath.Join(opts.ProjectDir, "Project.json"))
+	if err != nil {
+		return types.BuildList{}, err
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return types.BuildList{}, err
+	}
+	groups := opts.Groups
+	if len(groups) == 0 {
+		groups = recordedGroups(opts.ProjectDir)
+	}
+	buildList, err := generateBuildList(selectGroups(project, groups), opts.ProjectDir, targetPlatform(), registriesDir)
+	if err != nil {
+		return types.BuildList{}, fmt.Errorf("failed to generate build list for %s: %w", project.Name, err)
+	}
+	return buildList, nil
+}
+
+// saveProjectAndBuildList saves a changed Project.json and, unless noResolve is set, regenerates
+// the build list of the project. The build list is resolved first, so that a change whose build
+// list cannot be resolved leaves Project.json as it was.
+func saveProjectAndBuildList(project *types.Project, projectDir, registriesDir string, noResolve bool) error {
+	projectFile := filepath.Join(projectDir, "Project.json")
+	if noResolve {
+		return saveProject(project, projectFile)
+	}
+	groups := recordedGroups(projectDir)
+	buildList, err := generateBuildList(selectGroups(project, groups), projectDir, targetPlatform(), registriesDir)
+	if err != nil {
+		return fmt.Errorf("failed to generate build list for %s: %w (Project.json was not changed; use --no-resolve to change it anyway)", project.Name, err)
+	}
+	if err := saveProject(project, projectFile); err != nil {
+		return err
+	}
+	if err := writeProjectBuildList(projectDir, &buildList); err != nil {
+		return err
+	}
+	if err := writeBuildListMeta(projectDir, projectBuildListInputs(project, projectDir), groups); err != nil {
+		return err
+	}
+	reportMajorVersionConflicts(project, buildList, registriesDir)
+	logging.Debugf("Generated build list for %s in %s", project.Name, filepath.Join(projectDir, ".cosm", "buildlist.json"))
+	return nil
+}
+
+// generateLocalBuildList computes the build list of the dependencies in the given groups and writes
+// it to .cosm/buildlist.json
+func generateLocalBuildList(project *types.Project, groups []string, registriesDir string) error {
+	buildList, err := generateBuildList(selectGroups(project, groups), "", targetPlatform(), registriesDir)
+	if err != nil {
+		return fmt.Errorf("failed to generate build list for %s: %w", project.Name, err)
+	}
+	if err := writeLocalBuildList(&buildList); err != nil {
+		return err
+	}
+	if err := writeBuildListMeta("", projectBuildListInputs(project, ""), groups); err != nil {
+		return err
 	}
+	reportMajorVersionConflicts(project, buildList, registriesDir)
 	return nil
 }
 
-// createEnvironmentFiles creates .cosm directory, .env, and .bashrc
+// writeLocalBuildList writes the build list to .cosm/buildlist.json
+func writeLocalBuildList(buildList *types.BuildList) error {
+	return writeProjectBuildList("", buildList)
+}
+
+// writeProjectBuildList writes the build list to .cosm/buildlist.json in a project directory, the
+// current directory if empty
+func writeProjectBuildList(projectDir string, buildList *types.BuildList) error {
+	data, err := json.MarshalIndent(buildList, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal buildlist.json: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(projectDir, ".cosm"), 0755); err != nil {
+		return fmt.Errorf("failed to create .cosm directory: %w", err)
+	}
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+	if err := writeFileAtomically(buildListFile, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", buildListFile, err)
+	}
+	return recordBuildListUsage(buildListFile)
+}
+
+// recordBuildListUsage records the build list in the depot, so that 'cosm cache clean --unused'
+// keeps the packages it refers to
+func recordBuildListUsage(buildListFile string) error {
+	absPath, err := filepath.Abs(buildListFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path for %s: %w", buildListFile, err)
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	buildListFiles, err := loadBuildListUsage(cosmDir)
+	if err != nil {
+		return err
+	}
+	if contains(buildListFiles, absPath) {
+		return nil
+	}
+	return saveBuildListUsage(cosmDir, append(buildListFiles, absPath))
+}
+
+// createEnvironmentFiles creates .cosm directory and the startup files of the supported shells
 func createEnvironmentFiles() error {
 	if err := os.MkdirAll(".cosm", 0755); err != nil {
-		return fmt.Errorf("failed to create .cosm directory: %v", err)
+		return fmt.Errorf("failed to create .cosm directory: %w", err)
 	}
 	const bashrcContent = `# signal that cosm prompt is active
 		export COSM_PROMPT=1
+		export COSM_ACTIVE="$PWD"
+
+		# leaving the shell deactivates the environment
+		function deactivate() {
+			exit
+		}
 
 		# supress depracation warning
 		export BASH_SILENCE_DEPRECATION_WARNING=1
@@ -162,77 +499,185 @@ func createEnvironmentFiles() error {
 		trap before_command DEBUG
 		`
 	if err := os.WriteFile(".cosm/.bashrc", []byte(bashrcContent), 0644); err != nil {
-		return fmt.Errorf("failed to write .cosm/.bashrc: %v", err)
+		return fmt.Errorf("failed to write .cosm/.bashrc: %w", err)
 	}
-	return nil
-}
+	const zshrcContent = `# load the user's configuration
+		if [ -f "$HOME/.zshrc" ]; then
+			source "$HOME/.zshrc"
+		fi
 
-// generateEnvironmentVariables creates the .cosm/.env file with environment variables
-func generateEnvironmentVariables(cosmDir string, buildList *types.BuildList) error {
+		# signal that cosm prompt is active
+		export COSM_PROMPT=1
+		export COSM_ACTIVE="$PWD"
 
-	// Construct TERRA_PATH
-	var terraPaths, luaPaths []string
-	terraPaths = append(terraPaths, "src/?.t")
-	luaPaths = append(luaPaths, "src/?.lua")
+		# leaving the shell deactivates the environment
+		function deactivate() {
+			exit
+		}
 
-	// Add direct subfolders of "src"
-	srcDir := "src"
-	entries, err := os.ReadDir(srcDir)
-	if err != nil {
-		return fmt.Errorf("failed to read src dir: %v", err)
-	}
-	for _, entry := range entries {
-		if entry.IsDir() {
-			terraPaths = append(terraPaths, filepath.Join(srcDir, entry.Name(), "?.t"))
-			luaPaths = append(luaPaths, filepath.Join(srcDir, entry.Name(), "?.lua"))
+		# define cosm prompt
+		PROMPT='%B%F{green}cosm>%f%b '
+
+		# reload environment variables in every command
+		function before_command() {
+			if [ -f .cosm/.env ]; then
+				source .cosm/.env
+			fi
 		}
+		autoload -Uz add-zsh-hook
+		add-zsh-hook preexec before_command
+		before_command
+		`
+	if err := os.WriteFile(".cosm/.zshrc", []byte(zshrcContent), 0644); err != nil {
+		return fmt.Errorf("failed to write .cosm/.zshrc: %w", err)
 	}
+	const fishContent = `# signal that cosm prompt is active
+		set -gx COSM_PROMPT 1
+		set -gx COSM_ACTIVE "$PWD"
 
-	for _, dep := range buildList.Dependencies {
-		if dep.Path != "" {
-			terraPaths = append(terraPaths, filepath.Join(cosmDir, dep.Path, "src", "?.t"))
-			luaPaths = append(luaPaths, filepath.Join(cosmDir, dep.Path, "src", "?.lua"))
+		# leaving the shell deactivates the environment
+		function deactivate
+			exit
+		end
+
+		# define cosm prompt
+		function fish_prompt
+			set_color --bold green
+			echo -n 'cosm>'
+			set_color normal
+			echo -n ' '
+		end
+
+		# reload environment variables in every command
+		function before_command --on-event fish_preexec
+			if test -f .cosm/env.fish
+				source .cosm/env.fish
+			end
+		end
+		before_command
+		`
+	if err := os.WriteFile(".cosm/config.fish", []byte(fishContent), 0644); err != nil {
+		return fmt.Errorf("failed to write .cosm/config.fish: %w", err)
+	}
+	const powershellContent = `# signal that cosm prompt is active
+		$env:COSM_PROMPT = 1
+		$env:COSM_ACTIVE = $PWD.Path
+
+		# leaving the shell deactivates the environment
+		function global:deactivate {
+			exit
+		}
+
+		# define cosm prompt, which also reloads the environment variables after every command
+		function global:prompt {
+			if (Test-Path .cosm/env.ps1) {
+				. .cosm/env.ps1
+			}
+			Write-Host -NoNewline -ForegroundColor Green 'cosm>'
+			' '
 		}
+		`
+	if err := os.WriteFile(".cosm/startup.ps1", []byte(powershellContent), 0644); err != nil {
+		return fmt.Errorf("failed to write .cosm/startup.ps1: %w", err)
 	}
-	terraPathValue := strings.Join(terraPaths, ";") + ";;"
-	luaPathValue := strings.Join(luaPaths, ";") + ";;"
+	return nil
+}
 
-	// Write to .cosm/.env
-	envContent := fmt.Sprintf("export TERRA_PATH=%q\nexport LUA_PATH=%q\n", terraPathValue, luaPathValue)
-	envFile := filepath.Join(".", ".cosm", ".env")
-	if err := os.WriteFile(envFile, []byte(envContent), 0644); err != nil {
-		return fmt.Errorf("failed to write .cosm/.env: %v", err)
+// generateEnvironmentVariables creates the .cosm/.env file with environment variables and returns them;
+// the variables defined in Project.json override the variables of the same name that cosm computes
+func generateEnvironmentVariables(cosmDir string, languages, srcDirs []string, projectEnv map[string]string, buildList *types.BuildList) ([]envVar, error) {
+	env, err := buildEnvironment(cosmDir, languages, srcDirs, buildList)
+	if err != nil {
+		return nil, err
+	}
+	defined, err := projectEnvironment(cosmDir, projectEnv, buildList)
+	if err != nil {
+		return nil, err
 	}
+	env = mergeEnvironment(env, defined)
 
-	return nil
+	// Write to .cosm/.env for POSIX shells, .cosm/env.fish for fish, .cosm/env.ps1 for PowerShell
+	// and .cosm/env.bat for cmd
+	for _, shell := range activationShells {
+		var envContent strings.Builder
+		if shell == "cmd" {
+			envContent.WriteString("@echo off\n")
+		}
+		for _, v := range env {
+			envContent.WriteString(shellExportLine(shell, v.name, v.value))
+		}
+		content := envContent.String()
+		if shell == "cmd" {
+			content = crlf(content)
+		}
+		envFile := envFileForShell(shell)
+		if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", envFile, err)
+		}
+	}
+
+	// Write the activation scripts and the variables they inject
+	var names []string
+	for _, v := range env {
+		names = append(names, v.name)
+	}
+	return env, writeActivationScripts(names)
 }
 
 // makePackagesAvailable ensures all packages in the build list are available
-func makePackagesAvailable(buildList *types.BuildList, cosmDir string) error {
+func makePackagesAvailable(ctx context.Context, buildList *types.BuildList, cosmDir string) error {
 	registriesDir := setupRegistriesDir(cosmDir)
 	// Process all dependencies
 	for _, dep := range buildList.Dependencies {
-		specs, _, err := findDependency(dep.Name, dep.Version, dep.UUID, registriesDir)
+		if filepath.IsAbs(dep.Path) {
+			continue // vendored packages are already available
+		}
+		specs, _, err := findDependency(dep.Name, dep.Version, dep.UUID, "", registriesDir)
 		if err != nil {
 			return err
 		}
-		if err := MakePackageAvailable(cosmDir, &specs); err != nil {
-			return fmt.Errorf("failed to make package '%s@%s' available: %v", dep.Name, dep.Version, err)
+		specs.SHA1 = dep.SHA1 // The commit a dependency is pinned to, if not the release
+		if err := MakePackageAvailable(ctx, cosmDir, &specs); err != nil {
+			return fmt.Errorf("failed to make package '%s@%s' available: %w", dep.Name, dep.Version, err)
 		}
 	}
 	return nil
 }
 
-// startBashShell starts a new bash shell sourcing .cosm/.bashrc
-func startInteractiveShell() error {
-	bashrcFile := filepath.Join(".cosm", ".bashrc")
-	cmdShell := exec.Command("bash", "--rcfile", bashrcFile)
+// startInteractiveShell starts a new shell that loads the cosm startup file of that shell
+func startInteractiveShell(shell string) error {
+	var cmdShell *exec.Cmd
+	switch shell {
+	case "zsh":
+		cosmDir, err := filepath.Abs(".cosm")
+		if err != nil {
+			return fmt.Errorf("failed to resolve .cosm directory: %w", err)
+		}
+		cmdShell = exec.Command("zsh", "-i")
+		cmdShell.Env = append(os.Environ(), "ZDOTDIR="+cosmDir)
+	case "fish":
+		cmdShell = exec.Command("fish", "--init-command", "source .cosm/config.fish")
+	case "powershell":
+		cmdShell = exec.Command(powershellExecutable(), "-NoLogo", "-NoExit", "-Command", ". .cosm/startup.ps1")
+	default:
+		cmdShell = exec.Command("bash", "--rcfile", filepath.Join(".cosm", ".bashrc"))
+	}
 	cmdShell.Stdin = os.Stdin
 	cmdShell.Stdout = os.Stdout
 	cmdShell.Stderr = os.Stderr
-	fmt.Printf("Starting interactive shell. Press ctrl-d or type 'exit' to quit.\n")
+
+	// The shell handles ctrl-c itself; it must not cancel or terminate cosm while the shell runs
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	logging.Infof("Starting interactive shell. Press ctrl-d or type 'exit' to quit.")
 	if err := cmdShell.Run(); err != nil {
-		return fmt.Errorf("failed to start bash shell with .cosm/.bashrc: %v", err)
+		// The exit status of the last command in the shell is not an activation failure
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("failed to start %s shell: %w", shell, err)
+		}
 	}
+	logging.Infof("Left the cosm environment")
 	return nil
 }
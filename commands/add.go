@@ -1,71 +1,479 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
-// Add adds a dependency to the project's Project.json file
+// aliasPattern matches the names that a dependency can be imported as
+var aliasPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// commitPattern matches a commit SHA-1 or a prefix of it that cosm add --sha accepts
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// AddOptions describes a dependency to add to a project
+type AddOptions struct {
+	ProjectDir string // Directory with the Project.json; the current directory if empty
+	Name       string
+	Registry   string   // Registry to look the package up in, from a scoped name <registry>/<name>; all registries if empty
+	Version    string   // v<version>, v<major> for the latest version with that major version, or empty for the latest version
+	Prerelease bool     // Select prereleases when the latest version is added
+	Alias      string   // Name the dependency is imported as, if it differs from its name
+	NoResolve  bool     // Do not regenerate .cosm/buildlist.json; applies to all dependencies added together
+	Path       string   // Local tree to add as a path dependency, relative to ProjectDir; Name and Version are read from its Project.json
+	Group      string   // Dependency group, e.g. dev or test; the main group if empty
+	Features   []string // Features of the package to enable
+	Optional   bool     // Only resolve the dependency for dependents if a feature of the project enables it
+	Platforms  []string // Platforms <os> or <os>/<arch> the dependency is restricted to; all platforms if empty
+	SHA1       string   // Commit, or a prefix of at least 7 digits, to pin the dependency to instead of the release
+
+	// SelectVersion chooses the version when Version is empty, from the versions in the registries
+	// newest first; the latest version is added if it is nil
+	SelectVersion func(packageName string, choices []VersionChoice) (string, error)
+}
+
+// AddResult is the dependency that was added to a project
+type AddResult struct {
+	Name      string
+	Version   string
+	UUID      string
+	Registry  string
+	Alias     string
+	Group     string // Dependency group; empty for the main group
+	Path      string // Local tree of a path dependency, relative to the project
+	Features  []string
+	Optional  bool
+	Platforms []string
+	SHA1      string // Commit the dependency is pinned to, if not the release of Version
+}
+
+// Add adds one or more dependencies to the project's Project.json file
 func Add(cmd *cobra.Command, args []string) error {
-	packageName, versionTag, err := parseAddArgs(args)
-	if err != nil {
+	ctx := cmd.Context()
+	var deps []AddOptions
+	if path, _ := cmd.Flags().GetString("path"); path != "" {
+		if len(args) != 0 {
+			return validationError("--path takes no package arguments; the package is read from %s", filepath.Join(path, "Project.json"))
+		}
+		deps = []AddOptions{{Path: path}}
+	} else {
+		var err error
+		if deps, err = parseAddArgs(args); err != nil {
+			return err
+		}
+	}
+	prerelease, _ := cmd.Flags().GetBool("pre")
+	alias, _ := cmd.Flags().GetString("as")
+	noResolve, _ := cmd.Flags().GetBool("no-resolve")
+	group, _ := cmd.Flags().GetString("group")
+	if err := validateGroupName(group); err != nil {
 		return err
 	}
-	project, err := loadProject("Project.json")
+	features, _ := cmd.Flags().GetStringSlice("features")
+	optional, _ := cmd.Flags().GetBool("optional")
+	platforms, _ := cmd.Flags().GetStringSlice("platform")
+	for _, platform := range platforms {
+		if err := validatePlatform(platform); err != nil {
+			return err
+		}
+	}
+	if refresh, _ := cmd.Flags().GetBool("refresh"); refresh {
+		if err := OverrideConfig("refreshinterval", "0"); err != nil {
+			return err
+		}
+	}
+	if alias != "" && len(deps) > 1 {
+		return validationError("--as can only be used when adding a single dependency")
+	}
+	if len(features) > 0 && len(deps) > 1 {
+		return validationError("--features can only be used when adding a single dependency")
+	}
+	sha1, _ := cmd.Flags().GetString("sha")
+	if sha1 != "" {
+		if len(deps) > 1 || deps[0].Path != "" {
+			return validationError("--sha can only be used when adding a single dependency from a registry")
+		}
+		if !commitPattern.MatchString(sha1) {
+			return validationError("invalid commit '%s': must be a SHA-1 of 7 to 40 hexadecimal digits", sha1)
+		}
+		deps[0].SHA1 = sha1
+	}
+	for i := range deps {
+		deps[i].Group = group
+		deps[i].Features = features
+		deps[i].Optional = optional
+		deps[i].Platforms = platforms
+		deps[i].Prerelease = prerelease
+		deps[i].Alias = alias
+		deps[i].NoResolve = noResolve
+		if deps[i].Version == "" && !inputDisabled() && stdinIsTerminal() {
+			deps[i].SelectVersion = promptUserForVersion
+		}
+	}
+	results, err := AddDependencies(ctx, deps)
 	if err != nil {
 		return err
 	}
+	for _, result := range results {
+		var message string
+		switch {
+		case result.Path != "":
+			message = fmt.Sprintf("Added path dependency '%s' %s from %s to project", result.Name, result.Version, result.Path)
+		case result.Alias != "":
+			message = fmt.Sprintf("Added dependency '%s' %s from registry '%s' to project as '%s'", result.Name, result.Version, result.Registry, result.Alias)
+		default:
+			message = fmt.Sprintf("Added dependency '%s' %s from registry '%s' to project", result.Name, result.Version, result.Registry)
+		}
+		if result.Optional {
+			message += " as optional dependency"
+		}
+		if result.Group != "" {
+			message += fmt.Sprintf(" in group '%s'", result.Group)
+		}
+		if len(result.Features) > 0 {
+			message += " with features " + quoteFeatures(result.Features)
+		}
+		if len(result.Platforms) > 0 {
+			message += " on " + strings.Join(result.Platforms, ", ")
+		}
+		if result.SHA1 != "" {
+			message += " pinned to commit " + result.SHA1[:7]
+		}
+		logging.Infof("%s", message)
+	}
+	return nil
+}
+
+// AddDependency selects a version of a package in the registries and adds it to the Project.json of a project
+func AddDependency(ctx context.Context, opts AddOptions) (AddResult, error) {
+	results, err := AddDependencies(ctx, []AddOptions{opts})
+	if err != nil {
+		return AddResult{}, err
+	}
+	return results[0], nil
+}
+
+// AddDependencies adds several dependencies to the Project.json of a project at once and
+// regenerates its build list. The versions of all of them are selected and the build list is
+// resolved before Project.json is written, so either all are added or none.
+func AddDependencies(ctx context.Context, deps []AddOptions) ([]AddResult, error) {
+	if len(deps) == 0 {
+		return nil, validationError("no dependencies to add")
+	}
+	projectDir := deps[0].ProjectDir
+	for _, opts := range deps[1:] {
+		if opts.ProjectDir != projectDir {
+			return nil, validationError("all dependencies must be added to the same project")
+		}
+	}
+	projectFile := filepath.Join(projectDir, "Project.json")
+	project, err := loadProject(projectFile)
+	if err != nil {
+		return nil, err
+	}
 	registriesDir, err := getRegistriesDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	registryNames, err := loadRegistryNames(registriesDir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	results := make([]AddResult, 0, len(deps))
+	for _, opts := range deps {
+		var result AddResult
+		if opts.Path != "" {
+			result, err = addPathDependency(project, opts, projectDir)
+		} else {
+			result, err = addDependencyToProject(ctx, project, opts, registriesDir, registryNames)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	noResolve := slices.ContainsFunc(deps, func(opts AddOptions) bool { return opts.NoResolve })
+	if err := saveProjectAndBuildList(project, projectDir, registriesDir, noResolve); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// addDependencyToProject selects a version of a package in the registries and adds it to the
+// dependencies of the project, without saving it
+func addDependencyToProject(ctx context.Context, project *types.Project, opts AddOptions, registriesDir string, registryNames []string) (AddResult, error) {
+	if opts.Alias != "" {
+		if err := validateAlias(project, opts.Alias); err != nil {
+			return AddResult{}, err
+		}
+	}
+	if opts.Registry != "" {
+		if err := assertRegistryExists(registriesDir, opts.Registry); err != nil {
+			return AddResult{}, err
+		}
+		registryNames = []string{opts.Registry}
+	}
+	var selectedPackage types.PackageLocation
+	var err error
+	if opts.Version == "" && opts.SelectVersion != nil {
+		selectedPackage, err = selectPackageVersion(ctx, opts, registriesDir, registryNames)
+	} else {
+		selectedPackage, err = findPackageInRegistries(ctx, opts.Name, opts.Version, opts.Prerelease, registriesDir, registryNames)
 	}
-	selectedPackage, err := findPackageInRegistries(packageName, versionTag, registriesDir, registryNames)
 	if err != nil {
-		return err
+		return AddResult{}, err
 	}
-	if err := updateProjectWithDependency(project, packageName, selectedPackage.Specs.Version, selectedPackage.RegistryName, selectedPackage.Specs.UUID); err != nil {
-		return err
+	if err := validateRequestedFeatures(selectedPackage.Specs, opts.Features); err != nil {
+		return AddResult{}, err
 	}
-	return nil
+	// Record the registry, so that the build list is resolved from the registry selected here
+	registry, _, err := LoadRegistryMetadata(registriesDir, selectedPackage.RegistryName)
+	if err != nil {
+		return AddResult{}, err
+	}
+	var sha1 string
+	if opts.SHA1 != "" {
+		if sha1, err = resolvePackageCommit(ctx, &selectedPackage.Specs, opts.SHA1); err != nil {
+			return AddResult{}, err
+		}
+	}
+	dep := types.Dependency{Name: opts.Name, Version: selectedPackage.Specs.Version, Registry: registry.UUID, SHA1: sha1, Alias: opts.Alias, Group: groupName(opts.Group), Optional: opts.Optional, Features: mergeFeatures(opts.Features, nil), Platforms: opts.Platforms}
+	if err := updateDependency(project, selectedPackage.Specs.UUID, dep); err != nil {
+		return AddResult{}, err
+	}
+	return AddResult{
+		Name:      opts.Name,
+		Version:   selectedPackage.Specs.Version,
+		UUID:      selectedPackage.Specs.UUID,
+		Registry:  selectedPackage.RegistryName,
+		Alias:     opts.Alias,
+		Group:     dep.Group,
+		Features:  dep.Features,
+		Optional:  dep.Optional,
+		Platforms: dep.Platforms,
+		SHA1:      dep.SHA1,
+	}, nil
+}
+
+// resolvePackageCommit returns the full SHA1 of a commit in the repository of a package, fetching
+// the repository if the clone in the depot does not have the commit yet
+func resolvePackageCommit(ctx context.Context, specs *types.Specs, commit string) (string, error) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return "", err
+	}
+	unlock, err := lockDepot(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	clonePath, err := ensurePackageClone(ctx, cosmDir, specs)
+	if err != nil {
+		return "", err
+	}
+	ref := strings.ToLower(commit) + "^{commit}"
+	sha1, err := GitCommand(ctx, clonePath, "rev-parse", "--verify", "--quiet", ref)
+	if err != nil {
+		if err := fetchWithMirrors(ctx, clonePath, specs.Mirrors); err != nil {
+			return "", err
+		}
+		if sha1, err = GitCommand(ctx, clonePath, "rev-parse", "--verify", "--quiet", ref); err != nil {
+			return "", notFoundError("commit '%s' not found in the repository of package '%s'", commit, specs.Name)
+		}
+	}
+	return strings.TrimSpace(sha1), nil
 }
 
-// parseAddArgs validates and parses the package name and optional version
-func parseAddArgs(args []string) (string, string, error) {
-	if len(args) < 1 || len(args) > 2 {
-		return "", "", fmt.Errorf("expected 1 or 2 arguments in the format <package_name> [v<version_number>] (e.g., cosm add mypkg v1.2.3)")
+// addPathDependency adds the package in a local tree as a path dependency of the project, without
+// saving it; the build list uses the local tree instead of a registered version
+func addPathDependency(project *types.Project, opts AddOptions, projectDir string) (AddResult, error) {
+	if opts.Alias != "" {
+		if err := validateAlias(project, opts.Alias); err != nil {
+			return AddResult{}, err
+		}
+	}
+	targetDir := opts.Path
+	if !filepath.IsAbs(targetDir) {
+		targetDir = filepath.Join(projectDir, targetDir)
+	}
+	local, err := loadProjectFromDir(targetDir)
+	if err != nil {
+		return AddResult{}, notFoundError("no package found at path '%s': %v", opts.Path, err)
+	}
+	if local.UUID == project.UUID {
+		return AddResult{}, validationError("project '%s' cannot depend on itself", project.Name)
+	}
+	absProjectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return AddResult{}, fmt.Errorf("failed to resolve project directory: %w", err)
+	}
+	absTargetDir, err := filepath.Abs(targetDir)
+	if err != nil {
+		return AddResult{}, fmt.Errorf("failed to resolve path '%s': %w", opts.Path, err)
+	}
+	relPath, err := filepath.Rel(absProjectDir, absTargetDir)
+	if err != nil {
+		return AddResult{}, fmt.Errorf("failed to make path '%s' relative to the project: %w", opts.Path, err)
+	}
+	specs, err := localPackageSpecs(absTargetDir)
+	if err != nil {
+		return AddResult{}, err
+	}
+	if err := validateRequestedFeatures(specs, opts.Features); err != nil {
+		return AddResult{}, err
+	}
+	dep := types.Dependency{Name: local.Name, Version: local.Version, Alias: opts.Alias, Group: groupName(opts.Group), Path: filepath.ToSlash(relPath), Optional: opts.Optional, Features: mergeFeatures(opts.Features, nil), Platforms: opts.Platforms}
+	if err := updateDependency(project, local.UUID, dep); err != nil {
+		return AddResult{}, err
+	}
+	return AddResult{Name: local.Name, Version: local.Version, UUID: local.UUID, Alias: opts.Alias, Group: dep.Group, Path: dep.Path, Features: dep.Features, Optional: dep.Optional, Platforms: dep.Platforms}, nil
+}
+
+// selectPackageVersion refreshes the registries and lets opts.SelectVersion choose among the versions
+// of the package in them, skipping yanked versions and, unless opts.Prerelease is set, prereleases
+func selectPackageVersion(ctx context.Context, opts AddOptions, registriesDir string, registryNames []string) (types.PackageLocation, error) {
+	registriesOf := make(map[string][]string)
+	var versions []string
+	for _, registryName := range registryNames {
+		if err := refreshRegistry(ctx, registriesDir, registryName); err != nil {
+			return types.PackageLocation{}, err
+		}
+		registryVersions, err := loadVersions(registriesDir, registryName, opts.Name)
+		if err != nil {
+			continue // Not in this registry
+		}
+		for _, version := range removeYankedVersions(registriesDir, registryName, opts.Name, registryVersions) {
+			if IsPrerelease(version) && !opts.Prerelease {
+				continue
+			}
+			if _, seen := registriesOf[version]; !seen {
+				versions = append(versions, version)
+			}
+			registriesOf[version] = append(registriesOf[version], registryName)
+		}
+	}
+	if len(versions) == 0 {
+		return types.PackageLocation{}, notFoundError("package '%s' not found in any registry", opts.Name)
+	}
+	sortVersions(versions)
+	choices := make([]VersionChoice, len(versions))
+	for i, version := range versions {
+		choices[len(versions)-1-i] = VersionChoice{Version: version, Registries: registriesOf[version]}
+	}
+	choices[0].Latest = true
+	version, err := opts.SelectVersion(opts.Name, choices)
+	if err != nil {
+		return types.PackageLocation{}, err
+	}
+	if _, found := registriesOf[version]; !found {
+		return types.PackageLocation{}, notFoundError("version '%s' of package '%s' is not available", version, opts.Name)
+	}
+
+	var foundPackages []types.PackageLocation
+	for _, registryName := range registriesOf[version] {
+		specs, err := loadSpecs(registriesDir, registryName, opts.Name, version)
+		if err != nil {
+			return types.PackageLocation{}, fmt.Errorf("failed to load specs for '%s@%s' in registry '%s': %w", opts.Name, version, registryName, err)
+		}
+		foundPackages = append(foundPackages, types.PackageLocation{RegistryName: registryName, Specs: specs})
+	}
+	return selectPackageFromResults(opts.Name, version, foundPackages)
+}
+
+// parseAddArgs validates and parses the dependencies to add. A single dependency can be given as
+// <package_name> v<version>; otherwise every argument is a <package_name> or <package_name>@v<version>.
+// A package name can be scoped to a registry as <registry>/<package_name>.
+func parseAddArgs(args []string) ([]AddOptions, error) {
+	if len(args) == 0 {
+		return nil, validationError("expected at least one argument in the format <package_name>[@v<version_number>] (e.g., cosm add mypkg@v1.2.3)")
+	}
+	if len(args) == 2 && strings.HasPrefix(args[1], "v") && isVersionArg(args[1]) {
+		if strings.Contains(args[0], "@") {
+			return nil, fmt.Errorf("cannot specify version both as <package_name>@<version> and as a separate argument")
+		}
+		args = []string{args[0] + "@" + args[1]}
+	}
+	var deps []AddOptions
+	for _, arg := range args {
+		packageName, versionTag, found := strings.Cut(arg, "@")
+		if found && versionTag == "" {
+			return nil, validationError("version after '@' cannot be empty")
+		}
+		registryName, packageName, err := splitScopedName(packageName)
+		if err != nil {
+			return nil, err
+		}
+		if versionTag != "" {
+			if !strings.HasPrefix(versionTag, "v") {
+				return nil, validationError("version '%s' must start with 'v'", versionTag)
+			}
+			if !IsMajorVersion(versionTag) {
+				if _, err := ParseSemVer(versionTag); err != nil {
+					return nil, err
+				}
+			}
+		}
+		deps = append(deps, AddOptions{Name: packageName, Registry: registryName, Version: versionTag})
+	}
+	return deps, nil
+}
+
+// splitScopedName splits a package name scoped to a registry, <registry>/<package_name>, into the
+// registry name and the package name; the registry name is empty for an unscoped package name
+func splitScopedName(name string) (string, string, error) {
+	registryName, packageName, scoped := strings.Cut(name, "/")
+	if !scoped {
+		registryName, packageName = "", name
+	} else if registryName == "" {
+		return "", "", validationError("registry name in '%s' cannot be empty", name)
 	}
-	packageName := args[0]
 	if packageName == "" {
-		return "", "", fmt.Errorf("package name cannot be empty")
+		return "", "", validationError("package name cannot be empty")
+	}
+	return registryName, packageName, nil
+}
+
+// isVersionArg reports whether an argument of cosm add is a version rather than a package name
+func isVersionArg(arg string) bool {
+	if IsMajorVersion(arg) {
+		return true
 	}
-	versionTag := ""
-	if len(args) == 2 {
-		versionTag = args[1]
-		if !strings.HasPrefix(versionTag, "v") {
-			return "", "", fmt.Errorf("version '%s' must start with 'v'", versionTag)
+	_, err := ParseSemVer(arg)
+	return err == nil
+}
+
+// validateAlias checks that an alias is a valid name that no other dependency is imported as
+func validateAlias(project *types.Project, alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return validationError("invalid alias '%s': must start with a letter and contain only letters, digits, '-' and '_'", alias)
+	}
+	for _, dep := range project.Deps {
+		if dep.Alias == alias || (dep.Alias == "" && dep.Name == alias) {
+			return conflictError("alias '%s' is already used by dependency '%s' %s", alias, dep.Name, dep.Version)
 		}
 	}
-	return packageName, versionTag, nil
+	return nil
 }
 
 // updateDependency adds a dependency to the project's Deps map
-func updateDependency(project *types.Project, packageName, versionTag, depUUID string) error {
+func updateDependency(project *types.Project, depUUID string, dep types.Dependency) error {
 	// Ensure Deps map is initialized
 	if project.Deps == nil {
 		project.Deps = make(map[string]types.Dependency)
 	}
 
 	// Get major version for the key
-	majorVersion, err := GetMajorVersion(versionTag)
+	majorVersion, err := GetMajorVersion(dep.Version)
 	if err != nil {
-		return fmt.Errorf("failed to get major version for %s@%s: %v", packageName, versionTag, err)
+		return fmt.Errorf("failed to get major version for %s@%s: %w", dep.Name, dep.Version, err)
 	}
 
 	// Create the dependency key
@@ -73,26 +481,10 @@ func updateDependency(project *types.Project, packageName, versionTag, depUUID s
 
 	// Check if dependency already exists
 	if _, exists := project.Deps[depKey]; exists {
-		return fmt.Errorf("dependency '%s' with major version %s already exists in project", packageName, majorVersion)
+		return conflictError("dependency '%s' with major version %s already exists in project", dep.Name, majorVersion)
 	}
 
 	// Add the dependency
-	project.Deps[depKey] = types.Dependency{
-		Name:    packageName,
-		Version: versionTag,
-		Develop: false,
-	}
-	return nil
-}
-
-// updateProjectWithDependency adds the dependency and saves the updated project
-func updateProjectWithDependency(project *types.Project, packageName, versionTag, registryName, depUUID string) error {
-	if err := updateDependency(project, packageName, versionTag, depUUID); err != nil {
-		return err
-	}
-	if err := saveProject(project, "Project.json"); err != nil {
-		return err
-	}
-	fmt.Printf("Added dependency '%s' %s from registry '%s' to project\n", packageName, versionTag, registryName)
+	project.Deps[depKey] = dep
 	return nil
 }
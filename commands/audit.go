@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// advisoriesDir is the directory in a registry that holds the advisories, one directory per package
+const advisoriesDir = "advisories"
+
+// advisoryMatch is an advisory that affects a package in the build list
+type advisoryMatch struct {
+	registryName string
+	dep          types.BuildListDependency
+	advisory     types.Advisory
+}
+
+// Audit checks the build list of the project against the advisories of all registries and
+// fails if a package version in the build list is affected
+func Audit(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	project, err := validateActivate(args)
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return err
+	}
+	for _, registryName := range registryNames {
+		if err := updateSingleRegistry(ctx, registriesDir, registryName); err != nil {
+			logging.Warnf("failed to update registry '%s'; using its local advisories: %v", registryName, err)
+		}
+	}
+
+	buildList, err := loadCurrentBuildList(project, registriesDir)
+	if err != nil {
+		return err
+	}
+	matches, err := findAffectingAdvisories(&buildList, registriesDir, registryNames)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		logging.Infof("No known vulnerabilities in %d package(s)", len(buildList.Dependencies))
+		return nil
+	}
+	affected := make(map[string]bool)
+	for _, match := range matches {
+		affected[match.dep.UUID+"@"+match.dep.Version] = true
+		line := fmt.Sprintf("%s@%s: %s", match.dep.Name, match.dep.Version, match.advisory.ID)
+		if match.advisory.Severity != "" {
+			line += fmt.Sprintf(" (%s)", match.advisory.Severity)
+		}
+		line += fmt.Sprintf(" %s [%s]", match.advisory.Summary, match.registryName)
+		if match.advisory.Patched != "" {
+			line += fmt.Sprintf("; fixed in %s", match.advisory.Patched)
+		}
+		fmt.Println(line)
+	}
+	return fmt.Errorf("found %d advisory(ies) affecting %d package(s)", len(matches), len(affected))
+}
+
+// findAffectingAdvisories returns the advisories that affect the packages in the build list,
+// sorted by package name, version and advisory ID
+func findAffectingAdvisories(buildList *types.BuildList, registriesDir string, registryNames []string) ([]advisoryMatch, error) {
+	var matches []advisoryMatch
+	for _, dep := range buildList.Dependencies {
+		for _, registryName := range registryNames {
+			advisories, err := loadAdvisories(registriesDir, registryName, dep.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, advisory := range advisories {
+				if advisory.UUID != "" && advisory.UUID != dep.UUID {
+					continue
+				}
+				affected, err := advisoryAffects(advisory, dep.Version)
+				if err != nil {
+					return nil, fmt.Errorf("invalid advisory '%s' in registry '%s': %w", advisory.ID, registryName, err)
+				}
+				if affected {
+					matches = append(matches, advisoryMatch{registryName: registryName, dep: dep, advisory: advisory})
+				}
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dep.Name != matches[j].dep.Name {
+			return matches[i].dep.Name < matches[j].dep.Name
+		}
+		if matches[i].dep.Version != matches[j].dep.Version {
+			return matches[i].dep.Version < matches[j].dep.Version
+		}
+		return matches[i].advisory.ID < matches[j].advisory.ID
+	})
+	return matches, nil
+}
+
+// loadAdvisories reads the advisories of a package in a registry
+func loadAdvisories(registriesDir, registryName, packageName string) ([]types.Advisory, error) {
+	packageDir := filepath.Join(registriesDir, registryName, advisoriesDir, packageName)
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read advisories directory %s: %w", packageDir, err)
+	}
+	var advisories []types.Advisory
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		advisoryFile := filepath.Join(packageDir, entry.Name())
+		data, err := os.ReadFile(advisoryFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", advisoryFile, err)
+		}
+		var advisory types.Advisory
+		if err := json.Unmarshal(data, &advisory); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", advisoryFile, err)
+		}
+		if advisory.ID == "" {
+			advisory.ID = strings.TrimSuffix(entry.Name(), ".json")
+		}
+		if advisory.Package == "" {
+			advisory.Package = packageName
+		}
+		advisories = append(advisories, advisory)
+	}
+	return advisories, nil
+}
+
+// advisoryAffects reports whether a version lies in one of the affected ranges of an advisory
+func advisoryAffects(advisory types.Advisory, version string) (bool, error) {
+	for _, versionRange := range advisory.Affected {
+		affected, err := versionInRange(version, versionRange)
+		if err != nil || affected {
+			return affected, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,575 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// cacheEntry is a package version in the packages directory or a clone in the clones directory
+type cacheEntry struct {
+	name    string // package name
+	id      string // SHA1 of a package version or UUID of a clone
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// cacheCleanConfig holds the criteria for removing cache entries
+type cacheCleanConfig struct {
+	cosmDir   string
+	olderThan int  // days since the entry was last modified, 0 to ignore age
+	unused    bool // only remove entries that no recorded build list refers to
+}
+
+// CacheInfo prints the disk usage of the cached package versions and clones
+func CacheInfo(cmd *cobra.Command, args []string) error {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	packages, err := listCachedPackages(cosmDir)
+	if err != nil {
+		return err
+	}
+	clones, err := listCachedClones(cosmDir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	fmt.Printf("Cache in '%s':\n", cosmDir)
+	if len(packages) == 0 {
+		fmt.Println("  No cached packages.")
+	} else {
+		fmt.Println("  Packages:")
+		var names []string
+		versions := make(map[string]int)
+		sizes := make(map[string]int64)
+		for _, entry := range packages {
+			if versions[entry.name] == 0 {
+				names = append(names, entry.name)
+			}
+			versions[entry.name]++
+			sizes[entry.name] += entry.size
+			total += entry.size
+		}
+		for _, name := range names {
+			fmt.Printf("    - %s: %d version(s), %s\n", name, versions[name], formatSize(sizes[name]))
+		}
+	}
+	if len(clones) == 0 {
+		fmt.Println("  No clones.")
+	} else {
+		fmt.Println("  Clones:")
+		for _, entry := range clones {
+			fmt.Printf("    - %s (UUID: %s): %s\n", entry.name, entry.id, formatSize(entry.size))
+			total += entry.size
+		}
+	}
+	fmt.Printf("  Total: %s\n", formatSize(total))
+	return nil
+}
+
+// CacheClean removes cached package versions and clones that are older than a number of days
+// and/or not referred to by any build list written by 'cosm activate'
+func CacheClean(cmd *cobra.Command, args []string) error {
+	config, err := parseCacheCleanArgs(cmd)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockDepot(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	packages, err := listCachedPackages(config.cosmDir)
+	if err != nil {
+		return err
+	}
+	clones, err := listCachedClones(config.cosmDir)
+	if err != nil {
+		return err
+	}
+	usedPaths := make(map[string]bool)
+	if config.unused {
+		if usedPaths, err = collectUsedCachePaths(config.cosmDir); err != nil {
+			return err
+		}
+	}
+
+	var removedPackages, removedClones int
+	var freed int64
+	for _, entry := range packages {
+		if !shouldRemoveCacheEntry(config, entry, usedPaths) {
+			continue
+		}
+		if err := os.RemoveAll(entry.path); err != nil {
+			return fmt.Errorf("failed to remove cached package %s: %w", entry.path, err)
+		}
+		// Drop the package directory once its last version is gone
+		_ = os.Remove(filepath.Dir(entry.path))
+		removedPackages++
+		freed += entry.size
+	}
+	for _, entry := range clones {
+		if !shouldRemoveCacheEntry(config, entry, usedPaths) {
+			continue
+		}
+		if err := os.RemoveAll(entry.path); err != nil {
+			return fmt.Errorf("failed to remove clone %s: %w", entry.path, err)
+		}
+		removedClones++
+		freed += entry.size
+	}
+
+	if removedPackages == 0 && removedClones == 0 {
+		logging.Infof("No cache entries to remove")
+		return nil
+	}
+	logging.Infof("Removed %d package version(s) and %d clone(s), freeing %s", removedPackages, removedClones, formatSize(freed))
+	return nil
+}
+
+// CacheVerify checks that every cached package version matches the commit it was materialized from
+func CacheVerify(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	fix, err := cmd.Flags().GetBool("fix")
+	if err != nil {
+		return fmt.Errorf("failed to get fix flag: %w", err)
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	if fix {
+		unlock, err := lockDepot(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	packages, err := listCachedPackages(cosmDir)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	var corrupted []cacheEntry
+	var verified, skipped int
+	for _, entry := range packages {
+		project, err := loadProjectFromDir(entry.path)
+		if err == nil && project.UUID == "" {
+			err = fmt.Errorf("Project.json has no UUID")
+		}
+		var meta *types.PackageMeta
+		if err == nil {
+			meta, err = loadPackageMeta(entry.path)
+		}
+		if err == nil && meta != nil && (meta.Name != entry.name || meta.SHA1 != entry.id || meta.UUID != project.UUID) {
+			err = fmt.Errorf("%s records package '%s' (%s) at %s", packageMetaFile, meta.Name, meta.UUID, meta.SHA1)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %v", entry.name, entry.id, err))
+			corrupted = append(corrupted, entry)
+			continue
+		}
+		clonePath := filepath.Join(cosmDir, "clones", project.UUID)
+		if _, err := os.Stat(clonePath); os.IsNotExist(err) {
+			skipped++
+			continue
+		}
+		var subdir string
+		if meta != nil {
+			subdir = meta.Subdir
+		} else {
+			subdir = findPackageSubdir(registriesDir, project.UUID) // Materialized before cosm recorded its metadata
+		}
+		differences, err := diffPackageTree(ctx, clonePath, entry.id, subdir, entry.path)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s (%s): %w", entry.name, entry.id, err)
+		}
+		if len(differences) > 0 {
+			for _, difference := range differences {
+				problems = append(problems, fmt.Sprintf("%s (%s): %s", entry.name, entry.id, difference))
+			}
+			corrupted = append(corrupted, entry)
+			continue
+		}
+		verified++
+	}
+
+	if len(problems) == 0 {
+		logging.Infof("Verified %d cached package version(s)", verified)
+		if skipped > 0 {
+			logging.Infof("Skipped %d package version(s) without a clone", skipped)
+		}
+		return nil
+	}
+	fmt.Printf("Cache verification found %d problem(s):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	if !fix {
+		return fmt.Errorf("%d cached package version(s) do not match their SHA1; run 'cosm cache verify --fix' to remove them", len(corrupted))
+	}
+	for _, entry := range corrupted {
+		if err := os.RemoveAll(entry.path); err != nil {
+			return fmt.Errorf("failed to remove cached package %s: %w", entry.path, err)
+		}
+	}
+	logging.Infof("Removed %d corrupted package version(s); they are restored on the next activation", len(corrupted))
+	return nil
+}
+
+// CacheArchive writes an archive of every package version in the build list of the project to the
+// depot, and uploads them to the artifact store with --upload
+func CacheArchive(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	upload, _ := cmd.Flags().GetBool("upload")
+	archiveURL := currentConfig().ArchiveURL
+	if upload && archiveURL == "" {
+		return validationError("--upload requires an artifact store; set it with 'cosm config set archiveurl <url>'")
+	}
+	project, err := validateActivate(args)
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	buildList, err := loadCurrentBuildList(project, registriesDir)
+	if err != nil {
+		return err
+	}
+
+	archived, uploaded := 0, 0
+	for _, dep := range buildList.Dependencies {
+		if filepath.IsAbs(dep.Path) {
+			continue // Vendored packages are part of the project
+		}
+		specs, _, err := findDependency(dep.Name, dep.Version, dep.UUID, "", registriesDir)
+		if err != nil {
+			return err
+		}
+		specs.SHA1 = dep.SHA1 // The commit a dependency is pinned to, if not the release
+		if err := MakePackageAvailable(ctx, cosmDir, &specs); err != nil {
+			return fmt.Errorf("failed to make package '%s@%s' available: %w", dep.Name, dep.Version, err)
+		}
+		archivePath := packageArchivePath(cosmDir, &specs)
+		if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+			if err := writePackageArchive(packagePath(cosmDir, dep), archivePath); err != nil {
+				return fmt.Errorf("failed to archive '%s@%s': %w", dep.Name, dep.Version, err)
+			}
+			archived++
+		}
+		if upload {
+			if err := uploadPackageArchive(ctx, packageArchiveURL(archiveURL, &specs), archivePath); err != nil {
+				return fmt.Errorf("failed to upload the archive of '%s@%s': %w", dep.Name, dep.Version, err)
+			}
+			uploaded++
+		}
+	}
+	logging.Infof("Archived %d package version(s) in %s", archived, filepath.Join(cosmDir, "archives"))
+	if upload {
+		logging.Infof("Uploaded %d archive(s) to %s", uploaded, archiveURL)
+	}
+	return nil
+}
+
+// parseCacheCleanArgs reads the --older-than and --unused flags
+func parseCacheCleanArgs(cmd *cobra.Command) (*cacheCleanConfig, error) {
+	olderThan, err := cmd.Flags().GetInt("older-than")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get older-than flag: %w", err)
+	}
+	unused, err := cmd.Flags().GetBool("unused")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unused flag: %w", err)
+	}
+	if olderThan < 0 {
+		return nil, validationError("--older-than must be a positive number of days")
+	}
+	if olderThan == 0 && !unused {
+		return nil, validationError("cache clean requires --older-than <days> and/or --unused")
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return nil, err
+	}
+	return &cacheCleanConfig{cosmDir: cosmDir, olderThan: olderThan, unused: unused}, nil
+}
+
+// shouldRemoveCacheEntry reports whether an entry satisfies all the given clean criteria
+func shouldRemoveCacheEntry(config *cacheCleanConfig, entry cacheEntry, usedPaths map[string]bool) bool {
+	if config.olderThan > 0 && time.Since(entry.modTime) < time.Duration(config.olderThan)*24*time.Hour {
+		return false
+	}
+	if config.unused && usedPaths[entry.path] {
+		return false
+	}
+	return true
+}
+
+// collectUsedCachePaths returns the package versions and clones referred to by the recorded
+// build lists. Build lists that no longer exist are dropped from the record.
+func collectUsedCachePaths(cosmDir string) (map[string]bool, error) {
+	buildListFiles, err := loadBuildListUsage(cosmDir)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	existing := []string{}
+	for _, buildListFile := range buildListFiles {
+		if _, err := os.Stat(buildListFile); os.IsNotExist(err) {
+			continue
+		}
+		buildList, err := loadBuildListFile(buildListFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load build list %s: %w", buildListFile, err)
+		}
+		for _, dep := range buildList.Dependencies {
+			used[filepath.Join(cosmDir, filepath.FromSlash(dep.Path))] = true
+			used[filepath.Join(cosmDir, "clones", dep.UUID)] = true
+		}
+		existing = append(existing, buildListFile)
+	}
+	if len(existing) != len(buildListFiles) {
+		if err := saveBuildListUsage(cosmDir, existing); err != nil {
+			return nil, err
+		}
+	}
+	return used, nil
+}
+
+// listCachedPackages returns the package versions in the packages directory, sorted by name
+func listCachedPackages(cosmDir string) ([]cacheEntry, error) {
+	packagesDir := filepath.Join(cosmDir, "packages")
+	names, err := listSubdirs(packagesDir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	for _, name := range names {
+		sha1s, err := listSubdirs(filepath.Join(packagesDir, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, sha1 := range sha1s {
+			entry, err := newCacheEntry(name, sha1, filepath.Join(packagesDir, name, sha1))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// listCachedClones returns the package clones in the clones directory, sorted by UUID
+func listCachedClones(cosmDir string) ([]cacheEntry, error) {
+	clonesDir := filepath.Join(cosmDir, "clones")
+	uuids, err := listSubdirs(clonesDir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	for _, uuid := range uuids {
+		if strings.HasPrefix(uuid, tempDirPrefix) {
+			continue // in use by a running command
+		}
+		name := uuid
+		if project, err := loadProjectFromDir(filepath.Join(clonesDir, uuid)); err == nil {
+			name = project.Name
+		}
+		entry, err := newCacheEntry(name, uuid, filepath.Join(clonesDir, uuid))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// newCacheEntry describes the cache directory at path
+func newCacheEntry(name, id, path string) (cacheEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return cacheEntry{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	size, err := dirSize(path)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	return cacheEntry{name: name, id: id, path: path, size: size, modTime: info.ModTime()}, nil
+}
+
+// listSubdirs returns the sorted names of the directories in dir, or none if dir does not exist
+func listSubdirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// dirSize returns the total size of the regular files below dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute size of %s: %w", dir, err)
+	}
+	return size, nil
+}
+
+// formatSize formats a number of bytes using binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes) / unit
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TiB", value)
+}
+
+// findPackageSubdir returns the monorepo subdirectory registered for the package with the given UUID
+func findPackageSubdir(registriesDir, uuid string) string {
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return ""
+	}
+	for _, registryName := range registryNames {
+		registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+		if err != nil {
+			continue
+		}
+		for _, pkgInfo := range registry.Packages {
+			if pkgInfo.UUID == uuid {
+				return pkgInfo.Subdir
+			}
+		}
+	}
+	return ""
+}
+
+// diffPackageTree compares a materialized package directory with the tree of the commit sha1
+// (or of subdir within it) in the clone, and describes the files that differ
+func diffPackageTree(ctx context.Context, clonePath, sha1, subdir, packageDir string) ([]string, error) {
+	treeish := sha1
+	if subdir != "" {
+		treeish = sha1 + ":" + filepath.ToSlash(subdir)
+	}
+	output, err := GitCommand(ctx, clonePath, "ls-tree", "-r", "-z", treeish)
+	if err != nil {
+		return nil, wrapGitError(clonePath, fmt.Sprintf("failed to list files of commit %s", sha1), err)
+	}
+
+	// Files in the commit, without .gitignore files which are not materialized
+	expected := make(map[string]string)
+	symlinks := make(map[string]bool)
+	for _, line := range strings.Split(output, "\x00") {
+		meta, path, found := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 3 || fields[1] != "blob" || filepath.Base(path) == ".gitignore" {
+			continue
+		}
+		expected[path] = fields[2]
+		symlinks[path] = fields[0] == "120000"
+	}
+
+	// Files in the package directory
+	var differences, toHash []string
+	present := make(map[string]bool)
+	err = filepath.Walk(packageDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(packageDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == packageMetaFile {
+			return nil
+		}
+		present[relPath] = true
+		if _, exists := expected[relPath]; !exists {
+			differences = append(differences, fmt.Sprintf("unexpected file '%s'", relPath))
+		} else if !symlinks[relPath] {
+			toHash = append(toHash, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", packageDir, err)
+	}
+	for path := range expected {
+		if !present[path] {
+			differences = append(differences, fmt.Sprintf("missing file '%s'", path))
+		}
+	}
+
+	// Compare the content of the files in batches, to keep the command lines short
+	const batchSize = 500
+	for start := 0; start < len(toHash); start += batchSize {
+		batch := toHash[start:min(start+batchSize, len(toHash))]
+		args := []string{"--no-filters", "--"}
+		for _, relPath := range batch {
+			args = append(args, filepath.Join(packageDir, filepath.FromSlash(relPath)))
+		}
+		output, err := GitCommand(ctx, clonePath, "hash-object", args...)
+		if err != nil {
+			return nil, wrapGitError(clonePath, "failed to hash package files", err)
+		}
+		hashes := strings.Split(output, "\n")
+		if len(hashes) != len(batch) {
+			return nil, fmt.Errorf("expected %d hashes from git hash-object, got %d", len(batch), len(hashes))
+		}
+		for i, relPath := range batch {
+			if strings.TrimSpace(hashes[i]) != expected[relPath] {
+				differences = append(differences, fmt.Sprintf("modified file '%s'", relPath))
+			}
+		}
+	}
+	sort.Strings(differences)
+	return differences, nil
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Clone checks out the source of a registered package at a released version, resolving its git
+// URL and release tag from the registries
+func Clone(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) < 1 || len(args) > 2 {
+		return validationError("requires a package and an optional directory (e.g., cosm clone <package>[@v<version>] [<dir>])")
+	}
+	packageName, versionTag, found := strings.Cut(args[0], "@")
+	if packageName == "" {
+		return validationError("package name cannot be empty")
+	}
+	if found && !strings.HasPrefix(versionTag, "v") {
+		return validationError("version '%s' must start with 'v'", versionTag)
+	}
+	destDir := packageName
+	if len(args) == 2 {
+		destDir = args[1]
+	}
+	if _, err := os.Stat(destDir); err == nil {
+		return conflictError("destination '%s' already exists", destDir)
+	}
+	includePrerelease, _ := cmd.Flags().GetBool("pre")
+
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return err
+	}
+	if registryName, _ := cmd.Flags().GetString("registry"); registryName != "" {
+		if !contains(registryNames, registryName) {
+			return notFoundError("registry '%s' not found in registries.json", registryName)
+		}
+		registryNames = []string{registryName}
+	}
+	pkg, err := findPackageInRegistries(ctx, packageName, versionTag, includePrerelease, registriesDir, registryNames)
+	if err != nil {
+		return err
+	}
+
+	if err := cloneSourceCheckout(ctx, &pkg.Specs, destDir); err != nil {
+		return err
+	}
+	if pkg.Specs.Subdir != "" {
+		logging.Infof("Cloned package '%s' %s from registry '%s' to %s", packageName, pkg.Specs.Version, pkg.RegistryName, filepath.Join(destDir, pkg.Specs.Subdir))
+		return nil
+	}
+	logging.Infof("Cloned package '%s' %s from registry '%s' to %s", packageName, pkg.Specs.Version, pkg.RegistryName, destDir)
+	return nil
+}
+
+// cloneSourceCheckout clones the repository of a package version to destDir, trying the mirrors
+// if the primary URL fails, and checks out its release tag with submodules
+func cloneSourceCheckout(ctx context.Context, specs *types.Specs, destDir string) error {
+	absDest, err := filepath.Abs(destDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path for %s: %w", destDir, err)
+	}
+	var cloneErrs []error
+	for _, gitURL := range append([]string{specs.GitURL}, specs.Mirrors...) {
+		_, err := clone(ctx, gitURL, filepath.Dir(absDest), filepath.Base(absDest))
+		if err == nil {
+			cloneErrs = nil
+			break
+		}
+		cloneErrs = append(cloneErrs, err)
+		os.RemoveAll(absDest)
+	}
+	if len(cloneErrs) > 0 {
+		return fmt.Errorf("failed to clone '%s': %w", specs.Name, errors.Join(cloneErrs...))
+	}
+	if len(specs.Mirrors) > 0 {
+		if _, err := GitCommand(ctx, absDest, "remote", "set-url", "origin", specs.GitURL); err != nil {
+			return wrapGitError(absDest, "failed to set origin URL", err)
+		}
+	}
+
+	// Check out the release tag, or the registered commit if the tag was moved or deleted
+	ref := specs.SHA1
+	tag := releaseTagPrefix(specs.Name, specs.Subdir) + specs.Version
+	if tagSHA1, err := GitCommand(ctx, absDest, "rev-list", "-n", "1", tag); err == nil && strings.TrimSpace(tagSHA1) == specs.SHA1 {
+		ref = tag
+	} else {
+		logging.Warnf("tag '%s' does not point to the registered commit %s; checking out the commit", tag, specs.SHA1)
+	}
+	if _, err := GitCommand(ctx, absDest, "checkout", "--quiet", ref); err != nil {
+		return wrapGitError(absDest, fmt.Sprintf("failed to check out '%s'", ref), err)
+	}
+	return updateSubmodules(ctx, absDest)
+}
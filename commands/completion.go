@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Completion prints the completion script of a shell
+func Completion(cmd *cobra.Command, args []string) error {
+	root := cmd.Root()
+	switch args[0] {
+	case "bash":
+		return root.GenBashCompletionV2(os.Stdout, true)
+	case "zsh":
+		return root.GenZshCompletion(os.Stdout)
+	case "fish":
+		return root.GenFishCompletion(os.Stdout, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(os.Stdout)
+	}
+	return validationError("unsupported shell '%s' (must be bash, zsh, fish or powershell)", args[0])
+}
+
+// CompleteRegistryNames completes the first argument with the names of the registries
+func CompleteRegistryNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return matching(completionRegistryNames(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteRegistryPackages completes a registry name followed by a package of that registry
+func CompleteRegistryPackages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return matching(completionRegistryNames(), toComplete), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		return matching(completionPackageNames([]string{args[0]}), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteRegistryVersions completes a registry name, a package of that registry and a version of the package
+func CompleteRegistryVersions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 2 {
+		return matching(completionVersions([]string{args[0]}, args[1]), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	return CompleteRegistryPackages(cmd, args, toComplete)
+}
+
+// CompletePackages completes a package of any registry followed by one of its versions, or <package>@<version>
+func CompletePackages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	registryNames := completionRegistryNames()
+	switch len(args) {
+	case 0:
+		if name, _, found := strings.Cut(toComplete, "@"); found {
+			return matching(prefixed(name+"@", completionVersions(registryNames, name)), toComplete), cobra.ShellCompDirectiveNoFileComp
+		}
+		return matching(completionPackageNames(registryNames), toComplete), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		if !strings.Contains(args[0], "@") {
+			return matching(completionVersions(registryNames, args[0]), toComplete), cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteClone completes the package of cosm clone like CompletePackages, then the directory
+func CompleteClone(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return CompletePackages(cmd, args, toComplete)
+	}
+	if len(args) == 1 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteDependencyNames completes the dependencies of the project in the current directory that
+// are not among the arguments yet
+func CompleteDependencyNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	project, err := loadProject("Project.json")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := make(map[string]bool)
+	for _, dep := range project.Deps {
+		names[dep.Name] = true
+	}
+	for _, arg := range args {
+		delete(names, arg)
+	}
+	return matching(sortedKeys(names), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteDependencies completes a dependency of the project in the current directory followed by
+// one of its versions in the registries
+func CompleteDependencies(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		project, err := loadProject("Project.json")
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names := make(map[string]bool)
+		for _, dep := range project.Deps {
+			names[dep.Name] = true
+		}
+		return matching(sortedKeys(names), toComplete), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		return matching(completionVersions(completionRegistryNames(), args[0]), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteTemplateSources completes the first argument with the names of the template sources
+func CompleteTemplateSources(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cosmDir, err := getCosmDir()
+	if len(args) > 0 || err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, _ := listSubdirs(filepath.Join(cosmDir, "template-sources"))
+	return matching(append([]string{defaultTemplateSource}, names...), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteConfigKeys completes the first argument with the names of the settings
+func CompleteConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, key := range configKeys {
+		names = append(names, key.name+"\t"+key.usage)
+	}
+	return matching(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionRegistriesDir returns the registries directory without creating the depot,
+// which is not initialized for completion requests
+func completionRegistriesDir() string {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cosmDir, "registries")
+}
+
+// completionRegistryNames returns the names in registries.json, or nil if they cannot be read
+func completionRegistryNames() []string {
+	registriesDir := completionRegistriesDir()
+	if registriesDir == "" {
+		return nil
+	}
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return nil
+	}
+	sort.Strings(registryNames)
+	return registryNames
+}
+
+// completionPackageNames returns the sorted names of the packages in the registries
+func completionPackageNames(registryNames []string) []string {
+	registriesDir := completionRegistriesDir()
+	names := make(map[string]bool)
+	for _, registryName := range registryNames {
+		registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+		if err != nil {
+			continue
+		}
+		for name := range registry.Packages {
+			names[name] = true
+		}
+	}
+	return sortedKeys(names)
+}
+
+// completionVersions returns the versions of a package in the registries, newest first
+func completionVersions(registryNames []string, packageName string) []string {
+	if packageName == "" {
+		return nil
+	}
+	registriesDir := completionRegistriesDir()
+	seen := make(map[string]bool)
+	var versions []string
+	for _, registryName := range registryNames {
+		registryVersions, err := loadVersions(registriesDir, registryName, packageName)
+		if err != nil {
+			continue
+		}
+		for _, version := range registryVersions {
+			if !seen[version] {
+				seen[version] = true
+				versions = append(versions, version)
+			}
+		}
+	}
+	sortVersions(versions)
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions
+}
+
+// sortedKeys returns the keys of a set in alphabetical order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// matching returns the completions that start with the text to complete; a completion may be
+// followed by a tab and its description
+func matching(completions []string, toComplete string) []string {
+	var result []string
+	for _, completion := range completions {
+		if strings.HasPrefix(completion, toComplete) {
+			result = append(result, completion)
+		}
+	}
+	return result
+}
+
+// prefixed returns the values with a prefix
+func prefixed(prefix string, values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = prefix + value
+	}
+	return result
+}
@@ -0,0 +1,392 @@
+package commands
+
+import (
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// configKey describes a setting of config.json and the environment variable that overrides it
+type configKey struct {
+	name  string
+	env   string
+	usage string
+	get   func(cfg *types.Config) string
+	set   func(cfg *types.Config, value string) error
+}
+
+// configKeys lists the settings in the order in which cosm config list prints them
+var configKeys = []configKey{
+	{
+		name:  "defaultregistry",
+		env:   "COSM_DEFAULT_REGISTRY",
+		usage: "registry preferred when a package is found in several registries",
+		get:   func(cfg *types.Config) string { return cfg.DefaultRegistry },
+		set: func(cfg *types.Config, value string) error {
+			cfg.DefaultRegistry = value
+			return nil
+		},
+	},
+	{
+		name:  "author",
+		env:   "COSM_AUTHOR",
+		usage: "author of new projects ([name]email), instead of the git user",
+		get:   func(cfg *types.Config) string { return cfg.Author },
+		set: func(cfg *types.Config, value string) error {
+			if _, _, ok := parseAuthor(value); value != "" && !ok {
+				return fmt.Errorf("author must have the form [name]email")
+			}
+			cfg.Author = value
+			return nil
+		},
+	},
+	{
+		name:  "offline",
+		env:   "COSM_OFFLINE",
+		usage: "do not pull registries or clone templates (true or false)",
+		get:   func(cfg *types.Config) string { return strconv.FormatBool(cfg.Offline) },
+		set: func(cfg *types.Config, value string) error {
+			if value == "" {
+				cfg.Offline = false
+				return nil
+			}
+			offline, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("offline must be true or false")
+			}
+			cfg.Offline = offline
+			return nil
+		},
+	},
+	{
+		name:  "parallelism",
+		env:   "COSM_PARALLELISM",
+		usage: "number of registries updated or published to concurrently",
+		get:   func(cfg *types.Config) string { return strconv.Itoa(cfg.Parallelism) },
+		set: func(cfg *types.Config, value string) error {
+			if value == "" {
+				cfg.Parallelism = 0
+				return nil
+			}
+			parallelism, err := strconv.Atoi(value)
+			if err != nil || parallelism < 1 {
+				return fmt.Errorf("parallelism must be a positive number")
+			}
+			cfg.Parallelism = parallelism
+			return nil
+		},
+	},
+	{
+		name:  "timeout",
+		env:   "COSM_TIMEOUT",
+		usage: "timeout of git commands that contact a remote, e.g. 90s or 5m (default 10m)",
+		get:   func(cfg *types.Config) string { return cfg.Timeout },
+		set: func(cfg *types.Config, value string) error {
+			if value == "" {
+				cfg.Timeout = ""
+				return nil
+			}
+			if timeout, err := time.ParseDuration(value); err != nil || timeout <= 0 {
+				return fmt.Errorf("timeout must be a positive duration, e.g. 90s or 5m")
+			}
+			cfg.Timeout = value
+			return nil
+		},
+	},
+	{
+		name:  "retries",
+		env:   "COSM_RETRIES",
+		usage: "retries of git commands that contact a remote after transient failures (default 3)",
+		get: func(cfg *types.Config) string {
+			if cfg.Retries == nil {
+				return ""
+			}
+			return strconv.Itoa(*cfg.Retries)
+		},
+		set: func(cfg *types.Config, value string) error {
+			if value == "" {
+				cfg.Retries = nil
+				return nil
+			}
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				return fmt.Errorf("retries must be zero or a positive number")
+			}
+			cfg.Retries = &retries
+			return nil
+		},
+	},
+	{
+		name:  "refreshinterval",
+		env:   "COSM_REFRESH_INTERVAL",
+		usage: "minimum time between pulls of a registry when packages are looked up, e.g. 1h; 0 pulls every time (default 5m)",
+		get:   func(cfg *types.Config) string { return cfg.RefreshInterval },
+		set: func(cfg *types.Config, value string) error {
+			if value == "" {
+				cfg.RefreshInterval = ""
+				return nil
+			}
+			if interval, err := time.ParseDuration(value); err != nil || interval < 0 {
+				return fmt.Errorf("refreshinterval must be a duration, e.g. 30s or 1h, or 0")
+			}
+			cfg.RefreshInterval = value
+			return nil
+		},
+	},
+	{
+		name:  "templatesurl",
+		env:   "COSM_TEMPLATES_URL",
+		usage: "repository of the default template source",
+		get:   func(cfg *types.Config) string { return cfg.TemplatesURL },
+		set: func(cfg *types.Config, value string) error {
+			cfg.TemplatesURL = value
+			return nil
+		},
+	},
+	{
+		name:  "platform",
+		env:   "COSM_PLATFORM",
+		usage: "platform <os>/<arch> that platform-specific dependencies are resolved for (default: the current platform)",
+		get:   func(cfg *types.Config) string { return cfg.Platform },
+		set: func(cfg *types.Config, value string) error {
+			if value != "" && (!platformPattern.MatchString(value) || !strings.Contains(value, "/")) {
+				return fmt.Errorf("platform must have the form <os>/<arch>, e.g. linux/amd64")
+			}
+			cfg.Platform = value
+			return nil
+		},
+	},
+	{
+		name:  "archiveurl",
+		env:   "COSM_ARCHIVE_URL",
+		usage: "artifact store with package archives, an http, https or file URL",
+		get:   func(cfg *types.Config) string { return cfg.ArchiveURL },
+		set: func(cfg *types.Config, value string) error {
+			if value != "" {
+				if err := validateArchiveURL(value); err != nil {
+					return err
+				}
+			}
+			cfg.ArchiveURL = value
+			return nil
+		},
+	},
+	{
+		name:  "license",
+		env:   "COSM_LICENSE",
+		usage: "license of new projects",
+		get:   func(cfg *types.Config) string { return cfg.License },
+		set: func(cfg *types.Config, value string) error {
+			cfg.License = value
+			return nil
+		},
+	},
+	{
+		name:  "stageregistry",
+		env:   "COSM_STAGE_REGISTRY",
+		usage: "commit registry changes locally until cosm registry push (true or false)",
+		get:   func(cfg *types.Config) string { return strconv.FormatBool(cfg.StageRegistry) },
+		set: func(cfg *types.Config, value string) error {
+			if value == "" {
+				cfg.StageRegistry = false
+				return nil
+			}
+			stage, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("stageregistry must be true or false")
+			}
+			cfg.StageRegistry = stage
+			return nil
+		},
+	},
+}
+
+// ConfigList prints every setting with its effective value
+func ConfigList(cmd *cobra.Command, args []string) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	for _, key := range configKeys {
+		line := fmt.Sprintf("%s = %s", key.name, key.get(&cfg))
+		if _, set := os.LookupEnv(key.env); set {
+			line += fmt.Sprintf(" (from %s)", key.env)
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// ConfigGet prints the effective value of a setting
+func ConfigGet(cmd *cobra.Command, args []string) error {
+	key, err := findConfigKey(args[0])
+	if err != nil {
+		return err
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key.get(&cfg))
+	return nil
+}
+
+// ConfigSet stores a setting in config.json; an empty value restores the default
+func ConfigSet(cmd *cobra.Command, args []string) error {
+	key, err := findConfigKey(args[0])
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfigFile(cosmDir)
+	if err != nil {
+		return err
+	}
+	if err := key.set(&cfg, args[1]); err != nil {
+		return validationError("invalid value '%s' for %s: %w", args[1], key.name, err)
+	}
+	if err := saveConfigFile(cosmDir, &cfg); err != nil {
+		return err
+	}
+	logging.Infof("Set %s to '%s'", key.name, key.get(&cfg))
+	if _, set := os.LookupEnv(key.env); set {
+		logging.Warnf("%s is overridden by %s", key.name, key.env)
+	}
+	return nil
+}
+
+// findConfigKey looks up a setting by name
+func findConfigKey(name string) (configKey, error) {
+	var names []string
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, nil
+		}
+		names = append(names, key.name)
+	}
+	return configKey{}, validationError("unknown config key '%s' (valid keys: %s)", name, strings.Join(names, ", "))
+}
+
+// configOverrides holds the settings given on the command line; they take precedence over the environment
+var configOverrides = make(map[string]string)
+
+// OverrideConfig sets a setting for this run of cosm, e.g. from a command line flag
+func OverrideConfig(name, value string) error {
+	key, err := findConfigKey(name)
+	if err != nil {
+		return err
+	}
+	if err := key.set(&types.Config{}, value); err != nil {
+		return validationError("invalid value '%s' for %s: %w", value, name, err)
+	}
+	configOverrides[name] = value
+	return nil
+}
+
+// LoadConfig reads config.json from the depot and applies the overrides of the environment and the command line
+func LoadConfig() (types.Config, error) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return types.Config{}, err
+	}
+	cfg, err := loadConfigFile(cosmDir)
+	if err != nil {
+		return types.Config{}, err
+	}
+	for _, key := range configKeys {
+		if value, set := os.LookupEnv(key.env); set {
+			if err := key.set(&cfg, value); err != nil {
+				return types.Config{}, validationError("invalid value '%s' in %s: %w", value, key.env, err)
+			}
+		}
+		if value, set := configOverrides[key.name]; set {
+			key.set(&cfg, value) // Validated by OverrideConfig
+		}
+	}
+	return cfg, nil
+}
+
+// defaultNetworkTimeout is the timeout of git commands that contact a remote, unless timeout is configured
+const defaultNetworkTimeout = 10 * time.Minute
+
+// networkTimeout returns the timeout of git commands that contact a remote
+func networkTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(currentConfig().Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultNetworkTimeout
+}
+
+// defaultNetworkRetries is the number of retries of git commands that contact a remote, unless retries is configured
+const defaultNetworkRetries = 3
+
+// networkRetries returns the number of retries of git commands that contact a remote
+func networkRetries() int {
+	if retries := currentConfig().Retries; retries != nil {
+		return *retries
+	}
+	return defaultNetworkRetries
+}
+
+// defaultRefreshInterval is the minimum time between pulls of a registry when packages are looked
+// up, unless refreshinterval is configured
+const defaultRefreshInterval = 5 * time.Minute
+
+// refreshInterval returns the minimum time between pulls of a registry when packages are looked up
+func refreshInterval() time.Duration {
+	if interval, err := time.ParseDuration(currentConfig().RefreshInterval); err == nil && interval >= 0 {
+		return interval
+	}
+	return defaultRefreshInterval
+}
+
+// currentConfig returns the effective configuration, or the defaults if it cannot be loaded;
+// invalid configurations are reported at startup
+func currentConfig() types.Config {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return types.Config{}
+	}
+	return cfg
+}
+
+// loadConfigFile reads config.json from the depot without environment overrides
+func loadConfigFile(cosmDir string) (types.Config, error) {
+	var cfg types.Config
+	configFile := filepath.Join(cosmDir, "config.json")
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("failed to read %s: %w", configFile, err)
+	}
+	if err := unmarshalValidated("config.schema.json", data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %w", configFile, err)
+	}
+	return cfg, nil
+}
+
+// saveConfigFile writes config.json to the depot
+func saveConfigFile(cosmDir string, cfg *types.Config) error {
+	configFile := filepath.Join(cosmDir, "config.json")
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", configFile, err)
+	}
+	if err := writeMetadataFile(configFile, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", configFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"cosm/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// JSON-RPC 2.0 error codes returned by the daemon
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcCommandError   = -32000 // A cosm error; its kind and exit code are in the data
+)
+
+// rpcRequest is a JSON-RPC 2.0 request, sent as a single line on the daemon socket
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response, written as a single line
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// rpcParams holds the parameters of all methods; each method uses a subset
+type rpcParams struct {
+	Project    string `json:"project"`    // Absolute project directory, for resolve, add and watch
+	Name       string `json:"name"`       // Package to add
+	Version    string `json:"version"`    // Version to add, as for cosm add
+	Alias      string `json:"alias"`      // Name the added dependency is imported as
+	Prerelease bool   `json:"prerelease"` // Select prereleases when the latest version is added
+	NoResolve  bool   `json:"noresolve"`  // Do not regenerate the build list of the project
+	Query      string `json:"query"`      // Search pattern
+	Regex      bool   `json:"regex"`      // Interpret the search pattern as a regular expression
+	Registry   string `json:"registry"`   // Restrict the search to a registry
+}
+
+// rpcAddResult is the result of the add method
+type rpcAddResult struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	UUID     string `json:"uuid"`
+	Registry string `json:"registry"`
+	Alias    string `json:"alias,omitempty"`
+}
+
+// daemon is the state of a running cosm daemon
+type daemon struct {
+	mu            sync.Mutex // Serializes requests and background work
+	cosmDir       string
+	registriesDir string
+	watched       map[string]string // Project directory -> hash of its build list inputs when it was last resolved
+}
+
+// Daemon keeps the registries fresh, pre-warms the packages of the projects that use the depot,
+// and serves resolve, add and search requests on a Unix socket until it is interrupted
+func Daemon(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	socketPath, _ := cmd.Flags().GetString("socket")
+	if socketPath == "" {
+		socketPath = filepath.Join(cosmDir, "daemon.sock")
+	}
+	interval, _ := cmd.Flags().GetDuration("interval")
+	poll, _ := cmd.Flags().GetDuration("poll")
+	if interval <= 0 || poll <= 0 {
+		return validationError("--interval and --poll must be positive durations")
+	}
+
+	listener, err := listenDaemonSocket(socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+	d := &daemon{cosmDir: cosmDir, registriesDir: setupRegistriesDir(cosmDir), watched: make(map[string]string)}
+	go d.serve(ctx, listener)
+	logging.Infof("Daemon listening on %s", socketPath)
+
+	d.refreshRegistries(ctx)
+	d.pollProjects(ctx)
+	refresh := time.NewTicker(interval)
+	defer refresh.Stop()
+	watch := time.NewTicker(poll)
+	defer watch.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			listener.Close()
+			logging.Infof("Daemon stopped")
+			return nil
+		case <-refresh.C:
+			d.refreshRegistries(ctx)
+		case <-watch.C:
+			d.pollProjects(ctx)
+		}
+	}
+}
+
+// listenDaemonSocket listens on a Unix socket, replacing a stale socket file left by a daemon that
+// did not exit cleanly
+func listenDaemonSocket(socketPath string) (net.Listener, error) {
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return nil, conflictError("a daemon is already listening on %s", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", socketPath, err)
+		}
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	return listener, nil
+}
+
+// serve accepts connections until the listener is closed
+func (d *daemon) serve(ctx context.Context, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logging.Warnf("daemon stopped accepting connections: %v", err)
+			}
+			return
+		}
+		go d.handleConnection(ctx, conn)
+	}
+}
+
+// handleConnection answers the requests on a connection, one JSON object per line
+func (d *daemon) handleConnection(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := encoder.Encode(d.handleRequest(ctx, scanner.Bytes())); err != nil {
+			return
+		}
+	}
+}
+
+// handleRequest decodes and dispatches a request
+func (d *daemon) handleRequest(ctx context.Context, line []byte) rpcResponse {
+	var request rpcRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}}
+	}
+	response := rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	if response.ID == nil {
+		response.ID = json.RawMessage("null")
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		response.Error = &rpcError{Code: rpcInvalidRequest, Message: "expected a JSON-RPC 2.0 request with a method"}
+		return response
+	}
+	var params rpcParams
+	if len(request.Params) > 0 {
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			response.Error = &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+			return response
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Every request is an operation of its own in the journal, so that it is recorded when it is
+	// done and cosm undo reverts it alone
+	command := "cosm daemon " + request.Method
+	for _, arg := range []string{params.Name, params.Version} {
+		if arg != "" {
+			command += " " + arg
+		}
+	}
+	beginOperation(command, params.Project)
+	var err error
+	defer func() { FinishOperation(err) }()
+	switch request.Method {
+	case "resolve":
+		response.Result, err = d.resolve(ctx, params)
+	case "add":
+		response.Result, err = d.add(ctx, params)
+	case "search":
+		response.Result, err = d.search(ctx, params)
+	case "watch":
+		response.Result, err = d.watch(params)
+	default:
+		response.Error = &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method '%s' (valid methods: resolve, add, search, watch)", request.Method)}
+		return response
+	}
+	if err != nil {
+		response.Result = nil
+		response.Error = &rpcError{Code: rpcCommandError, Message: err.Error(), Data: map[string]any{"kind": KindOf(err), "exitcode": ExitCode(err)}}
+	}
+	return response
+}
+
+// projectParam returns the project directory of a request, which must be absolute since the
+// daemon does not share the working directory of its clients
+func projectParam(params rpcParams) (string, error) {
+	if params.Project == "" || !filepath.IsAbs(params.Project) {
+		return "", validationError("requires the absolute path of a project directory")
+	}
+	return filepath.Clean(params.Project), nil
+}
+
+// resolve returns the build list of a project without writing it
+func (d *daemon) resolve(ctx context.Context, params rpcParams) (any, error) {
+	projectDir, err := projectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	buildList, err := ResolveBuildList(ctx, ResolveOptions{ProjectDir: projectDir})
+	if err != nil {
+		return nil, err
+	}
+	return buildList, nil
+}
+
+// add adds a dependency to a project as cosm add does
+func (d *daemon) add(ctx context.Context, params rpcParams) (any, error) {
+	projectDir, err := projectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Name == "" {
+		return nil, validationError("requires the name of the package to add")
+	}
+	registryName, packageName, err := splitScopedName(params.Name)
+	if err != nil {
+		return nil, err
+	}
+	result, err := AddDependency(ctx, AddOptions{
+		ProjectDir: projectDir,
+		Name:       packageName,
+		Registry:   registryName,
+		Version:    params.Version,
+		Prerelease: params.Prerelease,
+		Alias:      params.Alias,
+		NoResolve:  params.NoResolve,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rpcAddResult{Name: result.Name, Version: result.Version, UUID: result.UUID, Registry: result.Registry, Alias: result.Alias}, nil
+}
+
+// search returns the packages whose name or keywords match, sorted by name
+func (d *daemon) search(ctx context.Context, params rpcParams) (any, error) {
+	match, err := packageNameMatcher(params.Query, params.Regex)
+	if err != nil {
+		return nil, err
+	}
+	registryNames, err := loadRegistryNames(d.registriesDir)
+	if err != nil {
+		return nil, err
+	}
+	if params.Registry != "" {
+		if !contains(registryNames, params.Registry) {
+			return nil, notFoundError("registry '%s' not found in registries.json", params.Registry)
+		}
+		registryNames = []string{params.Registry}
+	}
+	results, err := searchRegistries(ctx, d.registriesDir, registryNames, match, "name")
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []searchResult{}
+	}
+	return results, nil
+}
+
+// watch adds a project to the projects whose packages are pre-warmed when Project.json changes
+func (d *daemon) watch(params rpcParams) (any, error) {
+	projectDir, err := projectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(projectFilePath(filepath.Join(projectDir, "Project.json"))); err != nil {
+		return nil, notFoundError("no Project.json in %s", projectDir)
+	}
+	if _, exists := d.watched[projectDir]; !exists {
+		d.watched[projectDir] = ""
+	}
+	return map[string]string{"project": projectDir}, nil
+}
+
+// refreshRegistries pulls all registries, unless cosm is offline
+func (d *daemon) refreshRegistries(ctx context.Context) {
+	if currentConfig().Offline {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	registryNames, err := loadRegistryNames(d.registriesDir)
+	if err != nil {
+		logging.Warnf("failed to load registries: %v", err)
+		return
+	}
+	errs := updateRegistries(ctx, d.registriesDir, registryNames, currentConfig().Parallelism)
+	for i, name := range registryNames {
+		if errs[i] != nil && ctx.Err() == nil {
+			logging.Warnf("failed to update registry '%s': %v", name, errs[i])
+		}
+	}
+	logging.Debugf("Updated %d registry(ies)", len(registryNames))
+}
+
+// pollProjects resolves the build lists of the watched projects whose Project.json changed and
+// makes their packages available in the depot, so that the next activation does not clone
+func (d *daemon) pollProjects(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Projects are watched once they have been activated with this depot
+	buildListFiles, err := loadBuildListUsage(d.cosmDir)
+	if err != nil {
+		logging.Warnf("failed to load the activated projects: %v", err)
+	}
+	for _, buildListFile := range buildListFiles {
+		projectDir := filepath.Dir(filepath.Dir(buildListFile))
+		if _, exists := d.watched[projectDir]; !exists {
+			d.watched[projectDir] = ""
+		}
+	}
+
+	projectDirs := make([]string, 0, len(d.watched))
+	for projectDir := range d.watched {
+		projectDirs = append(projectDirs, projectDir)
+	}
+	sort.Strings(projectDirs)
+	for _, projectDir := range projectDirs {
+		if ctx.Err() != nil {
+			return
+		}
+		project, err := loadProject(filepath.Join(projectDir, "Project.json"))
+		if err != nil {
+			continue // Workspace roots and removed projects
+		}
+		hash, err := hashBuildListInputs(projectBuildListInputs(project, projectDir))
+		if err != nil || hash == d.watched[projectDir] {
+			continue
+		}
+		d.watched[projectDir] = hash
+		buildList, err := generateBuildList(selectGroups(project, recordedGroups(projectDir)), projectDir, targetPlatform(), d.registriesDir)
+		if err != nil {
+			logging.Warnf("failed to resolve the build list of %s: %v", projectDir, err)
+			continue
+		}
+		if len(buildList.Dependencies) == 0 {
+			continue
+		}
+		if err := makePackagesAvailable(ctx, &buildList, d.cosmDir); err != nil {
+			logging.Warnf("failed to pre-warm the packages of %s: %v", projectDir, err)
+			continue
+		}
+		logging.Infof("Pre-warmed %d package(s) of %s", len(buildList.Dependencies), projectDir)
+	}
+}
@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"bytes"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Deactivate prints the shell statements that undo the active cosm environment.
+// The output is meant to be evaluated by the shell, e.g. eval "$(cosm deactivate)" or
+// cosm deactivate | Out-String | Invoke-Expression in PowerShell.
+func Deactivate(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("cosm deactivate takes no arguments")
+	}
+	projectDir := os.Getenv("COSM_ACTIVE")
+	if projectDir == "" {
+		return fmt.Errorf("no cosm environment is active in this shell")
+	}
+	state, err := loadActivationState(filepath.Join(projectDir, ".cosm", "activation.json"))
+	if err != nil {
+		return err
+	}
+	fmt.Print(deactivateStatements(detectShell(), state.Variables))
+	return nil
+}
+
+// ensureNotActivated refuses to activate an environment on top of another one.
+// Re-running activate in the active project only refreshes its environment files.
+func ensureNotActivated(startShell bool) error {
+	active := os.Getenv("COSM_ACTIVE")
+	if active == "" {
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	if startShell || filepath.Clean(active) != filepath.Clean(cwd) {
+		return fmt.Errorf("a cosm environment is already active for %s; run 'deactivate' first", active)
+	}
+	return nil
+}
+
+// writeActivationScripts writes .cosm/activation.json with the injected variables and the
+// activation scripts .cosm/activate (bash, zsh), .cosm/activate.fish (fish), .cosm/activate.ps1
+// (PowerShell) and .cosm/activate.bat (cmd), which is undone by .cosm/deactivate.bat
+func writeActivationScripts(names []string) error {
+	projectDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	state := types.ActivationState{Variables: names}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal activation.json: %w", err)
+	}
+	if err := writeFileAtomically(filepath.Join(".cosm", "activation.json"), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write .cosm/activation.json: %w", err)
+	}
+	for _, shell := range activationShells {
+		activateFile := activateFileForShell(shell)
+		if err := os.WriteFile(activateFile, []byte(activateScript(shell, projectDir, names)), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", activateFile, err)
+		}
+	}
+	// cmd has no functions; the deactivate macro of activate.bat runs a script instead
+	deactivateFile := filepath.Join(".cosm", "deactivate.bat")
+	if err := os.WriteFile(deactivateFile, []byte("@echo off\r\n"+crlf(deactivateStatements("cmd", names))), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", deactivateFile, err)
+	}
+	return nil
+}
+
+// loadActivationState reads the variables injected by an activation
+func loadActivationState(filename string) (*types.ActivationState, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activation state %s: %w", filename, err)
+	}
+	var state types.ActivationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse activation state %s: %w", filename, err)
+	}
+	return &state, nil
+}
+
+// activateScript generates a script that saves the current values of the injected variables
+// and the prompt, loads the environment, and defines a deactivate function
+func activateScript(shell, projectDir string, names []string) string {
+	envFile := filepath.Join(projectDir, envFileForShell(shell))
+	var b strings.Builder
+	switch shell {
+	case "powershell":
+		b.WriteString("if ($env:COSM_ACTIVE) {\n")
+		b.WriteString("\tWrite-Error \"cosm: an environment is already active for $env:COSM_ACTIVE; run 'deactivate' first\"\n")
+		b.WriteString("\treturn\n")
+		b.WriteString("}\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "if (Test-Path env:%s) {\n\t$env:_COSM_OLD_%s = $env:%s\n}\n", name, name, name)
+		}
+		fmt.Fprintf(&b, ". %s\n", powershellQuote(envFile))
+		fmt.Fprintf(&b, "$env:COSM_ACTIVE = %s\n", powershellQuote(projectDir))
+		b.WriteString("if (Test-Path function:prompt) {\n\t$function:global:_cosm_old_prompt = $function:prompt\n}\n")
+		b.WriteString("function global:prompt {\n\tWrite-Host -NoNewline -ForegroundColor Green 'cosm> '\n")
+		b.WriteString("\tif (Test-Path function:_cosm_old_prompt) {\n\t\t_cosm_old_prompt\n\t}\n}\n")
+		b.WriteString("function global:deactivate {\n")
+		b.WriteString(indent(deactivateStatements(shell, names)))
+		b.WriteString("}\n")
+		return b.String()
+	case "cmd":
+		b.WriteString("@echo off\n")
+		b.WriteString("if defined COSM_ACTIVE (\n")
+		b.WriteString("\techo cosm: an environment is already active for %COSM_ACTIVE%; run 'deactivate' first 1>&2\n")
+		b.WriteString("\texit /b 1\n")
+		b.WriteString(")\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "if defined %s set \"_COSM_OLD_%s=%%%s%%\"\n", name, name, name)
+		}
+		b.WriteString("set \"_COSM_OLD_PROMPT=%PROMPT%\"\n")
+		fmt.Fprintf(&b, "call \"%s\"\n", envFile)
+		fmt.Fprintf(&b, "set \"COSM_ACTIVE=%s\"\n", projectDir)
+		b.WriteString("set \"PROMPT=cosm$G %PROMPT%\"\n")
+		fmt.Fprintf(&b, "doskey deactivate=call \"%s\"\n", filepath.Join(projectDir, ".cosm", "deactivate.bat"))
+		return crlf(b.String())
+	case "fish":
+		b.WriteString("if set -q COSM_ACTIVE\n")
+		b.WriteString("\techo \"cosm: an environment is already active for $COSM_ACTIVE; run 'deactivate' first\" >&2\n")
+		b.WriteString("\treturn 1\n")
+		b.WriteString("end\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "if set -q %s\n\tset -gx _COSM_OLD_%s $%s\nend\n", name, name, name)
+		}
+		fmt.Fprintf(&b, "source %q\n", envFile)
+		fmt.Fprintf(&b, "set -gx COSM_ACTIVE %q\n", projectDir)
+		b.WriteString("if functions -q fish_prompt\n\tfunctions -c fish_prompt _cosm_old_fish_prompt\nend\n")
+		b.WriteString("function fish_prompt\n\tset_color --bold green\n\techo -n 'cosm> '\n\tset_color normal\n")
+		b.WriteString("\tif functions -q _cosm_old_fish_prompt\n\t\t_cosm_old_fish_prompt\n\tend\nend\n")
+		b.WriteString("function deactivate\n")
+		b.WriteString(indent(deactivateStatements(shell, names)))
+		b.WriteString("end\n")
+		return b.String()
+	}
+	b.WriteString("if [ -n \"$COSM_ACTIVE\" ]; then\n")
+	b.WriteString("\techo \"cosm: an environment is already active for $COSM_ACTIVE; run 'deactivate' first\" >&2\n")
+	b.WriteString("\treturn 1\n")
+	b.WriteString("fi\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "if [ -n \"${%s+x}\" ]; then\n\texport _COSM_OLD_%s=\"$%s\"\nfi\n", name, name, name)
+	}
+	b.WriteString("_COSM_OLD_PS1=\"$PS1\"\n")
+	fmt.Fprintf(&b, ". %q\n", envFile)
+	fmt.Fprintf(&b, "export COSM_ACTIVE=%q\n", projectDir)
+	b.WriteString("PS1=\"cosm> $PS1\"\n")
+	b.WriteString("deactivate() {\n")
+	b.WriteString(indent(deactivateStatements(shell, names)))
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// deactivateStatements generates the statements that restore the saved variables and prompt
+func deactivateStatements(shell string, names []string) string {
+	var b strings.Builder
+	switch shell {
+	case "powershell":
+		for _, name := range names {
+			fmt.Fprintf(&b, "if (Test-Path env:_COSM_OLD_%s) {\n\t$env:%s = $env:_COSM_OLD_%s\n\tRemove-Item env:_COSM_OLD_%s\n} else {\n\tRemove-Item env:%s -ErrorAction SilentlyContinue\n}\n", name, name, name, name, name)
+		}
+		b.WriteString("if (Test-Path function:_cosm_old_prompt) {\n")
+		b.WriteString("\t$function:global:prompt = $function:_cosm_old_prompt\n\tRemove-Item function:_cosm_old_prompt\n")
+		b.WriteString("}\n")
+		b.WriteString("Remove-Item env:COSM_ACTIVE -ErrorAction SilentlyContinue\n")
+		b.WriteString("Remove-Item function:deactivate -ErrorAction SilentlyContinue\n")
+		return b.String()
+	case "cmd":
+		for _, name := range names {
+			fmt.Fprintf(&b, "if defined _COSM_OLD_%s (set \"%s=%%_COSM_OLD_%s%%\") else (set \"%s=\")\nset \"_COSM_OLD_%s=\"\n", name, name, name, name, name)
+		}
+		b.WriteString("if defined _COSM_OLD_PROMPT set \"PROMPT=%_COSM_OLD_PROMPT%\"\n")
+		b.WriteString("set \"_COSM_OLD_PROMPT=\"\n")
+		b.WriteString("set \"COSM_ACTIVE=\"\n")
+		b.WriteString("doskey deactivate=\n")
+		return b.String()
+	case "fish":
+		for _, name := range names {
+			fmt.Fprintf(&b, "if set -q _COSM_OLD_%s\n\tset -gx %s $_COSM_OLD_%s\n\tset -e _COSM_OLD_%s\nelse\n\tset -e %s\nend\n", name, name, name, name, name)
+		}
+		b.WriteString("if functions -q _cosm_old_fish_prompt\n")
+		b.WriteString("\tfunctions -e fish_prompt\n\tfunctions -c _cosm_old_fish_prompt fish_prompt\n\tfunctions -e _cosm_old_fish_prompt\n")
+		b.WriteString("end\n")
+		b.WriteString("set -e COSM_ACTIVE\n")
+		b.WriteString("functions -e deactivate\n")
+		return b.String()
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "if [ -n \"${_COSM_OLD_%s+x}\" ]; then\n\texport %s=\"$_COSM_OLD_%s\"\n\tunset _COSM_OLD_%s\nelse\n\tunset %s\nfi\n", name, name, name, name, name)
+	}
+	b.WriteString("if [ -n \"${_COSM_OLD_PS1+x}\" ]; then\n\tPS1=\"$_COSM_OLD_PS1\"\n\tunset _COSM_OLD_PS1\nfi\n")
+	b.WriteString("unset COSM_ACTIVE\n")
+	b.WriteString("unset -f deactivate 2>/dev/null\n")
+	return b.String()
+}
+
+// crlf converts the line endings of a batch script to CRLF, which cmd expects
+func crlf(script string) string {
+	return strings.ReplaceAll(script, "\n", "\r\n")
+}
+
+// indent prefixes every line of a script with a tab
+func indent(script string) string {
+	lines := strings.SplitAfter(script, "\n")
+	var b strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			b.WriteString("\t" + line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// Diff shows what changes between two registered versions of a package: the changelog sections of
+// the versions in between and the git diff of its source, from the clone in the depot, or with
+// --deps the changes to its dependencies in specs.json
+func Diff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 3 {
+		return validationError("requires a package and two versions (e.g., cosm diff <package> v1.0.0 v1.1.0)")
+	}
+	registryName, packageName, err := splitScopedName(args[0])
+	if err != nil {
+		return err
+	}
+	from, to := args[1], args[2]
+	for _, version := range []string{from, to} {
+		if err := validateVersion(version); err != nil {
+			return validationError("invalid version '%s': %v", version, err)
+		}
+	}
+	depsOnly, _ := cmd.Flags().GetBool("deps")
+	stat, _ := cmd.Flags().GetBool("stat")
+	noChangelog, _ := cmd.Flags().GetBool("no-changelog")
+
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return err
+	}
+	if flagRegistry, _ := cmd.Flags().GetString("registry"); flagRegistry != "" {
+		if registryName != "" && registryName != flagRegistry {
+			return validationError("package '%s' is scoped to registry '%s', not '%s'", args[0], registryName, flagRegistry)
+		}
+		registryName = flagRegistry
+	}
+	if registryName != "" {
+		if !contains(registryNames, registryName) {
+			return notFoundError("registry '%s' not found in registries.json", registryName)
+		}
+		registryNames = []string{registryName}
+	}
+	pkg, err := findPackageInRegistries(ctx, packageName, from, true, registriesDir, registryNames)
+	if err != nil {
+		return err
+	}
+	toSpecs, err := loadSpecs(registriesDir, pkg.RegistryName, packageName, to)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return notFoundError("version '%s' of package '%s' not found in registry '%s'", to, packageName, pkg.RegistryName)
+		}
+		return err
+	}
+
+	if depsOnly {
+		printDependencyChanges(packageName, pkg.Specs, toSpecs)
+		return nil
+	}
+	if !noChangelog {
+		if err := printChangelogs(registriesDir, pkg.RegistryName, packageName, from, to); err != nil {
+			return err
+		}
+	}
+	output, err := diffPackageVersions(ctx, &pkg.Specs, &toSpecs, stat)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		logging.Infof("No changes in the source of '%s' from %s to %s", packageName, from, to)
+		return nil
+	}
+	fmt.Println(output)
+	return nil
+}
+
+// printChangelogs prints the changelog sections stored in the registry for the versions after the
+// older of two versions up to the newer one, newest first
+func printChangelogs(registriesDir, registryName, packageName, from, to string) error {
+	if semVerLess(to, from) {
+		from, to = to, from
+	}
+	versions, err := loadVersions(registriesDir, registryName, packageName)
+	if err != nil {
+		return err
+	}
+	sortVersions(versions)
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		if !semVerLess(from, version) || semVerLess(to, version) {
+			continue
+		}
+		changelog, err := loadChangelog(registriesDir, registryName, packageName, version)
+		if err != nil {
+			return err
+		}
+		if changelog != "" {
+			fmt.Printf("Changelog of '%s' %s:\n%s\n\n", packageName, version, changelog)
+		}
+	}
+	return nil
+}
+
+// diffPackageVersions returns the git diff between the commits of two versions of a package, limited
+// to the package subdirectory in a monorepo; the clone in the depot is fetched if it lacks a commit
+func diffPackageVersions(ctx context.Context, from, to *types.Specs, stat bool) (string, error) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return "", err
+	}
+	unlock, err := lockDepot(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	clonePath, err := ensurePackageClone(ctx, cosmDir, from)
+	if err != nil {
+		return "", err
+	}
+	if !hasCommit(ctx, clonePath, from.SHA1) || !hasCommit(ctx, clonePath, to.SHA1) {
+		if err := fetchWithMirrors(ctx, clonePath, from.Mirrors); err != nil {
+			return "", err
+		}
+	}
+	var diffArgs []string
+	if stat {
+		diffArgs = append(diffArgs, "--stat")
+	}
+	diffArgs = append(diffArgs, from.SHA1, to.SHA1)
+	if from.Subdir != "" {
+		diffArgs = append(diffArgs, "--", from.Subdir)
+	}
+	output, err := GitCommand(ctx, clonePath, "diff", diffArgs...)
+	if err != nil {
+		return "", wrapGitError(clonePath, fmt.Sprintf("failed to diff %s and %s of '%s'", from.Version, to.Version, from.Name), err)
+	}
+	return output, nil
+}
+
+// printDependencyChanges lists the dependencies that were added, removed or changed version
+// between the specs of two versions of a package
+func printDependencyChanges(packageName string, from, to types.Specs) {
+	var changes []string
+	for key, dep := range to.Deps {
+		previous, existed := from.Deps[key]
+		switch {
+		case !existed:
+			changes = append(changes, fmt.Sprintf("  + %s %s", dep.Name, dep.Version))
+		case previous.Version != dep.Version:
+			changes = append(changes, fmt.Sprintf("  ~ %s %s -> %s", dep.Name, previous.Version, dep.Version))
+		}
+	}
+	for key, dep := range from.Deps {
+		if _, exists := to.Deps[key]; !exists {
+			changes = append(changes, fmt.Sprintf("  - %s %s", dep.Name, dep.Version))
+		}
+	}
+	if len(changes) == 0 {
+		logging.Infof("The dependencies of '%s' are the same in %s and %s", packageName, from.Version, to.Version)
+		return
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i][4:] < changes[j][4:] })
+	logging.Infof("Dependencies of '%s' from %s to %s:", packageName, from.Version, to.Version)
+	for _, change := range changes {
+		logging.Infof("%s", change)
+	}
+}
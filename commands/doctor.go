@@ -0,0 +1,240 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// minGitVersion is the oldest git version with the partial clones that cosm makes
+var minGitVersion = [2]int{2, 22}
+
+// doctorCheck is the outcome of a single check of cosm doctor
+type doctorCheck struct {
+	subject string
+	problem string // Empty if the check passed
+	fix     string // How to repair the problem
+	warning bool   // The problem does not keep cosm from working
+}
+
+// Doctor checks git, the depot and the registries, and prints how to fix the problems it finds
+func Doctor(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	offline := currentConfig().Offline
+
+	checks := []doctorCheck{checkGit(ctx)}
+	depotChecks, cosmDir := checkDepot()
+	checks = append(checks, depotChecks...)
+	if cosmDir != "" {
+		checks = append(checks, checkRegistryClones(ctx, cosmDir, offline)...)
+		checks = append(checks, checkLocks(cosmDir)...)
+		checks = append(checks, checkSymlinks(cosmDir)...)
+	}
+
+	failures, warnings := 0, 0
+	for _, check := range checks {
+		switch {
+		case check.problem == "":
+			fmt.Printf("[ok]   %s\n", check.subject)
+			continue
+		case check.warning:
+			warnings++
+			fmt.Printf("[warn] %s: %s\n", check.subject, check.problem)
+		default:
+			failures++
+			fmt.Printf("[fail] %s: %s\n", check.subject, check.problem)
+		}
+		if check.fix != "" {
+			fmt.Printf("       fix: %s\n", check.fix)
+		}
+	}
+	if offline {
+		fmt.Println("Skipped the checks of the registry remotes in offline mode")
+	}
+	if failures > 0 {
+		return fmt.Errorf("cosm doctor found %d problem(s) and %d warning(s)", failures, warnings)
+	}
+	if warnings > 0 {
+		fmt.Printf("No problems found, %d warning(s)\n", warnings)
+		return nil
+	}
+	fmt.Println("No problems found")
+	return nil
+}
+
+// checkGit checks that git is installed and recent enough
+func checkGit(ctx context.Context) doctorCheck {
+	output, err := GitCommand(ctx, "", "--version")
+	if err != nil {
+		return doctorCheck{subject: "git", problem: "git cannot be run", fix: "install git and make sure it is on your PATH"}
+	}
+	version := strings.TrimPrefix(strings.TrimSpace(output), "git version ")
+	check := doctorCheck{subject: "git " + version}
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return check
+	}
+	major, errMajor := strconv.Atoi(parts[0])
+	minor, errMinor := strconv.Atoi(parts[1])
+	if errMajor == nil && errMinor == nil && (major < minGitVersion[0] || major == minGitVersion[0] && minor < minGitVersion[1]) {
+		check.problem = fmt.Sprintf("git %d.%d or newer is required for partial clones", minGitVersion[0], minGitVersion[1])
+		check.fix = "upgrade git"
+	}
+	return check
+}
+
+// checkDepot checks COSM_DEPOT_PATH, the depot directories, registries.json and config.json. It
+// returns the depot directory if it exists.
+func checkDepot() ([]doctorCheck, string) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return []doctorCheck{{subject: "COSM_DEPOT_PATH", problem: "not set", fix: "run any cosm command to create a depot, or export COSM_DEPOT_PATH in the profile of your shell"}}, ""
+	}
+	if info, err := os.Stat(cosmDir); os.IsNotExist(err) {
+		return []doctorCheck{{subject: "COSM_DEPOT_PATH " + cosmDir, problem: "does not exist", fix: "run any cosm command to create the depot, or point COSM_DEPOT_PATH to an existing depot"}}, ""
+	} else if err != nil || !info.IsDir() {
+		return []doctorCheck{{subject: "COSM_DEPOT_PATH " + cosmDir, problem: "not a directory", fix: "run any cosm command to create the depot, or point COSM_DEPOT_PATH to an existing depot"}}, ""
+	}
+	checks := []doctorCheck{{subject: "COSM_DEPOT_PATH " + cosmDir}}
+	for _, dir := range []string{"registries", "templates", "clones", "packages"} {
+		check := doctorCheck{subject: "depot directory " + dir}
+		if info, err := os.Stat(filepath.Join(cosmDir, dir)); err != nil || !info.IsDir() {
+			check.problem = "missing"
+			check.fix = fmt.Sprintf("mkdir -p %s", filepath.Join(cosmDir, dir))
+		}
+		checks = append(checks, check)
+	}
+	check := doctorCheck{subject: "registries.json"}
+	if _, err := loadRegistryNames(filepath.Join(cosmDir, "registries")); err != nil && !strings.Contains(err.Error(), "no registries available") {
+		check.problem = err.Error()
+		check.fix = "repair or remove " + filepath.Join(cosmDir, "registries", "registries.json") + " and clone the registries again with cosm registry clone"
+	}
+	checks = append(checks, check)
+	check = doctorCheck{subject: "configuration"}
+	if _, err := LoadConfig(); err != nil {
+		check.problem = err.Error()
+		check.fix = "correct the setting with cosm config set, or the environment variable"
+	}
+	return append(checks, check), cosmDir
+}
+
+// checkRegistryClones checks that every registry in registries.json is a git clone on a branch that
+// has not diverged from its upstream, and unless offline, that its remote can be reached
+func checkRegistryClones(ctx context.Context, cosmDir string, offline bool) []doctorCheck {
+	registriesDir := filepath.Join(cosmDir, "registries")
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return nil
+	}
+	var checks []doctorCheck
+	for _, registryName := range registryNames {
+		registryDir := filepath.Join(registriesDir, registryName)
+		subject := fmt.Sprintf("registry '%s'", registryName)
+		if _, err := os.Stat(filepath.Join(registryDir, ".git")); err != nil {
+			checks = append(checks, doctorCheck{subject: subject, problem: "no git clone in " + registryDir,
+				fix: fmt.Sprintf("cosm registry delete %s --force, then clone it again with cosm registry clone <giturl>", registryName)})
+			continue
+		}
+		checks = append(checks, checkRegistryClone(ctx, registryDir, subject, offline)...)
+	}
+	return checks
+}
+
+// checkRegistryClone checks the branch of a registry clone against its remote as of the last update,
+// and the remote
+func checkRegistryClone(ctx context.Context, registryDir, subject string, offline bool) []doctorCheck {
+	branch, err := getCurrentBranch(ctx, registryDir)
+	if err != nil {
+		return []doctorCheck{{subject: subject, problem: "detached HEAD",
+			fix: fmt.Sprintf("git -C %s checkout main (or the default branch of the registry)", registryDir)}}
+	}
+	checks := []doctorCheck{{subject: subject + " on branch " + branch}}
+	if output, _ := GitCommand(ctx, registryDir, "status", "--porcelain", "--", ":/", excludeBackups); strings.TrimSpace(output) != "" {
+		checks = append(checks, doctorCheck{subject: subject, problem: "uncommitted changes", warning: true,
+			fix: fmt.Sprintf("git -C %s stash (or git -C %s reset --hard to discard them)", registryDir, registryDir)})
+	}
+	remote := gitRemote(ctx, registryDir)
+	output, err := GitCommand(ctx, registryDir, "rev-list", "--left-right", "--count", "HEAD..."+remote+"/"+branch)
+	if err != nil {
+		checks = append(checks, doctorCheck{subject: subject, problem: fmt.Sprintf("branch '%s' was never pushed to %s", branch, remote), warning: true,
+			fix: fmt.Sprintf("git -C %s push %s %s", registryDir, remote, branch)})
+	} else if counts := strings.Fields(output); len(counts) == 2 {
+		ahead, behind := counts[0], counts[1]
+		switch {
+		case ahead != "0" && behind != "0":
+			checks = append(checks, doctorCheck{subject: subject, problem: fmt.Sprintf("branch '%s' has diverged from its upstream (%s local and %s remote commits)", branch, ahead, behind),
+				fix: fmt.Sprintf("git -C %s pull --rebase && git -C %s push", registryDir, registryDir)})
+		case ahead != "0":
+			checks = append(checks, doctorCheck{subject: subject, problem: fmt.Sprintf("%s commit(s) not pushed", ahead), warning: true,
+				fix: fmt.Sprintf("git -C %s push", registryDir)})
+		}
+	}
+	if !offline {
+		check := doctorCheck{subject: subject + " remote"}
+		if _, err := GitCommand(ctx, registryDir, "ls-remote", "--heads", remote); err != nil {
+			check.problem = "cannot be reached: " + lastLine(err.Error())
+			check.fix = "check your network connection and credentials, or work offline with cosm config set offline true"
+			check.warning = true
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkLocks reports the locks in the depot whose process no longer runs
+func checkLocks(cosmDir string) []doctorCheck {
+	locksDir := filepath.Join(cosmDir, "locks")
+	entries, err := os.ReadDir(locksDir)
+	if err != nil {
+		return nil
+	}
+	var checks []doctorCheck
+	for _, entry := range entries {
+		path := filepath.Join(locksDir, entry.Name())
+		info, err := readLockFile(path)
+		if err == nil && !isStaleLock(info) {
+			checks = append(checks, doctorCheck{subject: "lock " + entry.Name(), problem: fmt.Sprintf("held by cosm process %d (%s) since %s", info.PID, info.Command, info.Acquired.Format(time.RFC3339)), warning: true})
+			continue
+		}
+		checks = append(checks, doctorCheck{subject: "lock " + entry.Name(), problem: "left behind by a process that no longer runs", warning: true, fix: "rm " + path})
+	}
+	return checks
+}
+
+// checkSymlinks reports symbolic links in the depot whose target does not exist
+func checkSymlinks(cosmDir string) []doctorCheck {
+	var broken []string
+	filepath.WalkDir(cosmDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if _, err := os.Stat(path); err != nil {
+				broken = append(broken, path)
+			}
+		}
+		return nil
+	})
+	check := doctorCheck{subject: "symbolic links in the depot"}
+	if len(broken) > 0 {
+		check.problem = fmt.Sprintf("%d broken: %s", len(broken), strings.Join(broken, ", "))
+		check.fix = "remove the broken links; package versions are restored on the next cosm activate"
+	}
+	return []doctorCheck{check}
+}
+
+// lastLine returns the last non-empty line of a message
+func lastLine(message string) string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind categorizes the errors of cosm commands, so that scripts can tell them apart
+type ErrorKind string
+
+const (
+	KindGeneral    ErrorKind = "general"    // Any other failure
+	KindValidation ErrorKind = "validation" // Invalid arguments, flags or versions
+	KindNotFound   ErrorKind = "not_found"  // A registry, package, version, dependency or template does not exist
+	KindConflict   ErrorKind = "conflict"   // The registry, package, version or dependency already exists
+	KindNetwork    ErrorKind = "network"    // A remote could not be reached
+	KindCanceled   ErrorKind = "canceled"   // The command was interrupted
+)
+
+// exitCodes maps the error kinds to the exit codes of cosm
+var exitCodes = map[ErrorKind]int{
+	KindGeneral:    1,
+	KindValidation: 2,
+	KindNotFound:   3,
+	KindConflict:   4,
+	KindNetwork:    5,
+	KindCanceled:   130, // As for a shell command killed by SIGINT
+}
+
+// Error is an error of a known kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// validationError returns an error for invalid user input
+func validationError(format string, args ...any) error {
+	return &Error{Kind: KindValidation, Err: fmt.Errorf(format, args...)}
+}
+
+// notFoundError returns an error for something that does not exist
+func notFoundError(format string, args ...any) error {
+	return &Error{Kind: KindNotFound, Err: fmt.Errorf(format, args...)}
+}
+
+// conflictError returns an error for something that already exists
+func conflictError(format string, args ...any) error {
+	return &Error{Kind: KindConflict, Err: fmt.Errorf(format, args...)}
+}
+
+// networkError returns an error for a remote that could not be reached
+func networkError(format string, args ...any) error {
+	return &Error{Kind: KindNetwork, Err: fmt.Errorf(format, args...)}
+}
+
+// ExitStatusError is the failure of a command that cosm exec ran; cosm exits with the same exit
+// code, and the command has reported the failure itself
+type ExitStatusError struct {
+	Code int
+}
+
+func (e *ExitStatusError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+// networkFailures are messages of git that mean a remote could not be reached
+var networkFailures = []string{
+	"Could not resolve host",
+	"Could not read from remote repository",
+	"Connection refused",
+	"Connection timed out",
+	"Failed to connect",
+	"unable to access",
+	"Network is unreachable",
+}
+
+// authFailures are messages of git that mean access to a remote was denied or the repository does
+// not exist; retrying the command does not help
+var authFailures = []string{
+	"Authentication failed",
+	"Permission denied",
+	"could not read Username",
+	"could not read Password",
+	"returned error: 401",
+	"returned error: 403",
+	"Repository not found",
+	"does not appear to be a git repository",
+}
+
+// transientFailures are messages of git that mean the connection to a remote failed in a way that
+// may not happen again
+var transientFailures = []string{
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"Connection refused",
+	"Connection reset",
+	"Connection timed out",
+	"Operation timed out",
+	"Failed to connect",
+	"Network is unreachable",
+	"The remote end hung up unexpectedly",
+	"unexpected disconnect",
+	"early EOF",
+	"RPC failed",
+	"returned error: 502",
+	"returned error: 503",
+	"returned error: 504",
+}
+
+// isTransientGitFailure reports whether a failed git command timed out or lost its connection,
+// and was not denied access
+func isTransientGitFailure(err error) bool {
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var kindErr *Error
+	if errors.As(cmdErr.err, &kindErr) && kindErr.Kind == KindNetwork {
+		return true // Timed out
+	}
+	for _, failure := range authFailures {
+		if strings.Contains(cmdErr.output, failure) {
+			return false
+		}
+	}
+	for _, failure := range transientFailures {
+		if strings.Contains(cmdErr.output, failure) {
+			return true
+		}
+	}
+	return false
+}
+
+// KindOf returns the kind of an error. Errors without a kind are cancellations if the command was
+// interrupted, network errors if a git command failed to reach its remote, and general errors otherwise.
+func KindOf(err error) ErrorKind {
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind
+	}
+	if errors.Is(err, context.Canceled) {
+		return KindCanceled
+	}
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		for _, failure := range networkFailures {
+			if strings.Contains(cmdErr.output, failure) {
+				return KindNetwork
+			}
+		}
+	}
+	return KindGeneral
+}
+
+// ExitCode returns the exit code of cosm for an error: the exit code of the command that cosm exec
+// ran, or the exit code of its kind
+func ExitCode(err error) int {
+	var statusErr *ExitStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return exitCodes[KindOf(err)]
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		kind     ErrorKind
+		exitCode int
+	}{
+		{errors.New("boom"), KindGeneral, 1},
+		{validationError("bad flag"), KindValidation, 2},
+		{fmt.Errorf("failed to load: %w", notFoundError("registry 'x' not found")), KindNotFound, 3},
+		{fmt.Errorf("failed to add: %w", conflictError("already exists")), KindConflict, 4},
+		{fmt.Errorf("failed to fetch: %w", &commandError{args: []string{"git", "fetch"}, output: "fatal: unable to access 'https://example.com/x.git/': Could not resolve host: example.com", err: errors.New("exit status 128")}), KindNetwork, 5},
+		{&commandError{args: []string{"git", "checkout"}, output: "error: pathspec 'x' did not match", err: errors.New("exit status 1")}, KindGeneral, 1},
+		{fmt.Errorf("failed to clone: %w", &commandError{args: []string{"git", "clone"}, err: context.Canceled}), KindCanceled, 130},
+	} {
+		if kind := KindOf(tc.err); kind != tc.kind {
+			t.Errorf("KindOf(%q) = %s, expected %s", tc.err, kind, tc.kind)
+		}
+		if code := ExitCode(tc.err); code != tc.exitCode {
+			t.Errorf("ExitCode(%q) = %d, expected %d", tc.err, code, tc.exitCode)
+		}
+	}
+}
+
+func TestIsTransientGitFailure(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		transient bool
+	}{
+		{&commandError{output: "fatal: unable to access 'https://example.com/x.git/': Could not resolve host: example.com", err: errors.New("exit status 128")}, true},
+		{&commandError{output: "error: RPC failed; curl 56 Recv failure: Connection reset by peer\nfatal: early EOF", err: errors.New("exit status 128")}, true},
+		{&commandError{err: &Error{Kind: KindNetwork, Err: errors.New("timed out after 1s")}}, true},
+		{&commandError{output: "git@example.com: Permission denied (publickey).\nfatal: Could not read from remote repository.", err: errors.New("exit status 128")}, false},
+		{&commandError{output: "remote: Repository not found.\nfatal: The remote end hung up unexpectedly", err: errors.New("exit status 128")}, false},
+		{&commandError{err: context.Canceled}, false},
+		{errors.New("boom"), false},
+	} {
+		if transient := isTransientGitFailure(tc.err); transient != tc.transient {
+			t.Errorf("isTransientGitFailure(%q) = %v, expected %v", tc.err, transient, tc.transient)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"cosm/logging"
+	"cosm/types"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// Exec resolves the build list of the project or workspace in the current directory if needed,
+// makes its packages available, and runs a command in its environment, without sourcing the
+// activation scripts. The messages of cosm go to stderr, so that stdout is the output of the
+// command, and cosm exits with the exit code of the command.
+func Exec(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return validationError("requires a command to run (e.g., cosm exec -- make test)")
+	}
+	if err := ensureNotActivated(false); err != nil {
+		return err
+	}
+	logging.SetOutput(os.Stderr, os.Stderr)
+	env, err := prepareActivation(cmd.Context(), nil, func(*types.Project) ([]string, error) {
+		return recordedGroups(""), nil
+	})
+	if err != nil {
+		return err
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return notFoundError("command '%s' not found: %v", args[0], err)
+	}
+	projectDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	command := exec.Command(path, args[1:]...)
+	command.Env = os.Environ()
+	for _, v := range env {
+		command.Env = append(command.Env, v.name+"="+v.value)
+	}
+	command.Env = append(command.Env, "COSM_ACTIVE="+projectDir)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	// The command handles ctrl-c itself, as it does in an activated shell
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	logging.Debugf("Running %s in the environment of %s", path, projectDir)
+	err = command.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			code = 128 + int(status.Signal()) // As reported by shells
+		}
+		return &ExitStatusError{Code: code}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// helpTopic is a long-form help text about a concept of cosm rather than a single command
+type helpTopic struct {
+	name  string
+	short string
+	text  string
+}
+
+// helpTopics lists the topics in the order in which cosm help topics prints them
+var helpTopics = []helpTopic{
+	{
+		name:  "depot",
+		short: "Layout of the depot in COSM_DEPOT_PATH",
+		text: `The depot is the directory in COSM_DEPOT_PATH (asked for on first use and exported
+in the profile of your shell). It holds everything cosm shares between projects:
+
+  registries/registries.json    names of the local registries
+  registries/trust.json         trust policies of the registries (cosm verify)
+  registries/<registry>/        git clone of each registry
+  clones/<uuid>/                git clone of each package, shared by its versions
+  packages/<name>/<sha1>/       checked out copy of each package version in a build list
+  templates/                    the default template source
+  template-sources/<name>/      template sources added with cosm template add
+  logs/buildlists.json          build lists of activated projects (cosm cache clean --unused)
+  locks/                        locks of the cosm commands that change the depot or a registry
+  config.json                   global configuration (cosm config)
+
+Everything except config.json can be recreated from the registries: removed package
+versions are restored on the next activation.
+
+Commands that change the depot or a registry lock it, so concurrent cosm processes wait
+for each other. A lock whose process no longer runs is removed automatically. Clones are
+made in tmp-* staging directories of clones/ and registries/ first; staging directories
+left behind by a killed cosm are removed after a day.`,
+	},
+	{
+		name:  "registry-format",
+		short: "How packages and versions are stored in a registry",
+		text: `A registry is a git repository that records packages and their released versions.
+Every change is committed and pushed, so updating a registry is a git pull:
+
+  registry.json                          name, Git URL and the packages with their UUID,
+                                         Git URL and maintainers
+  <LETTER>/<name>/versions.json          the registered versions of a package
+  <LETTER>/<name>/<version>/specs.json   the release: UUID, Git URL, SHA1 of the tagged
+                                         commit, dependencies and metadata
+  <LETTER>/<name>/<version>/buildlist.json
+                                         the build list of the release
+  advisories/<name>/<id>.json            security advisories (cosm audit)
+
+<LETTER> is the upper-cased first letter of the package name. Versions are added by
+cosm release --registry and cosm registry add, removed or yanked by cosm registry rm,
+and a registry is checked for inconsistencies by cosm registry audit.`,
+	},
+	{
+		name:  "mvs",
+		short: "How minimal version selection resolves the build list",
+		text: `cosm resolves dependencies with minimal version selection. Project.json lists the
+minimal version of every direct dependency, keyed by <uuid>@<major>. Packages with a
+different major version are different packages and can be used side by side.
+
+To build the build list, cosm visits the dependencies of the project and, transitively,
+those recorded in the specs.json of every release it reaches. For every <uuid>@<major>
+the maximum of the required minimal versions is selected. The requirements are then
+followed again from the selected releases only, and dependencies that were only required
+by releases that were not selected are pruned. The result only changes when a
+Project.json changes, so builds are reproducible without a lockfile.
+
+When the build list contains a package with several major versions, and none of them is
+imported under an alias, cosm warns after resolving it. For every dependent that requires
+an older major version it suggests the oldest newer release of that dependent which
+requires the newest major version, so that the dependencies can converge.
+
+The build list of a project is written to .cosm/buildlist.json by cosm add and cosm rm,
+unless --no-resolve is given, and by cosm activate when Project.json changed since; the
+build list of each release is recorded in the registry next to its specs.json.`,
+	},
+	{
+		name:  "activation",
+		short: "How cosm activate sets up the environment of a project",
+		text: `cosm activate resolves the build list of the project in the current directory
+(see 'cosm help mvs'), checks out every package version into the depot and writes the
+environment to .cosm/.env (bash and zsh) and .cosm/env.fish (fish):
+
+  COSM_PACKAGE_PATHS   all resolved package directories
+  <NAME>_PATH          the directory of each dependency, e.g. MY_LIB_PATH
+  TERRA_PATH, LUA_PATH, PYTHONPATH
+                       the search paths of the project language
+
+Load the environment with 'source .cosm/activate' (or .cosm/activate.fish), which also
+defines a deactivate function, or start a subshell with 'cosm activate --shell'. The
+build list is regenerated only when the content of Project.json (or of the Project.json
+of a dependency in development mode) changed since it was last resolved, as recorded by
+a hash in .cosm/buildlist.meta; file times are not used. A vendored build list
+(cosm vendor) takes precedence over the registries.`,
+	},
+}
+
+// findHelpTopic looks up a help topic by name
+func findHelpTopic(name string) (helpTopic, bool) {
+	for _, topic := range helpTopics {
+		if topic.name == name {
+			return topic, true
+		}
+	}
+	return helpTopic{}, false
+}
+
+// Help prints the help of a topic, the list of topics, or the help of a command
+func Help(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 && args[0] == "topics" {
+		fmt.Println("Help topics:")
+		for _, topic := range helpTopics {
+			fmt.Printf("  %-16s %s\n", topic.name, topic.short)
+		}
+		fmt.Println("\nUse 'cosm help <topic>' to read a topic.")
+		return nil
+	}
+	if len(args) == 1 {
+		if topic, found := findHelpTopic(args[0]); found {
+			fmt.Println(topic.text)
+			return nil
+		}
+	}
+	target, _, err := cmd.Root().Find(args)
+	if err != nil || target == nil {
+		return notFoundError("unknown help topic or command '%s' (see 'cosm help topics')", strings.Join(args, " "))
+	}
+	return target.Help()
+}
+
+// CompleteHelpTopics completes the help topics and the commands of cosm
+func CompleteHelpTopics(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := []string{"topics"}
+	for _, topic := range helpTopics {
+		names = append(names, topic.name)
+	}
+	for _, sub := range cmd.Root().Commands() {
+		if sub.IsAvailableCommand() {
+			names = append(names, sub.Name())
+		}
+	}
+	return matching(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Import adds the dependencies in the manifest of another package manager (go.mod, package.json or
+// requirements.txt) that match packages in the registries to the project's Project.json file, and
+// reports the entries that match no package
+func Import(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	manifestPath, _ := cmd.Flags().GetString("from")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	noResolve, _ := cmd.Flags().GetBool("no-resolve")
+	if manifestPath == "" {
+		return validationError("--from is required: the go.mod, package.json or requirements.txt to import")
+	}
+	entries, err := parseManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	project, err := loadProject("Project.json")
+	if err != nil {
+		return err
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return err
+	}
+
+	var deps []AddOptions
+	var messages []string
+	var unmatched []manifestEntry
+	imported := make(map[string]string) // Manifest entry that a dependency key was imported for
+	for _, entry := range entries {
+		pkg, found, err := matchManifestEntry(ctx, entry, registriesDir, registryNames)
+		if err != nil {
+			return err
+		}
+		if !found {
+			unmatched = append(unmatched, entry)
+			continue
+		}
+		major, err := GetMajorVersion(pkg.Specs.Version)
+		if err != nil {
+			return err
+		}
+		key := pkg.Specs.UUID + "@" + major
+		if dep, exists := project.Deps[key]; exists {
+			logging.Infof("Skipped '%s': '%s' %s is already a dependency", entry.Name, dep.Name, dep.Version)
+			continue
+		}
+		if other, exists := imported[key]; exists {
+			logging.Infof("Skipped '%s': '%s' %s is already imported for '%s'", entry.Name, pkg.Specs.Name, pkg.Specs.Version, other)
+			continue
+		}
+		imported[key] = entry.Name
+		deps = append(deps, AddOptions{Name: pkg.Specs.Name, Version: pkg.Specs.Version, Group: entry.Group, Optional: entry.Optional, NoResolve: noResolve})
+		message := fmt.Sprintf("Imported '%s' as dependency '%s' %s from registry '%s'", entry.Name, pkg.Specs.Name, pkg.Specs.Version, pkg.RegistryName)
+		if entry.Optional {
+			message += " as optional dependency"
+		}
+		if entry.Group != "" {
+			message += fmt.Sprintf(" in group '%s'", entry.Group)
+		}
+		messages = append(messages, message)
+	}
+	if len(deps) > 0 && !dryRun {
+		if _, err := AddDependencies(ctx, deps); err != nil {
+			return err
+		}
+	}
+	for _, message := range messages {
+		logging.Infof("%s", message)
+	}
+	for _, entry := range unmatched {
+		logging.Warnf("No package in the registries matches '%s'", strings.TrimSpace(entry.Name+" "+entry.Version))
+	}
+	if dryRun {
+		logging.Infof("Would import %d of %d dependencies from %s", len(deps), len(entries), manifestPath)
+	} else {
+		logging.Infof("Imported %d of %d dependencies from %s", len(deps), len(entries), manifestPath)
+	}
+	return nil
+}
+
+// matchManifestEntry finds the package in the registries that a manifest entry refers to: the
+// version of the manifest if it is registered, or else the latest version with its major version
+func matchManifestEntry(ctx context.Context, entry manifestEntry, registriesDir string, registryNames []string) (types.PackageLocation, bool, error) {
+	versions := []string{""}
+	if version := manifestVersion(entry.Version); version != "" {
+		major, err := GetMajorVersion(version)
+		if err != nil {
+			return types.PackageLocation{}, false, err
+		}
+		versions = []string{version, major}
+	}
+	for _, name := range manifestPackageNames(entry) {
+		for _, version := range versions {
+			pkg, err := findPackageInRegistries(ctx, name, version, false, registriesDir, registryNames)
+			if err == nil {
+				return pkg, true, nil
+			}
+			if KindOf(err) != KindNotFound {
+				return types.PackageLocation{}, false, err
+			}
+		}
+	}
+	return types.PackageLocation{}, false, nil
+}
@@ -0,0 +1,268 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// packageDetails is a package in the local registries, as printed by cosm info --json
+type packageDetails struct {
+	Name       string                 `json:"name"`
+	Registries []packageRegistryEntry `json:"registries"`
+	UsedBy     []packageUser          `json:"usedby"` // Local projects whose build list contains the package
+}
+
+// packageRegistryEntry describes a package in one registry, with the dependencies of the selected version
+type packageRegistryEntry struct {
+	Registry    string                  `json:"registry"`
+	UUID        string                  `json:"uuid"`
+	GitURL      string                  `json:"giturl"`
+	Subdir      string                  `json:"subdir,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	License     string                  `json:"license,omitempty"`
+	Homepage    string                  `json:"homepage,omitempty"`
+	Latest      string                  `json:"latest,omitempty"`
+	Version     string                  `json:"version,omitempty"` // The requested version, or the latest release
+	Notes       string                  `json:"notes,omitempty"`   // Release notes of Version
+	Deps        []indexDependency       `json:"deps"`
+	Versions    []registryVersionStatus `json:"versions"`
+}
+
+// packageUser is a local project that uses a package
+type packageUser struct {
+	Project string `json:"project"` // Directory of the project
+	Version string `json:"version"`
+	Direct  bool   `json:"direct"` // The package is a direct dependency of the project
+}
+
+// Info prints the details of a package in the local registries and the local projects that use it
+func Info(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 1 {
+		return validationError("requires a package (e.g., cosm info <package>[@v<version>])")
+	}
+	packageName, versionTag, found := strings.Cut(args[0], "@")
+	if packageName == "" {
+		return validationError("package name cannot be empty")
+	}
+	if found && !strings.HasPrefix(versionTag, "v") {
+		return validationError("version '%s' must start with 'v'", versionTag)
+	}
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return err
+	}
+	if registryName, _ := cmd.Flags().GetString("registry"); registryName != "" {
+		if !contains(registryNames, registryName) {
+			return notFoundError("registry '%s' not found in registries.json", registryName)
+		}
+		registryNames = []string{registryName}
+	}
+
+	details := packageDetails{Name: packageName, Registries: []packageRegistryEntry{}, UsedBy: []packageUser{}}
+	uuids := make(map[string]bool)
+	for _, registryName := range registryNames {
+		entry, found, err := collectPackageRegistryEntry(ctx, registriesDir, registryName, packageName, versionTag)
+		if err != nil {
+			return err
+		}
+		if found {
+			details.Registries = append(details.Registries, entry)
+			uuids[entry.UUID] = true
+		}
+	}
+	if len(details.Registries) == 0 {
+		if versionTag != "" {
+			return notFoundError("package '%s' with version '%s' not found in any registry", packageName, versionTag)
+		}
+		return notFoundError("package '%s' not found in any registry", packageName)
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	if details.UsedBy, err = findPackageUsers(cosmDir, uuids); err != nil {
+		return err
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(details, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal package info: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printPackageDetails(details)
+	return nil
+}
+
+// collectPackageRegistryEntry gathers a package in a registry; it is not found if the registry does
+// not have the package or the requested version
+func collectPackageRegistryEntry(ctx context.Context, registriesDir, registryName, packageName, versionTag string) (packageRegistryEntry, bool, error) {
+	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return packageRegistryEntry{}, false, fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+	}
+	pkgInfo, exists := registry.Packages[packageName]
+	if !exists {
+		return packageRegistryEntry{}, false, nil
+	}
+	entry := packageRegistryEntry{Registry: registryName, UUID: pkgInfo.UUID, GitURL: pkgInfo.GitURL, Subdir: pkgInfo.Subdir, Deps: []indexDependency{}, Versions: []registryVersionStatus{}}
+	versions, err := loadVersions(registriesDir, registryName, packageName)
+	if err != nil {
+		return entry, false, err
+	}
+	if versionTag != "" && !contains(versions, versionTag) {
+		return entry, false, nil
+	}
+	sortVersions(versions)
+	published, err := versionPublicationDates(ctx, registriesDir, registryName, packageName)
+	if err != nil {
+		return entry, false, err
+	}
+	for _, version := range versions {
+		status := registryVersionStatus{Version: version, Published: published[version]}
+		if specs, err := loadSpecs(registriesDir, registryName, packageName, version); err == nil {
+			status.Yanked = specs.Yanked
+		}
+		entry.Versions = append(entry.Versions, status)
+	}
+	if entry.Latest, err = latestReleasedVersion(registriesDir, registryName, packageName); err != nil {
+		return entry, false, err
+	}
+	entry.Version = versionTag
+	if entry.Version == "" {
+		entry.Version = entry.Latest
+	}
+	if entry.Version == "" {
+		return entry, true, nil
+	}
+	specs, err := loadSpecs(registriesDir, registryName, packageName, entry.Version)
+	if err != nil {
+		return entry, false, fmt.Errorf("failed to load specs for '%s@%s' in registry '%s': %w", packageName, entry.Version, registryName, err)
+	}
+	entry.Description = specs.Description
+	entry.License = specs.License
+	entry.Homepage = specs.Homepage
+	if entry.Notes, err = loadReleaseNotes(registriesDir, registryName, packageName, entry.Version); err != nil {
+		return entry, false, err
+	}
+	for _, key := range sortedDependencyKeys(specs.Deps) {
+		entry.Deps = append(entry.Deps, indexDependency{Name: specs.Deps[key].Name, Version: specs.Deps[key].Version})
+	}
+	return entry, true, nil
+}
+
+// findPackageUsers returns the local projects, sorted by directory, whose recorded build list (see
+// cosm cache clean --unused) contains a package with one of the UUIDs
+func findPackageUsers(cosmDir string, uuids map[string]bool) ([]packageUser, error) {
+	buildListFiles, err := loadBuildListUsage(cosmDir)
+	if err != nil {
+		return nil, err
+	}
+	users := []packageUser{}
+	for _, buildListFile := range buildListFiles {
+		if _, err := os.Stat(buildListFile); err != nil {
+			continue
+		}
+		buildList, err := loadBuildListFile(buildListFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load build list %s: %w", buildListFile, err)
+		}
+		projectDir := filepath.Dir(filepath.Dir(buildListFile))
+		project, _ := loadProjectFromDir(projectDir)
+		for _, dep := range buildList.Dependencies {
+			if !uuids[dep.UUID] {
+				continue
+			}
+			user := packageUser{Project: projectDir, Version: dep.Version}
+			if major, err := GetMajorVersion(dep.Version); err == nil && project != nil {
+				_, user.Direct = project.Deps[dep.UUID+"@"+major]
+			}
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Project != users[j].Project {
+			return users[i].Project < users[j].Project
+		}
+		return semVerLess(users[i].Version, users[j].Version)
+	})
+	return users, nil
+}
+
+// printPackageDetails displays a package in every registry and the projects that use it
+func printPackageDetails(details packageDetails) {
+	for _, entry := range details.Registries {
+		fmt.Printf("Package '%s' in registry '%s':\n", details.Name, entry.Registry)
+		if entry.Description != "" {
+			fmt.Printf("  Description: %s\n", entry.Description)
+		}
+		fmt.Printf("  UUID: %s\n", entry.UUID)
+		fmt.Printf("  Git URL: %s\n", entry.GitURL)
+		if entry.Subdir != "" {
+			fmt.Printf("  Subdirectory: %s\n", entry.Subdir)
+		}
+		if entry.License != "" {
+			fmt.Printf("  License: %s\n", entry.License)
+		}
+		if entry.Homepage != "" {
+			fmt.Printf("  Homepage: %s\n", entry.Homepage)
+		}
+		if entry.Latest != "" {
+			fmt.Printf("  Latest: %s\n", entry.Latest)
+		}
+		versions := make([]string, len(entry.Versions))
+		for i, version := range entry.Versions {
+			versions[i] = version.Version
+			if version.Yanked {
+				versions[i] += " (yanked)"
+			}
+		}
+		if len(versions) == 0 {
+			fmt.Println("  No versions registered.")
+			continue
+		}
+		fmt.Printf("  Versions: %s\n", strings.Join(versions, ", "))
+		if entry.Notes != "" {
+			fmt.Printf("  Release notes of %s:\n", entry.Version)
+			for _, line := range strings.Split(entry.Notes, "\n") {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+		if len(entry.Deps) == 0 {
+			fmt.Printf("  Dependencies of %s: none\n", entry.Version)
+			continue
+		}
+		fmt.Printf("  Dependencies of %s:\n", entry.Version)
+		for _, dep := range entry.Deps {
+			fmt.Printf("    - %s %s\n", dep.Name, dep.Version)
+		}
+	}
+	if len(details.UsedBy) == 0 {
+		fmt.Println("Not used by any local project")
+		return
+	}
+	fmt.Println("Used by local projects:")
+	for _, user := range details.UsedBy {
+		kind := "indirect"
+		if user.Direct {
+			kind = "direct"
+		}
+		fmt.Printf("  - %s (%s, %s)\n", user.Project, user.Version, kind)
+	}
+}
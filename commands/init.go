@@ -1,9 +1,12 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/google/uuid"
@@ -12,6 +15,9 @@ import (
 
 // Init initializes a new project with a Project.json file
 func Init(cmd *cobra.Command, args []string) error {
+	if gitURL, _ := cmd.Flags().GetString("from-git"); gitURL != "" {
+		return initFromGit(cmd, args, gitURL)
+	}
 	templatePath, _ := cmd.Flags().GetString("template")
 	if templatePath != "" {
 		return initWithTemplate(cmd, args, templatePath)
@@ -19,31 +25,123 @@ func Init(cmd *cobra.Command, args []string) error {
 	return initWithoutTemplate(cmd, args)
 }
 
+// projectManifestFile returns the file name of the manifest that cosm init creates: Project.json,
+// or cosm.toml with --format toml
+func projectManifestFile(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case "", "json":
+		return "Project.json", nil
+	case "toml":
+		return projectTOMLFile, nil
+	}
+	return "", validationError("invalid format '%s': must be json or toml", format)
+}
+
 // Init initializes a new project with a Project.json file
 func initWithoutTemplate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	packageName, version, err := validateInitArgsWithoutTemplate(args, cmd)
 	if err != nil {
 		return err
 	}
+	manifestFile, err := projectManifestFile(cmd)
+	if err != nil {
+		return err
+	}
 	language := getInitLanguageFlag(cmd)
 	if version != "" {
 		if err := validateVersion(version); err != nil {
 			return err
 		}
 	}
+	var cosmDir string
+	if language != "" {
+		if cosmDir, err = getCosmDir(); err != nil {
+			return fmt.Errorf("failed to get cosm directory: %w", err)
+		}
+		if language, err = validateLanguage(ctx, cosmDir, language); err != nil {
+			return err
+		}
+	}
 	projectUUID := uuid.New().String()
-	authors, err := getGitAuthors()
+	authors, err := getGitAuthors(ctx)
 	if err != nil {
 		return err
 	}
-	if err := ensureProjectFileDoesNotExist("Project.json"); err != nil {
+	if err := ensureProjectFileDoesNotExist(manifestFile); err != nil {
 		return err
 	}
+	if language != "" {
+		if err := scaffoldLanguage(ctx, cosmDir, language, packageName); err != nil {
+			return err
+		}
+	}
 	project := createProject(packageName, projectUUID, authors, language, version)
-	if err := saveProject(&project, "Project.json"); err != nil {
+	if err := saveProject(&project, manifestFile); err != nil {
 		return err
 	}
-	fmt.Printf("Initialized project '%s' with version %s\n", packageName, version)
+	logging.Infof("Initialized project '%s' with version %s", packageName, version)
+	return nil
+}
+
+// knownLanguages are the languages for which an activated environment sets search paths,
+// with the extension of their source files
+var knownLanguages = map[string]string{
+	"terra":  ".t",
+	"lua":    ".lua",
+	"python": ".py",
+}
+
+// validateLanguage checks that a language is known, either built in or by having templates,
+// and returns its canonical (lowercase) name
+func validateLanguage(ctx context.Context, cosmDir, language string) (string, error) {
+	language = strings.ToLower(language)
+	if _, known := knownLanguages[language]; known {
+		return language, nil
+	}
+	if hasTemplateLanguage(ctx, cosmDir, language) {
+		return language, nil
+	}
+	var names []string
+	for name := range knownLanguages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown language '%s' (known languages: %s, or any language with templates)", language, strings.Join(names, ", "))
+}
+
+// scaffoldLanguage creates the source layout of a new project in the current directory from
+// the default template of the language (<language>/default). Without a default
+// template, an empty source file src/<package name><ext> is created instead.
+func scaffoldLanguage(ctx context.Context, cosmDir, language, packageName string) error {
+	templatePath := filepath.Join(language, "default")
+	if templateFullPath, err := resolveTemplateDir(ctx, cosmDir, templatePath); err == nil {
+		if err := ensureTemplateFilesDoNotExist(templateFullPath, ".", "default", packageName); err != nil {
+			return err
+		}
+		if err := copyTemplateFiles(templateFullPath, ".", "default", packageName); err != nil {
+			return fmt.Errorf("failed to copy template files: %w", err)
+		}
+		logging.Infof("Created source layout from template '%s'", templatePath)
+		return nil
+	}
+
+	logging.Warnf("no default template found for %s; creating a minimal source layout", language)
+	if err := os.MkdirAll("src", 0755); err != nil {
+		return fmt.Errorf("failed to create src directory: %w", err)
+	}
+	ext, known := knownLanguages[language]
+	if !known {
+		return nil
+	}
+	sourceFile := filepath.Join("src", packageName+ext)
+	if _, err := os.Stat(sourceFile); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(sourceFile, nil, 0644); err != nil {
+		return fmt.Errorf("failed to create %s: %w", sourceFile, err)
+	}
 	return nil
 }
 
@@ -54,7 +152,7 @@ func validateInitArgsWithoutTemplate(args []string, cmd *cobra.Command) (string,
 	}
 	packageName := args[0]
 	if packageName == "" {
-		return "", "", fmt.Errorf("package name cannot be empty")
+		return "", "", validationError("package name cannot be empty")
 	}
 
 	// Check version from args or flag
@@ -77,37 +175,50 @@ func validateInitArgsWithoutTemplate(args []string, cmd *cobra.Command) (string,
 
 // initWithTemplate initializes a project using a template
 func initWithTemplate(cmd *cobra.Command, args []string, templatePath string) error {
+	ctx := cmd.Context()
 	packageName, version, err := validateInitArgsWithTemplate(args, cmd)
 	if err != nil {
 		return err
 	}
+	manifestFile, err := projectManifestFile(cmd)
+	if err != nil {
+		return err
+	}
 
 	// Determine language from template path
 	parts := strings.Split(templatePath, string(filepath.Separator))
 	if len(parts) < 2 {
-		return fmt.Errorf("template path %s must start with <language>/", templatePath)
+		return validationError("template path %s must start with <language>/", templatePath)
 	}
 	language := parts[0]
 
 	// Create project directory
 	projectDir := packageName
 	if err := os.Mkdir(projectDir, 0755); err != nil {
-		return fmt.Errorf("failed to create project directory %s: %v", projectDir, err)
+		return fmt.Errorf("failed to create project directory %s: %w", projectDir, err)
 	}
 
 	// Copy template files
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	templateFullPath, err := resolveTemplateDir(ctx, cosmDir, templatePath)
+	if err != nil {
+		return err
+	}
 	templateName := filepath.Base(templatePath)
-	if err := copyTemplateFiles(templatePath, projectDir, templateName, packageName); err != nil {
-		return fmt.Errorf("failed to copy template files: %v", err)
+	if err := copyTemplateFiles(templateFullPath, projectDir, templateName, packageName); err != nil {
+		return fmt.Errorf("failed to copy template files: %w", err)
 	}
 
 	// Initialize project
 	projectUUID := uuid.New().String()
-	authors, err := getGitAuthors()
+	authors, err := getGitAuthors(ctx)
 	if err != nil {
 		return err
 	}
-	projectFile := filepath.Join(projectDir, "Project.json")
+	projectFile := filepath.Join(projectDir, manifestFile)
 	if err := ensureProjectFileDoesNotExist(projectFile); err != nil {
 		return err
 	}
@@ -117,22 +228,23 @@ func initWithTemplate(cmd *cobra.Command, args []string, templatePath string) er
 	}
 
 	// Initialize git repository
-	if err := initializeGitRepo(projectDir); err != nil {
-		return fmt.Errorf("failed to initialize git repository: %v", err)
+	if err := initializeGitRepo(ctx, projectDir); err != nil {
+		return fmt.Errorf("failed to initialize git repository: %w", err)
 	}
 
-	fmt.Printf("Initialized project '%s' with version %s in %s\n", packageName, version, projectDir)
+	logging.Infof("Initialized project '%s' with version %s in %s", packageName, version, projectDir)
 	return nil
 }
 
 // validateInitArgsWithTemplate checks the command-line arguments and flags for template mode
 func validateInitArgsWithTemplate(args []string, cmd *cobra.Command) (string, string, error) {
+	ctx := cmd.Context()
 	if len(args) < 1 || len(args) > 2 {
 		return "", "", fmt.Errorf("one or two arguments required (e.g., cosm init <package-name> [version])")
 	}
 	packageName := args[0]
 	if packageName == "" {
-		return "", "", fmt.Errorf("package name cannot be empty")
+		return "", "", validationError("package name cannot be empty")
 	}
 
 	// Check version from args or flag
@@ -165,29 +277,22 @@ func validateInitArgsWithTemplate(args []string, cmd *cobra.Command) (string, st
 	templatePath, _ := cmd.Flags().GetString("template")
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get cosm directory: %v", err)
+		return "", "", fmt.Errorf("failed to get cosm directory: %w", err)
 	}
-	templateFullPath := filepath.Join(cosmDir, "templates", templatePath)
-	if _, err := os.Stat(templateFullPath); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("template directory %s does not exist", templateFullPath)
+	if _, err := resolveTemplateDir(ctx, cosmDir, templatePath); err != nil {
+		return "", "", err
 	}
 	// Validate template path starts with <language>/
 	parts := strings.Split(templatePath, string(filepath.Separator))
 	if len(parts) < 2 {
-		return "", "", fmt.Errorf("template path %s must start with <language>/", templatePath)
+		return "", "", validationError("template path %s must start with <language>/", templatePath)
 	}
 
 	return packageName, version, nil
 }
 
 // copyTemplateFiles copies files from the template directory to the project directory, replacing templateName with packageName in contents and filenames
-func copyTemplateFiles(templatePath, projectDir, templateName, packageName string) error {
-	cosmDir, err := getCosmDir()
-	if err != nil {
-		return fmt.Errorf("failed to get cosm directory: %v", err)
-	}
-	templateFullPath := filepath.Join(cosmDir, "templates", templatePath)
-
+func copyTemplateFiles(templateFullPath, projectDir, templateName, packageName string) error {
 	return filepath.Walk(templateFullPath, func(srcPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -196,22 +301,13 @@ func copyTemplateFiles(templatePath, projectDir, templateName, packageName strin
 		// Compute relative path and destination
 		relPath, err := filepath.Rel(templateFullPath, srcPath)
 		if err != nil {
-			return fmt.Errorf("failed to compute relative path for %s: %v", srcPath, err)
+			return fmt.Errorf("failed to compute relative path for %s: %w", srcPath, err)
 		}
 		if relPath == "." {
 			return nil // Skip root directory itself
 		}
 
-		// Determine destination filename, renaming <templateName>.* to <packageName>.*
-		destRelPath := relPath
-		baseName := filepath.Base(relPath)
-		ext := filepath.Ext(baseName)
-		nameWithoutExt := strings.TrimSuffix(baseName, ext)
-		if nameWithoutExt == templateName {
-			newBaseName := packageName + ext
-			destRelPath = filepath.Join(filepath.Dir(relPath), newBaseName)
-		}
-		destPath := filepath.Join(projectDir, destRelPath)
+		destPath := filepath.Join(projectDir, templateDestPath(relPath, templateName, packageName))
 
 		// Handle directories
 		if info.IsDir() {
@@ -221,40 +317,206 @@ func copyTemplateFiles(templatePath, projectDir, templateName, packageName strin
 		// Copy and replace content for text files
 		data, err := os.ReadFile(srcPath)
 		if err != nil {
-			return fmt.Errorf("failed to read template file %s: %v", srcPath, err)
+			return fmt.Errorf("failed to read template file %s: %w", srcPath, err)
 		}
 		// Assume text files for simplicity; skip binary files if needed
 		content := string(data)
 		newContent := strings.ReplaceAll(content, templateName, packageName)
 
 		if err := os.WriteFile(destPath, []byte(newContent), info.Mode()); err != nil {
-			return fmt.Errorf("failed to write file %s: %v", destPath, err)
+			return fmt.Errorf("failed to write file %s: %w", destPath, err)
 		}
 
 		return nil
 	})
 }
 
+// templateDestPath returns the path of a template file in the new project, renaming
+// <templateName>.* to <packageName>.*
+func templateDestPath(relPath, templateName, packageName string) string {
+	baseName := filepath.Base(relPath)
+	ext := filepath.Ext(baseName)
+	if strings.TrimSuffix(baseName, ext) == templateName {
+		return filepath.Join(filepath.Dir(relPath), packageName+ext)
+	}
+	return relPath
+}
+
+// ensureTemplateFilesDoNotExist checks that copying a template into projectDir does not overwrite any file
+func ensureTemplateFilesDoNotExist(templateFullPath, projectDir, templateName, packageName string) error {
+	return filepath.Walk(templateFullPath, func(srcPath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(templateFullPath, srcPath)
+		if err != nil {
+			return fmt.Errorf("failed to compute relative path for %s: %w", srcPath, err)
+		}
+		destPath := filepath.Join(projectDir, templateDestPath(relPath, templateName, packageName))
+		if _, err := os.Stat(destPath); err == nil {
+			return conflictError("template file %s already exists in the project", destPath)
+		}
+		return nil
+	})
+}
+
 // initializeGitRepo initializes a git repository, adds all files, and commits
-func initializeGitRepo(projectDir string) error {
+func initializeGitRepo(ctx context.Context, projectDir string) error {
 	// Run git init
-	if _, err := GitCommand(projectDir, "init"); err != nil {
-		return fmt.Errorf("failed to initialize git repository in %s: %v", projectDir, err)
+	if _, err := GitCommand(ctx, projectDir, "init"); err != nil {
+		return fmt.Errorf("failed to initialize git repository in %s: %w", projectDir, err)
 	}
 
 	// Add all files
-	if err := stageFiles(projectDir, "."); err != nil {
-		return fmt.Errorf("failed to stage files in %s: %v", projectDir, err)
+	if err := stageFiles(ctx, projectDir, "."); err != nil {
+		return fmt.Errorf("failed to stage files in %s: %w", projectDir, err)
 	}
 
 	// Commit files
-	if err := commitChanges(projectDir, "Initial commit"); err != nil {
-		return fmt.Errorf("failed to commit files in %s: %v", projectDir, err)
+	if err := commitChanges(ctx, projectDir, "Initial commit"); err != nil {
+		return fmt.Errorf("failed to commit files in %s: %w", projectDir, err)
+	}
+
+	return nil
+}
+
+// initFromGit clones an existing repository into a directory named after the package and turns it
+// into a cosm package: Project.json is created with a fresh UUID and committed, but not pushed. The
+// name defaults to the name of the repository, and the version to its highest release tag, so that
+// the next cosm release continues from there. Both are asked for if they are not given and input
+// is enabled.
+func initFromGit(cmd *cobra.Command, args []string, gitURL string) error {
+	ctx := cmd.Context()
+	if templatePath, _ := cmd.Flags().GetString("template"); templatePath != "" {
+		return validationError("cannot specify --template when using --from-git")
+	}
+	if len(args) > 2 {
+		return validationError("at most a package name and a version can be given (e.g., cosm init --from-git <url> [<package-name>] [version])")
+	}
+	manifestFile, err := projectManifestFile(cmd)
+	if err != nil {
+		return err
+	}
+	interactive := !inputDisabled() && stdinIsTerminal()
+	packageName := repositoryName(gitURL)
+	if len(args) > 0 {
+		packageName = args[0]
+	} else if interactive {
+		packageName = promptUserForValue("Package name", packageName)
+	}
+	if packageName == "" {
+		return validationError("cannot derive a package name from '%s'; pass it as an argument", gitURL)
+	}
+	version := ""
+	if len(args) == 2 {
+		version = args[1]
+	}
+	flagVersion, _ := cmd.Flags().GetString("version")
+	if version != "" && flagVersion != "" {
+		return validationError("cannot specify version both as an argument and a flag")
+	}
+	if version == "" {
+		version = flagVersion
+	}
+	if version != "" {
+		if err := validateVersion(version); err != nil {
+			return err
+		}
+	}
+	language := getInitLanguageFlag(cmd)
+	if language != "" {
+		cosmDir, err := getCosmDir()
+		if err != nil {
+			return fmt.Errorf("failed to get cosm directory: %w", err)
+		}
+		if language, err = validateLanguage(ctx, cosmDir, language); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(packageName); err == nil {
+		return conflictError("destination '%s' already exists", packageName)
 	}
 
+	projectDir, err := clone(ctx, gitURL, ".", packageName)
+	if err != nil {
+		return err
+	}
+	imported := false
+	defer func() {
+		if !imported {
+			os.RemoveAll(projectDir)
+		}
+	}()
+	existing := projectFilePath(filepath.Join(projectDir, "Project.json"))
+	if _, err := os.Stat(existing); err == nil {
+		return conflictError("repository '%s' already has a %s; use git clone or cosm clone instead", gitURL, filepath.Base(existing))
+	}
+	projectFile := filepath.Join(projectDir, manifestFile)
+	if version == "" {
+		latest, err := latestReleaseTag(ctx, projectDir)
+		if err != nil {
+			return err
+		}
+		version = "v0.1.0"
+		if latest != "" {
+			version = latest
+		}
+		if interactive {
+			version = promptUserForValue("Version", version)
+		}
+		if err := validateVersion(version); err != nil {
+			return err
+		}
+	}
+
+	authors, err := getGitAuthors(ctx)
+	if err != nil {
+		return err
+	}
+	project := createProject(packageName, uuid.New().String(), authors, language, version)
+	if err := saveProject(&project, projectFile); err != nil {
+		return err
+	}
+	if err := stageFiles(ctx, projectDir, manifestFile); err != nil {
+		return err
+	}
+	if err := commitChanges(ctx, projectDir, "Add "+manifestFile); err != nil {
+		return err
+	}
+	imported = true
+	logging.Infof("Initialized project '%s' with version %s in %s; push the commit with %s or run cosm release to publish it", packageName, version, projectDir, manifestFile)
 	return nil
 }
 
+// repositoryName returns the last path element of a git URL without .git, e.g. mylib for
+// git@github.com:me/mylib.git
+func repositoryName(gitURL string) string {
+	name := strings.TrimSuffix(strings.TrimRight(gitURL, "/"), ".git")
+	if idx := strings.LastIndexAny(name, "/:"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// latestReleaseTag returns the highest tag of a repository that is a version without a
+// prerelease, or "" if there is none
+func latestReleaseTag(ctx context.Context, dir string) (string, error) {
+	tags, err := listTags(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, tag := range tags {
+		if _, err := ParseSemVer(tag); err != nil || validateVersion(tag) != nil || IsPrerelease(tag) {
+			continue
+		}
+		if latest == "" || semVerLess(latest, tag) {
+			latest = tag
+		}
+	}
+	return latest, nil
+}
+
 // getInitLanguageFlag retrieves the language flag from the command
 func getInitLanguageFlag(cmd *cobra.Command) string {
 	language, _ := cmd.Flags().GetString("language")
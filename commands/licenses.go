@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"cosm/logging"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// licenseFileNames are the files checked, in order, for the license of a cached package
+var licenseFileNames = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "LICENCE", "COPYING", "COPYING.md"}
+
+// licenseSignatures maps phrases of common license texts, in lower case with single spaces, to
+// their SPDX identifiers. More specific phrases come first, e.g. the LGPL before the GPL.
+var licenseSignatures = []struct {
+	phrase string
+	id     string
+}{
+	{"apache license version 2.0", "Apache-2.0"},
+	{"apache license, version 2.0", "Apache-2.0"},
+	{"mozilla public license version 2.0", "MPL-2.0"},
+	{"gnu lesser general public license version 3", "LGPL-3.0"},
+	{"gnu lesser general public license version 2.1", "LGPL-2.1"},
+	{"gnu affero general public license version 3", "AGPL-3.0"},
+	{"gnu general public license version 3", "GPL-3.0"},
+	{"gnu general public license version 2", "GPL-2.0"},
+	{"this is free and unencumbered software released into the public domain", "Unlicense"},
+	{"permission is hereby granted, free of charge", "MIT"},
+	{"permission to use, copy, modify, and/or distribute this software for any purpose", "ISC"},
+	{"neither the name of", "BSD-3-Clause"},
+	{"redistribution and use in source and binary forms", "BSD-2-Clause"},
+}
+
+// dependencyLicense is the license of a package in the build list, as printed by cosm licenses --json
+type dependencyLicense struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	UUID      string `json:"uuid"`
+	License   string `json:"license,omitempty"`
+	Source    string `json:"source"`              // "specs", the license file it was detected from, or "unknown"
+	Violation string `json:"violation,omitempty"` // Why the license is rejected by the policy
+}
+
+// Licenses prints the license of every package in the build list of the project and fails if a
+// license violates the allow or deny list
+func Licenses(cmd *cobra.Command, args []string) error {
+	allow, _ := cmd.Flags().GetStringSlice("allow")
+	deny, _ := cmd.Flags().GetStringSlice("deny")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	project, err := validateActivate(args)
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	buildList, err := loadCurrentBuildList(project, registriesDir)
+	if err != nil {
+		return err
+	}
+
+	licenses := []dependencyLicense{}
+	violations := 0
+	for _, dep := range buildList.Dependencies {
+		entry := dependencyLicense{Name: dep.Name, Version: dep.Version, UUID: dep.UUID, Source: "unknown"}
+		if specs, _, err := findDependency(dep.Name, dep.Version, dep.UUID, "", registriesDir); err == nil && specs.License != "" {
+			entry.License, entry.Source = specs.License, "specs"
+		} else if license, file := detectLicense(packagePath(cosmDir, dep)); license != "" {
+			entry.License, entry.Source = license, file
+		}
+		if entry.Violation = licenseViolation(entry.License, allow, deny); entry.Violation != "" {
+			violations++
+		}
+		licenses = append(licenses, entry)
+	}
+	sort.Slice(licenses, func(i, j int) bool {
+		if licenses[i].Name != licenses[j].Name {
+			return licenses[i].Name < licenses[j].Name
+		}
+		return semVerLess(licenses[i].Version, licenses[j].Version)
+	})
+
+	if asJSON {
+		data, err := json.MarshalIndent(licenses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal licenses: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printLicenses(licenses)
+	}
+	if violations > 0 {
+		return fmt.Errorf("found %d license violation(s) in %d package(s)", violations, len(licenses))
+	}
+	if !asJSON && (len(allow) > 0 || len(deny) > 0) {
+		logging.Infof("All %d package(s) comply with the license policy", len(licenses))
+	}
+	return nil
+}
+
+// detectLicense identifies the license of a cached package tree from its license file; it returns
+// "" if the package is not cached or the license is not recognized
+func detectLicense(packageDir string) (string, string) {
+	for _, name := range licenseFileNames {
+		data, err := os.ReadFile(filepath.Join(packageDir, name))
+		if err != nil {
+			continue
+		}
+		text := strings.ToLower(strings.Join(strings.Fields(string(data)), " "))
+		for _, signature := range licenseSignatures {
+			if strings.Contains(text, signature.phrase) {
+				return signature.id, name
+			}
+		}
+		return "", ""
+	}
+	return "", ""
+}
+
+// licenseViolation returns why a license is rejected by the policy, or "" if it is accepted.
+// Licenses are compared case-insensitively; with an allow list, an unknown license is rejected.
+func licenseViolation(license string, allow, deny []string) string {
+	for _, denied := range deny {
+		if license != "" && strings.EqualFold(license, denied) {
+			return "denied"
+		}
+	}
+	if len(allow) == 0 {
+		return ""
+	}
+	for _, allowed := range allow {
+		if license != "" && strings.EqualFold(license, allowed) {
+			return ""
+		}
+	}
+	return "not allowed"
+}
+
+// printLicenses prints a line per package with its license, where it was found, and violations
+func printLicenses(licenses []dependencyLicense) {
+	if len(licenses) == 0 {
+		fmt.Println("No dependencies.")
+		return
+	}
+	for _, entry := range licenses {
+		license := entry.License
+		if license == "" {
+			license = "unknown"
+		}
+		line := fmt.Sprintf("%s %s: %s", entry.Name, entry.Version, license)
+		if entry.Source != "specs" && entry.Source != "unknown" {
+			line += fmt.Sprintf(" (detected from %s)", entry.Source)
+		}
+		if entry.Violation != "" {
+			line += fmt.Sprintf(" [%s]", entry.Violation)
+		}
+		fmt.Println(line)
+	}
+}
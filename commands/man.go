@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"cosm/logging"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Man writes a man page for every command (section 1) and every help topic (section 7) to a directory
+func Man(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create man page directory %s: %w", dir, err)
+	}
+	count := 0
+	var write func(c *cobra.Command) error
+	write = func(c *cobra.Command) error {
+		if !c.IsAvailableCommand() && c != c.Root() {
+			return nil
+		}
+		name := strings.ReplaceAll(c.CommandPath(), " ", "-")
+		if err := os.WriteFile(filepath.Join(dir, name+".1"), []byte(commandManPage(c)), 0644); err != nil {
+			return fmt.Errorf("failed to write man page of '%s': %w", c.CommandPath(), err)
+		}
+		count++
+		for _, sub := range c.Commands() {
+			if err := write(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(cmd.Root()); err != nil {
+		return err
+	}
+	for _, topic := range helpTopics {
+		if err := os.WriteFile(filepath.Join(dir, "cosm-"+topic.name+".7"), []byte(topicManPage(topic)), 0644); err != nil {
+			return fmt.Errorf("failed to write man page of topic '%s': %w", topic.name, err)
+		}
+		count++
+	}
+	logging.Infof("Wrote %d man page(s) to %s", count, dir)
+	return nil
+}
+
+// commandManPage renders the man page of a command in roff
+func commandManPage(c *cobra.Command) string {
+	var b strings.Builder
+	name := strings.ReplaceAll(c.CommandPath(), " ", "-")
+	fmt.Fprintf(&b, ".TH %q 1 \"\" \"cosm\" \"Cosm Manual\"\n", strings.ToUpper(name))
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", name, roffEscape(c.Short))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B %s\n", roffEscape(c.UseLine()))
+	description := c.Long
+	if description == "" {
+		description = c.Short
+	}
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n%s\n", roffEscape(description))
+	writeManFlags(&b, "OPTIONS", c.NonInheritedFlags())
+	writeManFlags(&b, "GLOBAL OPTIONS", c.InheritedFlags())
+
+	var seeAlso []string
+	if c.HasParent() {
+		seeAlso = append(seeAlso, strings.ReplaceAll(c.Parent().CommandPath(), " ", "-")+"(1)")
+	}
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() {
+			seeAlso = append(seeAlso, strings.ReplaceAll(sub.CommandPath(), " ", "-")+"(1)")
+		}
+	}
+	if !c.HasParent() {
+		for _, topic := range helpTopics {
+			seeAlso = append(seeAlso, "cosm-"+topic.name+"(7)")
+		}
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(&b, ".SH SEE ALSO\n%s\n", roffEscape(strings.Join(seeAlso, ", ")))
+	}
+	return b.String()
+}
+
+// writeManFlags renders a section with the flags of a command
+func writeManFlags(b *strings.Builder, section string, flags *pflag.FlagSet) {
+	var lines []string
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden {
+			return
+		}
+		names := "--" + flag.Name
+		if flag.Shorthand != "" {
+			names = "-" + flag.Shorthand + ", " + names
+		}
+		lines = append(lines, fmt.Sprintf(".TP\n\\fB%s\\fR\n%s\n", roffEscape(names), roffEscape(flag.Usage)))
+	})
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+	fmt.Fprintf(b, ".SH %s\n%s", section, strings.Join(lines, ""))
+}
+
+// topicManPage renders a help topic in roff
+func topicManPage(topic helpTopic) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %q 7 \"\" \"cosm\" \"Cosm Manual\"\n", strings.ToUpper("cosm-"+topic.name))
+	fmt.Fprintf(&b, ".SH NAME\ncosm-%s \\- %s\n", topic.name, roffEscape(topic.short))
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n.nf\n%s\n.fi\n", roffEscape(topic.text))
+	fmt.Fprintf(&b, ".SH SEE ALSO\ncosm(1)\n")
+	return b.String()
+}
+
+// roffEscape escapes backslashes and hyphens, and dots and quotes at the start of a line, for roff
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\e")
+	text = strings.ReplaceAll(text, "-", "\\-")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = "\\&" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
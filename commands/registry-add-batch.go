@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"cosm/logging"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// batchAddResult is the outcome of adding one package of a batch to a registry
+type batchAddResult struct {
+	gitURL string
+	config *addPackageConfig
+	err    error
+}
+
+// registryAddBatch adds the packages listed in a file to a registry with a single commit and push
+func registryAddBatch(cmd *cobra.Command, args []string, batchFile string) error {
+	ctx := cmd.Context()
+	if len(args) != 1 {
+		return validationError("requires exactly one argument (registry name) when using --batch")
+	}
+	if path, _ := cmd.Flags().GetString("path"); path != "" {
+		return validationError("--batch cannot be combined with --path")
+	}
+	if subdir, _ := cmd.Flags().GetString("subdir"); subdir != "" {
+		return validationError("--batch cannot be combined with --subdir")
+	}
+	gitURLs, err := readBatchFile(batchFile)
+	if err != nil {
+		return err
+	}
+	shallow, _ := cmd.Flags().GetBool("shallow")
+	force, _ := cmd.Flags().GetBool("force")
+	registryName := args[0]
+
+	results, err := addPackagesToRegistry(ctx, registryName, gitURLs, shallow, force)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			logging.Warnf("failed to add '%s': %v", result.gitURL, result.err)
+			continue
+		}
+		logging.Infof("Added package '%s' to registry '%s'", result.config.packageName, registryName)
+	}
+	for _, result := range results {
+		if result.err == nil {
+			notifyWebhooks(ctx, result.config.registriesDir, registryName, result.config.packageName, result.config.tags)
+		}
+	}
+	logging.Infof("Added %d of %d packages to registry '%s'", len(results)-failed, len(results), registryName)
+	if failed > 0 {
+		return fmt.Errorf("failed to add %d of %d packages to registry '%s'", failed, len(results), registryName)
+	}
+	return nil
+}
+
+// readBatchFile reads the git URLs in a batch file, one per line; blank lines and lines starting with # are skipped
+func readBatchFile(batchFile string) ([]string, error) {
+	file, err := os.Open(batchFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError("batch file %s not found", batchFile)
+		}
+		return nil, fmt.Errorf("failed to open batch file %s: %w", batchFile, err)
+	}
+	defer file.Close()
+	var gitURLs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		gitURLs = append(gitURLs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch file %s: %w", batchFile, err)
+	}
+	if len(gitURLs) == 0 {
+		return nil, validationError("batch file %s lists no git URLs", batchFile)
+	}
+	return gitURLs, nil
+}
+
+// addPackagesToRegistry registers every package under a single lock and pull of the registry. Each
+// package that is added is staged, so that the changes of a failed package can be reverted without
+// losing the others; the staged packages are committed and pushed at the end.
+func addPackagesToRegistry(ctx context.Context, registryName string, gitURLs []string, shallow, force bool) ([]batchAddResult, error) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return nil, err
+	}
+	registriesDir := filepath.Join(cosmDir, "registries")
+	if err := assertRegistryExists(registriesDir, registryName); err != nil {
+		return nil, err
+	}
+	if err := assertRegistryWritable(registriesDir, registryName); err != nil {
+		return nil, err
+	}
+	registryDir := filepath.Join(registriesDir, registryName)
+	unlockDepot, err := lockDepot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockDepot()
+	unlockRegistry, err := lockRegistry(ctx, registryName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockRegistry()
+	if err := updateSingleRegistry(ctx, registriesDir, registryName); err != nil {
+		return nil, err
+	}
+
+	var results []batchAddResult
+	var added []string
+	for _, gitURL := range gitURLs {
+		config, err := newAddPackageConfig(ctx, RegistryAddOptions{Registry: registryName, GitURL: gitURL, Shallow: shallow, Force: force})
+		if err == nil {
+			config.registry, config.registryFile, err = LoadRegistryMetadata(registriesDir, registryName)
+		}
+		if err == nil {
+			err = registerPackageWithAllVersions(ctx, config)
+		}
+		if err == nil {
+			err = stageFiles(ctx, registryDir, ".")
+		}
+		if err != nil {
+			if revertErr := revertUnstagedChanges(ctx, registryDir); revertErr != nil {
+				return nil, fmt.Errorf("failed to revert the changes of '%s': %w", gitURL, revertErr)
+			}
+		} else {
+			added = append(added, config.packageName)
+		}
+		results = append(results, batchAddResult{gitURL: gitURL, config: config, err: err})
+	}
+	if len(added) == 0 {
+		return results, nil
+	}
+	commitMsg := fmt.Sprintf("Added packages %s", strings.Join(added, ", "))
+	if err := commitAndPushRegistryChanges(ctx, registriesDir, registryName, commitMsg); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// revertUnstagedChanges restores the tracked files of a repository to the index and removes the
+// untracked files, except backups of metadata files
+func revertUnstagedChanges(ctx context.Context, dir string) error {
+	if _, err := GitCommand(ctx, dir, "checkout", "--", "."); err != nil {
+		return wrapGitError(dir, "failed to restore files", err)
+	}
+	if _, err := GitCommand(ctx, dir, "clean", "-fd", "-e", "*"+backupSuffix); err != nil {
+		return wrapGitError(dir, "failed to remove untracked files", err)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"encoding/json"
 	"fmt"
@@ -24,19 +26,90 @@ type addPackageConfig struct {
 	packageUUID   string
 	packageDir    string
 	clonePath     string
+	subdir        string
+	mirrors       []string
 	tags          []string
+	shallow       bool
+	force         bool // Publish even if the author is not a maintainer of the package
+}
+
+// RegistryAddOptions describes a package, or a version of a registered package, to add to a registry
+type RegistryAddOptions struct {
+	Registry string
+	GitURL   string // Repository of a package to add with all its versions
+	Path     string // Local repository of a package to add with all its versions, instead of GitURL
+	Package  string // Subdirectory of the package in a monorepo
+	Name     string // Registered package to add Version of, instead of GitURL or Path
+	Version  string
+	Shallow  bool // Clone the package without its full history
+	Force    bool // Publish even if the author is not a maintainer of the package
+}
+
+// RegistryAddResult is the package and the versions that were added to a registry
+type RegistryAddResult struct {
+	Registry string
+	Name     string
+	UUID     string
+	Versions []string
 }
 
 // RegistryAdd adds a package with all versions or a specific version to a registry
 func RegistryAdd(cmd *cobra.Command, args []string) error {
-	// Parse arguments and setup
-	config, err := parseRegistryAddArgs(args)
+	ctx := cmd.Context()
+	if batchFile, _ := cmd.Flags().GetString("batch"); batchFile != "" {
+		return registryAddBatch(cmd, args, batchFile)
+	}
+	opts, err := parseRegistryAddArgs(cmd, args)
+	if err != nil {
+		return err
+	}
+	result, err := AddToRegistry(ctx, opts)
 	if err != nil {
 		return err
 	}
+	if opts.Version != "" {
+		logging.Infof("Added version '%s' of package '%s' to registry '%s'", opts.Version, result.Name, result.Registry)
+		return nil
+	}
+	logging.Infof("Added package '%s' to registry '%s'", result.Name, result.Registry)
+	return nil
+}
+
+// AddToRegistry adds a package with all its versions, or a version of a registered package, to a
+// registry and pushes the registry
+func AddToRegistry(ctx context.Context, opts RegistryAddOptions) (RegistryAddResult, error) {
+	config, err := newAddPackageConfig(ctx, opts)
+	if err != nil {
+		return RegistryAddResult{}, err
+	}
+	if err := runRegistryAdd(ctx, config); err != nil {
+		return RegistryAddResult{}, err
+	}
+	notifyWebhooks(ctx, config.registriesDir, config.registryName, config.packageName, config.tags)
+	return RegistryAddResult{
+		Registry: config.registryName,
+		Name:     config.packageName,
+		UUID:     config.packageUUID,
+		Versions: config.tags,
+	}, nil
+}
+
+// runRegistryAdd updates the registry and adds the package or version described by config
+func runRegistryAdd(ctx context.Context, config *addPackageConfig) error {
+	// Lock the depot for the clone of the package, then the registry until it is pushed
+	unlockDepot, err := lockDepot(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlockDepot()
+	unlockRegistry, err := lockRegistry(ctx, config.registryName)
+	if err != nil {
+		return err
+	}
+	defer unlockRegistry()
 
 	// Update registry
-	if err := updateSingleRegistry(config.registriesDir, config.registryName); err != nil {
+	if err := updateSingleRegistry(ctx, config.registriesDir, config.registryName); err != nil {
 		return err
 	}
 
@@ -48,59 +121,125 @@ func RegistryAdd(cmd *cobra.Command, args []string) error {
 
 	if config.versionTag == "" {
 		// Mode 1: Add package with all versions
-		return addPackageWithAllVersions(config)
+		return addPackageWithAllVersions(ctx, config)
 	}
 	// Mode 2: Add specific version
-	return addSpecificPackageVersion(config)
+	return addSpecificPackageVersion(ctx, config)
+}
+
+// parseRegistryAddArgs validates the arguments and parses them with the flags into options
+func parseRegistryAddArgs(cmd *cobra.Command, args []string) (RegistryAddOptions, error) {
+	opts := RegistryAddOptions{}
+	opts.Path, _ = cmd.Flags().GetString("path")
+	opts.Package, _ = cmd.Flags().GetString("subdir")
+	opts.Shallow, _ = cmd.Flags().GetBool("shallow")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	if opts.Path != "" {
+		if len(args) != 1 {
+			return RegistryAddOptions{}, validationError("requires exactly one argument (registry name) when using --path")
+		}
+	} else if len(args) != 2 && len(args) != 3 {
+		return RegistryAddOptions{}, validationError("requires two arguments (registry name, package giturl) or three arguments (registry name, package name, version)")
+	}
+	opts.Registry = args[0]
+	switch len(args) {
+	case 2:
+		opts.GitURL = args[1]
+		if opts.GitURL == "" {
+			return RegistryAddOptions{}, validationError("package giturl must not be empty")
+		}
+	case 3:
+		opts.Name, opts.Version = args[1], args[2]
+		if opts.Name == "" {
+			return RegistryAddOptions{}, validationError("package name must not be empty")
+		}
+	}
+	return opts, nil
 }
 
-// parseAddArgs validates arguments and sets up directories
-func parseRegistryAddArgs(args []string) (*addPackageConfig, error) {
-	if len(args) != 2 && len(args) != 3 {
-		return nil, fmt.Errorf("requires two arguments (registry name, package giturl) or three arguments (registry name, package name, version)")
+// newAddPackageConfig validates the options and sets up directories
+func newAddPackageConfig(ctx context.Context, opts RegistryAddOptions) (*addPackageConfig, error) {
+	if opts.Registry == "" {
+		return nil, validationError("registry name must not be empty")
 	}
-	registryName := args[0]
-	if registryName == "" {
-		return nil, fmt.Errorf("registry name must not be empty")
+	subdir, err := cleanSubdir(opts.Package)
+	if err != nil {
+		return nil, err
 	}
 	cosmDir, err := getCosmDir()
 	if err != nil {
 		return nil, err
 	}
-	registriesDir := filepath.Join(cosmDir, "registries")
-	if len(args) == 2 {
-		packageGitURL := args[1]
-		if packageGitURL == "" {
-			return nil, fmt.Errorf("package giturl must not be empty")
-		}
-		return &addPackageConfig{
-			registryName:  registryName,
-			packageGitURL: packageGitURL,
-			cosmDir:       cosmDir,
-			registriesDir: registriesDir,
-		}, nil
-	}
-	packageName := args[1]
-	versionTag := args[2]
-	if packageName == "" {
-		return nil, fmt.Errorf("package name must not be empty")
-	}
-	if versionTag == "" || !strings.HasPrefix(versionTag, "v") {
-		return nil, fmt.Errorf("version must be non-empty and start with 'v'")
-	}
-	return &addPackageConfig{
-		registryName:  registryName,
-		packageName:   packageName,
-		versionTag:    versionTag,
+	config := &addPackageConfig{
+		registryName:  opts.Registry,
 		cosmDir:       cosmDir,
-		registriesDir: registriesDir,
-	}, nil
+		registriesDir: filepath.Join(cosmDir, "registries"),
+		subdir:        subdir,
+		shallow:       opts.Shallow,
+		force:         opts.Force,
+	}
+	if err := assertRegistryWritable(config.registriesDir, config.registryName); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.Path != "":
+		config.packageGitURL, err = localPathToGitURL(ctx, opts.Path)
+		if err != nil {
+			return nil, err
+		}
+	case opts.GitURL != "":
+		config.packageGitURL = opts.GitURL
+	case opts.Name != "":
+		if subdir != "" {
+			return nil, fmt.Errorf("--subdir can only be used when adding a package by its giturl or --path")
+		}
+		if opts.Version == "" || !strings.HasPrefix(opts.Version, "v") {
+			return nil, validationError("version must be non-empty and start with 'v'")
+		}
+		config.packageName = opts.Name
+		config.versionTag = opts.Version
+	default:
+		return nil, validationError("specify the giturl or path of a package, or the name and version of a registered package")
+	}
+	return config, nil
+}
+
+// localPathToGitURL verifies that a local directory is a Git repository and returns its file:// URL
+func localPathToGitURL(ctx context.Context, localPath string) (string, error) {
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path for %s: %w", localPath, err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", fmt.Errorf("package path %s does not exist: %w", absPath, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("package path %s is not a directory", absPath)
+	}
+	if _, err := GitCommand(ctx, absPath, "rev-parse", "--git-dir"); err != nil {
+		return "", fmt.Errorf("package path %s is not a Git repository: %w", absPath, err)
+	}
+	return "file://" + absPath, nil
 }
 
 // addPackageWithAllVersions adds a package with all available versions to the registry
-func addPackageWithAllVersions(config *addPackageConfig) error {
+func addPackageWithAllVersions(ctx context.Context, config *addPackageConfig) error {
+	if err := registerPackageWithAllVersions(ctx, config); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Added package %s", config.packageName)
+	if len(config.tags) > 0 {
+		commitMsg = fmt.Sprintf("Added package %s version %s", config.packageName, config.tags[0])
+	}
+	return commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg)
+}
+
+// registerPackageWithAllVersions writes a package with all available versions to the registry
+// clone, without committing it
+func registerPackageWithAllVersions(ctx context.Context, config *addPackageConfig) error {
 	// Clone package to temporary directory
-	clonePath, err := clonePackageToTempDir(config.cosmDir, config.packageGitURL)
+	clonePath, err := clonePackageToTempDir(ctx, config.cosmDir, config.packageGitURL, config.shallow)
 	if err != nil {
 		return err
 	}
@@ -108,12 +247,15 @@ func addPackageWithAllVersions(config *addPackageConfig) error {
 	defer cleanupTempClone(config.clonePath)
 
 	// Fetch tags to ensure latest tags are available
-	if _, err := GitCommand(config.clonePath, "fetch", "--tags"); err != nil {
-		return fmt.Errorf("failed to fetch tags for repository at '%s': %v", config.packageGitURL, err)
+	if err := fetchTags(ctx, config.clonePath); err != nil {
+		return fmt.Errorf("failed to fetch tags for repository at '%s': %w", config.packageGitURL, err)
 	}
 
-	// Validate Project.json to get package name and UUID
-	project, err := loadProjectFromDir(config.clonePath)
+	// Validate Project.json to get package name and UUID; the package may be in a submodule
+	if err := updateSubmodules(ctx, config.clonePath); err != nil {
+		return err
+	}
+	project, err := loadProjectFromDir(filepath.Join(config.clonePath, config.subdir))
 	if err != nil {
 		return err
 	}
@@ -126,7 +268,7 @@ func addPackageWithAllVersions(config *addPackageConfig) error {
 	if err := ensurePackageNotRegistered(config.registry, config.packageName, config.registryName, config.clonePath); err != nil {
 		return err
 	}
-	config.tags, err = validateAndCollectVersionTags(config.clonePath)
+	config.tags, err = validateAndCollectVersionTags(ctx, config.clonePath, releaseTagPrefix(config.packageName, config.subdir))
 	if err != nil {
 		return err
 	}
@@ -136,63 +278,67 @@ func addPackageWithAllVersions(config *addPackageConfig) error {
 	}
 	if len(config.tags) > 0 {
 		// Update versions for all tags
-		if err := updatePackageVersions(config.packageDir, config.packageName, config.packageUUID, config.packageGitURL, config.tags, config.registriesDir, config.clonePath); err != nil {
+		if err := updatePackageVersions(ctx, config.packageDir, config.packageName, config.packageUUID, config.packageGitURL, config.subdir, config.mirrors, config.tags, config.registriesDir, config.registryName, config.clonePath); err != nil {
 			return err
 		}
 	}
 
-	// Update registry.json and move clone
-	config.registry.Packages[config.packageName] = types.PackageInfo{
-		UUID:   config.packageUUID,
-		GitURL: config.packageGitURL,
-	}
-	if err := saveRegistryMetadata(config.registry, config.registryFile); err != nil {
-		return err
-	}
-	config.clonePath, err = moveCloneToPermanentDir(config.cosmDir, config.clonePath, config.packageUUID)
+	// Update registry.json and move clone; the publishing author becomes the first maintainer
+	author, err := publishingAuthor(ctx)
 	if err != nil {
 		return err
 	}
-	commitMsg := fmt.Sprintf("Added package %s", config.packageName)
-	if len(config.tags) > 0 {
-		commitMsg = fmt.Sprintf("Added package %s version %s", config.packageName, config.tags[0])
+	config.registry.Packages[config.packageName] = types.PackageInfo{
+		UUID:        config.packageUUID,
+		GitURL:      config.packageGitURL,
+		Subdir:      config.subdir,
+		Maintainers: []string{author},
 	}
-	if err := commitAndPushRegistryChanges(config.registriesDir, config.registryName, commitMsg); err != nil {
+	if err := saveRegistryMetadata(config.registry, config.registryFile); err != nil {
 		return err
 	}
-	fmt.Printf("Added package '%s' to registry '%s'\n", config.packageName, config.registryName)
-	return nil
+	config.clonePath, err = moveCloneToPermanentDir(config.cosmDir, config.clonePath, config.packageUUID)
+	return err
 }
 
 // addSpecificPackageVersion adds a specific version of an existing package to the registry
-func addSpecificPackageVersion(config *addPackageConfig) error {
+func addSpecificPackageVersion(ctx context.Context, config *addPackageConfig) error {
 	// Check if package exists in registry
 	pkgInfo, exists := config.registry.Packages[config.packageName]
 	if !exists {
-		return fmt.Errorf("package '%s' not found in registry '%s'", config.packageName, config.registryName)
+		return notFoundError("package '%s' not found in registry '%s'", config.packageName, config.registryName)
+	}
+	if err := ensureMaintainer(ctx, pkgInfo, config.packageName, config.registryName, config.force); err != nil {
+		return err
 	}
 	config.packageUUID = pkgInfo.UUID
 	config.packageGitURL = pkgInfo.GitURL
+	config.subdir = pkgInfo.Subdir
+	config.mirrors = pkgInfo.Mirrors
 
 	// Check if version is already registered
-	config.packageDir = filepath.Join(config.registriesDir, config.registryName, strings.ToUpper(string(config.packageName[0])), config.packageName)
+	packageDir, err := registryPackageDir(config.registriesDir, config.registryName, config.packageName)
+	if err != nil {
+		return err
+	}
+	config.packageDir = packageDir
 	versionsFile := filepath.Join(config.packageDir, "versions.json")
 	var existingVersions []string
 	if data, err := os.ReadFile(versionsFile); err == nil {
-		if err := json.Unmarshal(data, &existingVersions); err != nil {
-			return fmt.Errorf("failed to parse versions.json for package '%s': %v", config.packageName, err)
+		if err := unmarshalValidated("versions.schema.json", data, &existingVersions); err != nil {
+			return fmt.Errorf("failed to parse versions.json for package '%s': %w", config.packageName, err)
 		}
 		if contains(existingVersions, config.versionTag) {
-			return fmt.Errorf("version '%s' of package '%s' is already registered in registry '%s'", config.versionTag, config.packageName, config.registryName)
+			return conflictError("version '%s' of package '%s' is already registered in registry '%s'", config.versionTag, config.packageName, config.registryName)
 		}
 	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to read versions.json for package '%s': %v", config.packageName, err)
+		return fmt.Errorf("failed to read versions.json for package '%s': %w", config.packageName, err)
 	}
 
 	// Check if package is cloned
 	config.clonePath = filepath.Join(config.cosmDir, "clones", config.packageUUID)
 	if _, err := os.Stat(config.clonePath); os.IsNotExist(err) {
-		tmpClonePath, err := clonePackageToTempDir(config.cosmDir, config.packageGitURL)
+		tmpClonePath, err := clonePackageToTempDir(ctx, config.cosmDir, config.packageGitURL, config.shallow, config.mirrors...)
 		if err != nil {
 			return err
 		}
@@ -202,22 +348,18 @@ func addSpecificPackageVersion(config *addPackageConfig) error {
 			return err
 		}
 	} else if err != nil {
-		return fmt.Errorf("failed to check clone at %s: %v", config.clonePath, err)
+		return fmt.Errorf("failed to check clone at %s: %w", config.clonePath, err)
 	}
 
 	// Update versions for the specific tag
-	if err := updatePackageVersions(config.packageDir, config.packageName, config.packageUUID, config.packageGitURL, []string{config.versionTag}, config.registriesDir, config.clonePath); err != nil {
+	config.tags = []string{config.versionTag}
+	if err := updatePackageVersions(ctx, config.packageDir, config.packageName, config.packageUUID, config.packageGitURL, config.subdir, config.mirrors, config.tags, config.registriesDir, config.registryName, config.clonePath); err != nil {
 		return err
 	}
 
 	// Commit and push registry changes
 	commitMsg := fmt.Sprintf("Added version %s of package %s", config.versionTag, config.packageName)
-	if err := commitAndPushRegistryChanges(config.registriesDir, config.registryName, commitMsg); err != nil {
-		return err
-	}
-
-	fmt.Printf("Added version '%s' of package '%s' to registry '%s'\n", config.versionTag, config.packageName, config.registryName)
-	return nil
+	return commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg)
 }
 
 // ensurePackageNotRegistered checks if the package is already in the registry
@@ -225,9 +367,9 @@ func ensurePackageNotRegistered(registry types.Registry, packageName, registryNa
 	if _, exists := registry.Packages[packageName]; exists {
 		cleanupErr := cleanupTempClone(tmpClonePath)
 		if cleanupErr != nil {
-			return fmt.Errorf("package '%s' is already registered in registry '%s'; cleanup failed: %v", packageName, registryName, cleanupErr)
+			return conflictError("package '%s' is already registered in registry '%s'; cleanup failed: %v", packageName, registryName, cleanupErr)
 		}
-		return fmt.Errorf("package '%s' is already registered in registry '%s'", packageName, registryName)
+		return conflictError("package '%s' is already registered in registry '%s'", packageName, registryName)
 	}
 	return nil
 }
@@ -240,21 +382,22 @@ func moveCloneToPermanentDir(cosmDir, tmpClonePath, packageUUID string) (string,
 	// If the permanent clone directory already exists, remove it
 	if _, err := os.Stat(packageClonePath); !os.IsNotExist(err) {
 		if err := os.RemoveAll(packageClonePath); err != nil {
-			return "", fmt.Errorf("failed to remove existing clone at %s: %v", packageClonePath, err)
+			return "", fmt.Errorf("failed to remove existing clone at %s: %w", packageClonePath, err)
 		}
-		fmt.Fprintf(os.Stderr, "Warning: Replaced existing clone for UUID '%s' at %s\n", packageUUID, packageClonePath)
+		logging.Warnf("Replaced existing clone for UUID '%s' at %s", packageUUID, packageClonePath)
 	}
 
 	// Move the temporary clone to the permanent location
 	if err := os.Rename(tmpClonePath, packageClonePath); err != nil {
-		return "", fmt.Errorf("failed to move package to %s: %v", packageClonePath, err)
+		return "", fmt.Errorf("failed to move package to %s: %w", packageClonePath, err)
 	}
 	return packageClonePath, nil
 }
 
-// validateAndCollectVersionTags fetches Git tags, or returns empty slice if none exist
-func validateAndCollectVersionTags(clonePath string) ([]string, error) {
-	tagOutput, err := GitCommand(clonePath, "tag")
+// validateAndCollectVersionTags fetches Git tags starting with tagPrefix and returns the versions
+// they carry (with the prefix stripped), or returns empty slice if none exist
+func validateAndCollectVersionTags(ctx context.Context, clonePath, tagPrefix string) ([]string, error) {
+	tagOutput, err := GitCommand(ctx, clonePath, "tag")
 	if err != nil || len(strings.TrimSpace(tagOutput)) == 0 {
 		return []string{}, nil // No tags, return empty slice
 	}
@@ -262,73 +405,120 @@ func validateAndCollectVersionTags(clonePath string) ([]string, error) {
 	tags := strings.Split(strings.TrimSpace(tagOutput), "\n")
 	var validTags []string
 	for _, tag := range tags {
-		if strings.HasPrefix(tag, "v") && len(strings.Split(tag, ".")) >= 2 {
-			validTags = append(validTags, tag)
+		if !strings.HasPrefix(tag, tagPrefix) {
+			continue
+		}
+		version := strings.TrimPrefix(tag, tagPrefix)
+		if strings.HasPrefix(version, "v") && len(strings.Split(version, ".")) >= 2 {
+			validTags = append(validTags, version)
 		}
 	}
 	return validTags, nil
 }
 
+// cleanSubdir normalizes the subdirectory of a package (--package) to a path relative to the repository root
+func cleanSubdir(subdir string) (string, error) {
+	if subdir == "" {
+		return "", nil
+	}
+	subdir = filepath.ToSlash(filepath.Clean(subdir))
+	if subdir == "." {
+		return "", nil
+	}
+	if filepath.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+		return "", fmt.Errorf("package subdirectory '%s' must be relative to the repository root", subdir)
+	}
+	return subdir, nil
+}
+
+// releaseTagPrefix returns the prefix of release tags for a package; packages in a
+// monorepo subdirectory are tagged as <name>/v<version>
+func releaseTagPrefix(packageName, subdir string) string {
+	if subdir == "" {
+		return ""
+	}
+	return packageName + "/"
+}
+
 // setupPackageDir creates the package directory structure
 func setupPackageDir(registriesDir, registryName, packageName string) (string, error) {
-	packageFirstLetter := strings.ToUpper(string(packageName[0]))
-	packageDir := filepath.Join(registriesDir, registryName, packageFirstLetter, packageName)
+	packageDir, err := registryPackageDir(registriesDir, registryName, packageName)
+	if err != nil {
+		return "", err
+	}
 	if err := os.MkdirAll(packageDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create package directory %s: %v", packageDir, err)
+		return "", fmt.Errorf("failed to create package directory %s: %w", packageDir, err)
 	}
 	return packageDir, nil
 }
 
 // updatePackageVersions updates versions.json with the specified tags
-func updatePackageVersions(packageDir, packageName, packageUUID, packageGitURL string, tags []string, registriesDir, clonePath string) error {
+func updatePackageVersions(ctx context.Context, packageDir, packageName, packageUUID, packageGitURL, subdir string, mirrors, tags []string, registriesDir, registryName, clonePath string) error {
 	versionsFile := filepath.Join(packageDir, "versions.json")
 	var versions []string
 	if data, err := os.ReadFile(versionsFile); err == nil {
-		if err := json.Unmarshal(data, &versions); err != nil {
-			return fmt.Errorf("failed to parse versions.json for package '%s': %v", packageName, err)
+		if err := unmarshalValidated("versions.schema.json", data, &versions); err != nil {
+			return fmt.Errorf("failed to parse versions.json for package '%s': %w", packageName, err)
 		}
 	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to read versions.json for package '%s': %v", packageName, err)
+		return fmt.Errorf("failed to read versions.json for package '%s': %w", packageName, err)
 	}
 
 	// Process each tag
 	for _, tag := range tags {
 		if !contains(versions, tag) {
+			gitTag := releaseTagPrefix(packageName, subdir) + tag
+
 			// Fetch latest changes from remote to ensure tag commits are available
-			if err := fetchOrigin(clonePath); err != nil {
-				return fmt.Errorf("failed to fetch remote changes for package '%s': %v", packageName, err)
+			if err := fetchWithMirrors(ctx, clonePath, mirrors); err != nil {
+				return fmt.Errorf("failed to fetch remote changes for package '%s': %w", packageName, err)
 			}
 
 			// Checkout the specific version tag
-			if err := checkoutVersion(clonePath, tag); err != nil {
-				return fmt.Errorf("failed to checkout tag '%s' for package '%s': %v", tag, packageName, err)
+			if err := checkoutVersion(ctx, clonePath, gitTag, mirrors...); err != nil {
+				return fmt.Errorf("failed to checkout tag '%s' for package '%s': %w", tag, packageName, err)
+			}
+			if err := updateSubmodules(ctx, clonePath); err != nil {
+				return fmt.Errorf("failed to check out the submodules of tag '%s' for package '%s': %w", tag, packageName, err)
 			}
 
 			// Load Project.json for this tag
-			project, err := loadProjectFromDir(clonePath)
+			project, err := loadProjectFromDir(filepath.Join(clonePath, subdir))
 			if err != nil {
-				return fmt.Errorf("failed to load Project.json for tag '%s': %v", tag, err)
+				return fmt.Errorf("failed to load Project.json for tag '%s': %w", tag, err)
 			}
 
 			// Validate project file
 			if err := validateProject(project); err != nil {
-				return fmt.Errorf("invalid Project.json for tag '%s': %v", tag, err)
+				return fmt.Errorf("invalid Project.json for tag '%s': %w", tag, err)
 			}
 
 			// Revert clone to previous state
-			if err := revertClone(clonePath); err != nil {
-				return fmt.Errorf("failed to revert clone for tag '%s': %v", tag, err)
+			if err := revertClone(ctx, clonePath); err != nil {
+				return fmt.Errorf("failed to revert clone for tag '%s': %w", tag, err)
 			}
 
 			// Get SHA1 for the tag
-			sha1Output, err := GitCommand(clonePath, "rev-list", "-n", "1", tag)
+			sha1Output, err := GitCommand(ctx, clonePath, "rev-list", "-n", "1", gitTag)
 			if err != nil {
-				return fmt.Errorf("failed to get SHA1 for tag '%s': %v", tag, err)
+				return fmt.Errorf("failed to get SHA1 for tag '%s': %w", tag, err)
 			}
 			sha1 := strings.TrimSpace(sha1Output)
 
 			// Add the version using the project data for this tag
-			if err := addPackageVersion(packageDir, packageName, packageUUID, packageGitURL, sha1, tag, project, registriesDir); err != nil {
+			if err := addPackageVersion(packageDir, packageName, packageUUID, packageGitURL, subdir, mirrors, sha1, tag, project, registriesDir, registryName); err != nil {
+				return err
+			}
+			if err := recordChangelog(ctx, clonePath, sha1, subdir, filepath.Join(packageDir, tag), tag); err != nil {
+				return err
+			}
+			if err := recordReleaseNotes(ctx, clonePath, gitTag, filepath.Join(packageDir, tag)); err != nil {
+				return err
+			}
+			if err := recordTagSigner(ctx, clonePath, gitTag, filepath.Join(packageDir, tag)); err != nil {
+				return err
+			}
+			if err := recordPackageDigest(ctx, clonePath, sha1, subdir, filepath.Join(packageDir, tag)); err != nil {
 				return err
 			}
 
@@ -339,50 +529,70 @@ func updatePackageVersions(packageDir, packageName, packageUUID, packageGitURL s
 	// Write updated versions.json
 	data, err := json.MarshalIndent(versions, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal versions.json for package '%s': %v", packageName, err)
+		return fmt.Errorf("failed to marshal versions.json for package '%s': %w", packageName, err)
 	}
-	if err := os.WriteFile(versionsFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write versions.json for package '%s': %v", packageName, err)
+	if err := writeMetadataFile(versionsFile, data); err != nil {
+		return fmt.Errorf("failed to write versions.json for package '%s': %w", packageName, err)
 	}
 
 	return nil
 }
 
 // addPackageVersion adds a single version to the registry package directory
-func addPackageVersion(packageDir, packageName, packageUUID, packageGitURL, sha1, versionTag string, project *types.Project, registriesDir string) error {
+func addPackageVersion(packageDir, packageName, packageUUID, packageGitURL, subdir string, mirrors []string, sha1, versionTag string, project *types.Project, registriesDir, registryName string) error {
+	// Do not build on top of transitive metadata that disagrees with the registries
+	if err := validateFeatures(project); err != nil {
+		return fmt.Errorf("invalid features in version '%s': %w", versionTag, err)
+	}
+	deps := publishedDeps(project)
+	if err := verifyDependencyBuildLists(deps, registriesDir); err != nil {
+		return fmt.Errorf("failed to verify dependencies of version '%s': %w", versionTag, err)
+	}
 	versionDir := filepath.Join(packageDir, versionTag)
 	if err := os.MkdirAll(versionDir, 0755); err != nil {
-		return fmt.Errorf("failed to create version directory %s: %v", versionDir, err)
+		return fmt.Errorf("failed to create version directory %s: %w", versionDir, err)
 	}
 
 	specs := types.Specs{
-		Name:    packageName,
-		UUID:    packageUUID,
-		Version: versionTag,
-		GitURL:  packageGitURL,
-		SHA1:    sha1,
-		Deps:    project.Deps,
+		Name:        packageName,
+		UUID:        packageUUID,
+		Version:     versionTag,
+		GitURL:      packageGitURL,
+		SHA1:        sha1,
+		Subdir:      subdir,
+		Mirrors:     mirrors,
+		Deps:        deps,
+		Description: project.Description,
+		Keywords:    project.Keywords,
+		License:     project.License,
+		Homepage:    project.Homepage,
+		Features:    project.Features,
 	}
 	data, err := json.MarshalIndent(specs, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal specs.json for version '%s': %v", versionTag, err)
+		return fmt.Errorf("failed to marshal specs.json for version '%s': %w", versionTag, err)
 	}
 	specsFile := filepath.Join(versionDir, "specs.json")
-	if err := os.WriteFile(specsFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write specs.json for version '%s': %v", versionTag, err)
+	if err := writeMetadataFile(specsFile, data); err != nil {
+		return fmt.Errorf("failed to write specs.json for version '%s': %w", versionTag, err)
 	}
 
-	buildList, err := generateBuildList(project, registriesDir)
+	buildList, err := generateBuildList(&types.Project{Name: project.Name, Deps: deps}, "", "", registriesDir)
 	if err != nil {
-		return fmt.Errorf("failed to generate build list for version '%s': %v", versionTag, err)
+		return fmt.Errorf("failed to generate build list for version '%s': %w", versionTag, err)
 	}
 	data, err = json.MarshalIndent(buildList, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal buildlist.json for version '%s': %v", versionTag, err)
+		return fmt.Errorf("failed to marshal buildlist.json for version '%s': %w", versionTag, err)
 	}
 	buildListFile := filepath.Join(versionDir, "buildlist.json")
-	if err := os.WriteFile(buildListFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write buildlist.json for version '%s': %v", versionTag, err)
+	if err := writeMetadataFile(buildListFile, data); err != nil {
+		return fmt.Errorf("failed to write buildlist.json for version '%s': %w", versionTag, err)
+	}
+
+	// The package directory is <registries>/<registry>/<letter>/<package>
+	if err := recordDependents(registriesDir, registryName, specs); err != nil {
+		return fmt.Errorf("failed to record version '%s' as a dependent: %w", versionTag, err)
 	}
 	return nil
 }
@@ -390,8 +600,8 @@ func addPackageVersion(packageDir, packageName, packageUUID, packageGitURL, sha1
 // cleanupTempClone removes the temporary clone directory
 func cleanupTempClone(tmpClonePath string) error {
 	if tmpClonePath != "" {
-		if err := os.RemoveAll(tmpClonePath); err != nil {
-			return fmt.Errorf("failed to clean up temporary clone directory %s: %v", tmpClonePath, err)
+		if err := removeTempDir(tmpClonePath); err != nil {
+			return err
 		}
 	}
 	return nil
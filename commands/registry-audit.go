@@ -0,0 +1,435 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// auditRegistryConfig holds configuration for auditing a registry
+type auditRegistryConfig struct {
+	registryName  string
+	registriesDir string
+	registryDir   string
+	fix           bool
+	registry      types.Registry
+	registryFile  string
+	knownUUIDs    map[string]bool // UUIDs of packages in all registries
+}
+
+// auditProblem is an inconsistency found in a registry, with an optional repair
+type auditProblem struct {
+	description string
+	fix         func() error // nil if the problem cannot be repaired automatically
+}
+
+// RegistryAudit validates the registry tree and optionally repairs the problems it finds
+func RegistryAudit(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	config, err := parseRegistryAuditArgs(cmd, args)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRegistry(ctx, config.registryName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := updateSingleRegistry(ctx, config.registriesDir, config.registryName); err != nil {
+		return fmt.Errorf("failed to update registry '%s': %w", config.registryName, err)
+	}
+	config.registry, config.registryFile, err = LoadRegistryMetadata(config.registriesDir, config.registryName)
+	if err != nil {
+		return fmt.Errorf("failed to load registry metadata for '%s': %w", config.registryName, err)
+	}
+	if config.knownUUIDs, err = collectKnownUUIDs(config.registriesDir); err != nil {
+		return err
+	}
+
+	problems, err := auditRegistry(config)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		logging.Infof("Audit of registry '%s' found no problems", config.registryName)
+		return nil
+	}
+	fmt.Printf("Audit of registry '%s' found %d problem(s):\n", config.registryName, len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem.description)
+	}
+	if !config.fix {
+		return fmt.Errorf("registry '%s' has %d problem(s); run 'cosm registry audit %s --fix' to repair them", config.registryName, len(problems), config.registryName)
+	}
+	return repairRegistry(ctx, config, problems)
+}
+
+// parseRegistryAuditArgs parses the registry name and the --fix flag
+func parseRegistryAuditArgs(cmd *cobra.Command, args []string) (*auditRegistryConfig, error) {
+	if len(args) != 1 {
+		return nil, validationError("exactly one argument required (e.g., cosm registry audit <registry name>)")
+	}
+	registryName := args[0]
+	if registryName == "" {
+		return nil, validationError("registry name cannot be empty")
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	if err := assertRegistryExists(registriesDir, registryName); err != nil {
+		return nil, err
+	}
+	fix, err := cmd.Flags().GetBool("fix")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fix flag: %w", err)
+	}
+	return &auditRegistryConfig{
+		registryName:  registryName,
+		registriesDir: registriesDir,
+		registryDir:   filepath.Join(registriesDir, registryName),
+		fix:           fix,
+	}, nil
+}
+
+// auditRegistry checks the registered packages and looks for directories that are not registered
+func auditRegistry(config *auditRegistryConfig) ([]auditProblem, error) {
+	var problems []auditProblem
+
+	packageNames := make([]string, 0, len(config.registry.Packages))
+	for name := range config.registry.Packages {
+		packageNames = append(packageNames, name)
+	}
+	sort.Strings(packageNames)
+	for _, packageName := range packageNames {
+		pkgProblems, err := auditPackage(config, packageName, config.registry.Packages[packageName])
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, pkgProblems...)
+	}
+
+	problems = append(problems, auditDependents(config, packageNames)...)
+
+	orphans, err := findOrphanedPackageDirs(config)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, orphans...), nil
+}
+
+// auditDependents reports packages whose dependents.json differs from the dependents computed from
+// the specs of all versions, e.g. because a dependent was registered before its dependency
+func auditDependents(config *auditRegistryConfig, packageNames []string) []auditProblem {
+	var problems []auditProblem
+	collected := collectDependents(config.registriesDir, config.registryName, config.registry)
+	for _, packageName := range packageNames {
+		expected := collected[packageName]
+		if expected == nil {
+			expected = []types.Dependent{}
+		}
+		sortDependents(expected)
+		stored, err := loadDependents(config.registriesDir, config.registryName, packageName)
+		if err == nil {
+			sortDependents(stored)
+			if reflect.DeepEqual(stored, expected) {
+				continue
+			}
+		}
+		packageDir := filepath.Join(config.registryDir, registryPackagePath(packageName))
+		if _, err := os.Stat(packageDir); err != nil {
+			continue // Reported by auditPackage
+		}
+		problems = append(problems, auditProblem{
+			description: fmt.Sprintf("package '%s' has an outdated dependents.json", packageName),
+			fix:         func() error { return saveDependents(expected, packageDir) },
+		})
+	}
+	return problems
+}
+
+// auditPackage checks that a registered package has a directory, a valid versions.json,
+// and consistent specs.json and buildlist.json files for every listed version
+func auditPackage(config *auditRegistryConfig, packageName string, pkgInfo types.PackageInfo) ([]auditProblem, error) {
+	packageDir, err := registryPackageDir(config.registriesDir, config.registryName, packageName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(packageDir); os.IsNotExist(err) {
+		return []auditProblem{{
+			description: fmt.Sprintf("package '%s' is listed in registry.json but has no directory", packageName),
+			fix:         func() error { return unregisterPackage(config, packageName) },
+		}}, nil
+	}
+
+	versionsFile := filepath.Join(packageDir, "versions.json")
+	versions, err := loadVersions(config.registriesDir, config.registryName, packageName)
+	if err != nil || versions == nil {
+		return []auditProblem{{
+			description: fmt.Sprintf("package '%s' has a missing or invalid versions.json", packageName),
+			fix:         func() error { return rebuildVersions(config, packageName, pkgInfo, packageDir) },
+		}}, nil
+	}
+
+	var problems []auditProblem
+	for _, version := range versions {
+		if reason := checkRegistryVersion(config, packageName, pkgInfo, version); reason != "" {
+			problems = append(problems, auditProblem{
+				description: fmt.Sprintf("version '%s' of package '%s' %s", version, packageName, reason),
+				fix:         func() error { return dropRegistryVersion(config, packageName, version) },
+			})
+			continue
+		}
+		if problem := auditGitURL(config, packageName, pkgInfo, packageDir, version); problem != nil {
+			problems = append(problems, *problem)
+		}
+		problems = append(problems, auditDependencies(config, packageName, version)...)
+		if problem := auditBuildList(config, packageName, packageDir, version); problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+
+	// Version directories that are not listed in versions.json
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package directory %s: %w", packageDir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !contains(versions, entry.Name()) {
+			versionDir := filepath.Join(packageDir, entry.Name())
+			problems = append(problems, auditProblem{
+				description: fmt.Sprintf("directory '%s' of package '%s' is not listed in %s", entry.Name(), packageName, filepath.Base(versionsFile)),
+				fix:         func() error { return os.RemoveAll(versionDir) },
+			})
+		}
+	}
+	return problems, nil
+}
+
+// checkRegistryVersion returns why a listed version is inconsistent, or "" if it is valid
+func checkRegistryVersion(config *auditRegistryConfig, packageName string, pkgInfo types.PackageInfo, version string) string {
+	specs, err := loadSpecs(config.registriesDir, config.registryName, packageName, version)
+	if err != nil {
+		return "has a missing or invalid specs.json"
+	}
+	if specs.Name != packageName || specs.Version != version {
+		return fmt.Sprintf("has specs.json for '%s@%s'", specs.Name, specs.Version)
+	}
+	if specs.UUID != pkgInfo.UUID {
+		return fmt.Sprintf("has UUID '%s' in specs.json, but the package is registered with UUID '%s'", specs.UUID, pkgInfo.UUID)
+	}
+	buildListFile := filepath.Join(config.registryDir, registryPackagePath(packageName), version, "buildlist.json")
+	if _, err := os.Stat(buildListFile); err != nil {
+		return "has no buildlist.json"
+	}
+	if _, err := loadBuildListFile(buildListFile); err != nil {
+		return "has an invalid buildlist.json"
+	}
+	return ""
+}
+
+// auditGitURL reports a version whose specs.json records another Git URL than the one under
+// which the package is registered; the fix records the registered URL
+func auditGitURL(config *auditRegistryConfig, packageName string, pkgInfo types.PackageInfo, packageDir, version string) *auditProblem {
+	specs, err := loadSpecs(config.registriesDir, config.registryName, packageName, version)
+	if err != nil || specs.GitURL == pkgInfo.GitURL || pkgInfo.GitURL == "" {
+		return nil
+	}
+	return &auditProblem{
+		description: fmt.Sprintf("version '%s' of package '%s' has Git URL '%s' in specs.json, but the package is registered with Git URL '%s'", version, packageName, specs.GitURL, pkgInfo.GitURL),
+		fix: func() error {
+			specs.GitURL = pkgInfo.GitURL
+			return saveSpecs(specs, filepath.Join(packageDir, version, "specs.json"))
+		},
+	}
+}
+
+// auditBuildList reports a version whose buildlist.json differs from the build list resolved from
+// its specs, such as the build lists published before unreachable dependencies were pruned; the fix
+// writes the resolved build list. Versions whose build list cannot be resolved are left to
+// auditDependencies.
+func auditBuildList(config *auditRegistryConfig, packageName, packageDir, version string) *auditProblem {
+	specs, err := loadSpecs(config.registriesDir, config.registryName, packageName, version)
+	if err != nil {
+		return nil // Reported by checkRegistryVersion
+	}
+	published, err := loadBuildList(config.registriesDir, config.registryName, packageName, version)
+	if err != nil {
+		return nil
+	}
+	resolved, err := generateBuildList(&types.Project{Name: packageName, Deps: specs.Deps}, "", "", config.registriesDir)
+	if err != nil {
+		return nil
+	}
+	diff := diffBuildLists(resolved, published)
+	if diff == "" {
+		return nil
+	}
+	return &auditProblem{
+		description: fmt.Sprintf("version '%s' of package '%s' has a buildlist.json that does not match its specs: %s", version, packageName, diff),
+		fix: func() error {
+			data, err := json.MarshalIndent(resolved, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal buildlist.json for version '%s': %w", version, err)
+			}
+			return writeMetadataFile(filepath.Join(packageDir, version, "buildlist.json"), data)
+		},
+	}
+}
+
+// auditDependencies reports dependencies in the build list of a version whose UUID is not
+// registered in any registry. These cannot be repaired automatically.
+func auditDependencies(config *auditRegistryConfig, packageName, version string) []auditProblem {
+	buildList, err := loadBuildList(config.registriesDir, config.registryName, packageName, version)
+	if err != nil {
+		return nil // Reported by checkRegistryVersion
+	}
+	var problems []auditProblem
+	keys := make([]string, 0, len(buildList.Dependencies))
+	for key := range buildList.Dependencies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		dep := buildList.Dependencies[key]
+		if !config.knownUUIDs[dep.UUID] {
+			problems = append(problems, auditProblem{
+				description: fmt.Sprintf("version '%s' of package '%s' depends on '%s@%s' with UUID '%s', which is not registered in any registry", version, packageName, dep.Name, dep.Version, dep.UUID),
+			})
+		}
+	}
+	return problems
+}
+
+// collectKnownUUIDs gathers the UUIDs of all packages in all registries
+func collectKnownUUIDs(registriesDir string) (map[string]bool, error) {
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return nil, err
+	}
+	uuids := make(map[string]bool)
+	for _, registryName := range registryNames {
+		registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkgInfo := range registry.Packages {
+			uuids[pkgInfo.UUID] = true
+		}
+	}
+	return uuids, nil
+}
+
+// findOrphanedPackageDirs reports package directories that are not listed in registry.json
+func findOrphanedPackageDirs(config *auditRegistryConfig) ([]auditProblem, error) {
+	var problems []auditProblem
+	letters, err := os.ReadDir(config.registryDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry directory %s: %w", config.registryDir, err)
+	}
+	for _, letter := range letters {
+		if !letter.IsDir() || strings.HasPrefix(letter.Name(), ".") || letter.Name() == advisoriesDir {
+			continue
+		}
+		letterDir := filepath.Join(config.registryDir, letter.Name())
+		entries, err := os.ReadDir(letterDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read registry directory %s: %w", letterDir, err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if _, registered := config.registry.Packages[name]; registered && strings.ToUpper(string(name[0])) == letter.Name() {
+				continue
+			}
+			orphanDir := filepath.Join(letterDir, name)
+			problems = append(problems, auditProblem{
+				description: fmt.Sprintf("directory '%s/%s' does not belong to a registered package", letter.Name(), name),
+				fix:         func() error { return os.RemoveAll(orphanDir) },
+			})
+		}
+	}
+	return problems, nil
+}
+
+// unregisterPackage removes a package from registry.json
+func unregisterPackage(config *auditRegistryConfig, packageName string) error {
+	delete(config.registry.Packages, packageName)
+	return saveRegistryMetadata(config.registry, config.registryFile)
+}
+
+// rebuildVersions recreates versions.json from the version directories with valid metadata
+func rebuildVersions(config *auditRegistryConfig, packageName string, pkgInfo types.PackageInfo, packageDir string) error {
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		return fmt.Errorf("failed to read package directory %s: %w", packageDir, err)
+	}
+	versions := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && checkRegistryVersion(config, packageName, pkgInfo, entry.Name()) == "" {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sortVersions(versions)
+	return savePackageVersions(versions, filepath.Join(packageDir, "versions.json"))
+}
+
+// sortVersions sorts versions in ascending semantic version order
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		v1, err1 := ParseSemVer(versions[i])
+		v2, err2 := ParseSemVer(versions[j])
+		if err1 != nil || err2 != nil {
+			return versions[i] < versions[j]
+		}
+		return compareSemVer(v1, v2) < 0
+	})
+}
+
+// dropRegistryVersion removes a version from versions.json and deletes its directory
+func dropRegistryVersion(config *auditRegistryConfig, packageName, version string) error {
+	versions, err := loadVersions(config.registriesDir, config.registryName, packageName)
+	if err != nil {
+		return err
+	}
+	packageDir := filepath.Join(config.registryDir, registryPackagePath(packageName))
+	if err := savePackageVersions(removeString(versions, version), filepath.Join(packageDir, "versions.json")); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(packageDir, version))
+}
+
+// repairRegistry applies all available fixes and commits and pushes the repaired registry
+func repairRegistry(ctx context.Context, config *auditRegistryConfig, problems []auditProblem) error {
+	fixed, unfixable := 0, 0
+	for _, problem := range problems {
+		if problem.fix == nil {
+			unfixable++
+			continue
+		}
+		if err := problem.fix(); err != nil {
+			return fmt.Errorf("failed to repair registry '%s': %s: %w", config.registryName, problem.description, err)
+		}
+		fixed++
+	}
+	if fixed > 0 {
+		commitMsg := fmt.Sprintf("Repaired %d problem(s) found by audit", fixed)
+		if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+			return fmt.Errorf("failed to commit repairs to registry '%s': %w", config.registryName, err)
+		}
+	}
+	logging.Infof("Repaired %d problem(s) in registry '%s'", fixed, config.registryName)
+	if unfixable > 0 {
+		return fmt.Errorf("%d problem(s) in registry '%s' could not be repaired automatically", unfixable, config.registryName)
+	}
+	return nil
+}
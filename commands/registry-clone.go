@@ -1,7 +1,8 @@
 package commands
 
 import (
-	"encoding/json"
+	"context"
+	"cosm/logging"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,33 +13,47 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// RegistryClone clones a registry from a Git URL to the registries directory
+// RegistryClone clones a registry from a Git URL to the registries directory. With --sparse, only
+// registry.json and the other files in the root of the registry are checked out; packages are
+// checked out when they are first used. With --read-only, the registry is marked as read-only.
 func RegistryClone(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	// Validate and parse arguments
 	if len(args) != 1 {
-		return fmt.Errorf("exactly one argument required (e.g., cosm registry clone <giturl>)")
+		return validationError("exactly one argument required (e.g., cosm registry clone <giturl>)")
 	}
 	gitURL := args[0]
 	if gitURL == "" {
-		return fmt.Errorf("git URL cannot be empty")
+		return validationError("git URL cannot be empty")
 	}
+	sparse, _ := cmd.Flags().GetBool("sparse")
+	readOnly, _ := cmd.Flags().GetBool("read-only")
 
 	// Initialize paths
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return fmt.Errorf("failed to get cosm directory: %v", err)
+		return fmt.Errorf("failed to get cosm directory: %w", err)
 	}
 	registriesDir := filepath.Join(cosmDir, "registries")
 	if err := os.MkdirAll(registriesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create registries directory %s: %v", registriesDir, err)
+		return fmt.Errorf("failed to create registries directory %s: %w", registriesDir, err)
 	}
 
+	unlock, err := lockDepot(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Step 1: Clone to temporary folder
-	tmpDir := filepath.Join(registriesDir, "tmp-registry-clone")
-	if err := cloneToTempRegistryDir(gitURL, registriesDir, tmpDir); err != nil {
+	tmpDir, err := makeTempDir(registriesDir, "registry-clone")
+	if err != nil {
+		return err
+	}
+	defer removeTempDir(tmpDir) // Ensure cleanup
+	if err := cloneToTempRegistryDir(ctx, gitURL, registriesDir, tmpDir, sparse); err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmpDir) // Ensure cleanup
 
 	// Step 2: Extract registry name
 	registryName, err := extractRegistryName(tmpDir)
@@ -61,19 +76,33 @@ func RegistryClone(cmd *cobra.Command, args []string) error {
 	if err := addRegistryNameToJSON(registriesDir, registryName); err != nil {
 		return err
 	}
+	if readOnly {
+		protected, err := loadProtectedRegistries(registriesDir)
+		if err != nil {
+			return err
+		}
+		if err := saveProtectedRegistries(registriesDir, append(protected, registryName)); err != nil {
+			return err
+		}
+	}
 
 	// Step 6: Cleanup handled by defer
-	fmt.Printf("Cloned registry '%s' from %s\n", registryName, gitURL)
+	if sparse {
+		logging.Infof("Cloned registry '%s' from %s (sparse)", registryName, gitURL)
+		return nil
+	}
+	logging.Infof("Cloned registry '%s' from %s", registryName, gitURL)
 	return nil
 }
 
 // cloneToTempRegistryDir clones the repository to a temporary directory
-func cloneToTempRegistryDir(gitURL, registriesDir, tmpDir string) error {
-	if err := os.RemoveAll(tmpDir); err != nil {
-		return fmt.Errorf("failed to remove existing temporary directory %s: %v", tmpDir, err)
+func cloneToTempRegistryDir(ctx context.Context, gitURL, registriesDir, tmpDir string, sparse bool) error {
+	var options []string
+	if sparse {
+		options = sparseCloneOptions
 	}
-	if _, err := clone(gitURL, registriesDir, "tmp-registry-clone"); err != nil {
-		return fmt.Errorf("failed to clone repository from '%s' to %s: %v", gitURL, tmpDir, err)
+	if _, err := clone(ctx, gitURL, registriesDir, filepath.Base(tmpDir), options...); err != nil {
+		return fmt.Errorf("failed to clone repository from '%s' to %s: %w", gitURL, tmpDir, err)
 	}
 	return nil
 }
@@ -83,11 +112,11 @@ func extractRegistryName(tmpDir string) (string, error) {
 	registryMetaFile := filepath.Join(tmpDir, "registry.json")
 	data, err := os.ReadFile(registryMetaFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to read %s from cloned repository: %v", registryMetaFile, err)
+		return "", fmt.Errorf("failed to read %s from cloned repository: %w", registryMetaFile, err)
 	}
 	var registry types.Registry
-	if err := json.Unmarshal(data, &registry); err != nil {
-		return "", fmt.Errorf("failed to parse %s: %v", registryMetaFile, err)
+	if err := unmarshalValidated("registry.schema.json", data, &registry); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", registryMetaFile, err)
 	}
 	if registry.Name == "" {
 		return "", fmt.Errorf("%s does not contain a valid registry name", registryMetaFile)
@@ -100,13 +129,13 @@ func checkRegistryNameDoesNotExist(registriesDir, registryName string) error {
 	registryNames, err := loadRegistryNames(registriesDir)
 	if err != nil {
 		if !os.IsNotExist(err) && !strings.Contains(err.Error(), "no registries available") {
-			return fmt.Errorf("failed to load registry names: %v", err)
+			return fmt.Errorf("failed to load registry names: %w", err)
 		}
 		registryNames = []string{}
 	}
 	for _, name := range registryNames {
 		if name == registryName {
-			return fmt.Errorf("registry '%s' already exists in registries.json", registryName)
+			return conflictError("registry '%s' already exists in registries.json", registryName)
 		}
 	}
 	return nil
@@ -115,10 +144,10 @@ func checkRegistryNameDoesNotExist(registriesDir, registryName string) error {
 // moveTempToFinalRegistryDir moves the temporary directory to the final registry location
 func moveTempToFinalRegistryDir(tmpDir, finalDir string) error {
 	if err := os.MkdirAll(filepath.Dir(finalDir), 0755); err != nil {
-		return fmt.Errorf("failed to create parent directory for %s: %v", finalDir, err)
+		return fmt.Errorf("failed to create parent directory for %s: %w", finalDir, err)
 	}
 	if err := os.Rename(tmpDir, finalDir); err != nil {
-		return fmt.Errorf("failed to move %s to %s: %v", tmpDir, finalDir, err)
+		return fmt.Errorf("failed to move %s to %s: %w", tmpDir, finalDir, err)
 	}
 	return nil
 }
@@ -128,13 +157,13 @@ func addRegistryNameToJSON(registriesDir, registryName string) error {
 	registryNames, err := loadRegistryNames(registriesDir)
 	if err != nil {
 		if !os.IsNotExist(err) && !strings.Contains(err.Error(), "no registries available") {
-			return fmt.Errorf("failed to load registry names: %v", err)
+			return fmt.Errorf("failed to load registry names: %w", err)
 		}
 		registryNames = []string{}
 	}
 	registryNames = append(registryNames, registryName)
 	if err := saveRegistryNames(registryNames, registriesDir); err != nil {
-		return fmt.Errorf("failed to update registries.json: %v", err)
+		return fmt.Errorf("failed to update registries.json: %w", err)
 	}
 	return nil
 }
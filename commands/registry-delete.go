@@ -1,7 +1,7 @@
 package commands
 
 import (
-	"bufio"
+	"cosm/logging"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,17 +22,28 @@ type deleteRegistryConfig struct {
 
 // RegistryDelete deletes a registry from the local system
 func RegistryDelete(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	// Parse arguments and initialize config
 	config, err := parseDeleteArgs(cmd, args)
 	if err != nil {
 		return err
 	}
+	unlockDepot, err := lockDepot(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlockDepot()
+	unlockRegistry, err := lockRegistry(ctx, config.registryName)
+	if err != nil {
+		return err
+	}
+	defer unlockRegistry()
 
 	// Load existing registry names
 	config.registryNames, err = loadRegistryNames(config.registriesDir)
 	if err != nil {
 		if !os.IsNotExist(err) && !strings.Contains(err.Error(), "no registries available") {
-			return fmt.Errorf("failed to load registry names: %v", err)
+			return fmt.Errorf("failed to load registry names: %w", err)
 		}
 		config.registryNames = []string{} // Initialize empty list if registries.json is missing or empty
 	}
@@ -52,32 +63,32 @@ func RegistryDelete(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("Deleted registry '%s'\n", config.registryName)
+	logging.Infof("Deleted registry '%s'", config.registryName)
 	return nil
 }
 
 // parseDeleteArgs parses and validates the registry name argument
 func parseDeleteArgs(cmd *cobra.Command, args []string) (*deleteRegistryConfig, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("exactly one argument required (e.g., cosm registry delete <registryName>)")
+		return nil, validationError("exactly one argument required (e.g., cosm registry delete <registryName>)")
 	}
 	registryName := args[0]
 	if registryName == "" {
-		return nil, fmt.Errorf("registry name cannot be empty")
+		return nil, validationError("registry name cannot be empty")
 	}
 
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cosm directory: %v", err)
+		return nil, fmt.Errorf("failed to get cosm directory: %w", err)
 	}
 	registriesDir, err := getRegistriesDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get registries directory: %v", err)
+		return nil, fmt.Errorf("failed to get registries directory: %w", err)
 	}
 
 	force, err := cmd.Flags().GetBool("force")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get force flag: %v", err)
+		return nil, fmt.Errorf("failed to get force flag: %w", err)
 	}
 
 	return &deleteRegistryConfig{
@@ -95,7 +106,7 @@ func validateRegistryForDeletion(config *deleteRegistryConfig) error {
 		return err
 	}
 	if _, err := os.Stat(config.registryPath); os.IsNotExist(err) {
-		return fmt.Errorf("registry directory '%s' not found", config.registryPath)
+		return notFoundError("registry directory '%s' not found", config.registryPath)
 	}
 	return nil
 }
@@ -103,13 +114,13 @@ func validateRegistryForDeletion(config *deleteRegistryConfig) error {
 // promptForDeletion prompts the user for confirmation if not forced
 func promptForDeletion(config *deleteRegistryConfig) error {
 	if !config.force {
-		fmt.Printf("Are you sure you want to delete registry '%s'? [y/N]: ", config.registryName)
-		scanner := bufio.NewScanner(os.Stdin)
-		scanner.Scan()
-		response := strings.TrimSpace(strings.ToLower(scanner.Text()))
-		if response != "y" && response != "yes" {
-			fmt.Println("Registry deletion cancelled.")
-			return nil
+		prompt := fmt.Sprintf("Are you sure you want to delete registry '%s'? [y/N]: ", config.registryName)
+		confirmed, err := promptUserForConfirmation(prompt, fmt.Sprintf("deleting registry '%s'", config.registryName))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return fmt.Errorf("registry deletion cancelled by user")
 		}
 	}
 	return nil
@@ -118,7 +129,7 @@ func promptForDeletion(config *deleteRegistryConfig) error {
 // deleteRegistry removes the registry directory and updates registries.json
 func deleteRegistry(config *deleteRegistryConfig) error {
 	if err := os.RemoveAll(config.registryPath); err != nil {
-		return fmt.Errorf("failed to remove directory '%s': %v", config.registryPath, err)
+		return fmt.Errorf("failed to remove directory '%s': %w", config.registryPath, err)
 	}
 
 	var updatedNames []string
@@ -130,5 +141,12 @@ func deleteRegistry(config *deleteRegistryConfig) error {
 	if err := saveRegistryNames(updatedNames, config.registriesDir); err != nil {
 		return err
 	}
+	protected, err := loadProtectedRegistries(config.registriesDir)
+	if err != nil {
+		return err
+	}
+	if contains(protected, config.registryName) {
+		return saveProtectedRegistries(config.registriesDir, removeString(protected, config.registryName))
+	}
 	return nil
 }
@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// importPackageConfig holds the configuration for copying a package between registries
+type importPackageConfig struct {
+	registriesDir  string
+	registryName   string // Registry the package is imported into
+	sourceRegistry string
+	packageName    string
+	versions       []string // Versions to import; all versions of the source if empty
+}
+
+// RegistryImport copies a package, with all or the given versions, from another local registry,
+// e.g. to promote it from a staging registry to a production registry. The specs are copied and
+// the build lists and dependents are recomputed for the registry the package is imported into.
+func RegistryImport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) < 3 {
+		return validationError("requires a registry name, a source registry name and a package name")
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	config := &importPackageConfig{
+		registriesDir:  registriesDir,
+		registryName:   args[0],
+		sourceRegistry: args[1],
+		packageName:    args[2],
+		versions:       args[3:],
+	}
+	if config.registryName == config.sourceRegistry {
+		return validationError("cannot import package '%s' from registry '%s' into itself", config.packageName, config.registryName)
+	}
+	for _, version := range config.versions {
+		if err := validateVersion(version); err != nil {
+			return validationError("invalid version '%s': %v", version, err)
+		}
+	}
+	imported, err := importPackage(ctx, config)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Imported %d version(s) of package '%s' from registry '%s' to registry '%s': %s", len(imported), config.packageName, config.sourceRegistry, config.registryName, strings.Join(imported, ", "))
+	notifyWebhooks(ctx, registriesDir, config.registryName, config.packageName, imported)
+	return nil
+}
+
+// importPackage copies the package versions under the locks of both registries and commits and
+// pushes the registry they are imported into; it returns the imported versions
+func importPackage(ctx context.Context, config *importPackageConfig) ([]string, error) {
+	for _, registryName := range []string{config.registryName, config.sourceRegistry} {
+		if err := assertRegistryExists(config.registriesDir, registryName); err != nil {
+			return nil, err
+		}
+	}
+	if err := assertRegistryWritable(config.registriesDir, config.registryName); err != nil {
+		return nil, err
+	}
+	unlockDepot, err := lockDepot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockDepot()
+	// Lock the registries in name order, so that concurrent imports in both directions cannot deadlock
+	lockOrder := []string{config.registryName, config.sourceRegistry}
+	if lockOrder[1] < lockOrder[0] {
+		lockOrder[0], lockOrder[1] = lockOrder[1], lockOrder[0]
+	}
+	for _, registryName := range lockOrder {
+		unlockRegistry, err := lockRegistry(ctx, registryName)
+		if err != nil {
+			return nil, err
+		}
+		defer unlockRegistry()
+		if err := updateSingleRegistry(ctx, config.registriesDir, registryName); err != nil {
+			return nil, err
+		}
+	}
+
+	source, _, err := LoadRegistryMetadata(config.registriesDir, config.sourceRegistry)
+	if err != nil {
+		return nil, err
+	}
+	pkgInfo, ok := source.Packages[config.packageName]
+	if !ok {
+		return nil, notFoundError("package '%s' not found in registry '%s'", config.packageName, config.sourceRegistry)
+	}
+	sourceVersions, err := loadVersions(config.registriesDir, config.sourceRegistry, config.packageName)
+	if err != nil {
+		return nil, err
+	}
+	versions := config.versions
+	if len(versions) == 0 {
+		versions = sourceVersions
+	}
+	for _, version := range versions {
+		if !contains(sourceVersions, version) {
+			return nil, notFoundError("version '%s' of package '%s' not found in registry '%s'", version, config.packageName, config.sourceRegistry)
+		}
+	}
+
+	registry, registryFile, err := LoadRegistryMetadata(config.registriesDir, config.registryName)
+	if err != nil {
+		return nil, err
+	}
+	var existingVersions []string
+	if existing, ok := registry.Packages[config.packageName]; ok {
+		if existing.UUID != pkgInfo.UUID {
+			return nil, conflictError("registry '%s' has another package named '%s' (UUID %s instead of %s)", config.registryName, config.packageName, existing.UUID, pkgInfo.UUID)
+		}
+		if existingVersions, err = loadVersions(config.registriesDir, config.registryName, config.packageName); err != nil {
+			return nil, err
+		}
+	}
+	var imported []string
+	for _, version := range versions {
+		if contains(existingVersions, version) {
+			if len(config.versions) > 0 {
+				return nil, conflictError("version '%s' of package '%s' is already registered in registry '%s'", version, config.packageName, config.registryName)
+			}
+			continue
+		}
+		imported = append(imported, version)
+	}
+	if len(imported) == 0 {
+		return nil, conflictError("all versions of package '%s' in registry '%s' are already registered in registry '%s'", config.packageName, config.sourceRegistry, config.registryName)
+	}
+
+	registryDir := filepath.Join(config.registriesDir, config.registryName)
+	if err := copyPackageVersions(config, registry, registryFile, pkgInfo, existingVersions, imported); err != nil {
+		if revertErr := revertUnstagedChanges(ctx, registryDir); revertErr != nil {
+			logging.Warnf("failed to revert the changes to registry '%s': %v", config.registryName, revertErr)
+		}
+		return nil, err
+	}
+	commitMsg := fmt.Sprintf("Imported package %s %s from registry %s", config.packageName, strings.Join(imported, ", "), config.sourceRegistry)
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// copyPackageVersions writes the imported versions, versions.json and, for a new package, its
+// entry in registry.json to the registry the package is imported into
+func copyPackageVersions(config *importPackageConfig, registry types.Registry, registryFile string, pkgInfo types.PackageInfo, existingVersions, imported []string) error {
+	packageDir, err := setupPackageDir(config.registriesDir, config.registryName, config.packageName)
+	if err != nil {
+		return err
+	}
+	for _, version := range imported {
+		specs, err := loadSpecs(config.registriesDir, config.sourceRegistry, config.packageName, version)
+		if err != nil {
+			return err
+		}
+		project := &types.Project{
+			Name:        specs.Name,
+			UUID:        specs.UUID,
+			Version:     specs.Version,
+			Deps:        specs.Deps,
+			Description: specs.Description,
+			Keywords:    specs.Keywords,
+			License:     specs.License,
+			Homepage:    specs.Homepage,
+			Features:    specs.Features,
+		}
+		if err := addPackageVersion(packageDir, config.packageName, specs.UUID, specs.GitURL, specs.Subdir, specs.Mirrors, specs.SHA1, version, project, config.registriesDir, config.registryName); err != nil {
+			return err
+		}
+		changelog, err := loadChangelog(config.registriesDir, config.sourceRegistry, config.packageName, version)
+		if err != nil {
+			return err
+		}
+		if changelog != "" {
+			if err := writeMetadataFile(filepath.Join(packageDir, version, "changelog.md"), []byte(changelog+"\n")); err != nil {
+				return err
+			}
+		}
+		notes, err := loadReleaseNotes(config.registriesDir, config.sourceRegistry, config.packageName, version)
+		if err != nil {
+			return err
+		}
+		if notes != "" {
+			if err := writeMetadataFile(filepath.Join(packageDir, version, "notes.md"), []byte(notes+"\n")); err != nil {
+				return err
+			}
+		}
+		if specs.Yanked || specs.Signer != "" || specs.Digest != "" {
+			// Yanked versions stay yanked in the registry they are imported into, signed ones keep their
+			// signer, and the digests of archives are kept
+			copied, err := loadSpecs(config.registriesDir, config.registryName, config.packageName, version)
+			if err != nil {
+				return err
+			}
+			copied.Yanked = specs.Yanked
+			copied.Signer = specs.Signer
+			copied.Digest = specs.Digest
+			if err := saveSpecs(copied, filepath.Join(packageDir, version, "specs.json")); err != nil {
+				return err
+			}
+		}
+	}
+	versions := append(append([]string{}, existingVersions...), imported...)
+	sortVersions(versions)
+	if err := savePackageVersions(versions, filepath.Join(packageDir, "versions.json")); err != nil {
+		return err
+	}
+	if _, ok := registry.Packages[config.packageName]; !ok {
+		registry.Packages[config.packageName] = pkgInfo
+		if err := saveRegistryMetadata(registry, registryFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// registryIndex is the catalog of a registry written to index.json by cosm registry index
+type registryIndex struct {
+	Name     string         `json:"name"`
+	UUID     string         `json:"uuid"`
+	GitURL   string         `json:"giturl"`
+	Packages []indexPackage `json:"packages"`
+}
+
+// indexPackage describes a package in the index, with the metadata of its latest version
+type indexPackage struct {
+	Name        string         `json:"name"`
+	UUID        string         `json:"uuid"`
+	GitURL      string         `json:"giturl"`
+	Subdir      string         `json:"subdir,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Keywords    []string       `json:"keywords,omitempty"`
+	License     string         `json:"license,omitempty"`
+	Homepage    string         `json:"homepage,omitempty"`
+	Latest      string         `json:"latest,omitempty"`
+	Versions    []indexVersion `json:"versions"` // Newest first
+}
+
+// indexVersion describes a version of a package in the index
+type indexVersion struct {
+	Version   string            `json:"version"`
+	SHA1      string            `json:"sha1"`
+	Published string            `json:"published,omitempty"` // Commit date of the registry commit that added the version
+	Yanked    bool              `json:"yanked,omitempty"`
+	License   string            `json:"license,omitempty"`
+	Deps      []indexDependency `json:"deps"`
+}
+
+// indexDependency is a dependency of a version in the index
+type indexDependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// RegistryIndex writes a static HTML and JSON catalog of a registry clone, e.g. to publish with GitHub Pages
+func RegistryIndex(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 1 || args[0] == "" {
+		return validationError("requires a registry name (e.g., cosm registry index <registry> [--output <dir>])")
+	}
+	registryName := args[0]
+	outputDir, _ := cmd.Flags().GetString("output")
+	if outputDir == "" {
+		outputDir = registryName + "-index"
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	if err := assertRegistryExists(registriesDir, registryName); err != nil {
+		return fmt.Errorf("failed to validate registry '%s': %w", registryName, err)
+	}
+	index, err := buildRegistryIndex(ctx, registriesDir, registryName)
+	if err != nil {
+		return err
+	}
+	if err := writeRegistryIndex(index, outputDir); err != nil {
+		return err
+	}
+	logging.Infof("Wrote index of %d package(s) in registry '%s' to %s", len(index.Packages), registryName, outputDir)
+	return nil
+}
+
+// buildRegistryIndex collects the packages of a registry with all their versions, sorted by name
+func buildRegistryIndex(ctx context.Context, registriesDir, registryName string) (registryIndex, error) {
+	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return registryIndex{}, fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+	}
+	index := registryIndex{Name: registryName, UUID: registry.UUID, GitURL: registry.GitURL, Packages: []indexPackage{}}
+	pkgNames := make([]string, 0, len(registry.Packages))
+	for pkgName := range registry.Packages {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	sort.Strings(pkgNames)
+	for _, pkgName := range pkgNames {
+		pkg, err := buildIndexPackage(ctx, registriesDir, registryName, pkgName, registry.Packages[pkgName])
+		if err != nil {
+			return registryIndex{}, err
+		}
+		index.Packages = append(index.Packages, pkg)
+	}
+	return index, nil
+}
+
+// buildIndexPackage collects the versions of a package; the descriptive metadata is taken from its
+// latest release
+func buildIndexPackage(ctx context.Context, registriesDir, registryName, pkgName string, pkgInfo types.PackageInfo) (indexPackage, error) {
+	pkg := indexPackage{Name: pkgName, UUID: pkgInfo.UUID, GitURL: pkgInfo.GitURL, Subdir: pkgInfo.Subdir, Versions: []indexVersion{}}
+	versions, err := loadVersions(registriesDir, registryName, pkgName)
+	if err != nil {
+		return pkg, err
+	}
+	sortVersions(versions)
+	published, err := versionPublicationDates(ctx, registriesDir, registryName, pkgName)
+	if err != nil {
+		return pkg, err
+	}
+	if pkg.Latest, err = latestReleasedVersion(registriesDir, registryName, pkgName); err != nil {
+		return pkg, err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		specs, err := loadSpecs(registriesDir, registryName, pkgName, versions[i])
+		if err != nil {
+			return pkg, fmt.Errorf("failed to load specs for '%s@%s': %w", pkgName, versions[i], err)
+		}
+		version := indexVersion{
+			Version:   versions[i],
+			SHA1:      specs.SHA1,
+			Published: published[versions[i]],
+			Yanked:    specs.Yanked,
+			License:   specs.License,
+			Deps:      []indexDependency{},
+		}
+		for _, key := range sortedDependencyKeys(specs.Deps) {
+			version.Deps = append(version.Deps, indexDependency{Name: specs.Deps[key].Name, Version: specs.Deps[key].Version})
+		}
+		pkg.Versions = append(pkg.Versions, version)
+		if versions[i] == pkg.Latest {
+			pkg.Description = specs.Description
+			pkg.Keywords = specs.Keywords
+			pkg.License = specs.License
+			pkg.Homepage = specs.Homepage
+		}
+	}
+	return pkg, nil
+}
+
+// writeRegistryIndex writes index.json and index.html to a directory, with a .nojekyll file so that
+// GitHub Pages serves the files as they are
+func writeRegistryIndex(index registryIndex, outputDir string) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "index.json"), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write index.json: %w", err)
+	}
+	var page strings.Builder
+	if err := indexTemplate.Execute(&page, index); err != nil {
+		return fmt.Errorf("failed to render index.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "index.html"), []byte(page.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write index.html: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, ".nojekyll"), nil, 0644); err != nil {
+		return fmt.Errorf("failed to write .nojekyll: %w", err)
+	}
+	return nil
+}
+
+// indexTemplate renders the catalog of a registry as a single page, with a section per package
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"day":  publishedDay,
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} package index</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.25em 0.5em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.yanked { color: #999; text-decoration: line-through; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Registry <code>{{.GitURL}}</code>, {{len .Packages}} package(s). Also available as <a href="index.json">index.json</a>.</p>
+<table>
+<tr><th>Package</th><th>Latest</th><th>License</th><th>Description</th></tr>
+{{- range .Packages}}
+<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Latest}}</td><td>{{.License}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+{{- range .Packages}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+<ul>
+<li>UUID: <code>{{.UUID}}</code></li>
+<li>Git URL: <code>{{.GitURL}}</code>{{if .Subdir}} ({{.Subdir}}){{end}}</li>
+{{- if .Homepage}}
+<li>Homepage: <a href="{{.Homepage}}">{{.Homepage}}</a></li>
+{{- end}}
+{{- if .Keywords}}
+<li>Keywords: {{join .Keywords ", "}}</li>
+{{- end}}
+</ul>
+<table>
+<tr><th>Version</th><th>Published</th><th>License</th><th>Dependencies</th><th>SHA1</th></tr>
+{{- range .Versions}}
+<tr{{if .Yanked}} class="yanked"{{end}}><td>{{.Version}}{{if .Yanked}} (yanked){{end}}</td><td>{{day .Published}}</td><td>{{.License}}</td><td>
+{{- range $i, $dep := .Deps}}{{if $i}}, {{end}}<a href="#{{$dep.Name}}">{{$dep.Name}}</a> {{$dep.Version}}{{end -}}
+</td><td><code>{{.SHA1}}</code></td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"encoding/json"
 	"fmt"
@@ -13,15 +15,21 @@ import (
 
 // RegistryInit initializes a new package registry
 func RegistryInit(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	registryName, gitURL, registriesDir, err := setupAndParseInitArgs(args)
 	if err != nil {
 		return err
 	}
+	unlock, err := lockDepot(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	registryNames, err := loadAndCheckRegistries(registriesDir, registryName)
 	if err != nil {
 		return err
 	}
-	registrySubDir, err := cloneDir(registriesDir, registryName, gitURL)
+	registrySubDir, err := cloneDir(ctx, registriesDir, registryName, gitURL)
 	if err != nil {
 		return err
 	}
@@ -38,11 +46,11 @@ func RegistryInit(cmd *cobra.Command, args []string) error {
 		cleanupInit(registrySubDir)
 		return err
 	}
-	if err := commitAndPushInitialRegistryChanges(registryName); err != nil {
+	if err := commitAndPushInitialRegistryChanges(ctx, registryName); err != nil {
 		cleanupInit(registrySubDir)
 		return err
 	}
-	fmt.Printf("Initialized registry '%s' with Git URL: %s\n", registryName, gitURL)
+	logging.Infof("Initialized registry '%s' with Git URL: %s", registryName, gitURL)
 	return nil
 }
 
@@ -55,19 +63,19 @@ func setupAndParseInitArgs(args []string) (string, string, string, error) {
 	gitURL := args[1]
 
 	if registryName == "" {
-		return "", "", "", fmt.Errorf("registry name cannot be empty")
+		return "", "", "", validationError("registry name cannot be empty")
 	}
 	if gitURL == "" {
-		return "", "", "", fmt.Errorf("git URL cannot be empty")
+		return "", "", "", validationError("git URL cannot be empty")
 	}
 
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to get global .cosm directory: %v", err)
+		return "", "", "", fmt.Errorf("failed to get global .cosm directory: %w", err)
 	}
 	registriesDir := filepath.Join(cosmDir, "registries")
 	if err := os.MkdirAll(registriesDir, 0755); err != nil {
-		return "", "", "", fmt.Errorf("failed to create %s directory: %v", registriesDir, err)
+		return "", "", "", fmt.Errorf("failed to create %s directory: %w", registriesDir, err)
 	}
 
 	return registryName, gitURL, registriesDir, nil
@@ -76,7 +84,7 @@ func setupAndParseInitArgs(args []string) (string, string, string, error) {
 // cleanupInit reverts to the original directory and removes the registrySubDir if needed
 func cleanupInit(registrySubDir string) {
 	if err := os.RemoveAll(registrySubDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to clean up registry directory %s: %v\n", registrySubDir, err)
+		logging.Warnf("Failed to clean up registry directory %s: %v", registrySubDir, err)
 	}
 }
 
@@ -84,7 +92,7 @@ func cleanupInit(registrySubDir string) {
 func ensureDirectoryEmpty(dir, gitURL string) error {
 	files, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory %s: %v", dir, err)
+		return fmt.Errorf("failed to read directory %s: %w", dir, err)
 	}
 	for _, file := range files {
 		if file.Name() != ".git" { // Ignore .git directory
@@ -95,8 +103,8 @@ func ensureDirectoryEmpty(dir, gitURL string) error {
 }
 
 // cloneDir clones the repository into registries/<registryName> and returns the directory path.
-func cloneDir(registriesDir, registryName, gitURL string) (string, error) {
-	return clone(gitURL, registriesDir, registryName)
+func cloneDir(ctx context.Context, registriesDir, registryName, gitURL string) (string, error) {
+	return clone(ctx, gitURL, registriesDir, registryName)
 }
 
 // updateRegistriesList adds the registry name to registries.json
@@ -104,11 +112,11 @@ func updateRegistriesList(registriesDir string, registryNames []string, registry
 	registryNames = append(registryNames, registryName)
 	data, err := json.MarshalIndent(registryNames, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal registries.json: %v", err)
+		return fmt.Errorf("failed to marshal registries.json: %w", err)
 	}
 	registriesFile := filepath.Join(registriesDir, "registries.json")
-	if err := os.WriteFile(registriesFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write registries.json: %v", err)
+	if err := writeMetadataFile(registriesFile, data); err != nil {
+		return fmt.Errorf("failed to write registries.json: %w", err)
 	}
 	return nil
 }
@@ -124,10 +132,10 @@ func initializeRegistryMetadata(registrySubDir, registryName, gitURL string) (st
 	}
 	data, err := json.MarshalIndent(registry, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal registry.json: %v", err)
+		return "", fmt.Errorf("failed to marshal registry.json: %w", err)
 	}
-	if err := os.WriteFile(registryMetaFile, data, 0644); err != nil {
-		return "", fmt.Errorf("failed to write registry.json: %v", err)
+	if err := writeMetadataFile(registryMetaFile, data); err != nil {
+		return "", fmt.Errorf("failed to write registry.json: %w", err)
 	}
 	return registryMetaFile, nil
 }
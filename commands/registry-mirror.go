@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// mirrorRegistryConfig holds configuration for managing the mirrors of a registry or package
+type mirrorRegistryConfig struct {
+	registryName  string
+	packageName   string // Empty when managing the mirrors of the registry itself
+	url           string
+	registriesDir string
+	registry      types.Registry
+	registryFile  string
+}
+
+// RegistryMirrorAdd adds a mirror URL to a registry, or to a package in the registry
+func RegistryMirrorAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) > 0 && args[0] != "" {
+		unlock, err := lockRegistry(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	config, err := parseRegistryMirrorArgs(ctx, args, "add")
+	if err != nil {
+		return err
+	}
+	mirrors, err := currentMirrors(config)
+	if err != nil {
+		return err
+	}
+	if contains(mirrors, config.url) {
+		return conflictError("mirror '%s' already exists for %s", config.url, mirrorTarget(config))
+	}
+	if err := applyMirrors(config, append(mirrors, config.url)); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Added mirror %s for %s", config.url, mirrorTarget(config))
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return err
+	}
+	logging.Infof("Added mirror '%s' for %s", config.url, mirrorTarget(config))
+	return nil
+}
+
+// RegistryMirrorRm removes a mirror URL from a registry, or from a package in the registry
+func RegistryMirrorRm(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) > 0 && args[0] != "" {
+		unlock, err := lockRegistry(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	config, err := parseRegistryMirrorArgs(ctx, args, "rm")
+	if err != nil {
+		return err
+	}
+	mirrors, err := currentMirrors(config)
+	if err != nil {
+		return err
+	}
+	if !contains(mirrors, config.url) {
+		return notFoundError("mirror '%s' not found for %s", config.url, mirrorTarget(config))
+	}
+	if err := applyMirrors(config, removeString(mirrors, config.url)); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Removed mirror %s for %s", config.url, mirrorTarget(config))
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return err
+	}
+	logging.Infof("Removed mirror '%s' for %s", config.url, mirrorTarget(config))
+	return nil
+}
+
+// RegistryMirrorList prints the mirrors of a registry, or of a package in the registry
+func RegistryMirrorList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) < 1 || len(args) > 2 {
+		return validationError("requires a registry name and an optional package name (e.g., cosm registry mirror list <registry> [<package>])")
+	}
+	config, err := loadMirrorConfig(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		config.packageName = args[1]
+	}
+	mirrors, err := currentMirrors(config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mirrors for %s:\n", mirrorTarget(config))
+	if len(mirrors) == 0 {
+		fmt.Println("  No mirrors.")
+		return nil
+	}
+	for _, mirror := range mirrors {
+		fmt.Printf("  - %s\n", mirror)
+	}
+	return nil
+}
+
+// parseRegistryMirrorArgs parses <registry> [<package>] <url>
+func parseRegistryMirrorArgs(ctx context.Context, args []string, action string) (*mirrorRegistryConfig, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, validationError("requires a registry name, an optional package name, and a URL (e.g., cosm registry mirror %s <registry> [<package>] <url>)", action)
+	}
+	config, err := loadMirrorConfig(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 {
+		config.packageName = args[1]
+	}
+	config.url = args[len(args)-1]
+	if config.url == "" {
+		return nil, validationError("mirror URL cannot be empty")
+	}
+	return config, nil
+}
+
+// loadMirrorConfig updates the registry and loads its metadata
+func loadMirrorConfig(ctx context.Context, registryName string) (*mirrorRegistryConfig, error) {
+	if registryName == "" {
+		return nil, validationError("registry name cannot be empty")
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	if err := updateSingleRegistry(ctx, registriesDir, registryName); err != nil {
+		return nil, fmt.Errorf("failed to update registry '%s': %w", registryName, err)
+	}
+	registry, registryFile, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+	}
+	return &mirrorRegistryConfig{
+		registryName:  registryName,
+		registriesDir: registriesDir,
+		registry:      registry,
+		registryFile:  registryFile,
+	}, nil
+}
+
+// currentMirrors returns the mirror list of the registry or package
+func currentMirrors(config *mirrorRegistryConfig) ([]string, error) {
+	if config.packageName == "" {
+		return config.registry.Mirrors, nil
+	}
+	pkgInfo, exists := config.registry.Packages[config.packageName]
+	if !exists {
+		return nil, notFoundError("package '%s' not found in registry '%s'", config.packageName, config.registryName)
+	}
+	return pkgInfo.Mirrors, nil
+}
+
+// applyMirrors stores the mirror list in registry.json and, for packages, in the
+// specs.json of every registered version
+func applyMirrors(config *mirrorRegistryConfig, mirrors []string) error {
+	if len(mirrors) == 0 {
+		mirrors = nil
+	}
+	if config.packageName == "" {
+		config.registry.Mirrors = mirrors
+		return saveRegistryMetadata(config.registry, config.registryFile)
+	}
+
+	pkgInfo := config.registry.Packages[config.packageName]
+	pkgInfo.Mirrors = mirrors
+	config.registry.Packages[config.packageName] = pkgInfo
+	if err := saveRegistryMetadata(config.registry, config.registryFile); err != nil {
+		return err
+	}
+
+	versions, err := loadVersions(config.registriesDir, config.registryName, config.packageName)
+	if err != nil {
+		return err
+	}
+	packageDir := filepath.Join(config.registriesDir, config.registryName, registryPackagePath(config.packageName))
+	for _, version := range versions {
+		specs, err := loadSpecs(config.registriesDir, config.registryName, config.packageName, version)
+		if err != nil {
+			return fmt.Errorf("failed to load specs for '%s@%s': %w", config.packageName, version, err)
+		}
+		specs.Mirrors = mirrors
+		if err := saveSpecs(specs, filepath.Join(packageDir, version, "specs.json")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorTarget describes the registry or package whose mirrors are managed
+func mirrorTarget(config *mirrorRegistryConfig) string {
+	if config.packageName == "" {
+		return fmt.Sprintf("registry '%s'", config.registryName)
+	}
+	return fmt.Sprintf("package '%s' in registry '%s'", config.packageName, config.registryName)
+}
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ownerRegistryConfig holds configuration for managing the maintainers of a package
+type ownerRegistryConfig struct {
+	registryName  string
+	packageName   string
+	registriesDir string
+	registry      types.Registry
+	registryFile  string
+	force         bool
+}
+
+// RegistryOwnerAdd adds a maintainer to a package in a registry
+func RegistryOwnerAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	unlock, err := lockRegistry(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := loadOwnerRegistryConfig(cmd, args)
+	if err != nil {
+		return err
+	}
+	author := args[2]
+	if _, _, ok := parseAuthor(author); !ok {
+		return validationError("invalid author '%s': must have the form [name]email", author)
+	}
+	pkgInfo := config.registry.Packages[config.packageName]
+	if err := ensureMaintainer(ctx, pkgInfo, config.packageName, config.registryName, config.force); err != nil {
+		return err
+	}
+	if findMaintainer(pkgInfo.Maintainers, author) >= 0 {
+		return conflictError("'%s' is already a maintainer of package '%s' in registry '%s'", author, config.packageName, config.registryName)
+	}
+	pkgInfo.Maintainers = append(pkgInfo.Maintainers, author)
+	return saveMaintainers(ctx, config, pkgInfo, fmt.Sprintf("Added maintainer %s of package %s", author, config.packageName),
+		fmt.Sprintf("Added maintainer '%s' to package '%s' in registry '%s'", author, config.packageName, config.registryName))
+}
+
+// RegistryOwnerRm removes a maintainer from a package in a registry
+func RegistryOwnerRm(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	unlock, err := lockRegistry(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := loadOwnerRegistryConfig(cmd, args)
+	if err != nil {
+		return err
+	}
+	author := args[2]
+	pkgInfo := config.registry.Packages[config.packageName]
+	if err := ensureMaintainer(ctx, pkgInfo, config.packageName, config.registryName, config.force); err != nil {
+		return err
+	}
+	index := findMaintainer(pkgInfo.Maintainers, author)
+	if index < 0 {
+		return fmt.Errorf("'%s' is not a maintainer of package '%s' in registry '%s'", author, config.packageName, config.registryName)
+	}
+	removed := pkgInfo.Maintainers[index]
+	pkgInfo.Maintainers = append(pkgInfo.Maintainers[:index:index], pkgInfo.Maintainers[index+1:]...)
+	if len(pkgInfo.Maintainers) == 0 {
+		pkgInfo.Maintainers = nil
+	}
+	return saveMaintainers(ctx, config, pkgInfo, fmt.Sprintf("Removed maintainer %s of package %s", removed, config.packageName),
+		fmt.Sprintf("Removed maintainer '%s' from package '%s' in registry '%s'", removed, config.packageName, config.registryName))
+}
+
+// RegistryOwnerList prints the maintainers of a package in a registry
+func RegistryOwnerList(cmd *cobra.Command, args []string) error {
+	config, err := loadOwnerRegistryConfig(cmd, args)
+	if err != nil {
+		return err
+	}
+	maintainers := config.registry.Packages[config.packageName].Maintainers
+	if len(maintainers) == 0 {
+		fmt.Printf("Package '%s' in registry '%s' has no maintainers; anyone can publish it\n", config.packageName, config.registryName)
+		return nil
+	}
+	fmt.Printf("Maintainers of package '%s' in registry '%s':\n", config.packageName, config.registryName)
+	for _, maintainer := range maintainers {
+		fmt.Printf("  - %s\n", maintainer)
+	}
+	return nil
+}
+
+// loadOwnerRegistryConfig updates the registry and checks that the package is registered
+func loadOwnerRegistryConfig(cmd *cobra.Command, args []string) (*ownerRegistryConfig, error) {
+	ctx := cmd.Context()
+	registryName, packageName := args[0], args[1]
+	if registryName == "" || packageName == "" {
+		return nil, validationError("registry name and package name cannot be empty")
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	force, _ := cmd.Flags().GetBool("force")
+	config := &ownerRegistryConfig{
+		registryName:  registryName,
+		packageName:   packageName,
+		registriesDir: registriesDir,
+		force:         force,
+	}
+	if err := updateSingleRegistry(ctx, registriesDir, registryName); err != nil {
+		return nil, fmt.Errorf("failed to update registry '%s': %w", registryName, err)
+	}
+	config.registry, config.registryFile, err = LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+	}
+	if _, exists := config.registry.Packages[packageName]; !exists {
+		return nil, notFoundError("package '%s' not found in registry '%s'", packageName, registryName)
+	}
+	return config, nil
+}
+
+// saveMaintainers stores the package info in registry.json and commits and pushes the registry
+func saveMaintainers(ctx context.Context, config *ownerRegistryConfig, pkgInfo types.PackageInfo, commitMsg, message string) error {
+	config.registry.Packages[config.packageName] = pkgInfo
+	if err := saveRegistryMetadata(config.registry, config.registryFile); err != nil {
+		return err
+	}
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return fmt.Errorf("failed to commit maintainers of package '%s': %w", config.packageName, err)
+	}
+	logging.Infof("%s", message)
+	return nil
+}
+
+// ensureMaintainer checks that the publishing author is a maintainer of the package. Packages
+// without maintainers can be published by anyone, and force overrides the check.
+func ensureMaintainer(ctx context.Context, pkgInfo types.PackageInfo, packageName, registryName string, force bool) error {
+	if force || len(pkgInfo.Maintainers) == 0 {
+		return nil
+	}
+	author, err := publishingAuthor(ctx)
+	if err != nil {
+		return err
+	}
+	if findMaintainer(pkgInfo.Maintainers, author) < 0 {
+		return fmt.Errorf("'%s' is not a maintainer of package '%s' in registry '%s' (use --force to override)", author, packageName, registryName)
+	}
+	return nil
+}
+
+// publishingAuthor returns the author that publishes changes to registries
+func publishingAuthor(ctx context.Context) (string, error) {
+	authors, err := getGitAuthors(ctx)
+	if err != nil {
+		return "", err
+	}
+	return authors[0], nil
+}
+
+// findMaintainer returns the index of an author in the maintainers, matching by email, or -1
+func findMaintainer(maintainers []string, author string) int {
+	_, email, ok := parseAuthor(author)
+	for i, maintainer := range maintainers {
+		if maintainer == author {
+			return i
+		}
+		if _, maintainerEmail, maintainerOK := parseAuthor(maintainer); ok && maintainerOK && strings.EqualFold(email, maintainerEmail) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseAuthor splits an author of the form [name]email
+func parseAuthor(author string) (name, email string, ok bool) {
+	if !strings.HasPrefix(author, "[") {
+		return "", "", false
+	}
+	end := strings.Index(author, "]")
+	if end < 0 || end == len(author)-1 {
+		return "", "", false
+	}
+	return author[1:end], author[end+1:], true
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"cosm/logging"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// protectedRegistriesFile lists the registries in the depot that cosm must not modify, such as local
+// clones of shared upstream registries; it is local to the depot and never pushed
+const protectedRegistriesFile = "protected.json"
+
+// RegistryProtect marks a registry as read-only, so that registry add, rm, unyank and import and
+// release refuse to modify it
+func RegistryProtect(cmd *cobra.Command, args []string) error {
+	return setRegistryProtection(args, true)
+}
+
+// RegistryUnprotect allows changes to a registry that was marked as read-only
+func RegistryUnprotect(cmd *cobra.Command, args []string) error {
+	return setRegistryProtection(args, false)
+}
+
+// setRegistryProtection adds a registry to or removes it from the protected registries
+func setRegistryProtection(args []string, protect bool) error {
+	if len(args) != 1 || args[0] == "" {
+		return validationError("requires exactly one argument (registry name)")
+	}
+	registryName := args[0]
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	if err := assertRegistryExists(registriesDir, registryName); err != nil {
+		return err
+	}
+	protected, err := loadProtectedRegistries(registriesDir)
+	if err != nil {
+		return err
+	}
+	if contains(protected, registryName) == protect {
+		if protect {
+			logging.Infof("Registry '%s' is already read-only", registryName)
+		} else {
+			logging.Infof("Registry '%s' is not read-only", registryName)
+		}
+		return nil
+	}
+	if protect {
+		protected = append(protected, registryName)
+	} else {
+		protected = removeString(protected, registryName)
+	}
+	if err := saveProtectedRegistries(registriesDir, protected); err != nil {
+		return err
+	}
+	if protect {
+		logging.Infof("Registry '%s' is now read-only", registryName)
+	} else {
+		logging.Infof("Registry '%s' is no longer read-only", registryName)
+	}
+	return nil
+}
+
+// loadProtectedRegistries returns the names of the read-only registries in registries/protected.json
+func loadProtectedRegistries(registriesDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(registriesDir, protectedRegistriesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", protectedRegistriesFile, err)
+	}
+	var protected []string
+	if err := unmarshalValidated("registries.schema.json", data, &protected); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", protectedRegistriesFile, err)
+	}
+	return protected, nil
+}
+
+// saveProtectedRegistries writes the names of the read-only registries, sorted, to registries/protected.json
+func saveProtectedRegistries(registriesDir string, protected []string) error {
+	protected = append([]string{}, protected...)
+	sort.Strings(protected)
+	data, err := json.MarshalIndent(protected, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", protectedRegistriesFile, err)
+	}
+	return writeMetadataFile(filepath.Join(registriesDir, protectedRegistriesFile), data)
+}
+
+// assertRegistryWritable returns a conflict error if a registry is marked as read-only
+func assertRegistryWritable(registriesDir, registryName string) error {
+	protected, err := loadProtectedRegistries(registriesDir)
+	if err != nil {
+		return err
+	}
+	if contains(protected, registryName) {
+		return conflictError("registry '%s' is read-only (run 'cosm registry unprotect %s' to allow changes)", registryName, registryName)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package commands
+
+import (
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// RegistryRdeps prints the packages in a registry that depend on a package, so that maintainers can
+// see who is affected before removing or yanking a version
+func RegistryRdeps(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return validationError("requires a registry name and a package name, with an optional version (e.g., cosm registry rdeps <registry> <package> [<version>])")
+	}
+	registryName, packageName := args[0], args[1]
+	if registryName == "" || packageName == "" {
+		return validationError("registry name and package name cannot be empty")
+	}
+	versionTag := ""
+	if len(args) == 3 {
+		versionTag = args[2]
+		if !strings.HasPrefix(versionTag, "v") {
+			return validationError("version must start with 'v' if provided")
+		}
+	}
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	if err := assertRegistryExists(registriesDir, registryName); err != nil {
+		return err
+	}
+	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+	}
+	pkgInfo, exists := registry.Packages[packageName]
+	if !exists {
+		return notFoundError("package '%s' not found in registry '%s'", packageName, registryName)
+	}
+	if versionTag != "" {
+		versions, err := loadVersions(registriesDir, registryName, packageName)
+		if err != nil {
+			return err
+		}
+		if !contains(versions, versionTag) {
+			return notFoundError("version '%s' of package '%s' not found in registry '%s'", versionTag, packageName, registryName)
+		}
+	}
+
+	dependents, err := loadDependents(registriesDir, registryName, packageName)
+	if err != nil {
+		return err
+	}
+	if versionTag != "" {
+		if dependents, err = filterDependentsByVersion(registriesDir, registryName, dependents, pkgInfo.UUID, versionTag); err != nil {
+			return err
+		}
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(dependents, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal dependents: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if versionTag != "" {
+		fmt.Printf("Packages in registry '%s' whose build list selects '%s' %s:\n", registryName, packageName, versionTag)
+	} else {
+		fmt.Printf("Packages in registry '%s' that depend on '%s':\n", registryName, packageName)
+	}
+	if len(dependents) == 0 {
+		fmt.Println("  No dependents.")
+		return nil
+	}
+	for _, dependent := range dependents {
+		note := "requires " + dependent.Requires
+		if specs, err := loadSpecs(registriesDir, registryName, dependent.Name, dependent.Version); err == nil && specs.Yanked {
+			note += ", yanked"
+		}
+		fmt.Printf("  - %s %s (%s)\n", dependent.Name, dependent.Version, note)
+	}
+	return nil
+}
+
+// filterDependentsByVersion keeps the dependents whose build list selects the given version of the
+// package; these are the versions that no longer resolve if it is removed
+func filterDependentsByVersion(registriesDir, registryName string, dependents []types.Dependent, packageUUID, versionTag string) ([]types.Dependent, error) {
+	major, err := GetMajorVersion(versionTag)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []types.Dependent{}
+	for _, dependent := range dependents {
+		buildList, err := loadBuildList(registriesDir, registryName, dependent.Name, dependent.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load build list of '%s@%s': %w", dependent.Name, dependent.Version, err)
+		}
+		if dep, ok := buildList.Dependencies[packageUUID+"@"+major]; ok && dep.Version == versionTag {
+			filtered = append(filtered, dependent)
+		}
+	}
+	return filtered, nil
+}
+
+// loadDependents loads the dependents of a package from its dependents.json; a package without the
+// file has no dependents
+func loadDependents(registriesDir, registryName, packageName string) ([]types.Dependent, error) {
+	packageDir, err := registryPackageDir(registriesDir, registryName, packageName)
+	if err != nil {
+		return nil, err
+	}
+	dependentsFile := filepath.Join(packageDir, "dependents.json")
+	dependents := []types.Dependent{}
+	data, err := os.ReadFile(dependentsFile)
+	if os.IsNotExist(err) {
+		return dependents, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dependentsFile, err)
+	}
+	if err := json.Unmarshal(data, &dependents); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", dependentsFile, err)
+	}
+	return dependents, nil
+}
+
+// saveDependents sorts the dependents and writes them to dependents.json;
+// the file is removed if there are none
+func saveDependents(dependents []types.Dependent, packageDir string) error {
+	dependentsFile := filepath.Join(packageDir, "dependents.json")
+	if len(dependents) == 0 {
+		if err := os.Remove(dependentsFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", dependentsFile, err)
+		}
+		return nil
+	}
+	sortDependents(dependents)
+	data, err := json.MarshalIndent(dependents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", dependentsFile, err)
+	}
+	if err := writeMetadataFile(dependentsFile, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dependentsFile, err)
+	}
+	return nil
+}
+
+// sortDependents sorts dependents by name and version
+func sortDependents(dependents []types.Dependent) {
+	sort.Slice(dependents, func(i, j int) bool {
+		if dependents[i].Name != dependents[j].Name {
+			return dependents[i].Name < dependents[j].Name
+		}
+		return semVerLess(dependents[i].Version, dependents[j].Version)
+	})
+}
+
+// registryDependencies returns the dependencies of a version that are registered in the registry
+// itself, keyed by package name; dependencies from other registries are not tracked
+func registryDependencies(registry types.Registry, specs types.Specs) map[string]types.Dependency {
+	deps := make(map[string]types.Dependency)
+	for key, dep := range specs.Deps {
+		uuid, _, _ := strings.Cut(key, "@")
+		if pkgInfo, ok := registry.Packages[dep.Name]; ok && pkgInfo.UUID == uuid {
+			deps[dep.Name] = dep
+		}
+	}
+	return deps
+}
+
+// recordDependents adds a registered version to the dependents.json of each of its dependencies
+// in the same registry
+func recordDependents(registriesDir, registryName string, specs types.Specs) error {
+	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+	}
+	for depName, dep := range registryDependencies(registry, specs) {
+		dependents, err := loadDependents(registriesDir, registryName, depName)
+		if err != nil {
+			return err
+		}
+		dependents = removeDependent(dependents, specs.Name, specs.Version)
+		dependents = append(dependents, types.Dependent{Name: specs.Name, UUID: specs.UUID, Version: specs.Version, Requires: dep.Version})
+		if err := saveDependents(dependents, filepath.Join(registriesDir, registryName, registryPackagePath(depName))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forgetDependents removes a version that is removed from the registry from the dependents.json of
+// each of its dependencies
+func forgetDependents(registriesDir, registryName string, registry types.Registry, specs types.Specs) error {
+	for depName := range registryDependencies(registry, specs) {
+		dependents, err := loadDependents(registriesDir, registryName, depName)
+		if err != nil {
+			return err
+		}
+		if err := saveDependents(removeDependent(dependents, specs.Name, specs.Version), filepath.Join(registriesDir, registryName, registryPackagePath(depName))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeDependent returns the dependents without the given version of a package
+func removeDependent(dependents []types.Dependent, name, version string) []types.Dependent {
+	kept := []types.Dependent{}
+	for _, dependent := range dependents {
+		if dependent.Name != name || dependent.Version != version {
+			kept = append(kept, dependent)
+		}
+	}
+	return kept
+}
+
+// collectDependents computes the dependents of every package in a registry from the specs of all
+// registered versions, keyed by the name of the dependency
+func collectDependents(registriesDir, registryName string, registry types.Registry) map[string][]types.Dependent {
+	dependents := make(map[string][]types.Dependent)
+	for packageName := range registry.Packages {
+		versions, err := loadVersions(registriesDir, registryName, packageName)
+		if err != nil {
+			continue // Reported by auditPackage
+		}
+		for _, version := range versions {
+			specs, err := loadSpecs(registriesDir, registryName, packageName, version)
+			if err != nil {
+				continue
+			}
+			for depName, dep := range registryDependencies(registry, specs) {
+				dependents[depName] = append(dependents[depName], types.Dependent{Name: packageName, UUID: specs.UUID, Version: version, Requires: dep.Version})
+			}
+		}
+	}
+	return dependents
+}
@@ -1,8 +1,9 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"cosm/types"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,6 +19,7 @@ type rmRegistryConfig struct {
 	versionTag    string
 	registriesDir string
 	force         bool
+	yank          bool
 	registry      types.Registry
 	registryFile  string
 	packageDir    string
@@ -26,14 +28,30 @@ type rmRegistryConfig struct {
 
 // RegistryRm removes a package or a specific version from a registry
 func RegistryRm(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	// Parse arguments and initialize config
 	config, err := parseRegistryRmArgs(cmd, args)
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRegistry(ctx, config.registryName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Validate registry and package
-	if err := validateRegistryAndPackage(config); err != nil {
+	if err := validateRegistryAndPackage(ctx, config); err != nil {
+		return err
+	}
+
+	// Yanking keeps the version, so that existing build lists still resolve
+	if config.yank {
+		return setVersionYanked(ctx, config.registriesDir, config.registryName, config.packageName, config.versionTag, true)
+	}
+
+	// Refuse to break the build lists of other packages unless forced
+	if err := checkRmDependents(config); err != nil {
 		return err
 	}
 
@@ -44,15 +62,15 @@ func RegistryRm(cmd *cobra.Command, args []string) error {
 
 	// Remove package or version and commit changes
 	if config.versionTag != "" {
-		return removePackageVersion(config)
+		return removePackageVersion(ctx, config)
 	}
-	return removeEntirePackage(config)
+	return removeEntirePackage(ctx, config)
 }
 
 // parseRmArgs parses and validates the registry name, package name, and optional version
 func parseRegistryRmArgs(cmd *cobra.Command, args []string) (*rmRegistryConfig, error) {
 	if len(args) < 2 || len(args) > 3 {
-		return nil, fmt.Errorf("requires registry name and package name, with optional version (e.g., cosm registry rm <registry> <package> [<version>])")
+		return nil, validationError("requires registry name and package name, with optional version (e.g., cosm registry rm <registry> <package> [<version>])")
 	}
 	registryName, packageName := args[0], args[1]
 	versionTag := ""
@@ -60,23 +78,31 @@ func parseRegistryRmArgs(cmd *cobra.Command, args []string) (*rmRegistryConfig,
 		versionTag = args[2]
 	}
 	if registryName == "" {
-		return nil, fmt.Errorf("registry name cannot be empty")
+		return nil, validationError("registry name cannot be empty")
 	}
 	if packageName == "" {
-		return nil, fmt.Errorf("package name cannot be empty")
+		return nil, validationError("package name cannot be empty")
 	}
 	if versionTag != "" && !strings.HasPrefix(versionTag, "v") {
-		return nil, fmt.Errorf("version must start with 'v' if provided")
+		return nil, validationError("version must start with 'v' if provided")
 	}
 
 	registriesDir, err := getRegistriesDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get registries directory: %v", err)
+		return nil, fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	if err := assertRegistryWritable(registriesDir, registryName); err != nil {
+		return nil, err
 	}
 
 	force, err := cmd.Flags().GetBool("force")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get force flag: %v", err)
+		return nil, fmt.Errorf("failed to get force flag: %w", err)
+	}
+
+	yank, _ := cmd.Flags().GetBool("yank")
+	if yank && versionTag == "" {
+		return nil, validationError("--yank requires a version (e.g., cosm registry rm <registry> <package> <version> --yank)")
 	}
 
 	config := &rmRegistryConfig{
@@ -85,7 +111,8 @@ func parseRegistryRmArgs(cmd *cobra.Command, args []string) (*rmRegistryConfig,
 		versionTag:    versionTag,
 		registriesDir: registriesDir,
 		force:         force,
-		packageDir:    filepath.Join(registriesDir, registryName, strings.ToUpper(string(packageName[0])), packageName),
+		yank:          yank,
+		packageDir:    filepath.Join(registriesDir, registryName, registryPackagePath(packageName)),
 	}
 	if versionTag != "" {
 		config.versionDir = filepath.Join(config.packageDir, versionTag)
@@ -95,47 +122,84 @@ func parseRegistryRmArgs(cmd *cobra.Command, args []string) (*rmRegistryConfig,
 }
 
 // validateRegistryAndPackage updates the registry and validates the package and version
-func validateRegistryAndPackage(config *rmRegistryConfig) error {
-	if err := updateSingleRegistry(config.registriesDir, config.registryName); err != nil {
-		return fmt.Errorf("failed to update registry '%s': %v", config.registryName, err)
+func validateRegistryAndPackage(ctx context.Context, config *rmRegistryConfig) error {
+	if err := updateSingleRegistry(ctx, config.registriesDir, config.registryName); err != nil {
+		return fmt.Errorf("failed to update registry '%s': %w", config.registryName, err)
 	}
 
 	var err error
 	config.registry, config.registryFile, err = LoadRegistryMetadata(config.registriesDir, config.registryName)
 	if err != nil {
-		return fmt.Errorf("failed to load registry metadata for '%s': %v", config.registryName, err)
+		return fmt.Errorf("failed to load registry metadata for '%s': %w", config.registryName, err)
 	}
 
 	if _, exists := config.registry.Packages[config.packageName]; !exists {
-		return fmt.Errorf("package '%s' not found in registry '%s'", config.packageName, config.registryName)
+		return notFoundError("package '%s' not found in registry '%s'", config.packageName, config.registryName)
+	}
+	if _, err := registryPackageDir(config.registriesDir, config.registryName, config.packageName); err != nil {
+		return err
 	}
 
 	if config.versionTag != "" {
 		if _, err := os.Stat(config.versionDir); os.IsNotExist(err) {
-			return fmt.Errorf("version '%s' not found for package '%s' in registry '%s'", config.versionTag, config.packageName, config.registryName)
+			return notFoundError("version '%s' not found for package '%s' in registry '%s'", config.versionTag, config.packageName, config.registryName)
 		}
 		versionsFile := filepath.Join(config.packageDir, "versions.json")
 		var versions []string
 		data, err := os.ReadFile(versionsFile)
 		if err != nil {
-			return fmt.Errorf("failed to read %s for package '%s': %v", versionsFile, config.packageName, err)
+			return fmt.Errorf("failed to read %s for package '%s': %w", versionsFile, config.packageName, err)
 		}
-		if err := json.Unmarshal(data, &versions); err != nil {
-			return fmt.Errorf("failed to parse %s for package '%s': %v", versionsFile, config.packageName, err)
+		if err := unmarshalValidated("versions.schema.json", data, &versions); err != nil {
+			return fmt.Errorf("failed to parse %s for package '%s': %w", versionsFile, config.packageName, err)
 		}
 		if !contains(versions, config.versionTag) {
-			return fmt.Errorf("version '%s' not found in %s for package '%s'", config.versionTag, versionsFile, config.packageName)
+			return notFoundError("version '%s' not found in %s for package '%s'", config.versionTag, versionsFile, config.packageName)
 		}
 	}
 	return nil
 }
 
+// checkRmDependents finds the registered versions of other packages that break if the package or
+// version is removed: for a version, those whose build list selects it. Without --force these are
+// reported in an error; with --force they are listed in a warning.
+func checkRmDependents(config *rmRegistryConfig) error {
+	dependents, err := loadDependents(config.registriesDir, config.registryName, config.packageName)
+	if err != nil {
+		return err
+	}
+	if config.versionTag != "" {
+		pkgUUID := config.registry.Packages[config.packageName].UUID
+		if dependents, err = filterDependentsByVersion(config.registriesDir, config.registryName, dependents, pkgUUID, config.versionTag); err != nil {
+			return err
+		}
+	}
+	var broken []string
+	for _, dependent := range dependents {
+		if dependent.Name != config.packageName {
+			broken = append(broken, dependent.Name+"@"+dependent.Version)
+		}
+	}
+	if len(broken) == 0 {
+		return nil
+	}
+	if !config.force {
+		return conflictError("cannot remove %s from registry '%s': it is used by %s; use --force to remove it anyway", getRemovalTarget(config), config.registryName, strings.Join(broken, ", "))
+	}
+	logging.Warnf("removing %s breaks the build lists of %s", getRemovalTarget(config), strings.Join(broken, ", "))
+	return nil
+}
+
 // promptForRm prompts the user for confirmation if not forced
 func promptForRm(config *rmRegistryConfig) error {
 	if !config.force {
 		prompt := fmt.Sprintf("Are you sure you want to remove %s from registry '%s'? [y/N]: ",
 			getRemovalTarget(config), config.registryName)
-		if !promptUserForConfirmation(prompt) {
+		confirmed, err := promptUserForConfirmation(prompt, "removing "+getRemovalTarget(config))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			return fmt.Errorf("operation cancelled by user")
 		}
 	}
@@ -151,19 +215,24 @@ func getRemovalTarget(config *rmRegistryConfig) string {
 }
 
 // removePackageVersion removes a specific version of a package
-func removePackageVersion(config *rmRegistryConfig) error {
+func removePackageVersion(ctx context.Context, config *rmRegistryConfig) error {
+	if specs, err := loadSpecs(config.registriesDir, config.registryName, config.packageName, config.versionTag); err == nil {
+		if err := forgetDependents(config.registriesDir, config.registryName, config.registry, specs); err != nil {
+			return err
+		}
+	}
 	if err := os.RemoveAll(config.versionDir); err != nil {
-		return fmt.Errorf("failed to remove directory '%s' for version '%s' of package '%s': %v", config.versionDir, config.versionTag, config.packageName, err)
+		return fmt.Errorf("failed to remove directory '%s' for version '%s' of package '%s': %w", config.versionDir, config.versionTag, config.packageName, err)
 	}
 
 	versionsFile := filepath.Join(config.packageDir, "versions.json")
 	var versions []string
 	data, err := os.ReadFile(versionsFile)
 	if err != nil {
-		return fmt.Errorf("failed to read %s for package '%s': %v", versionsFile, config.packageName, err)
+		return fmt.Errorf("failed to read %s for package '%s': %w", versionsFile, config.packageName, err)
 	}
-	if err := json.Unmarshal(data, &versions); err != nil {
-		return fmt.Errorf("failed to parse %s for package '%s': %v", versionsFile, config.packageName, err)
+	if err := unmarshalValidated("versions.schema.json", data, &versions); err != nil {
+		return fmt.Errorf("failed to parse %s for package '%s': %w", versionsFile, config.packageName, err)
 	}
 	versions = removeString(versions, config.versionTag)
 	if err := savePackageVersions(versions, versionsFile); err != nil {
@@ -171,18 +240,26 @@ func removePackageVersion(config *rmRegistryConfig) error {
 	}
 
 	commitMsg := fmt.Sprintf("Removed version '%s' of package '%s'", config.versionTag, config.packageName)
-	if err := commitAndPushRegistryChanges(config.registriesDir, config.registryName, commitMsg); err != nil {
-		return fmt.Errorf("failed to commit changes for version '%s' of package '%s': %v", config.versionTag, config.packageName, err)
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return fmt.Errorf("failed to commit changes for version '%s' of package '%s': %w", config.versionTag, config.packageName, err)
 	}
 
-	fmt.Printf("Removed version '%s' of package '%s' from registry '%s'\n", config.versionTag, config.packageName, config.registryName)
+	logging.Infof("Removed version '%s' of package '%s' from registry '%s'", config.versionTag, config.packageName, config.registryName)
 	return nil
 }
 
 // removeEntirePackage removes an entire package from the registry
-func removeEntirePackage(config *rmRegistryConfig) error {
+func removeEntirePackage(ctx context.Context, config *rmRegistryConfig) error {
+	versions, _ := loadVersions(config.registriesDir, config.registryName, config.packageName)
+	for _, version := range versions {
+		if specs, err := loadSpecs(config.registriesDir, config.registryName, config.packageName, version); err == nil {
+			if err := forgetDependents(config.registriesDir, config.registryName, config.registry, specs); err != nil {
+				return err
+			}
+		}
+	}
 	if err := os.RemoveAll(config.packageDir); err != nil {
-		return fmt.Errorf("failed to remove directory '%s' for package '%s': %v", config.packageDir, config.packageName, err)
+		return fmt.Errorf("failed to remove directory '%s' for package '%s': %w", config.packageDir, config.packageName, err)
 	}
 
 	delete(config.registry.Packages, config.packageName)
@@ -191,10 +268,78 @@ func removeEntirePackage(config *rmRegistryConfig) error {
 	}
 
 	commitMsg := fmt.Sprintf("Removed package '%s'", config.packageName)
-	if err := commitAndPushRegistryChanges(config.registriesDir, config.registryName, commitMsg); err != nil {
-		return fmt.Errorf("failed to commit changes for package '%s': %v", config.packageName, err)
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return fmt.Errorf("failed to commit changes for package '%s': %w", config.packageName, err)
+	}
+
+	logging.Infof("Removed package '%s' from registry '%s'", config.packageName, config.registryName)
+	return nil
+}
+
+// RegistryUnyank makes a yanked version of a package available to new dependencies again
+func RegistryUnyank(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	registryName, packageName, versionTag := args[0], args[1], args[2]
+	if registryName == "" || packageName == "" {
+		return validationError("registry name and package name cannot be empty")
+	}
+	if !strings.HasPrefix(versionTag, "v") {
+		return validationError("version must start with 'v'")
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	if err := assertRegistryWritable(registriesDir, registryName); err != nil {
+		return err
+	}
+	config := &rmRegistryConfig{
+		registryName:  registryName,
+		packageName:   packageName,
+		versionTag:    versionTag,
+		registriesDir: registriesDir,
+		packageDir:    filepath.Join(registriesDir, registryName, registryPackagePath(packageName)),
+	}
+	config.versionDir = filepath.Join(config.packageDir, versionTag)
+	unlock, err := lockRegistry(ctx, registryName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := validateRegistryAndPackage(ctx, config); err != nil {
+		return err
+	}
+	return setVersionYanked(ctx, registriesDir, registryName, packageName, versionTag, false)
+}
+
+// setVersionYanked marks a version as yanked or not in its specs.json and commits and pushes the registry
+func setVersionYanked(ctx context.Context, registriesDir, registryName, packageName, versionTag string, yanked bool) error {
+	specs, err := loadSpecs(registriesDir, registryName, packageName, versionTag)
+	if err != nil {
+		return fmt.Errorf("failed to load specs for '%s@%s': %w", packageName, versionTag, err)
+	}
+	action := "Yanked"
+	if !yanked {
+		action = "Unyanked"
+	}
+	if specs.Yanked == yanked {
+		state := "yanked"
+		if !yanked {
+			state = "not yanked"
+		}
+		return conflictError("version '%s' of package '%s' is already %s in registry '%s'", versionTag, packageName, state, registryName)
+	}
+	specs.Yanked = yanked
+	specsFile := filepath.Join(registriesDir, registryName, registryPackagePath(packageName), versionTag, "specs.json")
+	if err := saveSpecs(specs, specsFile); err != nil {
+		return err
+	}
+
+	commitMsg := fmt.Sprintf("%s version '%s' of package '%s'", action, versionTag, packageName)
+	if err := commitAndPushRegistryChanges(ctx, registriesDir, registryName, commitMsg); err != nil {
+		return fmt.Errorf("failed to commit changes for version '%s' of package '%s': %w", versionTag, packageName, err)
 	}
 
-	fmt.Printf("Removed package '%s' from registry '%s'\n", config.packageName, config.registryName)
+	logging.Infof("%s version '%s' of package '%s' in registry '%s'", action, versionTag, packageName, registryName)
 	return nil
 }
@@ -0,0 +1,265 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// registryChange is a package or a version of a package that is added to or removed from a registry
+type registryChange struct {
+	Package string
+	Version string // Empty if the package itself is added or removed
+	Added   bool
+}
+
+// String formats the change as a line of cosm registry diff
+func (c registryChange) String() string {
+	sign := "-"
+	if c.Added {
+		sign = "+"
+	}
+	if c.Version == "" {
+		return fmt.Sprintf("%s package '%s'", sign, c.Package)
+	}
+	return fmt.Sprintf("%s %s %s", sign, c.Package, c.Version)
+}
+
+// pendingRegistryChanges describes the commits of a registry that are not pushed to its remote
+type pendingRegistryChanges struct {
+	registryDir string
+	branch      string
+	commits     int
+	changes     []registryChange
+}
+
+// RegistryDiff shows the packages and versions committed to a registry that are not pushed to its remote
+func RegistryDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	pending, err := loadPendingRegistryChanges(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if pending.commits == 0 {
+		logging.Infof("Registry '%s' has no unpushed changes", args[0])
+		return nil
+	}
+	logging.Infof("Registry '%s' has %d unpushed commit(s):", args[0], pending.commits)
+	for _, change := range pending.changes {
+		logging.Infof("  %s", change)
+	}
+	return nil
+}
+
+// RegistryPush publishes the staged commits of a registry and notifies its webhooks of the added versions
+func RegistryPush(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	registryName := args[0]
+	unlockRegistry, err := lockRegistry(ctx, registryName)
+	if err != nil {
+		return err
+	}
+	defer unlockRegistry()
+	pending, err := loadPendingRegistryChanges(ctx, registryName)
+	if err != nil {
+		return err
+	}
+	if pending.commits == 0 {
+		logging.Infof("Registry '%s' has no unpushed changes", registryName)
+		return nil
+	}
+	if err := pushToRemote(ctx, pending.registryDir, pending.branch, false); err != nil {
+		return fmt.Errorf("failed to push registry '%s': %w", registryName, err)
+	}
+	logging.Infof("Pushed %d commit(s) to registry '%s'", pending.commits, registryName)
+
+	registriesDir := filepath.Dir(pending.registryDir)
+	added := make(map[string][]string)
+	var packageNames []string
+	for _, change := range pending.changes {
+		if change.Added && change.Version != "" {
+			if added[change.Package] == nil {
+				packageNames = append(packageNames, change.Package)
+			}
+			added[change.Package] = append(added[change.Package], change.Version)
+		}
+	}
+	for _, packageName := range packageNames {
+		notifyWebhooks(ctx, registriesDir, registryName, packageName, added[packageName])
+	}
+	return nil
+}
+
+// RegistryDiscard resets a registry to its remote, dropping the commits that are not pushed
+func RegistryDiscard(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	registryName := args[0]
+	force, _ := cmd.Flags().GetBool("force")
+	unlockRegistry, err := lockRegistry(ctx, registryName)
+	if err != nil {
+		return err
+	}
+	defer unlockRegistry()
+	pending, err := loadPendingRegistryChanges(ctx, registryName)
+	if err != nil {
+		return err
+	}
+	if pending.commits == 0 {
+		logging.Infof("Registry '%s' has no unpushed changes", registryName)
+		return nil
+	}
+	if !force {
+		prompt := fmt.Sprintf("Discard %d unpushed commit(s) in registry '%s'? [y/N]: ", pending.commits, registryName)
+		confirmed, err := promptUserForConfirmation(prompt, fmt.Sprintf("discarding the changes to registry '%s'", registryName))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return fmt.Errorf("discarding the changes to registry '%s' cancelled by user", registryName)
+		}
+	}
+	if err := resetHard(ctx, pending.registryDir, gitRemote(ctx, pending.registryDir)+"/"+pending.branch); err != nil {
+		return err
+	}
+	logging.Infof("Discarded %d unpushed commit(s) in registry '%s'", pending.commits, registryName)
+	return nil
+}
+
+// loadPendingRegistryChanges fetches the remote, unless offline, and compares the registry with the
+// commit it has in common with the remote
+func loadPendingRegistryChanges(ctx context.Context, registryName string) (*pendingRegistryChanges, error) {
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := assertRegistryExists(registriesDir, registryName); err != nil {
+		return nil, err
+	}
+	registryDir := filepath.Join(registriesDir, registryName)
+	branch, err := getCurrentBranch(ctx, registryDir)
+	if err != nil {
+		return nil, err
+	}
+	remoteRef := gitRemote(ctx, registryDir) + "/" + branch
+	if currentConfig().Offline {
+		logging.Debugf("Comparing registry '%s' with the last fetched %s in offline mode", registryName, remoteRef)
+	} else if err := fetchRemote(ctx, registryDir); err != nil {
+		return nil, err
+	}
+
+	base, err := GitCommand(ctx, registryDir, "merge-base", remoteRef, "HEAD")
+	if err != nil {
+		return nil, wrapGitError(registryDir, fmt.Sprintf("failed to compare with %s", remoteRef), err)
+	}
+	base = strings.TrimSpace(base)
+	count, err := GitCommand(ctx, registryDir, "rev-list", "--count", base+"..HEAD")
+	if err != nil {
+		return nil, wrapGitError(registryDir, "failed to count unpushed commits", err)
+	}
+	commits, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unpushed commits in %s: %w", registryDir, err)
+	}
+	pending := &pendingRegistryChanges{registryDir: registryDir, branch: branch, commits: commits}
+	if commits > 0 {
+		if pending.changes, err = diffRegistryCommits(ctx, registryDir, base, "HEAD"); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// diffRegistryCommits lists the packages and versions added or removed between two commits of a registry
+func diffRegistryCommits(ctx context.Context, registryDir, from, to string) ([]registryChange, error) {
+	var before, after types.Registry
+	if err := unmarshalGitFile(ctx, registryDir, from, "registry.json", &before); err != nil {
+		return nil, err
+	}
+	if err := unmarshalGitFile(ctx, registryDir, to, "registry.json", &after); err != nil {
+		return nil, err
+	}
+
+	// Packages whose versions.json changed, by the path of the file
+	versionFiles := make(map[string]string)
+	for _, packages := range []map[string]types.PackageInfo{before.Packages, after.Packages} {
+		for name := range packages {
+			versionFiles[filepath.ToSlash(filepath.Join(registryPackagePath(name), "versions.json"))] = name
+		}
+	}
+	output, err := GitCommand(ctx, registryDir, "diff", "--name-only", from, to)
+	if err != nil {
+		return nil, wrapGitError(registryDir, "failed to list changed files", err)
+	}
+	changed := make(map[string]bool)
+	for _, file := range strings.Fields(output) {
+		if name, ok := versionFiles[file]; ok {
+			changed[name] = true
+		}
+	}
+	for name := range after.Packages {
+		if _, ok := before.Packages[name]; !ok {
+			changed[name] = true
+		}
+	}
+	for name := range before.Packages {
+		if _, ok := after.Packages[name]; !ok {
+			changed[name] = true
+		}
+	}
+	names := make([]string, 0, len(changed))
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []registryChange
+	for _, name := range names {
+		_, existed := before.Packages[name]
+		_, exists := after.Packages[name]
+		if existed != exists {
+			changes = append(changes, registryChange{Package: name, Added: exists})
+		}
+		path := filepath.ToSlash(filepath.Join(registryPackagePath(name), "versions.json"))
+		var oldVersions, newVersions []string
+		if err := unmarshalGitFile(ctx, registryDir, from, path, &oldVersions); err != nil {
+			return nil, err
+		}
+		if err := unmarshalGitFile(ctx, registryDir, to, path, &newVersions); err != nil {
+			return nil, err
+		}
+		for _, version := range newVersions {
+			if !contains(oldVersions, version) {
+				changes = append(changes, registryChange{Package: name, Version: version, Added: true})
+			}
+		}
+		for _, version := range oldVersions {
+			if !contains(newVersions, version) {
+				changes = append(changes, registryChange{Package: name, Version: version})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// unmarshalGitFile parses a JSON file as it is in a commit; a file missing in the commit leaves v unchanged
+func unmarshalGitFile(ctx context.Context, dir, commit, path string, v any) error {
+	if _, err := GitCommand(ctx, dir, "cat-file", "-e", commit+":"+path); err != nil {
+		return nil
+	}
+	data, err := GitCommand(ctx, dir, "show", commit+":"+path)
+	if err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to read %s in %s", path, commit), err)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("failed to parse %s in %s: %w", path, commit, err)
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package commands
 
 import (
+	"context"
 	"cosm/types"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -10,16 +15,47 @@ import (
 // statusRegistryConfig holds configuration for displaying registry status
 type statusRegistryConfig struct {
 	registryName  string
+	packageName   string // Only show this package, with its full version history
+	asJSON        bool
+	listing       listingOptions
 	cosmDir       string
 	registriesDir string
 	registry      types.Registry
 	registryFile  string
 }
 
+// registryStatus is the status of a registry, as printed by cosm registry status --json
+type registryStatus struct {
+	Name     string                  `json:"name"`
+	GitURL   string                  `json:"giturl"`
+	Total    int                     `json:"total"` // Number of packages in the registry, of which Packages holds the selected page
+	Packages []registryPackageStatus `json:"packages"`
+}
+
+// registryPackageStatus summarizes a package and its versions in a registry
+type registryPackageStatus struct {
+	Name          string                  `json:"name"`
+	UUID          string                  `json:"uuid"`
+	GitURL        string                  `json:"giturl"`
+	Description   string                  `json:"description,omitempty"`
+	VersionCount  int                     `json:"versioncount"`
+	Latest        string                  `json:"latest,omitempty"`
+	LastPublished string                  `json:"lastpublished,omitempty"` // Commit date of the most recently published version
+	Versions      []registryVersionStatus `json:"versions"`
+}
+
+// registryVersionStatus describes a single version of a package in a registry
+type registryVersionStatus struct {
+	Version   string `json:"version"`
+	Published string `json:"published,omitempty"` // Commit date of the registry commit that added the version
+	Yanked    bool   `json:"yanked,omitempty"`
+}
+
 // RegistryStatus prints an overview of packages in a registry
 func RegistryStatus(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	// Parse arguments and initialize config
-	config, err := parseStatusArgs(args)
+	config, err := parseStatusArgs(cmd, args)
 	if err != nil {
 		return err
 	}
@@ -29,32 +65,57 @@ func RegistryStatus(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Print registry status
-	printRegistryStatus(config)
+	// Collect and print registry status
+	status, err := collectRegistryStatus(ctx, config)
+	if err != nil {
+		return err
+	}
+	if config.asJSON {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal registry status: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if config.packageName != "" {
+		printPackageHistory(config, status.Packages[0])
+		return nil
+	}
+	printRegistryStatus(config, status)
 	return nil
 }
 
-// parseStatusArgs parses and validates the registry name
-func parseStatusArgs(args []string) (*statusRegistryConfig, error) {
+// parseStatusArgs parses and validates the registry name and flags
+func parseStatusArgs(cmd *cobra.Command, args []string) (*statusRegistryConfig, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("exactly one argument required (e.g., cosm registry status <registryName>)")
+		return nil, validationError("exactly one argument required (e.g., cosm registry status <registryName>)")
 	}
 	registryName := args[0]
 	if registryName == "" {
-		return nil, fmt.Errorf("registry name cannot be empty")
+		return nil, validationError("registry name cannot be empty")
 	}
 
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cosm directory: %v", err)
+		return nil, fmt.Errorf("failed to get cosm directory: %w", err)
 	}
 	registriesDir, err := getRegistriesDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get registries directory: %v", err)
+		return nil, fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	packageName, _ := cmd.Flags().GetString("package")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	listing, err := parseListingFlags(cmd)
+	if err != nil {
+		return nil, err
 	}
 
 	return &statusRegistryConfig{
 		registryName:  registryName,
+		packageName:   packageName,
+		asJSON:        asJSON,
+		listing:       listing,
 		cosmDir:       cosmDir,
 		registriesDir: registriesDir,
 	}, nil
@@ -63,26 +124,187 @@ func parseStatusArgs(args []string) (*statusRegistryConfig, error) {
 // validateRegistryForStatus checks if the registry exists and loads its metadata
 func validateRegistryForStatus(config *statusRegistryConfig) error {
 	if err := assertRegistryExists(config.registriesDir, config.registryName); err != nil {
-		return fmt.Errorf("failed to validate registry '%s': %v", config.registryName, err)
+		return fmt.Errorf("failed to validate registry '%s': %w", config.registryName, err)
 	}
 
 	var err error
 	config.registry, config.registryFile, err = LoadRegistryMetadata(config.registriesDir, config.registryName)
 	if err != nil {
-		return fmt.Errorf("failed to load registry metadata for '%s': %v", config.registryName, err)
+		return fmt.Errorf("failed to load registry metadata for '%s': %w", config.registryName, err)
+	}
+	if config.packageName != "" {
+		if _, exists := config.registry.Packages[config.packageName]; !exists {
+			return notFoundError("package '%s' not found in registry '%s'", config.packageName, config.registryName)
+		}
 	}
 	return nil
 }
 
+// collectRegistryStatus gathers the status of the selected page of packages, or of the selected package
+func collectRegistryStatus(ctx context.Context, config *statusRegistryConfig) (registryStatus, error) {
+	status := registryStatus{Name: config.registryName, GitURL: config.registry.GitURL, Packages: []registryPackageStatus{}}
+	pkgNames := make([]string, 0, len(config.registry.Packages))
+	for pkgName := range config.registry.Packages {
+		if config.packageName == "" || pkgName == config.packageName {
+			pkgNames = append(pkgNames, pkgName)
+		}
+	}
+	sort.Strings(pkgNames)
+	status.Total = len(pkgNames)
+
+	// Names are known up front, so only the packages on the page need to be inspected
+	listing := config.listing
+	if config.packageName != "" {
+		listing = listingOptions{sortBy: "name", page: 1}
+	}
+	if listing.sortBy == "name" {
+		start, end, err := listing.pageBounds(len(pkgNames))
+		if err != nil {
+			return registryStatus{}, err
+		}
+		pkgNames = pkgNames[start:end]
+	}
+	for _, pkgName := range pkgNames {
+		pkgStatus, err := collectPackageStatus(ctx, config, pkgName, config.registry.Packages[pkgName])
+		if err != nil {
+			return registryStatus{}, err
+		}
+		status.Packages = append(status.Packages, pkgStatus)
+	}
+	if listing.sortBy != "name" {
+		sortPackageStatuses(status.Packages, listing.sortBy)
+		start, end, err := listing.pageBounds(len(status.Packages))
+		if err != nil {
+			return registryStatus{}, err
+		}
+		status.Packages = status.Packages[start:end]
+	}
+	return status, nil
+}
+
+// sortPackageStatuses orders packages by descending version count or by descending publication date
+// of their latest version, keeping name order for ties
+func sortPackageStatuses(packages []registryPackageStatus, sortBy string) {
+	sort.SliceStable(packages, func(i, j int) bool {
+		if sortBy == "versions" {
+			return packages[i].VersionCount > packages[j].VersionCount
+		}
+		return packages[i].LastPublished > packages[j].LastPublished
+	})
+}
+
+// collectPackageStatus gathers the versions of a package with their publication dates
+func collectPackageStatus(ctx context.Context, config *statusRegistryConfig, pkgName string, pkgInfo types.PackageInfo) (registryPackageStatus, error) {
+	pkgStatus := registryPackageStatus{Name: pkgName, UUID: pkgInfo.UUID, GitURL: pkgInfo.GitURL, Versions: []registryVersionStatus{}}
+	versions, err := loadVersions(config.registriesDir, config.registryName, pkgName)
+	if err != nil {
+		return pkgStatus, err
+	}
+	sortVersions(versions)
+	published, err := versionPublicationDates(ctx, config.registriesDir, config.registryName, pkgName)
+	if err != nil {
+		return pkgStatus, err
+	}
+	for _, version := range versions {
+		versionStatus := registryVersionStatus{Version: version, Published: published[version]}
+		if specs, err := loadSpecs(config.registriesDir, config.registryName, pkgName, version); err == nil {
+			versionStatus.Yanked = specs.Yanked
+		}
+		if versionStatus.Published > pkgStatus.LastPublished {
+			pkgStatus.LastPublished = versionStatus.Published
+		}
+		pkgStatus.Versions = append(pkgStatus.Versions, versionStatus)
+	}
+	pkgStatus.VersionCount = len(versions)
+	if pkgStatus.Latest, err = latestReleasedVersion(config.registriesDir, config.registryName, pkgName); err != nil {
+		return pkgStatus, err
+	}
+	if pkgStatus.Latest != "" {
+		if specs, err := loadSpecs(config.registriesDir, config.registryName, pkgName, pkgStatus.Latest); err == nil {
+			pkgStatus.Description = specs.Description
+		}
+	}
+	return pkgStatus, nil
+}
+
+// versionPublicationDates returns the local commit date (RFC 3339) of the registry commit that added
+// the specs.json of each version of a package, so that dates compare as strings
+func versionPublicationDates(ctx context.Context, registriesDir, registryName, pkgName string) (map[string]string, error) {
+	registryDir := filepath.Join(registriesDir, registryName)
+	packagePath := filepath.Join(strings.ToUpper(string(pkgName[0])), pkgName)
+	output, err := GitCommand(ctx, registryDir, "log", "--diff-filter=A", "--name-only", "--date=iso-strict-local", "--format=date %cd", "--", packagePath)
+	if err != nil {
+		return nil, wrapGitError(registryDir, fmt.Sprintf("failed to read the history of package '%s'", pkgName), err)
+	}
+	dates := make(map[string]string)
+	date := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "date ") {
+			date = strings.TrimPrefix(line, "date ")
+			continue
+		}
+		rel, err := filepath.Rel(packagePath, filepath.FromSlash(line))
+		if err != nil || filepath.Base(rel) != "specs.json" {
+			continue
+		}
+		// The log lists the newest commits first; keep the oldest commit that added the file
+		dates[filepath.Dir(rel)] = date
+	}
+	return dates, nil
+}
+
+// publishedDay returns the date part of an RFC 3339 timestamp
+func publishedDay(timestamp string) string {
+	if len(timestamp) >= len("2006-01-02") {
+		return timestamp[:len("2006-01-02")]
+	}
+	return timestamp
+}
+
 // printRegistryStatus displays the registry's package information
-func printRegistryStatus(config *statusRegistryConfig) {
+func printRegistryStatus(config *statusRegistryConfig, status registryStatus) {
 	fmt.Printf("Registry Status for '%s':\n", config.registryName)
-	if len(config.registry.Packages) == 0 {
+	if len(status.Packages) == 0 {
 		fmt.Println("  No packages registered.")
-	} else {
-		fmt.Println("  Packages:")
-		for pkgName, pkgInfo := range config.registry.Packages {
-			fmt.Printf("    - %s (UUID: %s)\n", pkgName, pkgInfo.UUID)
+		return
+	}
+	fmt.Println("  Packages:")
+	start := (config.listing.page - 1) * config.listing.limit
+	for _, pkg := range status.Packages {
+		line := fmt.Sprintf("    - %s (UUID: %s)", pkg.Name, pkg.UUID)
+		if pkg.VersionCount == 0 {
+			line += ", no versions"
+		} else {
+			line += fmt.Sprintf(", %d version(s), latest %s, last published %s", pkg.VersionCount, pkg.Latest, publishedDay(pkg.LastPublished))
+		}
+		if pkg.Description != "" {
+			line += ": " + pkg.Description
+		}
+		fmt.Println(line)
+	}
+	if footer := config.listing.pageFooter(start, start+len(status.Packages), status.Total); footer != "" {
+		fmt.Println("  " + footer)
+	}
+}
+
+// printPackageHistory displays a package with all its versions
+func printPackageHistory(config *statusRegistryConfig, pkg registryPackageStatus) {
+	fmt.Printf("Package '%s' in registry '%s':\n", pkg.Name, config.registryName)
+	fmt.Printf("  UUID: %s\n", pkg.UUID)
+	fmt.Printf("  Git URL: %s\n", pkg.GitURL)
+	if pkg.Description != "" {
+		fmt.Printf("  Description: %s\n", pkg.Description)
+	}
+	if len(pkg.Versions) == 0 {
+		fmt.Println("  No versions registered.")
+		return
+	}
+	fmt.Println("  Versions:")
+	for _, version := range pkg.Versions {
+		line := fmt.Sprintf("    - %s published %s", version.Version, publishedDay(version.Published))
+		if version.Yanked {
+			line += " (yanked)"
 		}
+		fmt.Println(line)
 	}
 }
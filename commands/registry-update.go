@@ -1,20 +1,26 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"fmt"
-	"os"
+	"sync"
 
 	"github.com/spf13/cobra"
 )
 
 // RegistryUpdate updates and synchronizes a registry or all registries with their remotes
 func RegistryUpdate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	all, _ := cmd.Flags().GetBool("all")
 	if all && len(args) != 0 {
 		return fmt.Errorf("no arguments allowed with --all flag")
 	}
 	if !all && len(args) != 1 {
-		return fmt.Errorf("exactly one argument required (e.g., cosm registry update <registry_name>)")
+		return validationError("exactly one argument required (e.g., cosm registry update <registry_name>)")
+	}
+	if currentConfig().Offline {
+		return fmt.Errorf("cannot update registries in offline mode")
 	}
 
 	cosmDir, err := getCosmDir()
@@ -26,26 +32,49 @@ func RegistryUpdate(cmd *cobra.Command, args []string) error {
 	if all {
 		registryNames, err := loadRegistryNames(registriesDir)
 		if err != nil {
-			return fmt.Errorf("failed to load registry names: %v", err)
+			return fmt.Errorf("failed to load registry names: %w", err)
 		}
 		if len(registryNames) == 0 {
-			fmt.Println("No registries to update.")
+			logging.Infof("No registries to update.")
 			return nil
 		}
-		for _, name := range registryNames {
-			if err := updateSingleRegistry(registriesDir, name); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to update registry '%s': %v\n", name, err)
+		errs := updateRegistries(ctx, registriesDir, registryNames, currentConfig().Parallelism)
+		for i, name := range registryNames {
+			if errs[i] != nil {
+				logging.Errorf("failed to update registry '%s': %v", name, errs[i])
 				continue
 			}
-			fmt.Printf("Updated registry '%s'\n", name)
+			logging.Infof("Updated registry '%s'", name)
 		}
 		return nil
 	}
 
 	registryName := args[0]
-	if err := updateSingleRegistry(registriesDir, registryName); err != nil {
+	if err := updateSingleRegistry(ctx, registriesDir, registryName); err != nil {
 		return err
 	}
-	fmt.Printf("Updated registry '%s'\n", registryName)
+	logging.Infof("Updated registry '%s'", registryName)
 	return nil
 }
+
+// updateRegistries updates the registries with at most parallelism updates running at once and
+// returns the error of each registry in the order of registryNames
+func updateRegistries(ctx context.Context, registriesDir string, registryNames []string, parallelism int) []error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	errs := make([]error, len(registryNames))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, name := range registryNames {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = updateSingleRegistry(ctx, registriesDir, name)
+		}(i, name)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"cosm/logging"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// RegistryWebhookAdd adds a URL that is notified when a version is published to a registry
+func RegistryWebhookAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 2 {
+		return validationError("requires a registry name and a URL (e.g., cosm registry webhook add <registry> <url>)")
+	}
+	if err := validateWebhookURL(args[1]); err != nil {
+		return err
+	}
+	unlock, err := lockRegistry(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := loadMirrorConfig(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if contains(config.registry.Webhooks, args[1]) {
+		return conflictError("webhook '%s' already exists for registry '%s'", args[1], config.registryName)
+	}
+	config.registry.Webhooks = append(config.registry.Webhooks, args[1])
+	if err := saveRegistryMetadata(config.registry, config.registryFile); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Added webhook %s", args[1])
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return err
+	}
+	logging.Infof("Added webhook '%s' to registry '%s'", args[1], config.registryName)
+	return nil
+}
+
+// RegistryWebhookRm removes a webhook from a registry
+func RegistryWebhookRm(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 2 {
+		return validationError("requires a registry name and a URL (e.g., cosm registry webhook rm <registry> <url>)")
+	}
+	unlock, err := lockRegistry(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := loadMirrorConfig(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if !contains(config.registry.Webhooks, args[1]) {
+		return notFoundError("webhook '%s' not found for registry '%s'", args[1], config.registryName)
+	}
+	config.registry.Webhooks = removeString(config.registry.Webhooks, args[1])
+	if len(config.registry.Webhooks) == 0 {
+		config.registry.Webhooks = nil
+	}
+	if err := saveRegistryMetadata(config.registry, config.registryFile); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Removed webhook %s", args[1])
+	if err := commitAndPushRegistryChanges(ctx, config.registriesDir, config.registryName, commitMsg); err != nil {
+		return err
+	}
+	logging.Infof("Removed webhook '%s' from registry '%s'", args[1], config.registryName)
+	return nil
+}
+
+// RegistryWebhookList prints the webhooks of a registry
+func RegistryWebhookList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 1 {
+		return validationError("requires a registry name (e.g., cosm registry webhook list <registry>)")
+	}
+	config, err := loadMirrorConfig(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Webhooks for registry '%s':\n", config.registryName)
+	if len(config.registry.Webhooks) == 0 {
+		fmt.Println("  No webhooks.")
+		return nil
+	}
+	for _, webhook := range config.registry.Webhooks {
+		fmt.Printf("  - %s\n", webhook)
+	}
+	return nil
+}
@@ -1,142 +1,404 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 )
 
+// ReleaseOptions describes a release of a project
+type ReleaseOptions struct {
+	ProjectDir string   // Root of the project repository; the current directory if empty
+	Version    string   // v<version> to release, or empty to bump the current version
+	Bump       string   // patch, minor or major, used when Version is empty
+	Package    string   // Subdirectory of the package in a monorepo
+	Registries []string // Registries to publish the release to
+	Register   string   // Registry to register the package in, with all its versions including the release
+	DryRun     bool     // Validate the release and return it without changing anything
+	Force      bool     // Publish even if the author is not a maintainer of the package
+
+	// AllowPathDeps releases a project with path dependencies; they are published as dependencies
+	// on the versions recorded in Project.json
+	AllowPathDeps bool
+
+	// Notes are the release notes, stored as the message of an annotated release tag
+	Notes string
+
+	// Branch is the branch to release from; the default branch of the remote if empty
+	Branch string
+
+	// Sign creates a signed release tag with the signing key of the Git configuration
+	Sign bool
+
+	// SkipChecks releases without running the checks of Project.json
+	SkipChecks bool
+
+	// Strict refuses to release a project with dependencies pinned to commits; otherwise they are
+	// published as dependencies on the versions recorded in Project.json, with a warning
+	Strict bool
+}
+
+// ReleaseResult is a published release, or the planned release of a dry run
+type ReleaseResult struct {
+	Name            string
+	PreviousVersion string
+	Version         string
+	Tag             string
+	Branch          string
+	Remote          string // Git remote the branch and tag are pushed to
+	ProjectFile     string // Project.json or cosm.toml relative to the repository root
+	Registries      []string
+	Register        string // Registry the package is registered in, if any
+	Notes           string
+	Signed          bool
+	Checks          []releaseCheck // Checks of Project.json that are run before tagging
+}
+
 // releaseConfig holds configuration for releasing a new project version
 type releaseConfig struct {
-	projectDir  string
-	project     *types.Project
-	newVersion  string
-	patch       bool
-	minor       bool
-	major       bool
-	projectFile string
+	projectDir    string
+	project       *types.Project
+	prevVersion   string
+	newVersion    string
+	projectFile   string
+	subdir        string   // Package subdirectory within a monorepo
+	tag           string   // Release tag, <version> or <name>/<version> for monorepo packages
+	registryNames []string // Target registries, including register
+	register      string   // Registry to register the package in with the release
+	dryRun        bool
+	force         bool              // Publish even if the author is not a maintainer of the package
+	notes         string            // Message of the annotated release tag; the tag is lightweight if empty
+	sign          bool              // Sign the release tag
+	branch        string            // Branch the release is made from and pushed to
+	prevHead      string            // project HEAD before the release, used for rollback
+	registryHeads map[string]string // registry HEADs before the release, used for rollback
 }
 
 // Release updates the project version and publishes it to the remote repository
+// and the target registries
 func Release(cmd *cobra.Command, args []string) error {
-	// Parse arguments and initialize config
-	config, err := parseReleaseArgs(cmd, args)
+	ctx := cmd.Context()
+	opts, err := parseReleaseArgs(cmd, args)
 	if err != nil {
 		return err
 	}
+	result, err := ReleaseVersion(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		printReleasePlan(result)
+		return nil
+	}
+	logging.Infof("Released version '%s' for project '%s'", result.Version, result.Name)
+	return nil
+}
+
+// ReleaseVersion tags a new version of a project and publishes it to its remote repository and
+// the target registries. All local changes are prepared before anything is pushed, and local
+// commits and tags that were not pushed are rolled back on failure.
+func ReleaseVersion(ctx context.Context, opts ReleaseOptions) (ReleaseResult, error) {
+	// Initialize config
+	config, err := newReleaseConfig(opts)
+	if err != nil {
+		return ReleaseResult{}, err
+	}
+
+	if err := validatePathDependencies(config.project, opts.AllowPathDeps); err != nil {
+		return ReleaseResult{}, err
+	}
+	if err := validatePinnedDependencies(config.project, opts.Strict); err != nil {
+		return ReleaseResult{}, err
+	}
+	if err := validateFeatures(config.project); err != nil {
+		return ReleaseResult{}, err
+	}
 
 	// Validate repository state
-	if err := validateRepositoryState(config); err != nil {
-		return err
+	if err := validateRepositoryState(ctx, config); err != nil {
+		return ReleaseResult{}, err
 	}
 
 	// Validate new version
-	if err := validateReleaseVersion(config); err != nil {
-		return err
+	if err := validateReleaseVersion(ctx, config); err != nil {
+		return ReleaseResult{}, err
+	}
+	if config.sign {
+		if err := checkSigningConfig(ctx, config.projectDir); err != nil {
+			return ReleaseResult{}, err
+		}
 	}
 
-	// Update project version and commit
-	if err := updateProjectVersion(config); err != nil {
-		return err
+	// Run the checks of the package before anything is tagged; a dry run only lists them
+	checks := releaseChecks(config.project)
+	if opts.SkipChecks {
+		checks = nil
+	}
+	if !config.dryRun {
+		if err := runReleaseChecks(ctx, filepath.Join(config.projectDir, config.subdir), checks); err != nil {
+			return ReleaseResult{}, err
+		}
 	}
 
-	// Publish to Git remote
-	if err := publishToGitRemote(config); err != nil {
-		return err
+	// Lock the target registries until they are published
+	unlock, err := lockRegistries(ctx, config.registryNames)
+	if err != nil {
+		return ReleaseResult{}, err
 	}
+	defer unlock()
 
-	fmt.Printf("Released version '%s' for project '%s'\n", config.newVersion, config.project.Name)
-	return nil
-}
+	// Validate the target registries, if any
+	if err := validateReleaseRegistries(ctx, config); err != nil {
+		return ReleaseResult{}, err
+	}
 
-// parseReleaseArgs parses arguments and flags to initialize the release config
-func parseReleaseArgs(cmd *cobra.Command, args []string) (*releaseConfig, error) {
-	projectDir, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get project directory: %v", err)
+	result := ReleaseResult{
+		Name:            config.project.Name,
+		PreviousVersion: config.prevVersion,
+		Version:         config.newVersion,
+		Tag:             config.tag,
+		Branch:          config.branch,
+		Remote:          gitRemote(ctx, config.projectDir),
+		ProjectFile:     filepath.Join(config.subdir, filepath.Base(config.projectFile)),
+		Registries:      config.registryNames,
+		Register:        config.register,
+		Notes:           config.notes,
+		Signed:          config.sign,
+		Checks:          checks,
 	}
-	projectFile := filepath.Join(projectDir, "Project.json")
-	project, err := loadProject(projectFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load %s: %v", projectFile, err)
+
+	// In dry-run mode, stop before changing anything
+	if config.dryRun {
+		return result, nil
 	}
 
-	config := &releaseConfig{
-		projectDir:  projectDir,
-		project:     project,
-		projectFile: projectFile,
+	// Prepare all local changes: project commit, tag, and registry commits
+	if err := prepareRelease(ctx, config); err != nil {
+		return ReleaseResult{}, rollbackRelease(ctx, config, err, true)
+	}
+
+	// Publish to Git remote
+	if err := publishToGitRemote(ctx, config); err != nil {
+		return ReleaseResult{}, err
+	}
+
+	// Publish to the registries
+	if err := publishToRegistries(ctx, config); err != nil {
+		return ReleaseResult{}, err
+	}
+	return result, nil
+}
+
+// parseReleaseArgs parses arguments and flags into release options
+func parseReleaseArgs(cmd *cobra.Command, args []string) (ReleaseOptions, error) {
+	opts := ReleaseOptions{}
+	opts.Package, _ = cmd.Flags().GetString("package")
+	opts.Registries, _ = cmd.Flags().GetStringSlice("registry")
+	opts.Register, _ = cmd.Flags().GetString("register")
+	opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	opts.AllowPathDeps, _ = cmd.Flags().GetBool("allow-path-deps")
+	opts.Strict, _ = cmd.Flags().GetBool("strict")
+	opts.Notes, _ = cmd.Flags().GetString("notes")
+	opts.Sign, _ = cmd.Flags().GetBool("sign")
+	opts.Branch, _ = cmd.Flags().GetString("branch")
+	opts.SkipChecks, _ = cmd.Flags().GetBool("skip-checks")
+	if notesFile, _ := cmd.Flags().GetString("notes-file"); notesFile != "" {
+		if opts.Notes != "" {
+			return ReleaseOptions{}, validationError("--notes and --notes-file cannot be combined")
+		}
+		data, err := os.ReadFile(notesFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return ReleaseOptions{}, notFoundError("notes file %s not found", notesFile)
+			}
+			return ReleaseOptions{}, fmt.Errorf("failed to read notes file %s: %w", notesFile, err)
+		}
+		opts.Notes = string(data)
 	}
 
 	if len(args) == 1 {
-		config.newVersion = args[0]
-		return config, nil
+		opts.Version = args[0]
+		return opts, nil
 	}
 	if len(args) > 1 {
-		return nil, fmt.Errorf("too many arguments: use 'cosm release v<version>' or a version flag (--patch, --minor, --major)")
+		return ReleaseOptions{}, fmt.Errorf("too many arguments: use 'cosm release v<version>' or a version flag (--patch, --minor, --major)")
+	}
+	for _, bump := range []string{"patch", "minor", "major"} {
+		if set, _ := cmd.Flags().GetBool(bump); set {
+			if opts.Bump != "" {
+				return ReleaseOptions{}, fmt.Errorf("only one of --patch, --minor, or --major can be specified")
+			}
+			opts.Bump = bump
+		}
+	}
+	if opts.Bump == "" {
+		return ReleaseOptions{}, fmt.Errorf("specify a version (e.g., v1.2.3) or use --patch, --minor, or --major")
 	}
+	return opts, nil
+}
 
-	config.patch, _ = cmd.Flags().GetBool("patch")
-	config.minor, _ = cmd.Flags().GetBool("minor")
-	config.major, _ = cmd.Flags().GetBool("major")
-	count := 0
-	if config.patch {
-		count++
+// newReleaseConfig loads the project and determines the new version and tag of a release
+func newReleaseConfig(opts ReleaseOptions) (*releaseConfig, error) {
+	projectDir, err := filepath.Abs(opts.ProjectDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project directory: %w", err)
 	}
-	if config.minor {
-		count++
+	subdir, err := cleanSubdir(opts.Package)
+	if err != nil {
+		return nil, err
 	}
-	if config.major {
-		count++
+	projectFile := projectFilePath(filepath.Join(projectDir, subdir, "Project.json"))
+	project, err := loadProject(projectFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", projectFile, err)
+	}
+
+	config := &releaseConfig{
+		projectDir:    projectDir,
+		project:       project,
+		prevVersion:   project.Version,
+		projectFile:   projectFile,
+		subdir:        subdir,
+		registryNames: opts.Registries,
+		register:      opts.Register,
+		dryRun:        opts.DryRun,
+		force:         opts.Force,
+		notes:         strings.TrimSpace(opts.Notes),
+		sign:          opts.Sign,
+		branch:        opts.Branch,
 	}
-	if count > 1 {
-		return nil, fmt.Errorf("only one of --patch, --minor, or --major can be specified")
+	if opts.Register != "" {
+		if contains(opts.Registries, opts.Register) {
+			return nil, validationError("registry '%s' is given with both --registry and --register", opts.Register)
+		}
+		config.registryNames = append(append([]string{}, opts.Registries...), opts.Register)
 	}
-	if count == 0 {
-		return nil, fmt.Errorf("specify a version (e.g., v1.2.3) or use --patch, --minor, or --major")
+	if opts.Version != "" {
+		if opts.Bump != "" {
+			return nil, fmt.Errorf("specify either a version or a version bump, not both")
+		}
+		config.newVersion = opts.Version
+		config.tag = releaseTagPrefix(project.Name, subdir) + config.newVersion
+		return config, nil
 	}
 
 	currentSemVer, err := ParseSemVer(project.Version)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse current version '%s': %v", project.Version, err)
+		return nil, fmt.Errorf("failed to parse current version '%s': %w", project.Version, err)
 	}
-	switch {
-	case config.patch:
-		config.newVersion = fmt.Sprintf("v%d.%d.%d", currentSemVer.Major, currentSemVer.Minor, currentSemVer.Patch+1)
-	case config.minor:
+	switch opts.Bump {
+	case "patch":
+		if currentSemVer.Prerelease != "" {
+			// A patch release of a prerelease finalizes it (e.g., v2.0.0-beta.1 -> v2.0.0)
+			config.newVersion = fmt.Sprintf("v%d.%d.%d", currentSemVer.Major, currentSemVer.Minor, currentSemVer.Patch)
+		} else {
+			config.newVersion = fmt.Sprintf("v%d.%d.%d", currentSemVer.Major, currentSemVer.Minor, currentSemVer.Patch+1)
+		}
+	case "minor":
 		config.newVersion = fmt.Sprintf("v%d.%d.0", currentSemVer.Major, currentSemVer.Minor+1)
-	case config.major:
+	case "major":
 		config.newVersion = fmt.Sprintf("v%d.0.0", currentSemVer.Major+1)
+	case "":
+		return nil, fmt.Errorf("specify a version (e.g., v1.2.3) or a version bump (patch, minor or major)")
+	default:
+		return nil, validationError("invalid version bump '%s' (must be patch, minor or major)", opts.Bump)
 	}
+	config.tag = releaseTagPrefix(project.Name, subdir) + config.newVersion
 	return config, nil
 }
 
-// validateRepositoryState ensures the repository is clean and in sync with origin
-func validateRepositoryState(config *releaseConfig) error {
-	if err := ensureNoUncommittedChanges(config.projectDir); err != nil {
-		return fmt.Errorf("repository has uncommitted changes in %s: %v", config.projectDir, err)
+// validatePathDependencies refuses to release a project with path dependencies, whose local trees
+// are not available to the users of the release, unless allowed
+func validatePathDependencies(project *types.Project, allow bool) error {
+	pathDeps := pathDependencies(project)
+	if len(pathDeps) == 0 {
+		return nil
+	}
+	if allow {
+		for _, dep := range pathDeps {
+			logging.Warnf("path dependency '%s' at %s is published as version %s", dep.Name, dep.Path, dep.Version)
+		}
+		return nil
+	}
+	names := make([]string, len(pathDeps))
+	for i, dep := range pathDeps {
+		names[i] = fmt.Sprintf("'%s' at %s", dep.Name, dep.Path)
+	}
+	return validationError("project '%s' has path dependencies: %s; release them and add them from a registry, or use --allow-path-deps to publish their recorded versions", project.Name, strings.Join(names, ", "))
+}
+
+// validatePinnedDependencies refuses to release a project with dependencies pinned to commits in
+// strict mode; otherwise it warns that their recorded versions are published instead
+func validatePinnedDependencies(project *types.Project, strict bool) error {
+	var pinned []string
+	for _, dep := range selectGroups(project, publishedGroups(project)).Deps {
+		if dep.SHA1 == "" {
+			continue
+		}
+		if !strict {
+			logging.Warnf("dependency '%s' is pinned to commit %s; it is published as version %s", dep.Name, dep.SHA1[:7], dep.Version)
+		}
+		pinned = append(pinned, fmt.Sprintf("'%s' at %s", dep.Name, dep.SHA1[:7]))
+	}
+	if len(pinned) == 0 || !strict {
+		return nil
+	}
+	sort.Strings(pinned)
+	return validationError("project '%s' has dependencies pinned to commits: %s; add released versions of them, or release without --strict to publish their recorded versions", project.Name, strings.Join(pinned, ", "))
+}
+
+// validateRepositoryState ensures the repository is clean and in sync with its remote
+func validateRepositoryState(ctx context.Context, config *releaseConfig) error {
+	if err := ensureNoUncommittedChanges(ctx, config.projectDir); err != nil {
+		return fmt.Errorf("repository has uncommitted changes in %s: %w", config.projectDir, err)
+	}
+	branch, err := getCurrentBranch(ctx, config.projectDir)
+	if err != nil {
+		return fmt.Errorf("failed to get current branch in %s: %w", config.projectDir, err)
+	}
+	// Release from the default branch of the remote, or the branch given with --branch
+	if config.branch == "" {
+		config.branch = defaultBranch(ctx, config.projectDir)
+	}
+	if config.branch == "" {
+		config.branch = branch
 	}
-	if err := ensureLocalRepoInSyncWithOrigin(config.projectDir); err != nil {
-		return fmt.Errorf("repository is not in sync with origin in %s: %v", config.projectDir, err)
+	if branch != config.branch {
+		return validationError("releases are made from branch '%s', but '%s' is checked out in %s (check out '%s', or release from '%s' with --branch %s)", config.branch, branch, config.projectDir, config.branch, branch, branch)
+	}
+	if err := ensureLocalRepoInSyncWithRemote(ctx, config.projectDir, config.branch); err != nil {
+		return fmt.Errorf("repository is not in sync with its remote in %s: %w", config.projectDir, err)
+	}
+	config.prevHead, err = getHeadSHA(ctx, config.projectDir)
+	if err != nil {
+		return err
 	}
 	return nil
 }
 
 // validateReleaseVersion validates the new version and ensures the tag doesn’t exist
-func validateReleaseVersion(config *releaseConfig) error {
+func validateReleaseVersion(ctx context.Context, config *releaseConfig) error {
 	if err := validateNewVersion(config.newVersion, config.project.Version); err != nil {
 		return err
 	}
-	if err := ensureTagDoesNotExist(config.projectDir, config.newVersion); err != nil {
-		return fmt.Errorf("failed to validate tag '%s' in %s: %v", config.newVersion, config.projectDir, err)
+	if err := ensureTagDoesNotExist(ctx, config.projectDir, config.tag); err != nil {
+		return fmt.Errorf("failed to validate tag '%s' in %s: %w", config.tag, config.projectDir, err)
 	}
 	return nil
 }
 
 // updateProjectVersion updates Project.json with the new version and commits the change
-func updateProjectVersion(config *releaseConfig) error {
+func updateProjectVersion(ctx context.Context, config *releaseConfig) error {
 	if config.newVersion == config.project.Version {
 		// No change needed, skip write and commit
 		return nil
@@ -144,53 +406,405 @@ func updateProjectVersion(config *releaseConfig) error {
 
 	config.project.Version = config.newVersion
 	if err := saveProject(config.project, config.projectFile); err != nil {
-		return fmt.Errorf("failed to save %s: %v", config.projectFile, err)
+		return fmt.Errorf("failed to save %s: %w", config.projectFile, err)
 	}
 
-	if err := stageFiles(config.projectDir, "Project.json"); err != nil {
-		return fmt.Errorf("failed to stage %s in %s: %v", config.projectFile, config.projectDir, err)
+	if err := stageFiles(ctx, config.projectDir, filepath.Join(config.subdir, filepath.Base(config.projectFile))); err != nil {
+		return fmt.Errorf("failed to stage %s in %s: %w", config.projectFile, config.projectDir, err)
 	}
 
-	commitMsg := fmt.Sprintf("Release %s", config.newVersion)
-	if err := commitChanges(config.projectDir, commitMsg); err != nil {
-		return fmt.Errorf("failed to commit release '%s' in %s: %v", config.newVersion, config.projectDir, err)
+	commitMsg := fmt.Sprintf("Release %s", config.tag)
+	if err := commitChanges(ctx, config.projectDir, commitMsg); err != nil {
+		return fmt.Errorf("failed to commit release '%s' in %s: %w", config.newVersion, config.projectDir, err)
 	}
 
 	return nil
 }
 
-// publishToGitRemote tags and pushes the release to the remote repository
-func publishToGitRemote(config *releaseConfig) error {
-	// Tag the version
-	if err := createTag(config.projectDir, config.newVersion); err != nil {
-		return fmt.Errorf("failed to create tag '%s' in %s: %v", config.newVersion, config.projectDir, err)
+// releaseCheck is a check of Project.json, named build, test or lint
+type releaseCheck struct {
+	Name    string
+	Command string
+}
+
+// releaseChecks returns the configured checks of a project in the order they are run
+func releaseChecks(project *types.Project) []releaseCheck {
+	if project.Checks == nil {
+		return nil
 	}
+	var checks []releaseCheck
+	for _, check := range []releaseCheck{
+		{"build", project.Checks.Build},
+		{"test", project.Checks.Test},
+		{"lint", project.Checks.Lint},
+	} {
+		if strings.TrimSpace(check.Command) != "" {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
 
-	// Get the current branch
-	branch, err := getCurrentBranch(config.projectDir)
-	if err != nil {
-		return fmt.Errorf("failed to get current branch in %s: %v", config.projectDir, err)
+// runReleaseChecks runs the checks with the shell in the package root, stopping at the first that fails
+func runReleaseChecks(ctx context.Context, packageDir string, checks []releaseCheck) error {
+	shell := []string{"sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/C"}
 	}
+	for _, check := range checks {
+		logging.Infof("Running the %s check: %s", check.Name, check.Command)
+		if _, err := runCommand(ctx, packageDir, append(shell, check.Command)...); err != nil {
+			return fmt.Errorf("%s check failed, nothing was released (use --skip-checks to release anyway): %w", check.Name, err)
+		}
+	}
+	return nil
+}
 
+// prepareRelease creates the release commit and tag in the project and commits the new version
+// to each target registry, without pushing anything
+func prepareRelease(ctx context.Context, config *releaseConfig) error {
+	if err := updateProjectVersion(ctx, config); err != nil {
+		return err
+	}
+	if err := createTag(ctx, config.projectDir, config.tag, config.notes, config.sign); err != nil {
+		return fmt.Errorf("failed to create tag '%s' in %s: %w", config.tag, config.projectDir, err)
+	}
+	for _, registryName := range config.registryNames {
+		if err := prepareRegistryRelease(ctx, config, registryName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishToGitRemote pushes the release commit and tag to the remote repository
+func publishToGitRemote(ctx context.Context, config *releaseConfig) error {
 	// Push to the current branch
-	if err := pushToRemote(config.projectDir, branch, true); err != nil {
+	if err := pushToRemote(ctx, config.projectDir, config.branch, true); err != nil {
+		return rollbackRelease(ctx, config, err, true)
+	}
+
+	// Push the tag; the release commit is already on the remote at this point
+	if err := pushToRemote(ctx, config.projectDir, config.tag, false); err != nil {
+		return rollbackRelease(ctx, config, err, false)
+	}
+	return nil
+}
+
+// publishToRegistries pushes the prepared registry commits to all target registries concurrently
+// and reports the result of each registry. The registries whose push failed are rolled back; the
+// others stay published.
+func publishToRegistries(ctx context.Context, config *releaseConfig) error {
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
 		return err
 	}
+	errs := pushRegistries(ctx, registriesDir, config.registryNames, releaseParallelism(config))
+	var failed []string
+	for i, registryName := range config.registryNames {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("'%s'", registryName))
+			logging.Warnf("failed to publish version '%s' of package '%s' to registry '%s': %v", config.newVersion, config.project.Name, registryName, errs[i])
+			// Roll back even if the release was cancelled
+			if resetErr := resetHard(context.WithoutCancel(ctx), filepath.Join(registriesDir, registryName), config.registryHeads[registryName]); resetErr != nil {
+				logging.Warnf("failed to roll back registry '%s': %v", registryName, resetErr)
+			}
+			continue
+		}
+		if registryName == config.register {
+			logging.Infof("Registered package '%s' with version '%s' in registry '%s'", config.project.Name, config.newVersion, registryName)
+		} else {
+			logging.Infof("Added version '%s' of package '%s' to registry '%s'", config.newVersion, config.project.Name, registryName)
+		}
+		notifyWebhooks(ctx, registriesDir, registryName, config.project.Name, []string{config.newVersion})
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("released version '%s' but failed to publish to registry %s (retry with 'cosm registry add <registry> %s %s')", config.newVersion, failed[0], config.project.Name, config.newVersion)
+	default:
+		return fmt.Errorf("released version '%s' but failed to publish to registries %s (retry with 'cosm registry add <registry> %s %s')", config.newVersion, strings.Join(failed, ", "), config.project.Name, config.newVersion)
+	}
+}
 
-	// Push the tag
-	return pushToRemote(config.projectDir, config.newVersion, false)
+// releaseParallelism returns the number of target registries that a release updates and publishes to
+// at once: all of them, unless the parallelism setting limits it
+func releaseParallelism(config *releaseConfig) int {
+	if parallelism := currentConfig().Parallelism; parallelism > 0 {
+		return parallelism
+	}
+	return len(config.registryNames)
+}
+
+// pushRegistries pushes the registries with at most parallelism pushes running at once and returns
+// the error of each registry in the order of registryNames
+func pushRegistries(ctx context.Context, registriesDir string, registryNames []string, parallelism int) []error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	errs := make([]error, len(registryNames))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, name := range registryNames {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = pushRegistryChanges(ctx, registriesDir, name)
+		}(i, name)
+	}
+	wg.Wait()
+	return errs
+}
+
+// rollbackRelease undoes local release changes after a failure. Registry commits and the
+// local tag are always removed; the release commit is only reset when it was not pushed.
+func rollbackRelease(ctx context.Context, config *releaseConfig, cause error, resetProject bool) error {
+	ctx = context.WithoutCancel(ctx) // Roll back even if the release was cancelled
+	registriesDir, err := getRegistriesDir()
+	if err == nil {
+		for name, head := range config.registryHeads {
+			if resetErr := resetHard(ctx, filepath.Join(registriesDir, name), head); resetErr != nil {
+				logging.Warnf("failed to roll back registry '%s': %v", name, resetErr)
+			}
+		}
+	}
+	if tagErr := deleteTag(ctx, config.projectDir, config.tag); tagErr != nil {
+		logging.Warnf("failed to delete tag '%s': %v", config.tag, tagErr)
+	}
+	if resetProject && config.prevHead != "" {
+		if resetErr := resetHard(ctx, config.projectDir, config.prevHead); resetErr != nil {
+			logging.Warnf("failed to roll back release commit in %s: %v", config.projectDir, resetErr)
+		}
+	}
+	return fmt.Errorf("release of '%s' failed and local changes were rolled back: %v", config.newVersion, cause)
 }
 
 // ensureTagDoesNotExist checks if the new version tag already exists in the repo
-func ensureTagDoesNotExist(projectDir, newVersion string) error {
-	tags, err := listTags(projectDir)
+func ensureTagDoesNotExist(ctx context.Context, projectDir, newVersion string) error {
+	tags, err := listTags(ctx, projectDir)
 	if err != nil {
-		return fmt.Errorf("failed to list tags in %s: %v", projectDir, err)
+		return fmt.Errorf("failed to list tags in %s: %w", projectDir, err)
 	}
 	for _, tag := range tags {
 		if tag == newVersion {
-			return fmt.Errorf("tag '%s' already exists in the repository", newVersion)
+			return conflictError("tag '%s' already exists in the repository", newVersion)
+		}
+	}
+	return nil
+}
+
+// validateReleaseRegistries checks that the package is registered in each target registry
+// and that the new version has not been published there yet, or for the registry given with
+// --register that the package is not registered there yet
+func validateReleaseRegistries(ctx context.Context, config *releaseConfig) error {
+	if len(config.registryNames) == 0 {
+		return nil
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	for _, registryName := range config.registryNames {
+		if err := assertRegistryWritable(registriesDir, registryName); err != nil {
+			return err
+		}
+	}
+	errs := updateRegistries(ctx, registriesDir, config.registryNames, releaseParallelism(config))
+	for i, registryName := range config.registryNames {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+		if err != nil {
+			return err
+		}
+		pkgInfo, exists := registry.Packages[config.project.Name]
+		if registryName == config.register {
+			if exists {
+				return conflictError("package '%s' is already registered in registry '%s' (use --registry to publish the release to it)", config.project.Name, registryName)
+			}
+			continue
+		}
+		if !exists {
+			return fmt.Errorf("package '%s' is not registered in registry '%s' (run 'cosm registry add' first, or release with --register %s)", config.project.Name, registryName, registryName)
+		}
+		if pkgInfo.UUID != config.project.UUID {
+			return fmt.Errorf("package '%s' in registry '%s' has UUID '%s', but Project.json has UUID '%s'", config.project.Name, registryName, pkgInfo.UUID, config.project.UUID)
+		}
+		if pkgInfo.Subdir != config.subdir {
+			return fmt.Errorf("package '%s' in registry '%s' is registered at subdirectory '%s', not '%s'", config.project.Name, registryName, pkgInfo.Subdir, config.subdir)
+		}
+		if err := ensureMaintainer(ctx, pkgInfo, config.project.Name, registryName, config.force); err != nil {
+			return err
+		}
+		versions, err := loadVersions(registriesDir, registryName, config.project.Name)
+		if err != nil {
+			return err
+		}
+		if contains(versions, config.newVersion) {
+			return conflictError("version '%s' of package '%s' is already registered in registry '%s'", config.newVersion, config.project.Name, registryName)
 		}
 	}
 	return nil
 }
+
+// releaseGitURL returns the clone URL recorded in the specs of a new version: the URL under which
+// the package is registered, or the URL of the remote of the project for older registry entries
+func releaseGitURL(ctx context.Context, projectDir string, pkgInfo types.PackageInfo) (string, error) {
+	if pkgInfo.GitURL != "" {
+		return pkgInfo.GitURL, nil
+	}
+	remote := gitRemote(ctx, projectDir)
+	gitURL, err := GitCommand(ctx, projectDir, "remote", "get-url", remote)
+	if err != nil || gitURL == "" {
+		return "", fmt.Errorf("package is registered without a Git URL and the project has no remote '%s'", remote)
+	}
+	return gitURL, nil
+}
+
+// prepareRegistryRelease writes the specs and build list of the new version to a registry
+// and commits them locally, recording the previous registry HEAD for rollback
+func prepareRegistryRelease(ctx context.Context, config *releaseConfig, registryName string) error {
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	registryDir := filepath.Join(registriesDir, registryName)
+	head, err := getHeadSHA(ctx, registryDir)
+	if err != nil {
+		return err
+	}
+	if config.registryHeads == nil {
+		config.registryHeads = make(map[string]string)
+	}
+	config.registryHeads[registryName] = head
+	if registryName == config.register {
+		return prepareRegistryRegistration(ctx, config, registriesDir, registryName)
+	}
+
+	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return err
+	}
+	pkgInfo := registry.Packages[config.project.Name]
+	sha1Output, err := GitCommand(ctx, config.projectDir, "rev-list", "-n", "1", config.tag)
+	if err != nil {
+		return fmt.Errorf("failed to get SHA1 for tag '%s': %w", config.tag, err)
+	}
+	packageDir, err := setupPackageDir(registriesDir, registryName, config.project.Name)
+	if err != nil {
+		return err
+	}
+	gitURL, err := releaseGitURL(ctx, config.projectDir, pkgInfo)
+	if err != nil {
+		return err
+	}
+	sha1 := strings.TrimSpace(sha1Output)
+	if err := addPackageVersion(packageDir, config.project.Name, pkgInfo.UUID, gitURL, config.subdir, pkgInfo.Mirrors, sha1, config.newVersion, config.project, registriesDir, registryName); err != nil {
+		return err
+	}
+	if err := recordChangelog(ctx, config.projectDir, sha1, config.subdir, filepath.Join(packageDir, config.newVersion), config.newVersion); err != nil {
+		return err
+	}
+	if err := recordReleaseNotes(ctx, config.projectDir, config.tag, filepath.Join(packageDir, config.newVersion)); err != nil {
+		return err
+	}
+	if err := recordTagSigner(ctx, config.projectDir, config.tag, filepath.Join(packageDir, config.newVersion)); err != nil {
+		return err
+	}
+	if err := recordPackageDigest(ctx, config.projectDir, sha1, config.subdir, filepath.Join(packageDir, config.newVersion)); err != nil {
+		return err
+	}
+	versions, err := loadVersions(registriesDir, registryName, config.project.Name)
+	if err != nil {
+		return err
+	}
+	versions = append(versions, config.newVersion)
+	if err := savePackageVersions(versions, filepath.Join(packageDir, "versions.json")); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Added version %s of package %s", config.newVersion, config.project.Name)
+	return commitRegistryChanges(ctx, registriesDir, registryName, commitMsg)
+}
+
+// prepareRegistryRegistration registers the package in a registry with all its release tags, like
+// 'cosm registry add', and commits the registry locally. The tags are read from a temporary clone of
+// the project, which has the release tag before it is pushed; the package is registered under the
+// URL of the remote of the project.
+func prepareRegistryRegistration(ctx context.Context, config *releaseConfig, registriesDir, registryName string) error {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	gitURL, err := releaseGitURL(ctx, config.projectDir, types.PackageInfo{})
+	if err != nil {
+		return err
+	}
+	author, err := publishingAuthor(ctx)
+	if err != nil {
+		return err
+	}
+	clonePath, err := clonePackageToTempDir(ctx, cosmDir, config.projectDir, false)
+	if err != nil {
+		return err
+	}
+	defer cleanupTempClone(clonePath)
+	tags, err := validateAndCollectVersionTags(ctx, clonePath, releaseTagPrefix(config.project.Name, config.subdir))
+	if err != nil {
+		return err
+	}
+	packageDir, err := setupPackageDir(registriesDir, registryName, config.project.Name)
+	if err != nil {
+		return err
+	}
+	if err := updatePackageVersions(ctx, packageDir, config.project.Name, config.project.UUID, gitURL, config.subdir, nil, tags, registriesDir, registryName, clonePath); err != nil {
+		return err
+	}
+	registry, registryFile, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil {
+		return err
+	}
+	registry.Packages[config.project.Name] = types.PackageInfo{
+		UUID:        config.project.UUID,
+		GitURL:      gitURL,
+		Subdir:      config.subdir,
+		Maintainers: []string{author},
+	}
+	if err := saveRegistryMetadata(registry, registryFile); err != nil {
+		return err
+	}
+	commitMsg := fmt.Sprintf("Added package %s version %s", config.project.Name, config.newVersion)
+	return commitRegistryChanges(ctx, registriesDir, registryName, commitMsg)
+}
+
+// printReleasePlan prints the actions a release would perform without executing them
+func printReleasePlan(result ReleaseResult) {
+	fmt.Printf("Dry run: release version '%s' for project '%s'\n", result.Version, result.Name)
+	for _, check := range result.Checks {
+		fmt.Printf("  - run the %s check '%s'\n", check.Name, check.Command)
+	}
+	if result.Version != result.PreviousVersion {
+		fmt.Printf("  - update version in %s from '%s' to '%s' and commit 'Release %s'\n", result.ProjectFile, result.PreviousVersion, result.Version, result.Tag)
+	}
+	switch {
+	case result.Signed:
+		fmt.Printf("  - create signed tag '%s'\n", result.Tag)
+	case result.Notes != "":
+		fmt.Printf("  - create tag '%s' annotated with the release notes\n", result.Tag)
+	default:
+		fmt.Printf("  - create tag '%s'\n", result.Tag)
+	}
+	fmt.Printf("  - push branch '%s' to %s\n", result.Branch, result.Remote)
+	fmt.Printf("  - push tag '%s' to %s\n", result.Tag, result.Remote)
+	for _, registryName := range result.Registries {
+		if registryName == result.Register {
+			fmt.Printf("  - register package '%s' with its versions up to '%s' in registry '%s' and push the registry\n", result.Name, result.Version, registryName)
+			continue
+		}
+		fmt.Printf("  - add version '%s' to registry '%s' and push the registry\n", result.Version, registryName)
+	}
+	fmt.Println("No changes were made.")
+}
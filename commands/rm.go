@@ -2,17 +2,22 @@ package commands
 
 import (
 	"bufio"
+	"cosm/logging"
 	"cosm/types"
 	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
-// Rm removes a dependency from the project's Project.json file
+// Rm removes one or more dependencies from the project's Project.json file
 func Rm(cmd *cobra.Command, args []string) error {
-	packageName, err := parseRmArgs(args)
+	unused, _ := cmd.Flags().GetBool("unused")
+	noResolve, _ := cmd.Flags().GetBool("no-resolve")
+	packageNames, err := parseRmArgs(args, unused)
 	if err != nil {
 		return err
 	}
@@ -22,58 +27,78 @@ func Rm(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	keys, deps, err := findDependencyKey(project, packageName)
-	if err != nil {
-		return err
+	var depKeys []string
+	if unused {
+		if depKeys, err = findUnusedDependencies(project, "src"); err != nil {
+			return err
+		}
+		if len(depKeys) == 0 {
+			logging.Infof("No unused dependencies found")
+			return nil
+		}
 	}
-
-	var depKey string
-	if len(keys) > 1 {
-		depKey, err = promptUserForDependency(packageName, keys, deps)
+	for _, packageName := range packageNames {
+		keys, deps, err := findDependencyKey(project, packageName)
 		if err != nil {
 			return err
 		}
-	} else {
-		depKey = keys[0]
-	}
-
-	if err := removeDependency(project, depKey, packageName); err != nil {
-		return err
+		depKey := keys[0]
+		if len(keys) > 1 {
+			if depKey, err = promptUserForDependency(packageName, keys, deps); err != nil {
+				return err
+			}
+		}
+		if !slices.Contains(depKeys, depKey) {
+			depKeys = append(depKeys, depKey)
+		}
 	}
 
-	return nil
+	return removeDependencies(project, depKeys, noResolve)
 }
 
 // parseRmArgs validates the input arguments for the rm command
-func parseRmArgs(args []string) (string, error) {
-	if len(args) != 1 {
-		return "", fmt.Errorf("exactly one argument required (e.g., cosm rm <package_name>)")
+func parseRmArgs(args []string, unused bool) ([]string, error) {
+	if unused {
+		if len(args) > 0 {
+			return nil, validationError("cannot combine package names with --unused")
+		}
+		return nil, nil
+	}
+	if len(args) == 0 {
+		return nil, validationError("at least one argument required (e.g., cosm rm <package_name>)")
 	}
-	packageName := args[0]
-	if packageName == "" {
-		return "", fmt.Errorf("package name cannot be empty")
+	for _, packageName := range args {
+		if packageName == "" {
+			return nil, validationError("package name cannot be empty")
+		}
 	}
-	return packageName, nil
+	return args, nil
 }
 
-// findDependencyKey finds the keys for dependencies by package name
+// findDependencyKey finds the keys for dependencies by package name or alias
 func findDependencyKey(project *types.Project, packageName string) ([]string, []types.Dependency, error) {
 	var keys []string
 	var deps []types.Dependency
 	for key, dep := range project.Deps {
-		if dep.Name == packageName {
+		if dep.Name == packageName || dep.Alias == packageName {
 			keys = append(keys, key)
-			deps = append(deps, dep)
 		}
 	}
 	if len(keys) == 0 {
-		return nil, nil, fmt.Errorf("dependency '%s' not found in project", packageName)
+		return nil, nil, notFoundError("dependency '%s' not found in project", packageName)
+	}
+	sort.Strings(keys) // List the major versions of a package in order
+	for _, key := range keys {
+		deps = append(deps, project.Deps[key])
 	}
 	return keys, deps, nil
 }
 
 // promptUserForDependency prompts the user to select a dependency when multiple have the same name
 func promptUserForDependency(packageName string, keys []string, deps []types.Dependency) (string, error) {
+	if inputDisabled() {
+		return "", inputRequiredError("multiple dependencies named '%s' found (%s); cannot choose one without a prompt", packageName, strings.Join(keys, ", "))
+	}
 	fmt.Printf("Multiple dependencies named '%s' found:\n", packageName)
 	for i, dep := range deps {
 		key := keys[i]
@@ -91,19 +116,35 @@ func promptUserForDependency(packageName string, keys []string, deps []types.Dep
 	choiceNum := 0
 	_, err := fmt.Sscanf(choice, "%d", &choiceNum)
 	if err != nil || choiceNum < 1 || choiceNum > len(deps) {
-		return "", fmt.Errorf("invalid selection '%s': must be a number between 1 and %d", choice, len(deps))
+		return "", validationError("invalid selection '%s': must be a number between 1 and %d", choice, len(deps))
 	}
 	return keys[choiceNum-1], nil
 }
 
-// removeDependency deletes the dependency and saves the project
-func removeDependency(project *types.Project, depKey, packageName string) error {
-	delete(project.Deps, depKey)
+// removeDependencies deletes the dependencies, saves the project once and regenerates its build
+// list unless noResolve is set
+func removeDependencies(project *types.Project, depKeys []string, noResolve bool) error {
+	var names []string
+	for _, depKey := range depKeys {
+		dep := project.Deps[depKey]
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+		names = append(names, name)
+		delete(project.Deps, depKey)
+	}
 
-	if err := saveProject(project, "Project.json"); err != nil {
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	if err := saveProjectAndBuildList(project, "", registriesDir, noResolve); err != nil {
 		return err
 	}
 
-	fmt.Printf("Removed dependency '%s' from project\n", packageName)
+	for _, name := range names {
+		logging.Infof("Removed dependency '%s' from project", name)
+	}
 	return nil
 }
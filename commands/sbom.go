@@ -0,0 +1,354 @@
+package commands
+
+import (
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// sbomComponent is a package in the build list with the metadata recorded in its specs
+type sbomComponent struct {
+	ref       string // Unique reference, <uuid>@<version>
+	dep       types.BuildListDependency
+	license   string
+	dependsOn []string // References of the components it depends on
+}
+
+// cycloneDXDocument is a CycloneDX 1.5 JSON document
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	PURL               string                 `json:"purl,omitempty"`
+	Licenses           []cycloneDXLicense     `json:"licenses,omitempty"`
+	Hashes             []cycloneDXHash        `json:"hashes,omitempty"`
+	ExternalReferences []cycloneDXExternalRef `json:"externalReferences,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	License cycloneDXLicenseName `json:"license"`
+}
+
+type cycloneDXLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// spdxDocument is an SPDX 2.3 JSON document
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxIDInvalidChars matches the characters that are not allowed in SPDX identifiers
+var spdxIDInvalidChars = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// Sbom prints a software bill of materials of the build list of the project in CycloneDX or SPDX format
+func Sbom(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "cyclonedx" && format != "spdx" {
+		return fmt.Errorf("unknown SBOM format '%s' (valid formats: cyclonedx, spdx)", format)
+	}
+	outputFile, _ := cmd.Flags().GetString("output")
+
+	project, err := validateActivate(args)
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	buildList, err := loadCurrentBuildList(project, registriesDir)
+	if err != nil {
+		return err
+	}
+	components, rootDeps := collectSbomComponents(project, &buildList, registriesDir)
+
+	var document interface{}
+	if format == "cyclonedx" {
+		document = cycloneDXSbom(project, components, rootDeps)
+	} else {
+		document = spdxSbom(project, components, rootDeps)
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SBOM: %w", err)
+	}
+	if outputFile == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	if err := os.WriteFile(outputFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputFile, err)
+	}
+	logging.Infof("Wrote %s SBOM of %s with %d package(s) to %s", format, project.Name, len(components), outputFile)
+	return nil
+}
+
+// loadCurrentBuildList loads .cosm/buildlist.json, regenerating it without output if Project.json changed
+func loadCurrentBuildList(project *types.Project, registriesDir string) (types.BuildList, error) {
+	buildListFile := ".cosm/buildlist.json"
+	groups := recordedGroups("")
+	needsBuildList, err := needsBuildListGeneration("", projectBuildListInputs(project, ""), groups)
+	if err != nil {
+		return types.BuildList{}, err
+	}
+	if needsBuildList {
+		if err := os.MkdirAll(".cosm", 0755); err != nil {
+			return types.BuildList{}, fmt.Errorf("failed to create .cosm directory: %w", err)
+		}
+		if err := generateLocalBuildList(project, groups, registriesDir); err != nil {
+			return types.BuildList{}, err
+		}
+	}
+	buildList, err := loadBuildListFile(buildListFile)
+	if err != nil {
+		return types.BuildList{}, fmt.Errorf("failed to load buildlist.json: %w", err)
+	}
+	return buildList, nil
+}
+
+// collectSbomComponents returns the components of the build list sorted by name and version, and
+// the references of the direct dependencies of the project. Licenses and dependencies between
+// components are taken from the specs in the registries, when available.
+func collectSbomComponents(project *types.Project, buildList *types.BuildList, registriesDir string) ([]sbomComponent, []string) {
+	refs := make(map[string]string) // build list key -> component reference
+	for key, dep := range buildList.Dependencies {
+		refs[key] = fmt.Sprintf("%s@%s", dep.UUID, dep.Version)
+	}
+
+	var components []sbomComponent
+	for key, dep := range buildList.Dependencies {
+		component := sbomComponent{ref: refs[key], dep: dep}
+		if specs, _, err := findDependency(dep.Name, dep.Version, dep.UUID, "", registriesDir); err == nil {
+			component.license = specs.License
+			component.dependsOn = dependencyRefs(specs.Deps, refs)
+		}
+		components = append(components, component)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].dep.Name != components[j].dep.Name {
+			return components[i].dep.Name < components[j].dep.Name
+		}
+		return components[i].dep.Version < components[j].dep.Version
+	})
+	return components, dependencyRefs(project.Deps, refs)
+}
+
+// dependencyRefs maps dependencies, keyed by <uuid>@<major version>, to the references of the
+// components selected for them in the build list
+func dependencyRefs(deps map[string]types.Dependency, refs map[string]string) []string {
+	dependsOn := []string{}
+	for key := range deps {
+		if ref, exists := refs[key]; exists {
+			dependsOn = append(dependsOn, ref)
+		}
+	}
+	sort.Strings(dependsOn)
+	return dependsOn
+}
+
+// packageURL returns a generic package URL for a package version
+func packageURL(name, version string) string {
+	return fmt.Sprintf("pkg:generic/%s@%s", name, version)
+}
+
+// cycloneDXSbom builds a CycloneDX document with the project as the described component
+func cycloneDXSbom(project *types.Project, components []sbomComponent, rootDeps []string) cycloneDXDocument {
+	root := cycloneDXComponent{
+		Type:    "application",
+		BOMRef:  fmt.Sprintf("%s@%s", project.UUID, project.Version),
+		Name:    project.Name,
+		Version: project.Version,
+		PURL:    packageURL(project.Name, project.Version),
+	}
+	if project.License != "" {
+		root.Licenses = []cycloneDXLicense{{License: cycloneDXLicenseName{Name: project.License}}}
+	}
+	document := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     cycloneDXTools{Components: []cycloneDXComponent{{Type: "application", Name: "cosm"}}},
+			Component: root,
+		},
+		Components:   []cycloneDXComponent{},
+		Dependencies: []cycloneDXDependency{{Ref: root.BOMRef, DependsOn: rootDeps}},
+	}
+	for _, component := range components {
+		entry := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  component.ref,
+			Name:    component.dep.Name,
+			Version: component.dep.Version,
+			PURL:    packageURL(component.dep.Name, component.dep.Version),
+			Hashes:  []cycloneDXHash{{Alg: "SHA-1", Content: component.dep.SHA1}},
+		}
+		if component.license != "" {
+			entry.Licenses = []cycloneDXLicense{{License: cycloneDXLicenseName{Name: component.license}}}
+		}
+		if component.dep.GitURL != "" {
+			entry.ExternalReferences = []cycloneDXExternalRef{{Type: "vcs", URL: component.dep.GitURL}}
+		}
+		document.Components = append(document.Components, entry)
+		dependsOn := component.dependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		document.Dependencies = append(document.Dependencies, cycloneDXDependency{Ref: component.ref, DependsOn: dependsOn})
+	}
+	return document
+}
+
+// spdxSbom builds an SPDX document that describes the project package
+func spdxSbom(project *types.Project, components []sbomComponent, rootDeps []string) spdxDocument {
+	rootID := spdxPackageID(project.Name, project.Version, project.UUID)
+	document := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s", project.Name, project.Version),
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", spdxIDInvalidChars.ReplaceAllString(project.Name, "-"), uuid.New().String()),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: cosm"},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           rootID,
+			Name:             project.Name,
+			VersionInfo:      project.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  spdxLicense(project.License),
+			ExternalRefs:     []spdxExternalRef{spdxPackageURLRef(project.Name, project.Version)},
+		}},
+		Relationships: []spdxRelationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: rootID}},
+	}
+
+	ids := make(map[string]string) // component reference -> SPDX identifier
+	for _, component := range components {
+		ids[component.ref] = spdxPackageID(component.dep.Name, component.dep.Version, component.dep.UUID)
+	}
+	for _, ref := range rootDeps {
+		document.Relationships = append(document.Relationships, spdxRelationship{SPDXElementID: rootID, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: ids[ref]})
+	}
+	for _, component := range components {
+		downloadLocation := "NOASSERTION"
+		if component.dep.GitURL != "" {
+			downloadLocation = fmt.Sprintf("git+%s@%s", component.dep.GitURL, component.dep.SHA1)
+		}
+		document.Packages = append(document.Packages, spdxPackage{
+			SPDXID:           ids[component.ref],
+			Name:             component.dep.Name,
+			VersionInfo:      component.dep.Version,
+			DownloadLocation: downloadLocation,
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  spdxLicense(component.license),
+			ExternalRefs:     []spdxExternalRef{spdxPackageURLRef(component.dep.Name, component.dep.Version)},
+		})
+		for _, ref := range component.dependsOn {
+			document.Relationships = append(document.Relationships, spdxRelationship{SPDXElementID: ids[component.ref], RelationshipType: "DEPENDS_ON", RelatedSPDXElement: ids[ref]})
+		}
+	}
+	return document
+}
+
+// spdxPackageID returns the SPDX identifier of a package version
+func spdxPackageID(name, version, packageUUID string) string {
+	return "SPDXRef-Package-" + spdxIDInvalidChars.ReplaceAllString(fmt.Sprintf("%s-%s-%s", name, version, packageUUID), "-")
+}
+
+// spdxLicense returns the declared license, or NOASSERTION if the package declares none
+func spdxLicense(license string) string {
+	if license == "" {
+		return "NOASSERTION"
+	}
+	return license
+}
+
+// spdxPackageURLRef returns the package URL reference of a package version
+func spdxPackageURLRef(name, version string) spdxExternalRef {
+	return spdxExternalRef{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: packageURL(name, version)}
+}
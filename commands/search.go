@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// searchResult is a package that matches a search, as printed by cosm search --json
+type searchResult struct {
+	Name        string   `json:"name"`
+	Registry    string   `json:"registry"`
+	Version     string   `json:"version"` // Latest release, or "" if the package has no releases
+	GitURL      string   `json:"giturl"`
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	License     string   `json:"license,omitempty"`
+	Homepage    string   `json:"homepage,omitempty"`
+
+	versionCount int    // Number of versions in the registry, for --sort versions
+	updated      string // Publication date of the latest version, for --sort updated
+}
+
+// Search lists the packages in the local registries whose name or keywords match a substring or regular expression
+func Search(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	useRegex, _ := cmd.Flags().GetBool("regex")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	listing, err := parseListingFlags(cmd)
+	if err != nil {
+		return err
+	}
+	match, err := packageNameMatcher(args[0], useRegex)
+	if err != nil {
+		return err
+	}
+
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return err
+	}
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return err
+	}
+	if registryName, _ := cmd.Flags().GetString("registry"); registryName != "" {
+		if !contains(registryNames, registryName) {
+			return notFoundError("registry '%s' not found in registries.json", registryName)
+		}
+		registryNames = []string{registryName}
+	}
+
+	results, err := searchRegistries(ctx, registriesDir, registryNames, match, listing.sortBy)
+	if err != nil {
+		return err
+	}
+	total := len(results)
+	start, end, err := listing.pageBounds(total)
+	if err != nil {
+		return err
+	}
+	results = results[start:end]
+	if asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal search results: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(results) == 0 {
+		fmt.Printf("No packages found matching '%s'\n", args[0])
+		return nil
+	}
+	for _, result := range results {
+		version := result.Version
+		if version == "" {
+			version = "no releases"
+		}
+		line := fmt.Sprintf("%s %s (%s)", result.Name, version, result.Registry)
+		if result.Description != "" {
+			line += " - " + result.Description
+		}
+		fmt.Println(line)
+	}
+	if footer := listing.pageFooter(start, end, total); footer != "" {
+		fmt.Println(footer)
+	}
+	return nil
+}
+
+// packageNameMatcher returns a case-insensitive matcher for a substring or, with useRegex, a regular expression
+func packageNameMatcher(pattern string, useRegex bool) (func(string) bool, error) {
+	if !useRegex {
+		pattern = strings.ToLower(pattern)
+		return func(name string) bool { return strings.Contains(strings.ToLower(name), pattern) }, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, validationError("invalid regular expression '%s': %w", pattern, err)
+	}
+	return re.MatchString, nil
+}
+
+// searchRegistries collects the matching packages of the registries, sorted by name and registry,
+// or first by version count or publication date (see listingOptions)
+func searchRegistries(ctx context.Context, registriesDir string, registryNames []string, match func(string) bool, sortBy string) ([]searchResult, error) {
+	results := []searchResult{}
+	for _, registryName := range registryNames {
+		registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
+		}
+		for packageName, pkgInfo := range registry.Packages {
+			version, err := latestReleasedVersion(registriesDir, registryName, packageName)
+			if err != nil {
+				return nil, err
+			}
+			result := searchResult{Name: packageName, Registry: registryName, Version: version, GitURL: pkgInfo.GitURL}
+			if version != "" {
+				if specs, err := loadSpecs(registriesDir, registryName, packageName, version); err == nil {
+					result.Description = specs.Description
+					result.Keywords = specs.Keywords
+					result.License = specs.License
+					result.Homepage = specs.Homepage
+				}
+			}
+			if !matchesSearch(result, match) {
+				continue
+			}
+			if err := addSearchSortKeys(ctx, &result, registriesDir, sortBy); err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if sortBy == "versions" && results[i].versionCount != results[j].versionCount {
+			return results[i].versionCount > results[j].versionCount
+		}
+		if sortBy == "updated" && results[i].updated != results[j].updated {
+			return results[i].updated > results[j].updated
+		}
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Registry < results[j].Registry
+	})
+	return results, nil
+}
+
+// addSearchSortKeys looks up the version count or the last publication date of a result if the sort order needs it
+func addSearchSortKeys(ctx context.Context, result *searchResult, registriesDir, sortBy string) error {
+	switch sortBy {
+	case "versions":
+		versions, err := loadVersions(registriesDir, result.Registry, result.Name)
+		if err != nil {
+			return err
+		}
+		result.versionCount = len(versions)
+	case "updated":
+		versions, err := loadVersions(registriesDir, result.Registry, result.Name)
+		if err != nil {
+			return err
+		}
+		published, err := versionPublicationDates(ctx, registriesDir, result.Registry, result.Name)
+		if err != nil {
+			return err
+		}
+		for _, version := range versions {
+			if published[version] > result.updated {
+				result.updated = published[version]
+			}
+		}
+	}
+	return nil
+}
+
+// matchesSearch reports whether the name or one of the keywords of a package matches
+func matchesSearch(result searchResult, match func(string) bool) bool {
+	if match(result.Name) {
+		return true
+	}
+	for _, keyword := range result.Keywords {
+		if match(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// latestReleasedVersion returns the latest stable version of a package, or its latest prerelease
+// if it has no stable versions
+func latestReleasedVersion(registriesDir, registryName, packageName string) (string, error) {
+	version, err := findLatestVersionInRegistry(packageName, "", false, registriesDir, registryName)
+	if err != nil || version != "" {
+		return version, err
+	}
+	return findLatestVersionInRegistry(packageName, "", true, registriesDir, registryName)
+}
@@ -1,7 +1,42 @@
 package commands
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"sort"
 
-// Status displays the current cosmic status
-func Status(cmd *cobra.Command, args []string) {
+	"github.com/spf13/cobra"
+)
+
+// Status displays the current cosmic status: the project in the current directory and its direct
+// dependencies, flagging those that do not use a registered release
+func Status(cmd *cobra.Command, args []string) error {
+	project, err := loadProject("Project.json")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Status for project '%s' %s:\n", project.Name, project.Version)
+	if len(project.Deps) == 0 {
+		fmt.Println("  No dependencies.")
+		return nil
+	}
+	lines := make([]string, 0, len(project.Deps))
+	for _, dep := range project.Deps {
+		line := fmt.Sprintf("    - %s %s", dep.Name, dep.Version)
+		if dep.Alias != "" {
+			line += fmt.Sprintf(" as '%s'", dep.Alias)
+		}
+		switch {
+		case dep.Path != "":
+			line += fmt.Sprintf(" (path dependency at %s)", dep.Path)
+		case dep.SHA1 != "":
+			line += fmt.Sprintf(" (pinned to commit %s, not a release)", dep.SHA1[:7])
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	fmt.Println("  Dependencies:")
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return nil
 }
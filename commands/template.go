@@ -0,0 +1,256 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultTemplateSource is the name of the template repository cloned into the templates directory
+const defaultTemplateSource = "default"
+
+// defaultTemplatesURL is the repository of the default template source, unless templatesurl is configured
+const defaultTemplatesURL = "https://github.com/simkinetic/cosm-templates.git"
+
+// templateSourceNamePattern matches valid names of template sources
+var templateSourceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// templateSource is a template repository in the depot
+type templateSource struct {
+	name string
+	dir  string
+}
+
+// TemplateList prints the templates of every template source
+func TemplateList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	sources, err := listTemplateSources(ctx, cosmDir)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		url, err := GitCommand(ctx, source.dir, "remote", "get-url", "origin")
+		if err != nil || url == "" {
+			url = "no remote"
+		}
+		fmt.Printf("Templates from '%s' (%s):\n", source.name, url)
+		templates, err := listTemplates(source.dir)
+		if err != nil {
+			return err
+		}
+		if len(templates) == 0 {
+			fmt.Println("  No templates.")
+		}
+		for _, template := range templates {
+			fmt.Printf("  - %s\n", template)
+		}
+	}
+	return nil
+}
+
+// TemplateAdd clones an additional template repository into the depot
+func TemplateAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	gitURL := args[0]
+	if gitURL == "" {
+		return validationError("template giturl must not be empty")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(strings.TrimSuffix(gitURL, "/")), ".git")
+	}
+	if name == defaultTemplateSource || !templateSourceNamePattern.MatchString(name) {
+		return validationError("invalid template source name '%s'; choose another one with --name", name)
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	sourcesDir := filepath.Join(cosmDir, "template-sources")
+	if _, err := os.Stat(filepath.Join(sourcesDir, name)); err == nil {
+		return conflictError("template source '%s' already exists", name)
+	}
+	if err := os.MkdirAll(sourcesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", sourcesDir, err)
+	}
+	if _, err := clone(ctx, gitURL, sourcesDir, name); err != nil {
+		os.RemoveAll(filepath.Join(sourcesDir, name))
+		return err
+	}
+	logging.Infof("Added template source '%s' from %s", name, gitURL)
+	return nil
+}
+
+// TemplateUpdate pulls the latest templates of one or all template sources
+func TemplateUpdate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	sources, err := listTemplateSources(ctx, cosmDir)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		source, err := findTemplateSource(sources, args[0])
+		if err != nil {
+			return err
+		}
+		sources = []templateSource{source}
+	}
+	for _, source := range sources {
+		if _, err := os.Stat(filepath.Join(source.dir, ".git")); err != nil {
+			logging.Infof("Skipped template source '%s': not a git repository", source.name)
+			continue
+		}
+		if _, err := GitCommand(ctx, source.dir, "pull"); err != nil {
+			return wrapGitError(source.dir, fmt.Sprintf("failed to update template source '%s'", source.name), err)
+		}
+		logging.Infof("Updated template source '%s'", source.name)
+	}
+	return nil
+}
+
+// TemplateRemove deletes an additional template repository from the depot
+func TemplateRemove(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	name := args[0]
+	if name == defaultTemplateSource {
+		return fmt.Errorf("the default template source cannot be removed")
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	sources, err := listTemplateSources(ctx, cosmDir)
+	if err != nil {
+		return err
+	}
+	source, err := findTemplateSource(sources, name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(source.dir); err != nil {
+		return fmt.Errorf("failed to remove template source '%s': %w", name, err)
+	}
+	logging.Infof("Removed template source '%s'", name)
+	return nil
+}
+
+// templatesURL returns the repository of the default template source. Setting COSM_TEMPLATES_URL
+// to an empty value disables the default template source.
+func templatesURL() string {
+	if url, set := os.LookupEnv("COSM_TEMPLATES_URL"); set {
+		return url
+	}
+	if url := currentConfig().TemplatesURL; url != "" {
+		return url
+	}
+	return defaultTemplatesURL
+}
+
+// ensureDefaultTemplates clones the default template source into the templates directory, unless
+// it was cloned before, it is disabled, cosm is offline, or the directory already holds templates of the user
+func ensureDefaultTemplates(ctx context.Context, cosmDir string) error {
+	templatesDir := filepath.Join(cosmDir, "templates")
+	url := templatesURL()
+	if url == "" || currentConfig().Offline {
+		return nil
+	}
+	entries, err := os.ReadDir(templatesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read templates directory %s: %w", templatesDir, err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	if _, err := clone(ctx, url, cosmDir, "templates"); err != nil {
+		return fmt.Errorf("failed to clone templates from %s: %w", url, err)
+	}
+	return nil
+}
+
+// listTemplateSources returns the default template source followed by the added sources in name order
+func listTemplateSources(ctx context.Context, cosmDir string) ([]templateSource, error) {
+	if err := ensureDefaultTemplates(ctx, cosmDir); err != nil {
+		logging.Warnf("%v", err)
+	}
+	var sources []templateSource
+	defaultDir := filepath.Join(cosmDir, "templates")
+	if _, err := os.Stat(defaultDir); err == nil {
+		sources = append(sources, templateSource{name: defaultTemplateSource, dir: defaultDir})
+	}
+	names, err := listSubdirs(filepath.Join(cosmDir, "template-sources"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		sources = append(sources, templateSource{name: name, dir: filepath.Join(cosmDir, "template-sources", name)})
+	}
+	return sources, nil
+}
+
+// findTemplateSource looks up a template source by name
+func findTemplateSource(sources []templateSource, name string) (templateSource, error) {
+	for _, source := range sources {
+		if source.name == name {
+			return source, nil
+		}
+	}
+	return templateSource{}, notFoundError("template source '%s' not found", name)
+}
+
+// listTemplates returns the templates (<language>/<template>) in a template source
+func listTemplates(sourceDir string) ([]string, error) {
+	languages, err := listSubdirs(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	var templates []string
+	for _, language := range languages {
+		if strings.HasPrefix(language, ".") {
+			continue
+		}
+		names, err := listSubdirs(filepath.Join(sourceDir, language))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			templates = append(templates, language+"/"+name)
+		}
+	}
+	return templates, nil
+}
+
+// resolveTemplateDir returns the directory of a template (<language>/<template>), taken from the
+// first template source that provides it
+func resolveTemplateDir(ctx context.Context, cosmDir, templatePath string) (string, error) {
+	sources, err := listTemplateSources(ctx, cosmDir)
+	if err != nil {
+		return "", err
+	}
+	for _, source := range sources {
+		dir := filepath.Join(source.dir, templatePath)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", notFoundError("template %s not found in any template source", templatePath)
+}
+
+// hasTemplateLanguage reports whether any template source has templates for the language
+func hasTemplateLanguage(ctx context.Context, cosmDir, language string) bool {
+	_, err := resolveTemplateDir(ctx, cosmDir, language)
+	return err == nil
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"bytes"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Undo reverts the last operation in the journal that has not been undone yet, by restoring the
+// metadata files it changed. Operations that committed to Git or changed a registry cannot be undone.
+func Undo(cmd *cobra.Command, args []string) error {
+	list, _ := cmd.Flags().GetBool("list")
+	force, _ := cmd.Flags().GetBool("force")
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return err
+	}
+	entries, err := loadJournal(cosmDir)
+	if err != nil {
+		return err
+	}
+	if list {
+		printJournal(entries, setupRegistriesDir(cosmDir))
+		return nil
+	}
+
+	entry := lastUndoableEntry(entries)
+	if entry == nil {
+		return notFoundError("there is no operation to undo")
+	}
+	if reason := undoBlocker(entry, setupRegistriesDir(cosmDir)); reason != "" {
+		return conflictError("cannot undo '%s': %s", entry.Command, reason)
+	}
+	if !force {
+		if err := ensureFilesUnchangedSince(entry); err != nil {
+			return err
+		}
+	}
+
+	markUndo(entry.ID)
+	for i := len(entry.Files) - 1; i >= 0; i-- {
+		file := entry.Files[i]
+		if file.Previous == nil {
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file.Path, err)
+			}
+			continue
+		}
+		if err := writeMetadataFile(file.Path, []byte(*file.Previous)); err != nil {
+			return err
+		}
+	}
+	logging.Infof("Undid '%s' (%s)", entry.Command, strings.Join(journalFileNames(entry), ", "))
+	return nil
+}
+
+// lastUndoableEntry returns the most recent operation that is neither an undo nor undone
+func lastUndoableEntry(entries []types.JournalEntry) *types.JournalEntry {
+	undone := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.Undoes > 0 {
+			undone[entry.Undoes] = true
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Undoes == 0 && !undone[entries[i].ID] {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// undoBlocker explains why an operation cannot be undone by restoring files; empty if it can
+func undoBlocker(entry *types.JournalEntry, registriesDir string) string {
+	if len(entry.Repositories) > 0 {
+		return fmt.Sprintf("it changed the Git history of %s", strings.Join(entry.Repositories, ", "))
+	}
+	for _, file := range entry.Files {
+		if rel, err := filepath.Rel(registriesDir, file.Path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return fmt.Sprintf("it changed the registries in %s", registriesDir)
+		}
+	}
+	return ""
+}
+
+// ensureFilesUnchangedSince refuses to overwrite files that were changed after the operation
+func ensureFilesUnchangedSince(entry *types.JournalEntry) error {
+	for _, file := range entry.Files {
+		current, err := os.ReadFile(file.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		if err != nil || !bytes.Equal(current, []byte(file.Result)) {
+			return conflictError("%s was changed after '%s'; use --force to undo anyway", file.Path, entry.Command)
+		}
+	}
+	return nil
+}
+
+// journalFileNames returns the paths of the files changed by an operation, relative to its directory
+func journalFileNames(entry *types.JournalEntry) []string {
+	var names []string
+	for _, file := range entry.Files {
+		name := file.Path
+		if rel, err := filepath.Rel(entry.Dir, file.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// printJournal lists the operations in the journal, most recent first
+func printJournal(entries []types.JournalEntry, registriesDir string) {
+	if len(entries) == 0 {
+		fmt.Println("The journal is empty")
+		return
+	}
+	undone := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.Undoes > 0 {
+			undone[entry.Undoes] = true
+		}
+	}
+	fmt.Println("Operations in the journal, most recent first:")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		var notes []string
+		switch {
+		case entry.Undoes > 0:
+			notes = append(notes, fmt.Sprintf("undoes %d", entry.Undoes))
+		case undone[entry.ID]:
+			notes = append(notes, "undone")
+		case undoBlocker(entry, registriesDir) != "":
+			notes = append(notes, "cannot be undone")
+		}
+		if entry.Failed {
+			notes = append(notes, "failed")
+		}
+		line := fmt.Sprintf("  %d  %s  %s", entry.ID, entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Command)
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+}
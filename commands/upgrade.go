@@ -1,7 +1,222 @@
 package commands
 
-import "github.com/spf13/cobra"
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"path/filepath"
+	"strings"
 
-func Upgrade(cmd *cobra.Command, args []string) {
+	"github.com/spf13/cobra"
+)
 
+// UpgradeOptions describes the dependencies of a project to upgrade
+type UpgradeOptions struct {
+	ProjectDir string // Directory with the Project.json; the current directory if empty
+	Name       string // Dependency to upgrade, by name or alias; all direct dependencies if empty
+	Version    string // v<major>, v<major>.<minor> or an exact version to upgrade to; the latest compatible version if empty
+	Latest     bool   // Upgrade to the latest version, even if its major version differs
+	Prerelease bool   // Consider prerelease versions
+}
+
+// UpgradeResult is a dependency that was upgraded, or that is up to date if From equals To
+type UpgradeResult struct {
+	Name string
+	From string
+	To   string
+}
+
+// Upgrade upgrades a dependency, or all direct dependencies, of the project in the current directory
+func Upgrade(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	latest, _ := cmd.Flags().GetBool("latest")
+	prerelease, _ := cmd.Flags().GetBool("pre")
+	opts := UpgradeOptions{Latest: latest, Prerelease: prerelease}
+	switch {
+	case all && len(args) > 0:
+		return validationError("cannot combine a dependency name with --all")
+	case !all && len(args) == 0:
+		return validationError("requires a dependency name or --all (e.g., cosm upgrade <name>)")
+	case len(args) > 0:
+		opts.Name = args[0]
+	}
+	if len(args) == 2 {
+		if latest {
+			return validationError("cannot combine a version with --latest")
+		}
+		if !strings.HasPrefix(args[1], "v") || !isVersionArg(args[1]) {
+			return validationError("invalid version '%s': must be v<major>, v<major>.<minor> or v<major>.<minor>.<patch>", args[1])
+		}
+		opts.Version = args[1]
+	}
+	results, err := UpgradeDependencies(cmd.Context(), opts)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.From == result.To {
+			logging.Infof("Dependency '%s' is up to date at %s", result.Name, result.To)
+		} else {
+			logging.Infof("Upgraded dependency '%s' from %s to %s", result.Name, result.From, result.To)
+		}
+	}
+	return nil
+}
+
+// UpgradeDependencies upgrades dependencies of a project to the latest version in the registries
+// that satisfies the options, and regenerates its build list. Path dependencies and dependencies
+// pinned to a commit are not upgraded.
+func UpgradeDependencies(ctx context.Context, opts UpgradeOptions) ([]UpgradeResult, error) {
+	projectFile := filepath.Join(opts.ProjectDir, "Project.json")
+	project, err := loadProject(projectFile)
+	if err != nil {
+		return nil, err
+	}
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var depKeys []string
+	if opts.Name != "" {
+		if depKeys, _, err = findDependencyKey(project, opts.Name); err != nil {
+			return nil, err
+		}
+	} else {
+		depKeys = sortedDependencyKeys(project.Deps)
+	}
+	refreshed := make(map[string]bool) // Registries that were refreshed
+	var results []UpgradeResult
+	changed := false
+	for _, key := range depKeys {
+		dep := project.Deps[key]
+		if dep.Path != "" || dep.SHA1 != "" {
+			if opts.Name != "" {
+				return nil, validationError("dependency '%s' is a path dependency or pinned to a commit; run cosm add to change it", dep.Name)
+			}
+			continue
+		}
+		depUUID, err := extractUUIDFromKey(key)
+		if err != nil {
+			return nil, err
+		}
+		version, registryUUID, err := selectUpgradeVersion(ctx, dep, depUUID, opts, registriesDir, refreshed)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, UpgradeResult{Name: dep.Name, From: dep.Version, To: version})
+		if version == dep.Version {
+			continue
+		}
+		delete(project.Deps, key)
+		dep.Version = version
+		dep.Registry = registryUUID
+		if err := updateDependency(project, depUUID, dep); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if changed {
+		if err := saveProjectAndBuildList(project, opts.ProjectDir, registriesDir, false); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// selectUpgradeVersion returns the version a dependency is upgraded to and the UUID of the
+// registry it is taken from; the current version if no newer version satisfies the options. The
+// versions are taken from the registry recorded for the dependency if it is available locally.
+func selectUpgradeVersion(ctx context.Context, dep types.Dependency, depUUID string, opts UpgradeOptions, registriesDir string, refreshed map[string]bool) (string, string, error) {
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return "", "", err
+	}
+	registries := make(map[string]types.Registry)
+	recorded := false // Whether a local registry has the UUID of the registry of the dependency
+	for _, registryName := range registryNames {
+		if registry, _, err := LoadRegistryMetadata(registriesDir, registryName); err == nil {
+			if pkgInfo, exists := registry.Packages[dep.Name]; exists && pkgInfo.UUID == depUUID {
+				registries[registryName] = registry
+				recorded = recorded || registry.UUID == dep.Registry
+			}
+		}
+	}
+
+	selected, selectedRegistry := "", dep.Registry
+	for _, registryName := range registryNames {
+		registry, found := registries[registryName]
+		if !found || (recorded && registry.UUID != dep.Registry) {
+			continue
+		}
+		if !refreshed[registryName] {
+			if err := refreshRegistry(ctx, registriesDir, registryName); err != nil {
+				return "", "", err
+			}
+			refreshed[registryName] = true
+		}
+		versions, err := loadVersions(registriesDir, registryName, dep.Name)
+		if err != nil {
+			continue
+		}
+		for _, version := range removeYankedVersions(registriesDir, registryName, dep.Name, versions) {
+			matches, err := upgradeCandidate(version, dep.Version, opts)
+			if err != nil || !matches {
+				continue
+			}
+			if selected == "" {
+				selected, selectedRegistry = version, registry.UUID
+			} else if maxVersion, err := MaxSemVer(selected, version); err == nil && maxVersion != selected {
+				selected, selectedRegistry = version, registry.UUID
+			}
+		}
+	}
+	if selected == "" {
+		if opts.Version != "" {
+			return "", "", notFoundError("no version of '%s' matches %s", dep.Name, opts.Version)
+		}
+		return dep.Version, dep.Registry, nil
+	}
+	if selected == dep.Version {
+		return dep.Version, dep.Registry, nil
+	}
+	if newest, err := MaxSemVer(dep.Version, selected); err != nil || newest != selected {
+		if err == nil && opts.Version != "" {
+			err = validationError("version %s of '%s' is older than the current version %s", selected, dep.Name, dep.Version)
+		}
+		return dep.Version, dep.Registry, err
+	}
+	return selected, selectedRegistry, nil
+}
+
+// upgradeCandidate reports whether a version can be selected by an upgrade from the current
+// version: without a version in the options, a version with the current major version, or any
+// version with Latest. Prereleases are skipped unless Prerelease is set or they are asked for.
+func upgradeCandidate(version, current string, opts UpgradeOptions) (bool, error) {
+	v, err := ParseSemVer(version)
+	if err != nil {
+		return false, err
+	}
+	if v.Prerelease != "" && !opts.Prerelease && version != opts.Version {
+		return false, nil
+	}
+	constraint := opts.Version
+	switch {
+	case constraint == "" && opts.Latest:
+		return true, nil
+	case constraint == "":
+		currentMajor, err := GetMajorVersion(current)
+		return currentMajor == fmt.Sprintf("v%d", v.Major), err
+	case IsMajorVersion(constraint):
+		return constraint == fmt.Sprintf("v%d", v.Major), nil
+	}
+	c, err := ParseSemVer(constraint)
+	if err != nil {
+		return false, err
+	}
+	if core, _, _ := strings.Cut(strings.TrimPrefix(constraint, "v"), "-"); strings.Count(core, ".") == 1 {
+		return c.Major == v.Major && c.Minor == v.Minor, nil // v<major>.<minor>
+	}
+	return compareSemVer(c, v) == 0, nil
 }
@@ -0,0 +1,29 @@
+package commands
+
+import "testing"
+
+func TestUpgradeCandidate(t *testing.T) {
+	tests := []struct {
+		version string
+		opts    UpgradeOptions
+		want    bool
+	}{
+		{"v1.3.0", UpgradeOptions{}, true},
+		{"v2.0.0", UpgradeOptions{}, false},
+		{"v2.0.0", UpgradeOptions{Latest: true}, true},
+		{"v1.4.0-rc.1", UpgradeOptions{}, false},
+		{"v1.4.0-rc.1", UpgradeOptions{Prerelease: true}, true},
+		{"v1.4.0-rc.1", UpgradeOptions{Version: "v1.4.0-rc.1"}, true},
+		{"v2.1.0", UpgradeOptions{Version: "v2"}, true},
+		{"v1.3.2", UpgradeOptions{Version: "v1.3"}, true},
+		{"v1.4.0", UpgradeOptions{Version: "v1.3"}, false},
+		{"v1.3.2", UpgradeOptions{Version: "v1.3.2"}, true},
+		{"v1.3.3", UpgradeOptions{Version: "v1.3.2"}, false},
+	}
+	for _, tt := range tests {
+		got, err := upgradeCandidate(tt.version, "v1.2.0", tt.opts)
+		if err != nil || got != tt.want {
+			t.Errorf("upgradeCandidate(%s, %+v) = %v (err: %v), want %v", tt.version, tt.opts, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveTokenEnv is the environment variable with a bearer token for the artifact store
+const archiveTokenEnv = "COSM_ARCHIVE_TOKEN"
+
+// packageArchivePath returns the cached archive of a package version in the depot
+func packageArchivePath(cosmDir string, specs *types.Specs) string {
+	return filepath.Join(cosmDir, "archives", specs.UUID, specs.SHA1+".tar.gz")
+}
+
+// packageArchiveURL returns the URL of the archive of a package version in the artifact store
+func packageArchiveURL(archiveURL string, specs *types.Specs) string {
+	return strings.TrimSuffix(archiveURL, "/") + "/" + specs.UUID + "/" + specs.SHA1 + ".tar.gz"
+}
+
+// validateArchiveURL checks that the artifact store is an absolute http, https or file URL
+func validateArchiveURL(archiveURL string) error {
+	parsed, err := url.Parse(archiveURL)
+	if err != nil || !((parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" || parsed.Scheme == "file" && parsed.Path != "") {
+		return fmt.Errorf("archiveurl must be an http, https or file URL")
+	}
+	return nil
+}
+
+// installFromArchive extracts a package version to destPath from its cached archive, downloading
+// the archive from the artifact store first if it is configured. It reports false if no archive is
+// available, or if the registry records no digest to check the archive against, in which case the
+// package is made available from its clone.
+func installFromArchive(ctx context.Context, cosmDir string, specs *types.Specs, destPath string) (bool, error) {
+	if specs.Digest == "" {
+		return false, nil
+	}
+	archivePath := packageArchivePath(cosmDir, specs)
+	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+		archiveURL := currentConfig().ArchiveURL
+		if archiveURL == "" || currentConfig().Offline {
+			return false, nil
+		}
+		found, err := downloadPackageArchive(ctx, packageArchiveURL(archiveURL, specs), archivePath)
+		if err != nil || !found {
+			return false, err
+		}
+	} else if err != nil {
+		return false, fmt.Errorf("failed to check archive %s: %w", archivePath, err)
+	}
+	if err := extractPackageArchive(archivePath, destPath, specs.Digest); err != nil {
+		// Do not use the archive again; it is downloaded anew the next time
+		os.Remove(archivePath)
+		return false, err
+	}
+	if err := writePackageMeta(destPath, specs, archivePath); err != nil {
+		return false, err
+	}
+	logging.Debugf("Extracted '%s@%s' from %s", specs.Name, specs.Version, archivePath)
+	return true, nil
+}
+
+// downloadPackageArchive copies an archive from the artifact store to archivePath; it reports
+// false if the store does not have the archive
+func downloadPackageArchive(ctx context.Context, archiveURL, archivePath string) (bool, error) {
+	var body io.ReadCloser
+	if path, isFile := strings.CutPrefix(archiveURL, "file://"); isFile {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to open archive %s: %w", path, err)
+		}
+		body = file
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, networkTimeout())
+		defer cancel()
+		req, err := newArchiveRequest(ctx, http.MethodGet, archiveURL, nil)
+		if err != nil {
+			return false, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false, networkError("failed to download %s: %v", archiveURL, err)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return false, nil
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			resp.Body.Close()
+			return false, fmt.Errorf("failed to download %s: unexpected response %s", archiveURL, resp.Status)
+		}
+		body = resp.Body
+	}
+	defer body.Close()
+	if err := writeFileAtomically(archivePath, body); err != nil {
+		return false, err
+	}
+	logging.Debugf("Downloaded %s", archiveURL)
+	return true, nil
+}
+
+// uploadPackageArchive copies an archive to the artifact store, with an HTTP PUT for http and
+// https URLs
+func uploadPackageArchive(ctx context.Context, archiveURL, archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer file.Close()
+	if path, isFile := strings.CutPrefix(archiveURL, "file://"); isFile {
+		return writeFileAtomically(path, file)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat archive %s: %w", archivePath, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, networkTimeout())
+	defer cancel()
+	req, err := newArchiveRequest(ctx, http.MethodPut, archiveURL, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return networkError("failed to upload %s: %v", archiveURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to upload %s: unexpected response %s", archiveURL, resp.Status)
+	}
+	return nil
+}
+
+// newArchiveRequest creates a request to the artifact store, authorized with the token in
+// COSM_ARCHIVE_TOKEN if it is set
+func newArchiveRequest(ctx context.Context, method, archiveURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, archiveURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL '%s': %w", archiveURL, err)
+	}
+	req.Header.Set("User-Agent", "cosm")
+	if token := os.Getenv(archiveTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// writePackageArchive writes the files of a materialized package version to a gzipped tarball
+func writePackageArchive(packageDir, archivePath string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTarGz(packageDir, writer))
+	}()
+	err := writeFileAtomically(archivePath, reader)
+	reader.Close()
+	return err
+}
+
+// writeTarGz writes the tree of a directory as a gzipped tarball with paths relative to the directory
+func writeTarGz(dir string, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || relPath == "." || relPath == packageMetaFile {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// extractPackageArchive extracts a package archive to a staging directory and moves it to destPath
+// if the extracted files match the digest of the package. Entries that would end up outside of
+// destPath are rejected.
+func extractPackageArchive(archivePath, destPath, digest string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer file.Close()
+	stagingDir, err := makeTempDir(filepath.Dir(destPath), filepath.Base(destPath))
+	if err != nil {
+		return err
+	}
+	defer removeTempDir(stagingDir)
+	if err := extractTarGz(file, stagingDir); err != nil {
+		return fmt.Errorf("failed to extract archive %s: %w", archivePath, err)
+	}
+	extracted, err := directoryDigest(stagingDir)
+	if err != nil {
+		return err
+	}
+	if extracted != digest {
+		return fmt.Errorf("archive %s does not match the digest %s recorded in the registry (got %s)", archivePath, digest, extracted)
+	}
+	if err := os.Rename(stagingDir, destPath); err != nil {
+		return fmt.Errorf("failed to move extracted archive to %s: %w", destPath, err)
+	}
+	return nil
+}
+
+// extractTarGz extracts the directories, regular files and symbolic links of a gzipped tarball into
+// dir. Entries outside of dir, symbolic links that point outside of dir and entries below an
+// extracted symbolic link are rejected, so that an archive cannot write anywhere else.
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("entry '%s' lies outside of the package", header.Name)
+		}
+		if err := checkNoSymlinkInPath(dir, name); err != nil {
+			return fmt.Errorf("entry '%s': %w", header.Name, err)
+		}
+		target := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tr); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(link) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), link)) {
+				return fmt.Errorf("symbolic link '%s' points outside of the package: %s", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkNoSymlinkInPath returns an error if the path of an entry below dir, or the entry itself, is
+// an existing symbolic link, so that nothing is written through a link
+func checkNoSymlinkInPath(dir, name string) error {
+	current := dir
+	for _, part := range strings.Split(name, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("goes through the symbolic link '%s'", filepath.ToSlash(strings.TrimPrefix(current, dir+string(filepath.Separator))))
+		}
+	}
+	return nil
+}
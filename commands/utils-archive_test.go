@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPackageArchiveRoundTrip tests that an archived package tree is extracted unchanged
+func TestPackageArchiveRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	packageDir := filepath.Join(tempDir, "pkg")
+	if err := os.MkdirAll(filepath.Join(packageDir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, "src", "main.t"), []byte("return 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("src/main.t", filepath.Join(packageDir, "main.t")); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := directoryDigest(packageDir)
+	if err != nil {
+		t.Fatalf("Failed to compute digest: %v", err)
+	}
+	archivePath := filepath.Join(tempDir, "archives", "pkg.tar.gz")
+	if err := writePackageArchive(packageDir, archivePath); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	destPath := filepath.Join(tempDir, "packages", "pkg")
+	if err := extractPackageArchive(archivePath, filepath.Join(tempDir, "packages", "other"), digest+"0"); err == nil {
+		t.Errorf("Expected an error for an archive that does not match the digest")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "packages", "other")); !os.IsNotExist(err) {
+		t.Errorf("Expected no package for an archive that does not match the digest")
+	}
+	if err := extractPackageArchive(archivePath, destPath, digest); err != nil {
+		t.Fatalf("Failed to extract archive: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(destPath, "main.t")); err != nil || string(data) != "return 1\n" {
+		t.Errorf("Expected main.t through the symlink, got %q (err: %v)", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(destPath, "run.sh")); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected run.sh to stay executable (err: %v)", err)
+	}
+}
+
+// TestExtractTarGzRejectsEscapes tests that entries outside of the package are rejected
+func TestExtractTarGzRejectsEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("x")
+	if err := tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+
+	dir := filepath.Join(t.TempDir(), "dest")
+	if err := extractTarGz(&buf, dir); err == nil {
+		t.Errorf("Expected an error for an entry outside of the package")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file outside of the package")
+	}
+}
+
+// TestExtractTarGzRejectsSymlinkEscapes tests that an archive cannot write outside of the package
+// through a symbolic link
+func TestExtractTarGzRejectsSymlinkEscapes(t *testing.T) {
+	tempDir := t.TempDir()
+	outside := filepath.Join(tempDir, "home")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		headers []tar.Header
+	}{
+		{"absolute link", []tar.Header{
+			{Name: "lib", Linkname: outside, Typeflag: tar.TypeSymlink},
+			{Name: "lib/.bashrc", Mode: 0644, Size: 1, Typeflag: tar.TypeReg},
+		}},
+		{"relative link outside", []tar.Header{
+			{Name: "src/lib", Linkname: "../../home", Typeflag: tar.TypeSymlink},
+		}},
+		{"file below a link", []tar.Header{
+			{Name: "src", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "lib", Linkname: "src", Typeflag: tar.TypeSymlink},
+			{Name: "lib/main.t", Mode: 0644, Size: 1, Typeflag: tar.TypeReg},
+		}},
+		{"file replacing a link", []tar.Header{
+			{Name: "main.t", Linkname: "src/main.t", Typeflag: tar.TypeSymlink},
+			{Name: "main.t", Mode: 0644, Size: 1, Typeflag: tar.TypeReg},
+		}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, header := range tt.headers {
+			if err := tw.WriteHeader(&header); err != nil {
+				t.Fatal(err)
+			}
+			if header.Typeflag == tar.TypeReg {
+				tw.Write([]byte("x"))
+			}
+		}
+		tw.Close()
+		gz.Close()
+
+		dir := filepath.Join(tempDir, "dest", strings.ReplaceAll(tt.name, " ", "-"))
+		if err := extractTarGz(&buf, dir); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if entries, err := os.ReadDir(outside); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no files written outside of the package, got %v (err: %v)", entries, err)
+	}
+}
@@ -1,43 +1,276 @@
 package commands
 
 import (
+	"cosm/logging"
 	"cosm/types"
 	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 )
 
-// generateBuildList creates a build list using Minimum Version Selection (MVS),
-// including direct dependencies from project.Deps and transitive dependencies
-// from dependency build lists, taking the maximum version for shared dependencies.
-func generateBuildList(project *types.Project, registriesDir string) (types.BuildList, error) {
-	buildList := types.BuildList{Dependencies: make(map[string]types.BuildListDependency)}
+// generateBuildList creates a build list using Minimal Version Selection (MVS). The requirement
+// graph is walked from the direct dependencies in project.Deps through the specs of every version
+// it reaches, and for every <uuid>@<major> the highest required version is selected. The graph is
+// then rebuilt from the specs of the selected versions only, and the dependencies that none of
+// them requires are pruned.
+//
+// Path dependencies, whose path is relative to projectDir, are resolved from the Project.json of
+// the local tree instead of the registries. They take precedence over any version of the same
+// package required elsewhere in the graph, and the build list refers to the local tree directly.
+// Dependencies pinned to a commit take precedence in the same way, with the SHA1 of the commit in
+// the build list instead of that of the release.
+//
+// The features enabled for a dependency are the union of the features that every requirement on
+// its <uuid>@<major> asks for. Only the optional dependencies that these features enable are
+// followed, so the graph is walked again whenever the walk enables new features, until it is
+// stable. The optional dependencies of the project itself are always resolved.
+//
+// Dependencies restricted to other platforms than platform (<os>/<arch>) are left out; if platform
+// is empty, the dependencies of all platforms are resolved, as for the build lists in registries.
+func generateBuildList(project *types.Project, projectDir, platform, registriesDir string) (types.BuildList, error) {
+	buildList, _, err := resolveBuildList(project, projectDir, platform, registriesDir)
+	return buildList, err
+}
 
-	// Process direct dependencies
-	for key, dep := range project.Deps {
-		depUUID, err := extractUUIDFromKey(key)
-		if err != nil {
-			return types.BuildList{}, err
+// resolveBuildList resolves the build list of a project like generateBuildList, and also returns
+// the versions selected before the unreachable dependencies were pruned
+func resolveBuildList(project *types.Project, projectDir, platform, registriesDir string) (types.BuildList, map[string]types.BuildListDependency, error) {
+	specsCache := make(map[string]types.Specs) // <uuid>@<version>, or the absolute path of a local tree
+	dependencySpecs := func(name, version, uuid, registryUUID string) (types.Specs, error) {
+		id := uuid + "@" + version
+		if specs, cached := specsCache[id]; cached {
+			return specs, nil
 		}
-		specs, depBuildList, err := findDependency(dep.Name, dep.Version, depUUID, registriesDir)
+		specs, _, err := findDependencySpecs(name, version, uuid, registryUUID, registriesDir)
 		if err != nil {
-			return types.BuildList{}, err
+			return types.Specs{}, err
 		}
-		key, entry, err := createDependencyEntry(dep.Name, dep.Version, depUUID, specs)
-		if err != nil {
-			return types.BuildList{}, err
+		specsCache[id] = specs
+		return specs, nil
+	}
+	conditional := false // Whether a dependency is restricted to some platforms
+	platformDeps := func(deps map[string]types.Dependency) map[string]types.Dependency {
+		matching := make(map[string]types.Dependency, len(deps))
+		for key, dep := range deps {
+			conditional = conditional || len(dep.Platforms) > 0
+			if matchesPlatform(dep, platform) {
+				matching[key] = dep
+			}
+		}
+		return matching
+	}
+	specsID := func(entry types.BuildListDependency) string {
+		if filepath.IsAbs(entry.Path) && entry.SHA1 == "" {
+			return entry.Path
+		}
+		return entry.UUID + "@" + entry.Version
+	}
+
+	// Select the highest required version of every dependency in the graph. A walk reports whether
+	// it enabled new features of a package whose dependencies it had already followed.
+	features := make(map[string][]string) // Features requested of every <uuid>@<major>
+	selectVersions := func() (map[string]types.BuildListDependency, bool, error) {
+		selected := make(map[string]types.BuildListDependency)
+		pinned := make(map[string]bool)   // Keys selected by a path dependency or a pinned commit
+		visited := make(map[string]bool)  // <uuid>@<version>, or the absolute path of a local tree
+		expanded := make(map[string]bool) // Keys whose dependencies were followed
+		grown := false
+		queue := []map[string]types.Dependency{platformDeps(absolutePathDependencies(project.Deps, projectDir))}
+		for len(queue) > 0 {
+			deps := queue[0]
+			queue = queue[1:]
+			for _, key := range sortedDependencyKeys(deps) {
+				dep := deps[key]
+				depUUID, err := extractUUIDFromKey(key)
+				if err != nil {
+					return nil, false, err
+				}
+				if merged := mergeFeatures(features[key], dep.Features); len(merged) > len(features[key]) {
+					features[key] = merged
+					grown = grown || expanded[key]
+				}
+				if dep.Path != "" {
+					if visited[dep.Path] {
+						continue
+					}
+					visited[dep.Path] = true
+					specs, err := localPackageSpecs(dep.Path)
+					if err != nil {
+						return nil, false, err
+					}
+					entryKey, entry, err := createDependencyEntry(specs.Name, specs.Version, specs.UUID, specs)
+					if err != nil {
+						return nil, false, err
+					}
+					if entryKey != key {
+						return nil, false, fmt.Errorf("path dependency '%s' in %s is %s@%s, which does not match '%s'; run cosm add --path again", dep.Name, dep.Path, specs.UUID, specs.Version, key)
+					}
+					if current, exists := selected[entryKey]; exists && pinned[entryKey] && current.Path != dep.Path {
+						return nil, false, fmt.Errorf("package '%s' is required from two local trees: %s and %s", dep.Name, current.Path, dep.Path)
+					}
+					entry.Path = dep.Path
+					specsCache[dep.Path] = specs
+					selected[entryKey] = entry
+					pinned[entryKey] = true
+					expanded[entryKey] = true
+					activeDeps, _ := featureDependencies(specs, features[entryKey])
+					queue = append(queue, platformDeps(activeDeps))
+					continue
+				}
+				if dep.SHA1 != "" {
+					if visited[dep.SHA1] {
+						continue
+					}
+					visited[dep.SHA1] = true
+					// The dependencies of the release of the recorded version are followed
+					specs, err := dependencySpecs(dep.Name, dep.Version, depUUID, dep.Registry)
+					if err != nil {
+						return nil, false, err
+					}
+					entryKey, entry, err := createDependencyEntry(dep.Name, dep.Version, depUUID, specs)
+					if err != nil {
+						return nil, false, err
+					}
+					if current, exists := selected[entryKey]; exists && pinned[entryKey] && current.SHA1 != dep.SHA1 {
+						return nil, false, fmt.Errorf("package '%s' is pinned to commit %s, but also required from %s", dep.Name, dep.SHA1, current.Path)
+					}
+					entry.SHA1 = dep.SHA1
+					entry.Path = fmt.Sprintf("packages/%s/%s", dep.Name, dep.SHA1)
+					selected[entryKey] = entry
+					pinned[entryKey] = true
+					expanded[entryKey] = true
+					activeDeps, _ := featureDependencies(specs, features[entryKey])
+					queue = append(queue, platformDeps(activeDeps))
+					continue
+				}
+				if visited[depUUID+"@"+dep.Version] {
+					continue
+				}
+				visited[depUUID+"@"+dep.Version] = true
+				specs, err := dependencySpecs(dep.Name, dep.Version, depUUID, dep.Registry)
+				if err != nil {
+					return nil, false, err
+				}
+				entryKey, entry, err := createDependencyEntry(dep.Name, dep.Version, depUUID, specs)
+				if err != nil {
+					return nil, false, err
+				}
+				if pinned[entryKey] {
+					continue // The local tree or pinned commit is used regardless of the required version
+				}
+				if current, exists := selected[entryKey]; exists {
+					maxVersion, err := MaxSemVer(current.Version, entry.Version)
+					if err != nil {
+						return nil, false, fmt.Errorf("failed to compare versions for '%s': %w", entry.Name, err)
+					}
+					if maxVersion != entry.Version {
+						entry = current
+					}
+				}
+				selected[entryKey] = entry
+				expanded[entryKey] = true
+				// Versions that are not selected may lack features; only selected versions must have them
+				activeDeps, _ := featureDependencies(specs, features[entryKey])
+				queue = append(queue, platformDeps(activeDeps))
+			}
+		}
+		return selected, grown, nil
+	}
+	var selected map[string]types.BuildListDependency
+	for grown := true; grown; {
+		var err error
+		if selected, grown, err = selectVersions(); err != nil {
+			return types.BuildList{}, nil, err
 		}
-		if err := mergeDependencyEntry(&buildList, key, entry); err != nil {
-			return types.BuildList{}, err
+	}
+
+	// Keep the selected versions that are reachable through the requirements of selected versions.
+	// The aliases of the project take precedence over those of its dependencies.
+	buildList := types.BuildList{Dependencies: make(map[string]types.BuildListDependency)}
+	queue := []map[string]types.Dependency{platformDeps(project.Deps)}
+	for len(queue) > 0 {
+		deps := queue[0]
+		queue = queue[1:]
+		for _, key := range sortedDependencyKeys(deps) {
+			if _, reached := buildList.Dependencies[key]; reached {
+				continue
+			}
+			entry, exists := selected[key]
+			if !exists {
+				return types.BuildList{}, nil, fmt.Errorf("dependency key '%s' of '%s' does not match its version %s", key, deps[key].Name, deps[key].Version)
+			}
+			entry.Alias = deps[key].Alias
+			entry.Features = features[key]
+			buildList.Dependencies[key] = entry
+			specs := specsCache[specsID(entry)]
+			if err := validateRequestedFeatures(specs, features[key]); err != nil {
+				return types.BuildList{}, nil, err
+			}
+			activeDeps, _ := featureDependencies(specs, features[key])
+			queue = append(queue, platformDeps(activeDeps))
 		}
-		// Process transitive dependencies
-		for transKey, transDep := range depBuildList.Dependencies {
-			if err := mergeDependencyEntry(&buildList, transKey, transDep); err != nil {
-				return types.BuildList{}, err
+	}
+	if conditional {
+		buildList.Platform = platform
+	}
+	return buildList, selected, nil
+}
+
+// absolutePathDependencies returns the dependencies with the paths of path dependencies made
+// absolute, relative to dir
+func absolutePathDependencies(deps map[string]types.Dependency, dir string) map[string]types.Dependency {
+	resolved := make(map[string]types.Dependency, len(deps))
+	for key, dep := range deps {
+		if dep.Path != "" && !filepath.IsAbs(dep.Path) {
+			if absPath, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(dep.Path))); err == nil {
+				dep.Path = absPath
 			}
 		}
+		resolved[key] = dep
+	}
+	return resolved
+}
+
+// localPackageSpecs returns the specs of the package in a local tree from its Project.json, with
+// the dependencies in its published groups; the paths of its own path dependencies are made absolute
+func localPackageSpecs(dir string) (types.Specs, error) {
+	project, err := loadProjectFromDir(dir)
+	if err != nil {
+		return types.Specs{}, fmt.Errorf("failed to load path dependency in %s: %w", dir, err)
+	}
+	return types.Specs{
+		Name:     project.Name,
+		UUID:     project.UUID,
+		Version:  project.Version,
+		Deps:     absolutePathDependencies(selectGroups(project, publishedGroups(project)).Deps, dir),
+		License:  project.License,
+		Features: project.Features,
+	}, nil
+}
+
+// pathDependencies returns the path dependencies of a project, sorted by key
+func pathDependencies(project *types.Project) []types.Dependency {
+	var deps []types.Dependency
+	for _, key := range sortedDependencyKeys(project.Deps) {
+		if dep := project.Deps[key]; dep.Path != "" {
+			deps = append(deps, dep)
+		}
 	}
+	return deps
+}
 
-	return buildList, nil
+// sortedDependencyKeys returns the keys of dependencies in order, so that the build list does
+// not depend on the order of map iteration
+func sortedDependencyKeys(deps map[string]types.Dependency) []string {
+	keys := make([]string, 0, len(deps))
+	for key := range deps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // extractUUIDFromKey extracts the UUID from a dependency key formatted as <uuid>@<major version>
@@ -52,16 +285,41 @@ func extractUUIDFromKey(key string) (string, error) {
 	return parts[0], nil
 }
 
-// findDependency searches all registries for a dependency with matching name, UUID, and version
-func findDependency(depName, depVersion, depUUID, registriesDir string) (types.Specs, types.BuildList, error) {
+// findDependency searches the registries for a dependency with matching name, UUID, and version,
+// and loads its specs and published build list; see findDependencySpecs for registryUUID
+func findDependency(depName, depVersion, depUUID, registryUUID, registriesDir string) (types.Specs, types.BuildList, error) {
+	specs, regName, err := findDependencySpecs(depName, depVersion, depUUID, registryUUID, registriesDir)
+	if err != nil {
+		return types.Specs{}, types.BuildList{}, err
+	}
+	buildList, err := loadBuildList(registriesDir, regName, depName, depVersion)
+	if err != nil {
+		return types.Specs{}, types.BuildList{}, fmt.Errorf("failed to load build list for '%s@%s' in registry '%s': %w", depName, depVersion, regName, err)
+	}
+	return specs, buildList, nil
+}
+
+// findDependencySpecs searches all registries for a dependency with matching name, UUID, and
+// version, and returns its specs and the registry it was found in. If registryUUID is not empty,
+// only the registry with that UUID is searched; if no local registry has that UUID, e.g. for the
+// dependency of a package that was released to a registry this depot does not have, all are.
+func findDependencySpecs(depName, depVersion, depUUID, registryUUID, registriesDir string) (types.Specs, string, error) {
 	registryNames, err := loadRegistryNames(registriesDir)
 	if err != nil {
-		return types.Specs{}, types.BuildList{}, fmt.Errorf("failed to load registry names: %v", err)
+		return types.Specs{}, "", fmt.Errorf("failed to load registry names: %w", err)
+	}
+	registries := make(map[string]types.Registry, len(registryNames))
+	recorded := false // Whether a local registry has the UUID registryUUID
+	for _, regName := range registryNames {
+		if reg, _, err := LoadRegistryMetadata(registriesDir, regName); err == nil {
+			registries[regName] = reg
+			recorded = recorded || reg.UUID == registryUUID
+		}
 	}
 
 	for _, regName := range registryNames {
-		reg, _, err := LoadRegistryMetadata(registriesDir, regName)
-		if err != nil {
+		reg, loaded := registries[regName]
+		if !loaded || (recorded && reg.UUID != registryUUID) {
 			continue
 		}
 		if pkgInfo, exists := reg.Packages[depName]; exists && pkgInfo.UUID == depUUID {
@@ -72,21 +330,20 @@ func findDependency(depName, depVersion, depUUID, registriesDir string) (types.S
 			if specs.Version != depVersion {
 				continue
 			}
-			buildList, err := loadBuildList(registriesDir, regName, depName, depVersion)
-			if err != nil {
-				return types.Specs{}, types.BuildList{}, fmt.Errorf("failed to load build list for '%s@%s' in registry '%s': %v", depName, depVersion, regName, err)
-			}
-			return specs, buildList, nil
+			return specs, regName, nil
 		}
 	}
-	return types.Specs{}, types.BuildList{}, fmt.Errorf("dependency '%s@%s' with UUID '%s' not found in any registry", depName, depVersion, depUUID)
+	if recorded {
+		return types.Specs{}, "", notFoundError("dependency '%s@%s' with UUID '%s' not found in the registry with UUID '%s'", depName, depVersion, depUUID, registryUUID)
+	}
+	return types.Specs{}, "", notFoundError("dependency '%s@%s' with UUID '%s' not found in any registry", depName, depVersion, depUUID)
 }
 
 // createDependencyEntry builds a BuildListDependency entry with its key
 func createDependencyEntry(depName, depVersion, depUUID string, specs types.Specs) (string, types.BuildListDependency, error) {
 	majorVersion, err := GetMajorVersion(depVersion)
 	if err != nil {
-		return "", types.BuildListDependency{}, fmt.Errorf("failed to get major version for '%s@%s': %v", depName, depVersion, err)
+		return "", types.BuildListDependency{}, fmt.Errorf("failed to get major version for '%s@%s': %w", depName, depVersion, err)
 	}
 	key := fmt.Sprintf("%s@%s", depUUID, majorVersion)
 	entry := types.BuildListDependency{
@@ -100,18 +357,237 @@ func createDependencyEntry(depName, depVersion, depUUID string, specs types.Spec
 	return key, entry, nil
 }
 
-// mergeDependencyEntry adds or updates a dependency in the build list, keeping the higher version
-func mergeDependencyEntry(buildList *types.BuildList, key string, entry types.BuildListDependency) error {
-	if currEntry, exists := buildList.Dependencies[key]; exists {
-		maxVersion, err := MaxSemVer(currEntry.Version, entry.Version)
+// verifyDependencyBuildLists recomputes the build list of every dependency, direct and
+// transitive, from the specs in the registries and fails if it disagrees with the
+// published buildlist.json. Dependencies are verified before their dependents, so that
+// the build lists used in the recomputation are themselves verified.
+func verifyDependencyBuildLists(deps map[string]types.Dependency, registriesDir string) error {
+	return verifyBuildListsOf(deps, registriesDir, make(map[string]bool))
+}
+
+// verifyBuildListsOf verifies the published build lists of the given dependencies.
+// The visited map records the dependencies (<uuid>@<version>) that were already checked.
+func verifyBuildListsOf(deps map[string]types.Dependency, registriesDir string, visited map[string]bool) error {
+	for key, dep := range deps {
+		depUUID, err := extractUUIDFromKey(key)
 		if err != nil {
-			return fmt.Errorf("failed to compare versions for '%s': %v", entry.Name, err)
+			return err
 		}
-		if maxVersion == entry.Version {
-			buildList.Dependencies[key] = entry
+		id := depUUID + "@" + dep.Version
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		specs, published, err := findDependency(dep.Name, dep.Version, depUUID, dep.Registry, registriesDir)
+		if err != nil {
+			return err
+		}
+		if err := verifyBuildListsOf(specs.Deps, registriesDir, visited); err != nil {
+			return err
+		}
+		recomputed, selected, err := resolveBuildList(&types.Project{Name: dep.Name, Deps: specs.Deps}, "", "", registriesDir)
+		if err != nil {
+			return fmt.Errorf("failed to recompute build list for '%s@%s': %w", dep.Name, dep.Version, err)
+		}
+		published, stale := withoutStaleDependencies(published, recomputed, selected)
+		if len(stale) > 0 {
+			logging.Warnf("published build list of '%s@%s' lists %s, which its specs no longer require; run 'cosm registry audit <registry> --fix' to rewrite it", dep.Name, dep.Version, strings.Join(stale, ", "))
+		}
+		if diff := diffBuildLists(recomputed, published); diff != "" {
+			return fmt.Errorf("published build list of '%s@%s' does not match its specs: %s", dep.Name, dep.Version, diff)
 		}
-	} else {
-		buildList.Dependencies[key] = entry
 	}
 	return nil
 }
+
+// withoutStaleDependencies returns a published build list without the dependencies that build lists
+// published before unreachable dependencies were pruned still list: dependencies that the pruned
+// build list leaves out, but that were selected in the same version while resolving it. It also
+// returns these dependencies as <name>@<version>. Other differences are left for diffBuildLists.
+func withoutStaleDependencies(published, recomputed types.BuildList, selected map[string]types.BuildListDependency) (types.BuildList, []string) {
+	kept := types.BuildList{Dependencies: make(map[string]types.BuildListDependency, len(published.Dependencies)), Platform: published.Platform}
+	var stale []string
+	for key, dep := range published.Dependencies {
+		if _, required := recomputed.Dependencies[key]; !required {
+			if candidate, exists := selected[key]; exists && candidate.Name == dep.Name && candidate.UUID == dep.UUID && candidate.Version == dep.Version && candidate.SHA1 == dep.SHA1 && candidate.Path == dep.Path {
+				stale = append(stale, fmt.Sprintf("'%s@%s'", dep.Name, dep.Version))
+				continue
+			}
+		}
+		kept.Dependencies[key] = dep
+	}
+	sort.Strings(stale)
+	return kept, stale
+}
+
+// diffBuildLists describes the first difference between an expected and an actual
+// build list, or returns "" if they are equal
+func diffBuildLists(expected, actual types.BuildList) string {
+	keys := make([]string, 0, len(expected.Dependencies))
+	for key := range expected.Dependencies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		want := expected.Dependencies[key]
+		got, exists := actual.Dependencies[key]
+		if !exists {
+			return fmt.Sprintf("'%s@%s' is missing", want.Name, want.Version)
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Sprintf("expected '%s@%s' (SHA1 %s), found '%s@%s' (SHA1 %s)", want.Name, want.Version, want.SHA1, got.Name, got.Version, got.SHA1)
+		}
+	}
+	for key, got := range actual.Dependencies {
+		if _, exists := expected.Dependencies[key]; !exists {
+			return fmt.Sprintf("unexpected dependency '%s@%s'", got.Name, got.Version)
+		}
+	}
+	return ""
+}
+
+// majorVersionConflict is a package that a build list contains with more than one major version
+type majorVersionConflict struct {
+	name       string
+	uuid       string
+	versions   []string                  // Selected version of every major version, oldest first
+	requiredBy map[string][]dependentRef // Dependents by the major version they require
+}
+
+// dependentRef is a project or package in a build list that requires another package
+type dependentRef struct {
+	name    string
+	version string
+	direct  bool // The project itself
+}
+
+// findMajorVersionConflicts finds the packages that a build list contains with several major
+// versions, with the dependents that require each of them. Packages imported under an alias are
+// used side by side on purpose and are left out.
+func findMajorVersionConflicts(project *types.Project, buildList types.BuildList, registriesDir string) []majorVersionConflict {
+	byUUID := make(map[string][]types.BuildListDependency)
+	for _, dep := range buildList.Dependencies {
+		byUUID[dep.UUID] = append(byUUID[dep.UUID], dep)
+	}
+	conflicts := make(map[string]*majorVersionConflict)
+	for uuid, deps := range byUUID {
+		if len(deps) < 2 || slices.ContainsFunc(deps, func(dep types.BuildListDependency) bool { return dep.Alias != "" }) {
+			continue
+		}
+		sort.Slice(deps, func(i, j int) bool { return semVerLess(deps[i].Version, deps[j].Version) })
+		conflict := &majorVersionConflict{name: deps[len(deps)-1].Name, uuid: uuid, requiredBy: make(map[string][]dependentRef)}
+		for _, dep := range deps {
+			conflict.versions = append(conflict.versions, dep.Version)
+		}
+		conflicts[uuid] = conflict
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	// Find the dependents of every major version: the project and the packages in the build list
+	addDependents := func(dependent dependentRef, deps map[string]types.Dependency) {
+		for key := range deps {
+			uuid, major, found := strings.Cut(key, "@")
+			if conflict, exists := conflicts[uuid]; found && exists {
+				conflict.requiredBy[major] = append(conflict.requiredBy[major], dependent)
+			}
+		}
+	}
+	addDependents(dependentRef{name: project.Name, direct: true}, project.Deps)
+	for _, dep := range buildList.Dependencies {
+		if specs, _, err := findDependency(dep.Name, dep.Version, dep.UUID, "", registriesDir); err == nil {
+			addDependents(dependentRef{name: dep.Name, version: dep.Version}, specs.Deps)
+		}
+	}
+
+	var result []majorVersionConflict
+	for _, conflict := range conflicts {
+		for _, dependents := range conflict.requiredBy {
+			sort.Slice(dependents, func(i, j int) bool { return dependents[i].name < dependents[j].name })
+		}
+		result = append(result, *conflict)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// reportMajorVersionConflicts warns about the packages that a build list contains with several
+// major versions, and suggests how the dependents of the older major versions can converge on
+// the newest one
+func reportMajorVersionConflicts(project *types.Project, buildList types.BuildList, registriesDir string) {
+	for _, conflict := range findMajorVersionConflicts(project, buildList, registriesDir) {
+		newest := conflict.versions[len(conflict.versions)-1]
+		newestMajor, _ := GetMajorVersion(newest)
+		lines := []string{fmt.Sprintf("'%s' is in the build list with several major versions: %s", conflict.name, strings.Join(conflict.versions, ", "))}
+		for _, version := range conflict.versions[:len(conflict.versions)-1] {
+			major, _ := GetMajorVersion(version)
+			for _, dependent := range conflict.requiredBy[major] {
+				lines = append(lines, "  "+convergeSuggestion(conflict, dependent, major, newestMajor, registriesDir))
+			}
+		}
+		logging.Warnf("%s", strings.Join(lines, "\n"))
+	}
+}
+
+// convergeSuggestion suggests how a dependent that requires an older major version of a package
+// can move to the newest major version
+func convergeSuggestion(conflict majorVersionConflict, dependent dependentRef, major, newestMajor, registriesDir string) string {
+	if dependent.direct {
+		return fmt.Sprintf("project '%s' requires '%s' %s; replace that dependency by '%s' %s", dependent.name, conflict.name, major, conflict.name, newestMajor)
+	}
+	requirement := fmt.Sprintf("'%s' %s requires '%s' %s", dependent.name, dependent.version, conflict.name, major)
+	if upgrade := findConvergingVersion(dependent, conflict.uuid+"@"+newestMajor, registriesDir); upgrade != "" {
+		return fmt.Sprintf("%s; upgrade '%s' to %s, which requires %s", requirement, dependent.name, upgrade, newestMajor)
+	}
+	return fmt.Sprintf("%s; no newer release of '%s' %s requires %s yet", requirement, dependent.name, mustMajorVersion(dependent.version), newestMajor)
+}
+
+// findConvergingVersion returns the oldest release of a dependent, newer than its selected version
+// and with the same major version, that requires the given dependency key, or "" if there is none
+func findConvergingVersion(dependent dependentRef, key, registriesDir string) string {
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return ""
+	}
+	major := mustMajorVersion(dependent.version)
+	for _, registryName := range registryNames {
+		versions, err := loadVersions(registriesDir, registryName, dependent.name)
+		if err != nil {
+			continue
+		}
+		versions = removeYankedVersions(registriesDir, registryName, dependent.name, versions)
+		sortVersions(versions)
+		for _, version := range versions {
+			if mustMajorVersion(version) != major || !semVerLess(dependent.version, version) {
+				continue
+			}
+			if specs, err := loadSpecs(registriesDir, registryName, dependent.name, version); err == nil {
+				if _, requires := specs.Deps[key]; requires {
+					return version
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// semVerLess reports whether version a is lower than version b
+func semVerLess(a, b string) bool {
+	v1, err1 := ParseSemVer(a)
+	v2, err2 := ParseSemVer(b)
+	if err1 != nil || err2 != nil {
+		return a < b
+	}
+	return compareSemVer(v1, v2) < 0
+}
+
+// mustMajorVersion returns the major version of a valid version, or the version itself
+func mustMajorVersion(version string) string {
+	major, err := GetMajorVersion(version)
+	if err != nil {
+		return version
+	}
+	return major
+}
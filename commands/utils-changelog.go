@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// changelogFile is the changelog that cosm reads in the root of a package
+const changelogFile = "CHANGELOG.md"
+
+// changelogHeading matches a Markdown heading, capturing its level and text
+var changelogHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+
+// extractChangelogSection returns the body of the section of a Markdown changelog whose heading
+// names the version, e.g. "## [1.2.0] - 2024-05-01" or "## v1.2.0", up to the next heading of the
+// same or a higher level; it is empty if the changelog has no such section
+func extractChangelogSection(changelog, version string) string {
+	versionPattern := regexp.MustCompile(`(^|[^0-9A-Za-z.])v?` + regexp.QuoteMeta(strings.TrimPrefix(version, "v")) + `($|[^0-9A-Za-z.+-])`)
+	var section []string
+	level := 0 // Level of the heading of the section; 0 until it is found
+	for _, line := range strings.Split(changelog, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if match := changelogHeading.FindStringSubmatch(line); match != nil {
+			if level > 0 && len(match[1]) <= level {
+				break
+			}
+			if level == 0 && versionPattern.MatchString(match[2]) {
+				level = len(match[1])
+				continue
+			}
+		}
+		if level > 0 {
+			section = append(section, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(section, "\n"))
+}
+
+// recordChangelog stores the section of CHANGELOG.md for a version, as of its release commit in the
+// repository in repoDir, as changelog.md in the version directory of a registry; nothing is stored
+// if the package has no changelog or the changelog has no section for the version
+func recordChangelog(ctx context.Context, repoDir, sha1, subdir, versionDir, version string) error {
+	file := path.Join(filepath.ToSlash(subdir), changelogFile)
+	if _, err := GitCommand(ctx, repoDir, "cat-file", "-e", sha1+":"+file); err != nil {
+		return nil // No changelog in this version
+	}
+	changelog, err := GitCommand(ctx, repoDir, "show", sha1+":"+file)
+	if err != nil {
+		return wrapGitError(repoDir, fmt.Sprintf("failed to read %s of version '%s'", file, version), err)
+	}
+	section := extractChangelogSection(changelog, version)
+	if section == "" {
+		return nil
+	}
+	return writeMetadataFile(filepath.Join(versionDir, "changelog.md"), []byte(section+"\n"))
+}
+
+// recordReleaseNotes stores the message of an annotated release tag in the repository in repoDir as
+// notes.md in the version directory of a registry; nothing is stored for lightweight tags
+func recordReleaseNotes(ctx context.Context, repoDir, tag, versionDir string) error {
+	objectType, err := GitCommand(ctx, repoDir, "cat-file", "-t", "refs/tags/"+tag)
+	if err != nil {
+		return wrapGitError(repoDir, fmt.Sprintf("failed to read tag '%s'", tag), err)
+	}
+	if strings.TrimSpace(objectType) != "tag" {
+		return nil
+	}
+	// The subject and body leave out the signature of signed tags
+	notes, err := GitCommand(ctx, repoDir, "for-each-ref", "--format=%(contents:subject)%0a%0a%(contents:body)", "refs/tags/"+tag)
+	if err != nil {
+		return wrapGitError(repoDir, fmt.Sprintf("failed to read the message of tag '%s'", tag), err)
+	}
+	notes = strings.TrimSpace(notes)
+	if notes == "" {
+		return nil
+	}
+	return writeMetadataFile(filepath.Join(versionDir, "notes.md"), []byte(notes+"\n"))
+}
+
+// loadChangelog returns the changelog section stored for a version of a package in a registry;
+// it is empty if none was stored
+func loadChangelog(registriesDir, registryName, packageName, version string) (string, error) {
+	return loadVersionText(registriesDir, registryName, packageName, version, "changelog.md", "changelog")
+}
+
+// loadReleaseNotes returns the release notes stored for a version of a package in a registry;
+// they are empty if none were stored
+func loadReleaseNotes(registriesDir, registryName, packageName, version string) (string, error) {
+	return loadVersionText(registriesDir, registryName, packageName, version, "notes.md", "release notes")
+}
+
+// loadVersionText returns the trimmed content of a text file in the directory of a version of a
+// package in a registry, or an empty string if the file does not exist
+func loadVersionText(registriesDir, registryName, packageName, version, file, what string) (string, error) {
+	packageDir, err := registryPackageDir(registriesDir, registryName, packageName)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(packageDir, version, file))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s of '%s@%s' in registry '%s': %w", what, packageName, version, registryName, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,36 @@
+package commands
+
+import "testing"
+
+func TestExtractChangelogSection(t *testing.T) {
+	changelog := `# Changelog
+
+## [Unreleased]
+- Work in progress
+
+## [1.2.0] - 2024-05-01
+### Added
+- Streaming parser
+
+## v1.1.0
+- Fixed a crash
+
+## 1.1.0-beta.1
+- Preview of the fix
+`
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"v1.2.0", "### Added\n- Streaming parser"},
+		{"v1.1.0", "- Fixed a crash"},
+		{"v1.1.0-beta.1", "- Preview of the fix"},
+		{"v1.0.0", ""},
+		{"v2.0.0", ""},
+	}
+	for _, tt := range tests {
+		if section := extractChangelogSection(changelog, tt.version); section != tt.expected {
+			t.Errorf("extractChangelogSection(%s) = %q, expected %q", tt.version, section, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// digestPrefix names the hash function of a package digest
+const digestPrefix = "sha256:"
+
+// packageDigest returns the digest of the files of a package: a hash over the Git mode, Git blob
+// and slash-separated path of every regular file and symbolic link, sorted by path. The same
+// digest is computed from a Git tree and from a materialized package, so that an archive can be
+// checked against the commit it was built from without a clone.
+func packageDigest(entries []string) string {
+	sort.Strings(entries)
+	hash := sha256.New()
+	for _, entry := range entries {
+		io.WriteString(hash, entry+"\n")
+	}
+	return digestPrefix + hex.EncodeToString(hash.Sum(nil))
+}
+
+// digestEntry formats a file of a package for its digest
+func digestEntry(mode, blob, relPath string) string {
+	return mode + " " + blob + " " + relPath
+}
+
+// treeDigest returns the digest of a package in the tree of a commit, or of its subdirectory, in
+// the repository in repoDir. It is empty for packages whose materialized files differ from their
+// tree: packages with submodules, whose files are not in the tree, packages with Git LFS files,
+// whose tree holds pointer files, and packages with symbolic links, which are materialized as
+// copies of their targets.
+func treeDigest(ctx context.Context, repoDir, sha1, subdir string) (string, error) {
+	// A pathspec instead of <sha1>:<subdir> also works if the subdirectory is a submodule
+	args := []string{"-r", "-z", sha1}
+	prefix := ""
+	if subdir != "" {
+		prefix = path.Clean(filepath.ToSlash(subdir)) + "/"
+		args = append(args, "--", prefix)
+	}
+	if _, err := GitCommand(ctx, repoDir, "grep", "-q", "filter=lfs", sha1, "--", ".gitattributes", "*/.gitattributes"); err == nil {
+		return "", nil
+	}
+	output, err := GitCommand(ctx, repoDir, "ls-tree", args...)
+	if err != nil {
+		return "", wrapGitError(repoDir, fmt.Sprintf("failed to list the files of %s", sha1), err)
+	}
+	var entries []string
+	for _, line := range strings.Split(output, "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, relPath, found := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 3 {
+			continue
+		}
+		if fields[1] == "commit" || fields[0] == "120000" {
+			return "", nil // A submodule or a symbolic link
+		}
+		if path.Base(relPath) == ".gitignore" {
+			continue // Not materialized
+		}
+		entries = append(entries, digestEntry(fields[0], fields[2], strings.TrimPrefix(relPath, prefix)))
+	}
+	return packageDigest(entries), nil
+}
+
+// directoryDigest returns the digest of a materialized package in dir, leaving out the files
+// that are not materialized from the tree
+func directoryDigest(dir string) (string, error) {
+	var entries []string
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() == ".git" || info.Name() == ".gitignore" || info.Name() == packageMetaFile {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, digestEntry("120000", gitBlobID([]byte(filepath.ToSlash(target))), filepath.ToSlash(relPath)))
+		case info.Mode().IsRegular():
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			mode := "100644"
+			if info.Mode().Perm()&0100 != 0 {
+				mode = "100755"
+			}
+			entries = append(entries, digestEntry(mode, gitBlobID(data), filepath.ToSlash(relPath)))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to compute the digest of %s: %w", dir, err)
+	}
+	return packageDigest(entries), nil
+}
+
+// gitBlobID returns the Git object ID of a blob with the given content
+func gitBlobID(data []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(data))
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordPackageDigest records the digest of a version, as of its release commit in the repository
+// in repoDir, in the specs.json of the version in a registry; nothing is recorded for packages
+// whose digest cannot be computed from the tree
+func recordPackageDigest(ctx context.Context, repoDir, sha1, subdir, versionDir string) error {
+	digest, err := treeDigest(ctx, repoDir, sha1, subdir)
+	if err != nil || digest == "" {
+		return err
+	}
+	specsFile := filepath.Join(versionDir, "specs.json")
+	specs, err := loadSpecsFile(specsFile)
+	if err != nil {
+		return err
+	}
+	specs.Digest = digest
+	return saveSpecs(specs, specsFile)
+}
@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"bytes"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// writeEditorPaths writes .cosm/paths.json with absolute paths to the sources of the project and
+// of every resolved dependency, so that editors can resolve imports without an activated shell
+func writeEditorPaths(cosmDir string, languages, srcDirs []string, buildList *types.BuildList) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	paths := types.EditorPaths{Root: root, Sources: []string{}, Dependencies: []types.EditorDependency{}, SearchPaths: make(map[string]string)}
+	for _, srcDir := range srcDirs {
+		if !filepath.IsAbs(srcDir) {
+			srcDir = filepath.Join(root, srcDir)
+		}
+		paths.Sources = append(paths.Sources, srcDir)
+	}
+
+	// The search paths are computed like the environment, but with absolute source directories
+	env, err := buildEnvironment(cosmDir, languages, paths.Sources, buildList)
+	if err != nil {
+		return err
+	}
+	skip := map[string]bool{"COSM_PACKAGE_PATHS": true}
+	for _, dep := range buildList.Dependencies {
+		if dep.Path == "" {
+			continue
+		}
+		skip[packageEnvName(dependencyImportName(dep))+"_PATH"] = true
+		path := packagePath(cosmDir, dep)
+		paths.Dependencies = append(paths.Dependencies, types.EditorDependency{
+			Name:    dep.Name,
+			Import:  dependencyImportName(dep),
+			UUID:    dep.UUID,
+			Version: dep.Version,
+			Path:    path,
+			Src:     filepath.Join(path, "src"),
+		})
+	}
+	for _, v := range env {
+		if !skip[v.name] {
+			paths.SearchPaths[v.name] = v.value
+		}
+	}
+	sort.Slice(paths.Dependencies, func(i, j int) bool {
+		if paths.Dependencies[i].Import != paths.Dependencies[j].Import {
+			return paths.Dependencies[i].Import < paths.Dependencies[j].Import
+		}
+		return paths.Dependencies[i].Version < paths.Dependencies[j].Version
+	})
+
+	data, err := json.MarshalIndent(paths, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal .cosm/paths.json: %w", err)
+	}
+	if err := writeFileAtomically(filepath.Join(".cosm", "paths.json"), bytes.NewReader(append(data, '\n'))); err != nil {
+		return fmt.Errorf("failed to write .cosm/paths.json: %w", err)
+	}
+	return nil
+}
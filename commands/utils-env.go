@@ -0,0 +1,201 @@
+package commands
+
+import (
+	"cosm/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envVar is a single exported environment variable
+type envVar struct {
+	name  string
+	value string
+}
+
+// buildEnvironment computes the variables exported by an activated environment:
+// COSM_PACKAGE_PATHS with all resolved package paths, a <NAME>_PATH variable per
+// dependency, and the search path variables of the project languages.
+func buildEnvironment(cosmDir string, languages, srcDirs []string, buildList *types.BuildList) ([]envVar, error) {
+	// Collect the source directories of the project and its subfolders
+	var localDirs []string
+	for _, srcDir := range srcDirs {
+		localDirs = append(localDirs, srcDir)
+		entries, err := os.ReadDir(srcDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read src dir: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				localDirs = append(localDirs, filepath.Join(srcDir, entry.Name()))
+			}
+		}
+	}
+
+	// Resolve dependencies in a stable order
+	deps := make([]types.BuildListDependency, 0, len(buildList.Dependencies))
+	for _, dep := range buildList.Dependencies {
+		if dep.Path != "" {
+			deps = append(deps, dep)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if nameI, nameJ := dependencyImportName(deps[i]), dependencyImportName(deps[j]); nameI != nameJ {
+			return nameI < nameJ
+		}
+		return deps[i].Version < deps[j].Version
+	})
+
+	var env []envVar
+	var packagePaths, depSrcDirs []string
+	for _, dep := range deps {
+		packagePaths = append(packagePaths, packagePath(cosmDir, dep))
+		depSrcDirs = append(depSrcDirs, filepath.Join(packagePath(cosmDir, dep), "src"))
+	}
+	env = append(env, envVar{"COSM_PACKAGE_PATHS", strings.Join(packagePaths, string(os.PathListSeparator))})
+	for _, dep := range deps {
+		env = append(env, envVar{packageEnvName(dependencyImportName(dep)) + "_PATH", packagePath(cosmDir, dep)})
+	}
+
+	// Language-specific search paths; the same variable is only written once
+	written := make(map[string]bool)
+	for _, language := range languages {
+		for _, v := range languageEnvironment(language, localDirs, depSrcDirs) {
+			if !written[v.name] {
+				written[v.name] = true
+				env = append(env, v)
+			}
+		}
+	}
+	return env, nil
+}
+
+// dependencyReference matches ${dep:<name>} or ${dep:<name>@<major version>} in the value of an
+// environment variable defined in Project.json
+var dependencyReference = regexp.MustCompile(`\$\{dep:([^}]*)\}`)
+
+// projectEnvironment resolves the environment variables defined in Project.json, sorted by name,
+// replacing every dependency reference with the absolute path of that dependency in the build list
+func projectEnvironment(cosmDir string, defined map[string]string, buildList *types.BuildList) ([]envVar, error) {
+	var deps []types.BuildListDependency
+	for _, dep := range buildList.Dependencies {
+		if dep.Path != "" {
+			deps = append(deps, dep)
+		}
+	}
+	names := make([]string, 0, len(defined))
+	for name := range defined {
+		if strings.HasPrefix(strings.ToUpper(name), "COSM_") {
+			return nil, validationError("environment variable '%s' in Project.json: names starting with COSM_ are reserved for cosm", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var env []envVar
+	for _, name := range names {
+		var resolveErr error
+		value := dependencyReference.ReplaceAllStringFunc(defined[name], func(reference string) string {
+			dep, err := findBuildListDependency(deps, dependencyReference.FindStringSubmatch(reference)[1])
+			if err == nil {
+				var path string
+				if path, err = dependencyPath(cosmDir, dep); err == nil {
+					return path
+				}
+			}
+			if resolveErr == nil {
+				resolveErr = fmt.Errorf("failed to resolve %s in environment variable '%s': %w", reference, name, err)
+			}
+			return reference
+		})
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		env = append(env, envVar{name, value})
+	}
+	return env, nil
+}
+
+// mergeEnvironment returns the variables of env with the values of overrides, which replace
+// variables of the same name and are appended otherwise
+func mergeEnvironment(env, overrides []envVar) []envVar {
+	merged := append([]envVar{}, env...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].name == override.name {
+				merged[i].value = override.value
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+// dependencyImportName returns the alias of a dependency, or its package name if it has none
+func dependencyImportName(dep types.BuildListDependency) string {
+	if dep.Alias != "" {
+		return dep.Alias
+	}
+	return dep.Name
+}
+
+// packagePath returns the location of a dependency: its path in the depot, or the absolute
+// path of a vendored copy
+func packagePath(cosmDir string, dep types.BuildListDependency) string {
+	if filepath.IsAbs(dep.Path) {
+		return dep.Path
+	}
+	return filepath.Join(cosmDir, dep.Path)
+}
+
+// languageEnvironment returns the module search path variables for a project language. Every
+// project gets the Terra and Lua search paths; some languages add search paths of their own.
+func languageEnvironment(language string, localDirs, depSrcDirs []string) []envVar {
+	env := []envVar{
+		{"TERRA_PATH", searchPath(localDirs, depSrcDirs, "?.t")},
+		{"LUA_PATH", searchPath(localDirs, depSrcDirs, "?.lua")},
+	}
+	switch strings.ToLower(language) {
+	case "python":
+		dirs := append(append([]string{}, localDirs...), depSrcDirs...)
+		env = append(env, envVar{"PYTHONPATH", strings.Join(dirs, string(os.PathListSeparator))})
+	}
+	return env
+}
+
+// searchPath builds a Lua-style search path (e.g., "src/?.t;...;;"). Only the top-level
+// source directory of each dependency is included.
+func searchPath(localDirs, depSrcDirs []string, pattern string) string {
+	var paths []string
+	for _, dir := range localDirs {
+		paths = append(paths, filepath.Join(dir, pattern))
+	}
+	for _, dir := range depSrcDirs {
+		paths = append(paths, filepath.Join(dir, pattern))
+	}
+	return strings.Join(paths, ";") + ";;"
+}
+
+// packageEnvName converts a package name into an environment variable name
+func packageEnvName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	envName := b.String()
+	if envName != "" && envName[0] >= '0' && envName[0] <= '9' {
+		return "_" + envName
+	}
+	return envName
+}
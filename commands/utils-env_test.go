@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"cosm/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildEnvironment(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	if err := os.MkdirAll(filepath.Join(srcDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	cosmDir := filepath.Join(tempDir, ".cosm")
+	buildList := types.BuildList{Dependencies: map[string]types.BuildListDependency{
+		"uuid-b@v1": {Name: "my-lib", Path: "packages/my-lib/sha-b"},
+		"uuid-a@v1": {Name: "Alpha", Path: "packages/Alpha/sha-a"},
+	}}
+
+	env, err := buildEnvironment(cosmDir, []string{"python"}, []string{srcDir}, &buildList)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	alphaPath := filepath.Join(cosmDir, "packages/Alpha/sha-a")
+	libPath := filepath.Join(cosmDir, "packages/my-lib/sha-b")
+	sep := string(os.PathListSeparator)
+	expected := []envVar{
+		{"COSM_PACKAGE_PATHS", alphaPath + sep + libPath},
+		{"ALPHA_PATH", alphaPath},
+		{"MY_LIB_PATH", libPath},
+		{"TERRA_PATH", searchPath([]string{srcDir, filepath.Join(srcDir, "sub")}, []string{filepath.Join(alphaPath, "src"), filepath.Join(libPath, "src")}, "?.t")},
+		{"LUA_PATH", searchPath([]string{srcDir, filepath.Join(srcDir, "sub")}, []string{filepath.Join(alphaPath, "src"), filepath.Join(libPath, "src")}, "?.lua")},
+		{"PYTHONPATH", srcDir + sep + filepath.Join(srcDir, "sub") + sep + filepath.Join(alphaPath, "src") + sep + filepath.Join(libPath, "src")},
+	}
+	if len(env) != len(expected) {
+		t.Fatalf("Expected %d variables, got %d: %v", len(expected), len(env), env)
+	}
+	for i, v := range expected {
+		if env[i] != v {
+			t.Errorf("Expected variable %d to be %v, got %v", i, v, env[i])
+		}
+	}
+}
+
+func TestBuildEnvironmentAlias(t *testing.T) {
+	cosmDir := t.TempDir()
+	buildList := types.BuildList{Dependencies: map[string]types.BuildListDependency{
+		"uuid-a@v2": {Name: "mypkg", Version: "v2.0.0", Path: "packages/mypkg/sha-2"},
+		"uuid-a@v1": {Name: "mypkg", Version: "v1.3.0", Path: "packages/mypkg/sha-1", Alias: "legacy_mypkg"},
+	}}
+
+	env, err := buildEnvironment(cosmDir, []string{"cobol"}, nil, &buildList)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	legacyPath := filepath.Join(cosmDir, "packages/mypkg/sha-1")
+	currentPath := filepath.Join(cosmDir, "packages/mypkg/sha-2")
+	expected := []envVar{
+		{"COSM_PACKAGE_PATHS", legacyPath + string(os.PathListSeparator) + currentPath},
+		{"LEGACY_MYPKG_PATH", legacyPath},
+		{"MYPKG_PATH", currentPath},
+		{"TERRA_PATH", filepath.Join(legacyPath, "src", "?.t") + ";" + filepath.Join(currentPath, "src", "?.t") + ";;"},
+		{"LUA_PATH", filepath.Join(legacyPath, "src", "?.lua") + ";" + filepath.Join(currentPath, "src", "?.lua") + ";;"},
+	}
+	if len(env) != len(expected) {
+		t.Fatalf("Expected %d variables, got %d: %v", len(expected), len(env), env)
+	}
+	for i, v := range expected {
+		if env[i] != v {
+			t.Errorf("Expected variable %d to be %v, got %v", i, v, env[i])
+		}
+	}
+}
+
+func TestProjectEnvironment(t *testing.T) {
+	cosmDir := t.TempDir()
+	buildList := types.BuildList{Dependencies: map[string]types.BuildListDependency{
+		"uuid-a@v2": {Name: "mypkg", Version: "v2.0.0", Path: "packages/mypkg/sha-2"},
+		"uuid-a@v1": {Name: "mypkg", Version: "v1.3.0", Path: "packages/mypkg/sha-1", Alias: "legacy_mypkg"},
+	}}
+
+	env, err := projectEnvironment(cosmDir, map[string]string{
+		"LDFLAGS": "-L${dep:mypkg@v2}/lib -L${dep:legacy_mypkg}/lib",
+		"CC":      "clang",
+	}, &buildList)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []envVar{
+		{"CC", "clang"},
+		{"LDFLAGS", "-L" + filepath.Join(cosmDir, "packages/mypkg/sha-2") + "/lib -L" + filepath.Join(cosmDir, "packages/mypkg/sha-1") + "/lib"},
+	}
+	if len(env) != len(expected) {
+		t.Fatalf("Expected %d variables, got %d: %v", len(expected), len(env), env)
+	}
+	for i, v := range expected {
+		if env[i] != v {
+			t.Errorf("Expected variable %d to be %v, got %v", i, v, env[i])
+		}
+	}
+
+	// A reference by name alone is ambiguous between the major versions of the package
+	if _, err := projectEnvironment(cosmDir, map[string]string{"LDFLAGS": "-L${dep:mypkg}/lib"}, &buildList); err == nil {
+		t.Error("Expected an error for an ambiguous reference")
+	}
+	if _, err := projectEnvironment(cosmDir, map[string]string{"LDFLAGS": "-L${dep:other}/lib"}, &buildList); err == nil {
+		t.Error("Expected an error for a package outside the build list")
+	}
+	if _, err := projectEnvironment(cosmDir, map[string]string{"COSM_PACKAGE_PATHS": ""}, &buildList); err == nil {
+		t.Error("Expected an error for a reserved name")
+	}
+
+	merged := mergeEnvironment([]envVar{{"A", "1"}, {"B", "2"}}, []envVar{{"B", "3"}, {"C", "4"}})
+	if len(merged) != 3 || merged[1] != (envVar{"B", "3"}) || merged[2] != (envVar{"C", "4"}) {
+		t.Errorf("Expected B to be overridden and C to be appended, got %v", merged)
+	}
+}
+
+func TestLanguageEnvironment(t *testing.T) {
+	tests := []struct {
+		language string
+		expected []string
+	}{
+		{"", []string{"TERRA_PATH", "LUA_PATH"}},
+		{"terra", []string{"TERRA_PATH", "LUA_PATH"}},
+		{"lua", []string{"TERRA_PATH", "LUA_PATH"}},
+		{"python", []string{"TERRA_PATH", "LUA_PATH", "PYTHONPATH"}},
+		// Languages without search paths of their own still get the Terra and Lua search paths
+		{"cobol", []string{"TERRA_PATH", "LUA_PATH"}},
+	}
+	for _, tt := range tests {
+		env := languageEnvironment(tt.language, []string{"src"}, nil)
+		if len(env) != len(tt.expected) {
+			t.Errorf("language %q: expected %v, got %v", tt.language, tt.expected, env)
+			continue
+		}
+		for i, name := range tt.expected {
+			if env[i].name != name {
+				t.Errorf("language %q: expected variable %s, got %s", tt.language, name, env[i].name)
+			}
+		}
+	}
+	if got := languageEnvironment("lua", []string{"src"}, []string{"dep/src"})[1].value; got != "src/?.lua;dep/src/?.lua;;" {
+		t.Errorf("Expected LUA_PATH %q, got %q", "src/?.lua;dep/src/?.lua;;", got)
+	}
+}
@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"cosm/types"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// dependencyName returns the alias of a dependency in Project.json or specs, or its package name
+// if it has none; features refer to dependencies by this name
+func dependencyName(dep types.Dependency) string {
+	if dep.Alias != "" {
+		return dep.Alias
+	}
+	return dep.Name
+}
+
+// featureDependencies returns the dependencies of a package version that are active with the given
+// features enabled: the required dependencies, and the optional dependencies that an enabled feature
+// turns on. An optional dependency is also a feature of its own name. The features that enabled
+// features request of dependencies (<dependency>/<feature>) are added to their Features. Features
+// that the package does not declare are returned separately and otherwise ignored.
+func featureDependencies(specs types.Specs, enabled []string) (map[string]types.Dependency, []string) {
+	keyByName := make(map[string]string, len(specs.Deps))
+	for key, dep := range specs.Deps {
+		keyByName[dependencyName(dep)] = key
+	}
+	active := make(map[string]bool)        // Keys of enabled optional dependencies
+	requested := make(map[string][]string) // Features requested of dependencies, by key
+	seen := make(map[string]bool)
+	var unknown []string
+	pending := slices.Clone(enabled)
+	for len(pending) > 0 {
+		feature := pending[0]
+		pending = pending[1:]
+		if seen[feature] {
+			continue
+		}
+		seen[feature] = true
+		entries, declared := specs.Features[feature]
+		if !declared {
+			if key, isDep := keyByName[feature]; isDep && specs.Deps[key].Optional {
+				active[key] = true
+			} else {
+				unknown = append(unknown, feature)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if depName, depFeature, found := strings.Cut(entry, "/"); found {
+				if key, isDep := keyByName[depName]; isDep {
+					active[key] = true
+					requested[key] = append(requested[key], depFeature)
+				}
+				continue
+			}
+			pending = append(pending, entry)
+		}
+	}
+
+	deps := make(map[string]types.Dependency, len(specs.Deps))
+	for key, dep := range specs.Deps {
+		if dep.Optional && !active[key] {
+			continue
+		}
+		dep.Features = mergeFeatures(dep.Features, requested[key])
+		deps[key] = dep
+	}
+	sort.Strings(unknown)
+	return deps, unknown
+}
+
+// mergeFeatures returns the sorted union of two lists of features, or nil if both are empty
+func mergeFeatures(a, b []string) []string {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+	merged := append(slices.Clone(a), b...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// validateFeatures checks the features of a project: their names have the same form as an alias,
+// and every entry refers to a feature, a dependency, or a feature of a dependency
+func validateFeatures(project *types.Project) error {
+	names := make(map[string]types.Dependency, len(project.Deps))
+	for _, dep := range project.Deps {
+		names[dependencyName(dep)] = dep
+	}
+	for _, feature := range sortedFeatureNames(project.Features) {
+		if !aliasPattern.MatchString(feature) {
+			return validationError("invalid feature '%s': must start with a letter and contain only letters, digits, '-' and '_'", feature)
+		}
+		if dep, isDep := names[feature]; isDep && !dep.Optional {
+			return validationError("feature '%s' has the name of dependency '%s', which is not optional", feature, dep.Name)
+		}
+		for _, entry := range project.Features[feature] {
+			depName, _, isDepFeature := strings.Cut(entry, "/")
+			if isDepFeature {
+				if _, isDep := names[depName]; !isDep {
+					return validationError("feature '%s' enables '%s', but '%s' is not a dependency", feature, entry, depName)
+				}
+				continue
+			}
+			_, isFeature := project.Features[entry]
+			if dep, isDep := names[entry]; !isFeature && (!isDep || !dep.Optional) {
+				return validationError("feature '%s' enables '%s', which is neither a feature nor an optional dependency", feature, entry)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRequestedFeatures checks that a package version declares the features requested of it
+func validateRequestedFeatures(specs types.Specs, features []string) error {
+	if _, unknown := featureDependencies(specs, features); len(unknown) > 0 {
+		return notFoundError("package '%s' %s has no feature %s", specs.Name, specs.Version, quoteFeatures(unknown))
+	}
+	return nil
+}
+
+// sortedFeatureNames returns the names of the features of a package in order
+func sortedFeatureNames(features map[string][]string) []string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// quoteFeatures formats features as a quoted, comma-separated list for messages
+func quoteFeatures(features []string) string {
+	quoted := make([]string, len(features))
+	for i, feature := range features {
+		quoted[i] = fmt.Sprintf("'%s'", feature)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"cosm/types"
+	"slices"
+	"testing"
+)
+
+func TestFeatureDependencies(t *testing.T) {
+	specs := types.Specs{
+		Name:    "lib",
+		Version: "v1.0.0",
+		Deps: map[string]types.Dependency{
+			"a@v1": {Name: "a", Version: "v1.0.0"},
+			"b@v1": {Name: "b", Version: "v1.0.0", Optional: true},
+			"c@v1": {Name: "c", Version: "v1.0.0", Optional: true, Alias: "cee"},
+			"d@v1": {Name: "d", Version: "v1.0.0", Features: []string{"fast"}},
+		},
+		Features: map[string][]string{
+			"full": {"b", "json"},
+			"json": {"cee/json", "d/json"},
+		},
+	}
+	tests := []struct {
+		name     string
+		enabled  []string
+		keys     []string
+		features map[string][]string
+		unknown  []string
+	}{
+		{"none", nil, []string{"a@v1", "d@v1"}, map[string][]string{"d@v1": {"fast"}}, nil},
+		{"implicit", []string{"b"}, []string{"a@v1", "b@v1", "d@v1"}, nil, nil},
+		{"nested", []string{"full"}, []string{"a@v1", "b@v1", "c@v1", "d@v1"}, map[string][]string{"c@v1": {"json"}, "d@v1": {"fast", "json"}}, nil},
+		{"unknown", []string{"xml", "a"}, []string{"a@v1", "d@v1"}, nil, []string{"a", "xml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, unknown := featureDependencies(specs, tt.enabled)
+			if keys := sortedDependencyKeys(deps); !slices.Equal(keys, tt.keys) {
+				t.Errorf("Expected dependencies %v, got %v", tt.keys, keys)
+			}
+			for key, want := range tt.features {
+				if got := deps[key].Features; !slices.Equal(got, want) {
+					t.Errorf("Expected features %v for %s, got %v", want, key, got)
+				}
+			}
+			if !slices.Equal(unknown, tt.unknown) {
+				t.Errorf("Expected unknown features %v, got %v", tt.unknown, unknown)
+			}
+		})
+	}
+}
+
+func TestValidateFeatures(t *testing.T) {
+	deps := map[string]types.Dependency{
+		"a@v1": {Name: "a", Version: "v1.0.0"},
+		"b@v1": {Name: "b", Version: "v1.0.0", Optional: true},
+	}
+	tests := []struct {
+		name     string
+		features map[string][]string
+		valid    bool
+	}{
+		{"valid", map[string][]string{"full": {"b", "extra", "a/json"}, "extra": {}}, true},
+		{"invalid_name", map[string][]string{"no good": {"b"}}, false},
+		{"required_dependency", map[string][]string{"full": {"a"}}, false},
+		{"unknown_entry", map[string][]string{"full": {"c"}}, false},
+		{"unknown_dependency", map[string][]string{"full": {"c/json"}}, false},
+		{"shadows_dependency", map[string][]string{"a": {"b"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFeatures(&types.Project{Name: "lib", Deps: deps, Features: tt.features})
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
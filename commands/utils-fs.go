@@ -2,6 +2,9 @@ package commands
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"encoding/json"
 	"fmt"
@@ -9,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // setupRegistriesDir constructs the registries directory path
@@ -28,11 +33,11 @@ func getCosmDir() (string, error) {
 func getRegistriesDir() (string, error) {
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get cosm directory: %v", err)
+		return "", fmt.Errorf("failed to get cosm directory: %w", err)
 	}
 	registriesDir := filepath.Join(cosmDir, "registries")
 	if err := os.MkdirAll(registriesDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create registries directory %s: %v", registriesDir, err)
+		return "", fmt.Errorf("failed to create registries directory %s: %w", registriesDir, err)
 	}
 	return registriesDir, nil
 }
@@ -67,7 +72,7 @@ func SplitPathComponents(path string) (parentDir, directory string, err error) {
 }
 
 // initializeCosmDir sets up the .cosm directory with essential files and folders
-func InitializeCosm() error {
+func InitializeCosm(ctx context.Context) error {
 
 	validDepotVar := verifyCosmDepotVar()
 	validDepotDir := verifyCosmDepot()
@@ -84,7 +89,7 @@ func InitializeCosm() error {
 	}
 
 	if !validDepotDir {
-		if err := initializeCosmDepot(); err != nil {
+		if err := initializeCosmDepot(ctx); err != nil {
 			return err
 		}
 	}
@@ -139,18 +144,24 @@ func initializeCosmDepotVar() error {
 	// Get default .cosm path
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
+		return fmt.Errorf("failed to get home directory: %w", err)
 	}
 	defaultPath := filepath.Join(homeDir, ".cosm")
 
-	// Prompt for location
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Printf("COSM_DEPOT_PATH is not set or invalid. Enter the location for the .cosm directory (default: %s): ", defaultPath)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read input: %v", err)
+	// Prompt for location, unless the default is accepted
+	input := ""
+	if !answerYes() {
+		if inputDisabled() {
+			return inputRequiredError("COSM_DEPOT_PATH is not set; export it, or use --yes to create the depot in %s", defaultPath)
+		}
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Printf("COSM_DEPOT_PATH is not set or invalid. Enter the location for the .cosm directory (default: %s): ", defaultPath)
+		input, err = reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		input = strings.TrimSpace(input)
 	}
-	input = strings.TrimSpace(input)
 
 	// Use default if input is empty
 	depotPath := defaultPath
@@ -159,7 +170,7 @@ func initializeCosmDepotVar() error {
 		if !filepath.IsAbs(depotPath) {
 			depotPath, err = filepath.Abs(depotPath)
 			if err != nil {
-				return fmt.Errorf("failed to resolve absolute path for %s: %v", input, err)
+				return fmt.Errorf("failed to resolve absolute path for %s: %w", input, err)
 			}
 		}
 	}
@@ -167,72 +178,76 @@ func initializeCosmDepotVar() error {
 	// Check if depotPath already exists
 	if _, err := os.Stat(depotPath); !os.IsNotExist(err) {
 		if err != nil {
-			return fmt.Errorf("failed to check if %s exists: %v", depotPath, err)
+			return fmt.Errorf("failed to check if %s exists: %w", depotPath, err)
 		}
 		return fmt.Errorf("directory %s already exists; please choose a new location", depotPath)
 	}
 
 	// Set COSM_DEPOT_PATH for the current process
 	if err := os.Setenv("COSM_DEPOT_PATH", depotPath); err != nil {
-		return fmt.Errorf("failed to set COSM_DEPOT_PATH: %v", err)
+		return fmt.Errorf("failed to set COSM_DEPOT_PATH: %w", err)
 	}
 
 	// Create the cosm depot path
 	if err := os.MkdirAll(depotPath, 0755); err != nil {
-		return fmt.Errorf("failed to create cosm depot path %s: %v", depotPath, err)
+		return fmt.Errorf("failed to create cosm depot path %s: %w", depotPath, err)
 	}
 
 	// Update shell profile
 	if err := updateShellProfile(depotPath); err != nil {
-		return fmt.Errorf("failed to update shell profile: %v", err)
+		return fmt.Errorf("failed to update shell profile: %w", err)
 	}
 
 	// Print confirmation with export instruction
 	fmt.Printf("COSM_DEPOT_PATH set to %s and added to shell profile\n", depotPath)
-	fmt.Printf("To apply COSM_DEPOT_PATH in the current session, run: export COSM_DEPOT_PATH=%q\n", depotPath)
+	fmt.Printf("To apply COSM_DEPOT_PATH in the current session, run: %s", shellExportLine(detectShell(), "COSM_DEPOT_PATH", depotPath))
 	return nil
 }
 
 // initializeCosmDir sets up the .cosm directory with essential files and folders
-func initializeCosmDepot() error {
+func initializeCosmDepot(ctx context.Context) error {
 
 	// get the cosm depot path
 	cosmDir, err := getCosmDir()
 	if err != nil {
-		return fmt.Errorf("failed to get cosm directory: %v", err)
+		return fmt.Errorf("failed to get cosm directory: %w", err)
 	}
 
 	// Create registries directory
 	registriesDir := setupRegistriesDir(cosmDir)
 	if err := os.MkdirAll(registriesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create registries directory %s: %v", registriesDir, err)
+		return fmt.Errorf("failed to create registries directory %s: %w", registriesDir, err)
 	}
 
 	// Create empty registries.json if it doesn't exist
 	registriesFile := filepath.Join(registriesDir, "registries.json")
 	if _, err := os.Stat(registriesFile); os.IsNotExist(err) {
-		if err := os.WriteFile(registriesFile, []byte("[]"), 0644); err != nil {
-			return fmt.Errorf("failed to create registries.json: %v", err)
+		if err := writeMetadataFile(registriesFile, []byte("[]")); err != nil {
+			return fmt.Errorf("failed to create registries.json: %w", err)
 		}
 	} else if err != nil {
-		return fmt.Errorf("failed to stat registries.json: %v", err)
+		return fmt.Errorf("failed to stat registries.json: %w", err)
 	}
 
-	// Clone cosm-templates repository
-	if _, err := clone("https://github.com/simkinetic/cosm-templates.git", cosmDir, "templates"); err != nil {
-		return fmt.Errorf("failed to clone cosm-templates repository: %v", err)
+	// Clone the default templates; if that fails (e.g., offline), they are cloned on first use
+	if err := ensureDefaultTemplates(ctx, cosmDir); err != nil {
+		logging.Warnf("%v; the templates are cloned on first use", err)
+	}
+	templatesDir := filepath.Join(cosmDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create templates directory %s: %w", templatesDir, err)
 	}
 
 	// Create clones directory
 	clonesDir := filepath.Join(cosmDir, "clones")
 	if err := os.MkdirAll(clonesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create clones directory %s: %v", clonesDir, err)
+		return fmt.Errorf("failed to create clones directory %s: %w", clonesDir, err)
 	}
 
 	// Create packages directory
 	packagesDir := filepath.Join(cosmDir, "packages")
 	if err := os.MkdirAll(packagesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create packages directory %s: %v", packagesDir, err)
+		return fmt.Errorf("failed to create packages directory %s: %w", packagesDir, err)
 	}
 
 	return nil
@@ -248,38 +263,55 @@ func updateShellProfile(depotPath string) error {
 	// Check if COSM_DEPOT_PATH is already set in the profile
 	content, err := os.ReadFile(profilePath)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to read shell profile %s: %v", profilePath, err)
+		return fmt.Errorf("failed to read shell profile %s: %w", profilePath, err)
 	}
-	if strings.Contains(string(content), "export COSM_DEPOT_PATH=") {
+	if strings.Contains(string(content), "export COSM_DEPOT_PATH=") || strings.Contains(string(content), "set -gx COSM_DEPOT_PATH ") || strings.Contains(string(content), "$env:COSM_DEPOT_PATH = ") {
 		return nil // Already set
 	}
 
 	// Append export statement
 	f, err := os.OpenFile(profilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open shell profile %s: %v", profilePath, err)
+		return fmt.Errorf("failed to open shell profile %s: %w", profilePath, err)
 	}
 	defer f.Close()
-	if _, err := f.WriteString(fmt.Sprintf("\nexport COSM_DEPOT_PATH=%q\n", depotPath)); err != nil {
-		return fmt.Errorf("failed to write to shell profile %s: %v", profilePath, err)
+	if _, err := f.WriteString("\n" + shellExportLine(detectShell(), "COSM_DEPOT_PATH", depotPath)); err != nil {
+		return fmt.Errorf("failed to write to shell profile %s: %w", profilePath, err)
 	}
 
 	return nil
 }
 
-// getShellProfilePath determines the appropriate shell profile file (.bash_profile or .zprofile)
+// getShellProfilePath determines the appropriate shell profile file (.bash_profile, .zprofile, fish
+// config.fish, or the PowerShell profile in Documents)
 func getShellProfilePath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %v", err)
+		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	// Check shell type
-	shell := os.Getenv("SHELL")
 	var profilePath string
-	if strings.Contains(shell, "zsh") {
+	switch detectShell() {
+	case "zsh":
 		profilePath = filepath.Join(homeDir, ".zprofile")
-	} else {
+	case "fish":
+		profileDir := filepath.Join(homeDir, ".config", "fish")
+		if err := os.MkdirAll(profileDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create fish config directory %s: %w", profileDir, err)
+		}
+		profilePath = filepath.Join(profileDir, "config.fish")
+	case "powershell":
+		// PowerShell 7 and Windows PowerShell read their profile from different directories
+		profileDir := filepath.Join(homeDir, "Documents", "WindowsPowerShell")
+		if powershellExecutable() == "pwsh" {
+			profileDir = filepath.Join(homeDir, "Documents", "PowerShell")
+		}
+		if err := os.MkdirAll(profileDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create PowerShell profile directory %s: %w", profileDir, err)
+		}
+		profilePath = filepath.Join(profileDir, "Microsoft.PowerShell_profile.ps1")
+	default:
 		profilePath = filepath.Join(homeDir, ".bash_profile")
 	}
 
@@ -294,11 +326,11 @@ func loadRegistryNames(registriesDir string) ([]string, error) {
 	}
 	data, err := os.ReadFile(registriesFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read registries.json: %v", err)
+		return nil, fmt.Errorf("failed to read registries.json: %w", err)
 	}
 	var registryNames []string
-	if err := json.Unmarshal(data, &registryNames); err != nil {
-		return nil, fmt.Errorf("failed to parse registries.json: %v", err)
+	if err := unmarshalValidated("registries.schema.json", data, &registryNames); err != nil {
+		return nil, fmt.Errorf("failed to parse registries.json: %w", err)
 	}
 	if len(registryNames) == 0 {
 		return nil, fmt.Errorf("no registries available to search for packages")
@@ -311,11 +343,11 @@ func LoadRegistryMetadata(registriesDir, registryName string) (types.Registry, s
 	registryMetaFile := filepath.Join(registriesDir, registryName, "registry.json")
 	data, err := os.ReadFile(registryMetaFile)
 	if err != nil {
-		return types.Registry{}, "", fmt.Errorf("failed to read registry.json for '%s': %v", registryName, err)
+		return types.Registry{}, "", fmt.Errorf("failed to read registry.json for '%s': %w", registryName, err)
 	}
 	var registry types.Registry
-	if err := json.Unmarshal(data, &registry); err != nil {
-		return types.Registry{}, "", fmt.Errorf("failed to parse registry.json for '%s': %v", registryName, err)
+	if err := unmarshalValidated("registry.schema.json", data, &registry); err != nil {
+		return types.Registry{}, "", fmt.Errorf("failed to parse registry.json for '%s': %w", registryName, err)
 	}
 	if registry.Packages == nil {
 		registry.Packages = make(map[string]types.PackageInfo)
@@ -323,26 +355,61 @@ func LoadRegistryMetadata(registriesDir, registryName string) (types.Registry, s
 	return registry, registryMetaFile, nil
 }
 
-// ensureProjectFileDoesNotExist checks if Project.json already exists
+// projectTOMLFile is the project manifest in TOML, which a project can have instead of Project.json
+const projectTOMLFile = "cosm.toml"
+
+// projectFilePath returns the manifest that a path to Project.json refers to: the cosm.toml next
+// to it if the project has no Project.json but a cosm.toml, and the path itself otherwise
+func projectFilePath(filename string) string {
+	if filepath.Base(filename) != "Project.json" {
+		return filename
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		return filename
+	}
+	tomlFile := filepath.Join(filepath.Dir(filename), projectTOMLFile)
+	if _, err := os.Stat(tomlFile); err == nil {
+		return tomlFile
+	}
+	return filename
+}
+
+// ensureProjectFileDoesNotExist checks that the directory of a new project manifest has neither a
+// Project.json nor a cosm.toml yet
 func ensureProjectFileDoesNotExist(projectFile string) error {
-	if _, err := os.Stat(projectFile); !os.IsNotExist(err) {
-		return fmt.Errorf("Project.json already exists in this directory")
+	dir := filepath.Dir(projectFile)
+	for _, filename := range []string{filepath.Join(dir, "Project.json"), filepath.Join(dir, projectTOMLFile)} {
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			return conflictError("%s already exists in this directory", filepath.Base(filename))
+		}
 	}
 	return nil
 }
 
-// loadProject loads and parses Project.json from the specified file path.
+// loadProject loads and parses Project.json, or the cosm.toml that replaces it, from the specified file path.
 func loadProject(filename string) (*types.Project, error) {
+	filename = projectFilePath(filename)
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return nil, fmt.Errorf("no Project.json found at %s", filename)
 	}
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read Project.json at %s: %v", filename, err)
+		return nil, fmt.Errorf("failed to read %s at %s: %w", filepath.Base(filename), filename, err)
+	}
+	// The positions of values in JSON converted from TOML are meaningless
+	positions := true
+	if filepath.Ext(filename) == ".toml" {
+		if data, _, err = tomlToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s at %s: %w", filepath.Base(filename), filename, err)
+		}
+		positions = false
+	}
+	if err := validateJSONSchema("project.schema.json", data, positions); err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", filepath.Base(filename), filename, err)
 	}
 	var project types.Project
 	if err := json.Unmarshal(data, &project); err != nil {
-		return nil, fmt.Errorf("failed to parse Project.json at %s: %v", filename, err)
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", filepath.Base(filename), filename, err)
 	}
 	if project.Deps == nil {
 		project.Deps = make(map[string]types.Dependency)
@@ -355,14 +422,142 @@ func loadProjectFromDir(dir string) (*types.Project, error) {
 	return loadProject(filepath.Join(dir, "Project.json"))
 }
 
-// saveProject marshals the project to JSON and writes it to Project.json
+// saveProject marshals the project to JSON and writes it to Project.json, or to TOML if the
+// project has a cosm.toml instead; the comments of an existing cosm.toml are kept
 func saveProject(project *types.Project, filename string) error {
+	filename = projectFilePath(filename)
 	data, err := json.MarshalIndent(project, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal %s: %v", filename, err)
+		return fmt.Errorf("failed to marshal %s: %w", filename, err)
+	}
+	if filepath.Ext(filename) == ".toml" {
+		var comments tomlComments
+		if existing, err := os.ReadFile(filename); err == nil {
+			_, comments, _ = tomlToJSON(existing)
+		}
+		if data, err = jsonToTOML(data, comments); err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", filename, err)
+		}
+	}
+	if err := writeMetadataFile(filename, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
+
+// loadWorkspace loads and parses Workspace.json from the specified file path.
+func loadWorkspace(filename string) (*types.Workspace, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no Workspace.json found at %s", filename)
+		}
+		return nil, fmt.Errorf("failed to read Workspace.json at %s: %w", filename, err)
+	}
+	var workspace types.Workspace
+	if err := unmarshalValidated("workspace.schema.json", data, &workspace); err != nil {
+		return nil, fmt.Errorf("failed to parse Workspace.json at %s: %w", filename, err)
+	}
+	if workspace.Members == nil {
+		workspace.Members = []string{}
+	}
+	return &workspace, nil
+}
+
+// writeFileAtomically writes the content of a reader to a temporary file next to path and
+// renames it, so that an interrupted write leaves no partial file behind
+func writeFileAtomically(path string, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), tempDirPrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := io.Copy(tmpFile, content); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// Flush to disk before the rename, so a crash leaves either the old or the new file
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", path, err)
+	}
+	return nil
+}
+
+// backupSuffix is appended to the name of a metadata file to keep its previous version
+const backupSuffix = ".bak"
+
+// backupFile returns where writeMetadataFile keeps the previous version of a file. Files of a
+// project or workspace keep it in .cosm/backups of its root, so that backups do not show up in
+// the git status of the project; the metadata of the depot and its registries, and files outside
+// of projects, keep it next to them, where registry commits leave it out.
+func backupFile(filename string) string {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return filename + backupSuffix
+	}
+	if cosmDir, err := getCosmDir(); err == nil {
+		if relPath, err := filepath.Rel(cosmDir, absPath); err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return filename + backupSuffix
+		}
+	}
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		for _, root := range []string{"Project.json", "Workspace.json"} {
+			if _, err := os.Stat(filepath.Join(dir, root)); err == nil {
+				relPath, _ := filepath.Rel(dir, absPath)
+				return filepath.Join(dir, ".cosm", "backups", relPath+backupSuffix)
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return filename + backupSuffix
+		}
+	}
+}
+
+// writeMetadataFile atomically replaces a metadata file with data, keeping the previous
+// version of the file as its backupFile
+func writeMetadataFile(filename string, data []byte) error {
+	previous, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	existed := err == nil
+	if existed && bytes.Equal(previous, data) {
+		return nil
+	}
+	if existed {
+		if err := writeFileAtomically(backupFile(filename), bytes.NewReader(previous)); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", filename, err)
+		}
+	}
+	if err := writeFileAtomically(filename, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	recordFileChange(filename, previous, existed, data)
+	return nil
+}
+
+// saveWorkspace marshals the workspace to JSON and writes it to Workspace.json
+func saveWorkspace(workspace *types.Workspace, filename string) error {
+	data, err := json.MarshalIndent(workspace, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filename, err)
 	}
-	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("failed to write %s: %v", filename, err)
+	if err := writeMetadataFile(filename, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
 	}
 	return nil
 }
@@ -371,11 +566,11 @@ func saveProject(project *types.Project, filename string) error {
 func saveRegistryNames(registryNames []string, registriesDir string) error {
 	data, err := json.MarshalIndent(registryNames, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal registries.json: %v", err)
+		return fmt.Errorf("failed to marshal registries.json: %w", err)
 	}
 	registriesFile := filepath.Join(registriesDir, "registries.json")
-	if err := os.WriteFile(registriesFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write registries.json: %v", err)
+	if err := writeMetadataFile(registriesFile, data); err != nil {
+		return fmt.Errorf("failed to write registries.json: %w", err)
 	}
 	return nil
 }
@@ -384,10 +579,10 @@ func saveRegistryNames(registryNames []string, registriesDir string) error {
 func saveRegistryMetadata(registry types.Registry, filename string) error {
 	data, err := json.MarshalIndent(registry, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal registry.json: %v", err)
+		return fmt.Errorf("failed to marshal registry.json: %w", err)
 	}
-	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("failed to write %s: %v", filename, err)
+	if err := writeMetadataFile(filename, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
 	}
 	return nil
 }
@@ -396,49 +591,75 @@ func saveRegistryMetadata(registry types.Registry, filename string) error {
 func savePackageVersions(versions []string, versionsFile string) error {
 	data, err := json.MarshalIndent(versions, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal %s: %v", versionsFile, err)
+		return fmt.Errorf("failed to marshal %s: %w", versionsFile, err)
+	}
+	if err := writeMetadataFile(versionsFile, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", versionsFile, err)
+	}
+	return nil
+}
+
+// saveSpecs marshals the specs to JSON and writes them to specs.json
+func saveSpecs(specs types.Specs, specsFile string) error {
+	data, err := json.MarshalIndent(specs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", specsFile, err)
 	}
-	if err := os.WriteFile(versionsFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write %s: %v", versionsFile, err)
+	if err := writeMetadataFile(specsFile, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", specsFile, err)
 	}
 	return nil
 }
 
 // loadVersions loads the list of versions for a package from versions.json
 func loadVersions(registriesDir, registryName, packageName string) ([]string, error) {
-	versionsFile := filepath.Join(registriesDir, registryName, strings.ToUpper(string(packageName[0])), packageName, "versions.json")
-	data, err := os.ReadFile(versionsFile)
+	packageDir, err := registryPackageDir(registriesDir, registryName, packageName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(packageDir, "versions.json"))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to read versions.json for '%s' in registry '%s': %v", packageName, registryName, err)
+		return nil, fmt.Errorf("failed to read versions.json for '%s' in registry '%s': %w", packageName, registryName, err)
 	}
 	var versions []string
-	if err := json.Unmarshal(data, &versions); err != nil {
-		return nil, fmt.Errorf("failed to parse versions.json for '%s' in registry '%s': %v", packageName, registryName, err)
+	if err := unmarshalValidated("versions.schema.json", data, &versions); err != nil {
+		return nil, fmt.Errorf("failed to parse versions.json for '%s' in registry '%s': %w", packageName, registryName, err)
 	}
 	return versions, nil
 }
 
 // loadSpecs loads a package's specs from specs.json
 func loadSpecs(registriesDir, registryName, packageName, version string) (types.Specs, error) {
-	specsFile := filepath.Join(registriesDir, registryName, strings.ToUpper(string(packageName[0])), packageName, version, "specs.json")
+	packageDir, err := registryPackageDir(registriesDir, registryName, packageName)
+	if err != nil {
+		return types.Specs{}, err
+	}
+	return loadSpecsFile(filepath.Join(packageDir, version, "specs.json"))
+}
+
+// loadSpecsFile loads the specs of a package version from a specs.json file
+func loadSpecsFile(specsFile string) (types.Specs, error) {
 	data, err := os.ReadFile(specsFile)
 	if err != nil {
-		return types.Specs{}, fmt.Errorf("failed to read specs.json: %v", err)
+		return types.Specs{}, fmt.Errorf("failed to read specs.json: %w", err)
 	}
 	var specs types.Specs
-	if err := json.Unmarshal(data, &specs); err != nil {
-		return types.Specs{}, fmt.Errorf("failed to parse specs.json: %v", err)
+	if err := unmarshalValidated("specs.schema.json", data, &specs); err != nil {
+		return types.Specs{}, fmt.Errorf("failed to parse specs.json: %w", err)
 	}
 	return specs, nil
 }
 
 // loadBuildList loads a package's build list from buildlist.json
 func loadBuildList(registriesDir, registryName, packageName, version string) (types.BuildList, error) {
-	buildListFile := filepath.Join(registriesDir, registryName, strings.ToUpper(string(packageName[0])), packageName, version, "buildlist.json")
-	return loadBuildListFile(buildListFile)
+	packageDir, err := registryPackageDir(registriesDir, registryName, packageName)
+	if err != nil {
+		return types.BuildList{}, err
+	}
+	return loadBuildListFile(filepath.Join(packageDir, version, "buildlist.json"))
 }
 
 // loadBuildList loads a package's build list from buildlist.json
@@ -448,11 +669,11 @@ func loadBuildListFile(buildListFile string) (types.BuildList, error) {
 		if os.IsNotExist(err) {
 			return types.BuildList{Dependencies: make(map[string]types.BuildListDependency)}, nil // No build list yet
 		}
-		return types.BuildList{}, fmt.Errorf("failed to read buildlist.json: %v", err)
+		return types.BuildList{}, fmt.Errorf("failed to read buildlist.json: %w", err)
 	}
 	var buildList types.BuildList
-	if err := json.Unmarshal(data, &buildList); err != nil {
-		return types.BuildList{}, fmt.Errorf("failed to parse buildlist.json: %v", err)
+	if err := unmarshalValidated("buildlist.schema.json", data, &buildList); err != nil {
+		return types.BuildList{}, fmt.Errorf("failed to parse buildlist.json: %w", err)
 	}
 	return buildList, nil
 }
@@ -461,24 +682,149 @@ func loadBuildListFile(buildListFile string) (types.BuildList, error) {
 func copyFile(src, dest string, mode os.FileMode) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("failed to open source file %s: %v", src, err)
+		return fmt.Errorf("failed to open source file %s: %w", src, err)
 	}
 	defer srcFile.Close()
 
 	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
 	if err != nil {
-		return fmt.Errorf("failed to create destination file %s: %v", dest, err)
+		return fmt.Errorf("failed to create destination file %s: %w", dest, err)
 	}
 	defer destFile.Close()
 
 	if _, err := io.Copy(destFile, srcFile); err != nil {
-		return fmt.Errorf("failed to copy file from %s to %s: %v", src, dest, err)
+		return fmt.Errorf("failed to copy file from %s to %s: %w", src, dest, err)
 	}
 
 	// Ensure the destination file has the same permissions as the source
 	if err := destFile.Chmod(mode); err != nil {
-		return fmt.Errorf("failed to set permissions on %s: %v", dest, err)
+		return fmt.Errorf("failed to set permissions on %s: %w", dest, err)
+	}
+
+	return nil
+}
+
+// buildListUsageFile returns the file in the depot that records the build lists written by activations
+func buildListUsageFile(cosmDir string) string {
+	return filepath.Join(cosmDir, "logs", "buildlists.json")
+}
+
+// loadBuildListUsage loads the absolute paths of the build lists written by activations
+func loadBuildListUsage(cosmDir string) ([]string, error) {
+	usageFile := buildListUsageFile(cosmDir)
+	data, err := os.ReadFile(usageFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", usageFile, err)
+	}
+	var buildListFiles []string
+	if err := json.Unmarshal(data, &buildListFiles); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", usageFile, err)
+	}
+	return buildListFiles, nil
+}
+
+// saveBuildListUsage writes the absolute paths of the build lists written by activations
+func saveBuildListUsage(cosmDir string, buildListFiles []string) error {
+	usageFile := buildListUsageFile(cosmDir)
+	if err := os.MkdirAll(filepath.Dir(usageFile), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", usageFile, err)
+	}
+	data, err := json.MarshalIndent(buildListFiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", usageFile, err)
+	}
+	if err := writeFileAtomically(usageFile, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", usageFile, err)
+	}
+	return nil
+}
+
+// tempDirPrefix starts the names of the staging directories in the depot, in which clones are
+// made before they are moved to their final location
+const tempDirPrefix = "tmp-"
+
+// staleTempDirAge is the age after which a staging directory is considered left behind by a
+// crashed or killed cosm process
+const staleTempDirAge = 24 * time.Hour
+
+// tempDirs are the staging directories of this process, removed by RemoveTempDirs if the command
+// exits before it cleans them up
+var (
+	tempDirsMu sync.Mutex
+	tempDirs   = make(map[string]bool)
+)
+
+// makeTempDir creates a uniquely named staging directory in parentDir and registers it for cleanup
+func makeTempDir(parentDir, name string) (string, error) {
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", parentDir, err)
 	}
+	path, err := os.MkdirTemp(parentDir, tempDirPrefix+name+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory in %s: %w", parentDir, err)
+	}
+	tempDirsMu.Lock()
+	tempDirs[path] = true
+	tempDirsMu.Unlock()
+	return path, nil
+}
 
+// removeTempDir removes a staging directory, if it was not moved away, and unregisters it
+func removeTempDir(path string) error {
+	tempDirsMu.Lock()
+	delete(tempDirs, path)
+	tempDirsMu.Unlock()
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to clean up temporary directory %s: %w", path, err)
+	}
 	return nil
 }
+
+// RemoveTempDirs removes the staging directories that the running command did not clean up;
+// cosm calls it before it exits
+func RemoveTempDirs() {
+	tempDirsMu.Lock()
+	paths := make([]string, 0, len(tempDirs))
+	for path := range tempDirs {
+		paths = append(paths, path)
+	}
+	tempDirsMu.Unlock()
+	for _, path := range paths {
+		if err := removeTempDir(path); err != nil {
+			logging.Warnf("%v", err)
+		}
+	}
+}
+
+// SweepStaleTempDirs removes the staging directories in the clones and registries directories of
+// the depot that are older than staleTempDirAge
+func SweepStaleTempDirs() {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return
+	}
+	for _, dir := range []string{filepath.Join(cosmDir, "clones"), filepath.Join(cosmDir, "registries")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < staleTempDirAge {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if err := os.RemoveAll(path); err != nil {
+				logging.Warnf("Failed to remove stale temporary directory %s: %v", path, err)
+				continue
+			}
+			logging.Debugf("Removed stale temporary directory %s", path)
+		}
+	}
+}
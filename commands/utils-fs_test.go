@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteMetadataFile tests that metadata files are replaced whole and keep a backup of the previous version
+func TestWriteMetadataFile(t *testing.T) {
+	depot := t.TempDir()
+	t.Setenv("COSM_DEPOT_PATH", depot)
+	filename := filepath.Join(depot, "registries", "myreg", "versions.json")
+	if err := writeMetadataFile(filename, []byte(`["v1.0.0"]`)); err != nil {
+		t.Fatalf("Failed to write %s: %v", filename, err)
+	}
+	if _, err := os.Stat(filename + backupSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup for a new file, got err %v", err)
+	}
+	for _, content := range []string{`["v1.0.0", "v1.1.0"]`, `["v1.0.0", "v1.1.0"]`} {
+		if err := writeMetadataFile(filename, []byte(content)); err != nil {
+			t.Fatalf("Failed to write %s: %v", filename, err)
+		}
+	}
+	if data, err := os.ReadFile(filename); err != nil || string(data) != `["v1.0.0", "v1.1.0"]` {
+		t.Errorf("Expected the new content, got %q (err: %v)", data, err)
+	}
+	if data, err := os.ReadFile(filename + backupSuffix); err != nil || string(data) != `["v1.0.0"]` {
+		t.Errorf("Expected the previous version in the backup, got %q (err: %v)", data, err)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v (err: %v)", info.Mode().Perm(), err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected only the file and its backup, got %v (err: %v)", entries, err)
+	}
+}
+
+// TestWriteMetadataFileProject tests that the backups of the files of a project are kept in its
+// .cosm directory instead of next to them
+func TestWriteMetadataFileProject(t *testing.T) {
+	t.Setenv("COSM_DEPOT_PATH", t.TempDir())
+	projectDir := t.TempDir()
+	projectFile := filepath.Join(projectDir, "Project.json")
+	manifestFile := filepath.Join(projectDir, "vendor", "vendor.json")
+	for _, content := range []string{`{"name": "a"}`, `{"name": "b"}`} {
+		for _, filename := range []string{projectFile, manifestFile} {
+			if err := writeMetadataFile(filename, []byte(content)); err != nil {
+				t.Fatalf("Failed to write %s: %v", filename, err)
+			}
+		}
+	}
+	for _, backup := range []string{"Project.json.bak", "vendor/vendor.json.bak"} {
+		if data, err := os.ReadFile(filepath.Join(projectDir, ".cosm", "backups", backup)); err != nil || string(data) != `{"name": "a"}` {
+			t.Errorf("Expected the previous version in .cosm/backups/%s, got %q (err: %v)", backup, data, err)
+		}
+	}
+	for _, filename := range []string{projectFile, manifestFile} {
+		if _, err := os.Stat(filename + backupSuffix); !os.IsNotExist(err) {
+			t.Errorf("Expected no backup next to %s, got err %v", filename, err)
+		}
+	}
+}
@@ -1,23 +1,62 @@
 package commands
 
 import (
+	"bufio"
+	"context"
+	"cosm/logging"
 	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
 )
 
+// commandError is the error of a failed command; it carries the combined output of the command
+// so that wrapped errors explain why the command failed
+type commandError struct {
+	args   []string
+	dir    string
+	output string
+	err    error
+}
+
+func (e *commandError) Error() string {
+	msg := fmt.Sprintf("failed to run '%s' in %s: %v", strings.Join(e.args, " "), e.dir, e.err)
+	if e.output != "" {
+		msg += "\nOutput: " + e.output
+	}
+	return msg
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
 // runCommand executes a command in the specified directory, returning the output and any error.
 // The command is provided as a slice of arguments (e.g., []string{"git", "checkout", "-"}).
-func runCommand(dir string, args ...string) (string, error) {
+// The command is killed when the context is cancelled. On failure the error is a *commandError
+// that includes the output.
+func runCommand(ctx context.Context, dir string, args ...string) (string, error) {
 	if len(args) == 0 {
 		return "", fmt.Errorf("no command arguments provided")
 	}
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	cmd.Dir = dir
+	start := time.Now()
 	output, err := cmd.CombinedOutput()
 	outputStr := strings.TrimSpace(string(output))
+	logging.Debugf("Ran '%s' in %s (%s)", strings.Join(args, " "), dir, time.Since(start).Round(time.Millisecond))
+	if outputStr != "" {
+		logging.Tracef("Output of '%s':\n%s", strings.Join(args, " "), outputStr)
+	}
 	if err != nil {
-		return outputStr, fmt.Errorf("failed to run '%s' in %s: %v\nOutput: %s", strings.Join(args, " "), dir, err, outputStr)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr // Report the cancellation instead of the signal that killed the command
+		}
+		return outputStr, &commandError{args: args, dir: dir, output: outputStr, err: err}
 	}
 	return outputStr, nil
 }
@@ -33,14 +72,63 @@ func removeString(slice []string, s string) []string {
 	return result
 }
 
-// promptUserForConfirmation prompts the user for confirmation and returns true if they enter 'y' or 'Y'
-func promptUserForConfirmation(prompt string) bool {
+// assumeYes and noInput are set by the --yes and --no-input flags
+var assumeYes, noInput bool
+
+// SetInteraction configures the prompts: with yes, confirmations and defaults are accepted without
+// asking; with noInput, or yes, cosm never reads from stdin and fails where input would be required.
+// COSM_YES and COSM_NO_INPUT have the same effect as the flags.
+func SetInteraction(yes, noPrompt bool) {
+	assumeYes = yes
+	noInput = noPrompt
+}
+
+// answerYes reports whether confirmations and defaults are accepted without asking
+func answerYes() bool {
+	return assumeYes || envEnabled("COSM_YES")
+}
+
+// inputDisabled reports whether cosm must not read from stdin
+func inputDisabled() bool {
+	return noInput || answerYes() || envEnabled("COSM_NO_INPUT")
+}
+
+// envEnabled reports whether an environment variable is set to a true value, e.g. 1 or true
+func envEnabled(name string) bool {
+	enabled, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && enabled
+}
+
+// inputRequiredError returns the error of a prompt that cannot be shown in non-interactive mode
+func inputRequiredError(format string, args ...any) error {
+	return validationError("%s (input is disabled by --yes or --no-input)", fmt.Sprintf(format, args...))
+}
+
+// promptUserForConfirmation prompts the user for confirmation and returns true if they enter 'y' or
+// 'yes'. With --yes the prompt is accepted; with --no-input it fails, naming the action to confirm.
+func promptUserForConfirmation(prompt, action string) (bool, error) {
+	if answerYes() {
+		return true, nil
+	}
+	if inputDisabled() {
+		return false, inputRequiredError("%s requires confirmation; use --yes or --force", action)
+	}
 	fmt.Print(prompt)
-	var response string
-	if _, err := fmt.Scanln(&response); err != nil {
-		return false
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	response := strings.TrimSpace(strings.ToLower(scanner.Text()))
+	return response == "y" || response == "yes", nil
+}
+
+// promptUserForValue asks for a value, showing a default that is used if the answer is empty
+func promptUserForValue(prompt, defaultValue string) string {
+	fmt.Printf("%s [%s]: ", prompt, defaultValue)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+		return answer
 	}
-	return strings.ToLower(response) == "y"
+	return defaultValue
 }
 
 // contains checks if a slice contains a specific string
@@ -52,3 +140,56 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+// listingOptions holds the sort order and page of a package listing
+type listingOptions struct {
+	sortBy string // "name", "versions" or "updated"
+	limit  int    // Maximum number of entries per page, or 0 for all entries
+	page   int    // 1-based page number
+}
+
+// parseListingFlags reads the --sort, --limit and --page flags of a listing command
+func parseListingFlags(cmd *cobra.Command) (listingOptions, error) {
+	sortBy, _ := cmd.Flags().GetString("sort")
+	limit, _ := cmd.Flags().GetInt("limit")
+	page, _ := cmd.Flags().GetInt("page")
+	switch sortBy {
+	case "name", "versions", "updated":
+	default:
+		return listingOptions{}, validationError("invalid sort order '%s' (must be name, versions or updated)", sortBy)
+	}
+	if limit < 0 {
+		return listingOptions{}, validationError("--limit must not be negative")
+	}
+	if page < 1 {
+		return listingOptions{}, validationError("--page must be at least 1")
+	}
+	if page > 1 && limit == 0 {
+		return listingOptions{}, validationError("--page requires --limit")
+	}
+	return listingOptions{sortBy: sortBy, limit: limit, page: page}, nil
+}
+
+// pageBounds returns the range [start, end) of the entries on the selected page
+func (opts listingOptions) pageBounds(total int) (int, int, error) {
+	if opts.limit == 0 {
+		return 0, total, nil
+	}
+	start := (opts.page - 1) * opts.limit
+	if start >= total && opts.page > 1 {
+		return 0, 0, validationError("page %d is out of range (%d page(s) with --limit %d)", opts.page, (total+opts.limit-1)/opts.limit, opts.limit)
+	}
+	end := start + opts.limit
+	if end > total {
+		end = total
+	}
+	return start, end, nil
+}
+
+// pageFooter describes the entries on the selected page, or returns "" if the listing is not paginated
+func (opts listingOptions) pageFooter(start, end, total int) string {
+	if opts.limit == 0 || total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Showing %d-%d of %d (page %d of %d)", start+1, end, total, opts.page, (total+opts.limit-1)/opts.limit)
+}
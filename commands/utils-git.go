@@ -1,18 +1,62 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// gitRemote returns the remote that cosm fetches from and pushes to in the repository in dir: the
+// remote set with 'git config cosm.remote', else the upstream remote of the current branch, else
+// the only remote of the repository, else origin
+func gitRemote(ctx context.Context, dir string) string {
+	if remote := gitConfigValue(ctx, dir, "cosm.remote"); remote != "" {
+		return remote
+	}
+	if branch, err := getCurrentBranch(ctx, dir); err == nil {
+		if remote := gitConfigValue(ctx, dir, "branch."+branch+".remote"); remote != "" && remote != "." {
+			return remote
+		}
+	}
+	if output, err := GitCommand(ctx, dir, "remote"); err == nil {
+		if remotes := strings.Fields(output); len(remotes) == 1 {
+			return remotes[0]
+		}
+	}
+	return "origin"
+}
+
+// defaultBranch returns the default branch of the remote, from the <remote>/HEAD reference of the
+// clone or else by asking the remote; it is empty if the remote has no default branch
+func defaultBranch(ctx context.Context, dir string) string {
+	remote := gitRemote(ctx, dir)
+	if output, err := GitCommand(ctx, dir, "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD"); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(output), remote+"/")
+	}
+	output, err := GitCommand(ctx, dir, "ls-remote", "--symref", remote, "HEAD")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if ref, found := strings.CutPrefix(line, "ref: refs/heads/"); found {
+			branch, _, _ := strings.Cut(ref, "\t")
+			return branch
+		}
+	}
+	return ""
+}
+
 // getCurrentBranch retrieves the current branch name of the Git repository in the specified directory
-func getCurrentBranch(dir string) (string, error) {
-	output, err := GitCommand(dir, "rev-parse", "--abbrev-ref", "HEAD")
+func getCurrentBranch(ctx context.Context, dir string) (string, error) {
+	output, err := GitCommand(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
 	if err != nil {
-		return "", wrapGitError(dir, fmt.Sprintf("failed to get current branch in %s", dir), err)
+		return "", wrapGitError(dir, "failed to get current branch", err)
 	}
 	branch := strings.TrimSpace(output)
 	if branch == "HEAD" {
@@ -25,79 +69,210 @@ func getCurrentBranch(dir string) (string, error) {
 }
 
 // pullFromBranch pulls updates from the specified branch in the Git repository
-func pullFromBranch(dir, branch, context string) error {
-	if _, err := GitCommand(dir, "pull", "origin", branch); err != nil {
-		return wrapGitError(dir, fmt.Sprintf("failed to pull updates from branch '%s' for %s", branch, context), err)
+func pullFromBranch(ctx context.Context, dir, branch, subject string) error {
+	if _, err := GitCommand(ctx, dir, "pull", gitRemote(ctx, dir), branch); err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to pull updates from branch '%s' for %s", branch, subject), err)
 	}
 	return nil
 }
 
-// wrapGitError wraps a Git command error with directory context.
+// wrapGitError wraps a Git command error with directory context. The directory is left out
+// if the error of the Git command already names it.
 func wrapGitError(dir, msg string, err error) error {
-	return fmt.Errorf("%s in %s: %v", msg, dir, err)
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) && cmdErr.dir == dir {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	return fmt.Errorf("%s in %s: %w", msg, dir, err)
 }
 
-// pushToRemote pushes the specified target (branch or tag) to origin.
-func pushToRemote(dir, target string, ignoreUpToDate bool) error {
-	output, err := GitCommand(dir, "push", "origin", target)
+// pushToRemote pushes the specified target (branch or tag) to the remote of the repository.
+func pushToRemote(ctx context.Context, dir, target string, ignoreUpToDate bool) error {
+	remote := gitRemote(ctx, dir)
+	output, err := GitCommand(ctx, dir, "push", remote, target)
 	if err != nil && !(ignoreUpToDate && strings.Contains(output, "Everything up-to-date")) {
-		return fmt.Errorf("failed to push %s to origin in %s: %v", target, dir, err)
+		return wrapGitError(dir, fmt.Sprintf("failed to push %s to %s", target, remote), err)
 	}
 	return nil
 }
 
-// fetchOrigin fetches updates from origin.
-func fetchOrigin(dir string) error {
-	if _, err := GitCommand(dir, "fetch", "origin"); err != nil {
-		return wrapGitError(dir, "failed to fetch from origin", err)
+// fetchRemote fetches updates from the remote of the repository.
+func fetchRemote(ctx context.Context, dir string) error {
+	remote := gitRemote(ctx, dir)
+	if _, err := GitCommand(ctx, dir, "fetch", remote); err != nil {
+		return wrapGitError(dir, "failed to fetch from "+remote, err)
 	}
 	return nil
 }
 
+// fetchWithMirrors fetches updates from the remote, falling back to the mirrors in order.
+// Fetching from a mirror retrieves its branches and tags.
+func fetchWithMirrors(ctx context.Context, dir string, mirrors []string) error {
+	err := fetchRemote(ctx, dir)
+	if err == nil {
+		return nil
+	}
+	remote := gitRemote(ctx, dir)
+	for _, mirror := range mirrors {
+		_, mirrorErr := GitCommand(ctx, dir, "fetch", "--tags", mirror, "+refs/heads/*:refs/remotes/"+remote+"/*")
+		if mirrorErr == nil {
+			return nil
+		}
+		err = fmt.Errorf("%w; fetching from mirror '%s' failed too: %v", err, mirror, mirrorErr)
+	}
+	return err
+}
+
+// networkSubcommands are the Git commands that contact a remote; they are subject to the network
+// timeout and retried after transient failures
+var networkSubcommands = []string{"clone", "fetch", "pull", "push", "ls-remote", "submodule", "lfs"}
+
+// retryBaseDelay is the delay before the first retry of a network command; it doubles with every retry
+var retryBaseDelay = time.Second
+
 // GitCommand executes a Git command in the specified directory, returning the output and any error.
 // The subcommand is the Git command (e.g., "add", "commit"), followed by its arguments.
-func GitCommand(dir, subcommand string, args ...string) (string, error) {
+func GitCommand(ctx context.Context, dir, subcommand string, args ...string) (string, error) {
 	if subcommand == "" {
 		return "", fmt.Errorf("no Git subcommand provided for directory %s", dir)
 	}
 	cmdArgs := append([]string{"git", subcommand}, args...)
-	output, err := runCommand(dir, cmdArgs...)
-	if err != nil && strings.Contains(output, "nothing to commit") && subcommand == "commit" {
-		return output, nil // Ignore "nothing to commit" errors for git commit
+	if contains(networkSubcommands, subcommand) {
+		output, err := networkGitCommand(ctx, dir, cmdArgs)
+		if err == nil {
+			recordGitChange(dir, subcommand, args)
+		}
+		return output, err
+	}
+	output, err := runCommand(ctx, dir, cmdArgs...)
+	if err == nil {
+		recordGitChange(dir, subcommand, args)
+	}
+	if err != nil && (strings.Contains(output, "nothing to commit") || strings.Contains(output, "nothing added to commit")) && subcommand == "commit" {
+		return output, nil // Ignore "nothing to commit" errors for git commit, also with untracked backups present
 	}
 	return output, err
 }
 
-// getGitAuthors retrieves the author info from git config or uses a default
-func getGitAuthors() ([]string, error) {
+// networkGitCommand runs a Git command that contacts a remote. Every attempt fails with a network
+// error when it exceeds the configured timeout, and transient failures are retried with exponential
+// backoff. A partial clone of a failed git clone is removed before the clone is retried.
+func networkGitCommand(ctx context.Context, dir string, cmdArgs []string) (string, error) {
+	retries := networkRetries()
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		output, err := runNetworkGitCommand(ctx, dir, cmdArgs)
+		if err == nil || attempt > retries || !isTransientGitFailure(err) {
+			return output, err
+		}
+		reason := output[strings.LastIndex(output, "\n")+1:]
+		if reason == "" {
+			reason = errors.Unwrap(err).Error()
+		}
+		logging.Warnf("'%s' failed, retrying in %s (retry %d of %d): %s", strings.Join(cmdArgs, " "), delay, attempt, retries, reason)
+		if cmdArgs[1] == "clone" {
+			destination := cmdArgs[len(cmdArgs)-1]
+			if !filepath.IsAbs(destination) {
+				destination = filepath.Join(dir, destination)
+			}
+			os.RemoveAll(destination)
+		}
+		select {
+		case <-ctx.Done():
+			return output, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// runNetworkGitCommand runs a Git command that contacts a remote once, within the configured timeout
+func runNetworkGitCommand(ctx context.Context, dir string, cmdArgs []string) (string, error) {
+	timeout := networkTimeout()
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	output, err := runCommand(timeoutCtx, dir, cmdArgs...)
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		cmdErr.err = &Error{Kind: KindNetwork, Err: fmt.Errorf("timed out after %s (see --timeout or 'cosm config set timeout')", timeout)}
+	}
+	return output, err
+}
+
+// getGitAuthors retrieves the configured author, the author info from git config, or uses a default
+func getGitAuthors(ctx context.Context) ([]string, error) {
+	if author := currentConfig().Author; author != "" {
+		return []string{author}, nil
+	}
 	// Use empty directory for global/system-wide config
-	name, errName := GitCommand("", "config", "user.name")
+	name, errName := GitCommand(ctx, "", "config", "user.name")
 	if errName != nil {
 		name = ""
 	}
-	email, errEmail := GitCommand("", "config", "user.email")
+	email, errEmail := GitCommand(ctx, "", "config", "user.email")
 	if errEmail != nil {
 		email = ""
 	}
 	if name == "" || email == "" {
-		fmt.Println("Warning: Could not retrieve git user.name or user.email, defaulting to '[unknown]unknown@author.com'")
+		logging.Warnf("Could not retrieve git user.name or user.email, defaulting to '[unknown]unknown@author.com'")
 		return []string{"[unknown]unknown@author.com"}, nil
 	}
 	return []string{fmt.Sprintf("[%s]%s", name, email)}, nil
 }
 
 // revertClone returns the clone to its previous branch or state using 'git checkout -'
-func revertClone(clonePath string) error {
-	_, err := GitCommand(clonePath, "checkout", "-")
+func revertClone(ctx context.Context, clonePath string) error {
+	_, err := GitCommand(ctx, clonePath, "checkout", "-")
 	return err
 }
 
-// stageFiles stages the specified files or directories using git add.
-func stageFiles(dir string, paths ...string) error {
+// updateSubmodules checks out the submodules of a clone, recursively, at the commits recorded in
+// its current checkout, so that packages in a submodule or with submodules are complete. Clones
+// without submodules are left alone.
+func updateSubmodules(ctx context.Context, clonePath string) error {
+	if _, err := os.Stat(filepath.Join(clonePath, ".gitmodules")); err != nil {
+		return nil
+	}
+	if _, err := GitCommand(ctx, clonePath, "submodule", "update", "--init", "--recursive"); err != nil {
+		return wrapGitError(clonePath, "failed to check out submodules", err)
+	}
+	return nil
+}
+
+// usesLFS reports whether the checked-out tree of a clone stores files in Git LFS, i.e. whether one
+// of its .gitattributes files assigns the lfs filter
+func usesLFS(ctx context.Context, clonePath string) bool {
+	_, err := GitCommand(ctx, clonePath, "grep", "-q", "filter=lfs", "--", ".gitattributes", "*/.gitattributes")
+	return err == nil
+}
+
+// fetchLFSContent replaces the Git LFS pointer files of a clone checked out at sha1 by their content;
+// without git-lfs, the pointer files would end up in the package instead
+func fetchLFSContent(ctx context.Context, clonePath, sha1 string) error {
+	if !usesLFS(ctx, clonePath) {
+		return nil
+	}
+	if _, err := runCommand(ctx, clonePath, "git", "lfs", "version"); err != nil {
+		return fmt.Errorf("the repository in %s stores files in Git LFS, but git-lfs is not installed (install it from https://git-lfs.com)", clonePath)
+	}
+	if _, err := GitCommand(ctx, clonePath, "lfs", "fetch", gitRemote(ctx, clonePath), sha1); err != nil {
+		return wrapGitError(clonePath, fmt.Sprintf("failed to fetch the Git LFS files of %s", sha1), err)
+	}
+	if _, err := GitCommand(ctx, clonePath, "lfs", "checkout"); err != nil {
+		return wrapGitError(clonePath, "failed to check out the Git LFS files", err)
+	}
+	return nil
+}
+
+// excludeBackups is a pathspec that leaves out the backups of metadata files kept by writeMetadataFile
+const excludeBackups = ":(exclude)*" + backupSuffix
+
+// stageFiles stages the specified files or directories using git add, leaving out backups of metadata files.
+func stageFiles(ctx context.Context, dir string, paths ...string) error {
 	if len(paths) == 0 {
 		return fmt.Errorf("no paths provided to stage in %s", dir)
 	}
-	_, err := GitCommand(dir, "add", paths...)
+	_, err := GitCommand(ctx, dir, "add", append(append([]string{"--"}, paths...), excludeBackups)...)
 	if err != nil {
 		return wrapGitError(dir, "failed to stage changes", err)
 	}
@@ -105,27 +280,39 @@ func stageFiles(dir string, paths ...string) error {
 }
 
 // commitChanges commits staged changes with the specified message.
-func commitChanges(dir, message string) error {
-	_, err := GitCommand(dir, "commit", "-m", message)
+func commitChanges(ctx context.Context, dir, message string) error {
+	_, err := GitCommand(ctx, dir, "commit", "-m", message)
 	if err != nil {
 		return wrapGitError(dir, "failed to commit changes", err)
 	}
 	return nil
 }
 
+// commitSignedChanges commits staged changes with the specified message and signs the commit.
+// The signing key and format are taken from the Git configuration (user.signingkey, gpg.format).
+func commitSignedChanges(ctx context.Context, dir, message string) error {
+	_, err := GitCommand(ctx, dir, "commit", "-S", "-m", message)
+	if err != nil {
+		return wrapGitError(dir, "failed to commit signed changes", err)
+	}
+	return nil
+}
+
 // clone clones a repository from gitURL to the destination directory.
-func clone(gitURL, parentDir, destination string) (string, error) {
-	if _, err := GitCommand(parentDir, "clone", gitURL, destination); err != nil {
-		return "", fmt.Errorf("failed to clone repository from '%s' to %s: %v", gitURL, destination, err)
+// Options are passed to git clone before the URL (e.g., "--depth", "1").
+func clone(ctx context.Context, gitURL, parentDir, destination string, options ...string) (string, error) {
+	args := append(append([]string{}, options...), gitURL, destination)
+	if _, err := GitCommand(ctx, parentDir, "clone", args...); err != nil {
+		return "", fmt.Errorf("failed to clone repository from '%s' to %s: %w", gitURL, destination, err)
 	}
 	return filepath.Join(parentDir, destination), nil
 }
 
 // listTags retrieves the list of tags in the Git repository
-func listTags(dir string) ([]string, error) {
-	output, err := GitCommand(dir, "tag")
+func listTags(ctx context.Context, dir string) ([]string, error) {
+	output, err := GitCommand(ctx, dir, "tag")
 	if err != nil {
-		return nil, wrapGitError(dir, fmt.Sprintf("failed to list tags in %s", dir), err)
+		return nil, wrapGitError(dir, "failed to list tags", err)
 	}
 	tags := strings.Split(strings.TrimSpace(output), "\n")
 	if len(tags) == 1 && tags[0] == "" {
@@ -134,35 +321,173 @@ func listTags(dir string) ([]string, error) {
 	return tags, nil
 }
 
-// createTag creates a new tag in the Git repository
-func createTag(dir, tag string) error {
+// createTag creates a new tag in the Git repository, annotated with the message if it is not empty.
+// A signed tag is signed with the key of the Git configuration and gets a default message.
+func createTag(ctx context.Context, dir, tag, message string, sign bool) error {
 	if tag == "" {
 		return fmt.Errorf("tag name cannot be empty")
 	}
-	if _, err := GitCommand(dir, "tag", tag); err != nil {
-		return wrapGitError(dir, fmt.Sprintf("failed to create tag '%s' in %s", tag, dir), err)
+	if sign && message == "" {
+		message = "Release " + tag
+	}
+	args := []string{tag}
+	switch {
+	case sign:
+		args = []string{"-s", "--cleanup=whitespace", "-m", message, tag}
+	case message != "":
+		// Keep the message as it is, including Markdown headings that git would strip as comments
+		args = []string{"-a", "--cleanup=whitespace", "-m", message, tag}
+	}
+	if _, err := GitCommand(ctx, dir, "tag", args...); err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to create tag '%s'", tag), err)
 	}
 	return nil
 }
 
-// checkoutVersion switches the clone to the specified SHA1
-func checkoutVersion(clonePath, sha1 string) error {
-	// Fetch updates to ensure we have the latest refs
-	if err := fetchOrigin(clonePath); err != nil {
-		return err
+// deleteTag removes a local tag from the Git repository
+func deleteTag(ctx context.Context, dir, tag string) error {
+	if _, err := GitCommand(ctx, dir, "tag", "-d", tag); err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to delete tag '%s'", tag), err)
 	}
+	return nil
+}
 
-	// Checkout the specific SHA1
-	_, err := GitCommand(clonePath, "checkout", sha1)
+// getHeadSHA returns the SHA1 of the current HEAD commit
+func getHeadSHA(ctx context.Context, dir string) (string, error) {
+	output, err := GitCommand(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", wrapGitError(dir, "failed to resolve HEAD", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// hasCommit reports whether a ref or SHA1 resolves to a commit in the local repository
+func hasCommit(ctx context.Context, dir, ref string) bool {
+	_, err := GitCommand(ctx, dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// remoteBranchMerged reports whether the head of a branch on the remote is already contained in
+// the local HEAD, so that pulling it would not change anything. It only asks the remote for the
+// ref with git ls-remote; if that fails, the branch is reported as not merged.
+func remoteBranchMerged(ctx context.Context, dir, remote, branch string) bool {
+	output, err := GitCommand(ctx, dir, "ls-remote", remote, "refs/heads/"+branch)
 	if err != nil {
-		return fmt.Errorf("failed to checkout SHA1 %s in %s: %v", sha1, clonePath, err)
+		return false
+	}
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[1] != "refs/heads/"+branch {
+		return false
+	}
+	if !hasCommit(ctx, dir, fields[0]) {
+		return false
+	}
+	_, err = GitCommand(ctx, dir, "merge-base", "--is-ancestor", fields[0], "HEAD")
+	return err == nil
+}
+
+// resetHard resets the working tree and current branch to the specified commit
+func resetHard(ctx context.Context, dir, ref string) error {
+	if _, err := GitCommand(ctx, dir, "reset", "--hard", ref); err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to reset to '%s'", ref), err)
+	}
+	return nil
+}
+
+// checkoutVersion switches the clone to the specified SHA1; the remote is only fetched if the
+// commit is not in the clone yet
+func checkoutVersion(ctx context.Context, clonePath, sha1 string, mirrors ...string) error {
+	if !hasCommit(ctx, clonePath, sha1) {
+		if err := fetchWithMirrors(ctx, clonePath, mirrors); err != nil {
+			return err
+		}
+	}
+
+	// Checkout the specific SHA1
+	_, err := GitCommand(ctx, clonePath, "checkout", sha1)
+	if err == nil {
+		return nil
+	}
+	if isShallowRepository(ctx, clonePath) {
+		// The commit may lie beyond the shallow history, so fetch just that commit
+		deepenErr := deepenToRef(ctx, clonePath, sha1)
+		if deepenErr == nil {
+			return nil
+		}
+		err = fmt.Errorf("%w; deepening the shallow clone failed too: %v", err, deepenErr)
+	}
+	return wrapGitError(clonePath, fmt.Sprintf("failed to checkout SHA1 %s", sha1), err)
+}
+
+// fetchCommit makes sure a clone has a commit, fetching from the remote, or else the mirrors, if it
+// does not. A shallow clone gets just that commit, or its full history if the server refuses to
+// serve the commit directly.
+func fetchCommit(ctx context.Context, dir, sha1 string, mirrors []string) error {
+	if hasCommit(ctx, dir, sha1) {
+		return nil
+	}
+	if err := fetchWithMirrors(ctx, dir, mirrors); err != nil {
+		return err
+	}
+	if hasCommit(ctx, dir, sha1) {
+		return nil
+	}
+	if isShallowRepository(ctx, dir) {
+		remote := gitRemote(ctx, dir)
+		if _, err := GitCommand(ctx, dir, "fetch", "--depth", "1", remote, sha1); err == nil && hasCommit(ctx, dir, sha1) {
+			return nil
+		}
+		if _, err := GitCommand(ctx, dir, "fetch", "--unshallow", "--tags", remote); err != nil {
+			return wrapGitError(dir, fmt.Sprintf("failed to fetch history for '%s'", sha1), err)
+		}
+		if hasCommit(ctx, dir, sha1) {
+			return nil
+		}
+	}
+	return fmt.Errorf("commit %s not found in %s", sha1, dir)
+}
+
+// isShallowRepository reports whether the repository in dir is a shallow clone
+func isShallowRepository(ctx context.Context, dir string) bool {
+	output, err := GitCommand(ctx, dir, "rev-parse", "--is-shallow-repository")
+	return err == nil && strings.TrimSpace(output) == "true"
+}
+
+// deepenToRef fetches the single commit of ref (a tag or SHA1) from the remote into a shallow
+// clone and checks it out. If the server refuses to serve the commit directly, the clone
+// is converted into a full clone instead.
+func deepenToRef(ctx context.Context, dir, ref string) error {
+	remote := gitRemote(ctx, dir)
+	if _, err := GitCommand(ctx, dir, "fetch", "--depth", "1", remote, ref); err == nil {
+		if _, err := GitCommand(ctx, dir, "checkout", "FETCH_HEAD"); err == nil {
+			return nil
+		}
+	}
+	if _, err := GitCommand(ctx, dir, "fetch", "--unshallow", "--tags", remote); err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to fetch history for '%s'", ref), err)
+	}
+	if _, err := GitCommand(ctx, dir, "checkout", ref); err != nil {
+		return wrapGitError(dir, fmt.Sprintf("failed to checkout '%s'", ref), err)
+	}
+	return nil
+}
+
+// fetchTags fetches all tags from the remote. In a shallow clone only the tagged commits
+// themselves are fetched, without their history.
+func fetchTags(ctx context.Context, dir string) error {
+	args := []string{"--tags", gitRemote(ctx, dir)}
+	if isShallowRepository(ctx, dir) {
+		args = append([]string{"--depth", "1"}, args...)
+	}
+	if _, err := GitCommand(ctx, dir, "fetch", args...); err != nil {
+		return wrapGitError(dir, "failed to fetch tags", err)
 	}
 	return nil
 }
 
 // ensureNoUncommittedChanges checks for uncommitted changes in the Git repo
-func ensureNoUncommittedChanges(projectDir string) error {
-	output, err := GitCommand(projectDir, "status", "--porcelain")
+func ensureNoUncommittedChanges(ctx context.Context, projectDir string) error {
+	output, err := GitCommand(ctx, projectDir, "status", "--porcelain", "--", ":/", excludeBackups)
 	if err != nil {
 		return wrapGitError(projectDir, "failed to check Git status", err)
 	}
@@ -172,37 +497,36 @@ func ensureNoUncommittedChanges(projectDir string) error {
 	return nil
 }
 
-// ensureLocalRepoInSyncWithOrigin ensures the local repo is ahead or in sync with origin
-func ensureLocalRepoInSyncWithOrigin(projectDir string) error {
-	// Get the current branch
-	branch, err := getCurrentBranch(projectDir)
-	if err != nil {
+// ensureLocalRepoInSyncWithRemote ensures the local repo is ahead or in sync with a branch of its
+// remote; a branch that the remote does not have yet is in sync
+func ensureLocalRepoInSyncWithRemote(ctx context.Context, projectDir, branch string) error {
+	// Fetch updates from the remote
+	if err := fetchRemote(ctx, projectDir); err != nil {
 		return err
 	}
-
-	// Fetch updates from origin
-	if err := fetchOrigin(projectDir); err != nil {
-		return err
+	remoteBranch := gitRemote(ctx, projectDir) + "/" + branch
+	if !hasCommit(ctx, projectDir, "refs/remotes/"+remoteBranch) {
+		return nil
 	}
 
-	// Check if local is behind origin
-	output, err := GitCommand(projectDir, "rev-list", "--count", fmt.Sprintf("HEAD..origin/%s", branch))
+	// Check if local is behind the remote
+	output, err := GitCommand(ctx, projectDir, "rev-list", "--count", "HEAD.."+remoteBranch)
 	if err != nil {
-		return fmt.Errorf("failed to check sync with origin/%s in %s: %v", branch, projectDir, err)
+		return wrapGitError(projectDir, fmt.Sprintf("failed to check sync with %s", remoteBranch), err)
 	}
 	behindCount, err := strconv.Atoi(strings.TrimSpace(output))
 	if err != nil {
 		return wrapGitError(projectDir, "failed to parse behind count", err)
 	}
 	if behindCount > 0 {
-		return fmt.Errorf("local repository is behind origin/%s in %s: please pull changes before proceeding", branch, projectDir)
+		return fmt.Errorf("local repository is behind %s in %s: please pull changes before proceeding", remoteBranch, projectDir)
 	}
 
 	return nil
 }
 
 // commitAndPushInitialRegistryChanges stages, commits, and pushes the initial registry changes
-func commitAndPushInitialRegistryChanges(registryName string) error {
+func commitAndPushInitialRegistryChanges(ctx context.Context, registryName string) error {
 	registriesDir, err := getRegistriesDir()
 	if err != nil {
 		return err
@@ -210,39 +534,70 @@ func commitAndPushInitialRegistryChanges(registryName string) error {
 	registryDir := filepath.Join(registriesDir, registryName)
 
 	// Stage registry.json
-	if err := stageFiles(registryDir, "registry.json"); err != nil {
+	if err := stageFiles(ctx, registryDir, "registry.json"); err != nil {
 		return err
 	}
 
 	// Commit changes
 	commitMsg := fmt.Sprintf("Initialized registry %s", registryName)
-	if err := commitChanges(registryDir, commitMsg); err != nil {
+	if err := commitChanges(ctx, registryDir, commitMsg); err != nil {
 		return err
 	}
 
 	// Get the current branch
-	branch, err := getCurrentBranch(registryDir)
+	branch, err := getCurrentBranch(ctx, registryDir)
 	if err != nil {
 		return err
 	}
 
 	// Push changes to the current branch
-	return pushToRemote(registryDir, branch, false)
+	return pushToRemote(ctx, registryDir, branch, false)
+}
+
+// cloneOptions returns the git clone options for a package clone. A shallow clone
+// fetches only the tip of every branch; commits of older versions are fetched on
+// demand when they are checked out. Otherwise a blobless partial clone is made, which
+// downloads file contents lazily. Servers without partial clone support ignore the
+// filter and send the full repository.
+func cloneOptions(shallow bool) []string {
+	if shallow {
+		return []string{"--depth", "1", "--no-single-branch"}
+	}
+	return []string{"--filter=blob:none"}
 }
 
-// clonePackageToTempDir creates a temp clone directly in the clones directory
-func clonePackageToTempDir(cosmDir, packageGitURL string) (string, error) {
+// clonePackageToTempDir creates a temp clone in a uniquely named directory of the clones directory,
+// which the caller removes with cleanupTempClone. If cloning from packageGitURL fails, the mirrors
+// are tried in order.
+func clonePackageToTempDir(ctx context.Context, cosmDir, packageGitURL string, shallow bool, mirrors ...string) (string, error) {
 	clonesDir := filepath.Join(cosmDir, "clones")
-	if err := os.MkdirAll(clonesDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create clones directory: %v", err)
+	tmpClonePath, err := makeTempDir(clonesDir, "clone")
+	if err != nil {
+		return "", err
+	}
+	var cloneErrs []error
+	for _, gitURL := range append([]string{packageGitURL}, mirrors...) {
+		_, err := clone(ctx, gitURL, clonesDir, filepath.Base(tmpClonePath), cloneOptions(shallow)...)
+		if err == nil {
+			cloneErrs = nil
+			break
+		}
+		cloneErrs = append(cloneErrs, err)
+		if cleanupErr := os.RemoveAll(tmpClonePath); cleanupErr != nil {
+			cleanupTempClone(tmpClonePath)
+			return "", fmt.Errorf("failed to clone package repository at '%s': %w; cleanup failed: %v", gitURL, err, cleanupErr)
+		}
+	}
+	if len(cloneErrs) > 0 {
+		cleanupTempClone(tmpClonePath)
+		return "", fmt.Errorf("failed to clone package repository at '%s': %w", packageGitURL, errors.Join(cloneErrs...))
 	}
-	tmpClonePath := filepath.Join(clonesDir, "tmp-clone")
-	if _, err := clone(packageGitURL, clonesDir, "tmp-clone"); err != nil {
-		cleanupErr := cleanupTempClone(tmpClonePath)
-		if cleanupErr != nil {
-			return "", fmt.Errorf("failed to clone package repository at '%s': %v; cleanup failed: %v", packageGitURL, err, cleanupErr)
+	if len(mirrors) > 0 {
+		// Keep origin pointing to the primary URL so that later fetches prefer it
+		if _, err := GitCommand(ctx, tmpClonePath, "remote", "set-url", "origin", packageGitURL); err != nil {
+			cleanupTempClone(tmpClonePath)
+			return "", wrapGitError(tmpClonePath, "failed to set origin URL", err)
 		}
-		return "", fmt.Errorf("failed to clone package repository at '%s': %v", packageGitURL, err)
 	}
 	return tmpClonePath, nil
 }
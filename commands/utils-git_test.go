@@ -1,11 +1,15 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"cosm/logging"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // setupTestEnv sets up a temporary environment with a Git config
@@ -51,6 +55,7 @@ func setupTempGitConfig(t *testing.T, tempDir string) string {
 
 // TestClone_Success tests the clone function by cloning a real Git repository.
 func TestClone_Success(t *testing.T) {
+	ctx := context.Background()
 	// Setup temporary environment with Git config
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -65,7 +70,7 @@ func TestClone_Success(t *testing.T) {
 	}
 
 	// Initialize local repository
-	if _, err := GitCommand(localDir, "init"); err != nil {
+	if _, err := GitCommand(ctx, localDir, "init"); err != nil {
 		t.Fatalf("Failed to init local Git repo in %s: %v", localDir, err)
 	}
 
@@ -74,13 +79,13 @@ func TestClone_Success(t *testing.T) {
 	if err := os.WriteFile(projectFile, []byte(`{"name": "test", "uuid": "1234"}`), 0644); err != nil {
 		t.Fatalf("Failed to create Project.json in %s: %v", localDir, err)
 	}
-	if _, err := GitCommand(localDir, "add", "Project.json"); err != nil {
+	if _, err := GitCommand(ctx, localDir, "add", "Project.json"); err != nil {
 		t.Fatalf("Failed to add Project.json in %s: %v", localDir, err)
 	}
-	if _, err := GitCommand(localDir, "commit", "-m", "Initial commit"); err != nil {
+	if _, err := GitCommand(ctx, localDir, "commit", "-m", "Initial commit"); err != nil {
 		t.Fatalf("Failed to commit in %s: %v", localDir, err)
 	}
-	if _, err := GitCommand(localDir, "branch", "-m", "main"); err != nil {
+	if _, err := GitCommand(ctx, localDir, "branch", "-m", "main"); err != nil {
 		t.Fatalf("Failed to set main branch in %s: %v", localDir, err)
 	}
 
@@ -90,18 +95,18 @@ func TestClone_Success(t *testing.T) {
 	}
 
 	// Initialize bare repository and set HEAD
-	if _, err := GitCommand(bareDir, "init", "--bare"); err != nil {
+	if _, err := GitCommand(ctx, bareDir, "init", "--bare"); err != nil {
 		t.Fatalf("Failed to init bare Git repo in %s: %v", bareDir, err)
 	}
-	if _, err := GitCommand(bareDir, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+	if _, err := GitCommand(ctx, bareDir, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
 		t.Fatalf("Failed to set HEAD in bare repo %s: %v", bareDir, err)
 	}
 
 	// Add bare repository as remote and push
-	if _, err := GitCommand(localDir, "remote", "add", "origin", bareDir); err != nil {
+	if _, err := GitCommand(ctx, localDir, "remote", "add", "origin", bareDir); err != nil {
 		t.Fatalf("Failed to add remote in %s: %v", localDir, err)
 	}
-	if output, err := GitCommand(localDir, "push", "origin", "main"); err != nil {
+	if output, err := GitCommand(ctx, localDir, "push", "origin", "main"); err != nil {
 		t.Fatalf("Failed to push to bare repo from %s: %v\nOutput: %s", localDir, err, output)
 	}
 
@@ -111,7 +116,7 @@ func TestClone_Success(t *testing.T) {
 		t.Fatalf("Failed to create parent directory %s: %v", parentDir, err)
 	}
 	destination := "cloned-repo"
-	dest, err := clone(bareDir, parentDir, destination)
+	dest, err := clone(ctx, bareDir, parentDir, destination)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -132,3 +137,144 @@ func TestClone_Success(t *testing.T) {
 		t.Errorf("Expected .git directory in %s, not found", dest)
 	}
 }
+
+// TestGitErrorIncludesOutput tests that failed Git commands report the output of git once per directory
+func TestGitErrorIncludesOutput(t *testing.T) {
+	ctx := context.Background()
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	localDir := filepath.Join(tempDir, "local")
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", localDir, err)
+	}
+	if _, err := GitCommand(ctx, localDir, "init"); err != nil {
+		t.Fatalf("Failed to init Git repo in %s: %v", localDir, err)
+	}
+	if _, err := GitCommand(ctx, localDir, "remote", "add", "origin", filepath.Join(tempDir, "missing.git")); err != nil {
+		t.Fatalf("Failed to add remote in %s: %v", localDir, err)
+	}
+
+	err := pushToRemote(ctx, localDir, "main", false)
+	if err == nil {
+		t.Fatalf("Expected push to a missing remote to fail")
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "failed to push main to origin: failed to run 'git push origin main' in "+localDir) {
+		t.Errorf("Unexpected error %q", msg)
+	}
+	if !strings.Contains(msg, "\nOutput: ") || !strings.Contains(msg, "missing.git") {
+		t.Errorf("Expected the output of git in %q", msg)
+	}
+	if strings.Count(msg, localDir) != 1 {
+		t.Errorf("Expected the directory once in %q", msg)
+	}
+}
+
+// TestGitCommandCancellation tests that cancelled and timed out Git commands report their kind
+func TestGitCommandCancellation(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GitCommand(ctx, tempDir, "init"); KindOf(err) != KindCanceled || ExitCode(err) != 130 {
+		t.Errorf("Expected a cancelled git init, got %v (kind %s)", err, KindOf(err))
+	}
+
+	t.Setenv("COSM_DEPOT_PATH", tempDir)
+	t.Setenv("COSM_TIMEOUT", "1ns")
+	t.Setenv("COSM_RETRIES", "0")
+	_, err := GitCommand(context.Background(), tempDir, "fetch", "origin")
+	if KindOf(err) != KindNetwork || err == nil || !strings.Contains(err.Error(), "timed out after") {
+		t.Errorf("Expected a timed out git fetch, got %v (kind %s)", err, KindOf(err))
+	}
+}
+
+// TestGitCommandRetries tests that connection failures are retried and missing repositories are not
+func TestGitCommandRetries(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("COSM_DEPOT_PATH", tempDir)
+	t.Setenv("COSM_RETRIES", "2")
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	logging.SetOutput(&stdout, &stderr)
+	defer logging.SetOutput(os.Stdout, os.Stderr)
+
+	if _, err := GitCommand(context.Background(), tempDir, "ls-remote", "http://127.0.0.1:1/repo.git"); err == nil {
+		t.Fatalf("Expected ls-remote of a closed port to fail")
+	}
+	if retries := strings.Count(stderr.String(), "retrying in"); retries != 2 {
+		t.Errorf("Expected 2 retries of a refused connection, got %d:\n%s", retries, stderr.String())
+	}
+
+	stderr.Reset()
+	if _, err := GitCommand(context.Background(), tempDir, "ls-remote", filepath.Join(tempDir, "missing.git")); err == nil {
+		t.Fatalf("Expected ls-remote of a missing repository to fail")
+	}
+	if strings.Contains(stderr.String(), "retrying in") {
+		t.Errorf("Expected no retries of a missing repository, got:\n%s", stderr.String())
+	}
+}
+
+func TestCloneStagingDirs(t *testing.T) {
+	ctx := context.Background()
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Setenv("COSM_DEPOT_PATH", tempDir)
+	repoDir := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init"}, {"commit", "--allow-empty", "-m", "Initial commit"}} {
+		if _, err := GitCommand(ctx, repoDir, args[0], args[1:]...); err != nil {
+			t.Fatalf("git %s failed: %v", args[0], err)
+		}
+	}
+
+	// Concurrent clones are staged in different directories, removed when cosm exits
+	first, err := clonePackageToTempDir(ctx, tempDir, repoDir, false)
+	if err != nil {
+		t.Fatalf("clonePackageToTempDir failed: %v", err)
+	}
+	second, err := clonePackageToTempDir(ctx, tempDir, repoDir, false)
+	if err != nil {
+		t.Fatalf("clonePackageToTempDir failed: %v", err)
+	}
+	if first == second {
+		t.Fatalf("Expected unique staging directories, got %s twice", first)
+	}
+	RemoveTempDirs()
+	for _, path := range []string{first, second} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", path, err)
+		}
+	}
+
+	// A failed clone leaves nothing behind
+	if _, err := clonePackageToTempDir(ctx, tempDir, filepath.Join(tempDir, "missing"), false); err == nil {
+		t.Fatalf("Expected clone of a missing repository to fail")
+	}
+	entries, _ := os.ReadDir(filepath.Join(tempDir, "clones"))
+	if len(entries) != 0 {
+		t.Errorf("Expected no staging directories after a failed clone, got %d", len(entries))
+	}
+
+	// Staging directories of crashed runs are swept once they are old
+	stale := filepath.Join(tempDir, "clones", "tmp-clone-stale")
+	recent := filepath.Join(tempDir, "registries", "tmp-registry-clone-recent")
+	for _, path := range []string{stale, recent} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTempDirAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	SweepStaleTempDirs()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected stale staging directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected recent staging directory to be kept: %v", err)
+	}
+}
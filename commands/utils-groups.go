@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"cosm/types"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+// mainGroup is the name of the group of the dependencies that have no group in Project.json
+const mainGroup = "main"
+
+// groupName returns a group as it is stored in Project.json: empty for the main group
+func groupName(group string) string {
+	if group == mainGroup {
+		return ""
+	}
+	return group
+}
+
+// dependencyGroup returns the group of a dependency, or mainGroup if it has none
+func dependencyGroup(dep types.Dependency) string {
+	if dep.Group == "" {
+		return mainGroup
+	}
+	return dep.Group
+}
+
+// validateGroupName checks that a group has the same form as an alias
+func validateGroupName(group string) error {
+	if group != "" && !aliasPattern.MatchString(group) {
+		return validationError("invalid group '%s': must start with a letter and contain only letters, digits, '-' and '_'", group)
+	}
+	return nil
+}
+
+// parseGroupFlags returns the sorted groups selected with --with, which adds groups to the main
+// group, or --only, which selects just the given groups; the main group if neither is given
+func parseGroupFlags(cmd *cobra.Command, project *types.Project) ([]string, error) {
+	with, _ := cmd.Flags().GetStringSlice("with")
+	only, _ := cmd.Flags().GetStringSlice("only")
+	if len(with) > 0 && len(only) > 0 {
+		return nil, validationError("--with cannot be combined with --only")
+	}
+	groups := append([]string{mainGroup}, with...)
+	if len(only) > 0 {
+		groups = only
+	}
+	for _, group := range groups {
+		if err := validateGroupName(group); err != nil {
+			return nil, err
+		}
+		if group != mainGroup && !hasGroup(project, group) {
+			return nil, notFoundError("no dependencies in group '%s' in Project.json", group)
+		}
+	}
+	slices.Sort(groups)
+	return slices.Compact(groups), nil
+}
+
+// hasGroup reports whether a project has dependencies in a group
+func hasGroup(project *types.Project, group string) bool {
+	for _, dep := range project.Deps {
+		if dependencyGroup(dep) == group {
+			return true
+		}
+	}
+	return false
+}
+
+// selectGroups returns a copy of the project with only the dependencies in the given groups
+func selectGroups(project *types.Project, groups []string) *types.Project {
+	selected := *project
+	selected.Deps = make(map[string]types.Dependency)
+	for key, dep := range project.Deps {
+		if slices.Contains(groups, dependencyGroup(dep)) {
+			selected.Deps[key] = dep
+		}
+	}
+	return &selected
+}
+
+// publishedGroups returns the groups of a project that are published in the registries: the main
+// group and the groups in publishgroups
+func publishedGroups(project *types.Project) []string {
+	return append([]string{mainGroup}, project.PublishGroups...)
+}
+
+// publishedDeps returns the dependencies of a project as they are published in a registry: the
+// published groups, without group names, and path dependencies and dependencies pinned to commits
+// replaced by their recorded version
+func publishedDeps(project *types.Project) map[string]types.Dependency {
+	published := make(map[string]types.Dependency)
+	for key, dep := range selectGroups(project, publishedGroups(project)).Deps {
+		dep.Path = ""
+		dep.SHA1 = ""
+		dep.Group = ""
+		published[key] = dep
+	}
+	return published
+}
+
+// recordedGroups returns the groups that the build list of a project directory was last resolved
+// for, or the main group if it was not resolved yet
+func recordedGroups(projectDir string) []string {
+	data, err := os.ReadFile(filepath.Join(projectDir, ".cosm", "buildlist.meta"))
+	if err != nil {
+		return []string{mainGroup}
+	}
+	var meta buildListMeta
+	if err := json.Unmarshal(data, &meta); err != nil || len(meta.Groups) == 0 {
+		return []string{mainGroup}
+	}
+	return meta.Groups
+}
@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cosm/types"
+)
+
+// importScanner finds the modules imported by the source files of a language
+type importScanner struct {
+	extensions []string                     // Extensions of the source files, e.g. ".py"
+	scan       func(source string) []string // Top-level names of the modules imported by a source file
+}
+
+// importScanners are the import scanners by language. Projects without a language are scanned
+// as Terra, like their environment is set up for Terra and Lua.
+var importScanners = map[string]importScanner{
+	"terra":  {extensions: []string{".t", ".lua"}, scan: scanLuaImports},
+	"lua":    {extensions: []string{".lua"}, scan: scanLuaImports},
+	"python": {extensions: []string{".py"}, scan: scanPythonImports},
+}
+
+// RegisterImportScanner adds or replaces the import scanner of a language, so that programs that
+// use cosm as a library can support cosm rm --unused for other languages. scan returns the
+// top-level names of the modules imported by the content of a source file.
+func RegisterImportScanner(language string, extensions []string, scan func(source string) []string) {
+	importScanners[strings.ToLower(language)] = importScanner{extensions: extensions, scan: scan}
+}
+
+var (
+	luaRequirePattern   = regexp.MustCompile(`\b(?:require|import)\s*\(?\s*["']([^"']+)["']`)
+	pythonImportPattern = regexp.MustCompile(`(?m)^\s*import\s+([^#\n]+)`)
+	pythonFromPattern   = regexp.MustCompile(`(?m)^\s*from\s+([\w.]+)\s+import\b`)
+)
+
+// scanLuaImports returns the modules loaded with require or import in Lua and Terra code
+func scanLuaImports(source string) []string {
+	var modules []string
+	for _, match := range luaRequirePattern.FindAllStringSubmatch(source, -1) {
+		modules = append(modules, topLevelModule(match[1]))
+	}
+	return modules
+}
+
+// scanPythonImports returns the modules imported with import or from ... import in Python code.
+// Relative imports refer to the project itself and are skipped.
+func scanPythonImports(source string) []string {
+	var modules []string
+	for _, match := range pythonImportPattern.FindAllStringSubmatch(source, -1) {
+		for _, name := range strings.Split(match[1], ",") {
+			if fields := strings.Fields(name); len(fields) > 0 {
+				modules = append(modules, topLevelModule(fields[0]))
+			}
+		}
+	}
+	for _, match := range pythonFromPattern.FindAllStringSubmatch(source, -1) {
+		if !strings.HasPrefix(match[1], ".") {
+			modules = append(modules, topLevelModule(match[1]))
+		}
+	}
+	return modules
+}
+
+// topLevelModule returns the first component of a module path, e.g. "pkg" for "pkg.sub.mod"
+func topLevelModule(module string) string {
+	if i := strings.IndexAny(module, "./"); i >= 0 {
+		return module[:i]
+	}
+	return module
+}
+
+// scanProjectImports returns the top-level modules imported by the source files of a project
+// in its source directory
+func scanProjectImports(language, srcDir string) (map[string]bool, error) {
+	if language == "" {
+		language = "terra"
+	}
+	scanner, ok := importScanners[strings.ToLower(language)]
+	if !ok {
+		return nil, validationError("cannot scan the imports of language '%s'", language)
+	}
+	imports := make(map[string]bool)
+	err := filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !hasExtension(path, scanner.extensions) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, module := range scanner.scan(string(data)) {
+			imports[module] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan imports in %s: %w", srcDir, err)
+	}
+	return imports, nil
+}
+
+// findUnusedDependencies returns the keys of the direct dependencies of a project that are not
+// imported by any of its source files, sorted
+func findUnusedDependencies(project *types.Project, srcDir string) ([]string, error) {
+	imports, err := scanProjectImports(project.Language, srcDir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key, dep := range project.Deps {
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+		if !imports[name] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// hasExtension reports whether a path has one of the extensions
+func hasExtension(path string, extensions []string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
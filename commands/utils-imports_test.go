@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScanImports(t *testing.T) {
+	tests := []struct {
+		name     string
+		scan     func(string) []string
+		source   string
+		expected []string
+	}{
+		{"lua_require", scanLuaImports, "local a = require(\"alpha.core\")\nlocal b = require 'beta'\n", []string{"alpha", "beta"}},
+		{"terra_import", scanLuaImports, "import \"gamma/lang\"\nlocal x = requirex", []string{"gamma"}},
+		{"python_import", scanPythonImports, "import alpha.core, beta as b\n# import ignored\n", []string{"alpha", "beta"}},
+		{"python_from", scanPythonImports, "from gamma.sub import x\nfrom . import local\nfrom .rel import y\n", []string{"gamma"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scan(tt.source); !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
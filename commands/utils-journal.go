@@ -0,0 +1,293 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalOperation collects the metadata files changed and the Git repositories committed to by
+// the running command, until it is appended to the journal by FinishOperation
+type journalOperation struct {
+	mu           sync.Mutex
+	entry        types.JournalEntry
+	files        map[string]int // Index in entry.Files by absolute path
+	repositories map[string]bool
+}
+
+// currentOperation is the operation of the running command; nil if none is recorded
+var currentOperation *journalOperation
+
+// journalGitSubcommands are the Git subcommands whose effects cosm undo cannot revert
+var journalGitSubcommands = []string{"commit", "tag", "push"}
+
+// journalMaxEntries is the number of operations that the journal keeps; older operations are pruned
+// once the journal holds a quarter more, and can no longer be undone
+const journalMaxEntries = 100
+
+// journalFile returns the path of the operation journal in the depot
+func journalFile(cosmDir string) string {
+	return filepath.Join(cosmDir, "logs", "journal.jsonl")
+}
+
+// BeginOperation starts recording the changes made by a command in the journal
+func BeginOperation(command string) {
+	dir, _ := os.Getwd()
+	beginOperation(command, dir)
+}
+
+// beginOperation starts recording the changes made by a command that works in dir
+func beginOperation(command, dir string) {
+	currentOperation = &journalOperation{
+		entry:        types.JournalEntry{Time: time.Now().UTC(), Command: command, Dir: dir, Files: []types.JournalFile{}},
+		files:        make(map[string]int),
+		repositories: make(map[string]bool),
+	}
+}
+
+// FinishOperation appends the recorded operation to the journal if it changed metadata files or undid an operation
+func FinishOperation(err error) {
+	op := currentOperation
+	currentOperation = nil
+	if op == nil || (len(op.entry.Files) == 0 && op.entry.Undoes == 0) {
+		return
+	}
+	op.entry.Failed = err != nil
+	for dir := range op.repositories {
+		op.entry.Repositories = append(op.entry.Repositories, dir)
+	}
+	sort.Strings(op.entry.Repositories)
+	cosmDir, cosmErr := getCosmDir()
+	if cosmErr != nil {
+		return
+	}
+	if err := appendJournalEntry(cosmDir, op.entry); err != nil {
+		logging.Warnf("failed to record the operation in the journal: %v", err)
+	}
+}
+
+// recordFileChange records that a metadata file is replaced; only the first previous content is kept
+func recordFileChange(filename string, previous []byte, existed bool, result []byte) {
+	op := currentOperation
+	if op == nil {
+		return
+	}
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if i, ok := op.files[path]; ok {
+		op.entry.Files[i].Result = string(result)
+		return
+	}
+	file := types.JournalFile{Path: path, Result: string(result)}
+	if existed {
+		content := string(previous)
+		file.Previous = &content
+	}
+	op.files[path] = len(op.entry.Files)
+	op.entry.Files = append(op.entry.Files, file)
+}
+
+// recordGitChange records that a Git command changed the history of a repository; listing tags does not
+func recordGitChange(dir, subcommand string, args []string) {
+	op := currentOperation
+	if op == nil || !contains(journalGitSubcommands, subcommand) || (subcommand == "tag" && len(args) == 0) {
+		return
+	}
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.repositories[path] = true
+}
+
+// markUndo records that the running operation reverts the operation with the given ID
+func markUndo(id int) {
+	if currentOperation != nil {
+		currentOperation.entry.Undoes = id
+	}
+}
+
+// loadJournal reads the entries of the journal, oldest first
+func loadJournal(cosmDir string) ([]types.JournalEntry, error) {
+	filename := journalFile(cosmDir)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer file.Close()
+	var entries []types.JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry types.JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of %s: %w", line, filename, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return entries, nil
+}
+
+// appendJournalEntry numbers the entry after the last one and appends it to the journal, pruning
+// the oldest entries once the journal holds too many
+func appendJournalEntry(cosmDir string, entry types.JournalEntry) error {
+	unlock, err := acquireLock(context.Background(), filepath.Join(cosmDir, "locks", "journal.lock"), "journal")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	filename := journalFile(cosmDir)
+	first, last, err := journalBounds(filename)
+	if err != nil {
+		return err
+	}
+	entry.ID = last + 1
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", filename, err)
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	if first > 0 && entry.ID-first+1 > journalMaxEntries+journalMaxEntries/4 {
+		return pruneJournal(filename, entry.ID-journalMaxEntries+1)
+	}
+	return nil
+}
+
+// journalEntryID returns the ID of the journal entry that a line starts with; the ID is the first
+// field of an entry, so the entry, which may hold whole files, need not be parsed
+func journalEntryID(line []byte) (int, error) {
+	var id int
+	if _, err := fmt.Sscanf(string(line), `{"id":%d`, &id); err != nil {
+		return 0, fmt.Errorf("invalid journal entry: %w", err)
+	}
+	return id, nil
+}
+
+// journalBounds returns the IDs of the first and the last entry of the journal, reading only the
+// start and the end of the file; both are 0 if the journal is empty or does not exist
+func journalBounds(filename string) (first, last int, err error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat %s: %w", filename, err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return 0, 0, nil
+	}
+
+	// Find the start of the last line, searching backwards from before the final newline
+	const chunkSize = 4096
+	start := int64(0)
+	buf := make([]byte, chunkSize)
+	for end := size - 1; end > 0 && start == 0; end -= chunkSize {
+		offset := max(end-chunkSize, 0)
+		n, err := file.ReadAt(buf[:end-offset], offset)
+		if err != nil && err != io.EOF {
+			return 0, 0, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			start = offset + int64(i) + 1
+		}
+	}
+	readID := func(offset int64) (int, error) {
+		n, err := file.ReadAt(buf[:64], offset)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		id, err := journalEntryID(buf[:n])
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		return id, nil
+	}
+	if first, err = readID(0); err != nil {
+		return 0, 0, err
+	}
+	if last, err = readID(start); err != nil {
+		return 0, 0, err
+	}
+	return first, last, nil
+}
+
+// pruneJournal rewrites the journal with only the entries from the given ID on
+func pruneJournal(filename string, firstID int) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer file.Close()
+	reader, writer := io.Pipe()
+	go func() {
+		lines := bufio.NewReader(file)
+		for {
+			line, err := lines.ReadBytes('\n')
+			if len(line) > 0 {
+				if id, idErr := journalEntryID(line); idErr != nil || id >= firstID {
+					if _, err := writer.Write(line); err != nil {
+						return
+					}
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	err = writeFileAtomically(filename, reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to prune %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"cosm/types"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAppendJournalEntry tests that entries are numbered after the last one and that the oldest
+// entries are pruned
+func TestAppendJournalEntry(t *testing.T) {
+	cosmDir := t.TempDir()
+	if first, last, err := journalBounds(journalFile(cosmDir)); err != nil || first != 0 || last != 0 {
+		t.Fatalf("Expected no entries in a missing journal, got %d-%d (err: %v)", first, last, err)
+	}
+	// Entries that hold large files span several chunks of the search for the last line
+	content := strings.Repeat("x", 10000)
+	total := journalMaxEntries + journalMaxEntries/4 + 1
+	for i := 0; i < total; i++ {
+		entry := types.JournalEntry{Time: time.Now(), Command: "cosm add", Files: []types.JournalFile{{Path: "Project.json", Result: content}}}
+		if err := appendJournalEntry(cosmDir, entry); err != nil {
+			t.Fatalf("Failed to append entry %d: %v", i+1, err)
+		}
+		if i == 1 {
+			if first, last, err := journalBounds(journalFile(cosmDir)); err != nil || first != 1 || last != 2 {
+				t.Fatalf("Expected entries 1-2, got %d-%d (err: %v)", first, last, err)
+			}
+		}
+	}
+
+	entries, err := loadJournal(cosmDir)
+	if err != nil {
+		t.Fatalf("Failed to load the journal: %v", err)
+	}
+	if len(entries) != journalMaxEntries || entries[0].ID != total-journalMaxEntries+1 || entries[len(entries)-1].ID != total {
+		t.Errorf("Expected the last %d entries up to %d, got %d entries from %d", journalMaxEntries, total, len(entries), entries[0].ID)
+	}
+	if entries[len(entries)-1].Files[0].Result != content {
+		t.Errorf("Expected the files of the entries to be kept")
+	}
+	if _, err := os.Stat(journalFile(cosmDir)); err != nil {
+		t.Errorf("Expected the journal to exist: %v", err)
+	}
+}
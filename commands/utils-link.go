@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// identicalPackageFiles maps the files of a version of a package, relative to the package root,
+// to files of other versions of the package in the depot that have the same Git blob and mode,
+// so that they can be hard-linked instead of copied. A file in the depot is only linked if its
+// content still matches the blob, so that files that were edited in the depot do not spread. Versions whose commit is not in the
+// clone are left out; the map is empty if the clone cannot be read.
+func identicalPackageFiles(ctx context.Context, clonePath, packageDir, sha1, subdir string) map[string]string {
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		return nil
+	}
+	files := packageTreeFiles(ctx, clonePath, sha1, subdir)
+	if len(files) == 0 {
+		return nil
+	}
+	links := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == sha1 || !hasCommit(ctx, clonePath, entry.Name()) {
+			continue
+		}
+		versionDir := filepath.Join(packageDir, entry.Name())
+		for relPath, file := range packageTreeFiles(ctx, clonePath, entry.Name(), subdir) {
+			if _, linked := links[relPath]; linked || files[relPath] != file {
+				continue
+			}
+			existing := filepath.Join(versionDir, filepath.FromSlash(relPath))
+			// The file in the depot must still hold the blob as it was materialized
+			if info, err := os.Lstat(existing); err != nil || !info.Mode().IsRegular() || info.Size() != file.size {
+				continue
+			}
+			if data, err := os.ReadFile(existing); err == nil && gitBlobID(data) == file.blob {
+				links[relPath] = existing
+			}
+		}
+	}
+	return links
+}
+
+// treeFile identifies the content of a file in a Git tree
+type treeFile struct {
+	mode string
+	blob string
+	size int64
+}
+
+// packageTreeFiles lists the regular files in the tree of a commit, or of its subdirectory,
+// by their slash-separated path relative to that directory
+func packageTreeFiles(ctx context.Context, clonePath, sha1, subdir string) map[string]treeFile {
+	treeish := sha1
+	if subdir != "" {
+		treeish += ":" + path.Clean(filepath.ToSlash(subdir))
+	}
+	output, err := GitCommand(ctx, clonePath, "ls-tree", "-r", "-l", "-z", treeish)
+	if err != nil {
+		return nil
+	}
+	files := make(map[string]treeFile)
+	for _, line := range strings.Split(output, "\x00") {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, relPath, found := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 4 || fields[1] != "blob" || (fields[0] != "100644" && fields[0] != "100755") {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		files[relPath] = treeFile{mode: fields[0], blob: fields[2], size: size}
+	}
+	return files
+}
+
+// placeFile materializes a regular file at dest: as a reflink of src if the filesystem supports
+// it, else as a hard link to an identical file elsewhere in the depot if link is set, and else as
+// a copy. reflinks is cleared once the filesystem turns out not to support reflinks.
+func placeFile(src, dest, link string, mode os.FileMode, reflinks *bool) error {
+	if *reflinks {
+		if err := reflinkFile(src, dest, mode); err == nil {
+			return nil
+		}
+		*reflinks = false
+	}
+	if link != "" && os.Link(link, dest) == nil {
+		return nil
+	}
+	return copyFile(src, dest, mode)
+}
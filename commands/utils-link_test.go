@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"context"
+	"cosm/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCopyPackageFilesLinksIdenticalFiles tests that a new version of a package in the depot shares
+// the files that did not change with an older version
+func TestCopyPackageFilesLinksIdenticalFiles(t *testing.T) {
+	ctx := context.Background()
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	repoDir := filepath.Join(tempDir, "repo")
+	packageDir := filepath.Join(tempDir, "packages", "mypkg")
+	if err := os.MkdirAll(filepath.Join(repoDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	commit := func(files map[string]string) string {
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+		}
+		for _, args := range [][]string{{"add", "."}, {"commit", "-m", "Update"}} {
+			if _, err := GitCommand(ctx, repoDir, args[0], args[1:]...); err != nil {
+				t.Fatalf("git %s failed: %v", args[0], err)
+			}
+		}
+		sha1, err := GitCommand(ctx, repoDir, "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatalf("Failed to get HEAD: %v", err)
+		}
+		return strings.TrimSpace(sha1)
+	}
+	if _, err := GitCommand(ctx, repoDir, "init"); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+
+	// Materialize the first version
+	first := commit(map[string]string{"src/same.lua": "return 1\n", "src/changed.lua": "return 1\n"})
+	if err := copyPackageFiles(repoDir, filepath.Join(packageDir, first), nil); err != nil {
+		t.Fatalf("Failed to copy the first version: %v", err)
+	}
+
+	// Only the unchanged file of the second version is identical to a file of the first
+	second := commit(map[string]string{"src/changed.lua": "return 2\n"})
+	links := identicalPackageFiles(ctx, repoDir, packageDir, second, "")
+	if expected := filepath.Join(packageDir, first, "src", "same.lua"); links["src/same.lua"] != expected || len(links) != 1 {
+		t.Fatalf("Expected only src/same.lua to be linked to %s, got %v", expected, links)
+	}
+	if links := identicalPackageFiles(ctx, repoDir, packageDir, second, "src"); links["same.lua"] != "" {
+		t.Errorf("Expected no links for the subdirectory of a version materialized from the root, got %v", links)
+	}
+
+	// A file that was edited in the depot is not linked, even if its size did not change
+	edited := filepath.Join(packageDir, first, "src", "same.lua")
+	if err := os.WriteFile(edited, []byte("return 9\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit %s: %v", edited, err)
+	}
+	if links := identicalPackageFiles(ctx, repoDir, packageDir, second, ""); len(links) != 0 {
+		t.Errorf("Expected no links to an edited file, got %v", links)
+	}
+	if err := os.WriteFile(edited, []byte("return 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to restore %s: %v", edited, err)
+	}
+	destPath := filepath.Join(packageDir, second)
+	if err := copyPackageFiles(repoDir, destPath, links); err != nil {
+		t.Fatalf("Failed to copy the second version: %v", err)
+	}
+	for name, expected := range map[string]string{"same.lua": "return 1\n", "changed.lua": "return 2\n"} {
+		if data, err := os.ReadFile(filepath.Join(destPath, "src", name)); err != nil || string(data) != expected {
+			t.Errorf("Expected %q in src/%s, got %q (%v)", expected, name, data, err)
+		}
+	}
+
+	// Without reflinks, the identical file is a hard link
+	probe := filepath.Join(tempDir, "probe")
+	if reflinkFile(filepath.Join(repoDir, "src", "same.lua"), probe, 0644) == nil {
+		t.Skip("the filesystem supports reflinks")
+	}
+	same := func(name string) bool {
+		a, errA := os.Stat(filepath.Join(packageDir, first, "src", name))
+		b, errB := os.Stat(filepath.Join(destPath, "src", name))
+		return errA == nil && errB == nil && os.SameFile(a, b)
+	}
+	if !same("same.lua") {
+		t.Errorf("Expected src/same.lua to be hard-linked to the first version")
+	}
+	if same("changed.lua") {
+		t.Errorf("Expected src/changed.lua not to be linked to the first version")
+	}
+}
+
+// TestTreeDigest tests that the digest of a package computed from its Git tree matches the digest
+// of the materialized package
+func TestTreeDigest(t *testing.T) {
+	ctx := context.Background()
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	repoDir := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(filepath.Join(repoDir, "pkg", "src"), 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	files := map[string]os.FileMode{"pkg/src/main.t": 0644, "pkg/run.sh": 0755, "pkg/.gitignore": 0644, "README.md": 0644}
+	for name, mode := range files {
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(name+"\n"), mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	commit := func(args ...[]string) string {
+		for _, args := range args {
+			if _, err := GitCommand(ctx, repoDir, args[0], args[1:]...); err != nil {
+				t.Fatalf("git %s failed: %v", args[0], err)
+			}
+		}
+		sha1, err := GitCommand(ctx, repoDir, "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatalf("Failed to get HEAD: %v", err)
+		}
+		return strings.TrimSpace(sha1)
+	}
+	sha1 := commit([]string{"init"}, []string{"add", "."}, []string{"commit", "-m", "Initial commit"})
+
+	expected, err := treeDigest(ctx, repoDir, sha1, "pkg")
+	if err != nil || expected == "" {
+		t.Fatalf("Failed to compute the digest of the tree: %q (err: %v)", expected, err)
+	}
+	destPath := filepath.Join(tempDir, "packages", "pkg")
+	if err := copyPackageFiles(filepath.Join(repoDir, "pkg"), destPath, nil); err != nil {
+		t.Fatalf("Failed to copy the package: %v", err)
+	}
+	if err := writePackageMeta(destPath, &types.Specs{Name: "pkg"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if digest, err := directoryDigest(destPath); err != nil || digest != expected {
+		t.Errorf("Expected the digest of the package to be %s, got %s (err: %v)", expected, digest, err)
+	}
+	if err := os.WriteFile(filepath.Join(destPath, "src", "main.t"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if digest, _ := directoryDigest(destPath); digest == expected {
+		t.Errorf("Expected the digest to change with the content of a file")
+	}
+
+	// Symbolic links are materialized as copies, so their packages have no digest
+	if err := os.Symlink("src/main.t", filepath.Join(repoDir, "pkg", "main.t")); err != nil {
+		t.Fatal(err)
+	}
+	sha1 = commit([]string{"add", "."}, []string{"commit", "-m", "Add a link"})
+	if digest, err := treeDigest(ctx, repoDir, sha1, "pkg"); err != nil || digest != "" {
+		t.Errorf("Expected no digest for a package with a symbolic link, got %q (err: %v)", digest, err)
+	}
+}
@@ -0,0 +1,298 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"cosm/logging"
+
+	"github.com/google/uuid"
+)
+
+// lockTimeout is how long a command waits for a lock held by another cosm process
+var lockTimeout = 5 * time.Minute
+
+// lockPollInterval is how often a waiting command checks whether a lock was released
+var lockPollInterval = 100 * time.Millisecond
+
+// staleLockAge is the age after which a lock of another host is considered abandoned; locks of
+// this host are stale as soon as their process no longer runs
+const staleLockAge = 24 * time.Hour
+
+// lockInfo is the content of a lock file, identifying the process that holds the lock
+type lockInfo struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Command  string    `json:"command"`
+	Acquired time.Time `json:"acquired"`
+	Token    string    `json:"token,omitempty"` // Tells the locks of a process apart
+}
+
+// heldLock is a lock held by this process: how often it was taken, and the token in its lock file
+type heldLock struct {
+	count int
+	token string
+}
+
+// heldLocks records the locks held by this process, so that a lock can be taken again by the
+// functions that run while it is held
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = make(map[string]*heldLock)
+)
+
+// lockDepot locks the depot for a command that changes registries.json, the registry clones or
+// the package clones and checkouts. The returned function releases the lock.
+func lockDepot(ctx context.Context) (func(), error) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(ctx, filepath.Join(cosmDir, "locks", "depot.lock"), "depot")
+}
+
+// lockRegistry locks a registry for a command that pulls, changes or pushes it. Commands that
+// also need the depot lock take it first. The returned function releases the lock.
+func lockRegistry(ctx context.Context, registryName string) (func(), error) {
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(ctx, filepath.Join(cosmDir, "locks", "registry-"+registryName+".lock"), fmt.Sprintf("registry '%s'", registryName))
+}
+
+// acquireLock creates a lock file, waiting while another live cosm process holds it. Stale lock
+// files are removed. Locks are reentrant within a process.
+func acquireLock(ctx context.Context, path, what string) (func(), error) {
+	heldLocksMu.Lock()
+	if held := heldLocks[path]; held != nil {
+		held.count++
+		heldLocksMu.Unlock()
+		return func() { releaseLock(path) }, nil
+	}
+	heldLocksMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create locks directory: %w", err)
+	}
+	deadline := time.Now().Add(lockTimeout)
+	waiting := false
+	for {
+		token, created, err := createLockFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			heldLocksMu.Lock()
+			heldLocks[path] = &heldLock{count: 1, token: token}
+			heldLocksMu.Unlock()
+			return func() { releaseLock(path) }, nil
+		}
+
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Released in the meantime
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lock %s: %w", path, err)
+		}
+		info, err := parseLockFile(path, data)
+		if err != nil || isStaleLock(info) {
+			if err := removeStaleLock(path, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, conflictError("%s is locked by cosm process %d on %s since %s (%s); remove %s if that process no longer runs",
+				what, info.PID, info.Host, info.Acquired.Format(time.RFC3339), info.Command, path)
+		}
+		if !waiting {
+			logging.Infof("Waiting for %s, locked by cosm process %d (%s)", what, info.PID, info.Command)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// createLockFile creates the lock file exclusively and returns its token; it returns false if the
+// file already exists
+func createLockFile(path string) (string, bool, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create lock %s: %w", path, err)
+	}
+	defer file.Close()
+	host, _ := os.Hostname()
+	info := lockInfo{
+		PID:      os.Getpid(),
+		Host:     host,
+		Command:  strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " "),
+		Acquired: time.Now(),
+		Token:    uuid.NewString(),
+	}
+	if err := json.NewEncoder(file).Encode(info); err != nil {
+		os.Remove(path)
+		return "", false, fmt.Errorf("failed to write lock %s: %w", path, err)
+	}
+	return info.Token, true, nil
+}
+
+// removeStaleLock removes a stale lock file with the given content. The lock file is renamed aside
+// first and only removed if it still has that content, so that of several processes that found
+// the same stale lock, only one removes it; a lock that another process created in its place in
+// the meantime is put back.
+func removeStaleLock(path string, stale []byte) error {
+	aside := fmt.Sprintf("%s.stale-%s", path, uuid.NewString())
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil // Removed by another process
+		}
+		return fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+	}
+	defer os.Remove(aside)
+	data, err := os.ReadFile(aside)
+	if err != nil {
+		return fmt.Errorf("failed to read stale lock %s: %w", aside, err)
+	}
+	if !bytes.Equal(data, stale) {
+		// Link fails if yet another process created a lock since, which is then kept
+		if err := os.Link(aside, path); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to restore lock %s: %w", path, err)
+		}
+		return nil
+	}
+	logging.Warnf("Removing stale lock %s", path)
+	return nil
+}
+
+// readLockFile reads the process that holds a lock
+func readLockFile(path string) (lockInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lockInfo{}, err
+	}
+	return parseLockFile(path, data)
+}
+
+// parseLockFile parses the content of a lock file
+func parseLockFile(path string, data []byte) (lockInfo, error) {
+	var info lockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		// The lock may be read while its holder is still writing it
+		if time.Since(fileModTime(path)) < time.Second {
+			return lockInfo{PID: -1, Acquired: time.Now()}, nil
+		}
+		return info, fmt.Errorf("invalid lock %s: %w", path, err)
+	}
+	return info, nil
+}
+
+// fileModTime returns the modification time of a file, or the current time if it cannot be read
+func fileModTime(path string) time.Time {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Now()
+	}
+	return stat.ModTime()
+}
+
+// isStaleLock reports whether the process that holds a lock no longer runs. The processes of
+// other hosts cannot be checked, so their locks become stale after staleLockAge.
+func isStaleLock(info lockInfo) bool {
+	if info.PID == -1 {
+		return false // Being written
+	}
+	host, _ := os.Hostname()
+	if info.Host != host {
+		return time.Since(info.Acquired) > staleLockAge
+	}
+	return !processRunning(info.PID)
+}
+
+// processRunning reports whether a process with the given ID runs on this host
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true // FindProcess fails for processes that do not exist
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// releaseLock releases a lock taken by this process, removing the lock file when it is no
+// longer held. A lock file that no longer has the token of this process, because another process
+// took the lock over, is left alone.
+func releaseLock(path string) {
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+	held := heldLocks[path]
+	if held == nil {
+		return
+	}
+	held.count--
+	if held.count > 0 {
+		return
+	}
+	delete(heldLocks, path)
+	info, err := readLockFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Warnf("Failed to read lock %s: %v", path, err)
+		}
+		return
+	}
+	if info.Token != held.token {
+		logging.Warnf("Lock %s was taken over by cosm process %d; leaving it", path, info.PID)
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logging.Warnf("Failed to remove lock %s: %v", path, err)
+	}
+}
+
+// lockRegistries locks several registries in alphabetical order, so that commands locking the
+// same registries cannot wait for each other. The returned function releases the locks.
+func lockRegistries(ctx context.Context, registryNames []string) (func(), error) {
+	names := append([]string(nil), registryNames...)
+	sort.Strings(names)
+	var unlocks []func()
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, name := range names {
+		unlock, err := lockRegistry(ctx, name)
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
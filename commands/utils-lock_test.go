@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestLock writes a lock file as if it was held by another process
+func writeTestLock(t *testing.T, depot string, info lockInfo) string {
+	t.Helper()
+	path := filepath.Join(depot, "locks", "depot.lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(info)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDepotLock(t *testing.T) {
+	depot := t.TempDir()
+	t.Setenv("COSM_DEPOT_PATH", depot)
+	host, _ := os.Hostname()
+	ctx := context.Background()
+
+	t.Run("Reentrant", func(t *testing.T) {
+		unlock, err := lockDepot(ctx)
+		if err != nil {
+			t.Fatalf("lockDepot failed: %v", err)
+		}
+		unlockAgain, err := lockDepot(ctx)
+		if err != nil {
+			t.Fatalf("lockDepot failed while held by this process: %v", err)
+		}
+		path := filepath.Join(depot, "locks", "depot.lock")
+		unlockAgain()
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected lock to be held until its last release: %v", err)
+		}
+		unlock()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected lock file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("StaleLock", func(t *testing.T) {
+		exited := exec.Command("true")
+		if err := exited.Run(); err != nil {
+			t.Skipf("cannot run a short-lived process: %v", err)
+		}
+		writeTestLock(t, depot, lockInfo{PID: exited.Process.Pid, Host: host, Command: "cosm release", Acquired: time.Now()})
+		unlock, err := lockDepot(ctx)
+		if err != nil {
+			t.Fatalf("Expected stale lock to be removed, got %v", err)
+		}
+		unlock()
+	})
+
+	t.Run("Held", func(t *testing.T) {
+		defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+		lockTimeout = 200 * time.Millisecond
+		path := writeTestLock(t, depot, lockInfo{PID: os.Getppid(), Host: host, Command: "cosm release", Acquired: time.Now()})
+		defer os.Remove(path)
+		_, err := lockDepot(ctx)
+		if err == nil {
+			t.Fatal("Expected lock held by a running process to time out")
+		}
+		if KindOf(err) != KindConflict {
+			t.Errorf("Expected conflict error, got %v", err)
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		lockTimeout = time.Minute
+		if _, err := lockDepot(canceled); KindOf(err) != KindCanceled {
+			t.Errorf("Expected canceled error, got %v", err)
+		}
+	})
+
+	t.Run("OtherHost", func(t *testing.T) {
+		writeTestLock(t, depot, lockInfo{PID: 1, Host: host + "-other", Command: "cosm registry add", Acquired: time.Now().Add(-2 * staleLockAge)})
+		unlock, err := lockDepot(ctx)
+		if err != nil {
+			t.Fatalf("Expected old lock of another host to be removed, got %v", err)
+		}
+		unlock()
+	})
+
+	t.Run("StaleLockReplaced", func(t *testing.T) {
+		// Another process removed the stale lock that was read and created its own lock
+		stale, _ := json.Marshal(lockInfo{PID: 1, Host: host + "-other", Command: "cosm release", Acquired: time.Now().Add(-2 * staleLockAge)})
+		path := writeTestLock(t, depot, lockInfo{PID: os.Getppid(), Host: host, Command: "cosm add", Acquired: time.Now(), Token: "other"})
+		defer os.Remove(path)
+		if err := removeStaleLock(path, stale); err != nil {
+			t.Fatalf("removeStaleLock failed: %v", err)
+		}
+		if info, err := readLockFile(path); err != nil || info.Token != "other" {
+			t.Errorf("Expected the lock of the other process to be kept, got %+v (%v)", info, err)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+			t.Errorf("Expected only the lock in the locks directory, got %v", entries)
+		}
+	})
+
+	t.Run("TakenOver", func(t *testing.T) {
+		unlock, err := lockDepot(ctx)
+		if err != nil {
+			t.Fatalf("lockDepot failed: %v", err)
+		}
+		// Another process took the lock over, e.g. after this one was suspended for a day
+		path := writeTestLock(t, depot, lockInfo{PID: os.Getppid(), Host: host, Command: "cosm add", Acquired: time.Now(), Token: "other"})
+		defer os.Remove(path)
+		unlock()
+		if info, err := readLockFile(path); err != nil || info.Token != "other" {
+			t.Errorf("Expected the lock of the other process to be kept, got %+v (%v)", info, err)
+		}
+	})
+}
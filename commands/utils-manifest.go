@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// manifestEntry is a dependency in the manifest of another package manager
+type manifestEntry struct {
+	Name     string // Name as written in the manifest, e.g. a Go module path
+	Version  string // Version or version constraint as written in the manifest; empty if none
+	Group    string // Dependency group in cosm, e.g. dev for devDependencies; empty for the main group
+	Optional bool
+}
+
+// manifestFormats maps the file names of the supported manifests to their parsers
+var manifestFormats = map[string]func([]byte) ([]manifestEntry, error){
+	"go.mod":           parseGoMod,
+	"package.json":     parsePackageJSON,
+	"requirements.txt": parseRequirements,
+}
+
+// parseManifest reads the dependencies in a manifest, recognized by its file name
+func parseManifest(path string) ([]manifestEntry, error) {
+	parse, supported := manifestFormats[filepath.Base(path)]
+	if !supported {
+		return nil, validationError("unsupported manifest '%s': must be one of go.mod, package.json and requirements.txt", filepath.Base(path))
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, notFoundError("manifest %s not found", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	entries, err := parse(data)
+	if err != nil {
+		return nil, validationError("failed to parse %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// parseGoMod returns the direct requirements of a go.mod file; requirements marked
+// '// indirect' are skipped, since cosm resolves transitive dependencies itself
+func parseGoMod(data []byte) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, comment, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case !inBlock && fields[0] == "require":
+			if len(fields) == 2 && fields[1] == "(" {
+				inBlock = true
+				continue
+			}
+			fields = fields[1:]
+		case !inBlock:
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid requirement '%s'", strings.TrimSpace(line))
+		}
+		if strings.TrimSpace(comment) == "indirect" {
+			continue
+		}
+		entries = append(entries, manifestEntry{Name: fields[0], Version: fields[1]})
+	}
+	return entries, scanner.Err()
+}
+
+// parsePackageJSON returns the dependencies, devDependencies (in group dev) and
+// optionalDependencies of a package.json file
+func parsePackageJSON(data []byte) ([]manifestEntry, error) {
+	var manifest struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	for _, section := range []struct {
+		deps     map[string]string
+		group    string
+		optional bool
+	}{
+		{manifest.Dependencies, "", false},
+		{manifest.DevDependencies, "dev", false},
+		{manifest.OptionalDependencies, "", true},
+	} {
+		names := make([]string, 0, len(section.deps))
+		for name := range section.deps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entries = append(entries, manifestEntry{Name: name, Version: section.deps[name], Group: section.group, Optional: section.optional})
+		}
+	}
+	return entries, nil
+}
+
+// requirementNameEnd matches where the project name of a requirement ends
+var requirementNameEnd = regexp.MustCompile(`[\s\[<>=!~;@]`)
+
+// parseRequirements returns the requirements of a pip requirements file; options such as
+// -r and -e, and requirements given as a URL, are skipped
+func parseRequirements(data []byte) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line, _, _ = strings.Cut(line, ";") // Environment markers
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		name, constraint := line, ""
+		if loc := requirementNameEnd.FindStringIndex(line); loc != nil {
+			name, constraint = line[:loc[0]], line[loc[0]:]
+		}
+		if _, rest, found := strings.Cut(constraint, "]"); found && strings.HasPrefix(constraint, "[") {
+			constraint = rest // Extras
+		}
+		entries = append(entries, manifestEntry{Name: name, Version: strings.TrimSpace(constraint)})
+	}
+	return entries, scanner.Err()
+}
+
+// manifestPackageNames returns the names of the cosm packages that a manifest entry may refer to:
+// the name without npm scope or Go module path and major version suffix, as written and in lower case
+func manifestPackageNames(entry manifestEntry) []string {
+	name := strings.TrimSuffix(entry.Name, "/")
+	if elements := strings.Split(name, "/"); len(elements) > 1 {
+		last := elements[len(elements)-1]
+		if IsMajorVersion(last) {
+			last = elements[len(elements)-2]
+		}
+		name = last
+	}
+	names := []string{name}
+	if lower := strings.ToLower(name); lower != name {
+		names = append(names, lower)
+	}
+	return names
+}
+
+// manifestVersionPattern matches the version at the start of a version or version constraint
+var manifestVersionPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// manifestVersion returns the version v<major>.<minor>.<patch> of a version or version constraint
+// in a manifest, e.g. v1.2.0 for ^1.2 or >=1.2; empty if it names no version or only an upper bound
+func manifestVersion(constraint string) string {
+	constraint = strings.TrimSpace(constraint)
+	if strings.HasPrefix(constraint, "<") || strings.HasPrefix(constraint, "!") {
+		return ""
+	}
+	constraint = strings.TrimLeft(constraint, "^~=> ")
+	match := manifestVersionPattern.FindStringSubmatch(constraint)
+	if match == nil {
+		return ""
+	}
+	for i := 2; i <= 3; i++ {
+		if match[i] == "" {
+			match[i] = "0"
+		}
+	}
+	return fmt.Sprintf("v%s.%s.%s", match[1], match[2], match[3])
+}
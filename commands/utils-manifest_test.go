@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		parse    func([]byte) ([]manifestEntry, error)
+		data     string
+		expected []manifestEntry
+	}{
+		{"go_mod", parseGoMod, `module example.com/app
+
+go 1.24
+
+require github.com/acme/strings v1.2.3
+
+require (
+	github.com/acme/json/v2 v2.0.1 // a comment
+	golang.org/x/text v0.14.0 // indirect
+)
+`, []manifestEntry{{Name: "github.com/acme/strings", Version: "v1.2.3"}, {Name: "github.com/acme/json/v2", Version: "v2.0.1"}}},
+		{"package_json", parsePackageJSON, `{
+  "name": "app",
+  "dependencies": {"left-pad": "^1.3.0", "@acme/json": "~2.1"},
+  "devDependencies": {"mocha": "10.x"},
+  "optionalDependencies": {"fsevents": "*"}
+}`, []manifestEntry{
+			{Name: "@acme/json", Version: "~2.1"},
+			{Name: "left-pad", Version: "^1.3.0"},
+			{Name: "mocha", Version: "10.x", Group: "dev"},
+			{Name: "fsevents", Version: "*", Optional: true},
+		}},
+		{"requirements", parseRequirements, `# Runtime
+requests==2.31.0
+Flask[async] >= 2.0 ; python_version >= "3.8"
+numpy
+-r dev-requirements.txt
+git+https://example.com/lib.git#egg=lib
+`, []manifestEntry{{Name: "requests", Version: "==2.31.0"}, {Name: "Flask", Version: ">= 2.0"}, {Name: "numpy"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := tt.parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(entries, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, entries)
+			}
+		})
+	}
+}
+
+func TestManifestPackageNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"numpy", []string{"numpy"}},
+		{"Flask", []string{"Flask", "flask"}},
+		{"@acme/json", []string{"json"}},
+		{"github.com/acme/strings", []string{"strings"}},
+		{"github.com/acme/json/v2", []string{"json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := manifestPackageNames(manifestEntry{Name: tt.name}); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestManifestVersion(t *testing.T) {
+	tests := []struct {
+		constraint string
+		expected   string
+	}{
+		{"v1.2.3", "v1.2.3"},
+		{"v0.0.0-20240101000000-abcdef123456", "v0.0.0"},
+		{"^1.3.0", "v1.3.0"},
+		{"~2.1", "v2.1.0"},
+		{"10.x", "v10.0.0"},
+		{"==2.31.0", "v2.31.0"},
+		{">= 2.0", "v2.0.0"},
+		{"<3.0", ""},
+		{"*", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			if got := manifestVersion(tt.constraint); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"bytes"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// packageMetaFile records where a materialized package version in the depot came from; it is not
+// part of the package, so it is left out of archives, vendored copies and verification
+const packageMetaFile = ".cosm-meta.json"
+
+// writePackageMeta writes .cosm-meta.json into a materialized package version; archivePath is the
+// archive the files were extracted from, or empty if they were copied from a clone
+func writePackageMeta(destPath string, specs *types.Specs, archivePath string) error {
+	meta := types.PackageMeta{
+		Name:      specs.Name,
+		Version:   specs.Version,
+		UUID:      specs.UUID,
+		SHA1:      specs.SHA1,
+		Subdir:    specs.Subdir,
+		Source:    specs.GitURL,
+		Archive:   archivePath,
+		Installed: time.Now().UTC().Truncate(time.Second),
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", packageMetaFile, err)
+	}
+	file := filepath.Join(destPath, packageMetaFile)
+	if err := writeFileAtomically(file, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// loadPackageMeta reads .cosm-meta.json of a materialized package version; it returns nil without
+// an error for package versions materialized before cosm wrote the file
+func loadPackageMeta(packageDir string) (*types.PackageMeta, error) {
+	file := filepath.Join(packageDir, packageMetaFile)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	var meta types.PackageMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return &meta, nil
+}
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pickerPageSize is the number of versions the picker shows at once
+const pickerPageSize = 10
+
+// VersionChoice is a version of a package that can be selected, with the registries it is in
+type VersionChoice struct {
+	Version    string
+	Registries []string
+	Latest     bool // The version that is added when none is selected
+}
+
+// stdinIsTerminal reports whether stdin is a terminal rather than a pipe, a file or /dev/null
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	devNull, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(stat, devNull)
+}
+
+// promptUserForVersion lets the user pick a version of a package on the terminal
+func promptUserForVersion(packageName string, choices []VersionChoice) (string, error) {
+	return pickVersion(bufio.NewReader(os.Stdin), os.Stdout, packageName, choices)
+}
+
+// pickVersion shows the versions of a package, newest first, and reads the selection: a number,
+// text that narrows the list down to the versions that fuzzily match it, or an empty line for the
+// preselected version, which is the latest version unless it was filtered out
+func pickVersion(in *bufio.Reader, out io.Writer, packageName string, choices []VersionChoice) (string, error) {
+	filter := ""
+	for {
+		matches := filterVersionChoices(choices, filter)
+		if len(matches) == 0 {
+			fmt.Fprintf(out, "No versions of '%s' match '%s'\n", packageName, filter)
+			filter = ""
+			continue
+		}
+		preselected := matches[0]
+		for _, choice := range matches {
+			if choice.Latest {
+				preselected = choice
+			}
+		}
+		fmt.Fprintf(out, "Versions of '%s':\n", packageName)
+		for i, choice := range matches {
+			if i == pickerPageSize {
+				fmt.Fprintf(out, "  ... %d more (type to filter)\n", len(matches)-pickerPageSize)
+				break
+			}
+			marker := " "
+			if choice.Version == preselected.Version {
+				marker = ">"
+			}
+			latest := ""
+			if choice.Latest {
+				latest = " (latest)"
+			}
+			fmt.Fprintf(out, "%s %2d. %s%s  %s\n", marker, i+1, choice.Version, latest, strings.Join(choice.Registries, ", "))
+		}
+		fmt.Fprintf(out, "Select a version (number, or text to filter; Enter for %s): ", preselected.Version)
+
+		line, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read selection: %w", err)
+		}
+		input := strings.TrimSpace(line)
+		if input == "" {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(out)
+			}
+			return preselected.Version, nil
+		}
+		if number, convErr := strconv.Atoi(input); convErr == nil {
+			if number < 1 || number > len(matches) {
+				fmt.Fprintf(out, "Invalid selection %d: must be a number between 1 and %d\n", number, len(matches))
+				continue
+			}
+			return matches[number-1].Version, nil
+		}
+		filter = input // At the end of the input, the preselected version of the filtered list is taken
+	}
+}
+
+// filterVersionChoices returns the choices whose version or registries fuzzily match the filter
+func filterVersionChoices(choices []VersionChoice, filter string) []VersionChoice {
+	if filter == "" {
+		return choices
+	}
+	var matches []VersionChoice
+	for _, choice := range choices {
+		if fuzzyMatch(choice.Version+" "+strings.Join(choice.Registries, " "), filter) {
+			matches = append(matches, choice)
+		}
+	}
+	return matches
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in text in order, ignoring case
+func fuzzyMatch(text, pattern string) bool {
+	text, pattern = strings.ToLower(text), strings.ToLower(pattern)
+	for _, r := range pattern {
+		index := strings.IndexRune(text, r)
+		if index < 0 {
+			return false
+		}
+		text = text[index+len(string(r)):]
+	}
+	return true
+}
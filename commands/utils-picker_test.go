@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPickVersion(t *testing.T) {
+	choices := []VersionChoice{
+		{Version: "v1.10.0", Registries: []string{"reg1"}, Latest: true},
+		{Version: "v1.9.0", Registries: []string{"reg1", "reg2"}},
+		{Version: "v1.2.0", Registries: []string{"reg1"}},
+	}
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"enter_selects_latest", "\n", "v1.10.0"},
+		{"end_of_input_selects_latest", "", "v1.10.0"},
+		{"number", "2\n", "v1.9.0"},
+		{"invalid_number", "7\n3\n", "v1.2.0"},
+		{"fuzzy_filter", "2.0\n\n", "v1.2.0"},
+		{"filter_on_registry", "reg2\n", "v1.9.0"},
+		{"number_in_filtered_list", "v1\n3\n", "v1.2.0"},
+		{"no_match", "xyz\n\n", "v1.10.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := pickVersion(bufio.NewReader(strings.NewReader(tt.input)), io.Discard, "mypkg", choices)
+			if err != nil {
+				t.Fatalf("pickVersion failed: %v", err)
+			}
+			if version != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, version)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		text, pattern string
+		expected      bool
+	}{
+		{"v1.2.0 reg1", "120", true},
+		{"v1.2.0 reg1", "REG", true},
+		{"v1.10.0 reg1", "1.2", false},
+		{"v2.0.0-beta.1 reg1", "beta", true},
+		{"v2.0.0 reg1", "21", true},
+		{"v2.0.0 reg1", "3", false},
+	}
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.text, tt.pattern); got != tt.expected {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, expected %v", tt.text, tt.pattern, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"cosm/types"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// platformPattern matches a platform selector: an operating system, optionally with an
+// architecture, as named by Go, e.g. linux or darwin/arm64
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+(/[a-z0-9]+)?$`)
+
+// validatePlatform checks that a platform selector has the form <os> or <os>/<arch>
+func validatePlatform(selector string) error {
+	if !platformPattern.MatchString(selector) {
+		return validationError("invalid platform '%s': must have the form <os> or <os>/<arch>, e.g. linux or darwin/arm64", selector)
+	}
+	return nil
+}
+
+// targetPlatform returns the platform <os>/<arch> that conditional dependencies are resolved for:
+// the configured platform, or the platform cosm runs on
+func targetPlatform() string {
+	if platform := currentConfig().Platform; platform != "" {
+		return platform
+	}
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// matchesPlatform reports whether a dependency applies to a platform <os>/<arch>. A dependency
+// without platforms applies to all of them, and every dependency applies if platform is empty.
+func matchesPlatform(dep types.Dependency, platform string) bool {
+	if len(dep.Platforms) == 0 || platform == "" {
+		return true
+	}
+	goos, _, _ := strings.Cut(platform, "/")
+	for _, selector := range dep.Platforms {
+		if selector == platform || selector == goos {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"cosm/types"
+	"testing"
+)
+
+func TestMatchesPlatform(t *testing.T) {
+	tests := []struct {
+		name      string
+		platforms []string
+		platform  string
+		expected  bool
+	}{
+		{"unrestricted", nil, "linux/amd64", true},
+		{"os", []string{"linux"}, "linux/arm64", true},
+		{"os_and_arch", []string{"darwin/arm64"}, "darwin/arm64", true},
+		{"other_arch", []string{"darwin/arm64"}, "darwin/amd64", false},
+		{"other_os", []string{"linux", "darwin"}, "windows/amd64", false},
+		{"all_platforms", []string{"windows"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesPlatform(types.Dependency{Platforms: tt.platforms}, tt.platform); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"fmt"
 	"os"
@@ -14,6 +16,7 @@ func createProject(packageName, projectUUID string, authors []string, language,
 		UUID:     projectUUID,
 		Authors:  authors,
 		Language: language,
+		License:  currentConfig().License,
 		Version:  version,
 	}
 }
@@ -21,18 +24,27 @@ func createProject(packageName, projectUUID string, authors []string, language,
 // selectPackageFromResults handles the selection of a package from multiple matches
 func selectPackageFromResults(packageName, versionTag string, foundPackages []types.PackageLocation) (types.PackageLocation, error) {
 	if len(foundPackages) == 0 {
-		return types.PackageLocation{}, fmt.Errorf("package '%s' with version '%s' not found in any registry", packageName, versionTag)
+		return types.PackageLocation{}, notFoundError("package '%s' with version '%s' not found in any registry", packageName, versionTag)
 	}
 	if len(foundPackages) == 1 {
 		return foundPackages[0], nil
 	}
+	if defaultRegistry := currentConfig().DefaultRegistry; defaultRegistry != "" {
+		for _, pkg := range foundPackages {
+			if pkg.RegistryName == defaultRegistry {
+				return pkg, nil
+			}
+		}
+	}
 	return promptUserForRegistry(packageName, versionTag, foundPackages)
 }
 
 // MakePackageAvailable copies the contents of a cloned package for a specific version
 // from ~/.cosm/clones/<UUID> to ~/.cosm/packages/<packageName>/<SHA1>, excluding Git-related files,
-// and ensures the clone is reverted to its previous state even on error.
-func MakePackageAvailable(cosmDir string, specs *types.Specs) error {
+// and ensures the clone is reverted to its previous state even on error. For packages in a
+// monorepo only the package subdirectory is copied. If an archive of the version is cached in the
+// depot or found in the artifact store (see archiveurl), it is extracted instead.
+func MakePackageAvailable(ctx context.Context, cosmDir string, specs *types.Specs) error {
 	if err := validateSpecs(specs); err != nil {
 		return err
 	}
@@ -41,39 +53,55 @@ func MakePackageAvailable(cosmDir string, specs *types.Specs) error {
 	if checkDestinationExists(destPath) {
 		return nil
 	}
-
-	// check out clone if it does not yet exist
-	clonePath := filepath.Join(cosmDir, "clones", specs.UUID)
-	if _, err := os.Stat(clonePath); os.IsNotExist(err) {
-		tmpClonePath, err := clonePackageToTempDir(cosmDir, specs.GitURL)
-		if err != nil {
-			return err
-		}
-		defer cleanupTempClone(tmpClonePath)
-		clonePath, err = moveCloneToPermanentDir(cosmDir, tmpClonePath, specs.UUID)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to check clone at %s: %v", clonePath, err)
+	unlock, err := lockDepot(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if checkDestinationExists(destPath) {
+		return nil // Made available by another cosm process while waiting for the lock
 	}
 
-	if err := prepareClone(clonePath, specs.SHA1); err != nil {
-		return fmt.Errorf("failed to prepare clone for %s@%s: %v", specs.Name, specs.Version, err)
+	// An archive of the version is faster to get than a clone of the whole history
+	installed, err := installFromArchive(ctx, cosmDir, specs, destPath)
+	if err != nil {
+		logging.Warnf("failed to install '%s@%s' from its archive, cloning it instead: %v", specs.Name, specs.Version, err)
+	} else if installed {
+		return nil
 	}
 
-	if err := copyPackageFiles(clonePath, destPath); err != nil {
-		if revertErr := revertClone(clonePath); revertErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to revert clone after error: %v\n", revertErr)
-		}
-		return fmt.Errorf("failed to copy package files for %s@%s: %v", specs.Name, specs.Version, err)
+	clonePath, err := ensurePackageClone(ctx, cosmDir, specs)
+	if err != nil {
+		return err
+	}
+	worktree, err := checkoutWorktree(ctx, clonePath, specs.SHA1, specs.Mirrors)
+	if err != nil {
+		return fmt.Errorf("failed to prepare clone for %s@%s: %w", specs.Name, specs.Version, err)
 	}
+	defer removeWorktree(ctx, clonePath, worktree)
 
-	if err := revertClone(clonePath); err != nil {
-		return fmt.Errorf("failed to revert clone for %s@%s: %v", specs.Name, specs.Version, err)
+	links := identicalPackageFiles(ctx, clonePath, filepath.Dir(destPath), specs.SHA1, specs.Subdir)
+	if err := copyPackageFiles(filepath.Join(worktree, specs.Subdir), destPath, links); err != nil {
+		return fmt.Errorf("failed to copy package files for %s@%s: %w", specs.Name, specs.Version, err)
 	}
+	return writePackageMeta(destPath, specs, "")
+}
 
-	return nil
+// ensurePackageClone clones the repository of a package to ~/.cosm/clones/<UUID> if it does not yet
+// exist and returns the path of the clone; the caller must hold the depot lock
+func ensurePackageClone(ctx context.Context, cosmDir string, specs *types.Specs) (string, error) {
+	clonePath := filepath.Join(cosmDir, "clones", specs.UUID)
+	if _, err := os.Stat(clonePath); err == nil {
+		return clonePath, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to check clone at %s: %w", clonePath, err)
+	}
+	tmpClonePath, err := clonePackageToTempDir(ctx, cosmDir, specs.GitURL, false, specs.Mirrors...)
+	if err != nil {
+		return "", err
+	}
+	defer cleanupTempClone(tmpClonePath)
+	return moveCloneToPermanentDir(cosmDir, tmpClonePath, specs.UUID)
 }
 
 // validateSpecs ensures the Specs object has valid fields
@@ -98,37 +126,71 @@ func checkDestinationExists(destPath string) bool {
 	if _, err := os.Stat(destPath); os.IsNotExist(err) {
 		return false
 	}
-	projectFile := filepath.Join(destPath, "Project.json")
+	projectFile := projectFilePath(filepath.Join(destPath, "Project.json"))
 	if _, err := os.Stat(projectFile); os.IsNotExist(err) {
 		return false
 	}
 	return true
 }
 
-// prepareClone verifies the clone directory exists and checks out the specified SHA1
-func prepareClone(clonePath, sha1 string) error {
+// checkoutWorktree checks out a commit of a clone, with its submodules and Git LFS files, in a
+// temporary worktree next to the clone and returns its path. The HEAD and working tree of the
+// clone itself, which other cosm commands may use at the same time, are left alone. The caller
+// removes the worktree with removeWorktree.
+func checkoutWorktree(ctx context.Context, clonePath, sha1 string, mirrors []string) (string, error) {
 	if _, err := os.Stat(clonePath); os.IsNotExist(err) {
-		return fmt.Errorf("clone directory not found at %s", clonePath)
+		return "", fmt.Errorf("clone directory not found at %s", clonePath)
 	}
-	if err := checkoutVersion(clonePath, sha1); err != nil {
-		return fmt.Errorf("failed to checkout SHA1 %s: %v", sha1, err)
+	if err := fetchCommit(ctx, clonePath, sha1, mirrors); err != nil {
+		return "", err
+	}
+	worktree, err := makeTempDir(filepath.Dir(clonePath), "worktree")
+	if err != nil {
+		return "", err
+	}
+	if _, err := GitCommand(ctx, clonePath, "worktree", "add", "--detach", worktree, sha1); err != nil {
+		removeTempDir(worktree)
+		return "", wrapGitError(clonePath, fmt.Sprintf("failed to checkout SHA1 %s", sha1), err)
+	}
+	err = updateSubmodules(ctx, worktree)
+	if err == nil {
+		err = fetchLFSContent(ctx, worktree, sha1)
+	}
+	if err != nil {
+		removeWorktree(ctx, clonePath, worktree)
+		return "", err
+	}
+	return worktree, nil
+}
+
+// removeWorktree removes a temporary worktree and prunes its administrative files from the clone;
+// git worktree remove refuses worktrees with submodules
+func removeWorktree(ctx context.Context, clonePath, worktree string) {
+	if err := removeTempDir(worktree); err != nil {
+		logging.Warnf("%v", err)
+		return
+	}
+	if _, err := GitCommand(ctx, clonePath, "worktree", "prune"); err != nil {
+		logging.Debugf("failed to prune the worktrees of %s: %v", clonePath, err)
 	}
-	return nil
 }
 
-// copyPackageFiles creates the destination directory and copies files, excluding Git-related ones
-func copyPackageFiles(clonePath, destPath string) error {
+// copyPackageFiles creates the destination directory and copies files, excluding Git-related ones.
+// Regular files are reflinked where the filesystem supports it, and else hard-linked to the
+// identical files in links, keyed by their slash-separated relative path, before they are copied.
+func copyPackageFiles(clonePath, destPath string, links map[string]string) error {
 	if err := os.MkdirAll(destPath, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory %s: %v", destPath, err)
+		return fmt.Errorf("failed to create destination directory %s: %w", destPath, err)
 	}
+	reflinks := true
 
 	return filepath.Walk(clonePath, func(srcPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip .git directory and .gitignore files
-		if info.Name() == ".git" || info.Name() == ".gitignore" {
+		// Skip .git directory, .gitignore files and the metadata of depot packages
+		if info.Name() == ".git" || info.Name() == ".gitignore" || info.Name() == packageMetaFile {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -138,7 +200,7 @@ func copyPackageFiles(clonePath, destPath string) error {
 		// Compute relative path and destination
 		relPath, err := filepath.Rel(clonePath, srcPath)
 		if err != nil {
-			return fmt.Errorf("failed to compute relative path for %s: %v", srcPath, err)
+			return fmt.Errorf("failed to compute relative path for %s: %w", srcPath, err)
 		}
 		if relPath == "." {
 			return nil // Skip root directory itself
@@ -151,6 +213,9 @@ func copyPackageFiles(clonePath, destPath string) error {
 		}
 
 		// Copy file
+		if info.Mode().IsRegular() {
+			return placeFile(srcPath, destFile, links[filepath.ToSlash(relPath)], info.Mode(), &reflinks)
+		}
 		return copyFile(srcPath, destFile, info.Mode())
 	})
 }
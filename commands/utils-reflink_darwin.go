@@ -0,0 +1,21 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile creates dest as a copy-on-write clone of src with clonefile(2), which APFS
+// supports; it fails on other filesystems or if dest exists, without leaving dest behind
+func reflinkFile(src, dest string, mode os.FileMode) error {
+	if err := unix.Clonefile(src, dest, unix.CLONE_NOFOLLOW); err != nil {
+		return fmt.Errorf("failed to reflink %s to %s: %w", src, dest, err)
+	}
+	if err := os.Chmod(dest, mode); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to set the mode of %s: %w", dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile creates dest as a copy-on-write clone of src with the FICLONE ioctl, which
+// filesystems such as Btrfs and XFS support; it fails if the filesystem does not support
+// reflinks, without leaving dest behind
+func reflinkFile(src, dest string, mode os.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %w", src, err)
+	}
+	defer srcFile.Close()
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file %s: %w", dest, err)
+	}
+	if err = unix.IoctlFileClone(int(destFile.Fd()), int(srcFile.Fd())); err == nil {
+		err = destFile.Chmod(mode)
+	} else {
+		err = fmt.Errorf("failed to reflink %s to %s: %w", src, dest, err)
+	}
+	if closeErr := destFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
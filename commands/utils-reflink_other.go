@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package commands
+
+import (
+	"errors"
+	"os"
+)
+
+// reflinkFile is only supported on Linux and macOS; elsewhere files are hard-linked or copied
+func reflinkFile(src, dest string, mode os.FileMode) error {
+	return errors.ErrUnsupported
+}
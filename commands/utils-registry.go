@@ -2,16 +2,29 @@ package commands
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"cosm/logging"
 	"cosm/types"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // promptUserForRegistry handles multiple registry matches by prompting the user
 func promptUserForRegistry(packageName, versionTag string, foundPackages []types.PackageLocation) (types.PackageLocation, error) {
+	if inputDisabled() {
+		registryNames := make([]string, len(foundPackages))
+		for i, pkg := range foundPackages {
+			registryNames[i] = pkg.RegistryName
+		}
+		return types.PackageLocation{}, inputRequiredError("package '%s' v%s found in multiple registries (%s); cannot choose one without a prompt", packageName, versionTag, strings.Join(registryNames, ", "))
+	}
 	fmt.Printf("Package '%s' v%s found in multiple registries:\n", packageName, versionTag)
 	for i, pkg := range foundPackages {
 		fmt.Printf("  %d. %s (Git URL: %s)\n", i+1, pkg.RegistryName, pkg.Specs.GitURL)
@@ -24,17 +37,18 @@ func promptUserForRegistry(packageName, versionTag string, foundPackages []types
 	choiceNum := 0
 	_, err := fmt.Sscanf(choice, "%d", &choiceNum)
 	if err != nil || choiceNum < 1 || choiceNum > len(foundPackages) {
-		return types.PackageLocation{}, fmt.Errorf("invalid selection '%s': must be a number between 1 and %d", choice, len(foundPackages))
+		return types.PackageLocation{}, validationError("invalid selection '%s': must be a number between 1 and %d", choice, len(foundPackages))
 	}
 	return foundPackages[choiceNum-1], nil
 }
 
-// findPackageInRegistries searches for a package across all registries
-func findPackageInRegistries(packageName, versionTag, registriesDir string, registryNames []string) (types.PackageLocation, error) {
+// findPackageInRegistries searches for a package across all registries. When no version is given,
+// the latest release is selected, skipping prereleases unless includePrerelease is set.
+func findPackageInRegistries(ctx context.Context, packageName, versionTag string, includePrerelease bool, registriesDir string, registryNames []string) (types.PackageLocation, error) {
 	var foundPackages []types.PackageLocation
 
 	for _, regName := range registryNames {
-		pkg, found, err := findPackageInRegistry(packageName, versionTag, registriesDir, regName)
+		pkg, found, err := findPackageInRegistry(ctx, packageName, versionTag, includePrerelease, registriesDir, regName)
 		if err != nil {
 			return types.PackageLocation{}, err
 		}
@@ -47,14 +61,14 @@ func findPackageInRegistries(packageName, versionTag, registriesDir string, regi
 }
 
 // findPackageInRegistry searches for a package in a single registry
-func findPackageInRegistry(packageName, versionTag, registriesDir, registryName string) (types.PackageLocation, bool, error) {
+func findPackageInRegistry(ctx context.Context, packageName, versionTag string, includePrerelease bool, registriesDir, registryName string) (types.PackageLocation, bool, error) {
 	// Update registry before loading metadata
-	if err := updateSingleRegistry(registriesDir, registryName); err != nil {
+	if err := refreshRegistry(ctx, registriesDir, registryName); err != nil {
 		return types.PackageLocation{}, false, err
 	}
 	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
 	if err != nil {
-		return types.PackageLocation{}, false, fmt.Errorf("failed to load registry metadata for '%s': %v", registryName, err)
+		return types.PackageLocation{}, false, fmt.Errorf("failed to load registry metadata for '%s': %w", registryName, err)
 	}
 
 	if _, exists := registry.Packages[packageName]; !exists {
@@ -63,8 +77,8 @@ func findPackageInRegistry(packageName, versionTag, registriesDir, registryName
 
 	// Determine the version to use
 	version := versionTag
-	if versionTag == "" {
-		latestVersion, err := findLatestVersionInRegistry(packageName, registriesDir, registryName)
+	if versionTag == "" || IsMajorVersion(versionTag) {
+		latestVersion, err := findLatestVersionInRegistry(packageName, versionTag, includePrerelease, registriesDir, registryName)
 		if err != nil {
 			return types.PackageLocation{}, false, err
 		}
@@ -77,31 +91,45 @@ func findPackageInRegistry(packageName, versionTag, registriesDir, registryName
 	// Load specs for the selected version
 	specs, err := loadSpecs(registriesDir, registryName, packageName, version)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			return types.PackageLocation{}, false, nil
 		}
-		return types.PackageLocation{}, false, fmt.Errorf("failed to load specs for '%s@%s' in registry '%s': %v", packageName, version, registryName, err)
+		return types.PackageLocation{}, false, fmt.Errorf("failed to load specs for '%s@%s' in registry '%s': %w", packageName, version, registryName, err)
 	}
 	if specs.Version != version {
 		return types.PackageLocation{}, false, nil
 	}
+	if specs.Yanked {
+		return types.PackageLocation{}, false, fmt.Errorf("version '%s' of package '%s' is yanked in registry '%s'", version, packageName, registryName)
+	}
 
 	return types.PackageLocation{RegistryName: registryName, Specs: specs}, true, nil
 }
 
-// findLatestVersionInRegistry finds the latest version of a package in a single registry
-func findLatestVersionInRegistry(packageName, registriesDir, registryName string) (string, error) {
+// findLatestVersionInRegistry finds the latest version of a package in a single registry, skipping yanked
+// versions; if major (e.g. v2) is not empty, only the versions with that major version are considered
+func findLatestVersionInRegistry(packageName, major string, includePrerelease bool, registriesDir, registryName string) (string, error) {
 	// Load versions
 	versions, err := loadVersions(registriesDir, registryName, packageName)
 	if err != nil {
 		return "", err
 	}
+	versions = removeYankedVersions(registriesDir, registryName, packageName, versions)
+	if major != "" {
+		var inMajor []string
+		for _, version := range versions {
+			if versionMajor, err := GetMajorVersion(version); err == nil && versionMajor == major {
+				inMajor = append(inMajor, version)
+			}
+		}
+		versions = inMajor
+	}
 	if len(versions) == 0 {
 		return "", nil
 	}
 
 	// Determine the latest version
-	latestVersion, err := determineLatestVersion(versions)
+	latestVersion, err := determineLatestVersion(versions, includePrerelease)
 	if err != nil {
 		return "", err
 	}
@@ -109,11 +137,27 @@ func findLatestVersionInRegistry(packageName, registriesDir, registryName string
 	return latestVersion, nil
 }
 
-// determineLatestVersion finds the latest version from a list of versions
-func determineLatestVersion(versions []string) (string, error) {
+// removeYankedVersions returns the versions whose specs are not marked as yanked
+func removeYankedVersions(registriesDir, registryName, packageName string, versions []string) []string {
+	var available []string
+	for _, version := range versions {
+		specs, err := loadSpecs(registriesDir, registryName, packageName, version)
+		if err == nil && specs.Yanked {
+			continue
+		}
+		available = append(available, version)
+	}
+	return available
+}
+
+// determineLatestVersion finds the latest version from a list of versions, skipping prereleases unless includePrerelease is set
+func determineLatestVersion(versions []string, includePrerelease bool) (string, error) {
 	var latestVersion string
 
 	for _, version := range versions {
+		if !includePrerelease && IsPrerelease(version) {
+			continue
+		}
 		if latestVersion == "" {
 			latestVersion = version
 		} else {
@@ -137,8 +181,11 @@ type updateRegistryConfig struct {
 	registryDir   string
 }
 
-// updateSingleRegistry pulls updates for a single registry
-func updateSingleRegistry(registriesDir, registryName string) error {
+// updateSingleRegistry pulls updates for a single registry; in offline mode the local copy is used as is
+func updateSingleRegistry(ctx context.Context, registriesDir, registryName string) error {
+	if currentConfig().Offline {
+		return nil
+	}
 	// Parse arguments and initialize config
 	config, err := parseUpdateArgs(registriesDir, registryName)
 	if err != nil {
@@ -149,12 +196,81 @@ func updateSingleRegistry(registriesDir, registryName string) error {
 	if err := validateRegistryForUpdate(config); err != nil {
 		return err
 	}
+	unlock, err := lockRegistry(ctx, registryName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Pull updates from the registry's Git repository
-	if err := pullRegistryUpdates(config); err != nil {
+	if err := pullRegistryUpdates(ctx, config); err != nil {
 		return err
 	}
 
+	return recordRegistryPull(registriesDir, registryName)
+}
+
+// refreshRegistry pulls updates for a registry when packages are looked up in it, unless it was
+// pulled less than the refresh interval ago
+func refreshRegistry(ctx context.Context, registriesDir, registryName string) error {
+	if interval := refreshInterval(); interval > 0 {
+		pulls, err := loadRegistryPulls(registriesDir)
+		if err != nil {
+			return err
+		}
+		if pulled, ok := pulls[registryName]; ok && time.Since(pulled) < interval {
+			logging.Debugf("Registry '%s' was pulled at %s; skipping pull", registryName, pulled.Format(time.RFC3339))
+			return nil
+		}
+	}
+	return updateSingleRegistry(ctx, registriesDir, registryName)
+}
+
+// registryPullsMu serializes the updates of the registry pull times by concurrent registry updates
+var registryPullsMu sync.Mutex
+
+// registryPullsFile returns the file in the depot that records when each registry was last pulled
+func registryPullsFile(registriesDir string) string {
+	return filepath.Join(filepath.Dir(registriesDir), "logs", "registries.json")
+}
+
+// loadRegistryPulls loads the time each registry was last pulled, keyed by registry name
+func loadRegistryPulls(registriesDir string) (map[string]time.Time, error) {
+	pullsFile := registryPullsFile(registriesDir)
+	pulls := make(map[string]time.Time)
+	data, err := os.ReadFile(pullsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pulls, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", pullsFile, err)
+	}
+	if err := json.Unmarshal(data, &pulls); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", pullsFile, err)
+	}
+	return pulls, nil
+}
+
+// recordRegistryPull records that a registry was pulled now
+func recordRegistryPull(registriesDir, registryName string) error {
+	registryPullsMu.Lock()
+	defer registryPullsMu.Unlock()
+	pulls, err := loadRegistryPulls(registriesDir)
+	if err != nil {
+		return err
+	}
+	pulls[registryName] = time.Now().UTC()
+	pullsFile := registryPullsFile(registriesDir)
+	if err := os.MkdirAll(filepath.Dir(pullsFile), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", pullsFile, err)
+	}
+	data, err := json.MarshalIndent(pulls, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", pullsFile, err)
+	}
+	if err := writeFileAtomically(pullsFile, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", pullsFile, err)
+	}
 	return nil
 }
 
@@ -178,46 +294,91 @@ func parseUpdateArgs(registriesDir, registryName string) (*updateRegistryConfig,
 // validateRegistryForUpdate checks if the registry exists
 func validateRegistryForUpdate(config *updateRegistryConfig) error {
 	if err := assertRegistryExists(config.registriesDir, config.registryName); err != nil {
-		return fmt.Errorf("failed to validate registry '%s': %v", config.registryName, err)
+		return fmt.Errorf("failed to validate registry '%s': %w", config.registryName, err)
 	}
 	return nil
 }
 
-// pullRegistryUpdates pulls updates from the current branch of the registry's Git repository
-func pullRegistryUpdates(config *updateRegistryConfig) error {
-	branch, err := getCurrentBranch(config.registryDir)
+// pullRegistryUpdates pulls updates from the current branch of the registry's Git repository;
+// the pull is skipped if git ls-remote shows that the remote branch has not moved
+func pullRegistryUpdates(ctx context.Context, config *updateRegistryConfig) error {
+	branch, err := getCurrentBranch(ctx, config.registryDir)
 	if err != nil {
-		return fmt.Errorf("failed to get current branch for registry '%s' in %s: %v", config.registryName, config.registryDir, err)
+		return fmt.Errorf("failed to get current branch for registry '%s' in %s: %w", config.registryName, config.registryDir, err)
 	}
-	context := fmt.Sprintf("registry '%s' in %s", config.registryName, config.registryDir)
-	if err := pullFromBranch(config.registryDir, branch, context); err != nil {
+	if remote := gitRemote(ctx, config.registryDir); remoteBranchMerged(ctx, config.registryDir, remote, branch) {
+		logging.Debugf("Registry '%s' is up to date with %s/%s; skipping pull", config.registryName, remote, branch)
+		return nil
+	}
+	subject := fmt.Sprintf("registry '%s' in %s", config.registryName, config.registryDir)
+	err = pullFromBranch(ctx, config.registryDir, branch, subject)
+	if err == nil {
+		return nil
+	}
+
+	// Fall back to the mirrors of the registry
+	registry, _, metaErr := LoadRegistryMetadata(config.registriesDir, config.registryName)
+	if metaErr != nil {
 		return err
 	}
-	return nil
+	for _, mirror := range registry.Mirrors {
+		if _, mirrorErr := GitCommand(ctx, config.registryDir, "pull", mirror, branch); mirrorErr == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 // commitAndPushRegistryChanges stages, commits, and pushes changes to the registry
-func commitAndPushRegistryChanges(registriesDir, registryName, commitMsg string) error {
+func commitAndPushRegistryChanges(ctx context.Context, registriesDir, registryName, commitMsg string) error {
+	if err := commitRegistryChanges(ctx, registriesDir, registryName, commitMsg); err != nil {
+		return err
+	}
+	return pushRegistryChanges(ctx, registriesDir, registryName)
+}
+
+// commitRegistryChanges stages and commits all changes to the registry without pushing
+func commitRegistryChanges(ctx context.Context, registriesDir, registryName, commitMsg string) error {
 	registryDir := filepath.Join(registriesDir, registryName)
 
 	// Stage all changes
-	if err := stageFiles(registryDir, "."); err != nil {
+	if err := stageFiles(ctx, registryDir, "."); err != nil {
 		return err
 	}
 
-	// Commit changes
-	if err := commitChanges(registryDir, commitMsg); err != nil {
+	// Commit changes, signed if the trust policy of the registry asks for it
+	policy, err := loadTrustPolicy(registriesDir, registryName)
+	if err != nil {
 		return err
 	}
+	if policy.SignCommits {
+		return commitSignedChanges(ctx, registryDir, commitMsg)
+	}
+	return commitChanges(ctx, registryDir, commitMsg)
+}
+
+// pushRegistryChanges pushes the current branch of the registry to its remote; with the
+// stageregistry setting the commits stay local until cosm registry push
+func pushRegistryChanges(ctx context.Context, registriesDir, registryName string) error {
+	if currentConfig().StageRegistry {
+		logging.Infof("Staged the changes to registry '%s'; publish them with 'cosm registry push %s'", registryName, registryName)
+		return nil
+	}
+	return publishRegistryChanges(ctx, registriesDir, registryName)
+}
+
+// publishRegistryChanges pushes the current branch of the registry to its remote
+func publishRegistryChanges(ctx context.Context, registriesDir, registryName string) error {
+	registryDir := filepath.Join(registriesDir, registryName)
 
 	// Get the current branch
-	branch, err := getCurrentBranch(registryDir)
+	branch, err := getCurrentBranch(ctx, registryDir)
 	if err != nil {
 		return err
 	}
 
 	// Push changes to the current branch
-	return pushToRemote(registryDir, branch, false)
+	return pushToRemote(ctx, registryDir, branch, false)
 }
 
 // assertRegistryExists verifies that the specified registry exists in registries.json
@@ -229,17 +390,17 @@ func assertRegistryExists(registriesDir, registryName string) error {
 	var registryNames []string
 	data, err := os.ReadFile(registriesFile)
 	if err != nil {
-		return fmt.Errorf("failed to read registries.json: %v", err)
+		return fmt.Errorf("failed to read registries.json: %w", err)
 	}
-	if err := json.Unmarshal(data, &registryNames); err != nil {
-		return fmt.Errorf("failed to parse registries.json: %v", err)
+	if err := unmarshalValidated("registries.schema.json", data, &registryNames); err != nil {
+		return fmt.Errorf("failed to parse registries.json: %w", err)
 	}
 	for _, name := range registryNames {
 		if name == registryName {
 			return nil
 		}
 	}
-	return fmt.Errorf("registry '%s' not found in registries.json", registryName)
+	return notFoundError("registry '%s' not found in registries.json", registryName)
 }
 
 // loadAndCheckRegistries loads registries.json and checks for duplicate registry names
@@ -247,16 +408,16 @@ func loadAndCheckRegistries(registriesDir, registryName string) ([]string, error
 	registriesFile := filepath.Join(registriesDir, "registries.json")
 	var registryNames []string
 	if data, err := os.ReadFile(registriesFile); err == nil {
-		if err := json.Unmarshal(data, &registryNames); err != nil {
-			return nil, fmt.Errorf("failed to parse registries.json: %v", err)
+		if err := unmarshalValidated("registries.schema.json", data, &registryNames); err != nil {
+			return nil, fmt.Errorf("failed to parse registries.json: %w", err)
 		}
 	} else if !os.IsNotExist(err) {
-		return nil, fmt.Errorf("failed to read registries.json: %v", err)
+		return nil, fmt.Errorf("failed to read registries.json: %w", err)
 	}
 
 	for _, name := range registryNames {
 		if name == registryName {
-			return nil, fmt.Errorf("registry '%s' already exists", registryName)
+			return nil, conflictError("registry '%s' already exists", registryName)
 		}
 	}
 
@@ -0,0 +1,463 @@
+package commands
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// schemaFiles are the JSON Schemas of the files that cosm reads. The validator supports the
+// keywords they use: $ref (to $defs, also in another schema file), type, properties, required,
+// additionalProperties, propertyNames, items, pattern, minLength and enum.
+//
+//go:embed schemas/*.schema.json
+var schemaFiles embed.FS
+
+// jsonSchema is a JSON Schema, or a subschema of one
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+	Description          string                 `json:"description"`
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	PropertyNames        *jsonSchema            `json:"propertyNames"`
+	Items                *jsonSchema            `json:"items"`
+	Pattern              string                 `json:"pattern"`
+	MinLength            int                    `json:"minLength"`
+	Enum                 []string               `json:"enum"`
+
+	file    string         // Schema file the schema is defined in, to resolve $ref
+	never   bool           // The schema false, which no value matches
+	pattern *regexp.Regexp // Compiled Pattern
+}
+
+// schemaTypes is the type keyword of a schema: a single type or a list of types
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// UnmarshalJSON reads a schema, which can also be the boolean true (any value) or false (no value)
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	var boolean bool
+	if err := json.Unmarshal(data, &boolean); err == nil {
+		*s = jsonSchema{never: !boolean}
+		return nil
+	}
+	type plain jsonSchema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+var (
+	schemasOnce sync.Once
+	schemas     map[string]*jsonSchema // By file name, e.g. project.schema.json
+	schemasErr  error
+)
+
+// loadSchemas parses and compiles the embedded schemas
+func loadSchemas() (map[string]*jsonSchema, error) {
+	schemasOnce.Do(func() {
+		schemas = make(map[string]*jsonSchema)
+		entries, err := schemaFiles.ReadDir("schemas")
+		if err != nil {
+			schemasErr = err
+			return
+		}
+		for _, entry := range entries {
+			data, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+			if err != nil {
+				schemasErr = err
+				return
+			}
+			var schema jsonSchema
+			if err := json.Unmarshal(data, &schema); err != nil {
+				schemasErr = fmt.Errorf("invalid schema %s: %w", entry.Name(), err)
+				return
+			}
+			if err := compileSchema(&schema, entry.Name()); err != nil {
+				schemasErr = fmt.Errorf("invalid schema %s: %w", entry.Name(), err)
+				return
+			}
+			schemas[entry.Name()] = &schema
+		}
+	})
+	return schemas, schemasErr
+}
+
+// compileSchema records the file of a schema and its subschemas and compiles their patterns
+func compileSchema(schema *jsonSchema, file string) error {
+	if schema == nil {
+		return nil
+	}
+	schema.file = file
+	if schema.Pattern != "" {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return err
+		}
+		schema.pattern = pattern
+	}
+	var subschemas []*jsonSchema
+	for _, sub := range schema.Defs {
+		subschemas = append(subschemas, sub)
+	}
+	for _, sub := range schema.Properties {
+		subschemas = append(subschemas, sub)
+	}
+	subschemas = append(subschemas, schema.AdditionalProperties, schema.PropertyNames, schema.Items)
+	for _, sub := range subschemas {
+		if err := compileSchema(sub, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSchemaRef returns the schema that a $ref refers to: [<file>]#/$defs/<name>
+func resolveSchemaRef(schema *jsonSchema) (*jsonSchema, error) {
+	all, err := loadSchemas()
+	if err != nil {
+		return nil, err
+	}
+	file, fragment, _ := strings.Cut(schema.Ref, "#")
+	if file == "" {
+		file = schema.file
+	}
+	root, found := all[file]
+	if !found {
+		return nil, fmt.Errorf("unknown schema '%s'", file)
+	}
+	if fragment == "" {
+		return root, nil
+	}
+	name, isDef := strings.CutPrefix(fragment, "/$defs/")
+	target, found := root.Defs[name]
+	if !isDef || !found {
+		return nil, fmt.Errorf("unknown schema reference '%s'", schema.Ref)
+	}
+	return target, nil
+}
+
+// SchemaError is a JSON file that does not match its schema or is not valid JSON. Line and Column
+// locate the offending value; they are zero if the position is not known.
+type SchemaError struct {
+	Line    int
+	Column  int
+	Field   string // Path of the offending field, e.g. deps.<key>.version; empty for the document
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// jsonNode is a value of a JSON document with its position
+type jsonNode struct {
+	offset  int64
+	value   any // string, bool, json.Number or nil for scalars
+	kind    string
+	keys    []string // Keys of an object, in order
+	fields  map[string]*jsonNode
+	keyPos  map[string]int64 // Offsets of the keys of an object
+	items   []*jsonNode
+	literal string // Scalar as it is written, for messages
+}
+
+// validateJSONSchema checks a JSON document against one of the embedded schemas, e.g.
+// project.schema.json. If positions is false, no line and column are reported, e.g. because
+// the JSON was converted from another format.
+func validateJSONSchema(schemaFile string, data []byte, positions bool) error {
+	all, err := loadSchemas()
+	if err != nil {
+		return err
+	}
+	schema, found := all[schemaFile]
+	if !found {
+		return fmt.Errorf("unknown schema '%s'", schemaFile)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := parseJSONNode(decoder, data)
+	if err == nil {
+		offset := skipJSONSeparators(data, decoder.InputOffset())
+		switch _, err = decoder.Token(); {
+		case err == io.EOF:
+			err = nil
+		case err == nil:
+			err = positionedError(data, offset, "", "invalid JSON: unexpected data after the end of the document")
+		default:
+			err = jsonSyntaxError(data, err)
+		}
+	}
+	if err == nil {
+		err = validateJSONNode(root, schema, "", data)
+	}
+	var schemaErr *SchemaError
+	if err != nil && errors.As(err, &schemaErr) && !positions {
+		schemaErr.Line, schemaErr.Column = 0, 0
+	}
+	return err
+}
+
+// parseJSONNode reads the next value of a JSON document with the positions of its values
+func parseJSONNode(decoder *json.Decoder, data []byte) (*jsonNode, error) {
+	offset := skipJSONSeparators(data, decoder.InputOffset())
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, jsonSyntaxError(data, err)
+	}
+	node := &jsonNode{offset: offset}
+	switch token {
+	case json.Delim('{'):
+		node.kind = "object"
+		node.fields = make(map[string]*jsonNode)
+		node.keyPos = make(map[string]int64)
+		for decoder.More() {
+			keyOffset := skipJSONSeparators(data, decoder.InputOffset())
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, jsonSyntaxError(data, err)
+			}
+			name := key.(string)
+			value, err := parseJSONNode(decoder, data)
+			if err != nil {
+				return nil, err
+			}
+			if _, duplicate := node.fields[name]; duplicate {
+				return nil, positionedError(data, keyOffset, name, fmt.Sprintf("field '%s' is defined twice", name))
+			}
+			node.keys = append(node.keys, name)
+			node.fields[name] = value
+			node.keyPos[name] = keyOffset
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, jsonSyntaxError(data, err)
+		}
+	case json.Delim('['):
+		node.kind = "array"
+		node.items = []*jsonNode{}
+		for decoder.More() {
+			item, err := parseJSONNode(decoder, data)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, jsonSyntaxError(data, err)
+		}
+	default:
+		node.value = token
+		node.literal = strings.TrimSpace(string(data[offset:decoder.InputOffset()]))
+		switch v := token.(type) {
+		case string:
+			node.kind = "string"
+		case bool:
+			node.kind = "boolean"
+		case json.Number:
+			node.kind = "number"
+			if _, err := v.Int64(); err == nil {
+				node.kind = "integer"
+			}
+		case nil:
+			node.kind = "null"
+		}
+	}
+	return node, nil
+}
+
+// skipJSONSeparators returns the offset of the next value or key after an offset, skipping
+// whitespace, colons and commas
+func skipJSONSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n:,", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// jsonSyntaxError returns a syntax error of the decoder with its position
+func jsonSyntaxError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		offset := syntaxErr.Offset
+		if offset > 0 && offset <= int64(len(data)) && !strings.Contains(syntaxErr.Error(), "unexpected end") {
+			offset-- // The offset is after the invalid character
+		}
+		return positionedError(data, offset, "", "invalid JSON: "+syntaxErr.Error())
+	}
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return positionedError(data, int64(len(data)), "", "invalid JSON: unexpected end of the document")
+	}
+	return err
+}
+
+// positionedError returns a SchemaError at an offset of a document
+func positionedError(data []byte, offset int64, field, message string) *SchemaError {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return &SchemaError{Line: line, Column: column, Field: field, Message: message}
+}
+
+// validateJSONNode checks a value against a schema and returns the first mismatch
+func validateJSONNode(node *jsonNode, schema *jsonSchema, field string, data []byte) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		target, err := resolveSchemaRef(schema)
+		if err != nil {
+			return err
+		}
+		return validateJSONNode(node, target, field, data)
+	}
+	fail := func(offset int64, format string, args ...any) error {
+		return positionedError(data, offset, field, fmt.Sprintf(format, args...))
+	}
+	if schema.never {
+		return fail(node.offset, "%s is not allowed", describeField(field))
+	}
+	if len(schema.Type) > 0 && !slices.Contains(schema.Type, node.kind) && !(node.kind == "integer" && slices.Contains(schema.Type, "number")) {
+		return fail(node.offset, "%s must be %s, not %s", describeField(field), describeTypes(schema.Type), describeKind(node.kind))
+	}
+	switch node.kind {
+	case "string":
+		value := node.value.(string)
+		if utf8.RuneCountInString(value) < schema.MinLength {
+			return fail(node.offset, "%s cannot be empty", describeField(field))
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(value) {
+			return fail(node.offset, "%s must be %s, not %s", describeField(field), describePattern(schema), node.literal)
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+			return fail(node.offset, "%s must be one of %s, not %s", describeField(field), strings.Join(schema.Enum, ", "), node.literal)
+		}
+	case "object":
+		missing := []string{}
+		for _, name := range schema.Required {
+			if _, found := node.fields[name]; !found {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fail(node.offset, "%s is missing required field '%s'", describeObject(field), missing[0])
+		}
+		for _, name := range node.keys {
+			sub := joinField(field, name)
+			if schema.PropertyNames != nil {
+				keyNode := &jsonNode{offset: node.keyPos[name], kind: "string", value: name, literal: fmt.Sprintf("%q", name)}
+				if err := validateJSONNode(keyNode, schema.PropertyNames, sub, data); err != nil {
+					var schemaErr *SchemaError
+					if !errors.As(err, &schemaErr) {
+						return err
+					}
+					reason := strings.TrimPrefix(schemaErr.Message, describeField(sub)+" ")
+					return positionedError(data, node.keyPos[name], sub, fmt.Sprintf("invalid key '%s' in %s: %s", name, describeObject(field), reason))
+				}
+			}
+			property, known := schema.Properties[name]
+			if !known {
+				property = schema.AdditionalProperties
+				if property != nil && property.never {
+					return positionedError(data, node.keyPos[name], sub, fmt.Sprintf("unknown field '%s'", sub))
+				}
+			}
+			if err := validateJSONNode(node.fields[name], property, sub, data); err != nil {
+				return err
+			}
+		}
+	case "array":
+		for i, item := range node.items {
+			if err := validateJSONNode(item, schema.Items, fmt.Sprintf("%s[%d]", field, i), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// joinField returns the path of a field of an object
+func joinField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func describeField(field string) string {
+	if field == "" {
+		return "the document"
+	}
+	return fmt.Sprintf("field '%s'", field)
+}
+
+func describeObject(field string) string {
+	if field == "" {
+		return "the document"
+	}
+	return fmt.Sprintf("'%s'", field)
+}
+
+func describeTypes(types []string) string {
+	described := make([]string, len(types))
+	for i, kind := range types {
+		described[i] = describeKind(kind)
+	}
+	return strings.Join(described, " or ")
+}
+
+func describeKind(kind string) string {
+	switch kind {
+	case "object", "array", "integer":
+		return "an " + kind
+	case "null":
+		return "null"
+	}
+	return "a " + kind
+}
+
+// describePattern describes the strings that a schema with a pattern accepts
+func describePattern(schema *jsonSchema) string {
+	if schema.Description != "" {
+		return schema.Description
+	}
+	return fmt.Sprintf("a string matching %s", schema.Pattern)
+}
+
+// unmarshalValidated checks a JSON document against one of the embedded schemas and decodes it into v
+func unmarshalValidated(schemaFile string, data []byte, v any) error {
+	if err := validateJSONSchema(schemaFile, data, true); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
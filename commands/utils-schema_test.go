@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		document string
+		expected string // Empty if the document is valid
+	}{
+		{"valid_project", "project.schema.json", `{
+  "name": "mypkg",
+  "uuid": "0b6f3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4a",
+  "authors": null,
+  "version": "v0.1.0",
+  "deps": {"0b6f3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4b@v1": {"name": "json", "version": "v1.2.0", "features": ["fast"]}}
+}`, ""},
+		{"syntax_error", "project.schema.json", "{\n  \"name\": \"mypkg\",\n  \"version\": \"v0.1.0\"\n  \"uuid\": \"x\"\n}", "line 4, column 3: invalid JSON: invalid character '\"' after object key:value pair"},
+		{"truncated", "project.schema.json", "{\n  \"name\": \"mypkg\",\n", "line 3, column 1: invalid JSON: unexpected end of JSON input"},
+		{"trailing_data", "versions.schema.json", "[\"v1.0.0\"]\n]", "line 2, column 1: invalid JSON: invalid character ']' looking for beginning of value"},
+		{"wrong_type", "project.schema.json", "{\n  \"name\": \"mypkg\",\n  \"uuid\": \"x\",\n  \"version\": 1\n}", "line 4, column 14: field 'version' must be a string, not an integer"},
+		{"missing_field", "project.schema.json", "{\n  \"name\": \"mypkg\",\n  \"uuid\": \"x\"\n}", "line 1, column 1: the document is missing required field 'version'"},
+		{"unknown_field", "project.schema.json", "{\"name\": \"mypkg\", \"uuid\": \"x\", \"version\": \"v0.1.0\", \"dependencies\": {}}", "line 1, column 53: unknown field 'dependencies'"},
+		{"invalid_key", "project.schema.json", "{\"name\": \"a\", \"uuid\": \"x\", \"version\": \"v0.1.0\",\n \"deps\": {\"json\": {\"name\": \"json\", \"version\": \"v1.0.0\"}}}", "line 2, column 11: invalid key 'json' in 'deps': must be a key <uuid>@v<major>, not \"json\""},
+		{"invalid_version", "project.schema.json", "{\"name\": \"a\", \"uuid\": \"x\", \"version\": \"v0.1.0\",\n \"deps\": {\"x@v1\": {\"name\": \"json\", \"version\": \"1.0\"}}}", "line 2, column 47: field 'deps.x@v1.version' must be a version v<major>.<minor>.<patch>, not \"1.0\""},
+		{"nested_type", "specs.schema.json", "{\"name\": \"a\", \"uuid\": \"x\", \"version\": \"v1.0.0\", \"keywords\": [\"a\", 2]}", "line 1, column 67: field 'keywords[1]' must be a string, not an integer"},
+		{"empty_name", "registry.schema.json", "{\"name\": \"\"}", "line 1, column 10: field 'name' cannot be empty"},
+		{"duplicate_field", "workspace.schema.json", "{\"name\": \"ws\",\n\"name\": \"other\"}", "line 2, column 1: field 'name' is defined twice"},
+		{"root_type", "versions.schema.json", "{}", "line 1, column 1: the document must be an array or null, not an object"},
+		{"config", "config.schema.json", "{\"offline\": \"yes\"}", "line 1, column 13: field 'offline' must be a boolean, not a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJSONSchema(tt.schema, []byte(tt.document), true)
+			switch {
+			case tt.expected == "" && err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case tt.expected != "" && (err == nil || err.Error() != tt.expected):
+				t.Errorf("Expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidateJSONSchemaWithoutPositions(t *testing.T) {
+	err := validateJSONSchema("project.schema.json", []byte(`{"name": "a", "uuid": "x", "version": true}`), false)
+	if err == nil || err.Error() != "field 'version' must be a string, not a boolean" {
+		t.Errorf("Expected an error without position, got %v", err)
+	}
+}
@@ -9,38 +9,137 @@ import (
 // validateVersion ensures the version starts with 'v'
 func validateVersion(version string) error {
 	if len(version) == 0 || version[0] != 'v' {
-		return fmt.Errorf("version '%s' must start with 'v'", version)
+		return validationError("version '%s' must start with 'v'", version)
 	}
 	return nil
 }
 
-// ParseSemVer parses a semantic version string into its components
+// ParseSemVer parses a semantic version string (vX.Y.Z[-prerelease][+build]) into its components
 func ParseSemVer(version string) (semVer, error) {
-	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	core := strings.TrimPrefix(version, "v")
+	build := ""
+	if idx := strings.Index(core, "+"); idx >= 0 {
+		core, build = core[:idx], core[idx+1:]
+		if build == "" {
+			return semVer{}, fmt.Errorf("invalid build metadata in '%s': must not be empty", version)
+		}
+	}
+	prerelease := ""
+	if idx := strings.Index(core, "-"); idx >= 0 {
+		core, prerelease = core[:idx], core[idx+1:]
+		if err := validatePrerelease(prerelease); err != nil {
+			return semVer{}, fmt.Errorf("invalid prerelease in '%s': %w", version, err)
+		}
+	}
+	parts := strings.Split(core, ".")
 	if len(parts) < 2 {
-		return semVer{}, fmt.Errorf("invalid version format '%s': must be vX.Y.Z or vX.Y", version)
+		return semVer{}, validationError("invalid version format '%s': must be vX.Y.Z or vX.Y", version)
 	}
 	major, err := strconv.Atoi(parts[0])
 	if err != nil {
-		return semVer{}, fmt.Errorf("invalid major version in '%s': %v", version, err)
+		return semVer{}, fmt.Errorf("invalid major version in '%s': %w", version, err)
 	}
 	minor, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return semVer{}, fmt.Errorf("invalid minor version in '%s': %v", version, err)
+		return semVer{}, fmt.Errorf("invalid minor version in '%s': %w", version, err)
 	}
 	patch := 0
 	if len(parts) > 2 {
 		patch, err = strconv.Atoi(parts[2])
 		if err != nil {
-			return semVer{}, fmt.Errorf("invalid patch version in '%s': %v", version, err)
+			return semVer{}, fmt.Errorf("invalid patch version in '%s': %w", version, err)
 		}
 	}
-	return semVer{Major: major, Minor: minor, Patch: patch}, nil
+	return semVer{Major: major, Minor: minor, Patch: patch, Prerelease: prerelease, Build: build}, nil
 }
 
-// semVer represents a semantic version (vX.Y.Z)
+// validatePrerelease checks that a prerelease string consists of non-empty dot-separated identifiers
+func validatePrerelease(prerelease string) error {
+	if prerelease == "" {
+		return fmt.Errorf("prerelease must not be empty")
+	}
+	for _, ident := range strings.Split(prerelease, ".") {
+		if ident == "" {
+			return fmt.Errorf("prerelease '%s' contains an empty identifier", prerelease)
+		}
+	}
+	return nil
+}
+
+// semVer represents a semantic version (vX.Y.Z[-prerelease][+build])
 type semVer struct {
 	Major, Minor, Patch int
+	Prerelease          string
+	Build               string
+}
+
+// IsPrerelease reports whether the version carries a prerelease suffix (e.g., v2.0.0-beta.1)
+func IsPrerelease(version string) bool {
+	s, err := ParseSemVer(version)
+	if err != nil {
+		return false
+	}
+	return s.Prerelease != ""
+}
+
+// compareSemVer compares two parsed versions following the semver precedence rules,
+// returning -1, 0, or 1. Build metadata is ignored.
+func compareSemVer(s1, s2 semVer) int {
+	if s1.Major != s2.Major {
+		return compareInts(s1.Major, s2.Major)
+	}
+	if s1.Minor != s2.Minor {
+		return compareInts(s1.Minor, s2.Minor)
+	}
+	if s1.Patch != s2.Patch {
+		return compareInts(s1.Patch, s2.Patch)
+	}
+	return comparePrerelease(s1.Prerelease, s2.Prerelease)
+}
+
+// comparePrerelease compares prerelease strings; a version without prerelease has higher precedence
+func comparePrerelease(p1, p2 string) int {
+	if p1 == p2 {
+		return 0
+	}
+	if p1 == "" {
+		return 1
+	}
+	if p2 == "" {
+		return -1
+	}
+	ids1 := strings.Split(p1, ".")
+	ids2 := strings.Split(p2, ".")
+	for i := 0; i < len(ids1) && i < len(ids2); i++ {
+		n1, err1 := strconv.Atoi(ids1[i])
+		n2, err2 := strconv.Atoi(ids2[i])
+		switch {
+		case err1 == nil && err2 == nil:
+			if n1 != n2 {
+				return compareInts(n1, n2)
+			}
+		case err1 == nil:
+			return -1 // Numeric identifiers have lower precedence than alphanumeric ones
+		case err2 == nil:
+			return 1
+		default:
+			if c := strings.Compare(ids1[i], ids2[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(ids1), len(ids2))
+}
+
+// compareInts returns -1, 0, or 1 depending on the order of a and b
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 // MaxSemVer returns the higher of two semantic versions
@@ -53,24 +152,22 @@ func MaxSemVer(v1, v2 string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if s1.Major > s2.Major {
-		return v1, nil
-	}
-	if s1.Major < s2.Major {
-		return v2, nil
-	}
-	if s1.Minor > s2.Minor {
-		return v1, nil
-	}
-	if s1.Minor < s2.Minor {
-		return v2, nil
-	}
-	if s1.Patch >= s2.Patch {
+	if compareSemVer(s1, s2) >= 0 {
 		return v1, nil
 	}
 	return v2, nil
 }
 
+// IsMajorVersion reports whether a version only names a major version, e.g. v2, which selects the
+// latest release with that major version
+func IsMajorVersion(version string) bool {
+	if len(version) < 2 || version[0] != 'v' {
+		return false
+	}
+	_, err := strconv.ParseUint(version[1:], 10, 64)
+	return err == nil
+}
+
 // GetMajorVersion extracts the major version number as a string (e.g., "v1" from "v1.2.0")
 func GetMajorVersion(version string) (string, error) {
 	s, err := ParseSemVer(version)
@@ -85,11 +182,11 @@ func validateNewVersion(newVersion, currentVersion string) error {
 	// Parse versions
 	currVer, err := ParseSemVer(currentVersion)
 	if err != nil {
-		return fmt.Errorf("invalid current version %q: %v", currentVersion, err)
+		return fmt.Errorf("invalid current version %q: %w", currentVersion, err)
 	}
 	newVer, err := ParseSemVer(newVersion)
 	if err != nil {
-		return fmt.Errorf("invalid new version %q: %v", newVersion, err)
+		return fmt.Errorf("invalid new version %q: %w", newVersion, err)
 	}
 
 	// Allow same version if not tagged, otherwise require newer
@@ -98,16 +195,46 @@ func validateNewVersion(newVersion, currentVersion string) error {
 	}
 
 	// Compare versions: newVer must be greater than currVer
-	if newVer.Major < currVer.Major {
-		return fmt.Errorf("new version %q must be greater than current version %q", newVersion, currentVersion)
+	if compareSemVer(newVer, currVer) <= 0 {
+		return validationError("new version %q must be greater than current version %q", newVersion, currentVersion)
+	}
+	return nil
+}
+
+// versionInRange reports whether a version satisfies a range of comma-separated constraints, each
+// a version with an optional operator (=, >, >=, <, <=), e.g. ">=v1.0.0, <v1.2.3"
+func versionInRange(version, versionRange string) (bool, error) {
+	v, err := ParseSemVer(version)
+	if err != nil {
+		return false, err
 	}
-	if newVer.Major == currVer.Major {
-		if newVer.Minor < currVer.Minor {
-			return fmt.Errorf("new version %q must be greater than current version %q", newVersion, currentVersion)
+	for _, constraint := range strings.Split(versionRange, ",") {
+		constraint = strings.TrimSpace(constraint)
+		bound := strings.TrimLeft(constraint, "<>=")
+		operator := constraint[:len(constraint)-len(bound)]
+		boundVer, err := ParseSemVer(strings.TrimSpace(bound))
+		if err != nil {
+			return false, fmt.Errorf("invalid version range '%s': %w", versionRange, err)
 		}
-		if newVer.Minor == currVer.Minor && newVer.Patch <= currVer.Patch {
-			return fmt.Errorf("new version %q must be greater than current version %q", newVersion, currentVersion)
+		cmp := compareSemVer(v, boundVer)
+		var ok bool
+		switch operator {
+		case "", "=":
+			ok = cmp == 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		default:
+			return false, fmt.Errorf("invalid operator '%s' in version range '%s'", operator, versionRange)
+		}
+		if !ok {
+			return false, nil
 		}
 	}
-	return nil
+	return true, nil
 }
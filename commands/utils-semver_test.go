@@ -0,0 +1,108 @@
+package commands
+
+import "testing"
+
+// TestMaxSemVer_Prerelease tests that MaxSemVer orders prereleases according to the semver spec
+func TestMaxSemVer_Prerelease(t *testing.T) {
+	// Each version has lower precedence than the next
+	ordered := []string{
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.0.1",
+		"v2.0.0-beta.1",
+		"v2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		lower, higher := ordered[i], ordered[i+1]
+		got, err := MaxSemVer(lower, higher)
+		if err != nil {
+			t.Fatalf("Unexpected error comparing %q and %q: %v", lower, higher, err)
+		}
+		if got != higher {
+			t.Errorf("Expected MaxSemVer(%q, %q) = %q, got %q", lower, higher, higher, got)
+		}
+		got, err = MaxSemVer(higher, lower)
+		if err != nil {
+			t.Fatalf("Unexpected error comparing %q and %q: %v", higher, lower, err)
+		}
+		if got != higher {
+			t.Errorf("Expected MaxSemVer(%q, %q) = %q, got %q", higher, lower, higher, got)
+		}
+	}
+}
+
+// TestParseSemVer_Prerelease tests parsing of prerelease and build metadata
+func TestParseSemVer_Prerelease(t *testing.T) {
+	s, err := ParseSemVer("v2.0.0-beta.1+build.5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Major != 2 || s.Minor != 0 || s.Patch != 0 || s.Prerelease != "beta.1" || s.Build != "build.5" {
+		t.Errorf("Unexpected parse result: %+v", s)
+	}
+	for _, invalid := range []string{"v1.0.0-", "v1.0.0-beta..1", "v1.0.0+", "v1-beta"} {
+		if _, err := ParseSemVer(invalid); err == nil {
+			t.Errorf("Expected error parsing %q, got none", invalid)
+		}
+	}
+	if !IsPrerelease("v2.0.0-rc.1") || IsPrerelease("v2.0.0") {
+		t.Errorf("IsPrerelease returned unexpected results")
+	}
+}
+
+// TestDetermineLatestVersion_SkipsPrerelease tests that prereleases are only selected when requested
+func TestDetermineLatestVersion_SkipsPrerelease(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.1.0", "v2.0.0-beta.1"}
+	latest, err := determineLatestVersion(versions, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if latest != "v1.1.0" {
+		t.Errorf("Expected latest stable version %q, got %q", "v1.1.0", latest)
+	}
+	latest, err = determineLatestVersion(versions, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if latest != "v2.0.0-beta.1" {
+		t.Errorf("Expected latest version %q, got %q", "v2.0.0-beta.1", latest)
+	}
+}
+
+// TestVersionInRange tests matching versions against advisory version ranges
+func TestVersionInRange(t *testing.T) {
+	tests := []struct {
+		version, versionRange string
+		expected              bool
+	}{
+		{"v1.0.0", ">=v1.0.0, <v1.2.3", true},
+		{"v1.2.2", ">=v1.0.0, <v1.2.3", true},
+		{"v1.2.3", ">=v1.0.0, <v1.2.3", false},
+		{"v0.9.0", ">=v1.0.0, <v1.2.3", false},
+		{"v2.0.0", ">v1.9", true},
+		{"v1.5.0", "<=v1.5.0", true},
+		{"v1.5.0", "v1.5.0", true},
+		{"v1.5.1", "=v1.5.0", false},
+		{"v1.0.0-beta.1", "<v1.0.0", true},
+	}
+	for _, test := range tests {
+		got, err := versionInRange(test.version, test.versionRange)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q in %q: %v", test.version, test.versionRange, err)
+		}
+		if got != test.expected {
+			t.Errorf("Expected versionInRange(%q, %q) = %v, got %v", test.version, test.versionRange, test.expected, got)
+		}
+	}
+	for _, invalid := range []string{"", ">=1.x", "~>v1.0.0", ">=v1.0.0,"} {
+		if _, err := versionInRange("v1.0.0", invalid); err == nil {
+			t.Errorf("Expected error for version range %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"cosm/logging"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// activationShells are the shells that cosm writes environment files and activation scripts for
+var activationShells = []string{"bash", "fish", "powershell", "cmd"}
+
+// detectShell returns the user's shell from $SHELL, defaulting to bash, or to PowerShell on
+// Windows outside of a POSIX shell such as Git Bash
+func detectShell() string {
+	return detectShellOn(runtime.GOOS)
+}
+
+// detectShellOn returns the user's shell from $SHELL on the given operating system
+func detectShellOn(goos string) string {
+	shellPath := os.Getenv("SHELL")
+	if goos == "windows" && shellPath == "" {
+		return "powershell"
+	}
+	// $SHELL may be a Windows path such as C:\Program Files\Git\bin\bash.exe
+	shell := strings.TrimSuffix(filepath.Base(strings.ReplaceAll(shellPath, "\\", "/")), ".exe")
+	switch shell {
+	case "zsh", "fish":
+		return shell
+	default:
+		return "bash"
+	}
+}
+
+// shellExportLine returns the statement that exports an environment variable in the given shell
+func shellExportLine(shell, name, value string) string {
+	switch shell {
+	case "fish":
+		return fmt.Sprintf("set -gx %s %q\n", name, value)
+	case "powershell":
+		return fmt.Sprintf("$env:%s = %s\n", name, powershellQuote(value))
+	case "cmd":
+		return fmt.Sprintf("set \"%s=%s\"\n", name, value)
+	default:
+		return fmt.Sprintf("export %s=%q\n", name, value)
+	}
+}
+
+// powershellQuote quotes a string literally for PowerShell, doubling its single quotes
+func powershellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// envFileForShell returns the environment file of an activated project for the given shell
+func envFileForShell(shell string) string {
+	switch shell {
+	case "fish":
+		return ".cosm/env.fish"
+	case "powershell":
+		return ".cosm/env.ps1"
+	case "cmd":
+		return ".cosm/env.bat"
+	default:
+		return ".cosm/.env"
+	}
+}
+
+// activateFileForShell returns the activation script of an activated project for the given shell
+func activateFileForShell(shell string) string {
+	switch shell {
+	case "fish":
+		return ".cosm/activate.fish"
+	case "powershell":
+		return ".cosm/activate.ps1"
+	case "cmd":
+		return ".cosm/activate.bat"
+	default:
+		return ".cosm/activate"
+	}
+}
+
+// sourceCommand returns the command that runs an activation script in the current shell
+func sourceCommand(shell, file string) string {
+	switch shell {
+	case "powershell":
+		return ". " + filepath.FromSlash(file)
+	case "cmd":
+		return filepath.FromSlash(file)
+	default:
+		return "source " + file
+	}
+}
+
+// powershellExecutable returns PowerShell 7 (pwsh) if it is installed, else Windows PowerShell
+func powershellExecutable() string {
+	if _, err := exec.LookPath("pwsh"); err == nil {
+		return "pwsh"
+	}
+	return "powershell"
+}
+
+// exportFormats are the formats of cosm activate --export
+var exportFormats = []string{"direnv", "dotenv", "github"}
+
+// exportHeader marks files written by cosm activate --export, so that they can be overwritten
+const exportHeader = "# Generated by cosm activate --export"
+
+// validateExportFormat checks an --export format before anything is resolved
+func validateExportFormat(format string) error {
+	if !contains(exportFormats, format) {
+		return validationError("unknown export format '%s' (valid formats: %s)", format, strings.Join(exportFormats, ", "))
+	}
+	if format == "github" && os.Getenv("GITHUB_ENV") == "" {
+		return validationError("--export github requires the GITHUB_ENV variable of a GitHub Actions job")
+	}
+	return nil
+}
+
+// exportEnvironment writes the environment in an export format: .envrc for direnv, .env for
+// dotenv, or appended to the file in $GITHUB_ENV for later steps of a GitHub Actions job
+func exportEnvironment(format string, env []envVar) error {
+	var b strings.Builder
+	switch format {
+	case "direnv", "dotenv":
+		fmt.Fprintf(&b, "%s %s\n", exportHeader, format)
+		for _, v := range env {
+			if format == "direnv" {
+				b.WriteString(shellExportLine("bash", v.name, v.value))
+			} else {
+				fmt.Fprintf(&b, "%s=%q\n", v.name, v.value)
+			}
+		}
+		file := ".envrc"
+		if format == "dotenv" {
+			file = ".env"
+		}
+		if data, err := os.ReadFile(file); err == nil && !strings.HasPrefix(string(data), exportHeader) {
+			return conflictError("%s exists and was not written by cosm; remove it to export the environment", file)
+		}
+		if err := os.WriteFile(file, []byte(b.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		logging.Infof("Exported %d variable(s) to %s", len(env), file)
+	case "github":
+		for _, v := range env {
+			if strings.Contains(v.value, "\n") {
+				fmt.Fprintf(&b, "%s<<COSM_EOF\n%s\nCOSM_EOF\n", v.name, v.value)
+			} else {
+				fmt.Fprintf(&b, "%s=%s\n", v.name, v.value)
+			}
+		}
+		file := os.Getenv("GITHUB_ENV")
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(b.String()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		logging.Infof("Exported %d variable(s) to $GITHUB_ENV", len(env))
+	}
+	return nil
+}
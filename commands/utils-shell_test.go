@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectShell(t *testing.T) {
+	tests := map[string]string{
+		"/bin/bash":           "bash",
+		"/usr/bin/zsh":        "zsh",
+		"/usr/local/bin/fish": "fish",
+		"/bin/sh":             "bash",
+		"":                    "bash",
+	}
+	for shellPath, expected := range tests {
+		t.Setenv("SHELL", shellPath)
+		if got := detectShell(); got != expected {
+			t.Errorf("SHELL=%q: expected %q, got %q", shellPath, expected, got)
+		}
+	}
+}
+
+func TestDetectShellOnWindows(t *testing.T) {
+	tests := map[string]string{
+		"":                                      "powershell",
+		`C:\Program Files\Git\usr\bin\bash.exe`: "bash",
+		"/usr/bin/zsh":                          "zsh",
+	}
+	for shellPath, expected := range tests {
+		t.Setenv("SHELL", shellPath)
+		if got := detectShellOn("windows"); got != expected {
+			t.Errorf("SHELL=%q: expected %q, got %q", shellPath, expected, got)
+		}
+	}
+}
+
+func TestShellExportLine(t *testing.T) {
+	if got := shellExportLine("bash", "LUA_PATH", "src/?.lua;;"); got != "export LUA_PATH=\"src/?.lua;;\"\n" {
+		t.Errorf("Unexpected bash export line %q", got)
+	}
+	if got := shellExportLine("zsh", "LUA_PATH", "src/?.lua;;"); got != "export LUA_PATH=\"src/?.lua;;\"\n" {
+		t.Errorf("Unexpected zsh export line %q", got)
+	}
+	if got := shellExportLine("fish", "LUA_PATH", "src/?.lua;;"); got != "set -gx LUA_PATH \"src/?.lua;;\"\n" {
+		t.Errorf("Unexpected fish export line %q", got)
+	}
+	if got := shellExportLine("powershell", "LUA_PATH", `C:\Users\o'neil\src\?.lua;;`); got != "$env:LUA_PATH = 'C:\\Users\\o''neil\\src\\?.lua;;'\n" {
+		t.Errorf("Unexpected PowerShell export line %q", got)
+	}
+	if got := shellExportLine("cmd", "LUA_PATH", `C:\src\?.lua;;`); got != "set \"LUA_PATH=C:\\src\\?.lua;;\"\n" {
+		t.Errorf("Unexpected cmd export line %q", got)
+	}
+}
+
+func TestWindowsActivationScripts(t *testing.T) {
+	names := []string{"LUA_PATH"}
+	script := activateScript("powershell", "proj", names)
+	for _, expected := range []string{"$env:_COSM_OLD_LUA_PATH = $env:LUA_PATH", "$env:COSM_ACTIVE = 'proj'", "function global:deactivate {"} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected PowerShell activation script to contain %q, got:\n%s", expected, script)
+		}
+	}
+	script = activateScript("cmd", "proj", names)
+	if strings.Contains(strings.ReplaceAll(script, "\r\n", ""), "\n") {
+		t.Errorf("Expected CRLF line endings in the cmd activation script, got %q", script)
+	}
+	for _, expected := range []string{`if defined LUA_PATH set "_COSM_OLD_LUA_PATH=%LUA_PATH%"`, `set "COSM_ACTIVE=proj"`, "doskey deactivate="} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected cmd activation script to contain %q, got:\n%s", expected, script)
+		}
+	}
+	if statements := deactivateStatements("cmd", names); !strings.Contains(statements, `if defined _COSM_OLD_LUA_PATH (set "LUA_PATH=%_COSM_OLD_LUA_PATH%") else (set "LUA_PATH=")`) {
+		t.Errorf("Unexpected cmd deactivate statements:\n%s", statements)
+	}
+}
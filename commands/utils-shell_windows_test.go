@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestActivationPathsOnWindows(t *testing.T) {
+	projectDir := `C:\Users\dev\my project`
+	script := activateScript("powershell", projectDir, nil)
+	if !strings.Contains(script, `. 'C:\Users\dev\my project\.cosm\env.ps1'`) {
+		t.Errorf("Expected the PowerShell activation script to load env.ps1 by its Windows path, got:\n%s", script)
+	}
+	script = activateScript("cmd", projectDir, nil)
+	for _, expected := range []string{`call "C:\Users\dev\my project\.cosm\env.bat"`, `doskey deactivate=call "C:\Users\dev\my project\.cosm\deactivate.bat"`} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected the cmd activation script to contain %q, got:\n%s", expected, script)
+		}
+	}
+	if got := sourceCommand("powershell", activateFileForShell("powershell")); got != `. .cosm\activate.ps1` {
+		t.Errorf("Unexpected PowerShell source command %q", got)
+	}
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sparseClones caches per registry clone whether it is a sparse checkout, and the package paths
+// that were added to it by this process
+var sparseClones = struct {
+	sync.Mutex
+	sparse map[string]bool
+	added  map[string]bool
+}{sparse: make(map[string]bool), added: make(map[string]bool)}
+
+// sparseCloneOptions are the git clone options of a sparse registry clone: only the files in the
+// root of the registry, such as registry.json, are checked out, and the contents of package
+// files are only downloaded when their paths are added to the checkout
+var sparseCloneOptions = []string{"--sparse", "--filter=blob:none"}
+
+// registryPackagePath returns the path of a package relative to its registry, e.g. E/Example
+func registryPackagePath(packageName string) string {
+	return filepath.Join(strings.ToUpper(string(packageName[0])), packageName)
+}
+
+// registryPackageDir returns the directory of a package in a registry clone. In a sparse clone the
+// package path is added to the checkout first, so that its files can be read and written.
+func registryPackageDir(registriesDir, registryName, packageName string) (string, error) {
+	registryDir := filepath.Join(registriesDir, registryName)
+	packageDir := filepath.Join(registryDir, registryPackagePath(packageName))
+	if err := materializePackagePath(registryDir, registryPackagePath(packageName)); err != nil {
+		return "", err
+	}
+	return packageDir, nil
+}
+
+// materializePackagePath adds a package path to the checkout of a sparse registry clone, unless it
+// is already checked out. Loading registry files has no context to cancel, so neither has this.
+func materializePackagePath(registryDir, path string) error {
+	if _, err := os.Stat(filepath.Join(registryDir, path)); err == nil {
+		return nil
+	}
+	sparseClones.Lock()
+	defer sparseClones.Unlock()
+	key := filepath.Join(registryDir, path)
+	if sparseClones.added[key] {
+		return nil
+	}
+	ctx := context.Background()
+	sparse, known := sparseClones.sparse[registryDir]
+	if !known {
+		output, _ := GitCommand(ctx, registryDir, "config", "--bool", "core.sparseCheckout")
+		sparse = strings.TrimSpace(output) == "true"
+		sparseClones.sparse[registryDir] = sparse
+	}
+	if !sparse {
+		return nil
+	}
+	if _, err := GitCommand(ctx, registryDir, "sparse-checkout", "add", filepath.ToSlash(path)); err != nil {
+		return wrapGitError(registryDir, fmt.Sprintf("failed to check out '%s' in the sparse registry clone", filepath.ToSlash(path)), err)
+	}
+	sparseClones.added[key] = true
+	return nil
+}
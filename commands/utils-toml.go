@@ -0,0 +1,599 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The project manifest can be written in TOML (cosm.toml) instead of JSON. It is read into the
+// same types.Project by converting the TOML document to JSON, and written by converting the JSON
+// of the project to TOML. The supported subset of TOML covers what a project needs: tables,
+// dotted and quoted keys, strings, booleans, numbers, arrays and inline tables; multi-line strings,
+// dates and arrays of tables are not supported.
+
+// tomlComments are the comments of a TOML document, kept to write them back when it is saved
+type tomlComments struct {
+	before   map[string][]string // Comment lines before a key or table header, by key path
+	inline   map[string]string   // Comment after a value or table header, by key path
+	trailing []string            // Comment lines after the last key
+}
+
+// tomlTable is a table of a TOML document with its keys in order
+type tomlTable struct {
+	keys   []string
+	values map[string]any // Values are strings, bools, json.Number, []any and *tomlTable
+}
+
+func newTOMLTable() *tomlTable {
+	return &tomlTable{values: make(map[string]any)}
+}
+
+func (t *tomlTable) set(key string, value any) {
+	if _, exists := t.values[key]; !exists {
+		t.keys = append(t.keys, key)
+	}
+	t.values[key] = value
+}
+
+// MarshalJSON writes the table as a JSON object with the keys in order
+func (t *tomlTable) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range t.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(t.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// tomlToJSON converts a TOML document to JSON and returns its comments
+func tomlToJSON(data []byte) ([]byte, tomlComments, error) {
+	parser := &tomlParser{src: string(data), line: 1}
+	root, comments, err := parser.parseDocument()
+	if err != nil {
+		return nil, tomlComments{}, fmt.Errorf("line %d: %w", parser.line, err)
+	}
+	converted, err := json.Marshal(root)
+	return converted, comments, err
+}
+
+// jsonToTOML converts a JSON object to a TOML document with the given comments; keys with a null
+// value are left out, since TOML has no null
+func jsonToTOML(data []byte, comments tomlComments) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeOrderedJSON(decoder)
+	if err != nil {
+		return nil, err
+	}
+	root, isTable := value.(*tomlTable)
+	if !isTable {
+		return nil, fmt.Errorf("a TOML document must be a table")
+	}
+	var buf bytes.Buffer
+	writer := &tomlWriter{buf: &buf, comments: comments}
+	if err := writer.writeTable(nil, root); err != nil {
+		return nil, err
+	}
+	writer.writeComments(comments.trailing)
+	return buf.Bytes(), nil
+}
+
+// decodeOrderedJSON decodes the next JSON value, keeping the order of the keys of objects
+func decodeOrderedJSON(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		table := newTOMLTable()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				table.set(key.(string), value)
+			}
+		}
+		_, err := decoder.Token()
+		return table, err
+	case json.Delim('['):
+		values := []any{}
+		for decoder.More() {
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				return nil, fmt.Errorf("TOML arrays cannot contain null")
+			}
+			values = append(values, value)
+		}
+		_, err := decoder.Token()
+		return values, err
+	}
+	return token, nil
+}
+
+// tomlWriter writes tables as TOML
+type tomlWriter struct {
+	buf      *bytes.Buffer
+	comments tomlComments
+}
+
+// writeTable writes the keys of a table and then its subtables; a header is written for a
+// subtable unless it only contains subtables
+func (w *tomlWriter) writeTable(path []string, table *tomlTable) error {
+	var subtables []string
+	hasValues := false
+	for _, key := range table.keys {
+		if _, isTable := table.values[key].(*tomlTable); isTable {
+			subtables = append(subtables, key)
+		} else {
+			hasValues = true
+		}
+	}
+	if len(path) > 0 && (hasValues || len(subtables) == 0) {
+		if w.buf.Len() > 0 {
+			w.buf.WriteByte('\n')
+		}
+		name := tomlPath(path)
+		w.writeComments(w.comments.before[name])
+		w.buf.WriteString("[" + name + "]")
+		w.writeInlineComment(name)
+	}
+	for _, key := range table.keys {
+		value := table.values[key]
+		if _, isTable := value.(*tomlTable); isTable {
+			continue
+		}
+		name := tomlPath(append(path, key))
+		w.writeComments(w.comments.before[name])
+		formatted, err := formatTOMLValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		w.buf.WriteString(tomlKey(key) + " = " + formatted)
+		w.writeInlineComment(name)
+	}
+	for _, key := range subtables {
+		if err := w.writeTable(append(append([]string(nil), path...), key), table.values[key].(*tomlTable)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *tomlWriter) writeComments(lines []string) {
+	for _, line := range lines {
+		w.buf.WriteString(line + "\n")
+	}
+}
+
+func (w *tomlWriter) writeInlineComment(name string) {
+	if comment := w.comments.inline[name]; comment != "" {
+		w.buf.WriteString(" " + comment)
+	}
+	w.buf.WriteByte('\n')
+}
+
+// formatTOMLValue formats a value on a single line; tables in arrays are written as inline tables
+func formatTOMLValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return quoteTOMLString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, element := range v {
+			formatted, err := formatTOMLValue(element)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = formatted
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case *tomlTable:
+		parts := make([]string, len(v.keys))
+		for i, key := range v.keys {
+			formatted, err := formatTOMLValue(v.values[key])
+			if err != nil {
+				return "", err
+			}
+			parts[i] = tomlKey(key) + " = " + formatted
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// bareKeyPattern matches the keys that can be written without quotes
+var bareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey returns a key as it is written in TOML: bare if possible, and quoted otherwise
+func tomlKey(key string) string {
+	if bareKeyPattern.MatchString(key) {
+		return key
+	}
+	return quoteTOMLString(key)
+}
+
+// tomlPath returns a key path as it is written in a table header, e.g. deps."<uuid>@v1"
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+// quoteTOMLString quotes a string as a TOML basic string
+func quoteTOMLString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlParser parses a TOML document
+type tomlParser struct {
+	src  string
+	pos  int
+	line int // Line of pos, for error messages
+}
+
+// parseDocument parses the tables and keys of the document and collects its comments
+func (p *tomlParser) parseDocument() (*tomlTable, tomlComments, error) {
+	root := newTOMLTable()
+	comments := tomlComments{before: make(map[string][]string), inline: make(map[string]string)}
+	defined := make(map[string]bool) // Tables with a header and keys, by path
+	current, currentPath := root, []string(nil)
+	var pending []string
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			break
+		}
+		switch p.peek() {
+		case '\n', '\r':
+			p.skipNewline()
+			continue
+		case '#':
+			pending = append(pending, p.readComment())
+			continue
+		}
+		var name string
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, comments, fmt.Errorf("arrays of tables are not supported")
+			}
+			path, err := p.parseKeyPath()
+			if err != nil {
+				return nil, comments, err
+			}
+			if !p.consume(']') {
+				return nil, comments, fmt.Errorf("expected ']' after table header")
+			}
+			name = tomlPath(path)
+			if defined[name] {
+				return nil, comments, fmt.Errorf("table [%s] is defined twice", name)
+			}
+			defined[name] = true
+			if current, err = descendTOMLTable(root, path); err != nil {
+				return nil, comments, err
+			}
+			currentPath = path
+		} else {
+			path, err := p.parseKeyPath()
+			if err != nil {
+				return nil, comments, err
+			}
+			p.skipSpaces()
+			if !p.consume('=') {
+				return nil, comments, fmt.Errorf("expected '=' after key %s", tomlPath(path))
+			}
+			p.skipSpaces()
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, comments, err
+			}
+			table, err := descendTOMLTable(current, path[:len(path)-1])
+			if err != nil {
+				return nil, comments, err
+			}
+			key := path[len(path)-1]
+			if _, exists := table.values[key]; exists {
+				return nil, comments, fmt.Errorf("key %s is defined twice", tomlPath(path))
+			}
+			table.set(key, value)
+			name = tomlPath(append(append([]string(nil), currentPath...), path...))
+		}
+		if len(pending) > 0 {
+			comments.before[name] = pending
+			pending = nil
+		}
+		p.skipSpaces()
+		if !p.eof() && p.peek() == '#' {
+			comments.inline[name] = p.readComment()
+		}
+		if !p.eof() && !p.skipNewline() {
+			return nil, comments, fmt.Errorf("unexpected '%c' after %s", p.peek(), name)
+		}
+	}
+	comments.trailing = pending
+	return root, comments, nil
+}
+
+// descendTOMLTable returns the table at a path below a table, creating the tables that do not exist
+func descendTOMLTable(table *tomlTable, path []string) (*tomlTable, error) {
+	for _, key := range path {
+		value, exists := table.values[key]
+		if !exists {
+			value = newTOMLTable()
+			table.set(key, value)
+		}
+		subtable, isTable := value.(*tomlTable)
+		if !isTable {
+			return nil, fmt.Errorf("key %s is not a table", tomlKey(key))
+		}
+		table = subtable
+	}
+	return table, nil
+}
+
+// parseKeyPath parses a dotted key of bare and quoted keys
+func (p *tomlParser) parseKeyPath() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpaces()
+		var key string
+		switch {
+		case p.eof():
+			return nil, fmt.Errorf("expected a key")
+		case p.peek() == '"' || p.peek() == '\'':
+			value, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = value
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("invalid key at '%c'", p.peek())
+			}
+			key = p.src[start:p.pos]
+		}
+		path = append(path, key)
+		p.skipSpaces()
+		if !p.consume('.') {
+			return path, nil
+		}
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue parses a string, boolean, number, array or inline table
+func (p *tomlParser) parseValue() (any, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	}
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n#,]}", p.peek()) < 0 {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	number := strings.ReplaceAll(word, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err == nil && number != "" {
+		return json.Number(strings.TrimPrefix(number, "+")), nil
+	}
+	return nil, fmt.Errorf("unsupported value '%s'", word)
+}
+
+// parseString parses a basic string in double quotes or a literal string in single quotes
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.peek()
+	if strings.HasPrefix(p.src[p.pos:], strings.Repeat(string(quote), 3)) {
+		return "", fmt.Errorf("multi-line strings are not supported")
+	}
+	start := p.pos
+	p.pos++
+	for !p.eof() && p.peek() != quote && p.peek() != '\n' {
+		if quote == '"' && p.peek() == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if !p.consume(quote) {
+		return "", fmt.Errorf("unterminated string")
+	}
+	raw := p.src[start:p.pos]
+	if quote == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+	value, err := strconv.Unquote(raw)
+	if err != nil || !utf8.ValidString(value) {
+		return "", fmt.Errorf("invalid string %s", raw)
+	}
+	return value, nil
+}
+
+// parseArray parses an array, which can span several lines and contain comments
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.pos++
+	values := []any{}
+	for {
+		p.skipBlank()
+		if p.consume(']') {
+			return values, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipBlank()
+		if p.consume(']') {
+			return values, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+// parseInlineTable parses an inline table on a single line
+func (p *tomlParser) parseInlineTable() (*tomlTable, error) {
+	p.pos++
+	table := newTOMLTable()
+	p.skipSpaces()
+	if p.consume('}') {
+		return table, nil
+	}
+	for {
+		path, err := p.parseKeyPath()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume('=') {
+			return nil, fmt.Errorf("expected '=' after key %s", tomlPath(path))
+		}
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		parent, err := descendTOMLTable(table, path[:len(path)-1])
+		if err != nil {
+			return nil, err
+		}
+		parent.set(path[len(path)-1], value)
+		p.skipSpaces()
+		if p.consume('}') {
+			return table, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) consume(c byte) bool {
+	if !p.eof() && p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tomlParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipNewline skips a line ending, and reports whether there was one
+func (p *tomlParser) skipNewline() bool {
+	p.consume('\r')
+	if p.consume('\n') {
+		p.line++
+		return true
+	}
+	return false
+}
+
+// skipBlank skips whitespace, line endings and comments, as allowed within arrays
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpaces()
+		switch {
+		case p.eof():
+			return
+		case p.peek() == '#':
+			p.readComment()
+		case !p.skipNewline():
+			return
+		}
+	}
+}
+
+// readComment reads a comment up to the end of the line
+func (p *tomlParser) readComment() string {
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+	return strings.TrimRight(p.src[start:p.pos], " \t\r")
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"cosm/types"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOMLRoundTrip(t *testing.T) {
+	project := types.Project{
+		Name:     "mypkg",
+		UUID:     "0b6f3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4a",
+		Authors:  []string{"Jane <jane@example.com>"},
+		Version:  "v1.2.0",
+		Keywords: []string{"a \"quoted\" word", "tab\there"},
+		Deps: map[string]types.Dependency{
+			"1f2e3d4c-0000-4000-8000-000000000001@v1": {Name: "json", Version: "v1.0.0", Optional: true, Platforms: []string{"linux"}},
+			"1f2e3d4c-0000-4000-8000-000000000002@v2": {Name: "http", Version: "v2.1.0", Group: "dev"},
+		},
+		Features: map[string][]string{"web": {"json", "http/tls"}},
+	}
+	data, err := json.Marshal(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := jsonToTOML(data, tomlComments{})
+	if err != nil {
+		t.Fatalf("Failed to convert to TOML: %v", err)
+	}
+	if !strings.Contains(string(document), "[deps.\"1f2e3d4c-0000-4000-8000-000000000001@v1\"]\nname = \"json\"") {
+		t.Errorf("Expected a table per dependency, got:\n%s", document)
+	}
+	converted, _, err := tomlToJSON(document)
+	if err != nil {
+		t.Fatalf("Failed to parse TOML: %v\n%s", err, document)
+	}
+	var parsed types.Project
+	if err := json.Unmarshal(converted, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, project) {
+		t.Errorf("Expected %+v, got %+v", project, parsed)
+	}
+}
+
+func TestTOMLComments(t *testing.T) {
+	document := `# The package
+name = "mypkg" # Do not rename
+version = "v1.0.0"
+authors = [
+  "Jane", # Maintainer
+  "John",
+]
+
+# Optional features
+[features]
+web = ["json"]
+# Trailing note
+`
+	converted, comments, err := tomlToJSON([]byte(document))
+	if err != nil {
+		t.Fatalf("Failed to parse TOML: %v", err)
+	}
+	var project types.Project
+	if err := json.Unmarshal(converted, &project); err != nil {
+		t.Fatal(err)
+	}
+	project.Version = "v1.1.0"
+	data, err := json.Marshal(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := jsonToTOML(data, comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"# The package\nname = \"mypkg\" # Do not rename\n", "version = \"v1.1.0\"\n", "authors = [\"Jane\", \"John\"]\n", "# Optional features\n[features]\nweb = [\"json\"]\n# Trailing note\n"} {
+		if !strings.Contains(string(written), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, written)
+		}
+	}
+}
+
+func TestTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{"duplicate_key", "name = \"a\"\nname = \"b\"\n", "line 2: key name is defined twice"},
+		{"duplicate_table", "[features]\n[features]\n", "line 2: table [features] is defined twice"},
+		{"missing_equals", "name \"a\"\n", "expected '='"},
+		{"unterminated_string", "name = \"a\n", "unterminated string"},
+		{"array_of_tables", "[[deps]]\n", "arrays of tables are not supported"},
+		{"multiline_string", "description = \"\"\"\ntext\n\"\"\"\n", "multi-line strings are not supported"},
+		{"trailing_garbage", "name = \"a\" b\n", "unexpected 'b'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tomlToJSON([]byte(tt.document))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"context"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// loadTrustPolicy returns the trust policy of a registry from registries/trust.json.
+// Registries without a policy get the zero policy (no signing, no requirements).
+func loadTrustPolicy(registriesDir, registryName string) (types.TrustPolicy, error) {
+	trustFile := filepath.Join(registriesDir, "trust.json")
+	data, err := os.ReadFile(trustFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return types.TrustPolicy{}, nil
+		}
+		return types.TrustPolicy{}, fmt.Errorf("failed to read trust.json: %w", err)
+	}
+	var policies map[string]types.TrustPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return types.TrustPolicy{}, fmt.Errorf("failed to parse trust.json: %w", err)
+	}
+	return policies[registryName], nil
+}
+
+// checkSigningConfig verifies that git can sign tags in a repository, so that a signed release
+// fails before anything is changed: the signing program of gpg.format must be available, and an
+// SSH signing key must be configured in user.signingkey
+func checkSigningConfig(ctx context.Context, dir string) error {
+	format := gitConfigValue(ctx, dir, "gpg.format")
+	if format == "" {
+		format = "openpgp"
+	}
+	program := gitConfigValue(ctx, dir, "gpg."+format+".program")
+	switch format {
+	case "ssh":
+		key := gitConfigValue(ctx, dir, "user.signingkey")
+		if key == "" {
+			return validationError("cannot sign the release tag: gpg.format is ssh but user.signingkey is not set (run 'git config user.signingkey <public key file>')")
+		}
+		if !strings.HasPrefix(key, "key::") && !strings.HasPrefix(key, "ssh-") {
+			if _, err := os.Stat(key); err != nil {
+				return validationError("cannot sign the release tag: signing key %s not found", key)
+			}
+		}
+		if program == "" {
+			program = "ssh-keygen"
+		}
+	case "x509":
+		if program == "" {
+			program = "gpgsm"
+		}
+	default:
+		if program == "" {
+			program = gitConfigValue(ctx, dir, "gpg.program")
+		}
+		if program == "" {
+			program = "gpg"
+		}
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		return validationError("cannot sign the release tag: %s (for gpg.format %s) not found", program, format)
+	}
+	return nil
+}
+
+// gitConfigValue returns the value of a git configuration key in a repository, or "" if it is not set
+func gitConfigValue(ctx context.Context, dir, key string) string {
+	value, err := GitCommand(ctx, dir, "config", key)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// tagSigner returns the tagger of a signed tag as "Name <email>", or "" if the tag is not signed
+func tagSigner(ctx context.Context, repoDir, tag string) (string, error) {
+	output, err := GitCommand(ctx, repoDir, "for-each-ref", "--format=%(taggername) %(taggeremail)%00%(contents:signature)", "refs/tags/"+tag)
+	if err != nil {
+		return "", wrapGitError(repoDir, fmt.Sprintf("failed to read tag '%s'", tag), err)
+	}
+	tagger, signature, _ := strings.Cut(output, "\x00")
+	if strings.TrimSpace(signature) == "" {
+		return "", nil
+	}
+	return strings.TrimSpace(tagger), nil
+}
+
+// recordTagSigner records the signer of a signed release tag in the specs.json of the version in a
+// registry; the specs are left as they are for unsigned tags
+func recordTagSigner(ctx context.Context, repoDir, tag, versionDir string) error {
+	signer, err := tagSigner(ctx, repoDir, tag)
+	if err != nil || signer == "" {
+		return err
+	}
+	specsFile := filepath.Join(versionDir, "specs.json")
+	specs, err := loadSpecsFile(specsFile)
+	if err != nil {
+		return err
+	}
+	specs.Signer = signer
+	return saveSpecs(specs, specsFile)
+}
+
+// commitSignatureStatus returns the signature status of a registry commit as reported by
+// git's %G? format ("G" for a good signature, "N" for no signature, etc.)
+func commitSignatureStatus(ctx context.Context, registriesDir, registryDir, commit string, policy types.TrustPolicy) (string, error) {
+	args := []string{"git"}
+	if policy.AllowedSigners != "" {
+		allowedSigners := policy.AllowedSigners
+		if !filepath.IsAbs(allowedSigners) {
+			allowedSigners = filepath.Join(registriesDir, allowedSigners)
+		}
+		args = append(args, "-c", "gpg.ssh.allowedSignersFile="+allowedSigners)
+	}
+	args = append(args, "log", "-1", "--format=%G?", commit)
+	output, err := runCommand(ctx, registryDir, args...)
+	if err != nil {
+		return "", wrapGitError(registryDir, fmt.Sprintf("failed to check signature of commit %s", commit), err)
+	}
+	return output, nil
+}
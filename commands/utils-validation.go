@@ -16,7 +16,7 @@ func validateProject(project *types.Project) error {
 		return fmt.Errorf("Project.json does not contain a valid UUID")
 	}
 	if _, err := uuid.Parse(project.UUID); err != nil {
-		return fmt.Errorf("invalid UUID '%s' in Project.json: %v", project.UUID, err)
+		return fmt.Errorf("invalid UUID '%s' in Project.json: %w", project.UUID, err)
 	}
 	if project.Version == "" {
 		return fmt.Errorf("Project.json does not contain a version")
@@ -24,7 +24,7 @@ func validateProject(project *types.Project) error {
 	// Validate version parsing
 	_, err := ParseSemVer(project.Version)
 	if err != nil {
-		return fmt.Errorf("invalid version in Project.json: %v", err)
+		return fmt.Errorf("invalid version in Project.json: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"cosm/logging"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout bounds each notification, so that an unresponsive endpoint does not hold up a release
+var webhookTimeout = 10 * time.Second
+
+// publishEvent is the JSON payload posted to the webhooks of a registry when a version is published
+type publishEvent struct {
+	Event    string `json:"event"` // Always "publish"
+	Registry string `json:"registry"`
+	Package  string `json:"package"`
+	UUID     string `json:"uuid"`
+	Version  string `json:"version"`
+	SHA1     string `json:"sha1"`
+}
+
+// notifyWebhooks posts a publish event for every version of a package to the webhooks configured in
+// registry.json. The versions are already pushed, so failures are reported as warnings.
+func notifyWebhooks(ctx context.Context, registriesDir, registryName, packageName string, versions []string) {
+	registry, _, err := LoadRegistryMetadata(registriesDir, registryName)
+	if err != nil || len(registry.Webhooks) == 0 || len(versions) == 0 {
+		return
+	}
+	if currentConfig().StageRegistry {
+		return // The webhooks are notified by cosm registry push
+	}
+	if currentConfig().Offline {
+		logging.Warnf("not notifying the webhooks of registry '%s' in offline mode", registryName)
+		return
+	}
+	for _, version := range versions {
+		specs, err := loadSpecs(registriesDir, registryName, packageName, version)
+		if err != nil {
+			logging.Warnf("failed to load specs for '%s@%s' to notify webhooks: %v", packageName, version, err)
+			continue
+		}
+		event := publishEvent{
+			Event:    "publish",
+			Registry: registryName,
+			Package:  packageName,
+			UUID:     specs.UUID,
+			Version:  version,
+			SHA1:     specs.SHA1,
+		}
+		for _, webhook := range registry.Webhooks {
+			if err := postWebhook(ctx, webhook, event); err != nil {
+				logging.Warnf("failed to notify webhook '%s' of '%s@%s': %v", webhook, packageName, version, err)
+			}
+		}
+	}
+}
+
+// postWebhook posts an event as JSON to a webhook URL and expects a 2xx response
+func postWebhook(ctx context.Context, webhook string, event publishEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cosm")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
+
+// validateWebhookURL checks that a webhook is an absolute http or https URL
+func validateWebhookURL(webhook string) error {
+	parsed, err := url.Parse(webhook)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return validationError("invalid webhook URL '%s': must be an http or https URL", webhook)
+	}
+	return nil
+}
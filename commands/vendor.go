@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"cosm/logging"
+	"cosm/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/spf13/cobra"
+)
+
+// vendorDir is the directory in the project root that holds the vendored packages
+const vendorDir = "vendor"
+
+// Vendor copies all packages in the build list of the project into vendor/ and records
+// them in vendor/vendor.json, so that the project can be activated without the depot
+func Vendor(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	project, err := validateActivate(args)
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	buildListFile := ".cosm/buildlist.json"
+
+	if err := generateOrVerifyBuildList(project, recordedGroups(""), registriesDir, buildListFile); err != nil {
+		return err
+	}
+	buildList, err := loadBuildListFile(buildListFile)
+	if err != nil {
+		return fmt.Errorf("failed to load buildlist.json: %w", err)
+	}
+	if err := makePackagesAvailable(ctx, &buildList, cosmDir); err != nil {
+		return fmt.Errorf("failed to make packages available: %w", err)
+	}
+
+	// Replace the previously vendored packages
+	if err := os.RemoveAll(vendorDir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", vendorDir, err)
+	}
+	for _, dep := range buildList.Dependencies {
+		if err := copyPackageFiles(filepath.Join(cosmDir, dep.Path), vendoredPackageDir(dep), nil); err != nil {
+			return fmt.Errorf("failed to vendor '%s@%s': %w", dep.Name, dep.Version, err)
+		}
+	}
+	manifest := types.VendorManifest{Deps: project.Deps, Dependencies: buildList.Dependencies}
+	if manifest.Deps == nil {
+		manifest.Deps = make(map[string]types.Dependency)
+	}
+	if err := saveVendorManifest(&manifest); err != nil {
+		return err
+	}
+
+	logging.Infof("Vendored %d package(s) into %s/", len(buildList.Dependencies), vendorDir)
+	return nil
+}
+
+// vendoredPackageDir returns the directory of a vendored package relative to the project root
+func vendoredPackageDir(dep types.BuildListDependency) string {
+	return filepath.Join(vendorDir, fmt.Sprintf("%s@%s", dep.Name, dep.Version))
+}
+
+// loadVendorManifest loads vendor/vendor.json, or returns nil if the project is not vendored
+func loadVendorManifest() (*types.VendorManifest, error) {
+	manifestFile := filepath.Join(vendorDir, "vendor.json")
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", manifestFile, err)
+	}
+	var manifest types.VendorManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", manifestFile, err)
+	}
+	return &manifest, nil
+}
+
+// saveVendorManifest writes vendor/vendor.json
+func saveVendorManifest(manifest *types.VendorManifest) error {
+	manifestFile := filepath.Join(vendorDir, "vendor.json")
+	if err := os.MkdirAll(vendorDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", vendorDir, err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", manifestFile, err)
+	}
+	if err := writeMetadataFile(manifestFile, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", manifestFile, err)
+	}
+	return nil
+}
+
+// loadCurrentVendorManifest returns the vendor manifest if it matches the dependencies of the
+// project, and nil if the project is not vendored. An outdated manifest is reported and ignored.
+func loadCurrentVendorManifest(project *types.Project) (*types.VendorManifest, error) {
+	manifest, err := loadVendorManifest()
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+	deps := project.Deps
+	if deps == nil {
+		deps = make(map[string]types.Dependency)
+	}
+	if !reflect.DeepEqual(manifest.Deps, deps) {
+		logging.Warnf("%s/vendor.json is out of date and is ignored; run 'cosm vendor' to update it", vendorDir)
+		return nil, nil
+	}
+	return manifest, nil
+}
+
+// useVendoredPackages points the dependencies of the build list that were vendored to their
+// absolute location in vendor/
+func useVendoredPackages(buildList *types.BuildList, manifest *types.VendorManifest) error {
+	for key, dep := range buildList.Dependencies {
+		vendored, exists := manifest.Dependencies[key]
+		if !exists || vendored.SHA1 != dep.SHA1 {
+			continue
+		}
+		path, err := filepath.Abs(vendoredPackageDir(vendored))
+		if err != nil {
+			return fmt.Errorf("failed to resolve vendored path of '%s@%s': %w", dep.Name, dep.Version, err)
+		}
+		dep.Path = path
+		buildList.Dependencies[key] = dep
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Verify checks the provenance of a registered package version: the signature of the
+// registry commit that added it, the SHA1 of its release tag and whether the tag was signed
+func Verify(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one argument required (e.g., cosm verify <package name>@v<version>)")
+	}
+	packageName, versionTag, found := strings.Cut(args[0], "@")
+	if !found || packageName == "" || versionTag == "" {
+		return fmt.Errorf("package must be given as <package name>@v<version>")
+	}
+	if _, err := ParseSemVer(versionTag); err != nil {
+		return fmt.Errorf("invalid version '%s': %w", versionTag, err)
+	}
+
+	registriesDir, err := getRegistriesDir()
+	if err != nil {
+		return fmt.Errorf("failed to get registries directory: %w", err)
+	}
+	registryName, err := findRegistryWithVersion(cmd, registriesDir, packageName, versionTag)
+	if err != nil {
+		return err
+	}
+	registryDir := filepath.Join(registriesDir, registryName)
+	specs, err := loadSpecs(registriesDir, registryName, packageName, versionTag)
+	if err != nil {
+		return fmt.Errorf("failed to load specs for '%s@%s' in registry '%s': %w", packageName, versionTag, registryName, err)
+	}
+
+	// Check the registry commit that recorded this version
+	policy, err := loadTrustPolicy(registriesDir, registryName)
+	if err != nil {
+		return err
+	}
+	specsPath := filepath.Join(strings.ToUpper(string(packageName[0])), packageName, versionTag, "specs.json")
+	commit, err := GitCommand(ctx, registryDir, "log", "-1", "--format=%H", "--", specsPath)
+	if err != nil || commit == "" {
+		return fmt.Errorf("failed to find the registry commit of '%s@%s' in registry '%s': %w", packageName, versionTag, registryName, err)
+	}
+	status, err := commitSignatureStatus(ctx, registriesDir, registryDir, commit, policy)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == "G":
+		logging.Infof("Registry commit %s has a valid signature", commit[:7])
+	case policy.RequireSigned:
+		return fmt.Errorf("registry commit %s of '%s@%s' has no valid signature (status %s), but registry '%s' requires signed commits", commit[:7], packageName, versionTag, status, registryName)
+	default:
+		logging.Warnf("registry commit %s is not signed with a trusted key", commit[:7])
+	}
+
+	// Check that the release tag still points to the recorded SHA1
+	tag := releaseTagPrefix(packageName, specs.Subdir) + versionTag
+	tagSHA1, err := remoteTagSHA1(ctx, specs.GitURL, tag)
+	if err != nil {
+		return err
+	}
+	if tagSHA1 != specs.SHA1 {
+		return fmt.Errorf("tag '%s' of '%s' points to %s, but specs.json in registry '%s' records %s", tag, packageName, tagSHA1, registryName, specs.SHA1)
+	}
+	switch {
+	case specs.Signer != "":
+		logging.Infof("Release tag '%s' was signed by %s", tag, specs.Signer)
+	case policy.RequireSignedTags:
+		return fmt.Errorf("release tag '%s' of '%s' was not signed, but registry '%s' requires signed release tags", tag, packageName, registryName)
+	}
+
+	logging.Infof("Verified '%s@%s' in registry '%s'", packageName, versionTag, registryName)
+	return nil
+}
+
+// findRegistryWithVersion returns the registry (from --registry or all registries) that contains the version
+func findRegistryWithVersion(cmd *cobra.Command, registriesDir, packageName, versionTag string) (string, error) {
+	registryNames, err := loadRegistryNames(registriesDir)
+	if err != nil {
+		return "", err
+	}
+	if registryName, _ := cmd.Flags().GetString("registry"); registryName != "" {
+		if !contains(registryNames, registryName) {
+			return "", notFoundError("registry '%s' not found in registries.json", registryName)
+		}
+		registryNames = []string{registryName}
+	}
+	for _, registryName := range registryNames {
+		versions, err := loadVersions(registriesDir, registryName, packageName)
+		if err != nil {
+			return "", err
+		}
+		if contains(versions, versionTag) {
+			return registryName, nil
+		}
+	}
+	return "", notFoundError("version '%s' of package '%s' not found in any registry", versionTag, packageName)
+}
+
+// remoteTagSHA1 returns the commit SHA1 a tag points to in a remote repository
+func remoteTagSHA1(ctx context.Context, gitURL, tag string) (string, error) {
+	output, err := GitCommand(ctx, "", "ls-remote", gitURL, "refs/tags/"+tag, "refs/tags/"+tag+"^{}")
+	if err != nil {
+		return "", fmt.Errorf("failed to list tag '%s' at '%s': %w", tag, gitURL, err)
+	}
+	sha1 := ""
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		// Prefer the peeled commit of annotated tags
+		if fields[1] == "refs/tags/"+tag+"^{}" || sha1 == "" {
+			sha1 = fields[0]
+		}
+	}
+	if sha1 == "" {
+		return "", notFoundError("tag '%s' not found at '%s'", tag, gitURL)
+	}
+	return sha1, nil
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"cosm/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Which prints the absolute path of a dependency in the build list of the project in the current
+// directory: its package version in the depot, or the local tree of a path dependency. With --all,
+// the paths of all dependencies are printed, one "<name>@<version> <path>" per line.
+func Which(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	if all && len(args) != 0 || !all && len(args) != 1 {
+		return validationError("requires a package name (e.g., cosm which mylib or cosm which mylib@v2), or --all")
+	}
+	project, err := validateActivate(nil)
+	if err != nil {
+		return err
+	}
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	buildList, err := loadCurrentBuildList(project, setupRegistriesDir(cosmDir))
+	if err != nil {
+		return err
+	}
+	var deps []types.BuildListDependency
+	for _, dep := range buildList.Dependencies {
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return semVerLess(deps[i].Version, deps[j].Version)
+	})
+
+	if all {
+		for _, dep := range deps {
+			path, err := dependencyPath(cosmDir, dep)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s@%s %s\n", dep.Name, dep.Version, path)
+		}
+		return nil
+	}
+	dep, err := findBuildListDependency(deps, args[0])
+	if err != nil {
+		return err
+	}
+	path, err := dependencyPath(cosmDir, dep)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return notFoundError("'%s@%s' is not in the depot yet (run 'cosm activate' to fetch it): %s", dep.Name, dep.Version, path)
+	}
+	fmt.Println(path)
+	return nil
+}
+
+// findBuildListDependency returns the dependency in the build list with a name or import alias,
+// optionally followed by @<major version> to choose between major versions of the same package
+func findBuildListDependency(deps []types.BuildListDependency, arg string) (types.BuildListDependency, error) {
+	name, major, _ := strings.Cut(arg, "@")
+	var matches []types.BuildListDependency
+	var versions []string
+	for _, dep := range deps {
+		if dep.Name != name && dep.Alias != name {
+			continue
+		}
+		if depMajor, err := GetMajorVersion(dep.Version); major != "" && (err != nil || depMajor != major) {
+			continue
+		}
+		matches = append(matches, dep)
+		versions = append(versions, dep.Version)
+	}
+	switch len(matches) {
+	case 0:
+		return types.BuildListDependency{}, notFoundError("package '%s' is not in the build list of the project", arg)
+	case 1:
+		return matches[0], nil
+	default:
+		return types.BuildListDependency{}, validationError("package '%s' is in the build list in versions %s; choose one with %s@<major version>", name, strings.Join(versions, ", "), name)
+	}
+}
+
+// dependencyPath returns the absolute path of a dependency in the build list
+func dependencyPath(cosmDir string, dep types.BuildListDependency) (string, error) {
+	path, err := filepath.Abs(packagePath(cosmDir, dep))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the path of '%s@%s': %w", dep.Name, dep.Version, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,328 @@
+package commands
+
+import (
+	"context"
+	"cosm/logging"
+	"cosm/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// workspaceMember is a loaded member project of a workspace
+type workspaceMember struct {
+	path    string // Path relative to the workspace root
+	project *types.Project
+}
+
+// WorkspaceInit creates a Workspace.json in the current directory
+func WorkspaceInit(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("at most one argument allowed (e.g., cosm workspace init [workspace name])")
+	}
+	workspaceDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	name := filepath.Base(workspaceDir)
+	if len(args) == 1 {
+		name = args[0]
+	}
+	if name == "" {
+		return fmt.Errorf("workspace name cannot be empty")
+	}
+	if _, err := os.Stat("Workspace.json"); !os.IsNotExist(err) {
+		return conflictError("Workspace.json already exists in this directory")
+	}
+	workspace := types.Workspace{Name: name, Members: []string{}}
+	if err := saveWorkspace(&workspace, "Workspace.json"); err != nil {
+		return err
+	}
+	logging.Infof("Initialized workspace '%s'", name)
+	return nil
+}
+
+// WorkspaceAdd adds a local project directory to the workspace in the current directory
+func WorkspaceAdd(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one argument required (e.g., cosm workspace add <project dir>)")
+	}
+	workspace, err := loadWorkspace("Workspace.json")
+	if err != nil {
+		return err
+	}
+	workspaceDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	memberPath, err := relativeMemberPath(workspaceDir, args[0])
+	if err != nil {
+		return err
+	}
+	if contains(workspace.Members, memberPath) {
+		return conflictError("'%s' is already a member of workspace '%s'", memberPath, workspace.Name)
+	}
+	project, err := loadProjectFromDir(filepath.Join(workspaceDir, memberPath))
+	if err != nil {
+		return err
+	}
+	if err := validateProject(project); err != nil {
+		return err
+	}
+	members, err := loadWorkspaceMembers(workspaceDir, workspace)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.project.UUID == project.UUID {
+			return conflictError("project '%s' is already a member of workspace '%s' at '%s'", project.Name, workspace.Name, member.path)
+		}
+	}
+	workspace.Members = append(workspace.Members, memberPath)
+	if err := saveWorkspace(workspace, "Workspace.json"); err != nil {
+		return err
+	}
+	logging.Infof("Added project '%s' (%s) to workspace '%s'", project.Name, memberPath, workspace.Name)
+	return nil
+}
+
+// WorkspaceStatus prints an overview of the workspace members
+func WorkspaceStatus(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("cosm workspace status takes no arguments; run in the workspace root")
+	}
+	workspace, err := loadWorkspace("Workspace.json")
+	if err != nil {
+		return err
+	}
+	workspaceDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	members, err := loadWorkspaceMembers(workspaceDir, workspace)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Workspace Status for '%s':\n", workspace.Name)
+	if len(members) == 0 {
+		fmt.Println("  No members.")
+		return nil
+	}
+	fmt.Println("  Members:")
+	for _, member := range members {
+		fmt.Printf("    - %s %s (%s)\n", member.project.Name, member.project.Version, member.path)
+	}
+	return nil
+}
+
+// relativeMemberPath validates a member directory and returns it relative to the workspace root
+func relativeMemberPath(workspaceDir, dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path for %s: %w", dir, err)
+	}
+	relPath, err := filepath.Rel(workspaceDir, absDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute path of %s relative to the workspace: %w", dir, err)
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("project directory %s must be inside the workspace root %s", absDir, workspaceDir)
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// loadWorkspaceMembers loads the Project.json of every workspace member
+func loadWorkspaceMembers(workspaceDir string, workspace *types.Workspace) ([]workspaceMember, error) {
+	var members []workspaceMember
+	for _, memberPath := range workspace.Members {
+		project, err := loadProjectFromDir(filepath.Join(workspaceDir, filepath.FromSlash(memberPath)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load workspace member '%s': %w", memberPath, err)
+		}
+		members = append(members, workspaceMember{path: memberPath, project: project})
+	}
+	return members, nil
+}
+
+// generateWorkspaceBuildList computes a single build list for all workspace members using MVS.
+// The build list is resolved once for a root that requires the external dependencies of every
+// member and the members themselves as path dependencies, so that the members' requirements of
+// other members are satisfied by the local member projects. The members are left out of the
+// build list.
+func generateWorkspaceBuildList(members []workspaceMember, registriesDir string) (types.BuildList, error) {
+	memberUUIDs := make(map[string]bool)
+	for _, member := range members {
+		memberUUIDs[member.project.UUID] = true
+	}
+
+	root := &types.Project{Name: "workspace", Deps: make(map[string]types.Dependency)}
+	for _, member := range members {
+		memberDir, err := filepath.Abs(filepath.FromSlash(member.path))
+		if err != nil {
+			return types.BuildList{}, fmt.Errorf("failed to resolve absolute path for workspace member '%s': %w", member.path, err)
+		}
+		key, _, err := createDependencyEntry(member.project.Name, member.project.Version, member.project.UUID, types.Specs{})
+		if err != nil {
+			return types.BuildList{}, fmt.Errorf("invalid version of workspace member '%s': %w", member.path, err)
+		}
+		root.Deps[key] = types.Dependency{Name: member.project.Name, Version: member.project.Version, Path: memberDir}
+	}
+	for _, member := range members {
+		// Path dependencies of a member are relative to the member
+		memberDir, _ := filepath.Abs(filepath.FromSlash(member.path))
+		for key, dep := range absolutePathDependencies(member.project.Deps, memberDir) {
+			depUUID, err := extractUUIDFromKey(key)
+			if err != nil {
+				return types.BuildList{}, err
+			}
+			if memberUUIDs[depUUID] {
+				continue // Provided by the workspace
+			}
+			if err := mergeWorkspaceDependency(root.Deps, key, dep); err != nil {
+				return types.BuildList{}, fmt.Errorf("failed to resolve dependencies of workspace member '%s': %w", member.path, err)
+			}
+		}
+	}
+
+	buildList, err := generateBuildList(root, ".", targetPlatform(), registriesDir)
+	if err != nil {
+		return types.BuildList{}, err
+	}
+	for key, entry := range buildList.Dependencies {
+		if memberUUIDs[entry.UUID] {
+			delete(buildList.Dependencies, key)
+		}
+	}
+	return buildList, nil
+}
+
+// mergeWorkspaceDependency adds a dependency of a workspace member to the requirements of the
+// workspace: of two requirements of the same package the higher version is kept, with the
+// features of both. Members must agree on the local tree or commit of a package.
+func mergeWorkspaceDependency(deps map[string]types.Dependency, key string, dep types.Dependency) error {
+	current, exists := deps[key]
+	if !exists {
+		deps[key] = dep
+		return nil
+	}
+	if current.Path != dep.Path || current.SHA1 != dep.SHA1 {
+		return conflictError("workspace members require different sources of package '%s'", dep.Name)
+	}
+	maxVersion, err := MaxSemVer(current.Version, dep.Version)
+	if err != nil {
+		return fmt.Errorf("failed to compare versions for '%s': %w", dep.Name, err)
+	}
+	if maxVersion != dep.Version {
+		dep, current = current, dep
+	}
+	if dep.Alias == "" {
+		dep.Alias = current.Alias
+	}
+	dep.Features = mergeFeatures(dep.Features, current.Features)
+	deps[key] = dep
+	return nil
+}
+
+// prepareWorkspaceActivation computes the shared build list of all workspace members if needed and
+// writes its environment
+func prepareWorkspaceActivation(ctx context.Context, args []string) ([]envVar, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("cosm activate takes no arguments; run in workspace root with Workspace.json")
+	}
+	workspace, err := loadWorkspace("Workspace.json")
+	if err != nil {
+		return nil, err
+	}
+	workspaceDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+	members, err := loadWorkspaceMembers(workspaceDir, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	cosmDir, err := getCosmDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cosm directory: %w", err)
+	}
+	registriesDir := setupRegistriesDir(cosmDir)
+	buildListFile := ".cosm/buildlist.json"
+
+	inputs := workspaceBuildListInputs(members)
+	needsBuildList, err := needsBuildListGeneration("", inputs, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := createEnvironmentFiles(); err != nil {
+		return nil, err
+	}
+	if needsBuildList {
+		buildList, err := generateWorkspaceBuildList(members, registriesDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate build list for workspace %s: %w", workspace.Name, err)
+		}
+		if err := writeLocalBuildList(&buildList); err != nil {
+			return nil, err
+		}
+		if err := writeBuildListMeta("", inputs, nil); err != nil {
+			return nil, err
+		}
+		logging.Infof("Generated build list for workspace %s in %s", workspace.Name, buildListFile)
+	} else {
+		logging.Infof("Build list up-to-date in %s", buildListFile)
+	}
+
+	buildList, err := loadBuildListFile(buildListFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load buildlist.json: %w", err)
+	}
+
+	// Expose the sources of every member that has a src directory
+	var languages, srcDirs []string
+	for _, member := range members {
+		if !contains(languages, member.project.Language) {
+			languages = append(languages, member.project.Language)
+		}
+		srcDir := filepath.Join(filepath.FromSlash(member.path), "src")
+		if info, err := os.Stat(srcDir); err == nil && info.IsDir() {
+			srcDirs = append(srcDirs, srcDir)
+		}
+	}
+
+	projectEnv, err := workspaceEnvironment(members)
+	if err != nil {
+		return nil, err
+	}
+	return activateEnvironment(ctx, cosmDir, languages, srcDirs, projectEnv, &buildList)
+}
+
+// workspaceEnvironment combines the environment variables defined in the Project.json of every
+// member; members may only define the same variable with the same value
+func workspaceEnvironment(members []workspaceMember) (map[string]string, error) {
+	env := make(map[string]string)
+	definedBy := make(map[string]string)
+	for _, member := range members {
+		for name, value := range member.project.Env {
+			if other, exists := definedBy[name]; exists && env[name] != value {
+				return nil, conflictError("environment variable '%s' is defined differently by workspace members '%s' and '%s'", name, other, member.project.Name)
+			}
+			env[name] = value
+			definedBy[name] = member.project.Name
+		}
+	}
+	return env, nil
+}
+
+// workspaceBuildListInputs returns the files that the build list of a workspace is resolved
+// from: Workspace.json and the build list inputs of every member
+func workspaceBuildListInputs(members []workspaceMember) []string {
+	inputs := []string{"Workspace.json"}
+	for _, member := range members {
+		inputs = append(inputs, projectBuildListInputs(member.project, filepath.FromSlash(member.path))...)
+	}
+	return inputs
+}
@@ -0,0 +1,96 @@
+// Package core is the Go API of cosm for tools that embed it. It resolves build lists, adds
+// dependencies, releases packages and adds packages to registries without a command line,
+// returning typed results instead of printing them.
+//
+// Like the cosm command, the functions work on the depot in COSM_DEPOT_PATH and with the
+// registries in it. Progress messages and warnings go through package cosm/logging; silence them
+// with logging.Configure(logging.LevelError, logging.FormatText) or capture them with
+// logging.SetOutput. Errors can be classified with KindOf. Cancelling the context of a function
+// kills the git command it is running.
+package core
+
+import (
+	"context"
+	"cosm/commands"
+	"cosm/types"
+)
+
+// ResolveOptions selects the project whose build list is resolved
+type ResolveOptions = commands.ResolveOptions
+
+// AddOptions describes a dependency to add to a project
+type AddOptions = commands.AddOptions
+
+// VersionChoice is a version offered to AddOptions.SelectVersion
+type VersionChoice = commands.VersionChoice
+
+// AddResult is the dependency that was added to a project
+type AddResult = commands.AddResult
+
+// ReleaseOptions describes a release of a project
+type ReleaseOptions = commands.ReleaseOptions
+
+// ReleaseResult is a published release, or the planned release of a dry run
+type ReleaseResult = commands.ReleaseResult
+
+// RegistryAddOptions describes a package, or a version of a registered package, to add to a registry
+type RegistryAddOptions = commands.RegistryAddOptions
+
+// RegistryAddResult is the package and the versions that were added to a registry
+type RegistryAddResult = commands.RegistryAddResult
+
+// ErrorKind classifies the errors of the functions, e.g. to tell a missing package from a network
+// failure
+type ErrorKind = commands.ErrorKind
+
+// The kinds of errors
+const (
+	KindGeneral    = commands.KindGeneral    // Any other failure
+	KindValidation = commands.KindValidation // Invalid arguments, options or versions
+	KindNotFound   = commands.KindNotFound   // A registry, package, version or dependency does not exist
+	KindConflict   = commands.KindConflict   // The registry, package, version or dependency already exists
+	KindNetwork    = commands.KindNetwork    // A remote could not be reached
+	KindCanceled   = commands.KindCanceled   // The context was canceled
+)
+
+// KindOf returns the kind of an error returned by one of the functions
+func KindOf(err error) ErrorKind {
+	return commands.KindOf(err)
+}
+
+// Resolve resolves the build list of a project with minimal version selection, without writing
+// it to .cosm/buildlist.json or fetching the packages
+func Resolve(ctx context.Context, opts ResolveOptions) (types.BuildList, error) {
+	return commands.ResolveBuildList(ctx, opts)
+}
+
+// AddDependency selects a version of a package in the registries and adds it to the Project.json
+// of a project, like cosm add
+func AddDependency(ctx context.Context, opts AddOptions) (AddResult, error) {
+	return commands.AddDependency(ctx, opts)
+}
+
+// AddDependencies adds several dependencies to the Project.json of a project at once, like cosm add
+// with several packages: either all of them are added or none
+func AddDependencies(ctx context.Context, deps []AddOptions) ([]AddResult, error) {
+	return commands.AddDependencies(ctx, deps)
+}
+
+// Release tags a new version of a project and publishes it to its remote repository and the
+// target registries, like cosm release
+func Release(ctx context.Context, opts ReleaseOptions) (ReleaseResult, error) {
+	return commands.ReleaseVersion(ctx, opts)
+}
+
+// RegistryAdd adds a package with all its versions, or a version of a registered package, to a
+// registry and pushes the registry, like cosm registry add
+func RegistryAdd(ctx context.Context, opts RegistryAddOptions) (RegistryAddResult, error) {
+	return commands.AddToRegistry(ctx, opts)
+}
+
+// RegisterImportScanner lets cosm rm --unused find the imports of another language. scan returns
+// the top-level names of the modules imported by the content of a source file with one of the
+// extensions.
+func RegisterImportScanner(language string, extensions []string, scan func(source string) []string) {
+	commands.RegisterImportScanner(language, extensions, scan)
+}
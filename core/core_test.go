@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"cosm/types"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeJSON writes a value as JSON, creating the parent directories
+func writeJSON(t *testing.T, path string, value any) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory of %s: %v", path, err)
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	depotDir := t.TempDir()
+	t.Setenv("COSM_DEPOT_PATH", depotDir)
+	registriesDir := filepath.Join(depotDir, "registries")
+	writeJSON(t, filepath.Join(registriesDir, "registries.json"), []string{"myreg"})
+	writeJSON(t, filepath.Join(registriesDir, "myreg", "registry.json"), types.Registry{
+		Name:     "myreg",
+		Packages: map[string]types.PackageInfo{"mylib": {UUID: "uuid-lib", GitURL: "file:///mylib"}},
+	})
+	writeJSON(t, filepath.Join(registriesDir, "myreg", "M", "mylib", "v1.2.0", "specs.json"), types.Specs{
+		Name: "mylib", UUID: "uuid-lib", Version: "v1.2.0", GitURL: "file:///mylib", SHA1: "sha-lib",
+	})
+	writeJSON(t, filepath.Join(registriesDir, "myreg", "M", "mylib", "v1.2.0", "buildlist.json"), types.BuildList{})
+
+	projectDir := t.TempDir()
+	writeJSON(t, filepath.Join(projectDir, "Project.json"), types.Project{
+		Name:    "myproject",
+		UUID:    "uuid-project",
+		Version: "v0.1.0",
+		Deps:    map[string]types.Dependency{"uuid-lib@v1": {Name: "mylib", Version: "v1.2.0"}},
+	})
+
+	buildList, err := Resolve(context.Background(), ResolveOptions{ProjectDir: projectDir})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	dep, exists := buildList.Dependencies["uuid-lib@v1"]
+	if len(buildList.Dependencies) != 1 || !exists {
+		t.Fatalf("Expected only uuid-lib@v1 in the build list, got %v", buildList.Dependencies)
+	}
+	if dep.Version != "v1.2.0" || dep.SHA1 != "sha-lib" || dep.Path != "packages/mylib/sha-lib" {
+		t.Errorf("Unexpected build list entry %+v", dep)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".cosm")); !os.IsNotExist(err) {
+		t.Errorf("Expected Resolve not to write .cosm, got %v", err)
+	}
+
+	if _, err := Resolve(context.Background(), ResolveOptions{ProjectDir: t.TempDir()}); err == nil {
+		t.Errorf("Expected error for a directory without Project.json")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Resolve(ctx, ResolveOptions{ProjectDir: projectDir}); KindOf(err) != KindCanceled {
+		t.Errorf("Expected a canceled error for a canceled context, got %v", err)
+	}
+}
+
+func TestAddDependencySelectVersion(t *testing.T) {
+	depotDir := t.TempDir()
+	t.Setenv("COSM_DEPOT_PATH", depotDir)
+	t.Setenv("COSM_OFFLINE", "1") // The registry is not a git clone
+	registriesDir := filepath.Join(depotDir, "registries")
+	writeJSON(t, filepath.Join(registriesDir, "registries.json"), []string{"myreg"})
+	writeJSON(t, filepath.Join(registriesDir, "myreg", "registry.json"), types.Registry{
+		Name:     "myreg",
+		Packages: map[string]types.PackageInfo{"mylib": {UUID: "uuid-lib", GitURL: "file:///mylib"}},
+	})
+	versions := []string{"v1.2.0", "v1.3.0", "v2.0.0-beta.1"}
+	writeJSON(t, filepath.Join(registriesDir, "myreg", "M", "mylib", "versions.json"), versions)
+	for _, version := range versions {
+		writeJSON(t, filepath.Join(registriesDir, "myreg", "M", "mylib", version, "specs.json"), types.Specs{
+			Name: "mylib", UUID: "uuid-lib", Version: version, GitURL: "file:///mylib", SHA1: "sha-" + version,
+		})
+	}
+	projectDir := t.TempDir()
+	writeJSON(t, filepath.Join(projectDir, "Project.json"), types.Project{Name: "myproject", UUID: "uuid-project", Version: "v0.1.0"})
+
+	var offered []VersionChoice
+	result, err := AddDependency(context.Background(), AddOptions{
+		ProjectDir: projectDir,
+		Name:       "mylib",
+		SelectVersion: func(packageName string, choices []VersionChoice) (string, error) {
+			offered = choices
+			return "v1.2.0", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("AddDependency failed: %v", err)
+	}
+	if result.Version != "v1.2.0" || result.Registry != "myreg" {
+		t.Errorf("Expected mylib v1.2.0 from myreg, got %+v", result)
+	}
+	if len(offered) != 2 || offered[0].Version != "v1.3.0" || !offered[0].Latest || offered[1].Version != "v1.2.0" || offered[1].Latest {
+		t.Errorf("Expected v1.3.0 (latest) and v1.2.0 to be offered without the prerelease, got %+v", offered)
+	}
+}
@@ -0,0 +1,119 @@
+// Package logging prints the messages of cosm at the verbosity and in the format selected on the command line.
+// Informational messages go to stdout; warnings, errors and debug messages go to stderr. In the JSON
+// format every message goes to stderr, so that stdout only holds the output of a command, e.g. of --json.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Level is the verbosity of the logger; messages above the level are suppressed
+type Level int
+
+const (
+	LevelError Level = iota // Only errors (--quiet)
+	LevelInfo               // Informational messages and warnings (default)
+	LevelDebug              // Also the commands cosm executes, with their durations (-v)
+	LevelTrace              // Also the output of the commands (-vv)
+)
+
+// Formats supported by Configure
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// record is a log message as written in the JSON format
+type record struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+var (
+	mu     sync.Mutex // Serializes writes of concurrent registry updates
+	level             = LevelInfo
+	format            = FormatText
+	stdout io.Writer  = os.Stdout
+	stderr io.Writer  = os.Stderr
+)
+
+// Configure sets the verbosity and the output format (text or json)
+func Configure(newLevel Level, newFormat string) error {
+	if newFormat != FormatText && newFormat != FormatJSON {
+		return fmt.Errorf("invalid log format '%s' (must be text or json)", newFormat)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	level = newLevel
+	format = newFormat
+	return nil
+}
+
+// SetOutput redirects the messages, e.g. to capture them in tests
+func SetOutput(out, errOut io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	stdout = out
+	stderr = errOut
+}
+
+// Enabled reports whether messages of a level are printed
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l <= level
+}
+
+// Errorf prints an error; errors are printed at every verbosity
+func Errorf(msg string, args ...any) {
+	write(LevelError, "error", "Error: ", msg, args...)
+}
+
+// Warnf prints a warning unless --quiet is given
+func Warnf(msg string, args ...any) {
+	write(LevelInfo, "warning", "Warning: ", msg, args...)
+}
+
+// Infof prints an informational message unless --quiet is given
+func Infof(msg string, args ...any) {
+	write(LevelInfo, "info", "", msg, args...)
+}
+
+// Debugf prints a message with -v
+func Debugf(msg string, args ...any) {
+	write(LevelDebug, "debug", "[debug] ", msg, args...)
+}
+
+// Tracef prints a message with -vv
+func Tracef(msg string, args ...any) {
+	write(LevelTrace, "trace", "[trace] ", msg, args...)
+}
+
+// write formats a message and prints it as a line of text with the given prefix, or as a JSON record
+func write(l Level, name, prefix, msg string, args ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l > level {
+		return
+	}
+	out := stderr
+	if name == "info" && format == FormatText {
+		out = stdout
+	}
+	text := fmt.Sprintf(msg, args...)
+	if format == FormatJSON {
+		data, err := json.Marshal(record{Time: time.Now().Format(time.RFC3339), Level: name, Message: text})
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(out, string(data))
+		return
+	}
+	fmt.Fprintln(out, prefix+text)
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	var out, errOut bytes.Buffer
+	SetOutput(&out, &errOut)
+	defer SetOutput(&bytes.Buffer{}, &bytes.Buffer{})
+
+	for _, tc := range []struct {
+		level     Level
+		stdout    string
+		stderr    string
+		debugging bool
+	}{
+		{LevelError, "", "Error: e\n", false},
+		{LevelInfo, "i\n", "Warning: w\nError: e\n", false},
+		{LevelTrace, "i\n", "Warning: w\n[debug] d\n[trace] t\nError: e\n", true},
+	} {
+		out.Reset()
+		errOut.Reset()
+		if err := Configure(tc.level, FormatText); err != nil {
+			t.Fatalf("Configure failed: %v", err)
+		}
+		Infof("i")
+		Warnf("w")
+		Debugf("d")
+		Tracef("t")
+		Errorf("e")
+		if out.String() != tc.stdout || errOut.String() != tc.stderr {
+			t.Errorf("Level %d: expected stdout %q and stderr %q, got %q and %q", tc.level, tc.stdout, tc.stderr, out.String(), errOut.String())
+		}
+		if Enabled(LevelDebug) != tc.debugging {
+			t.Errorf("Level %d: expected Enabled(LevelDebug) to be %v", tc.level, tc.debugging)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out, errOut bytes.Buffer
+	SetOutput(&out, &errOut)
+	defer SetOutput(&bytes.Buffer{}, &bytes.Buffer{})
+	if err := Configure(LevelInfo, FormatJSON); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	defer Configure(LevelInfo, FormatText)
+
+	Infof("Added %s", "x")
+	if out.Len() != 0 {
+		t.Errorf("Expected no records on stdout, got %q", out.String())
+	}
+	var rec record
+	if err := json.Unmarshal(errOut.Bytes(), &rec); err != nil {
+		t.Fatalf("Failed to parse %q: %v", errOut.String(), err)
+	}
+	if rec.Level != "info" || rec.Message != "Added x" || rec.Time == "" {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+	if err := Configure(LevelInfo, "xml"); err == nil {
+		t.Errorf("Expected error for an unknown format")
+	}
+}
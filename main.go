@@ -1,27 +1,124 @@
 // cosm --version
+// cosm <command> [-v|-vv|--quiet] [--log-format text|json] [--timeout <duration>] [--yes|--no-input]
+// cosm completion bash|zsh|fish|powershell
+// cosm help topics
+// cosm help <topic>|<command>
+// cosm man [--dir <dir>]
 // cosm status
 // cosm activate
+// cosm activate --shell
+// cosm activate --check
+// cosm activate --export direnv|dotenv|github
+// cosm activate --with <group>[,<group>...]
+// cosm activate --only <group>[,<group>...]
+// cosm deactivate
+// cosm exec [--] <command> [<args>...]
+// cosm vendor
+// cosm sbom [--format cyclonedx|spdx] [--output <file>]
+// cosm audit
+// cosm licenses [--allow <license>,...] [--deny <license>,...] [--json]
+// cosm which <package>[@<major version>]
+// cosm which --all
+// cosm daemon [--socket <path>] [--interval <duration>] [--poll <duration>]
 
-// cosm registry status <registry name>
+// cosm registry status <registry name> [--package <name>] [--json] [--sort name|versions|updated] [--limit <n>] [--page <n>]
+// cosm registry index <registry name> [--output <dir>]
 // cosm registry init <registry name> <giturl>
-// cosm registry clone <giturl>
+// cosm registry clone <giturl> [--sparse] [--read-only]
+// cosm registry protect <registry name>
+// cosm registry unprotect <registry name>
 // cosm registry delete <registry name> [--force]
 // cosm registry update <registry name>
 // cosm registry update --all
-// cosm registry add <registry name> <giturl>
+// cosm registry diff <registry name>
+// cosm registry push <registry name>
+// cosm registry discard <registry name> [--force]
+// cosm registry add <registry name> <giturl> [--subdir <path>] [--shallow]
+// cosm registry add <registry name> --path <dir>
+// cosm registry add <registry name> --batch <file>
 // cosm registry rm <registry name> <package name> [--force]
 // cosm registry rm <registry name> <package name> v<version> [--force]
+// cosm registry rm <registry name> <package name> v<version> --yank
+// cosm registry unyank <registry name> <package name> v<version>
+// cosm registry import <registry name> <source registry name> <package name> [v<version>...]
+// cosm registry audit <registry name> [--fix]
+// cosm registry rdeps <registry name> <package name> [v<version>] [--json]
+// cosm registry owner add <registry name> <package name> <author> [--force]
+// cosm registry owner rm <registry name> <package name> <author> [--force]
+// cosm registry owner list <registry name> <package name>
+// cosm registry mirror add <registry name> [<package name>] <url>
+// cosm registry mirror rm <registry name> [<package name>] <url>
+// cosm registry mirror list <registry name> [<package name>]
+// cosm registry webhook add <registry name> <url>
+// cosm registry webhook rm <registry name> <url>
+// cosm registry webhook list <registry name>
+
+// cosm template list
+// cosm template add <giturl> [--name <name>]
+// cosm template update [<name>]
+// cosm template remove <name>
+
+// cosm config list
+// cosm config get <key>
+// cosm config set <key> <value>
+
+// cosm cache info
+// cosm cache clean [--older-than <days>] [--unused]
+// cosm cache verify [--fix]
+// cosm cache archive [--upload]
+
+// cosm doctor
+
+// cosm workspace init [workspace name]
+// cosm workspace add <project dir>
+// cosm workspace status
 
 // cosm init <package name>
 // cosm init <package name> --language <language>
 // cosm init <package name> --template <language/template>
+// cosm init --from-git <giturl> [<package name>] [version]
+// cosm init ... --format json|toml
 // cosm add <name> v<version>
-// cosm rm <name>
+// cosm add <name>@v<version>
+// cosm add <name> --pre
+// cosm add <name>@v<version> --as <alias>
+// cosm add <registry>/<name>[@v<version>]
+// cosm add <name>[@v<version>] --sha <commit>
+// cosm add <name>[@v<version>] <name>[@v<version>]...
+// cosm add ... --refresh
+// cosm add --path <dir>
+// cosm add ... --group <group>
+// cosm add <name> --features <feature>[,<feature>...]
+// cosm add ... --optional
+// cosm add ... --platform <os>[/<arch>][,<os>[/<arch>]...]
+// cosm import --from go.mod|package.json|requirements.txt [--dry-run]
+// cosm rm <name> [<name>...]
+// cosm rm --unused
+// cosm add ... --no-resolve
+// cosm rm ... --no-resolve
 
 // cosm release v<version>
 // cosm release --patch
 // cosm release --minor
 // cosm release --major
+// cosm release ... --registry <registry name>
+// cosm release ... --register <registry name>
+// cosm release ... --dry-run
+// cosm release ... --package <subdir>
+// cosm release ... --force
+// cosm release ... --allow-path-deps
+// cosm release ... --strict
+// cosm release ... --notes <notes> | --notes-file <file>
+// cosm release ... --sign
+// cosm release ... --branch <branch>
+// cosm release ... --skip-checks
+
+// cosm verify <package name>@v<version> [--registry <registry name>]
+
+// cosm search <pattern> [--registry <registry name>] [--regex] [--json] [--sort name|versions|updated] [--limit <n>] [--page <n>]
+// cosm clone <name>[@v<version>] [<dir>] [--registry <registry name>] [--pre]
+// cosm info <name>[@v<version>] [--registry <registry name>] [--json]
+// cosm diff <name> v<version> v<version> [--registry <registry name>] [--deps] [--stat] [--no-changelog]
 
 // cosm develop <package name>
 // cosm free <package name>
@@ -39,16 +136,30 @@
 
 // cosm downgrade <name> v<version>
 
+// cosm undo [--force]
+// cosm undo --list
+
 package main
 
 import (
+	"context"
 	"cosm/commands"
+	"cosm/logging"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+//go:generate go run . man --dir man
+
 var version string // Populated by -ldflags during build
 
 // PrintVersion prints the version of the cosm tool and exits
@@ -57,12 +168,102 @@ func PrintVersion() {
 	os.Exit(0)
 }
 
+// skipsDepot reports whether cosm is run to generate or compute shell completions, to print help
+// or man pages, or to diagnose the depot, which must work without a depot
+func skipsDepot() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	switch os.Args[1] {
+	case "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd, "help", "man", "doctor":
+		return true
+	}
+	return false
+}
+
+// interactionArgs looks up the --yes and --no-input flags in the arguments of cosm
+func interactionArgs() (yes, noInput bool) {
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--":
+			return yes, noInput
+		case "--yes", "-y":
+			yes = true
+		case "--no-input":
+			noInput = true
+		}
+	}
+	return yes, noInput
+}
+
+// configureLogging sets the verbosity and format of messages from the -v, --quiet and --log-format flags
+func configureLogging(cmd *cobra.Command) error {
+	verbose, _ := cmd.Flags().GetCount("verbose")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	format, _ := cmd.Flags().GetString("log-format")
+	if quiet && verbose > 0 {
+		return fmt.Errorf("--quiet cannot be combined with --verbose")
+	}
+	level := logging.LevelInfo
+	switch {
+	case quiet:
+		level = logging.LevelError
+	case verbose == 1:
+		level = logging.LevelDebug
+	case verbose > 1:
+		level = logging.LevelTrace
+	}
+	return logging.Configure(level, format)
+}
+
+// reportError prints the error of a command; commands run with --json print it as a JSON object on stdout
+func reportError(cmd *cobra.Command, err error) {
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		data, _ := json.MarshalIndent(map[string]any{
+			"error": map[string]any{
+				"kind":     commands.KindOf(err),
+				"message":  err.Error(),
+				"exitcode": commands.ExitCode(err),
+			},
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	logging.Errorf("%v", err)
+}
+
+// addListingFlags adds the sort and pagination flags of package listings to a command
+func addListingFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sort", "name", "Sort packages by name, versions (most first) or updated (most recent first)")
+	cmd.Flags().Int("limit", 0, "Show at most this many packages per page (0 shows all)")
+	cmd.Flags().Int("page", 1, "Show this page of packages (requires --limit)")
+}
+
 func main() {
 
-	// Initialize COSM_DEPOT_PATH
-	if err := commands.InitializeCosm(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to initialize COSM_DEPOT_PATH: %v\n", err)
-		os.Exit(1)
+	// Cancel running git commands on the first Ctrl-C; a second Ctrl-C exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Initialize COSM_DEPOT_PATH and load the global configuration, except for shell completion
+	// and help, which must not prompt. The depot is initialized before the flags are parsed, so
+	// --yes and --no-input are looked up in the arguments.
+	commands.SetInteraction(interactionArgs())
+	if !skipsDepot() {
+		if err := commands.InitializeCosm(ctx); err != nil {
+			logging.Errorf("failed to initialize COSM_DEPOT_PATH: %v", err)
+			os.Exit(commands.ExitCode(err))
+		}
+		if _, err := commands.LoadConfig(); err != nil {
+			logging.Errorf("failed to load configuration: %v", err)
+			os.Exit(1)
+		}
+		// Remove the staging directories of clones left behind by crashed or killed runs
+		commands.SweepStaleTempDirs()
 	}
 
 	var rootCmd = &cobra.Command{
@@ -74,17 +275,42 @@ func main() {
 	}
 
 	var versionFlag bool
-	rootCmd.Flags().BoolVarP(&versionFlag, "version", "v", false, "Print the version number")
-	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+	rootCmd.Flags().BoolVar(&versionFlag, "version", false, "Print the version number")
+	rootCmd.PersistentFlags().CountP("verbose", "v", "Show the commands cosm executes (-v) and their output (-vv)")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only print errors")
+	rootCmd.PersistentFlags().String("log-format", logging.FormatText, "Format of messages: text or json")
+	rootCmd.PersistentFlags().String("timeout", "", "Timeout of each git command that contacts a remote, e.g. 90s or 5m (overrides the timeout setting)")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "Answer yes to confirmations and accept defaults without prompting (or set COSM_YES=1)")
+	rootCmd.PersistentFlags().Bool("no-input", false, "Never prompt; fail if input is required (or set COSM_NO_INPUT=1)")
+	rootCmd.SilenceErrors = true // Errors are printed by the logger
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := configureLogging(cmd); err != nil {
+			return err
+		}
+		yes, _ := cmd.Flags().GetBool("yes")
+		noInput, _ := cmd.Flags().GetBool("no-input")
+		commands.SetInteraction(yes, noInput)
+		if timeout, _ := cmd.Flags().GetString("timeout"); timeout != "" {
+			if err := commands.OverrideConfig("timeout", timeout); err != nil {
+				return err
+			}
+		}
 		if versionFlag {
 			PrintVersion()
 		}
+		// The daemon records an operation per request instead
+		if cmd.CommandPath() != "cosm daemon" {
+			commands.BeginOperation(strings.Join(append([]string{"cosm"}, os.Args[1:]...), " "))
+		}
+		return nil
 	}
 
 	var statusCmd = &cobra.Command{
-		Use:   "status",
-		Short: "Show the current cosmic status",
-		Run:   commands.Status, // Call from commands package,
+		Use:          "status",
+		Short:        "Show the current cosmic status",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Status,
+		SilenceUsage: true, // Prevent usage output in stderr
 	}
 
 	var activateCmd = &cobra.Command{
@@ -93,34 +319,83 @@ func main() {
 		RunE:         commands.Activate,
 		SilenceUsage: true, // Prevent usage output in stderr
 	}
+	activateCmd.Flags().Bool("shell", false, "Start an activated interactive subshell (bash, zsh, or fish from $SHELL)")
+	activateCmd.Flags().Bool("check", false, "Verify that .cosm/buildlist.json is up to date without writing anything")
+	activateCmd.Flags().StringSlice("with", nil, "Also resolve the dependencies in these groups, e.g. --with dev,test")
+	activateCmd.Flags().StringSlice("only", nil, "Only resolve the dependencies in these groups, e.g. --only main")
+	activateCmd.Flags().String("export", "", "Also export the environment: direnv (.envrc), dotenv (.env), or github ($GITHUB_ENV)")
+
+	var execCmd = &cobra.Command{
+		Use:          "exec [--] <command> [<args>...]",
+		Short:        "Run a command in the activated environment of the current project",
+		Long:         "Resolve the build list of the project or workspace in the current directory if needed, make its packages available, and run a command in its environment. The messages of cosm go to stderr, and cosm exits with the exit code of the command.",
+		Args:         cobra.MinimumNArgs(1),
+		RunE:         commands.Exec,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	execCmd.Flags().SetInterspersed(false) // Flags after the command belong to the command
+
+	var deactivateCmd = &cobra.Command{
+		Use:          "deactivate",
+		Short:        "Print the shell statements that deactivate the active environment",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Deactivate,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
 
 	// initCmd initializes a new project
 	var initCmd = &cobra.Command{
 		Use:          "init <package-name> [version]",
 		Short:        "Initialize a new project",
-		Args:         cobra.RangeArgs(1, 2),
+		Args:         cobra.RangeArgs(0, 2), // The package name is optional with --from-git
 		RunE:         commands.Init,
 		SilenceUsage: true,
 	}
-	initCmd.Flags().StringP("version", "v", "", "Version of the project (default: v0.1.0)")
+	initCmd.Flags().String("version", "", "Version of the project (default: v0.1.0)")
 	initCmd.Flags().StringP("language", "l", "", "Language of the project (not allowed with --template)")
+	initCmd.Flags().String("from-git", "", "Clone an existing repository and create its Project.json, with the version of its latest release tag")
 	initCmd.Flags().StringP("template", "t", "", "Path to template directory (relative to .cosm/templates/, e.g., go/mytemplate)")
+	initCmd.Flags().String("format", "json", "Format of the project manifest: json for Project.json or toml for cosm.toml")
 
 	var addCmd = &cobra.Command{
-		Use:          "add <package_name> [v<version>]",
-		Short:        "Add a dependency to the project",
-		Args:         cobra.RangeArgs(1, 2),
-		RunE:         commands.Add,
-		SilenceUsage: true,
+		Use:               "add <package_name> [v<version>] | <package_name>[@v<version>]... | --path <dir>",
+		Short:             "Add one or more dependencies to the project",
+		Args:              cobra.ArbitraryArgs,
+		RunE:              commands.Add,
+		ValidArgsFunction: commands.CompletePackages,
+		SilenceUsage:      true,
 	}
+	addCmd.Flags().Bool("pre", false, "Consider prerelease versions when no version is given")
+	addCmd.Flags().String("as", "", "Import the dependency under an alias, e.g. to use two major versions side by side")
+	addCmd.Flags().Bool("no-resolve", false, "Do not regenerate the build list in .cosm/buildlist.json")
+	addCmd.Flags().String("group", "", "Add the dependencies to a group, e.g. dev or test, instead of the main group")
+	addCmd.Flags().StringSlice("features", nil, "Enable features of the package, e.g. --features json,async")
+	addCmd.Flags().Bool("optional", false, "Add the dependencies as optional; dependents only resolve them if a feature of the project enables them")
+	addCmd.Flags().StringSlice("platform", nil, "Restrict the dependencies to platforms <os> or <os>/<arch>, e.g. --platform linux,darwin/arm64")
+	addCmd.Flags().String("path", "", "Add the package in a local directory as a path dependency")
+	addCmd.Flags().String("sha", "", "Pin the dependency to a commit instead of the release, e.g. for an unreleased fix")
+	addCmd.Flags().Bool("refresh", false, "Pull the registries even if they were pulled within the refreshinterval")
 
-	var rmCmd = &cobra.Command{
-		Use:          "rm [name]",
-		Short:        "Remove a dependency from the project",
-		Args:         cobra.ExactArgs(1),
-		RunE:         commands.Rm,
+	var importCmd = &cobra.Command{
+		Use:          "import --from <manifest>",
+		Short:        "Add the dependencies in a go.mod, package.json or requirements.txt that are in the registries",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Import,
 		SilenceUsage: true, // Prevent usage output in stderr
 	}
+	importCmd.Flags().String("from", "", "Manifest to import: a go.mod, package.json or requirements.txt file")
+	importCmd.Flags().Bool("dry-run", false, "Report the dependencies that would be imported without changing Project.json")
+	importCmd.Flags().Bool("no-resolve", false, "Do not regenerate the build list in .cosm/buildlist.json")
+
+	var rmCmd = &cobra.Command{
+		Use:               "rm <name>... | --unused",
+		Short:             "Remove dependencies from the project",
+		RunE:              commands.Rm,
+		ValidArgsFunction: commands.CompleteDependencyNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	rmCmd.Flags().Bool("unused", false, "Remove the dependencies that no source file imports")
+	rmCmd.Flags().Bool("no-resolve", false, "Do not regenerate the build list in .cosm/buildlist.json")
 
 	var releaseCmd = &cobra.Command{
 		Use:          "release [v<version>]",
@@ -132,37 +407,122 @@ func main() {
 	releaseCmd.Flags().Bool("patch", false, "Increment the patch version")
 	releaseCmd.Flags().Bool("minor", false, "Increment the minor version")
 	releaseCmd.Flags().Bool("major", false, "Increment the major version")
-	releaseCmd.Flags().String("registry", "", "Specify a registry to release to")
+	releaseCmd.Flags().StringSlice("registry", nil, "Specify a registry to release to (repeatable)")
+	releaseCmd.Flags().String("register", "", "Register the package in a registry that does not contain it yet, with all its versions")
+	releaseCmd.Flags().String("package", "", "Release the package in this subdirectory of a monorepo (tagged as <name>/v<version>)")
+	releaseCmd.Flags().Bool("dry-run", false, "Validate the release and print the planned actions without executing them")
+	releaseCmd.Flags().Bool("force", false, "Publish to the registries even if you are not a maintainer of the package")
+	releaseCmd.Flags().Bool("allow-path-deps", false, "Release even if the project has path dependencies; they are published as their recorded versions")
+	releaseCmd.Flags().String("notes", "", "Release notes, stored in an annotated release tag and in the registries")
+	releaseCmd.Flags().String("notes-file", "", "Read the release notes from a file")
+	releaseCmd.Flags().String("branch", "", "Release from this branch instead of the default branch of origin")
+	releaseCmd.Flags().Bool("sign", false, "Create a signed release tag with the signing key of the Git configuration")
+	releaseCmd.Flags().Bool("skip-checks", false, "Release without running the build, test and lint checks of Project.json")
+	releaseCmd.Flags().Bool("strict", false, "Refuse to release if dependencies are pinned to commits instead of releases")
 
 	var developCmd = &cobra.Command{
-		Use:   "develop [package-name]",
-		Short: "Switch an existing dependency to development mode",
-		Args:  cobra.ExactArgs(1),
-		Run:   commands.Develop,
+		Use:               "develop [package-name]",
+		Short:             "Switch an existing dependency to development mode",
+		Args:              cobra.ExactArgs(1),
+		Run:               commands.Develop,
+		ValidArgsFunction: commands.CompleteDependencies,
 	}
 
 	var freeCmd = &cobra.Command{
-		Use:   "free [package-name]",
-		Short: "Close development mode for an existing dependency",
-		Args:  cobra.ExactArgs(1),
-		Run:   commands.Free,
+		Use:               "free [package-name]",
+		Short:             "Close development mode for an existing dependency",
+		Args:              cobra.ExactArgs(1),
+		Run:               commands.Free,
+		ValidArgsFunction: commands.CompleteDependencies,
 	}
 
 	var upgradeCmd = &cobra.Command{
-		Use:   "upgrade [name] [v<version>]",
-		Short: "Upgrade a dependency or all dependencies",
-		Args:  cobra.RangeArgs(0, 2),
-		Run:   commands.Upgrade,
+		Use:               "upgrade [name] [v<version>]",
+		Short:             "Upgrade a dependency or all dependencies",
+		Args:              cobra.RangeArgs(0, 2),
+		RunE:              commands.Upgrade,
+		ValidArgsFunction: commands.CompleteDependencies,
+		SilenceUsage:      true,
 	}
 	upgradeCmd.Flags().Bool("all", false, "Upgrade all direct dependencies")
 	upgradeCmd.Flags().Bool("latest", false, "Use the latest version instead of the latest compatible version")
+	upgradeCmd.Flags().Bool("pre", false, "Consider prerelease versions")
 
 	var downgradeCmd = &cobra.Command{
-		Use:   "downgrade [name] v<version>",
-		Short: "Downgrade a dependency to an older version",
-		Args:  cobra.ExactArgs(2),
-		Run:   commands.Downgrade,
+		Use:               "downgrade [name] v<version>",
+		Short:             "Downgrade a dependency to an older version",
+		Args:              cobra.ExactArgs(2),
+		Run:               commands.Downgrade,
+		ValidArgsFunction: commands.CompleteDependencies,
+	}
+
+	var undoCmd = &cobra.Command{
+		Use:          "undo",
+		Short:        "Revert the last operation recorded in the journal",
+		Long:         "Revert the last operation that changed Project.json, Workspace.json or config.json, by restoring the files from the journal in logs/journal.jsonl of the depot. Running undo again reverts the operation before it. Operations that committed to Git, such as releases, or that changed a registry cannot be undone.",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Undo,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	undoCmd.Flags().Bool("list", false, "List the operations in the journal instead")
+	undoCmd.Flags().Bool("force", false, "Restore the files even if they were changed after the operation")
+
+	var verifyCmd = &cobra.Command{
+		Use:               "verify <package name>@v<version>",
+		Short:             "Verify the registry signature and tag SHA1 of a package version",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.Verify,
+		ValidArgsFunction: commands.CompletePackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	verifyCmd.Flags().String("registry", "", "Only look for the package in this registry")
+
+	var searchCmd = &cobra.Command{
+		Use:          "search <pattern>",
+		Short:        "Search the local registries for packages by name",
+		Args:         cobra.ExactArgs(1),
+		RunE:         commands.Search,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	searchCmd.Flags().String("registry", "", "Only search this registry")
+	searchCmd.Flags().Bool("regex", false, "Interpret the pattern as a regular expression")
+	searchCmd.Flags().Bool("json", false, "Print the results as JSON")
+	addListingFlags(searchCmd)
+
+	var infoCmd = &cobra.Command{
+		Use:               "info <package_name>[@v<version>]",
+		Short:             "Print the details of a package and the local projects that use it",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.Info,
+		ValidArgsFunction: commands.CompletePackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	infoCmd.Flags().String("registry", "", "Only look for the package in this registry")
+	infoCmd.Flags().Bool("json", false, "Print the details as JSON")
+
+	var diffCmd = &cobra.Command{
+		Use:               "diff <package_name> v<version> v<version>",
+		Short:             "Show the changes between two registered versions of a package",
+		Args:              cobra.ExactArgs(3),
+		RunE:              commands.Diff,
+		ValidArgsFunction: commands.CompletePackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	diffCmd.Flags().String("registry", "", "Only look for the package in this registry")
+	diffCmd.Flags().Bool("deps", false, "Only compare the dependencies in the specs of the versions")
+	diffCmd.Flags().Bool("stat", false, "Show a summary of the changed files instead of the full diff")
+	diffCmd.Flags().Bool("no-changelog", false, "Do not show the changelog sections of the versions in between")
+
+	var cloneCmd = &cobra.Command{
+		Use:               "clone <package_name>[@v<version>] [dir]",
+		Short:             "Clone the source of a registered package at a released version",
+		Args:              cobra.RangeArgs(1, 2),
+		RunE:              commands.Clone,
+		ValidArgsFunction: commands.CompleteClone,
+		SilenceUsage:      true, // Prevent usage output in stderr
 	}
+	cloneCmd.Flags().String("registry", "", "Only look for the package in this registry")
+	cloneCmd.Flags().Bool("pre", false, "Consider prerelease versions when no version is given")
 
 	var registryCmd = &cobra.Command{
 		Use:   "registry",
@@ -173,12 +533,26 @@ func main() {
 	}
 
 	var registryStatusCmd = &cobra.Command{
-		Use:          "status [registry-name]",
-		Short:        "Print an overview of packages in a registry",
-		Args:         cobra.ExactArgs(1),
-		RunE:         commands.RegistryStatus, // Changed from Run to RunE
-		SilenceUsage: true,                    // Prevent usage output in stderr
+		Use:               "status [registry-name]",
+		Short:             "Print an overview of packages in a registry",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryStatus, // Changed from Run to RunE
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	registryStatusCmd.Flags().String("package", "", "Show the full version history of this package")
+	registryStatusCmd.Flags().Bool("json", false, "Print the status as JSON")
+	addListingFlags(registryStatusCmd)
+
+	var registryIndexCmd = &cobra.Command{
+		Use:               "index [registry-name]",
+		Short:             "Write a static HTML and JSON index of the packages in a registry",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryIndex,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
 	}
+	registryIndexCmd.Flags().StringP("output", "o", "", "Directory to write the index to (default <registry name>-index)")
 
 	var registryInitCmd = &cobra.Command{
 		Use:          "init [registry-name] [giturl]",
@@ -195,65 +569,604 @@ func main() {
 		RunE:         commands.RegistryClone,
 		SilenceUsage: true, // Prevent usage output in stderr
 	}
+	registryCloneCmd.Flags().Bool("sparse", false, "Check out only registry.json, and packages when they are first used")
+	registryCloneCmd.Flags().Bool("read-only", false, "Mark the registry as read-only, so that cosm does not modify it")
+
+	var registryProtectCmd = &cobra.Command{
+		Use:               "protect <registry name>",
+		Short:             "Mark a registry as read-only",
+		Long:              "Mark a registry as read-only in the depot, so that 'cosm registry add', 'rm', 'unyank' and 'import' and 'cosm release --registry' refuse to modify it. Use this for local clones of shared registries that you do not publish to.",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryProtect,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryUnprotectCmd = &cobra.Command{
+		Use:               "unprotect <registry name>",
+		Short:             "Allow changes to a read-only registry",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryUnprotect,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
 
 	var registryDeleteCmd = &cobra.Command{
-		Use:          "delete [registry-name]",
-		Short:        "Delete a registry",
-		Args:         cobra.ExactArgs(1),
-		RunE:         commands.RegistryDelete,
-		SilenceUsage: true, // Prevent usage output in stderr
+		Use:               "delete [registry-name]",
+		Short:             "Delete a registry",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryDelete,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
 	}
 	registryDeleteCmd.Flags().BoolP("force", "f", false, "Force deletion of the registry")
 
 	var registryUpdateCmd = &cobra.Command{
-		Use:          "update [registry-name | --all]",
-		Short:        "Update and synchronize a registry with its remote",
-		Args:         cobra.MaximumNArgs(1),
-		RunE:         commands.RegistryUpdate,
-		SilenceUsage: true, // Prevent usage output in stderr
+		Use:               "update [registry-name | --all]",
+		Short:             "Update and synchronize a registry with its remote",
+		Args:              cobra.MaximumNArgs(1),
+		RunE:              commands.RegistryUpdate,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
 	}
 	registryUpdateCmd.Flags().Bool("all", false, "Update all registries")
 
+	var registryDiffCmd = &cobra.Command{
+		Use:               "diff <registry name>",
+		Short:             "Show the packages and versions committed to a registry but not pushed",
+		Long:              "Show the packages and versions added to or removed from a registry by local commits that are not pushed to origin. With 'cosm config set stageregistry true', registry changes are committed locally and only published by 'cosm registry push'.",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryDiff,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryPushCmd = &cobra.Command{
+		Use:               "push <registry name>",
+		Short:             "Publish the staged changes of a registry",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryPush,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryDiscardCmd = &cobra.Command{
+		Use:               "discard <registry name>",
+		Short:             "Reset a registry to origin, dropping its staged changes",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryDiscard,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	registryDiscardCmd.Flags().BoolP("force", "f", false, "Discard the changes without confirmation")
+
 	var registryAddCmd = &cobra.Command{
-		Use:   "add <registry name> <package giturl> | <registry name> <package name> <version>",
+		Use:   "add <registry name> <package giturl> | <registry name> <package name> <version> | <registry name> --path <dir>",
 		Short: "Add a package or a specific version to a registry",
-		Args:  cobra.RangeArgs(2, 3), // Allow 2 or 3 arguments
+		Args:  cobra.RangeArgs(1, 3), // Allow 1 (with --path), 2 or 3 arguments
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return commands.RegistryAdd(cmd, args)
 		},
-		SilenceUsage: true, // Prevent usage output in stderr
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
 	}
+	registryAddCmd.Flags().String("path", "", "Register a package from a local Git working directory")
+	registryAddCmd.Flags().String("subdir", "", "Subdirectory of the package within a monorepo, which may be a submodule")
+	// --package is the older name of --subdir
+	registryAddCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "package" {
+			name = "subdir"
+		}
+		return pflag.NormalizedName(name)
+	})
+	registryAddCmd.Flags().Bool("shallow", false, "Clone only the tagged commits of the package instead of its full history")
+	registryAddCmd.Flags().Bool("force", false, "Add the version even if you are not a maintainer of the package")
+	registryAddCmd.Flags().String("batch", "", "Add the packages whose git URLs are listed in a file, one per line, with a single commit and push")
 
 	var registryRmCmd = &cobra.Command{
-		Use:          "rm [registry-name] [package-name] [v<version>]",
-		Short:        "Remove a package or version from a registry",
-		Args:         cobra.RangeArgs(2, 3),
-		RunE:         commands.RegistryRm,
-		SilenceUsage: true, // Prevent usage output in stderr
+		Use:               "rm [registry-name] [package-name] [v<version>]",
+		Short:             "Remove a package or version from a registry",
+		Args:              cobra.RangeArgs(2, 3),
+		RunE:              commands.RegistryRm,
+		ValidArgsFunction: commands.CompleteRegistryVersions,
+		SilenceUsage:      true, // Prevent usage output in stderr
 	}
 	registryRmCmd.Flags().BoolP("force", "f", false, "Force removal of the package or version")
+	registryRmCmd.Flags().Bool("yank", false, "Mark the version as yanked instead of deleting it")
+
+	var registryUnyankCmd = &cobra.Command{
+		Use:               "unyank [registry-name] [package-name] [v<version>]",
+		Short:             "Make a yanked version available to new dependencies again",
+		Args:              cobra.ExactArgs(3),
+		RunE:              commands.RegistryUnyank,
+		ValidArgsFunction: commands.CompleteRegistryVersions,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryImportCmd = &cobra.Command{
+		Use:               "import <registry name> <source registry name> <package name> [v<version>...]",
+		Short:             "Copy a package from another registry",
+		Long:              "Copy a package with all its versions, or the given versions, from another local registry, e.g. to promote it from a staging registry to a production registry. The specs are copied, and the build lists and dependents are recomputed for the registry the package is imported into.",
+		Args:              cobra.MinimumNArgs(3),
+		RunE:              commands.RegistryImport,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryRdepsCmd = &cobra.Command{
+		Use:               "rdeps [registry-name] [package-name] [v<version>]",
+		Short:             "List the packages in a registry that depend on a package",
+		Args:              cobra.RangeArgs(2, 3),
+		RunE:              commands.RegistryRdeps,
+		ValidArgsFunction: commands.CompleteRegistryVersions,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	registryRdepsCmd.Flags().Bool("json", false, "Print the dependents as JSON")
+
+	var workspaceCmd = &cobra.Command{
+		Use:   "workspace",
+		Short: "Manage workspaces of local projects",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Workspace command requires a subcommand (e.g., 'init', 'add', 'status').")
+		},
+	}
+
+	var workspaceInitCmd = &cobra.Command{
+		Use:          "init [workspace-name]",
+		Short:        "Initialize a workspace in the current directory",
+		Args:         cobra.MaximumNArgs(1),
+		RunE:         commands.WorkspaceInit,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var workspaceAddCmd = &cobra.Command{
+		Use:          "add [project-dir]",
+		Short:        "Add a local project to the workspace",
+		Args:         cobra.ExactArgs(1),
+		RunE:         commands.WorkspaceAdd,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var workspaceStatusCmd = &cobra.Command{
+		Use:          "status",
+		Short:        "Print an overview of the workspace members",
+		Args:         cobra.NoArgs,
+		RunE:         commands.WorkspaceStatus,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var registryAuditCmd = &cobra.Command{
+		Use:               "audit [registry-name]",
+		Short:             "Check a registry for inconsistencies",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryAudit,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	registryAuditCmd.Flags().Bool("fix", false, "Repair the problems that were found")
+
+	var registryMirrorCmd = &cobra.Command{
+		Use:   "mirror",
+		Short: "Manage mirror URLs of a registry or package",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Mirror command requires a subcommand (e.g., 'add', 'rm', 'list').")
+		},
+	}
+
+	var registryMirrorAddCmd = &cobra.Command{
+		Use:               "add [registry-name] [package-name] [url]",
+		Short:             "Add a mirror URL to a registry or package",
+		Args:              cobra.RangeArgs(2, 3),
+		RunE:              commands.RegistryMirrorAdd,
+		ValidArgsFunction: commands.CompleteRegistryPackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryMirrorRmCmd = &cobra.Command{
+		Use:               "rm [registry-name] [package-name] [url]",
+		Short:             "Remove a mirror URL from a registry or package",
+		Args:              cobra.RangeArgs(2, 3),
+		RunE:              commands.RegistryMirrorRm,
+		ValidArgsFunction: commands.CompleteRegistryPackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryMirrorListCmd = &cobra.Command{
+		Use:               "list [registry-name] [package-name]",
+		Short:             "List the mirror URLs of a registry or package",
+		Args:              cobra.RangeArgs(1, 2),
+		RunE:              commands.RegistryMirrorList,
+		ValidArgsFunction: commands.CompleteRegistryPackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryWebhookCmd = &cobra.Command{
+		Use:   "webhook",
+		Short: "Manage the URLs notified when a version is published to a registry",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Webhook command requires a subcommand (e.g., 'add', 'rm', 'list').")
+		},
+	}
+
+	var registryWebhookAddCmd = &cobra.Command{
+		Use:               "add [registry-name] [url]",
+		Short:             "Add a webhook to a registry",
+		Args:              cobra.ExactArgs(2),
+		RunE:              commands.RegistryWebhookAdd,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryWebhookRmCmd = &cobra.Command{
+		Use:               "rm [registry-name] [url]",
+		Short:             "Remove a webhook from a registry",
+		Args:              cobra.ExactArgs(2),
+		RunE:              commands.RegistryWebhookRm,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryWebhookListCmd = &cobra.Command{
+		Use:               "list [registry-name]",
+		Short:             "List the webhooks of a registry",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.RegistryWebhookList,
+		ValidArgsFunction: commands.CompleteRegistryNames,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var registryOwnerCmd = &cobra.Command{
+		Use:   "owner",
+		Short: "Manage the maintainers of a package in a registry",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Owner command requires a subcommand (e.g., 'add', 'rm', 'list').")
+		},
+	}
+
+	var registryOwnerAddCmd = &cobra.Command{
+		Use:               "add [registry-name] [package-name] [author]",
+		Short:             "Add a maintainer ([name]email) to a package",
+		Args:              cobra.ExactArgs(3),
+		RunE:              commands.RegistryOwnerAdd,
+		ValidArgsFunction: commands.CompleteRegistryPackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	registryOwnerAddCmd.Flags().Bool("force", false, "Add the maintainer even if you are not a maintainer of the package")
+
+	var registryOwnerRmCmd = &cobra.Command{
+		Use:               "rm [registry-name] [package-name] [author]",
+		Short:             "Remove a maintainer from a package",
+		Args:              cobra.ExactArgs(3),
+		RunE:              commands.RegistryOwnerRm,
+		ValidArgsFunction: commands.CompleteRegistryPackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+	registryOwnerRmCmd.Flags().Bool("force", false, "Remove the maintainer even if you are not a maintainer of the package")
+
+	var registryOwnerListCmd = &cobra.Command{
+		Use:               "list [registry-name] [package-name]",
+		Short:             "List the maintainers of a package",
+		Args:              cobra.ExactArgs(2),
+		RunE:              commands.RegistryOwnerList,
+		ValidArgsFunction: commands.CompleteRegistryPackages,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var vendorCmd = &cobra.Command{
+		Use:          "vendor",
+		Short:        "Copy all dependencies of the project into vendor/",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Vendor,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var sbomCmd = &cobra.Command{
+		Use:          "sbom",
+		Short:        "Print a software bill of materials of the build list",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Sbom,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	sbomCmd.Flags().String("format", "cyclonedx", "SBOM format: cyclonedx or spdx")
+	sbomCmd.Flags().StringP("output", "o", "", "Write the SBOM to this file instead of stdout")
+
+	var auditCmd = &cobra.Command{
+		Use:          "audit",
+		Short:        "Check the build list against the advisories of all registries",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Audit,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var licensesCmd = &cobra.Command{
+		Use:          "licenses",
+		Short:        "Print the licenses of the build list and check them against a policy",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Licenses,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	licensesCmd.Flags().StringSlice("allow", nil, "Licenses that are allowed; other and unknown licenses are violations")
+	licensesCmd.Flags().StringSlice("deny", nil, "Licenses that are violations")
+	licensesCmd.Flags().Bool("json", false, "Print the licenses as JSON")
+
+	var whichCmd = &cobra.Command{
+		Use:               "which [<package>]",
+		Short:             "Print the path of a dependency in the build list",
+		Args:              cobra.MaximumNArgs(1),
+		RunE:              commands.Which,
+		SilenceUsage:      true, // Prevent usage output in stderr
+		ValidArgsFunction: commands.CompleteDependencyNames,
+	}
+	whichCmd.Flags().Bool("all", false, "Print the paths of all dependencies")
+
+	var daemonCmd = &cobra.Command{
+		Use:          "daemon",
+		Short:        "Keep registries and packages warm and serve a JSON-RPC API on a Unix socket",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Daemon,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	daemonCmd.Flags().String("socket", "", "Path of the Unix socket (default <depot>/daemon.sock)")
+	daemonCmd.Flags().Duration("interval", 5*time.Minute, "Interval between registry updates")
+	daemonCmd.Flags().Duration("poll", 2*time.Second, "Interval between checks of the watched Project.json files")
+
+	var templateCmd = &cobra.Command{
+		Use:   "template",
+		Short: "Manage the template repositories used by cosm init",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Template command requires a subcommand (e.g., 'list', 'add', 'update', 'remove').")
+		},
+	}
+
+	var templateListCmd = &cobra.Command{
+		Use:          "list",
+		Short:        "List the templates of all template sources",
+		Args:         cobra.NoArgs,
+		RunE:         commands.TemplateList,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var templateAddCmd = &cobra.Command{
+		Use:          "add [giturl]",
+		Short:        "Add a template repository",
+		Args:         cobra.ExactArgs(1),
+		RunE:         commands.TemplateAdd,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	templateAddCmd.Flags().String("name", "", "Name of the template source (default: repository name)")
+
+	var templateUpdateCmd = &cobra.Command{
+		Use:               "update [name]",
+		Short:             "Pull the latest templates of one or all template sources",
+		Args:              cobra.MaximumNArgs(1),
+		RunE:              commands.TemplateUpdate,
+		ValidArgsFunction: commands.CompleteTemplateSources,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var templateRemoveCmd = &cobra.Command{
+		Use:               "remove [name]",
+		Short:             "Remove a template repository",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.TemplateRemove,
+		ValidArgsFunction: commands.CompleteTemplateSources,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateAddCmd)
+	templateCmd.AddCommand(templateUpdateCmd)
+	templateCmd.AddCommand(templateRemoveCmd)
+
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the global configuration in the depot",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Config command requires a subcommand (e.g., 'list', 'get', 'set').")
+		},
+	}
+
+	var configListCmd = &cobra.Command{
+		Use:          "list",
+		Short:        "List all settings with their effective values",
+		Args:         cobra.NoArgs,
+		RunE:         commands.ConfigList,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var configGetCmd = &cobra.Command{
+		Use:               "get [key]",
+		Short:             "Print the effective value of a setting",
+		Args:              cobra.ExactArgs(1),
+		RunE:              commands.ConfigGet,
+		ValidArgsFunction: commands.CompleteConfigKeys,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	var configSetCmd = &cobra.Command{
+		Use:               "set [key] [value]",
+		Short:             "Store a setting in the configuration (an empty value restores the default)",
+		Args:              cobra.ExactArgs(2),
+		RunE:              commands.ConfigSet,
+		ValidArgsFunction: commands.CompleteConfigKeys,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	}
+
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+
+	var doctorCmd = &cobra.Command{
+		Use:          "doctor",
+		Short:        "Diagnose problems with git, the depot and the registries",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Doctor,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cached package versions and clones in the depot",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Cache command requires a subcommand (e.g., 'info', 'clean', 'verify').")
+		},
+	}
+
+	var cacheInfoCmd = &cobra.Command{
+		Use:          "info",
+		Short:        "Show the disk usage of cached packages and clones",
+		Args:         cobra.NoArgs,
+		RunE:         commands.CacheInfo,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+
+	var cacheCleanCmd = &cobra.Command{
+		Use:          "clean",
+		Short:        "Remove old or unused cached packages and clones",
+		Args:         cobra.NoArgs,
+		RunE:         commands.CacheClean,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	cacheCleanCmd.Flags().Int("older-than", 0, "Remove entries not modified in this many days")
+	cacheCleanCmd.Flags().Bool("unused", false, "Remove entries not used by any activated project")
+
+	var cacheVerifyCmd = &cobra.Command{
+		Use:          "verify",
+		Short:        "Verify cached packages against their recorded SHA1",
+		Args:         cobra.NoArgs,
+		RunE:         commands.CacheVerify,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	cacheVerifyCmd.Flags().Bool("fix", false, "Remove cached packages that do not match their SHA1")
+
+	var cacheArchiveCmd = &cobra.Command{
+		Use:          "archive",
+		Short:        "Archive the packages in the build list, e.g. for an artifact store",
+		RunE:         commands.CacheArchive,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	cacheArchiveCmd.Flags().Bool("upload", false, "Upload the archives to the artifact store set with archiveurl")
+
+	cacheCmd.AddCommand(cacheInfoCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+	cacheCmd.AddCommand(cacheVerifyCmd)
+	cacheCmd.AddCommand(cacheArchiveCmd)
+
+	registryMirrorCmd.AddCommand(registryMirrorAddCmd)
+	registryMirrorCmd.AddCommand(registryMirrorRmCmd)
+	registryMirrorCmd.AddCommand(registryMirrorListCmd)
+
+	registryWebhookCmd.AddCommand(registryWebhookAddCmd)
+	registryWebhookCmd.AddCommand(registryWebhookRmCmd)
+	registryWebhookCmd.AddCommand(registryWebhookListCmd)
+
+	registryOwnerCmd.AddCommand(registryOwnerAddCmd)
+	registryOwnerCmd.AddCommand(registryOwnerRmCmd)
+	registryOwnerCmd.AddCommand(registryOwnerListCmd)
 
 	registryCmd.AddCommand(registryStatusCmd)
+	registryCmd.AddCommand(registryIndexCmd)
 	registryCmd.AddCommand(registryInitCmd)
 	registryCmd.AddCommand(registryCloneCmd)
+	registryCmd.AddCommand(registryProtectCmd)
+	registryCmd.AddCommand(registryUnprotectCmd)
 	registryCmd.AddCommand(registryDeleteCmd)
 	registryCmd.AddCommand(registryUpdateCmd)
+	registryCmd.AddCommand(registryDiffCmd)
+	registryCmd.AddCommand(registryPushCmd)
+	registryCmd.AddCommand(registryDiscardCmd)
 	registryCmd.AddCommand(registryAddCmd)
 	registryCmd.AddCommand(registryRmCmd)
+	registryCmd.AddCommand(registryUnyankCmd)
+	registryCmd.AddCommand(registryImportCmd)
+	registryCmd.AddCommand(registryAuditCmd)
+	registryCmd.AddCommand(registryRdepsCmd)
+	registryCmd.AddCommand(registryMirrorCmd)
+	registryCmd.AddCommand(registryWebhookCmd)
+	registryCmd.AddCommand(registryOwnerCmd)
+
+	workspaceCmd.AddCommand(workspaceInitCmd)
+	workspaceCmd.AddCommand(workspaceAddCmd)
+	workspaceCmd.AddCommand(workspaceStatusCmd)
 
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(activateCmd)
+	rootCmd.AddCommand(deactivateCmd)
+	rootCmd.AddCommand(execCmd)
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(importCmd)
 	rootCmd.AddCommand(rmCmd)
 	rootCmd.AddCommand(releaseCmd)
 	rootCmd.AddCommand(developCmd)
 	rootCmd.AddCommand(freeCmd)
 	rootCmd.AddCommand(upgradeCmd)
 	rootCmd.AddCommand(downgradeCmd)
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(cloneCmd)
 	rootCmd.AddCommand(registryCmd)
+	rootCmd.AddCommand(workspaceCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(templateCmd)
+	rootCmd.AddCommand(vendorCmd)
+	rootCmd.AddCommand(sbomCmd)
+	rootCmd.AddCommand(licensesCmd)
+	rootCmd.AddCommand(whichCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(auditCmd)
+
+	var completionCmd = &cobra.Command{
+		Use:          "completion bash|zsh|fish|powershell",
+		Short:        "Generate the shell completion script",
+		Long:         "Generate the shell completion script, e.g. 'source <(cosm completion bash)' in ~/.bashrc, 'cosm completion zsh > \"${fpath[1]}/_cosm\"' or 'cosm completion fish > ~/.config/fish/completions/cosm.fish'.",
+		Args:         cobra.ExactArgs(1),
+		ValidArgs:    []string{"bash", "zsh", "fish", "powershell"},
+		RunE:         commands.Completion,
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	rootCmd.CompletionOptions.DisableDefaultCmd = true // Replaced by completionCmd
+	rootCmd.AddCommand(completionCmd)
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1) // Remove manual error printing, let Cobra handle it
+	rootCmd.SetHelpCommand(&cobra.Command{
+		Use:               "help [topic|command]",
+		Short:             "Help about a command or topic",
+		Long:              "Help about a command, or a long-form help topic about cosm; 'cosm help topics' lists the topics.",
+		RunE:              commands.Help,
+		ValidArgsFunction: commands.CompleteHelpTopics,
+		SilenceUsage:      true, // Prevent usage output in stderr
+	})
+
+	var manCmd = &cobra.Command{
+		Use:          "man",
+		Short:        "Generate man pages",
+		Long:         "Generate a man page for every command (section 1) and help topic (section 7), e.g. for installation into /usr/local/share/man.",
+		Args:         cobra.NoArgs,
+		RunE:         commands.Man,
+		Hidden:       true, // Used by go generate and packaging
+		SilenceUsage: true, // Prevent usage output in stderr
+	}
+	manCmd.Flags().String("dir", "man", "Directory to write the man pages to")
+	rootCmd.AddCommand(manCmd)
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &commands.Error{Kind: commands.KindValidation, Err: err}
+	})
+
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	commands.FinishOperation(err)
+	commands.RemoveTempDirs()
+	if err != nil {
+		// A command run by cosm exec has reported its failure itself
+		var statusErr *commands.ExitStatusError
+		if !errors.As(err, &statusErr) {
+			reportError(cmd, err)
+		}
+		os.Exit(commands.ExitCode(err))
 	}
 }
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"cosm/commands"
 	"cosm/types"
@@ -83,6 +93,148 @@ func TestInit(t *testing.T) {
 	initPackage(t, tempDir, packageName2, "v1.0.0")
 }
 
+func TestInitLanguage(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Provide a default template for lua
+	templateDir := filepath.Join(tempDir, ".cosm", "templates", "lua", "default", "src")
+	if err := os.MkdirAll(templateDir, 0755); err != nil {
+		t.Fatalf("Failed to create template dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "default.lua"), []byte("return 'default'\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template file: %v", err)
+	}
+
+	// The default template of the language is copied into the project
+	luaDir := filepath.Join(tempDir, "luapkg")
+	if err := os.Mkdir(luaDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	stdout, stderr, err := runCommand(t, luaDir, "init", "luapkg", "--language", "Lua")
+	checkOutput(t, stdout, stderr, "Created source layout from template 'lua/default'\nInitialized project 'luapkg' with version v0.1.0\n", err, false, 0)
+	data, err := os.ReadFile(filepath.Join(luaDir, "src", "luapkg.lua"))
+	if err != nil || string(data) != "return 'luapkg'\n" {
+		t.Errorf("Expected scaffolded src/luapkg.lua, got %q (err: %v)", data, err)
+	}
+	if project := loadProjectFile(t, filepath.Join(luaDir, "Project.json")); project.Language != "lua" {
+		t.Errorf("Expected language 'lua', got %q", project.Language)
+	}
+
+	// Without a default template a minimal source layout is created
+	pythonDir := filepath.Join(tempDir, "pypkg")
+	if err := os.Mkdir(pythonDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	stdout, stderr, err = runCommand(t, pythonDir, "init", "pypkg", "--language", "python")
+	if err != nil || !strings.HasPrefix(stderr, "Warning: no default template found") {
+		t.Errorf("Expected a warning about the missing template, got %q (err: %v)\nStdout: %s", stderr, err, stdout)
+	}
+	if _, err := os.Stat(filepath.Join(pythonDir, "src", "pypkg.py")); err != nil {
+		t.Errorf("Expected src/pypkg.py to be created: %v", err)
+	}
+
+	// Test error: unknown language
+	_, stderr, err = runCommand(t, tempDir, "init", "cobolpkg", "--language", "cobol")
+	if err == nil || !strings.Contains(stderr, "unknown language 'cobol'") {
+		t.Errorf("Expected error for an unknown language, got %q (err: %v)", stderr, err)
+	}
+}
+
+func TestProjectTOML(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+
+	// cosm init --format toml creates cosm.toml instead of Project.json
+	projectDir := filepath.Join(tempDir, "tomlpkg")
+	if err := os.Mkdir(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "init", "tomlpkg", "--format", "toml")
+	checkOutput(t, stdout, stderr, "Initialized project 'tomlpkg' with version v0.1.0\n", err, false, 0)
+	manifestFile := filepath.Join(projectDir, "cosm.toml")
+	data, err := os.ReadFile(manifestFile)
+	if err != nil || !strings.Contains(string(data), "name = \"tomlpkg\"\n") {
+		t.Fatalf("Expected cosm.toml with the project name, got %q (err: %v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "Project.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no Project.json, got %v", err)
+	}
+
+	// Commands read and write cosm.toml, and keep its comments
+	if err := os.WriteFile(manifestFile, append([]byte("# Packages of the tomlpkg project\n"), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "add", "pkga@v1.0.0")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added dependency 'pkga' v1.0.0 from registry '%s' to project\n", registryName), err, false, 0)
+	data, err = os.ReadFile(manifestFile)
+	if err != nil || !strings.HasPrefix(string(data), "# Packages of the tomlpkg project\nname = \"tomlpkg\"\n") || !strings.Contains(string(data), "name = \"pkga\"\nversion = \"v1.0.0\"\n") {
+		t.Errorf("Expected cosm.toml with the comment and the dependency, got:\n%s", data)
+	}
+	if buildList := loadBuildList(t, filepath.Join(projectDir, ".cosm", "buildlist.json")); len(buildList.Dependencies) != 1 {
+		t.Errorf("Expected pkga in the build list, got %+v", buildList.Dependencies)
+	}
+
+	// A release updates and commits the version in cosm.toml
+	gitURL := createBareRepo(t, tempDir, "tomlpkg.git")
+	gitOutput(t, projectDir, "init")
+	gitOutput(t, projectDir, "add", ".")
+	gitOutput(t, projectDir, "commit", "-m", "Initial commit")
+	gitOutput(t, projectDir, "branch", "-m", "main")
+	gitOutput(t, projectDir, "remote", "add", "origin", gitURL)
+	gitOutput(t, projectDir, "push", "origin", "main")
+	if _, stderr, err := runCommand(t, projectDir, "release", "--patch"); err != nil {
+		t.Fatalf("Failed to release: %v\nStderr: %s", err, stderr)
+	}
+	if shown := gitOutput(t, projectDir, "show", "HEAD:cosm.toml"); !strings.Contains(shown, "version = \"v0.1.1\"") {
+		t.Errorf("Expected the release commit to contain cosm.toml with v0.1.1, got:\n%s", shown)
+	}
+
+	// A project cannot have both manifests
+	stdout, stderr, err = runCommand(t, projectDir, "init", "tomlpkg")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	stdout, stderr, err = runCommand(t, projectDir, "init", "tomlpkg", "--format", "yaml")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+}
+
+func TestProjectSchemaErrors(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	projectDir := initPackage(t, tempDir, "myproject")
+
+	// A hand-edited Project.json with an invalid dependency version is reported with its position
+	project := `{
+  "name": "myproject",
+  "uuid": "0b6f3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4a",
+  "version": "v0.1.0",
+  "deps": {
+    "0b6f3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4b@v1": {"name": "json", "version": "1.2"}
+  }
+}`
+	if err := os.WriteFile(filepath.Join(projectDir, "Project.json"), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := runCommand(t, projectDir, "activate")
+	if err == nil || !strings.Contains(stderr, "line 6, column 76: field 'deps.0b6f3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4b@v1.version' must be a version v<major>.<minor>.<patch>, not \"1.2\"") {
+		t.Errorf("Expected the position of the invalid version, got %q (err: %v)", stderr, err)
+	}
+
+	// Misspelled fields are reported instead of being ignored
+	project = strings.Replace(project, `"deps"`, `"dependencies"`, 1)
+	if err := os.WriteFile(filepath.Join(projectDir, "Project.json"), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err = runCommand(t, projectDir, "activate")
+	if err == nil || !strings.Contains(stderr, "line 5, column 3: unknown field 'dependencies'") {
+		t.Errorf("Expected the unknown field to be reported, got %q (err: %v)", stderr, err)
+	}
+}
+
 func TestInitDuplicate(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -100,7 +252,7 @@ func TestInitDuplicate(t *testing.T) {
 
 	// Try to initialize again
 	stdout, stderr, err := runCommand(t, packageDir, "init", packageName, "v1.0.0")
-	checkOutput(t, stdout, stderr, "", err, true, 1)
+	checkOutput(t, stdout, stderr, "", err, true, 4) // Conflict
 	expectedStderr := "Error: Project.json already exists in this directory\n"
 	if stderr != expectedStderr {
 		t.Errorf("Expected stderr %q, got %q", expectedStderr, stderr)
@@ -132,12 +284,459 @@ func TestRegistryStatus(t *testing.T) {
 	invalidRegistry := "nonexistent"
 	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", invalidRegistry)
 	expectedStderr := fmt.Sprintf("Error: failed to validate registry '%s': registry '%s' not found in registries.json\n", invalidRegistry, invalidRegistry)
-	checkOutput(t, stdout, stderr, "", err, true, 1)
+	checkOutput(t, stdout, stderr, "", err, true, 3) // Not found
 	if stderr != expectedStderr {
 		t.Errorf("Expected stderr %q, got %q", expectedStderr, stderr)
 	}
 }
 
+// TestRegistryStatusDetail tests the version summary, the version history of a package and JSON output of registry status
+func TestRegistryStatusDetail(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	project := loadProjectFile(t, filepath.Join(packageDir, "Project.json"))
+	if _, _, err := runCommand(t, tempDir, "registry", "rm", registryName, packageName, "v1.1.0", "--yank"); err != nil {
+		t.Fatalf("Failed to yank version: %v", err)
+	}
+	today := time.Now().Format("2006-01-02")
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "status", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Registry Status for '%s':\n  Packages:\n    - %s (UUID: %s), 2 version(s), latest v1.0.0, last published %s\n", registryName, packageName, project.UUID, today), err, false, 0)
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName, "--package", packageName)
+	expected := fmt.Sprintf("Package '%s' in registry '%s':\n  UUID: %s\n  Git URL: %s\n  Versions:\n    - v1.0.0 published %s\n    - v1.1.0 published %s (yanked)\n", packageName, registryName, project.UUID, gitURL, today, today)
+	checkOutput(t, stdout, stderr, expected, err, false, 0)
+
+	if _, _, err := runCommand(t, tempDir, "registry", "status", registryName, "--package", "unknown"); err == nil {
+		t.Errorf("Expected error for a package that is not in the registry")
+	}
+
+	stdout, _, err = runCommand(t, tempDir, "registry", "status", registryName, "--json")
+	if err != nil {
+		t.Fatalf("Failed to get registry status as JSON: %v", err)
+	}
+	var status struct {
+		Name     string `json:"name"`
+		Packages []struct {
+			Name         string `json:"name"`
+			VersionCount int    `json:"versioncount"`
+			Latest       string `json:"latest"`
+			Versions     []struct {
+				Version   string `json:"version"`
+				Published string `json:"published"`
+				Yanked    bool   `json:"yanked"`
+			} `json:"versions"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &status); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	if status.Name != registryName || len(status.Packages) != 1 || status.Packages[0].VersionCount != 2 || status.Packages[0].Latest != "v1.0.0" {
+		t.Fatalf("Unexpected registry status: %+v", status)
+	}
+	versions := status.Packages[0].Versions
+	if len(versions) != 2 || versions[0].Yanked || !versions[1].Yanked || !strings.HasPrefix(versions[1].Published, today) {
+		t.Errorf("Unexpected version history: %+v", versions)
+	}
+}
+
+// TestRegistryIndex tests the static HTML and JSON index of a registry
+func TestRegistryIndex(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.0.0")
+	addDependencyToProject(t, packageDir, "E", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v1.1.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	outputDir := filepath.Join(tempDir, "site")
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "index", registryName, "--output", outputDir)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Wrote index of 2 package(s) in registry '%s' to %s\n", registryName, outputDir), err, false, 0)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.json"))
+	if err != nil {
+		t.Fatalf("Failed to read index.json: %v", err)
+	}
+	var index struct {
+		Name     string `json:"name"`
+		Packages []struct {
+			Name     string `json:"name"`
+			Latest   string `json:"latest"`
+			Versions []struct {
+				Version string `json:"version"`
+				SHA1    string `json:"sha1"`
+				Deps    []struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+				} `json:"deps"`
+			} `json:"versions"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("Failed to parse index.json: %v\n%s", err, data)
+	}
+	if index.Name != registryName || len(index.Packages) != 2 || index.Packages[0].Name != "B" || index.Packages[1].Name != "E" {
+		t.Fatalf("Unexpected index: %+v", index)
+	}
+	b := index.Packages[0]
+	if b.Latest != "v1.0.0" || len(b.Versions) != 1 || len(b.Versions[0].Deps) != 1 || b.Versions[0].Deps[0].Name != "E" || b.Versions[0].Deps[0].Version != "v1.1.0" {
+		t.Errorf("Unexpected index of B: %+v", b)
+	}
+	specs := loadSpecs(t, tempDir, registryName, "E", "v1.1.0")
+	if e := index.Packages[1]; len(e.Versions) != 1 || e.Versions[0].SHA1 != specs.SHA1 {
+		t.Errorf("Unexpected index of E: %+v", e)
+	}
+
+	page, err := os.ReadFile(filepath.Join(outputDir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	for _, expected := range []string{`<h2 id="B">B</h2>`, `<a href="#E">E</a> v1.1.0`, specs.SHA1} {
+		if !strings.Contains(string(page), expected) {
+			t.Errorf("Expected index.html to contain %q:\n%s", expected, page)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, ".nojekyll")); err != nil {
+		t.Errorf("Expected .nojekyll for GitHub Pages: %v", err)
+	}
+}
+
+// TestRegistryRdeps tests the reverse dependency index maintained by registry add, release and registry rm
+func TestRegistryRdeps(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// B v1.0.0 is added with registry add, B v1.1.0 is released to the registry
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.0.0")
+	addDependencyToProject(t, packageDir, "E", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	removeDependencyFromProject(t, packageDir, "E")
+	addDependencyToProject(t, packageDir, "E", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "upgraded E to v1.1.0")
+	if _, stderr, err := runCommand(t, packageDir, "release", "v1.1.0", "--registry", registryName); err != nil {
+		t.Fatalf("Failed to release B v1.1.0: %v\nStderr: %s", err, stderr)
+	}
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "rdeps", registryName, "E")
+	expected := fmt.Sprintf("Packages in registry '%s' that depend on 'E':\n  - B v1.0.0 (requires v1.0.0)\n  - B v1.1.0 (requires v1.1.0)\n", registryName)
+	checkOutput(t, stdout, stderr, expected, err, false, 0)
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rdeps", registryName, "E", "v1.0.0")
+	expected = fmt.Sprintf("Packages in registry '%s' whose build list selects 'E' v1.0.0:\n  - B v1.0.0 (requires v1.0.0)\n", registryName)
+	checkOutput(t, stdout, stderr, expected, err, false, 0)
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rdeps", registryName, "B")
+	expected = fmt.Sprintf("Packages in registry '%s' that depend on 'B':\n  No dependents.\n", registryName)
+	checkOutput(t, stdout, stderr, expected, err, false, 0)
+
+	// Removing a version drops it from the index
+	if _, stderr, err := runCommand(t, tempDir, "registry", "rm", registryName, "B", "v1.0.0", "--force"); err != nil {
+		t.Fatalf("Failed to remove B v1.0.0: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rdeps", registryName, "E", "--json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	var dependents []types.Dependent
+	if err := json.Unmarshal([]byte(stdout), &dependents); err != nil {
+		t.Fatalf("Failed to parse JSON output %q: %v", stdout, err)
+	}
+	specsB := loadSpecs(t, tempDir, registryName, "B", "v1.1.0")
+	if len(dependents) != 1 || dependents[0].Name != "B" || dependents[0].Version != "v1.1.0" || dependents[0].UUID != specsB.UUID {
+		t.Errorf("Expected only B v1.1.0 to depend on E, got %+v", dependents)
+	}
+
+	// A lost index is rebuilt by the audit
+	if err := os.Remove(filepath.Join(tempDir, ".cosm", "registries", registryName, "E", "E", "dependents.json")); err != nil {
+		t.Fatalf("Failed to remove dependents.json: %v", err)
+	}
+	if _, _, err := runCommand(t, tempDir, "registry", "audit", registryName, "--fix"); err != nil {
+		t.Fatalf("Failed to repair registry: %v", err)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rdeps", registryName, "E")
+	expected = fmt.Sprintf("Packages in registry '%s' that depend on 'E':\n  - B v1.1.0 (requires v1.1.0)\n", registryName)
+	checkOutput(t, stdout, stderr, expected, err, false, 0)
+
+	// The backups of the rewritten metadata files stay out of the registry history
+	registryDir := filepath.Join(tempDir, ".cosm", "registries", registryName)
+	if _, err := os.Stat(filepath.Join(registryDir, "registry.json.bak")); err != nil {
+		t.Errorf("Expected a backup of registry.json: %v", err)
+	}
+	if files := gitOutput(t, registryDir, "ls-files"); strings.Contains(files, ".bak") {
+		t.Errorf("Expected no backups in the registry repository, got:\n%s", files)
+	}
+}
+
+// TestRegistryAddBatch tests that the packages of a batch file are added with a single commit
+func TestRegistryAddBatch(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	packageDirA, packageGitURLA := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDirA, "v1.0.0")
+	packageDirB, packageGitURLB := setupPackageWithGit(t, tempDir, "pkgb", "v1.0.0")
+	releasePackage(t, packageDirB, "v1.0.0")
+	missingGitURL := "file://" + filepath.Join(tempDir, "missing.git")
+	batchFile := filepath.Join(tempDir, "packages.txt")
+	content := fmt.Sprintf("# Packages\n%s\n\n%s\n%s\n", packageGitURLA, missingGitURL, packageGitURLB)
+	if err := os.WriteFile(batchFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, "--batch", batchFile)
+	expected := "Added package 'pkga' to registry 'myreg'\nAdded package 'pkgb' to registry 'myreg'\nAdded 2 of 3 packages to registry 'myreg'\n"
+	checkOutput(t, stdout, stderr, expected, err, true, 1)
+	if !strings.Contains(stderr, "failed to add '"+missingGitURL+"'") {
+		t.Errorf("Expected the failed package to be reported, got %q", stderr)
+	}
+	if count := gitOutput(t, registryDir, "rev-list", "--count", "HEAD"); count != "2" {
+		t.Errorf("Expected one commit for the batch after the initial commit, got %s commits", count)
+	}
+	if subject := gitOutput(t, registryDir, "log", "-1", "--format=%s"); subject != "Added packages pkga, pkgb" {
+		t.Errorf("Expected the batch commit, got %q", subject)
+	}
+	if head, origin := gitOutput(t, registryDir, "rev-parse", "HEAD"), gitOutput(t, registryDir, "rev-parse", "origin/main"); head != origin {
+		t.Errorf("Expected the batch to be pushed")
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName)
+	if err != nil || !strings.Contains(stdout, "pkga") || !strings.Contains(stdout, "pkgb") {
+		t.Errorf("Expected both packages in the registry, got %q (err: %v, stderr: %q)", stdout, err, stderr)
+	}
+
+	// Packages that are already registered fail without affecting the others
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "add", registryName, "--batch", batchFile)
+	checkOutput(t, stdout, stderr, "Added 0 of 3 packages to registry 'myreg'\n", err, true, 1)
+	if status := gitOutput(t, registryDir, "status", "--porcelain", "--", ".", ":(exclude)*.bak"); status != "" {
+		t.Errorf("Expected a clean registry, got:\n%s", status)
+	}
+}
+
+// TestRegistryImport tests copying a package between registries
+func TestRegistryImport(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRegistry(t, tempDir, "staging")
+	_, productionDir := setupRegistry(t, tempDir, "production")
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, "staging", packageGitURL)
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "import", "production", "staging", "pkga", "v1.0.0")
+	checkOutput(t, stdout, stderr, "Imported 1 version(s) of package 'pkga' from registry 'staging' to registry 'production': v1.0.0\n", err, false, 0)
+	staged, imported := loadSpecs(t, tempDir, "staging", "pkga", "v1.0.0"), loadSpecs(t, tempDir, "production", "pkga", "v1.0.0")
+	if imported.UUID != staged.UUID || imported.SHA1 != staged.SHA1 || imported.GitURL != staged.GitURL {
+		t.Errorf("Expected the specs to be copied, got %+v instead of %+v", imported, staged)
+	}
+	if _, err := os.Stat(filepath.Join(productionDir, "P", "pkga", "v1.0.0", "buildlist.json")); err != nil {
+		t.Errorf("Expected a build list for the imported version: %v", err)
+	}
+	if subject := gitOutput(t, productionDir, "log", "-1", "--format=%s"); subject != "Imported package pkga v1.0.0 from registry staging" {
+		t.Errorf("Expected the import to be committed, got %q", subject)
+	}
+
+	// Without versions, the versions that are not in the registry yet are imported
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "import", "production", "staging", "pkga")
+	checkOutput(t, stdout, stderr, "Imported 1 version(s) of package 'pkga' from registry 'staging' to registry 'production': v1.1.0\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "import", "production", "staging", "pkga")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "import", "production", "staging", "missing")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "import", "production", "production", "pkga")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+
+	stdout, stderr, err = runCommand(t, tempDir, "info", "pkga", "--registry", "production")
+	if err != nil || !strings.Contains(stdout, "v1.1.0") {
+		t.Errorf("Expected the imported versions in the production registry, got %q (err: %v, stderr: %q)", stdout, err, stderr)
+	}
+}
+
+// TestDiff tests comparing the source and the dependencies of two registered versions of a package
+func TestDiff(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	addDependencyToProject(t, packageDir, "E", "v1.1.0")
+	if err := os.WriteFile(filepath.Join(packageDir, "notes.txt"), []byte("new in v1.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changelog := "# Changelog\n\n## [1.1.0]\n- Depend on E\n\n## [1.0.0]\n- First release\n"
+	if err := os.WriteFile(filepath.Join(packageDir, "CHANGELOG.md"), []byte(changelog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commitAndPushPackageChanges(t, packageDir, "added E and notes")
+	if _, stderr, err := runCommand(t, packageDir, "release", "v1.1.0", "--registry", registryName); err != nil {
+		t.Fatalf("Failed to release B v1.1.0: %v\nStderr: %s", err, stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(tempDir, ".cosm", "registries", registryName, "B", "B", "v1.1.0", "changelog.md")); err != nil || string(data) != "- Depend on E\n" {
+		t.Errorf("Expected the changelog section of v1.1.0 in the registry, got %q (err: %v)", data, err)
+	}
+
+	stdout, stderr, err := runCommand(t, tempDir, "diff", "B", "v1.0.0", "v1.1.0", "--deps")
+	checkOutput(t, stdout, stderr, "Dependencies of 'B' from v1.0.0 to v1.1.0:\n  + E v1.1.0\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "diff", "E", "v1.0.0", "v1.1.0", "--deps")
+	checkOutput(t, stdout, stderr, "The dependencies of 'E' are the same in v1.0.0 and v1.1.0\n", err, false, 0)
+
+	stdout, stderr, err = runCommand(t, tempDir, "diff", "myreg/B", "v1.0.0", "v1.1.0")
+	if err != nil || !strings.HasPrefix(stdout, "Changelog of 'B' v1.1.0:\n- Depend on E\n\n") || !strings.Contains(stdout, "+++ b/notes.txt") || !strings.Contains(stdout, "+new in v1.1.0") {
+		t.Errorf("Expected the changelog and the source diff, got %q (err: %v, stderr: %q)", stdout, err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "diff", "B", "v1.0.0", "v1.1.0", "--stat", "--no-changelog")
+	if err != nil || !strings.Contains(stdout, "files changed") || strings.Contains(stdout, "+new") || strings.Contains(stdout, "Changelog") {
+		t.Errorf("Expected a summary of the changed files, got %q (err: %v, stderr: %q)", stdout, err, stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, tempDir, "diff", "B", "v1.0.0", "v2.0.0")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, tempDir, "diff", "B", "1.0.0", "v1.1.0")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+}
+
+// TestRegistryStaged tests that staged registry changes stay local until they are pushed or discarded
+func TestRegistryStaged(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	packageDirA, packageGitURLA := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDirA, "v1.0.0")
+	packageDirB, packageGitURLB := setupPackageWithGit(t, tempDir, "pkgb", "v1.0.0")
+	releasePackage(t, packageDirB, "v1.0.0")
+	if _, stderr, err := runCommand(t, tempDir, "config", "set", "stageregistry", "true"); err != nil {
+		t.Fatalf("Failed to enable staging: %v\nStderr: %s", err, stderr)
+	}
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "diff", registryName)
+	checkOutput(t, stdout, stderr, "Registry 'myreg' has no unpushed changes\n", err, false, 0)
+
+	stdout, _ = addPackageToRegistry(t, tempDir, registryName, packageGitURLA)
+	if !strings.Contains(stdout, "Staged the changes to registry 'myreg'; publish them with 'cosm registry push myreg'") {
+		t.Errorf("Expected the changes to be staged, got %q", stdout)
+	}
+	if head, origin := gitOutput(t, registryDir, "rev-parse", "HEAD"), gitOutput(t, registryDir, "rev-parse", "origin/main"); head == origin {
+		t.Errorf("Expected the registry commit not to be pushed")
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "diff", registryName)
+	checkOutput(t, stdout, stderr, "Registry 'myreg' has 1 unpushed commit(s):\n  + package 'pkga'\n  + pkga v1.0.0\n", err, false, 0)
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "push", registryName)
+	checkOutput(t, stdout, stderr, "Pushed 1 commit(s) to registry 'myreg'\n", err, false, 0)
+	if head, origin := gitOutput(t, registryDir, "rev-parse", "HEAD"), gitOutput(t, registryDir, "rev-parse", "origin/main"); head != origin {
+		t.Errorf("Expected the registry to be pushed, HEAD %s and origin/main %s", head, origin)
+	}
+
+	// Discarding drops the staged package
+	addPackageToRegistry(t, tempDir, registryName, packageGitURLB)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "discard", registryName, "--no-input")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "discard", registryName, "--force")
+	checkOutput(t, stdout, stderr, "Discarded 1 unpushed commit(s) in registry 'myreg'\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "diff", registryName)
+	checkOutput(t, stdout, stderr, "Registry 'myreg' has no unpushed changes\n", err, false, 0)
+	if data, err := os.ReadFile(filepath.Join(registryDir, "registry.json")); err != nil || strings.Contains(string(data), "pkgb") {
+		t.Errorf("Expected pkgb to be discarded from registry.json (err: %v)", err)
+	}
+}
+
+// TestRegistryListingOrder tests sorting and pagination of registry status and search
+func TestRegistryListingOrder(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	// alpha has two versions published in 2024, beta one in 2025 and gamma three in 2023
+	packages := []struct {
+		name     string
+		versions []string
+		date     string
+	}{
+		{"alpha", []string{"v1.0.0", "v1.1.0"}, "2024-01-01T12:00:00"},
+		{"beta", []string{"v1.0.0"}, "2025-01-01T12:00:00"},
+		{"gamma", []string{"v1.0.0", "v1.1.0", "v1.2.0"}, "2023-01-01T12:00:00"},
+	}
+	uuids := make(map[string]string)
+	for _, pkg := range packages {
+		t.Setenv("GIT_COMMITTER_DATE", pkg.date)
+		packageDir, gitURL := setupPackageWithGit(t, tempDir, pkg.name, "v1.0.0")
+		for _, version := range pkg.versions {
+			releasePackage(t, packageDir, version)
+		}
+		addPackageToRegistry(t, tempDir, registryName, gitURL)
+		uuids[pkg.name] = loadProjectFile(t, filepath.Join(packageDir, "Project.json")).UUID
+	}
+	line := func(name string) string {
+		for _, pkg := range packages {
+			if pkg.name == name {
+				return fmt.Sprintf("    - %s (UUID: %s), %d version(s), latest %s, last published %s\n", name, uuids[name], len(pkg.versions), pkg.versions[len(pkg.versions)-1], pkg.date[:10])
+			}
+		}
+		return ""
+	}
+	header := fmt.Sprintf("Registry Status for '%s':\n  Packages:\n", registryName)
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "status", registryName)
+	checkOutput(t, stdout, stderr, header+line("alpha")+line("beta")+line("gamma"), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName, "--sort", "versions")
+	checkOutput(t, stdout, stderr, header+line("gamma")+line("alpha")+line("beta"), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName, "--sort", "updated")
+	checkOutput(t, stdout, stderr, header+line("beta")+line("alpha")+line("gamma"), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName, "--limit", "2", "--page", "2")
+	checkOutput(t, stdout, stderr, header+line("gamma")+"  Showing 3-3 of 3 (page 2 of 2)\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName, "--sort", "updated", "--limit", "1")
+	checkOutput(t, stdout, stderr, header+line("beta")+"  Showing 1-1 of 3 (page 1 of 3)\n", err, false, 0)
+
+	stdout, stderr, err = runCommand(t, tempDir, "search", "a", "--sort", "versions", "--limit", "2")
+	checkOutput(t, stdout, stderr, "gamma v1.2.0 (myreg)\nalpha v1.1.0 (myreg)\nShowing 1-2 of 3 (page 1 of 2)\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "search", "a", "--sort", "updated", "--limit", "2", "--page", "2")
+	checkOutput(t, stdout, stderr, "gamma v1.2.0 (myreg)\nShowing 3-3 of 3 (page 2 of 2)\n", err, false, 0)
+
+	for _, args := range [][]string{
+		{"registry", "status", registryName, "--limit", "2", "--page", "3"},
+		{"registry", "status", registryName, "--page", "2"},
+		{"registry", "status", registryName, "--sort", "size"},
+		{"search", "a", "--limit", "-1"},
+	} {
+		if _, _, err := runCommand(t, tempDir, args...); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
 func TestRegistryInit(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -147,7 +746,7 @@ func TestRegistryInit(t *testing.T) {
 
 	// Verify output (duplicate init should fail)
 	stdout, stderr, err := runCommand(t, tempDir, "registry", "init", registryName, createBareRepo(t, tempDir, "origin.git"))
-	checkOutput(t, stdout, stderr, "", err, true, 1) // Changed expectedOutput to "" (empty stdout)
+	checkOutput(t, stdout, stderr, "", err, true, 4) // Conflict; expectedOutput is "" (empty stdout)
 
 	// Verify stderr contains the error message
 	expectedStderr := "Error: registry 'myreg' already exists\n"
@@ -209,6 +808,35 @@ func TestRegistryDelete(t *testing.T) {
 				checkRegistriesFile(t, filepath.Join(registriesDir, "registries.json"), []string{"myreg3"})
 			},
 		},
+		{
+			name:         "success_with_yes",
+			registryName: "myreg4",
+			args:         []string{"registry", "delete", "myreg4", "--yes"},
+			verifyResults: func(t *testing.T, registriesDir string) {
+				verifyRegistryDeleted(t, registriesDir, "myreg4")
+			},
+		},
+		{
+			name:           "error_declined",
+			registryName:   "myreg5",
+			input:          "n\n",
+			args:           []string{"registry", "delete", "myreg5"},
+			expectError:    true,
+			expectedStderr: "Error: registry deletion cancelled by user",
+			verifyResults: func(t *testing.T, registriesDir string) {
+				checkRegistriesFile(t, filepath.Join(registriesDir, "registries.json"), []string{"myreg3", "myreg5"})
+			},
+		},
+		{
+			name:           "error_no_input",
+			registryName:   "myreg6",
+			args:           []string{"registry", "delete", "myreg6", "--no-input"},
+			expectError:    true,
+			expectedStderr: "Error: deleting registry 'myreg6' requires confirmation; use --yes or --force (input is disabled by --yes or --no-input)",
+			verifyResults: func(t *testing.T, registriesDir string) {
+				checkRegistriesFile(t, filepath.Join(registriesDir, "registries.json"), []string{"myreg3", "myreg5", "myreg6"})
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -221,6 +849,8 @@ func TestRegistryDelete(t *testing.T) {
 				setupRegistry(t, tempDir, "myreg2")
 			} else if tt.name == "error_non_existent_registry" {
 				setupRegistry(t, tempDir, "myreg3")
+			} else {
+				setupRegistry(t, tempDir, tt.registryName)
 			}
 
 			cmd := exec.Command(binaryPath, tt.args...)
@@ -307,39 +937,135 @@ func TestRegistryClone(t *testing.T) {
 	verifyRemoteUpdated(t, tempDir, registryDir, fmt.Sprintf("Added package %s version %s", packageName, version))
 }
 
-func TestRelease(t *testing.T) {
+// TestRegistryCloneSparse tests that a sparse registry clone checks out packages when they are used
+func TestRegistryCloneSparse(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
+	registryName := "myreg"
+	gitURL, registryDir := setupRegistry(t, tempDir, registryName)
 
-	// Create a package with bare remote
-	packageName := "mypkg"
-	version := "v1.2.3"
-	packageDir, _ := setupPackageWithGit(t, tempDir, packageName, version)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	otherDir, otherGitURL := setupPackageWithGit(t, tempDir, "F", "v1.0.0")
+	releasePackage(t, otherDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, otherGitURL)
 
-	// Execute release --patch
-	newVersion := "v1.2.4"
-	stdout, stderr := releasePackage(t, packageDir, "--patch")
-	expectedOutput := fmt.Sprintf("Released version '%s' for project '%s'\n", newVersion, packageName)
-	if stdout != expectedOutput {
-		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
+	deleteRegistry(t, tempDir, registryName, true)
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "clone", gitURL, "--sparse")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Cloned registry '%s' from %s (sparse)\n", registryName, gitURL), err, false, 0)
+	if _, err := os.Stat(filepath.Join(registryDir, "registry.json")); err != nil {
+		t.Fatalf("Expected registry.json in the sparse clone: %v", err)
+	}
+	for _, dir := range []string{"E", "F"} {
+		if _, err := os.Stat(filepath.Join(registryDir, dir)); !os.IsNotExist(err) {
+			t.Errorf("Expected package directory %s not to be checked out, got %v", dir, err)
+		}
 	}
-	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), newVersion)
-	verifyGitTag(t, packageDir, newVersion)
 
-	// Execute release --minor
-	newVersion = "v1.3.0"
-	stdout, stderr = releasePackage(t, packageDir, "--minor")
-	expectedOutput = fmt.Sprintf("Released version '%s' for project '%s'\n", newVersion, packageName)
-	if stdout != expectedOutput {
-		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
+	// Adding a dependency checks out only that package
+	projectDir := initPackage(t, tempDir, "A")
+	addDependencyToProject(t, projectDir, "E", "v1.1.0")
+	if _, err := os.Stat(filepath.Join(registryDir, "E", "E", "v1.1.0", "specs.json")); err != nil {
+		t.Errorf("Expected E to be checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(registryDir, "F")); !os.IsNotExist(err) {
+		t.Errorf("Expected F not to be checked out, got %v", err)
 	}
-	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), newVersion)
-	verifyGitTag(t, packageDir, newVersion)
 
-	// Execute release --major
-	newVersion = "v2.0.0"
-	stdout, stderr = releasePackage(t, packageDir, "--major")
-	expectedOutput = fmt.Sprintf("Released version '%s' for project '%s'\n", newVersion, packageName)
+	// A release to the sparse clone is committed and pushed
+	_, stderr, err = runCommand(t, packageDir, "release", "--minor", "--registry", registryName)
+	if err != nil {
+		t.Fatalf("Failed to release to the sparse registry: %v\nStderr: %s", err, stderr)
+	}
+	verifyRemoteUpdated(t, tempDir, registryDir, "Added version v1.2.0 of package E")
+	if _, err := os.Stat(filepath.Join(registryDir, "E", "E", "v1.2.0", "specs.json")); err != nil {
+		t.Errorf("Expected the new version in the sparse clone: %v", err)
+	}
+}
+
+// TestRegistryProtect tests that a read-only registry refuses changes until it is unprotected
+func TestRegistryProtect(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "upstream"
+	gitURL, registryDir := setupRegistry(t, tempDir, registryName)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "protect", registryName)
+	checkOutput(t, stdout, stderr, "Registry 'upstream' is now read-only\n", err, false, 0)
+	head := gitOutput(t, registryDir, "rev-parse", "HEAD")
+
+	// Changes to the registry are refused
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--minor", "--registry", registryName)
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	if !strings.Contains(stderr, "registry 'upstream' is read-only") {
+		t.Errorf("Expected a read-only error, got %q", stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rm", registryName, "pkga", "--force")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	otherDir, otherGitURL := setupPackageWithGit(t, tempDir, "pkgb", "v1.0.0")
+	releasePackage(t, otherDir, "v1.0.0")
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "add", registryName, otherGitURL)
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	if got := gitOutput(t, registryDir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("Expected the read-only registry to be unchanged, HEAD moved from %s to %s", head, got)
+	}
+
+	// Reading from the registry still works
+	projectDir := initPackage(t, tempDir, "app")
+	addDependencyToProject(t, projectDir, "pkga", "v1.0.0")
+
+	// After unprotecting, changes are allowed again
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "unprotect", registryName)
+	checkOutput(t, stdout, stderr, "Registry 'upstream' is no longer read-only\n", err, false, 0)
+	addPackageToRegistry(t, tempDir, registryName, otherGitURL)
+
+	// A registry cloned with --read-only is protected right away
+	deleteRegistry(t, tempDir, registryName, true)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "clone", gitURL, "--read-only")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Cloned registry '%s' from %s\n", registryName, gitURL), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rm", registryName, "pkgb", "--force")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "protect", registryName)
+	checkOutput(t, stdout, stderr, "Registry 'upstream' is already read-only\n", err, false, 0)
+}
+
+func TestRelease(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create a package with bare remote
+	packageName := "mypkg"
+	version := "v1.2.3"
+	packageDir, _ := setupPackageWithGit(t, tempDir, packageName, version)
+
+	// Execute release --patch
+	newVersion := "v1.2.4"
+	stdout, stderr := releasePackage(t, packageDir, "--patch")
+	expectedOutput := fmt.Sprintf("Released version '%s' for project '%s'\n", newVersion, packageName)
+	if stdout != expectedOutput {
+		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
+	}
+	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), newVersion)
+	verifyGitTag(t, packageDir, newVersion)
+
+	// Execute release --minor
+	newVersion = "v1.3.0"
+	stdout, stderr = releasePackage(t, packageDir, "--minor")
+	expectedOutput = fmt.Sprintf("Released version '%s' for project '%s'\n", newVersion, packageName)
+	if stdout != expectedOutput {
+		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
+	}
+	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), newVersion)
+	verifyGitTag(t, packageDir, newVersion)
+
+	// Execute release --major
+	newVersion = "v2.0.0"
+	stdout, stderr = releasePackage(t, packageDir, "--major")
+	expectedOutput = fmt.Sprintf("Released version '%s' for project '%s'\n", newVersion, packageName)
 	if stdout != expectedOutput {
 		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
 	}
@@ -520,6 +1246,92 @@ func TestRegistryRm(t *testing.T) {
 	verifyRemoteUpdated(t, tempDir, registryDir, fmt.Sprintf("Removed package '%s'", packageName))
 }
 
+// TestRegistryRmYank tests that yanked versions are skipped by new dependencies but still resolve
+func TestRegistryRmYank(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	existingDir, _ := setupPackageWithGit(t, tempDir, "existing", "v0.1.0")
+	addDependencyToProject(t, existingDir, packageName, "v1.1.0")
+
+	if _, _, err := runCommand(t, tempDir, "registry", "rm", registryName, packageName, "--yank"); err == nil {
+		t.Errorf("Expected error when yanking without a version")
+	}
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "rm", registryName, packageName, "v1.1.0", "--yank")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Yanked version 'v1.1.0' of package '%s' in registry '%s'\n", packageName, registryName), err, false, 0)
+	verifyVersionsJSON(t, filepath.Join(registryDir, "M", packageName, "versions.json"), []string{"v1.0.0", "v1.1.0"})
+	verifyRemoteUpdated(t, tempDir, registryDir, fmt.Sprintf("Yanked version 'v1.1.0' of package '%s'", packageName))
+
+	// New dependencies skip the yanked version
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, packageName, "")
+	verifyProjectDependencies(t, filepath.Join(projectDir, "Project.json"), packageName, "v1.0.0")
+	if _, _, err := runCommand(t, projectDir, "add", packageName, "v1.1.0"); err == nil {
+		t.Errorf("Expected error when adding a yanked version")
+	}
+
+	// Existing dependencies on the yanked version still resolve
+	if _, stderr, err := runCommand(t, existingDir, "activate"); err != nil {
+		t.Errorf("Expected activation with a yanked dependency to succeed: %v\nStderr: %s", err, stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "unyank", registryName, packageName, "v1.1.0")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Unyanked version 'v1.1.0' of package '%s' in registry '%s'\n", packageName, registryName), err, false, 0)
+	if _, _, err := runCommand(t, tempDir, "registry", "unyank", registryName, packageName, "v1.1.0"); err == nil {
+		t.Errorf("Expected error when unyanking a version that is not yanked")
+	}
+	otherDir := initPackage(t, tempDir, "other")
+	addDependencyToProject(t, otherDir, packageName, "")
+	verifyProjectDependencies(t, filepath.Join(otherDir, "Project.json"), packageName, "v1.1.0")
+}
+
+// TestRegistryRmDependents tests that removing a version other packages depend on requires --force
+func TestRegistryRmDependents(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.0.0")
+	addDependencyToProject(t, packageDir, "E", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "rm", registryName, "E", "v1.0.0")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	if !strings.Contains(stderr, "it is used by B@v1.0.0") {
+		t.Errorf("Expected the broken dependents in stderr, got %q", stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rm", registryName, "E")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	verifyVersionsJSON(t, filepath.Join(registryDir, "E", "E", "versions.json"), []string{"v1.0.0", "v1.1.0"})
+
+	// No registered build list selects v1.1.0
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rm", registryName, "E", "v1.1.0", "--force")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Removed version 'v1.1.0' of package 'E' from registry '%s'\n", registryName), err, false, 0)
+	if stderr != "" {
+		t.Errorf("Expected no warning, got %q", stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rm", registryName, "E", "v1.0.0", "--force")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Removed version 'v1.0.0' of package 'E' from registry '%s'\n", registryName), err, false, 0)
+	if !strings.Contains(stderr, "Warning: removing version 'v1.0.0' of package 'E' breaks the build lists of B@v1.0.0") {
+		t.Errorf("Expected a warning about B@v1.0.0, got %q", stderr)
+	}
+}
+
 func TestAddDependency(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -549,6 +1361,45 @@ func TestAddDependency(t *testing.T) {
 	verifyProjectDependencies(t, filepath.Join(projectDir, "Project.json"), packageName, packageVersion)
 }
 
+// TestAddRefreshInterval tests that cosm add only pulls registries that were not pulled recently
+func TestAddRefreshInterval(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "mypkg", "v0.1.0")
+	releasePackage(t, packageDir, "v0.1.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	if _, err := os.Stat(filepath.Join(tempDir, ".cosm", "logs", "registries.json")); err != nil {
+		t.Fatalf("Expected the registry pull to be recorded: %v", err)
+	}
+
+	// The registry was just pulled by registry add
+	_, stderr, err := runCommand(t, projectDir, "add", "mypkg@v0.1.0", "-v")
+	if err != nil || strings.Contains(stderr, "Ran 'git ls-remote") || !strings.Contains(stderr, "skipping pull") {
+		t.Errorf("Expected the pull to be skipped, got stderr %q (err: %v)", stderr, err)
+	}
+
+	// --refresh and a zero refreshinterval pull anyway
+	removeDependencyFromProject(t, projectDir, "mypkg")
+	_, stderr, err = runCommand(t, projectDir, "add", "mypkg@v0.1.0", "--refresh", "-v")
+	if err != nil || !strings.Contains(stderr, "Ran 'git ls-remote") {
+		t.Errorf("Expected a pull with --refresh, got stderr %q (err: %v)", stderr, err)
+	}
+	removeDependencyFromProject(t, projectDir, "mypkg")
+	t.Setenv("COSM_REFRESH_INTERVAL", "0")
+	_, stderr, err = runCommand(t, projectDir, "add", "mypkg@v0.1.0", "-v")
+	if err != nil || !strings.Contains(stderr, "Ran 'git ls-remote") {
+		t.Errorf("Expected a pull with a zero refreshinterval, got stderr %q (err: %v)", stderr, err)
+	}
+
+	t.Setenv("COSM_REFRESH_INTERVAL", "soon")
+	if _, _, err := runCommand(t, projectDir, "add", "mypkg@v0.1.0"); err == nil {
+		t.Errorf("Expected an error for an invalid refreshinterval")
+	}
+}
+
 // TestAddDependencyNoVersion tests the cosm add command when no version is specified
 func TestAddDependencyNoVersion(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
@@ -581,6 +1432,216 @@ func TestAddDependencyNoVersion(t *testing.T) {
 	verifyProjectDependencies(t, filepath.Join(projectDir, "Project.json"), packageName, packageVersions[len(packageVersions)-1])
 }
 
+// TestAddScopedDependency tests that a package name scoped to a registry selects the package in that
+// registry and that the build list is resolved from it
+func TestAddScopedDependency(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRegistry(t, tempDir, "staging")
+	_, productionDir := setupRegistry(t, tempDir, "production")
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "utils", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, "staging", packageGitURL)
+	addPackageToRegistry(t, tempDir, "production", packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+
+	// Without a scope, the registry cannot be chosen without a prompt
+	stdout, stderr, err := runCommand(t, projectDir, "add", "utils", "v1.0.0", "--no-input")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+
+	stdout, stderr, err = runCommand(t, projectDir, "add", "production/utils", "v1.0.0")
+	checkOutput(t, stdout, stderr, "Added dependency 'utils' v1.0.0 from registry 'production' to project\n", err, false, 0)
+	production := loadRegistryFile(t, productionDir)
+	project := loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	for _, dep := range project.Deps {
+		if dep.Name != "utils" || dep.Registry != production.UUID {
+			t.Errorf("Expected dependency 'utils' from registry %s, got %+v", production.UUID, dep)
+		}
+	}
+
+	// The build list is only resolved from the recorded registry
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "rm", "production", "utils", "--force")
+	checkOutput(t, stdout, stderr, "Removed package 'utils' from registry 'production'\n", err, false, 0)
+	_, stderr, err = runCommand(t, projectDir, "activate", "--check")
+	if err == nil || !strings.Contains(stderr, "not found in the registry with UUID '"+production.UUID+"'") {
+		t.Errorf("Expected activate to fail without the package in the recorded registry, got %q (err: %v)", stderr, err)
+	}
+
+	stdout, stderr, err = runCommand(t, projectDir, "add", "production/utils", "--no-input")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, projectDir, "add", "missing/utils")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, projectDir, "add", "/utils")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+}
+
+// TestAddRecordsRegistry tests that the registry a dependency is added from is recorded, and that the
+// build list keeps resolving it from that registry
+func TestAddRecordsRegistry(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	_, stagingDir := setupRegistry(t, tempDir, "staging")
+	setupRegistry(t, tempDir, "production")
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "utils", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, "staging", packageGitURL)
+	addPackageToRegistry(t, tempDir, "production", packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+
+	if _, stderr, err := runCommand(t, tempDir, "config", "set", "defaultregistry", "staging"); err != nil {
+		t.Fatalf("Failed to set the default registry: %v (stderr: %q)", err, stderr)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "add", "utils", "v1.0.0", "--no-input")
+	checkOutput(t, stdout, stderr, "Added dependency 'utils' v1.0.0 from registry 'staging' to project\n", err, false, 0)
+	staging := loadRegistryFile(t, stagingDir)
+	projectFile := filepath.Join(projectDir, "Project.json")
+	project := loadProjectFile(t, projectFile)
+	for _, dep := range project.Deps {
+		if dep.Registry != staging.UUID {
+			t.Errorf("Expected dependency 'utils' from registry %s, got %+v", staging.UUID, dep)
+		}
+	}
+
+	// Another registry with the same package is not used, regardless of the default registry
+	removeFromRegistry(t, tempDir, "staging", "utils", "")
+	if _, stderr, err := runCommand(t, tempDir, "config", "set", "defaultregistry", "production"); err != nil {
+		t.Fatalf("Failed to set the default registry: %v (stderr: %q)", err, stderr)
+	}
+	_, stderr, err = runCommand(t, projectDir, "activate", "--check")
+	if err == nil || !strings.Contains(stderr, "not found in the registry with UUID '"+staging.UUID+"'") {
+		t.Errorf("Expected activate to fail without the package in the recorded registry, got %q (err: %v)", stderr, err)
+	}
+
+	// A registry that is not in the depot does not prevent resolving the dependency from another one
+	data, err := os.ReadFile(projectFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), staging.UUID, "4e0a3c1e-4d4a-4f55-9a5e-3f0e1c2d3b4a", 1))
+	if err := os.WriteFile(projectFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "activate", "--check"); err != nil {
+		t.Errorf("Expected the dependency to be resolved from another registry, got %q (err: %v)", stderr, err)
+	}
+}
+
+// TestAddPinnedDependency tests pinning a dependency to an unreleased commit
+func TestAddPinnedDependency(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRegistry(t, tempDir, "myreg")
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "utils", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, "myreg", packageGitURL)
+	if err := os.WriteFile(filepath.Join(packageDir, "fix.txt"), []byte("unreleased fix\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commitAndPushPackageChanges(t, packageDir, "Unreleased fix")
+	commit := gitOutput(t, packageDir, "rev-parse", "HEAD")
+	projectDir := initPackage(t, tempDir, "myproject")
+
+	stdout, stderr, err := runCommand(t, projectDir, "add", "utils", "--sha", commit[:10])
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added dependency 'utils' v1.0.0 from registry 'myreg' to project pinned to commit %s\n", commit[:7]), err, false, 0)
+	for _, dep := range loadProjectFile(t, filepath.Join(projectDir, "Project.json")).Deps {
+		if dep.SHA1 != commit {
+			t.Errorf("Expected the dependency to be pinned to %s, got %+v", commit, dep)
+		}
+	}
+	for _, dep := range loadBuildList(t, filepath.Join(projectDir, ".cosm", "buildlist.json")).Dependencies {
+		if dep.SHA1 != commit || dep.Path != "packages/utils/"+commit {
+			t.Errorf("Expected the build list to use commit %s, got %+v", commit, dep)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v (stderr: %q)", err, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, ".cosm", "packages", "utils", commit, "fix.txt")); err != nil {
+		t.Errorf("Expected the pinned commit to be installed: %v", err)
+	}
+
+	stdout, stderr, err = runCommand(t, projectDir, "status")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Status for project 'myproject' v0.1.0:\n  Dependencies:\n    - utils v1.0.0 (pinned to commit %s, not a release)\n", commit[:7]), err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "release", "--patch", "--strict")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+	if !strings.Contains(stderr, "pinned to commits: 'utils' at "+commit[:7]) {
+		t.Errorf("Expected the pinned dependency to block a strict release, got %q", stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, projectDir, "add", "utils", "--sha", "not-a-commit")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+	stdout, stderr, err = runCommand(t, projectDir, "add", "utils@v1.0.0", "--as", "utils2", "--sha", "deadbeefdeadbeef")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+}
+
+// TestAddDependencyAlias tests importing two major versions of a package side by side
+func TestAddDependencyAlias(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageName := "mypkg"
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v2.0.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, packageName, "v2.0.0")
+	stdout, stderr, err := runCommand(t, projectDir, "add", packageName+"@v1.0.0", "--as", "legacy_mypkg")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added dependency '%s' v1.0.0 from registry '%s' to project as 'legacy_mypkg'\n", packageName, registryName), err, false, 0)
+
+	// The alias is stored with the dependency
+	project := loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	aliases := make(map[string]string)
+	for _, dep := range project.Deps {
+		aliases[dep.Version] = dep.Alias
+	}
+	if aliases["v1.0.0"] != "legacy_mypkg" || aliases["v2.0.0"] != "" {
+		t.Errorf("Unexpected aliases %v", aliases)
+	}
+
+	// Test errors: alias in use and invalid alias
+	_, stderr, err = runCommand(t, projectDir, "add", packageName+"@v1.0.0", "--as", packageName)
+	if err == nil || !strings.Contains(stderr, "alias 'mypkg' is already used") {
+		t.Errorf("Expected error for an alias in use, got %q (err: %v)", stderr, err)
+	}
+	if _, _, err := runCommand(t, projectDir, "add", packageName+"@v1.0.0", "--as", "1bad"); err == nil {
+		t.Errorf("Expected error for an invalid alias")
+	}
+
+	// Both versions are exposed in the environment
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+	env, err := os.ReadFile(filepath.Join(projectDir, ".cosm", ".env"))
+	if err != nil {
+		t.Fatalf("Failed to read .env: %v", err)
+	}
+	for _, version := range []string{"v1.0.0", "v2.0.0"} {
+		specs := loadSpecs(t, tempDir, registryName, packageName, version)
+		name := "MYPKG_PATH"
+		if version == "v1.0.0" {
+			name = "LEGACY_MYPKG_PATH"
+		}
+		expected := fmt.Sprintf("export %s=\"%s\"", name, filepath.Join(tempDir, ".cosm", "packages", packageName, specs.SHA1))
+		if !strings.Contains(string(env), expected) {
+			t.Errorf("Expected %q in .env, got:\n%s", expected, env)
+		}
+	}
+
+	// The dependency can be removed by its alias
+	stdout, stderr, err = runCommand(t, projectDir, "rm", "legacy_mypkg")
+	checkOutput(t, stdout, stderr, "Removed dependency 'legacy_mypkg' from project\n", err, false, 0)
+	project = loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	if len(project.Deps) != 1 {
+		t.Errorf("Expected one dependency left, got %v", project.Deps)
+	}
+}
+
 func TestRmDependency(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -673,6 +1734,51 @@ func TestRmDependencyMultipleMatches(t *testing.T) {
 	}
 }
 
+// TestRmMultipleDependencies tests removing several dependencies and the unused ones
+func TestRmMultipleDependencies(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	for _, packageName := range []string{"pkga", "pkgb", "pkgc"} {
+		packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	}
+	projectDir := initPackage(t, tempDir, "myproject")
+	projectFile := filepath.Join(projectDir, "Project.json")
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkga", "pkgb", "pkgc"); err != nil {
+		t.Fatalf("Failed to add dependencies: %v\nStderr: %s", err, stderr)
+	}
+
+	// A missing dependency leaves Project.json unchanged
+	if _, stderr, err := runCommand(t, projectDir, "rm", "pkga", "nonexistent"); err == nil || !strings.Contains(stderr, "dependency 'nonexistent' not found") {
+		t.Errorf("Expected error for a missing dependency, got %q (err: %v)", stderr, err)
+	}
+	if deps := loadProjectFile(t, projectFile).Deps; len(deps) != 3 {
+		t.Errorf("Expected 3 dependencies, got %v", deps)
+	}
+
+	// Only pkga and pkgb are imported by the sources
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	source := "local a = require(\"pkga.core\")\nlocal b = require \"pkgb\"\n"
+	if err := os.WriteFile(filepath.Join(projectDir, "src", "myproject.t"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "rm", "--unused")
+	checkOutput(t, stdout, stderr, "Removed dependency 'pkgc' from project\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "rm", "--unused")
+	checkOutput(t, stdout, stderr, "No unused dependencies found\n", err, false, 0)
+
+	stdout, stderr, err = runCommand(t, projectDir, "rm", "pkga", "pkgb")
+	checkOutput(t, stdout, stderr, "Removed dependency 'pkga' from project\nRemoved dependency 'pkgb' from project\n", err, false, 0)
+	if deps := loadProjectFile(t, projectFile).Deps; len(deps) != 0 {
+		t.Errorf("Expected no dependencies, got %v", deps)
+	}
+}
+
 func TestMinimalVersionSelectionBuildList(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -743,7 +1849,8 @@ func TestMinimalVersionSelectionBuildList(t *testing.T) {
 	if err != nil {
 		t.Errorf("Unexpected error: %v\nStderr: %s", err, stderr)
 	}
-	expectedOutput := fmt.Sprintf("Generated build list for %s in .cosm/buildlist.json\nStarting interactive shell. Press ctrl-d or type 'exit' to quit.\n", "A")
+	// cosm add already generated the build list
+	expectedOutput := fmt.Sprintf("Build list up-to-date in .cosm/buildlist.json\n%s", activatedMessage)
 	if stdout != expectedOutput {
 		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
 	}
@@ -790,6 +1897,56 @@ func TestMinimalVersionSelectionBuildList(t *testing.T) {
 	}
 }
 
+// TestBuildListPruning tests that dependencies only required by versions that were not selected
+// are left out of the build list
+func TestBuildListPruning(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "D", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// B v1.1.0 requires D, B v1.2.0 no longer does
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.1.0")
+	addDependencyToProject(t, packageDir, "D", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added D@v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	removeDependencyFromProject(t, packageDir, "D")
+	commitAndPushPackageChanges(t, packageDir, "removed D")
+	releasePackage(t, packageDir, "v1.2.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// C v1.0.0 requires B v1.1.0
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "C", "v1.0.0")
+	addDependencyToProject(t, packageDir, "B", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "added B@v1.1.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	projectDir := initPackage(t, tempDir, "A")
+	if _, stderr, err := runCommand(t, projectDir, "add", "B@v1.2.0", "C@v1.0.0"); err != nil {
+		t.Fatalf("Failed to add dependencies: %v\nStderr: %s", err, stderr)
+	}
+	data, err := os.ReadFile(filepath.Join(projectDir, ".cosm", "buildlist.json"))
+	if err != nil {
+		t.Fatalf("Failed to read build list: %v", err)
+	}
+	var buildList types.BuildList
+	if err := json.Unmarshal(data, &buildList); err != nil {
+		t.Fatalf("Failed to parse build list: %v", err)
+	}
+	versions := make(map[string]string)
+	for _, dep := range buildList.Dependencies {
+		versions[dep.Name] = dep.Version
+	}
+	if len(versions) != 2 || versions["B"] != "v1.2.0" || versions["C"] != "v1.0.0" {
+		t.Errorf("Expected B v1.2.0 and C v1.0.0 without D, got %v", versions)
+	}
+}
+
 // TestMakePackageAvailable tests the MakePackageAvailable function
 func TestMakePackageAvailable(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
@@ -822,7 +1979,7 @@ func TestMakePackageAvailable(t *testing.T) {
 	initialBranch := getCloneBranch(t, cloneDir)
 
 	// Call MakePackageAvailable
-	err := commands.MakePackageAvailable(cosmDir, &specs)
+	err := commands.MakePackageAvailable(context.Background(), cosmDir, &specs)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -850,3 +2007,3476 @@ func TestMakePackageAvailable(t *testing.T) {
 	// Verify clone branch is reverted
 	verifyCloneBranch(t, cloneDir, initialBranch)
 }
+
+// TestRegistryAddPath tests registering a package from a local directory with --path
+func TestRegistryAddPath(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create registry
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	// Create a package with releases
+	packageName := "mypkg"
+	packageDir, _ := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "--minor")
+
+	// Add package to registry from its local path
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, "--path", packageDir)
+	expectedOutput := fmt.Sprintf("Added package '%s' to registry '%s'\n", packageName, registryName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// Verify the package is recorded with a file:// URL to the directory
+	project := loadProjectFile(t, filepath.Join(packageDir, "Project.json"))
+	localURL := "file://" + packageDir
+	verifyPackageInRegistry(t, registryDir, packageName, project.UUID, localURL)
+	expectedVersions := []string{"v1.0.0", "v1.1.0"}
+	verifyVersionsJSON(t, filepath.Join(registryDir, strings.ToUpper(string(packageName[0])), packageName, "versions.json"), expectedVersions)
+	for _, version := range expectedVersions {
+		verifyRegistryPackage(t, registryDir, packageName, project.UUID, localURL, version)
+	}
+
+	// Test error: path that is not a Git repository
+	notRepo := filepath.Join(tempDir, "notrepo")
+	if err := os.Mkdir(notRepo, 0755); err != nil {
+		t.Fatalf("Failed to create dir %s: %v", notRepo, err)
+	}
+	_, _, err = runCommand(t, tempDir, "registry", "add", registryName, "--path", notRepo)
+	if err == nil {
+		t.Errorf("Expected error when adding a non-Git directory, got none")
+	}
+}
+
+// TestRegistryAddShallow tests registering a package from a shallow clone and materializing an older version
+func TestRegistryAddShallow(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create registry
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	// Create a package with releases
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "--minor")
+	releasePackage(t, packageDir, "--major")
+
+	// Add package to registry from a shallow clone
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, gitURL, "--shallow")
+	expectedOutput := fmt.Sprintf("Added package '%s' to registry '%s'\n", packageName, registryName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// Verify all versions are registered
+	project := loadProjectFile(t, filepath.Join(packageDir, "Project.json"))
+	expectedVersions := []string{"v1.0.0", "v1.1.0", "v2.0.0"}
+	verifyVersionsJSON(t, filepath.Join(registryDir, strings.ToUpper(string(packageName[0])), packageName, "versions.json"), expectedVersions)
+	for _, version := range expectedVersions {
+		verifyRegistryPackage(t, registryDir, packageName, project.UUID, gitURL, version)
+	}
+
+	// Verify the clone is shallow
+	cloneDir := filepath.Join(tempDir, ".cosm", "clones", project.UUID)
+	if output := strings.TrimSpace(gitOutput(t, cloneDir, "rev-parse", "--is-shallow-repository")); output != "true" {
+		t.Errorf("Expected clone %s to be shallow, got %q", cloneDir, output)
+	}
+
+	// Materialize the oldest version from the shallow clone
+	specs := loadSpecs(t, tempDir, registryName, packageName, "v1.0.0")
+	if err := commands.MakePackageAvailable(context.Background(), filepath.Join(tempDir, ".cosm"), &specs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	materialized := loadProjectFile(t, filepath.Join(tempDir, ".cosm", "packages", packageName, specs.SHA1, "Project.json"))
+	if materialized.Version != "v1.0.0" {
+		t.Errorf("Expected materialized version v1.0.0, got %s", materialized.Version)
+	}
+}
+
+// TestAddRegeneratesBuildList tests that cosm add and cosm rm keep .cosm/buildlist.json up to date
+func TestAddRegeneratesBuildList(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	for _, packageName := range []string{"pkga", "pkgb"} {
+		packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	}
+	projectDir := initPackage(t, tempDir, "myproject")
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+	buildListNames := func() []string {
+		t.Helper()
+		data, err := os.ReadFile(buildListFile)
+		if err != nil {
+			t.Fatalf("Failed to read build list: %v", err)
+		}
+		var buildList types.BuildList
+		if err := json.Unmarshal(data, &buildList); err != nil {
+			t.Fatalf("Failed to parse build list: %v", err)
+		}
+		var names []string
+		for _, dep := range buildList.Dependencies {
+			names = append(names, dep.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// --no-resolve leaves the build list alone
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkga", "--no-resolve"); err != nil {
+		t.Fatalf("Failed to add dependency: %v\nStderr: %s", err, stderr)
+	}
+	if _, err := os.Stat(buildListFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no build list with --no-resolve, got %v", err)
+	}
+
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkgb"); err != nil {
+		t.Fatalf("Failed to add dependency: %v\nStderr: %s", err, stderr)
+	}
+	if names := buildListNames(); strings.Join(names, ",") != "pkga,pkgb" {
+		t.Errorf("Expected pkga and pkgb in the build list, got %v", names)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "rm", "pkga"); err != nil {
+		t.Fatalf("Failed to remove dependency: %v\nStderr: %s", err, stderr)
+	}
+	if names := buildListNames(); strings.Join(names, ",") != "pkgb" {
+		t.Errorf("Expected pkgb in the build list, got %v", names)
+	}
+
+	// The regenerated build list is up to date for cosm activate
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "activate")
+	if err != nil || !strings.Contains(stdout, "Build list up-to-date") {
+		t.Errorf("Expected an up-to-date build list, got %q (err: %v, stderr: %s)", stdout, err, stderr)
+	}
+
+	// Staleness follows the content of Project.json, not its modification time
+	projectFile := filepath.Join(projectDir, "Project.json")
+	data, err := os.ReadFile(projectFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(projectFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "activate")
+	if err != nil || !strings.Contains(stdout, "Build list up-to-date") {
+		t.Errorf("Expected an up-to-date build list after rewriting Project.json, got %q (err: %v, stderr: %s)", stdout, err, stderr)
+	}
+	project := loadProjectFile(t, projectFile)
+	project.Deps = nil
+	data, _ = json.MarshalIndent(project, "", "  ")
+	if err := os.WriteFile(projectFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(projectFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "activate")
+	if err != nil || !strings.Contains(stdout, "Generated build list") {
+		t.Errorf("Expected the build list to be regenerated for an older but changed Project.json, got %q (err: %v, stderr: %s)", stdout, err, stderr)
+	}
+}
+
+// TestActivateCheck tests verifying the build list with cosm activate --check
+func TestActivateCheck(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	for _, packageName := range []string{"pkga", "pkgb"} {
+		packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	}
+	projectDir := initPackage(t, tempDir, "myproject")
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+
+	// A missing build list
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkga", "--no-resolve"); err != nil {
+		t.Fatalf("Failed to add dependency: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "activate", "--check")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	if _, err := os.Stat(buildListFile); !os.IsNotExist(err) {
+		t.Errorf("Expected --check not to write a build list, got %v", err)
+	}
+
+	if _, stderr, err := runCommand(t, projectDir, "rm", "pkga"); err != nil {
+		t.Fatalf("Failed to remove dependency: %v\nStderr: %s", err, stderr)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkga"); err != nil {
+		t.Fatalf("Failed to add dependency: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "activate", "--check")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\n", err, false, 0)
+
+	// A build list that drifted from Project.json
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkgb", "--no-resolve"); err != nil {
+		t.Fatalf("Failed to add dependency: %v\nStderr: %s", err, stderr)
+	}
+	before, err := os.ReadFile(buildListFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err = runCommand(t, projectDir, "activate", "--check")
+	if err == nil || !strings.Contains(stderr, "is out of date: 'pkgb@v1.0.0' is missing") {
+		t.Errorf("Expected drift to be reported, got %q (err: %v)", stderr, err)
+	}
+	if after, _ := os.ReadFile(buildListFile); string(after) != string(before) {
+		t.Errorf("Expected --check not to change the build list")
+	}
+}
+
+// TestActivateExport tests exporting the environment for direnv, dotenv and GitHub Actions
+func TestActivateExport(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, "pkga", "v1.0.0")
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	specs := loadSpecs(t, tempDir, registryName, "pkga", "v1.0.0")
+	pkgPath := filepath.Join(tempDir, ".cosm", "packages", "pkga", specs.SHA1)
+
+	stdout, stderr, err := runCommand(t, projectDir, "activate", "--export", "direnv")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\nExported 4 variable(s) to .envrc\n"+activatedMessage, err, false, 0)
+	envrc, err := os.ReadFile(filepath.Join(projectDir, ".envrc"))
+	if err != nil {
+		t.Fatalf("Failed to read .envrc: %v", err)
+	}
+	if !strings.Contains(string(envrc), fmt.Sprintf("export PKGA_PATH=%q\n", pkgPath)) {
+		t.Errorf("Expected .envrc to export PKGA_PATH, got:\n%s", envrc)
+	}
+
+	stdout, stderr, err = runCommand(t, projectDir, "activate", "--export", "dotenv")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\nExported 4 variable(s) to .env\n"+activatedMessage, err, false, 0)
+	dotenv, err := os.ReadFile(filepath.Join(projectDir, ".env"))
+	if err != nil {
+		t.Fatalf("Failed to read .env: %v", err)
+	}
+	if !strings.Contains(string(dotenv), fmt.Sprintf("PKGA_PATH=%q\n", pkgPath)) || strings.Contains(string(dotenv), "export PKGA_PATH") {
+		t.Errorf("Expected .env to assign PKGA_PATH, got:\n%s", dotenv)
+	}
+
+	// A .env that was not written by cosm is not overwritten
+	if err := os.WriteFile(filepath.Join(projectDir, ".env"), []byte("SECRET=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = runCommand(t, projectDir, "activate", "--export", "dotenv")
+	checkOutput(t, "", "", "", err, true, 4)
+
+	githubEnv := filepath.Join(tempDir, "github_env")
+	if err := os.WriteFile(githubEnv, []byte("EXISTING=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_ENV", githubEnv)
+	stdout, stderr, err = runCommand(t, projectDir, "activate", "--export", "github")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\nExported 4 variable(s) to $GITHUB_ENV\n"+activatedMessage, err, false, 0)
+	data, err := os.ReadFile(githubEnv)
+	if err != nil {
+		t.Fatalf("Failed to read $GITHUB_ENV: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "EXISTING=1\n") || !strings.Contains(string(data), "PKGA_PATH="+pkgPath+"\n") {
+		t.Errorf("Expected PKGA_PATH to be appended to $GITHUB_ENV, got:\n%s", data)
+	}
+
+	_, _, err = runCommand(t, projectDir, "activate", "--export", "fish")
+	checkOutput(t, "", "", "", err, true, 2)
+	_, _, err = runCommand(t, projectDir, "activate", "--check", "--export", "direnv")
+	checkOutput(t, "", "", "", err, true, 2)
+}
+
+// TestActivateEditorPaths tests the paths of the sources and dependencies written for editors
+func TestActivateEditorPaths(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, "pkga", "v1.0.0")
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(projectDir, ".cosm", "paths.json"))
+	if err != nil {
+		t.Fatalf("Failed to read .cosm/paths.json: %v", err)
+	}
+	var paths types.EditorPaths
+	if err := json.Unmarshal(data, &paths); err != nil {
+		t.Fatalf("Failed to parse .cosm/paths.json: %v\n%s", err, data)
+	}
+	specs := loadSpecs(t, tempDir, registryName, "pkga", "v1.0.0")
+	pkgPath := filepath.Join(tempDir, ".cosm", "packages", "pkga", specs.SHA1)
+	srcDir := filepath.Join(projectDir, "src")
+	if paths.Root != projectDir || len(paths.Sources) != 1 || paths.Sources[0] != srcDir {
+		t.Errorf("Expected root %s with source %s, got %+v", projectDir, srcDir, paths)
+	}
+	if len(paths.Dependencies) != 1 || paths.Dependencies[0].Import != "pkga" || paths.Dependencies[0].Path != pkgPath || paths.Dependencies[0].Src != filepath.Join(pkgPath, "src") {
+		t.Errorf("Unexpected dependencies %+v", paths.Dependencies)
+	}
+	if luaPath := paths.SearchPaths["LUA_PATH"]; !strings.HasPrefix(luaPath, filepath.Join(srcDir, "?.lua")+";") || !strings.Contains(luaPath, filepath.Join(pkgPath, "src", "?.lua")) {
+		t.Errorf("Expected an absolute LUA_PATH, got %q", luaPath)
+	}
+	if _, exists := paths.SearchPaths["PKGA_PATH"]; exists {
+		t.Errorf("Expected only language search paths, got %+v", paths.SearchPaths)
+	}
+}
+
+// TestMajorVersionConflicts tests the report of packages in the build list with several major versions
+func TestMajorVersionConflicts(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v2.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// B v1.0.0 requires E v1 and B v1.1.0 requires E v2
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.0.0")
+	addDependencyToProject(t, packageDir, "E", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	removeDependencyFromProject(t, packageDir, "E")
+	addDependencyToProject(t, packageDir, "E", "v2.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v2.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	projectDir := initPackage(t, tempDir, "myproject")
+	if _, stderr, err := runCommand(t, projectDir, "add", "B@v1.0.0"); err != nil || stderr != "" {
+		t.Fatalf("Failed to add B: %v\nStderr: %s", err, stderr)
+	}
+	_, stderr, err := runCommand(t, projectDir, "add", "E@v2.0.0")
+	if err != nil {
+		t.Fatalf("Failed to add E: %v\nStderr: %s", err, stderr)
+	}
+	for _, expected := range []string{
+		"Warning: 'E' is in the build list with several major versions: v1.0.0, v2.0.0",
+		"'B' v1.0.0 requires 'E' v1; upgrade 'B' to v1.1.0, which requires v2",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected %q in stderr, got %q", expected, stderr)
+		}
+	}
+
+	// A direct dependency on the older major version
+	if _, stderr, err := runCommand(t, projectDir, "add", "E@v1.0.0"); err != nil || !strings.Contains(stderr, "project 'myproject' requires 'E' v1; replace that dependency by 'E' v2") {
+		t.Errorf("Expected a suggestion for the direct dependency, got %q (err: %v)", stderr, err)
+	}
+}
+
+// TestAddDependencyPrerelease tests that prereleases are skipped by default and can be added explicitly
+func TestAddDependencyPrerelease(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Setup registry
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	// Setup package with a stable release and a prerelease
+	packageName := "mypkg"
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v2.0.0-beta.1")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+
+	// Without a version the latest stable release is selected
+	projectDir := initPackage(t, tempDir, "myproject")
+	stdout, stderr := addDependencyToProject(t, projectDir, packageName, "")
+	expectedOutput := fmt.Sprintf("Added dependency '%s' %s from registry '%s' to project\n", packageName, "v1.0.0", registryName)
+	if stdout != expectedOutput {
+		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
+	}
+
+	// The prerelease can be requested with <name>@<version>
+	stdout, stderr = addDependencyToProject(t, projectDir, packageName+"@v2.0.0-beta.1", "")
+	expectedOutput = fmt.Sprintf("Added dependency '%s' %s from registry '%s' to project\n", packageName, "v2.0.0-beta.1", registryName)
+	if stdout != expectedOutput {
+		t.Errorf("Expected output %q, got %q\nStderr: %s", expectedOutput, stdout, stderr)
+	}
+	verifyProjectDependencies(t, filepath.Join(projectDir, "Project.json"), packageName, "v1.0.0")
+	verifyProjectDependencies(t, filepath.Join(projectDir, "Project.json"), packageName, "v2.0.0-beta.1")
+}
+
+// TestUpgrade tests that cosm upgrade selects the latest compatible version, skipping prereleases
+// unless --pre is given
+func TestUpgrade(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageName := "mypkg"
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	for _, version := range []string{"v1.0.0", "v1.1.0", "v1.2.0-beta.1", "v2.0.0"} {
+		releasePackage(t, packageDir, version)
+	}
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, packageName, "v1.0.0")
+	projectFile := filepath.Join(projectDir, "Project.json")
+
+	stdout, stderr, err := runCommand(t, projectDir, "upgrade")
+	checkOutput(t, stdout, "", "", err, true, 2)
+
+	// The latest version with the same major version, without the prerelease
+	stdout, stderr, err = runCommand(t, projectDir, "upgrade", packageName)
+	checkOutput(t, stdout, stderr, "Upgraded dependency 'mypkg' from v1.0.0 to v1.1.0\n", err, false, 0)
+	verifyProjectDependencies(t, projectFile, packageName, "v1.1.0")
+
+	stdout, stderr, err = runCommand(t, projectDir, "upgrade", packageName, "v1.0.0")
+	checkOutput(t, stdout, "", "", err, true, 2)
+	if !strings.Contains(stderr, "version v1.0.0 of 'mypkg' is older than the current version v1.1.0") {
+		t.Errorf("Expected an error for an older version, got %q", stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, projectDir, "upgrade", packageName, "--pre")
+	checkOutput(t, stdout, stderr, "Upgraded dependency 'mypkg' from v1.1.0 to v1.2.0-beta.1\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "upgrade", packageName)
+	checkOutput(t, stdout, stderr, "Dependency 'mypkg' is up to date at v1.2.0-beta.1\n", err, false, 0)
+
+	// --latest moves to the next major version and regenerates the build list
+	stdout, stderr, err = runCommand(t, projectDir, "upgrade", "--all", "--latest")
+	checkOutput(t, stdout, stderr, "Upgraded dependency 'mypkg' from v1.2.0-beta.1 to v2.0.0\n", err, false, 0)
+	verifyProjectDependencies(t, projectFile, packageName, "v2.0.0")
+	if project := loadProjectFile(t, projectFile); len(project.Deps) != 1 {
+		t.Errorf("Expected only the v2 dependency in Project.json, got %v", project.Deps)
+	}
+	buildList := loadBuildList(t, filepath.Join(projectDir, ".cosm", "buildlist.json"))
+	for _, dep := range buildList.Dependencies {
+		if dep.Name != packageName || dep.Version != "v2.0.0" {
+			t.Errorf("Expected mypkg@v2.0.0 in the build list, got %s@%s", dep.Name, dep.Version)
+		}
+	}
+}
+
+// TestReleaseDryRun tests that cosm release --dry-run validates and reports without publishing
+func TestReleaseDryRun(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create registry and a registered package
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.2.3")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Dry run a patch release to the registry
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--patch", "--registry", registryName, "--dry-run")
+	expectedOutput := fmt.Sprintf("Dry run: release version 'v1.2.4' for project '%s'\n", packageName) +
+		"  - update version in Project.json from 'v1.2.3' to 'v1.2.4' and commit 'Release v1.2.4'\n" +
+		"  - create tag 'v1.2.4'\n" +
+		"  - push branch 'main' to origin\n" +
+		"  - push tag 'v1.2.4' to origin\n" +
+		fmt.Sprintf("  - add version 'v1.2.4' to registry '%s' and push the registry\n", registryName) +
+		"No changes were made.\n"
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// Verify nothing changed
+	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), "v1.2.3")
+	tagOutput, err := commands.GitCommand(context.Background(), packageDir, "tag", "-l", "v1.2.4")
+	if err != nil || tagOutput != "" {
+		t.Errorf("Expected no tag 'v1.2.4' after dry run, got %q (err: %v)", tagOutput, err)
+	}
+
+	// Dry run validation fails for an unknown registry
+	_, _, err = runCommand(t, packageDir, "release", "--patch", "--registry", "unknown", "--dry-run")
+	if err == nil {
+		t.Errorf("Expected error for dry run against unknown registry, got none")
+	}
+}
+
+// TestReleaseToRegistry tests that cosm release --registry publishes the new version to the registry
+func TestReleaseToRegistry(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create registry and a registered package
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.2.3")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Release to the registry
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName)
+	expectedOutput := fmt.Sprintf("Added version 'v1.3.0' of package '%s' to registry '%s'\nReleased version 'v1.3.0' for project '%s'\n", packageName, registryName, packageName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// Verify registry contents
+	project := loadProjectFile(t, filepath.Join(packageDir, "Project.json"))
+	verifyVersionsJSON(t, filepath.Join(registryDir, "M", packageName, "versions.json"), []string{"v1.3.0"})
+	verifyRegistryPackage(t, registryDir, packageName, project.UUID, gitURL, "v1.3.0")
+	verifySHA1Matches(t, packageDir, "v1.3.0", loadSpecs(t, tempDir, registryName, packageName, "v1.3.0"))
+}
+
+// TestReleaseRegister tests that cosm release --register registers a new package with the release
+func TestReleaseRegister(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+
+	// A release to a registry that does not contain the package fails and suggests --register
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName)
+	checkOutput(t, stdout, stderr, "", err, true, 1)
+	if !strings.Contains(stderr, "--register myreg") {
+		t.Errorf("Expected a hint to use --register, got %q", stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--minor", "--register", registryName, "--dry-run")
+	if err != nil || !strings.Contains(stdout, "  - register package 'mypkg' with its versions up to 'v1.1.0' in registry 'myreg' and push the registry\n") {
+		t.Errorf("Expected the registration in the dry run plan, got %q (err: %v)\nStderr: %s", stdout, err, stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--minor", "--register", registryName)
+	expectedOutput := fmt.Sprintf("Registered package '%s' with version 'v1.1.0' in registry '%s'\nReleased version 'v1.1.0' for project '%s'\n", packageName, registryName, packageName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// The package is registered under its origin URL with the earlier release and the new one
+	project := loadProjectFile(t, filepath.Join(packageDir, "Project.json"))
+	registry := loadRegistryFile(t, registryDir)
+	if pkgInfo := registry.Packages[packageName]; pkgInfo.UUID != project.UUID || pkgInfo.GitURL != gitURL || len(pkgInfo.Maintainers) != 1 {
+		t.Errorf("Expected package '%s' registered with UUID %s and URL %s, got %+v", packageName, project.UUID, gitURL, pkgInfo)
+	}
+	verifyVersionsJSON(t, filepath.Join(registryDir, "M", packageName, "versions.json"), []string{"v1.0.0", "v1.1.0"})
+	verifySHA1Matches(t, packageDir, "v1.1.0", loadSpecs(t, tempDir, registryName, packageName, "v1.1.0"))
+	verifyRemoteUpdated(t, tempDir, registryDir, "Added package mypkg version v1.1.0")
+
+	// Registering the package again is a conflict
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--patch", "--register", registryName)
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), "v1.1.0")
+}
+
+// TestReleaseNotes tests that release notes are stored in an annotated tag and the registry and shown by cosm info
+func TestReleaseNotes(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	notes := "## Fixes\n\n- Fixed the parser"
+	_, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName, "--notes", notes)
+	if err != nil {
+		t.Fatalf("Failed to release with notes: %v\nStderr: %s", err, stderr)
+	}
+	if objectType := gitOutput(t, packageDir, "cat-file", "-t", "v1.1.0"); objectType != "tag" {
+		t.Errorf("Expected an annotated tag, got object type %q", objectType)
+	}
+	data, err := os.ReadFile(filepath.Join(registryDir, "M", packageName, "v1.1.0", "notes.md"))
+	if err != nil || string(data) != notes+"\n" {
+		t.Errorf("Expected notes.md with %q, got %q (err: %v)", notes+"\n", string(data), err)
+	}
+	stdout, stderr, err := runCommand(t, tempDir, "info", packageName+"@v1.1.0")
+	if err != nil || !strings.Contains(stdout, "  Release notes of v1.1.0:\n    ## Fixes\n    \n    - Fixed the parser\n") {
+		t.Errorf("Expected the release notes in cosm info, got %q (err: %v)\nStderr: %s", stdout, err, stderr)
+	}
+
+	// Notes from a file; a release without notes gets a lightweight tag and no notes.md
+	notesFile := filepath.Join(tempDir, "notes.md")
+	if err := os.WriteFile(notesFile, []byte("Faster startup\n"), 0644); err != nil {
+		t.Fatalf("Failed to write notes file: %v", err)
+	}
+	if _, stderr, err := runCommand(t, packageDir, "release", "--patch", "--registry", registryName, "--notes-file", notesFile); err != nil {
+		t.Fatalf("Failed to release with a notes file: %v\nStderr: %s", err, stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(registryDir, "M", packageName, "v1.1.1", "notes.md")); err != nil || string(data) != "Faster startup\n" {
+		t.Errorf("Expected notes.md from the notes file, got %q (err: %v)", string(data), err)
+	}
+	releasePackage(t, packageDir, "--patch")
+	if objectType := gitOutput(t, packageDir, "cat-file", "-t", "v1.1.2"); objectType != "commit" {
+		t.Errorf("Expected a lightweight tag, got object type %q", objectType)
+	}
+
+	// Combining --notes and --notes-file is a validation error
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--patch", "--notes", "x", "--notes-file", notesFile)
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+}
+
+// TestReleaseChecks tests that cosm release runs the checks of Project.json before tagging
+func TestReleaseChecks(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	packageDir, _ := setupPackageWithGit(t, tempDir, "mypkg", "v1.0.0")
+	projectFile := filepath.Join(packageDir, "Project.json")
+	project := loadProjectFile(t, projectFile)
+	project.Checks = &types.ReleaseChecks{Build: "true", Test: "test -f Project.json", Lint: "echo lint problems; exit 1"}
+	data, _ := json.MarshalIndent(project, "", "  ")
+	if err := os.WriteFile(projectFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write Project.json: %v", err)
+	}
+	gitOutput(t, packageDir, "commit", "-am", "Add release checks")
+	gitOutput(t, packageDir, "push", "origin", "main")
+
+	// A dry run lists the checks without running them
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor", "--dry-run")
+	if err != nil || !strings.Contains(stdout, "  - run the build check 'true'\n  - run the test check 'test -f Project.json'\n  - run the lint check 'echo lint problems; exit 1'\n") {
+		t.Errorf("Expected the checks in the dry run plan, got %q (err: %v)\nStderr: %s", stdout, err, stderr)
+	}
+
+	// A failing check aborts the release before anything is changed
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--minor")
+	checkOutput(t, stdout, stderr, "Running the build check: true\nRunning the test check: test -f Project.json\nRunning the lint check: echo lint problems; exit 1\n", err, true, 1)
+	if !strings.Contains(stderr, "lint check failed") || !strings.Contains(stderr, "lint problems") {
+		t.Errorf("Expected the failing lint check and its output, got %q", stderr)
+	}
+	verifyProjectVersion(t, projectFile, "v1.0.0")
+	if tags := gitOutput(t, packageDir, "tag", "-l", "v1.1.0"); tags != "" {
+		t.Errorf("Expected no tag after a failed check, got %q", tags)
+	}
+
+	// --skip-checks releases anyway
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--minor", "--skip-checks")
+	checkOutput(t, stdout, stderr, "Released version 'v1.1.0' for project 'mypkg'\n", err, false, 0)
+}
+
+// TestReleaseBranch tests that releases are made from the default branch of origin or the branch given with --branch
+func TestReleaseBranch(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "mypkg", "v1.0.0")
+
+	// Make trunk the default branch of origin
+	gitOutput(t, packageDir, "branch", "-m", "main", "trunk")
+	gitOutput(t, packageDir, "push", "origin", "trunk")
+	gitOutput(t, strings.TrimPrefix(gitURL, "file://"), "symbolic-ref", "HEAD", "refs/heads/trunk")
+	gitOutput(t, strings.TrimPrefix(gitURL, "file://"), "branch", "-D", "main")
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor")
+	checkOutput(t, stdout, stderr, "Released version 'v1.1.0' for project 'mypkg'\n", err, false, 0)
+	if head := gitOutput(t, packageDir, "rev-parse", "origin/trunk"); head != gitOutput(t, packageDir, "rev-parse", "HEAD") {
+		t.Errorf("Expected the release commit to be pushed to trunk, got %s", head)
+	}
+
+	// A release from another branch needs --branch, and is pushed to that branch
+	gitOutput(t, packageDir, "checkout", "-b", "release/1.x")
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--patch")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+	if !strings.Contains(stderr, "releases are made from branch 'trunk', but 'release/1.x' is checked out") {
+		t.Errorf("Expected a branch mismatch error, got %q", stderr)
+	}
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--patch", "--branch", "release/1.x")
+	checkOutput(t, stdout, stderr, "Released version 'v1.1.1' for project 'mypkg'\n", err, false, 0)
+	if head := gitOutput(t, packageDir, "rev-parse", "origin/release/1.x"); head != gitOutput(t, packageDir, "rev-parse", "HEAD") {
+		t.Errorf("Expected the release commit to be pushed to release/1.x, got %s", head)
+	}
+	verifyGitTag(t, packageDir, "v1.1.1")
+}
+
+// TestReleaseRemote tests that release and registry operations use the upstream remote of the current
+// branch, or the remote set with git config cosm.remote, rather than assuming origin
+func TestReleaseRemote(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	_, registryDir := setupRegistry(t, tempDir, "myreg")
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "mypkg", "v1.0.0")
+
+	// Rename the remotes of the package and the registry
+	gitOutput(t, packageDir, "remote", "rename", "origin", "upstream")
+	gitOutput(t, registryDir, "remote", "rename", "origin", "upstream")
+	addPackageToRegistry(t, tempDir, "myreg", gitURL)
+	if head := gitOutput(t, registryDir, "rev-parse", "upstream/main"); head != gitOutput(t, registryDir, "rev-parse", "HEAD") {
+		t.Errorf("Expected the registry to be pushed to upstream, got %s", head)
+	}
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", "myreg")
+	checkOutput(t, stdout, stderr, "Added version 'v1.1.0' of package 'mypkg' to registry 'myreg'\nReleased version 'v1.1.0' for project 'mypkg'\n", err, false, 0)
+	if head := gitOutput(t, packageDir, "rev-parse", "upstream/main"); head != gitOutput(t, packageDir, "rev-parse", "HEAD") {
+		t.Errorf("Expected the release commit to be pushed to upstream, got %s", head)
+	}
+	if tags := gitOutput(t, strings.TrimPrefix(gitURL, "file://"), "tag", "-l", "v1.1.0"); tags != "v1.1.0" {
+		t.Errorf("Expected tag 'v1.1.0' on upstream, got %q", tags)
+	}
+	if head := gitOutput(t, registryDir, "rev-parse", "upstream/main"); head != gitOutput(t, registryDir, "rev-parse", "HEAD") {
+		t.Errorf("Expected the registry update to be pushed to upstream, got %s", head)
+	}
+	specs := loadSpecs(t, tempDir, "myreg", "mypkg", "v1.1.0")
+	if specs.GitURL != gitURL {
+		t.Errorf("Expected Git URL %s in the specs, got %s", gitURL, specs.GitURL)
+	}
+
+	// With cosm.remote a release is pushed to a fork, not to the upstream of the branch
+	forkDir := filepath.Join(tempDir, "fork.git")
+	gitOutput(t, tempDir, "clone", "--bare", strings.TrimPrefix(gitURL, "file://"), forkDir)
+	gitOutput(t, packageDir, "remote", "add", "fork", "file://"+forkDir)
+	gitOutput(t, packageDir, "config", "cosm.remote", "fork")
+	stdout, stderr, err = runCommand(t, packageDir, "release", "--patch")
+	checkOutput(t, stdout, stderr, "Released version 'v1.1.1' for project 'mypkg'\n", err, false, 0)
+	if tags := gitOutput(t, forkDir, "tag", "-l", "v1.1.1"); tags != "v1.1.1" {
+		t.Errorf("Expected tag 'v1.1.1' on the fork, got %q", tags)
+	}
+	if tags := gitOutput(t, strings.TrimPrefix(gitURL, "file://"), "tag", "-l", "v1.1.1"); tags != "" {
+		t.Errorf("Expected tag 'v1.1.1' not to be pushed to upstream, got %q", tags)
+	}
+}
+
+// TestReleaseRollback tests that a failed release to multiple registries rolls back unpublished local changes
+func TestReleaseRollback(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create two registries with the package registered in both
+	packageName := "mypkg"
+	reg1URL, reg1Dir := setupRegistry(t, tempDir, "reg1")
+	reg2URL, reg2Dir := setupRegistry(t, tempDir, "reg2")
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	addPackageToRegistry(t, tempDir, "reg1", gitURL)
+	addPackageToRegistry(t, tempDir, "reg2", gitURL)
+
+	// Case 1: the project push is rejected, so nothing may remain locally
+	rejectPushes(t, gitURL, true)
+	reg1Head := strings.TrimSpace(gitOutput(t, reg1Dir, "rev-parse", "HEAD"))
+	_, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", "reg1", "--registry", "reg2")
+	if err == nil {
+		t.Fatalf("Expected release to fail when the project push is rejected")
+	}
+	if !strings.Contains(stderr, "rolled back") {
+		t.Errorf("Expected rollback message in stderr, got %q", stderr)
+	}
+	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), "v1.0.0")
+	if tags := gitOutput(t, packageDir, "tag", "-l", "v1.1.0"); tags != "" {
+		t.Errorf("Expected tag 'v1.1.0' to be rolled back, got %q", tags)
+	}
+	if head := strings.TrimSpace(gitOutput(t, reg1Dir, "rev-parse", "HEAD")); head != reg1Head {
+		t.Errorf("Expected registry 'reg1' to be reset to %s, got %s", reg1Head, head)
+	}
+	rejectPushes(t, gitURL, false)
+
+	// Case 2: the second registry rejects the push, the first one stays published
+	rejectPushes(t, reg2URL, true)
+	reg2Head := strings.TrimSpace(gitOutput(t, reg2Dir, "rev-parse", "HEAD"))
+	_, stderr, err = runCommand(t, packageDir, "release", "--minor", "--registry", "reg1", "--registry", "reg2")
+	if err == nil {
+		t.Fatalf("Expected release to fail when a registry push is rejected")
+	}
+	if !strings.Contains(stderr, "failed to publish to registry 'reg2'") {
+		t.Errorf("Expected registry failure in stderr, got %q", stderr)
+	}
+	verifyGitTag(t, packageDir, "v1.1.0")
+	verifyVersionsJSON(t, filepath.Join(reg1Dir, "M", packageName, "versions.json"), []string{"v1.1.0"})
+	verifyRemoteUpdated(t, tempDir, reg1Dir, fmt.Sprintf("Added version v1.1.0 of package %s", packageName))
+	if head := strings.TrimSpace(gitOutput(t, reg2Dir, "rev-parse", "HEAD")); head != reg2Head {
+		t.Errorf("Expected registry 'reg2' to be reset to %s, got %s", reg2Head, head)
+	}
+	rejectPushes(t, reg2URL, false)
+
+	// Case 3: the registries are published concurrently, so a rejected first registry does not
+	// keep the release from the second one
+	rejectPushes(t, reg1URL, true)
+	reg1Head = strings.TrimSpace(gitOutput(t, reg1Dir, "rev-parse", "HEAD"))
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", "reg1", "--registry", "reg2")
+	if err == nil || !strings.Contains(stderr, "failed to publish to registry 'reg1'") {
+		t.Errorf("Expected registry failure of 'reg1', got err=%v stderr=%q", err, stderr)
+	}
+	if !strings.Contains(stdout, fmt.Sprintf("Added version 'v1.2.0' of package '%s' to registry 'reg2'\n", packageName)) {
+		t.Errorf("Expected the version to be published to 'reg2', got %q", stdout)
+	}
+	verifyRemoteUpdated(t, tempDir, reg2Dir, fmt.Sprintf("Added version v1.2.0 of package %s", packageName))
+	if head := strings.TrimSpace(gitOutput(t, reg1Dir, "rev-parse", "HEAD")); head != reg1Head {
+		t.Errorf("Expected registry 'reg1' to be reset to %s, got %s", reg1Head, head)
+	}
+}
+
+// TestReleaseMonorepo tests releasing and registering a package that lives in a subdirectory of a monorepo
+func TestReleaseMonorepo(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create registry
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	// Create a monorepo with two packages
+	repoDir := filepath.Join(tempDir, "monorepo")
+	if err := os.Mkdir(repoDir, 0755); err != nil {
+		t.Fatalf("Failed to create monorepo dir: %v", err)
+	}
+	initPackage(t, repoDir, "alpha", "v1.0.0")
+	initPackage(t, repoDir, "beta", "v0.1.0")
+	gitOutput(t, repoDir, "init")
+	gitOutput(t, repoDir, "add", ".")
+	gitOutput(t, repoDir, "commit", "-m", "Initial commit")
+	gitOutput(t, repoDir, "branch", "-m", "main")
+	gitURL := createBareRepo(t, tempDir, "monorepo.git")
+	gitOutput(t, repoDir, "remote", "add", "origin", gitURL)
+	gitOutput(t, repoDir, "push", "origin", "main")
+
+	// Register the alpha package and release a new version to the registry
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, gitURL, "--package", "alpha")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added package 'alpha' to registry '%s'\n", registryName), err, false, 0)
+	stdout, stderr, err = runCommand(t, repoDir, "release", "--minor", "--package", "alpha", "--registry", registryName)
+	expectedOutput := fmt.Sprintf("Added version 'v1.1.0' of package 'alpha' to registry '%s'\nReleased version 'v1.1.0' for project 'alpha'\n", registryName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// Verify tag, project version, and registry specs
+	verifyGitTag(t, repoDir, "alpha/v1.1.0")
+	verifyProjectVersion(t, filepath.Join(repoDir, "alpha", "Project.json"), "v1.1.0")
+	verifyProjectVersion(t, filepath.Join(repoDir, "beta", "Project.json"), "v0.1.0")
+	specs := loadSpecs(t, tempDir, registryName, "alpha", "v1.1.0")
+	if specs.Subdir != "alpha" {
+		t.Errorf("Expected specs.Subdir %q, got %q", "alpha", specs.Subdir)
+	}
+	verifyVersionsJSON(t, filepath.Join(registryDir, "A", "alpha", "versions.json"), []string{"v1.1.0"})
+
+	// Materializing the package only copies the subdirectory
+	if err := commands.MakePackageAvailable(context.Background(), filepath.Join(tempDir, ".cosm"), &specs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	destPath := filepath.Join(tempDir, ".cosm", "packages", "alpha", specs.SHA1)
+	project := loadProjectFile(t, filepath.Join(destPath, "Project.json"))
+	if project.Name != "alpha" || project.Version != "v1.1.0" {
+		t.Errorf("Expected alpha@v1.1.0 in %s, got %s@%s", destPath, project.Name, project.Version)
+	}
+	if _, err := os.Stat(filepath.Join(destPath, "beta")); !os.IsNotExist(err) {
+		t.Errorf("Expected only the alpha subtree in %s", destPath)
+	}
+}
+
+// TestRegistryAddSubmodule tests registering a package in a submodule of a larger repository
+func TestRegistryAddSubmodule(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	// Submodules with file:// URLs are not allowed by default
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	_, packageGitURL := setupPackageWithGit(t, tempDir, "gamma", "v1.0.0")
+
+	// The repository includes the package as a submodule and tags its releases
+	repoDir := filepath.Join(tempDir, "superproject")
+	if err := os.Mkdir(repoDir, 0755); err != nil {
+		t.Fatalf("Failed to create superproject dir: %v", err)
+	}
+	gitOutput(t, repoDir, "init")
+	gitOutput(t, repoDir, "submodule", "add", packageGitURL, "libs/gamma")
+	gitOutput(t, repoDir, "commit", "-m", "Added gamma")
+	gitOutput(t, repoDir, "branch", "-m", "main")
+	gitOutput(t, repoDir, "tag", "gamma/v1.0.0")
+	gitURL := createBareRepo(t, tempDir, "superproject.git")
+	gitOutput(t, repoDir, "remote", "add", "origin", gitURL)
+	gitOutput(t, repoDir, "push", "origin", "main", "--tags")
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, gitURL, "--subdir", "libs/gamma")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added package 'gamma' to registry '%s'\n", registryName), err, false, 0)
+	specs := loadSpecs(t, tempDir, registryName, "gamma", "v1.0.0")
+	if specs.Subdir != "libs/gamma" {
+		t.Errorf("Expected specs.Subdir %q, got %q", "libs/gamma", specs.Subdir)
+	}
+	// Materializing the package checks out the submodule and copies only its files
+	if err := commands.MakePackageAvailable(context.Background(), filepath.Join(tempDir, ".cosm"), &specs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	destPath := filepath.Join(tempDir, ".cosm", "packages", "gamma", specs.SHA1)
+	project := loadProjectFile(t, filepath.Join(destPath, "Project.json"))
+	if project.Name != "gamma" || project.Version != "v1.0.0" {
+		t.Errorf("Expected gamma@v1.0.0 in %s, got %s@%s", destPath, project.Name, project.Version)
+	}
+	if _, err := os.Stat(filepath.Join(destPath, ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected the .git file of the submodule not to be copied to %s", destPath)
+	}
+
+	// The package is materialized from a temporary worktree, which leaves the clone alone
+	clonePath := filepath.Join(tempDir, ".cosm", "clones", specs.UUID)
+	if head := gitOutput(t, clonePath, "rev-parse", "HEAD"); head != gitOutput(t, clonePath, "rev-parse", "origin/main") {
+		t.Errorf("Expected the HEAD of the clone to stay at origin/main, got %s", head)
+	}
+	if worktrees := gitOutput(t, clonePath, "worktree", "list"); strings.Contains(worktrees, "\n") {
+		t.Errorf("Expected the temporary worktree to be removed, got:\n%s", worktrees)
+	}
+	if entries, err := os.ReadDir(filepath.Join(tempDir, ".cosm", "clones")); err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the clone in the clones directory, got %v (%v)", entries, err)
+	}
+}
+
+// TestPackageLFS tests that a package storing files in Git LFS is not materialized with pointer files
+func TestPackageLFS(t *testing.T) {
+	if _, err := exec.LookPath("git-lfs"); err == nil {
+		t.Skip("git-lfs is installed")
+	}
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "assets", "v1.0.0")
+
+	// Store a file as an LFS pointer, as a repository using git-lfs does
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"
+	if err := os.WriteFile(filepath.Join(packageDir, ".gitattributes"), []byte("*.png filter=lfs diff=lfs merge=lfs -text\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .gitattributes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, "logo.png"), []byte(pointer), 0644); err != nil {
+		t.Fatalf("Failed to write logo.png: %v", err)
+	}
+	gitOutput(t, packageDir, "add", ".")
+	gitOutput(t, packageDir, "commit", "-m", "Added logo")
+	gitOutput(t, packageDir, "push", "origin", "main")
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--patch")
+	checkOutput(t, stdout, stderr, "Released version 'v1.0.1' for project 'assets'\n", err, false, 0)
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Without git-lfs the package cannot be materialized
+	specs := loadSpecs(t, tempDir, registryName, "assets", "v1.0.1")
+	err = commands.MakePackageAvailable(context.Background(), filepath.Join(tempDir, ".cosm"), &specs)
+	if err == nil || !strings.Contains(err.Error(), "git-lfs is not installed") {
+		t.Errorf("Expected an error that git-lfs is not installed, got %v", err)
+	}
+	destPath := filepath.Join(tempDir, ".cosm", "packages", "assets", specs.SHA1)
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no package with pointer files in %s", destPath)
+	}
+}
+
+func TestWorkspace(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	// Package E with two versions
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	releasePackage(t, packageDir, "v1.2.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Create a workspace
+	workspaceDir := filepath.Join(tempDir, "ws")
+	if err := os.Mkdir(workspaceDir, 0755); err != nil {
+		t.Fatalf("Failed to create workspace dir: %v", err)
+	}
+	stdout, stderr, err := runCommand(t, workspaceDir, "workspace", "init")
+	checkOutput(t, stdout, stderr, "Initialized workspace 'ws'\n", err, false, 0)
+
+	// Member lib is released to the registry but developed locally against E@v1.2.0
+	libDir, libGitURL := setupPackageWithGit(t, workspaceDir, "lib", "v1.0.0")
+	releasePackage(t, libDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, libGitURL)
+	addDependencyToProject(t, libDir, "E", "v1.2.0")
+
+	// Member app depends on lib and on E@v1.1.0
+	appDir := initPackage(t, workspaceDir, "app")
+	addDependencyToProject(t, appDir, "lib", "v1.0.0")
+	addDependencyToProject(t, appDir, "E", "v1.1.0")
+
+	stdout, stderr, err = runCommand(t, workspaceDir, "workspace", "add", "lib")
+	checkOutput(t, stdout, stderr, "Added project 'lib' (lib) to workspace 'ws'\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, workspaceDir, "workspace", "add", appDir)
+	checkOutput(t, stdout, stderr, "Added project 'app' (app) to workspace 'ws'\n", err, false, 0)
+	_, _, err = runCommand(t, workspaceDir, "workspace", "add", "lib")
+	if err == nil {
+		t.Errorf("Expected error when adding a member twice")
+	}
+
+	// Status lists all members
+	stdout, stderr, err = runCommand(t, workspaceDir, "workspace", "status")
+	expectedOutput := "Workspace Status for 'ws':\n  Members:\n    - lib v1.0.0 (lib)\n    - app v0.1.0 (app)\n"
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// Activate resolves one shared build list for all members
+	stdout, stderr, err = runCommand(t, workspaceDir, "activate")
+	expectedOutput = "Generated build list for workspace ws in .cosm/buildlist.json\n" + activatedMessage
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+
+	// The member lib is provided by the workspace and E is deduplicated to the highest version
+	buildList := loadBuildList(t, filepath.Join(workspaceDir, ".cosm", "buildlist.json"))
+	if len(buildList.Dependencies) != 1 {
+		t.Fatalf("Expected 1 dependency, got %d: %v", len(buildList.Dependencies), buildList.Dependencies)
+	}
+	for _, dep := range buildList.Dependencies {
+		if dep.Name != "E" || dep.Version != "v1.2.0" {
+			t.Errorf("Expected E@v1.2.0 in build list, got %s@%s", dep.Name, dep.Version)
+		}
+	}
+	env, err := os.ReadFile(filepath.Join(workspaceDir, ".cosm", ".env"))
+	if err != nil {
+		t.Fatalf("Failed to read .env: %v", err)
+	}
+	if !strings.Contains(string(env), "lib/src/?.t") {
+		t.Errorf("Expected member sources of lib in .env, got %s", env)
+	}
+}
+
+// TestWorkspaceSupersededDependencies tests that the shared build list leaves out the dependencies
+// of versions that another member's requirement superseded
+func TestWorkspaceSupersededDependencies(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "Y", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// X v1.1.0 requires Y, X v1.2.0 no longer does
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "X", "v1.1.0")
+	addDependencyToProject(t, packageDir, "Y", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added Y@v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	removeDependencyFromProject(t, packageDir, "Y")
+	commitAndPushPackageChanges(t, packageDir, "removed Y")
+	releasePackage(t, packageDir, "v1.2.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Member a requires X v1.1.0 and member b requires X v1.2.0
+	workspaceDir := filepath.Join(tempDir, "ws")
+	if err := os.Mkdir(workspaceDir, 0755); err != nil {
+		t.Fatalf("Failed to create workspace dir: %v", err)
+	}
+	if _, stderr, err := runCommand(t, workspaceDir, "workspace", "init"); err != nil {
+		t.Fatalf("Failed to initialize workspace: %v\nStderr: %s", err, stderr)
+	}
+	for member, version := range map[string]string{"a": "v1.1.0", "b": "v1.2.0"} {
+		memberDir := initPackage(t, workspaceDir, member)
+		addDependencyToProject(t, memberDir, "X", version)
+		if _, stderr, err := runCommand(t, workspaceDir, "workspace", "add", member); err != nil {
+			t.Fatalf("Failed to add member %s: %v\nStderr: %s", member, err, stderr)
+		}
+	}
+
+	stdout, stderr, err := runCommand(t, workspaceDir, "activate")
+	checkOutput(t, stdout, stderr, "Generated build list for workspace ws in .cosm/buildlist.json\n"+activatedMessage, err, false, 0)
+	buildList := loadBuildList(t, filepath.Join(workspaceDir, ".cosm", "buildlist.json"))
+	if len(buildList.Dependencies) != 1 {
+		t.Fatalf("Expected only X in the build list, got %v", buildList.Dependencies)
+	}
+	for _, dep := range buildList.Dependencies {
+		if dep.Name != "X" || dep.Version != "v1.2.0" {
+			t.Errorf("Expected X@v1.2.0 in build list, got %s@%s", dep.Name, dep.Version)
+		}
+	}
+}
+
+func TestActivateShell(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRegistry(t, tempDir, "myreg")
+	packageDir, _ := setupPackageWithGit(t, tempDir, "A", "v1.0.0")
+
+	// Without --shell only the environment is written
+	stdout, stderr, err := runCommand(t, packageDir, "activate")
+	checkOutput(t, stdout, stderr, "Generated build list for A in .cosm/buildlist.json\n"+activatedMessage, err, false, 0)
+	for _, file := range []string{".env", "env.fish", "activate", "activate.fish", "activation.json", ".bashrc", ".zshrc", "config.fish"} {
+		if _, err := os.Stat(filepath.Join(packageDir, ".cosm", file)); err != nil {
+			t.Errorf("Expected .cosm/%s to exist: %v", file, err)
+		}
+	}
+
+	fishEnv, err := os.ReadFile(filepath.Join(packageDir, ".cosm", "env.fish"))
+	if err != nil || !strings.Contains(string(fishEnv), "set -gx TERRA_PATH ") {
+		t.Errorf("Expected fish exports in .cosm/env.fish, got %q (%v)", fishEnv, err)
+	}
+
+	// With --shell a subshell is started; without input it exits immediately
+	stdout, stderr, err = runCommand(t, packageDir, "activate", "--shell")
+	expectedOutput := "Build list up-to-date in .cosm/buildlist.json\nStarting interactive shell. Press ctrl-d or type 'exit' to quit.\nLeft the cosm environment\n"
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+}
+
+func TestDeactivate(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	packageDir, _ := setupPackageWithGit(t, tempDir, "A", "v1.0.0")
+	stdout, stderr, err := runCommand(t, packageDir, "activate")
+	checkOutput(t, stdout, stderr, "Generated build list for A in .cosm/buildlist.json\n"+activatedMessage, err, false, 0)
+
+	// Activating saves the previous environment, refuses a second activation, and deactivate restores it
+	script := `export LUA_PATH=original
+unset TERRA_PATH
+PS1="prompt$ "
+source .cosm/activate
+echo "$COSM_ACTIVE|$PS1"
+source .cosm/activate 2>/dev/null || echo refused
+deactivate
+echo "${COSM_ACTIVE-unset}|$LUA_PATH|${TERRA_PATH-unset}|$PS1"
+declare -F deactivate >/dev/null || echo removed
+`
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Dir = packageDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run activation script: %v\nOutput: %s", err, output)
+	}
+	expectedOutput := fmt.Sprintf("%s|cosm> prompt$ \nrefused\nunset|original|unset|prompt$ \nremoved\n", packageDir)
+	if string(output) != expectedOutput {
+		t.Errorf("Expected output %q, got %q", expectedOutput, output)
+	}
+
+	// Without an active environment there is nothing to deactivate
+	_, _, err = runCommand(t, packageDir, "deactivate")
+	if err == nil {
+		t.Errorf("Expected error when no environment is active")
+	}
+
+	// With an active environment, cosm deactivate prints the statements that undo it
+	t.Setenv("COSM_ACTIVE", packageDir)
+	stdout, stderr, err = runCommand(t, packageDir, "deactivate")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "unset TERRA_PATH") || !strings.Contains(stdout, "unset COSM_ACTIVE") {
+		t.Errorf("Expected deactivation statements, got %q", stdout)
+	}
+
+	// Another activation on top of the active environment is refused
+	_, stderr, err = runCommand(t, packageDir, "activate", "--shell")
+	if err == nil || !strings.Contains(stderr, "already active") {
+		t.Errorf("Expected double activation to be refused, got err=%v stderr=%q", err, stderr)
+	}
+}
+
+func TestRegistryAudit(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	releasePackage(t, packageDir, "v1.2.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// A consistent registry has no problems
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "audit", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Audit of registry '%s' found no problems\n", registryName), err, false, 0)
+
+	// Corrupt the registry: a version without specs, an unregistered directory, and a package without directory
+	if err := os.Remove(filepath.Join(registryDir, "E", "E", "v1.1.0", "specs.json")); err != nil {
+		t.Fatalf("Failed to remove specs.json: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(registryDir, "Z", "zombie"), 0755); err != nil {
+		t.Fatalf("Failed to create orphaned directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(registryDir, "Z", "zombie", "versions.json"), []byte("[]"), 0644); err != nil {
+		t.Fatalf("Failed to write orphaned versions.json: %v", err)
+	}
+	registry, _, err := commands.LoadRegistryMetadata(filepath.Dir(registryDir), registryName)
+	if err != nil {
+		t.Fatalf("Failed to load registry.json: %v", err)
+	}
+	registry.Packages["ghost"] = types.PackageInfo{UUID: "ghost-uuid", GitURL: "file:///nonexistent"}
+	data, _ := json.MarshalIndent(registry, "", "  ")
+	if err := os.WriteFile(filepath.Join(registryDir, "registry.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write registry.json: %v", err)
+	}
+	gitOutput(t, registryDir, "add", ".")
+	gitOutput(t, registryDir, "commit", "-m", "Corrupt registry")
+	gitOutput(t, registryDir, "push", "origin", "HEAD")
+
+	expectedProblems := fmt.Sprintf("Audit of registry '%s' found 3 problem(s):\n", registryName) +
+		"  - version 'v1.1.0' of package 'E' has a missing or invalid specs.json\n" +
+		"  - package 'ghost' is listed in registry.json but has no directory\n" +
+		"  - directory 'Z/zombie' does not belong to a registered package\n"
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "audit", registryName)
+	checkOutput(t, stdout, stderr, expectedProblems, err, true, 1)
+
+	// Repair the registry
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "audit", registryName, "--fix")
+	checkOutput(t, stdout, stderr, expectedProblems+fmt.Sprintf("Repaired 3 problem(s) in registry '%s'\n", registryName), err, false, 0)
+	verifyVersionsJSON(t, filepath.Join(registryDir, "E", "E", "versions.json"), []string{"v1.2.0"})
+	if _, err := os.Stat(filepath.Join(registryDir, "Z", "zombie")); !os.IsNotExist(err) {
+		t.Errorf("Expected orphaned directory to be removed")
+	}
+	verifyRemoteUpdated(t, tempDir, registryDir, "Repaired 3 problem(s) found by audit")
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "audit", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Audit of registry '%s' found no problems\n", registryName), err, false, 0)
+}
+
+// TestRegistryAuditGitURL tests that released versions record the registered Git URL and that audit
+// repairs versions with another URL
+func TestRegistryAuditGitURL(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	if _, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName); err != nil {
+		t.Fatalf("Failed to release: %v\nStderr: %s", err, stderr)
+	}
+	if specs := loadSpecs(t, tempDir, registryName, "E", "v1.2.0"); specs.GitURL != gitURL {
+		t.Errorf("Expected Git URL %q in released specs, got %q", gitURL, specs.GitURL)
+	}
+
+	// A version with another Git URL is reported and repaired
+	specsFile := filepath.Join(registryDir, "E", "E", "v1.1.0", "specs.json")
+	specs := loadSpecs(t, tempDir, registryName, "E", "v1.1.0")
+	specs.GitURL = "file:///elsewhere"
+	data, _ := json.MarshalIndent(specs, "", "  ")
+	if err := os.WriteFile(specsFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write specs.json: %v", err)
+	}
+	gitOutput(t, registryDir, "add", ".")
+	gitOutput(t, registryDir, "commit", "-m", "Change Git URL")
+	gitOutput(t, registryDir, "push", "origin", "HEAD")
+
+	expectedProblems := fmt.Sprintf("Audit of registry '%s' found 1 problem(s):\n", registryName) +
+		fmt.Sprintf("  - version 'v1.1.0' of package 'E' has Git URL 'file:///elsewhere' in specs.json, but the package is registered with Git URL '%s'\n", gitURL)
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "audit", registryName, "--fix")
+	checkOutput(t, stdout, stderr, expectedProblems+fmt.Sprintf("Repaired 1 problem(s) in registry '%s'\n", registryName), err, false, 0)
+	if specs := loadSpecs(t, tempDir, registryName, "E", "v1.1.0"); specs.GitURL != gitURL {
+		t.Errorf("Expected Git URL %q after repair, got %q", gitURL, specs.GitURL)
+	}
+}
+
+// TestRegistryOwner tests that only maintainers can publish a package, unless forced
+func TestRegistryOwner(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageName := "mypkg"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// The author that registered the package is its first maintainer
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "owner", "list", registryName, packageName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Maintainers of package '%s' in registry '%s':\n  - [testuser]testuser@git.com\n", packageName, registryName), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "owner", "add", registryName, packageName, "[alice]alice@example.com")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added maintainer '[alice]alice@example.com' to package '%s' in registry '%s'\n", packageName, registryName), err, false, 0)
+	verifyRemoteUpdated(t, tempDir, registryDir, fmt.Sprintf("Added maintainer [alice]alice@example.com of package %s", packageName))
+	if _, _, err := runCommand(t, tempDir, "registry", "owner", "add", registryName, packageName, "alice"); err == nil {
+		t.Errorf("Expected error for an author without [name]email form")
+	}
+
+	// Other authors cannot publish or change the maintainers without --force
+	t.Setenv("COSM_AUTHOR", "[mallory]mallory@example.com")
+	_, stderr, err = runCommand(t, packageDir, "release", "--minor", "--registry", registryName)
+	if err == nil || !strings.Contains(stderr, "'[mallory]mallory@example.com' is not a maintainer of package 'mypkg'") {
+		t.Errorf("Expected error for a release by a non-maintainer, got %q (err: %v)", stderr, err)
+	}
+	if _, _, err := runCommand(t, tempDir, "registry", "owner", "rm", registryName, packageName, "[alice]alice@example.com"); err == nil {
+		t.Errorf("Expected error when a non-maintainer removes a maintainer")
+	}
+	if _, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName, "--force"); err != nil {
+		t.Errorf("Expected forced release to succeed: %v\nStderr: %s", err, stderr)
+	}
+
+	// Maintainers are matched by email
+	t.Setenv("COSM_AUTHOR", "[Alice Smith]alice@example.com")
+	if _, stderr, err := runCommand(t, packageDir, "release", "--patch", "--registry", registryName); err != nil {
+		t.Errorf("Expected release by a maintainer to succeed: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "owner", "rm", registryName, packageName, "[testuser]testuser@git.com")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Removed maintainer '[testuser]testuser@git.com' from package '%s' in registry '%s'\n", packageName, registryName), err, false, 0)
+	verifyVersionsJSON(t, filepath.Join(registryDir, "M", packageName, "versions.json"), []string{"v1.1.0", "v1.1.1"})
+}
+
+func TestRegistryAddVerifiesBuildLists(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	// Package G
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Package F depends on G
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "F", "v1.1.0")
+	addDependencyToProject(t, packageDir, "G", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "added G@v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Poison the published build list of F
+	buildListFile := filepath.Join(registryDir, "F", "F", "v1.1.0", "buildlist.json")
+	buildList := loadBuildList(t, buildListFile)
+	for key, dep := range buildList.Dependencies {
+		dep.SHA1 = "0000000000000000000000000000000000000000"
+		buildList.Dependencies[key] = dep
+	}
+	data, _ := json.MarshalIndent(buildList, "", "  ")
+	if err := os.WriteFile(buildListFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", buildListFile, err)
+	}
+	gitOutput(t, registryDir, "add", ".")
+	gitOutput(t, registryDir, "commit", "-m", "Poison build list")
+	gitOutput(t, registryDir, "push", "origin", "HEAD")
+
+	// Package H depends on F and cannot be registered on top of the poisoned build list
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "H", "v1.0.0")
+	addDependencyToProject(t, packageDir, "F", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "added F@v1.1.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	_, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, gitURL)
+	if err == nil {
+		t.Fatalf("Expected registry add to fail on a poisoned build list")
+	}
+	if !strings.Contains(stderr, "published build list of 'F@v1.1.0' does not match its specs") {
+		t.Errorf("Expected build list mismatch error, got %q", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(registryDir, "H", "H", "v1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("Expected no registry entry for H@v1.0.0")
+	}
+}
+
+// TestRegistryAddStaleBuildList tests that build lists published before unreachable dependencies
+// were pruned do not prevent registering dependents, and that registry audit rewrites them
+func TestRegistryAddStaleBuildList(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "D", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// B v1.1.0 requires D, B v1.2.0 no longer does
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.1.0")
+	addDependencyToProject(t, packageDir, "D", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added D@v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	removeDependencyFromProject(t, packageDir, "D")
+	commitAndPushPackageChanges(t, packageDir, "removed D")
+	releasePackage(t, packageDir, "v1.2.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// C requires B v1.1.0, and E requires B v1.2.0 and C
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "C", "v1.0.0")
+	addDependencyToProject(t, packageDir, "B", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "added B@v1.1.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	if _, stderr, err := runCommand(t, packageDir, "add", "B@v1.2.0", "C@v1.0.0"); err != nil {
+		t.Fatalf("Failed to add dependencies: %v\nStderr: %s", err, stderr)
+	}
+	commitAndPushPackageChanges(t, packageDir, "added B and C")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Publish the build list of E as the naive merge of the build lists of its dependencies did,
+	// with D, which no selected version requires
+	buildListFile := filepath.Join(registryDir, "E", "E", "v1.0.0", "buildlist.json")
+	buildList := loadBuildList(t, buildListFile)
+	for key, dep := range loadBuildList(t, filepath.Join(registryDir, "B", "B", "v1.1.0", "buildlist.json")).Dependencies {
+		buildList.Dependencies[key] = dep
+	}
+	if len(buildList.Dependencies) != 3 {
+		t.Fatalf("Expected B, C and D in the stale build list, got %v", buildList.Dependencies)
+	}
+	data, _ := json.MarshalIndent(buildList, "", "  ")
+	if err := os.WriteFile(buildListFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", buildListFile, err)
+	}
+	gitOutput(t, registryDir, "add", ".")
+	gitOutput(t, registryDir, "commit", "-m", "Publish stale build list")
+	gitOutput(t, registryDir, "push", "origin", "HEAD")
+
+	// Package H depends on E and is registered with a warning
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "H", "v1.0.0")
+	addDependencyToProject(t, packageDir, "E", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, gitURL)
+	checkOutput(t, stdout, "", fmt.Sprintf("Added package 'H' to registry '%s'\n", registryName), err, false, 0)
+	if !strings.Contains(stderr, "published build list of 'E@v1.0.0' lists 'D@v1.0.0', which its specs no longer require") {
+		t.Errorf("Expected a warning about the stale build list, got %q", stderr)
+	}
+
+	// The audit rewrites the stale build list from the specs
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "audit", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Audit of registry '%s' found 1 problem(s):\n  - version 'v1.0.0' of package 'E' has a buildlist.json that does not match its specs: unexpected dependency 'D@v1.0.0'\n", registryName), err, true, 1)
+	if _, stderr, err := runCommand(t, tempDir, "registry", "audit", registryName, "--fix"); err != nil {
+		t.Fatalf("Failed to repair the registry: %v\nStderr: %s", err, stderr)
+	}
+	if buildList := loadBuildList(t, buildListFile); len(buildList.Dependencies) != 2 {
+		t.Errorf("Expected the build list of E to be rewritten without D, got %v", buildList.Dependencies)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Unsigned registry commits only produce a warning without a trust policy
+	stdout, stderr, err := runCommand(t, tempDir, "verify", "E@v1.1.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Warning: registry commit") || !strings.Contains(stderr, "is not signed with a trusted key") || !strings.HasSuffix(stdout, fmt.Sprintf("Verified 'E@v1.1.0' in registry '%s'\n", registryName)) {
+		t.Errorf("Unexpected output %q (stderr: %q)", stdout, stderr)
+	}
+
+	// A policy that requires signed commits rejects the unsigned registry commit
+	trustFile := filepath.Join(filepath.Dir(registryDir), "trust.json")
+	if err := os.WriteFile(trustFile, []byte(`{"myreg": {"requiresigned": true}}`), 0644); err != nil {
+		t.Fatalf("Failed to write trust.json: %v", err)
+	}
+	_, stderr, err = runCommand(t, tempDir, "verify", "E@v1.1.0")
+	if err == nil || !strings.Contains(stderr, "requires signed commits") {
+		t.Errorf("Expected unsigned registry commit to be rejected, got err=%v stderr=%q", err, stderr)
+	}
+	if err := os.Remove(trustFile); err != nil {
+		t.Fatalf("Failed to remove trust.json: %v", err)
+	}
+
+	// Moving the release tag is detected
+	gitOutput(t, packageDir, "commit", "--allow-empty", "-m", "Rewrite history")
+	gitOutput(t, packageDir, "tag", "-f", "v1.1.0")
+	gitOutput(t, packageDir, "push", "-f", "origin", "v1.1.0")
+	_, stderr, err = runCommand(t, tempDir, "verify", "E@v1.1.0")
+	if err == nil || !strings.Contains(stderr, "but specs.json in registry 'myreg' records") {
+		t.Errorf("Expected tag SHA1 mismatch, got err=%v stderr=%q", err, stderr)
+	}
+}
+
+func TestVerifySignedRegistry(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	registriesDir := filepath.Dir(registryDir)
+
+	// Configure SSH signing and a trust policy for the registry
+	keyFile := filepath.Join(tempDir, "signing_key")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", keyFile).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to generate signing key: %v\n%s", err, output)
+	}
+	gitOutput(t, tempDir, "config", "--global", "gpg.format", "ssh")
+	gitOutput(t, tempDir, "config", "--global", "user.signingkey", keyFile+".pub")
+	publicKey, err := os.ReadFile(keyFile + ".pub")
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	allowedSigners := fmt.Sprintf("testuser@git.com %s", publicKey)
+	if err := os.WriteFile(filepath.Join(registriesDir, "allowed_signers"), []byte(allowedSigners), 0644); err != nil {
+		t.Fatalf("Failed to write allowed_signers: %v", err)
+	}
+	policy := `{"myreg": {"signcommits": true, "requiresigned": true, "allowedsigners": "allowed_signers"}}`
+	if err := os.WriteFile(filepath.Join(registriesDir, "trust.json"), []byte(policy), 0644); err != nil {
+		t.Fatalf("Failed to write trust.json: %v", err)
+	}
+
+	// Registering a package produces a signed registry commit that verifies
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	stdout, stderr, err := runCommand(t, tempDir, "verify", "E@v1.1.0", "--registry", registryName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "has a valid signature") || !strings.HasSuffix(stdout, fmt.Sprintf("Verified 'E@v1.1.0' in registry '%s'\n", registryName)) {
+		t.Errorf("Unexpected output %q", stdout)
+	}
+}
+
+// TestReleaseSigned tests that cosm release --sign creates a signed tag and records its signer
+func TestReleaseSigned(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	registriesDir := filepath.Dir(registryDir)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Without a signing key, the release fails before anything is changed
+	gitOutput(t, tempDir, "config", "--global", "gpg.format", "ssh")
+	stdout, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName, "--sign")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+	if !strings.Contains(stderr, "user.signingkey is not set") {
+		t.Errorf("Expected a missing signing key error, got %q", stderr)
+	}
+	verifyProjectVersion(t, filepath.Join(packageDir, "Project.json"), "v1.0.0")
+
+	keyFile := filepath.Join(tempDir, "signing_key")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", keyFile).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to generate signing key: %v\n%s", err, output)
+	}
+	gitOutput(t, tempDir, "config", "--global", "user.signingkey", keyFile+".pub")
+	if _, stderr, err := runCommand(t, packageDir, "release", "--minor", "--registry", registryName, "--sign"); err != nil {
+		t.Fatalf("Failed to release a signed tag: %v\nStderr: %s", err, stderr)
+	}
+	if tag := gitOutput(t, packageDir, "cat-file", "-p", "v1.1.0"); !strings.Contains(tag, "BEGIN SSH SIGNATURE") {
+		t.Errorf("Expected a signed tag, got %q", tag)
+	}
+	if signer := loadSpecs(t, tempDir, registryName, "E", "v1.1.0").Signer; signer != "testuser <testuser@git.com>" {
+		t.Errorf("Expected signer 'testuser <testuser@git.com>' in specs.json, got %q", signer)
+	}
+
+	// A registry that requires signed tags verifies the signed release, but not an unsigned one
+	policy := `{"myreg": {"requiresignedtags": true}}`
+	if err := os.WriteFile(filepath.Join(registriesDir, "trust.json"), []byte(policy), 0644); err != nil {
+		t.Fatalf("Failed to write trust.json: %v", err)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "verify", "E@v1.1.0")
+	if err != nil || !strings.Contains(stdout, "Release tag 'v1.1.0' was signed by testuser <testuser@git.com>") {
+		t.Errorf("Expected the signed release to verify, got %q (err: %v)\nStderr: %s", stdout, err, stderr)
+	}
+	releasePackage(t, packageDir, "--patch")
+	if _, stderr, err := runCommand(t, tempDir, "registry", "add", registryName, "E", "v1.1.1"); err != nil {
+		t.Fatalf("Failed to add v1.1.1: %v\nStderr: %s", err, stderr)
+	}
+	_, stderr, err = runCommand(t, tempDir, "verify", "E@v1.1.1")
+	if err == nil || !strings.Contains(stderr, "was not signed, but registry 'myreg' requires signed release tags") {
+		t.Errorf("Expected an unsigned tag error, got err=%v stderr=%q", err, stderr)
+	}
+}
+
+func TestRegistryMirror(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	registryGitURL, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	// Mirror the package repository and record the mirror
+	mirrorPath := filepath.Join(tempDir, "E-mirror.git")
+	gitOutput(t, tempDir, "clone", "--mirror", strings.TrimPrefix(gitURL, "file://"), mirrorPath)
+	mirrorURL := "file://" + mirrorPath
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "mirror", "add", registryName, "E", mirrorURL)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added mirror '%s' for package 'E' in registry '%s'\n", mirrorURL, registryName), err, false, 0)
+	_, _, err = runCommand(t, tempDir, "registry", "mirror", "add", registryName, "E", mirrorURL)
+	if err == nil {
+		t.Errorf("Expected error when adding a mirror twice")
+	}
+	specs := loadSpecs(t, tempDir, registryName, "E", "v1.1.0")
+	if len(specs.Mirrors) != 1 || specs.Mirrors[0] != mirrorURL {
+		t.Errorf("Expected mirrors [%s] in specs.json, got %v", mirrorURL, specs.Mirrors)
+	}
+
+	// Registry mirrors are listed separately from package mirrors
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "mirror", "add", registryName, registryGitURL)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added mirror '%s' for registry '%s'\n", registryGitURL, registryName), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "mirror", "list", registryName, "E")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Mirrors for package 'E' in registry '%s':\n  - %s\n", registryName, mirrorURL), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "mirror", "rm", registryName, registryGitURL)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Removed mirror '%s' for registry '%s'\n", registryGitURL, registryName), err, false, 0)
+	verifyRemoteUpdated(t, tempDir, registryDir, fmt.Sprintf("Removed mirror %s for registry '%s'", registryGitURL, registryName))
+
+	// With the primary repository gone, the package is cloned from the mirror
+	if err := os.Rename(strings.TrimPrefix(gitURL, "file://"), filepath.Join(tempDir, "E-gone.git")); err != nil {
+		t.Fatalf("Failed to move primary repository: %v", err)
+	}
+	projectDir, _ := setupPackageWithGit(t, tempDir, "A", "v1.0.0")
+	addDependencyToProject(t, projectDir, "E", "v1.1.0")
+	stdout, stderr, err = runCommand(t, projectDir, "activate")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\n"+activatedMessage, err, false, 0)
+	if _, err := os.Stat(filepath.Join(tempDir, ".cosm", "packages", "E", specs.SHA1, "Project.json")); err != nil {
+		t.Errorf("Expected E@v1.1.0 to be materialized from the mirror: %v", err)
+	}
+}
+
+// TestRegistryWebhooks tests that the webhooks of a registry are notified when versions are published
+func TestRegistryWebhooks(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	var mu sync.Mutex
+	var events []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+
+	webhook := server.URL + "/publish"
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "webhook", "add", registryName, webhook)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added webhook '%s' to registry '%s'\n", webhook, registryName), err, false, 0)
+	verifyRemoteUpdated(t, tempDir, registryDir, "Added webhook "+webhook)
+	_, _, err = runCommand(t, tempDir, "registry", "webhook", "add", registryName, "ftp://example.com")
+	if err == nil {
+		t.Errorf("Expected error when adding a webhook that is not an http URL")
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "webhook", "add", registryName, failing.URL)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added webhook '%s' to registry '%s'\n", failing.URL, registryName), err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "webhook", "list", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Webhooks for registry '%s':\n  - %s\n  - %s\n", registryName, webhook, failing.URL), err, false, 0)
+
+	// Adding a package notifies the webhooks of every version; a failing webhook only warns
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	_, stderr, err = runCommand(t, tempDir, "registry", "add", registryName, gitURL)
+	if err != nil {
+		t.Fatalf("Failed to add package to registry: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, fmt.Sprintf("Warning: failed to notify webhook '%s' of 'E@v1.1.0'", failing.URL)) {
+		t.Errorf("Expected a warning about the failing webhook, got %q", stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "webhook", "rm", registryName, failing.URL)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Removed webhook '%s' from registry '%s'\n", failing.URL, registryName), err, false, 0)
+
+	// Releasing to the registry notifies the webhooks of the new version
+	_, stderr, err = runCommand(t, packageDir, "release", "--patch", "--registry", registryName)
+	if err != nil {
+		t.Fatalf("Failed to release: %v\nStderr: %s", err, stderr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 webhook events, got %v", events)
+	}
+	for i, version := range []string{"v1.1.0", "v1.1.1"} {
+		specs := loadSpecs(t, tempDir, registryName, "E", version)
+		expected := map[string]string{"event": "publish", "registry": registryName, "package": "E", "uuid": specs.UUID, "version": version, "sha1": specs.SHA1}
+		for key, value := range expected {
+			if events[i][key] != value {
+				t.Errorf("Expected %s '%s' in event %d, got %v", key, value, i, events[i])
+			}
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	cosmDir := filepath.Join(tempDir, ".cosm")
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	specs := loadSpecs(t, tempDir, registryName, "E", "v1.1.0")
+	packagePath := filepath.Join(cosmDir, "packages", "E", specs.SHA1)
+	clonePath := filepath.Join(cosmDir, "clones", specs.UUID)
+
+	projectDir, _ := setupPackageWithGit(t, tempDir, "A", "v1.0.0")
+	addDependencyToProject(t, projectDir, "E", "v1.1.0")
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+
+	// Info lists the cached package version and its clone
+	stdout, stderr, err := runCommand(t, tempDir, "cache", "info")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "    - E: 1 version(s), ") || !strings.Contains(stdout, fmt.Sprintf("    - E (UUID: %s): ", specs.UUID)) {
+		t.Errorf("Unexpected cache info output %q", stdout)
+	}
+
+	// Verify succeeds on an untouched cache and detects modified files
+	stdout, stderr, err = runCommand(t, tempDir, "cache", "verify")
+	checkOutput(t, stdout, stderr, "Verified 1 cached package version(s)\n", err, false, 0)
+
+	// The package version records its origin in .cosm-meta.json, which verify checks too
+	metaFile := filepath.Join(packagePath, ".cosm-meta.json")
+	metaData, err := os.ReadFile(metaFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", metaFile, err)
+	}
+	var meta types.PackageMeta
+	if err := json.Unmarshal(metaData, &meta); err != nil {
+		t.Fatalf("Failed to parse %s: %v", metaFile, err)
+	}
+	if meta.Name != "E" || meta.Version != "v1.1.0" || meta.UUID != specs.UUID || meta.SHA1 != specs.SHA1 || meta.Source != gitURL || meta.Installed.IsZero() {
+		t.Errorf("Unexpected package metadata %+v", meta)
+	}
+	tampered := strings.Replace(string(metaData), specs.SHA1, strings.Repeat("0", 40), 1)
+	if err := os.WriteFile(metaFile, []byte(tampered), 0644); err != nil {
+		t.Fatalf("Failed to modify %s: %v", metaFile, err)
+	}
+	stdout, _, err = runCommand(t, tempDir, "cache", "verify")
+	if err == nil || !strings.Contains(stdout, ".cosm-meta.json records package 'E'") {
+		t.Errorf("Expected verification to fail on mismatching metadata, got %q (err: %v)", stdout, err)
+	}
+	if err := os.WriteFile(metaFile, metaData, 0644); err != nil {
+		t.Fatalf("Failed to restore %s: %v", metaFile, err)
+	}
+
+	projectFile := filepath.Join(packagePath, "Project.json")
+	data, err := os.ReadFile(projectFile)
+	if err != nil {
+		t.Fatalf("Failed to read cached package: %v", err)
+	}
+	if err := os.WriteFile(projectFile, append(data, '\n'), 0644); err != nil {
+		t.Fatalf("Failed to modify cached package: %v", err)
+	}
+	stdout, _, err = runCommand(t, tempDir, "cache", "verify")
+	if err == nil || !strings.Contains(stdout, "modified file 'Project.json'") {
+		t.Errorf("Expected verification to fail on a modified file, got %q (err: %v)", stdout, err)
+	}
+	_, stderr, err = runCommand(t, tempDir, "cache", "verify", "--fix")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if _, err := os.Stat(packagePath); !os.IsNotExist(err) {
+		t.Errorf("Expected corrupted package %s to be removed", packagePath)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+
+	// Clean requires a criterion and keeps entries in use
+	if _, _, err := runCommand(t, tempDir, "cache", "clean"); err == nil {
+		t.Errorf("Expected error when cleaning without criteria")
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "cache", "clean", "--unused")
+	checkOutput(t, stdout, stderr, "No cache entries to remove\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "cache", "clean", "--older-than", "30")
+	checkOutput(t, stdout, stderr, "No cache entries to remove\n", err, false, 0)
+
+	// Old entries are removed once no build list refers to them
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	for _, path := range []string{packagePath, clonePath} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to change modification time of %s: %v", path, err)
+		}
+	}
+	if err := os.Remove(filepath.Join(projectDir, ".cosm", "buildlist.json")); err != nil {
+		t.Fatalf("Failed to remove build list: %v", err)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "cache", "clean", "--older-than", "30", "--unused")
+	if err != nil || !strings.HasPrefix(stdout, "Removed 1 package version(s) and 1 clone(s), freeing ") {
+		t.Errorf("Unexpected clean output %q (err: %v)\nStderr: %s", stdout, err, stderr)
+	}
+	for _, path := range []string{packagePath, clonePath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+}
+
+func TestVendor(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+	cosmDir := filepath.Join(tempDir, ".cosm")
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	projectDir, _ := setupPackageWithGit(t, tempDir, "A", "v1.0.0")
+	addDependencyToProject(t, projectDir, "E", "v1.1.0")
+
+	stdout, stderr, err := runCommand(t, projectDir, "vendor")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\nVendored 1 package(s) into vendor/\n", err, false, 0)
+	vendoredDir := filepath.Join(projectDir, "vendor", "E@v1.1.0")
+	if _, err := os.Stat(filepath.Join(vendoredDir, "Project.json")); err != nil {
+		t.Fatalf("Expected E@v1.1.0 to be vendored: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(projectDir, "vendor", "vendor.json"))
+	if err != nil {
+		t.Fatalf("Failed to read vendor.json: %v", err)
+	}
+	var manifest types.VendorManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Failed to parse vendor.json: %v", err)
+	}
+	specs := loadSpecs(t, tempDir, registryName, "E", "v1.1.0")
+	if len(manifest.Deps) != 1 || len(manifest.Dependencies) != 1 {
+		t.Fatalf("Expected one vendored dependency, got %+v", manifest)
+	}
+	for _, dep := range manifest.Dependencies {
+		if dep.Name != "E" || dep.Version != "v1.1.0" || dep.SHA1 != specs.SHA1 {
+			t.Errorf("Unexpected vendored dependency %+v", dep)
+		}
+	}
+
+	// Without the cached package and its registry entry, activation uses the vendored copies
+	for _, dir := range []string{filepath.Join(cosmDir, "packages", "E"), filepath.Join(cosmDir, "clones", specs.UUID), filepath.Join(registryDir, "E"), filepath.Join(projectDir, ".cosm")} {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatalf("Failed to remove %s: %v", dir, err)
+		}
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "activate")
+	checkOutput(t, stdout, stderr, "Using vendored build list for A in .cosm/buildlist.json\n"+activatedMessage, err, false, 0)
+	env, err := os.ReadFile(filepath.Join(projectDir, ".cosm", ".env"))
+	if err != nil {
+		t.Fatalf("Failed to read .env: %v", err)
+	}
+	if !strings.Contains(string(env), fmt.Sprintf("export E_PATH=\"%s\"", vendoredDir)) {
+		t.Errorf("Expected E_PATH to point to %s, got:\n%s", vendoredDir, env)
+	}
+	if _, err := os.Stat(filepath.Join(cosmDir, "packages", "E")); !os.IsNotExist(err) {
+		t.Errorf("Expected vendored package not to be materialized in the depot")
+	}
+
+	// Changing the dependencies makes the vendored copies outdated
+	projectFile := filepath.Join(projectDir, "Project.json")
+	project := loadProjectFile(t, projectFile)
+	project.Deps = nil
+	data, err = json.MarshalIndent(project, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal Project.json: %v", err)
+	}
+	if err := os.WriteFile(projectFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write Project.json: %v", err)
+	}
+	_, stderr, err = runCommand(t, projectDir, "activate")
+	if err != nil || !strings.Contains(stderr, "vendor/vendor.json is out of date") {
+		t.Errorf("Expected a warning about outdated vendored packages, got %q (err: %v)", stderr, err)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Create a template repository with a lua template
+	sourceDir := filepath.Join(tempDir, "mytemplates")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "lua", "app"), 0755); err != nil {
+		t.Fatalf("Failed to create template dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "lua", "app", "app.lua"), []byte("return 'app'\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template file: %v", err)
+	}
+	gitOutput(t, sourceDir, "init", "-b", "main")
+	gitOutput(t, sourceDir, "add", ".")
+	gitOutput(t, sourceDir, "commit", "-m", "Add lua/app")
+	sourceURL := "file://" + sourceDir
+
+	stdout, stderr, err := runCommand(t, tempDir, "template", "add", sourceURL)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Added template source 'mytemplates' from %s\n", sourceURL), err, false, 0)
+	if _, _, err := runCommand(t, tempDir, "template", "add", sourceURL); err == nil {
+		t.Errorf("Expected error when adding a template source twice")
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "template", "list")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Templates from 'default'") || !strings.HasSuffix(stdout, fmt.Sprintf("Templates from 'mytemplates' (%s):\n  - lua/app\n", sourceURL)) {
+		t.Errorf("Unexpected template list %q", stdout)
+	}
+
+	// Templates of added sources can be used by init
+	stdout, stderr, err = runCommand(t, tempDir, "init", "myapp", "--template", "lua/app")
+	checkOutput(t, stdout, stderr, "Initialized project 'myapp' with version v0.1.0 in myapp\n", err, false, 0)
+	data, err := os.ReadFile(filepath.Join(tempDir, "myapp", "myapp.lua"))
+	if err != nil || string(data) != "return 'myapp'\n" {
+		t.Errorf("Expected myapp/myapp.lua from the template, got %q (err: %v)", data, err)
+	}
+
+	// Updating pulls new templates
+	if err := os.MkdirAll(filepath.Join(sourceDir, "lua", "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create template dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "lua", "lib", "lib.lua"), []byte("return {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template file: %v", err)
+	}
+	gitOutput(t, sourceDir, "add", ".")
+	gitOutput(t, sourceDir, "commit", "-m", "Add lua/lib")
+	stdout, stderr, err = runCommand(t, tempDir, "template", "update", "mytemplates")
+	checkOutput(t, stdout, stderr, "Updated template source 'mytemplates'\n", err, false, 0)
+	if _, err := os.Stat(filepath.Join(tempDir, ".cosm", "template-sources", "mytemplates", "lua", "lib", "lib.lua")); err != nil {
+		t.Errorf("Expected lua/lib after update: %v", err)
+	}
+
+	// Removing a source
+	if _, _, err := runCommand(t, tempDir, "template", "remove", "default"); err == nil {
+		t.Errorf("Expected error when removing the default template source")
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "template", "remove", "mytemplates")
+	checkOutput(t, stdout, stderr, "Removed template source 'mytemplates'\n", err, false, 0)
+	if _, _, err := runCommand(t, tempDir, "init", "other", "--template", "lua/app"); err == nil {
+		t.Errorf("Expected error when using a template of a removed source")
+	}
+}
+
+func TestTemplatesClonedOnFirstUse(t *testing.T) {
+	// Creating the depot succeeds when the templates cannot be cloned
+	t.Setenv("COSM_TEMPLATES_URL", "file:///nonexistent/templates.git")
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	templatesDir := filepath.Join(tempDir, ".cosm", "templates")
+	if entries, err := os.ReadDir(templatesDir); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected an empty templates directory, got %v (err: %v)", entries, err)
+	}
+
+	// Create a template repository
+	sourceDir := filepath.Join(tempDir, "templates-src")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "terra", "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create template dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "terra", "lib", "lib.t"), []byte("return {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template file: %v", err)
+	}
+	gitOutput(t, sourceDir, "init", "-b", "main")
+	gitOutput(t, sourceDir, "add", ".")
+	gitOutput(t, sourceDir, "commit", "-m", "Add terra/lib")
+
+	// The templates are cloned from the configured URL on first use
+	sourceURL := "file://" + sourceDir
+	t.Setenv("COSM_TEMPLATES_URL", sourceURL)
+	stdout, stderr, err := runCommand(t, tempDir, "template", "list")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Templates from 'default' (%s):\n  - terra/lib\n", sourceURL), err, false, 0)
+
+	// An empty URL disables the default templates
+	if err := os.RemoveAll(templatesDir); err != nil {
+		t.Fatalf("Failed to remove templates: %v", err)
+	}
+	if err := os.Mkdir(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
+	}
+	t.Setenv("COSM_TEMPLATES_URL", "")
+	stdout, stderr, err = runCommand(t, tempDir, "template", "list")
+	checkOutput(t, stdout, stderr, "Templates from 'default' (no remote):\n  No templates.\n", err, false, 0)
+}
+
+// TestLogging tests the verbosity and format flags
+func TestLogging(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	// -v shows the git commands with their durations, -vv also their output
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "update", registryName, "-v")
+	if err != nil || stdout != fmt.Sprintf("Updated registry '%s'\n", registryName) || !strings.Contains(stderr, "[debug] Ran 'git ls-remote") || strings.Contains(stderr, "[trace]") {
+		t.Errorf("Unexpected output with -v: %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+	if _, stderr, err = runCommand(t, tempDir, "registry", "update", registryName, "-vv"); err != nil || !strings.Contains(stderr, "[trace] Output of 'git") {
+		t.Errorf("Expected command output with -vv, got stderr %q (err: %v)", stderr, err)
+	}
+
+	// --quiet suppresses everything but errors
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "update", registryName, "--quiet")
+	checkOutput(t, stdout, stderr, "", err, false, 0)
+	_, stderr, err = runCommand(t, tempDir, "registry", "update", "unknown", "-q")
+	if err == nil || !strings.HasPrefix(stderr, "Error: ") {
+		t.Errorf("Expected an error with --quiet, got stderr %q (err: %v)", stderr, err)
+	}
+
+	// JSON records for CI go to stderr, so that they do not mix with the output of --json
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "update", registryName, "--log-format", "json")
+	var record struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}
+	if err != nil || stdout != "" || json.Unmarshal([]byte(stderr), &record) != nil || record.Level != "info" || record.Msg != fmt.Sprintf("Updated registry '%s'", registryName) {
+		t.Errorf("Expected a JSON record on stderr, got stdout %q and stderr %q (err: %v)", stdout, stderr, err)
+	}
+	_, stderr, _ = runCommand(t, tempDir, "registry", "update", "unknown", "--log-format", "json")
+	if json.Unmarshal([]byte(stderr), &record) != nil || record.Level != "error" {
+		t.Errorf("Expected a JSON error record, got %q", stderr)
+	}
+
+	for _, args := range [][]string{{"registry", "update", registryName, "-q", "-v"}, {"registry", "update", registryName, "--log-format", "xml"}} {
+		if _, _, err := runCommand(t, tempDir, args...); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+// TestRegistryUpdateSkipsUnchanged tests that registry update only pulls if the remote branch moved
+func TestRegistryUpdateSkipsUnchanged(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	gitURL, registryDir := setupRegistry(t, tempDir, registryName)
+
+	stdout, stderr, err := runCommand(t, tempDir, "registry", "update", registryName, "-v")
+	if err != nil || stdout != fmt.Sprintf("Updated registry '%s'\n", registryName) || strings.Contains(stderr, "Ran 'git pull") {
+		t.Errorf("Expected the pull to be skipped, got %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+
+	// Push a commit to the registry from another clone
+	otherDir := filepath.Join(tempDir, "other")
+	gitOutput(t, tempDir, "clone", gitURL, otherDir)
+	if err := os.WriteFile(filepath.Join(otherDir, "NOTES"), []byte("notes\n"), 0644); err != nil {
+		t.Fatalf("Failed to write NOTES: %v", err)
+	}
+	commitAndPushPackageChanges(t, otherDir, "Add notes")
+
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "update", registryName, "-v")
+	if err != nil || !strings.Contains(stderr, "Ran 'git pull") {
+		t.Errorf("Expected a pull after the remote moved, got %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+	if _, err := os.Stat(filepath.Join(registryDir, "NOTES")); err != nil {
+		t.Errorf("Expected NOTES to be pulled into the registry: %v", err)
+	}
+}
+
+// TestErrorExitCodes tests the exit codes of the error kinds and JSON error objects
+func TestErrorExitCodes(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	t.Setenv("COSM_RETRIES", "0") // Fail the clone of an unreachable registry at once
+
+	for _, tc := range []struct {
+		args     []string
+		exitCode int
+	}{
+		{[]string{"registry", "status", registryName, "--sort", "size"}, 2},
+		{[]string{"registry", "status", registryName, "--unknown-flag"}, 2},
+		{[]string{"registry", "status", "unknown"}, 3},
+		{[]string{"registry", "init", registryName, createBareRepo(t, tempDir, "other.git")}, 4},
+		{[]string{"registry", "clone", "http://127.0.0.1:1/registry.git"}, 5},
+	} {
+		stdout, stderr, err := runCommand(t, tempDir, tc.args...)
+		checkOutput(t, stdout, stderr, "", err, true, tc.exitCode)
+	}
+
+	stdout, stderr, err := runCommand(t, tempDir, "search", "x", "--registry", "unknown", "--json")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 || stderr != "" {
+		t.Errorf("Expected exit code 3 without stderr, got %v (stderr: %q)", err, stderr)
+	}
+	var result struct {
+		Error struct {
+			Kind     string `json:"kind"`
+			Message  string `json:"message"`
+			ExitCode int    `json:"exitcode"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON error %q: %v", stdout, err)
+	}
+	if result.Error.Kind != "not_found" || result.Error.Message != "registry 'unknown' not found in registries.json" || result.Error.ExitCode != 3 {
+		t.Errorf("Unexpected JSON error %+v", result.Error)
+	}
+}
+
+// TestCompletion tests the completion scripts and the dynamic completion of registries, packages and versions
+func TestCompletion(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "mypkg", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, "mypkg", "v1.0.0")
+
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		stdout, stderr, err := runCommand(t, tempDir, "completion", shell)
+		if err != nil || !strings.Contains(stdout, "cosm") {
+			t.Errorf("Expected a %s completion script, got error %v (stderr: %q)", shell, err, stderr)
+		}
+	}
+	if _, _, err := runCommand(t, tempDir, "completion", "tcsh"); err == nil {
+		t.Errorf("Expected error for an unsupported shell")
+	}
+
+	// Completions are printed one per line, followed by the directive
+	complete := func(dir string, args ...string) string {
+		t.Helper()
+		stdout, stderr, err := runCommand(t, dir, append([]string{"__completeNoDesc"}, args...)...)
+		if err != nil {
+			t.Fatalf("Completion of %v failed: %v (stderr: %q)", args, err, stderr)
+		}
+		return stdout[:strings.LastIndex(stdout, ":")]
+	}
+	for _, tc := range []struct {
+		dir      string
+		args     []string
+		expected string
+	}{
+		{tempDir, []string{"registry", "status", ""}, "myreg\n"},
+		{tempDir, []string{"registry", "rm", registryName, ""}, "mypkg\n"},
+		{tempDir, []string{"registry", "rm", registryName, "mypkg", ""}, "v1.1.0\nv1.0.0\n"},
+		{tempDir, []string{"add", ""}, "mypkg\n"},
+		{tempDir, []string{"add", "mypkg@"}, "mypkg@v1.1.0\nmypkg@v1.0.0\n"},
+		{projectDir, []string{"rm", ""}, "mypkg\n"},
+		{projectDir, []string{"upgrade", "mypkg", ""}, "v1.1.0\nv1.0.0\n"},
+		{tempDir, []string{"config", "get", "off"}, "offline\n"},
+	} {
+		if got := complete(tc.dir, tc.args...); got != tc.expected {
+			t.Errorf("Completion of %v: expected %q, got %q", tc.args, tc.expected, got)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	stdout, _, err := runCommand(t, tempDir, "help", "topics")
+	if err != nil {
+		t.Fatalf("help topics failed: %v", err)
+	}
+	for _, topic := range []string{"depot", "registry-format", "mvs", "activation"} {
+		if !strings.Contains(stdout, "  "+topic+" ") {
+			t.Errorf("Expected topic %s in %q", topic, stdout)
+		}
+	}
+	stdout, _, err = runCommand(t, tempDir, "help", "mvs")
+	if err != nil || !strings.Contains(stdout, "minimal version selection") {
+		t.Errorf("Expected the mvs topic, got %q (error: %v)", stdout, err)
+	}
+	stdout, _, err = runCommand(t, tempDir, "help", "registry", "status")
+	if err != nil || !strings.Contains(stdout, "cosm registry status [registry-name]") {
+		t.Errorf("Expected the help of registry status, got %q (error: %v)", stdout, err)
+	}
+	stdout, stderr, err := runCommand(t, tempDir, "help", "nope")
+	checkOutput(t, stdout, stderr, "", err, true, 3) // Not found
+
+	// Man pages are written for commands and topics
+	manDir := filepath.Join(tempDir, "man")
+	stdout, stderr, err = runCommand(t, tempDir, "man", "--dir", manDir)
+	if err != nil {
+		t.Fatalf("man failed: %v (stderr: %q)", err, stderr)
+	}
+	for _, page := range []string{"cosm.1", "cosm-registry-status.1", "cosm-mvs.7"} {
+		data, err := os.ReadFile(filepath.Join(manDir, page))
+		if err != nil || !strings.HasPrefix(string(data), ".TH ") {
+			t.Errorf("Expected man page %s, got %q (error: %v)", page, data, err)
+		}
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	_, registryDir := setupRegistry(t, tempDir, "myreg")
+
+	stdout, stderr, err := runCommand(t, tempDir, "doctor")
+	if err != nil {
+		t.Fatalf("doctor failed on a healthy depot: %v\n%s%s", err, stdout, stderr)
+	}
+	for _, expected := range []string{"[ok]   git ", "[ok]   registry 'myreg' on branch ", "[ok]   registry 'myreg' remote", "No problems found"} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, stdout)
+		}
+	}
+
+	// A detached registry clone and a broken symlink are reported with their fixes
+	if _, err := commands.GitCommand(context.Background(), registryDir, "checkout", "--detach"); err != nil {
+		t.Fatalf("Failed to detach HEAD: %v", err)
+	}
+	brokenLink := filepath.Join(tempDir, ".cosm", "packages", "broken")
+	if err := os.Symlink(filepath.Join(tempDir, "missing"), brokenLink); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	stdout, _, err = runCommand(t, tempDir, "doctor")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected exit code 1, got %v", err)
+	}
+	for _, expected := range []string{"[fail] registry 'myreg': detached HEAD", "fix: git -C " + registryDir + " checkout main", "[fail] symbolic links in the depot: 1 broken: " + brokenLink} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, stdout)
+		}
+	}
+
+	// Doctor does not create a missing depot
+	missingDepot := filepath.Join(tempDir, "missing-depot")
+	t.Setenv("COSM_DEPOT_PATH", missingDepot)
+	stdout, _, _ = runCommand(t, tempDir, "doctor")
+	if !strings.Contains(stdout, "[fail] COSM_DEPOT_PATH "+missingDepot+": does not exist") {
+		t.Errorf("Expected missing depot to be reported, got:\n%s", stdout)
+	}
+	if _, err := os.Stat(missingDepot); !os.IsNotExist(err) {
+		t.Errorf("Expected doctor not to create the depot, got %v", err)
+	}
+}
+
+func TestNonInteractiveDepot(t *testing.T) {
+	tempDir := t.TempDir()
+	setupTempGitConfig(t, tempDir)
+	env := append(os.Environ(), "HOME="+tempDir, "COSM_DEPOT_PATH=", "COSM_TEMPLATES_URL=", "SHELL=/bin/bash")
+
+	// Without a depot, --no-input fails instead of waiting for the location
+	cmd := exec.Command(binaryPath, "search", "foo", "--no-input")
+	cmd.Dir = tempDir
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("Expected exit code 2, got %v (stderr: %s)", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "COSM_DEPOT_PATH is not set; export it, or use --yes") {
+		t.Errorf("Expected missing depot error, got %q", stderr.String())
+	}
+
+	// COSM_YES accepts the default location
+	cmd = exec.Command(binaryPath, "search", "foo")
+	cmd.Dir = tempDir
+	cmd.Env = append(env, "COSM_YES=1")
+	if output, err := cmd.CombinedOutput(); err != nil && !strings.Contains(string(output), "COSM_DEPOT_PATH set to") {
+		t.Fatalf("Expected depot to be created, got %v: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, ".cosm", "registries", "registries.json")); err != nil {
+		t.Errorf("Expected depot in the default location: %v", err)
+	}
+}
+
+// TestAddMultipleDependencies tests adding several dependencies with one cosm add
+func TestAddMultipleDependencies(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	for _, packageName := range []string{"pkga", "pkgb"} {
+		packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		releasePackage(t, packageDir, "v1.1.0")
+		releasePackage(t, packageDir, "v2.0.0")
+		addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	}
+	projectDir := initPackage(t, tempDir, "myproject")
+	projectFile := filepath.Join(projectDir, "Project.json")
+
+	// A missing package leaves Project.json unchanged
+	before, err := os.ReadFile(projectFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := runCommand(t, projectDir, "add", "pkga@v1.0.0", "nopkg")
+	if err == nil || !strings.Contains(stderr, "nopkg") {
+		t.Errorf("Expected error for a missing package, got %q (err: %v)", stderr, err)
+	}
+	if after, _ := os.ReadFile(projectFile); string(after) != string(before) {
+		t.Errorf("Expected Project.json to be unchanged, got %s", after)
+	}
+
+	// An exact version and the latest version of a major version
+	stdout, stderr, err := runCommand(t, projectDir, "add", "pkga@v1.0.0", "pkgb@v1")
+	expectedOutput := fmt.Sprintf("Added dependency 'pkga' v1.0.0 from registry '%s' to project\nAdded dependency 'pkgb' v1.1.0 from registry '%s' to project\n", registryName, registryName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+	verifyProjectDependencies(t, projectFile, "pkga", "v1.0.0")
+	verifyProjectDependencies(t, projectFile, "pkgb", "v1.1.0")
+
+	// --as cannot be used with several dependencies
+	if _, _, err := runCommand(t, projectDir, "add", "pkga@v2.0.0", "pkgb@v2.0.0", "--as", "other"); err == nil {
+		t.Errorf("Expected error for --as with several dependencies")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	stdout, stderr, err := runCommand(t, tempDir, "config", "set", "author", "[Jane]jane@example.com")
+	checkOutput(t, stdout, stderr, "Set author to '[Jane]jane@example.com'\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "config", "set", "license", "MIT")
+	checkOutput(t, stdout, stderr, "Set license to 'MIT'\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "config", "get", "author")
+	checkOutput(t, stdout, stderr, "[Jane]jane@example.com\n", err, false, 0)
+
+	// Invalid keys and values are rejected
+	if _, _, err := runCommand(t, tempDir, "config", "set", "color", "blue"); err == nil {
+		t.Errorf("Expected error for an unknown config key")
+	}
+	if _, _, err := runCommand(t, tempDir, "config", "set", "parallelism", "many"); err == nil {
+		t.Errorf("Expected error for an invalid parallelism")
+	}
+
+	// New projects use the configured author and license
+	stdout, stderr, err = runCommand(t, tempDir, "init", "myproject")
+	checkOutput(t, stdout, stderr, "Initialized project 'myproject' with version v0.1.0\n", err, false, 0)
+	project := loadProjectFile(t, filepath.Join(tempDir, "Project.json"))
+	if len(project.Authors) != 1 || project.Authors[0] != "[Jane]jane@example.com" || project.License != "MIT" {
+		t.Errorf("Expected configured author and license, got %v and %q", project.Authors, project.License)
+	}
+
+	// Environment variables override the configuration file
+	t.Setenv("COSM_OFFLINE", "true")
+	stdout, stderr, err = runCommand(t, tempDir, "config", "list")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "author = [Jane]jane@example.com\n") || !strings.Contains(stdout, "offline = true (from COSM_OFFLINE)\n") {
+		t.Errorf("Unexpected config list %q", stdout)
+	}
+	if _, _, err := runCommand(t, tempDir, "registry", "update", "--all"); err == nil {
+		t.Errorf("Expected error when updating registries in offline mode")
+	}
+
+	// The network timeout can be configured and overridden on the command line
+	stdout, stderr, err = runCommand(t, tempDir, "config", "set", "timeout", "5m")
+	checkOutput(t, stdout, stderr, "Set timeout to '5m'\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "config", "set", "retries", "0")
+	checkOutput(t, stdout, stderr, "Set retries to '0'\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "config", "get", "timeout", "--timeout", "90s")
+	checkOutput(t, stdout, stderr, "90s\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "config", "get", "timeout", "--timeout", "soon")
+	checkOutput(t, stdout, stderr, "", err, true, 2) // Validation
+}
+
+func TestSearch(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRegistry(t, tempDir, "reg1")
+	setupRegistry(t, tempDir, "reg2")
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "mathlib", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, "reg1", gitURL)
+	addPackageToRegistry(t, tempDir, "reg2", gitURL)
+	_, otherURL := setupPackageWithGit(t, tempDir, "MathUtils", "v0.1.0")
+	addPackageToRegistry(t, tempDir, "reg2", otherURL)
+
+	stdout, stderr, err := runCommand(t, tempDir, "search", "math")
+	checkOutput(t, stdout, stderr, "MathUtils no releases (reg2)\nmathlib v1.1.0 (reg1)\nmathlib v1.1.0 (reg2)\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "search", "^math(lib)?$", "--regex", "--registry", "reg2")
+	checkOutput(t, stdout, stderr, "mathlib v1.1.0 (reg2)\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "search", "physics")
+	checkOutput(t, stdout, stderr, "No packages found matching 'physics'\n", err, false, 0)
+	if _, _, err := runCommand(t, tempDir, "search", "math", "--registry", "unknown"); err == nil {
+		t.Errorf("Expected error for an unknown registry")
+	}
+
+	stdout, stderr, err = runCommand(t, tempDir, "search", "lib", "--json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	var results []map[string]string
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("Failed to parse JSON output %q: %v", stdout, err)
+	}
+	if len(results) != 2 || results[0]["name"] != "mathlib" || results[0]["registry"] != "reg1" || results[0]["version"] != "v1.1.0" || results[0]["giturl"] != gitURL {
+		t.Errorf("Unexpected JSON results %v", results)
+	}
+}
+
+// TestInfo tests the details of a package and the local projects that use it
+func TestInfo(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "E", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	specsE := loadSpecs(t, tempDir, registryName, "E", "v1.1.0")
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "B", "v1.0.0")
+	addDependencyToProject(t, packageDir, "E", "v1.0.0")
+	commitAndPushPackageChanges(t, packageDir, "added E@v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	specsB := loadSpecs(t, tempDir, registryName, "B", "v1.0.0")
+
+	stdout, stderr, err := runCommand(t, tempDir, "info", "B")
+	expected := fmt.Sprintf("Package 'B' in registry '%s':\n  UUID: %s\n  Git URL: %s\n  Latest: v1.0.0\n  Versions: v1.0.0\n  Dependencies of v1.0.0:\n    - E v1.0.0\nNot used by any local project\n", registryName, specsB.UUID, gitURL)
+	checkOutput(t, stdout, stderr, expected, err, false, 0)
+
+	// A project that requires B and E v1.1.0 uses E v1.1.0 directly
+	projectDir := initPackage(t, tempDir, "A")
+	if _, stderr, err := runCommand(t, projectDir, "add", "B@v1.0.0", "E@v1.1.0"); err != nil {
+		t.Fatalf("Failed to add dependencies: %v\nStderr: %s", err, stderr)
+	}
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, tempDir, "info", "E@v1.0.0", "--json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	var details struct {
+		Name       string `json:"name"`
+		Registries []struct {
+			Registry string `json:"registry"`
+			UUID     string `json:"uuid"`
+			Latest   string `json:"latest"`
+			Version  string `json:"version"`
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"registries"`
+		UsedBy []struct {
+			Project string `json:"project"`
+			Version string `json:"version"`
+			Direct  bool   `json:"direct"`
+		} `json:"usedby"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &details); err != nil {
+		t.Fatalf("Failed to parse JSON output %q: %v", stdout, err)
+	}
+	if len(details.Registries) != 1 || details.Registries[0].UUID != specsE.UUID || details.Registries[0].Latest != "v1.1.0" || details.Registries[0].Version != "v1.0.0" || len(details.Registries[0].Versions) != 2 {
+		t.Errorf("Unexpected registry entries %+v", details.Registries)
+	}
+	// The working directory of B has a build list too
+	if len(details.UsedBy) != 2 || details.UsedBy[0].Project != projectDir || details.UsedBy[0].Version != "v1.1.0" || !details.UsedBy[0].Direct || details.UsedBy[1].Project != packageDir {
+		t.Errorf("Expected E v1.1.0 to be used directly by %s and E v1.0.0 by %s, got %+v", projectDir, packageDir, details.UsedBy)
+	}
+
+	_, _, err = runCommand(t, tempDir, "info", "E@v9.9.9")
+	if err == nil {
+		t.Errorf("Expected error for an unknown version")
+	}
+}
+
+// TestClone tests cloning the source of a registered package at a released version
+func TestClone(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "mathlib", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	workDir := filepath.Join(tempDir, "work")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		t.Fatalf("Failed to create work dir: %v", err)
+	}
+
+	// Without a version the latest release is checked out at its tag
+	stdout, stderr, err := runCommand(t, workDir, "clone", "mathlib")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Cloned package 'mathlib' v1.1.0 from registry '%s' to mathlib\n", registryName), err, false, 0)
+	verifyProjectVersion(t, filepath.Join(workDir, "mathlib", "Project.json"), "v1.1.0")
+	if remote := strings.TrimSpace(gitOutput(t, filepath.Join(workDir, "mathlib"), "remote", "get-url", "origin")); remote != gitURL {
+		t.Errorf("Expected origin %s, got %s", gitURL, remote)
+	}
+
+	stdout, stderr, err = runCommand(t, workDir, "clone", "mathlib@v1.0.0", "old")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Cloned package 'mathlib' v1.0.0 from registry '%s' to old\n", registryName), err, false, 0)
+	verifyProjectVersion(t, filepath.Join(workDir, "old", "Project.json"), "v1.0.0")
+	specs := loadSpecs(t, tempDir, registryName, "mathlib", "v1.0.0")
+	if head := strings.TrimSpace(gitOutput(t, filepath.Join(workDir, "old"), "rev-parse", "HEAD")); head != specs.SHA1 {
+		t.Errorf("Expected HEAD at %s, got %s", specs.SHA1, head)
+	}
+
+	_, _, err = runCommand(t, workDir, "clone", "mathlib")
+	if err == nil {
+		t.Errorf("Expected error when the destination exists")
+	}
+	_, _, err = runCommand(t, workDir, "clone", "unknown")
+	if err == nil {
+		t.Errorf("Expected error for an unknown package")
+	}
+}
+
+// TestPackageMetadata tests that descriptive metadata in Project.json is published with each version
+func TestPackageMetadata(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	packageName := "mathlib"
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+	projectFile := filepath.Join(packageDir, "Project.json")
+	project := loadProjectFile(t, projectFile)
+	project.Description = "Linear algebra routines"
+	project.Keywords = []string{"matrix", "vector"}
+	project.License = "MIT"
+	project.Homepage = "https://example.com/mathlib"
+	data, _ := json.MarshalIndent(project, "", "  ")
+	if err := os.WriteFile(projectFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write Project.json: %v", err)
+	}
+	gitOutput(t, packageDir, "commit", "-am", "Add metadata")
+	gitOutput(t, packageDir, "push", "origin", "main")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	specs := loadSpecs(t, tempDir, registryName, packageName, "v1.1.0")
+	if specs.Description != project.Description || strings.Join(specs.Keywords, ",") != "matrix,vector" || specs.License != "MIT" || specs.Homepage != project.Homepage {
+		t.Errorf("Expected metadata of Project.json in specs.json, got %+v", specs)
+	}
+
+	// Search matches keywords and shows the description
+	stdout, stderr, err := runCommand(t, tempDir, "search", "matrix")
+	checkOutput(t, stdout, stderr, "mathlib v1.1.0 (myreg) - Linear algebra routines\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "status", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Registry Status for '%s':\n  Packages:\n    - mathlib (UUID: %s), 1 version(s), latest v1.1.0, last published %s: Linear algebra routines\n", registryName, project.UUID, time.Now().Format("2006-01-02")), err, false, 0)
+}
+
+func TestSbom(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	// Package G with a license, and package F that depends on G
+	t.Setenv("COSM_LICENSE", "MIT")
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	os.Unsetenv("COSM_LICENSE")
+	gSpecs := loadSpecs(t, tempDir, registryName, "G", "v1.1.0")
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "F", "v1.1.0")
+	addDependencyToProject(t, packageDir, "G", "v1.1.0")
+	commitAndPushPackageChanges(t, packageDir, "added G@v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	fSpecs := loadSpecs(t, tempDir, registryName, "F", "v1.1.0")
+
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, "F", "v1.1.0")
+	project := loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	fRef := fSpecs.UUID + "@v1.1.0"
+	gRef := gSpecs.UUID + "@v1.1.0"
+
+	// CycloneDX
+	stdout, stderr, err := runCommand(t, projectDir, "sbom")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\nStderr: %s", err, stderr)
+	}
+	var bom struct {
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			BOMRef   string `json:"bom-ref"`
+			Name     string `json:"name"`
+			Version  string `json:"version"`
+			Licenses []struct {
+				License struct {
+					Name string `json:"name"`
+				} `json:"license"`
+			} `json:"licenses"`
+			Hashes []struct {
+				Content string `json:"content"`
+			} `json:"hashes"`
+		} `json:"components"`
+		Dependencies []struct {
+			Ref       string   `json:"ref"`
+			DependsOn []string `json:"dependsOn"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &bom); err != nil {
+		t.Fatalf("Failed to parse CycloneDX output %q: %v", stdout, err)
+	}
+	if bom.BOMFormat != "CycloneDX" || len(bom.Components) != 2 {
+		t.Fatalf("Expected a CycloneDX document with 2 components, got %+v", bom)
+	}
+	if g := bom.Components[1]; g.Name != "G" || g.BOMRef != gRef || len(g.Licenses) != 1 || g.Licenses[0].License.Name != "MIT" || g.Hashes[0].Content != gSpecs.SHA1 {
+		t.Errorf("Unexpected component for G: %+v", g)
+	}
+	expectedDeps := fmt.Sprintf("%s@v0.1.0->[%s] %s->[%s] %s->[]", project.UUID, fRef, fRef, gRef, gRef)
+	var deps []string
+	for _, dep := range bom.Dependencies {
+		deps = append(deps, fmt.Sprintf("%s->[%s]", dep.Ref, strings.Join(dep.DependsOn, " ")))
+	}
+	if strings.Join(deps, " ") != expectedDeps {
+		t.Errorf("Expected dependencies %q, got %q", expectedDeps, strings.Join(deps, " "))
+	}
+
+	// SPDX written to a file
+	stdout, stderr, err = runCommand(t, projectDir, "sbom", "--format", "spdx", "--output", "sbom.spdx.json")
+	checkOutput(t, stdout, stderr, "Wrote spdx SBOM of myproject with 2 package(s) to sbom.spdx.json\n", err, false, 0)
+	data, err := os.ReadFile(filepath.Join(projectDir, "sbom.spdx.json"))
+	if err != nil {
+		t.Fatalf("Failed to read SPDX output: %v", err)
+	}
+	var spdx struct {
+		SPDXVersion string `json:"spdxVersion"`
+		Packages    []struct {
+			Name             string `json:"name"`
+			DownloadLocation string `json:"downloadLocation"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+		} `json:"packages"`
+		Relationships []struct {
+			RelationshipType string `json:"relationshipType"`
+		} `json:"relationships"`
+	}
+	if err := json.Unmarshal(data, &spdx); err != nil {
+		t.Fatalf("Failed to parse SPDX output: %v", err)
+	}
+	if spdx.SPDXVersion != "SPDX-2.3" || len(spdx.Packages) != 3 || len(spdx.Relationships) != 3 {
+		t.Fatalf("Expected an SPDX document with 3 packages and 3 relationships, got %+v", spdx)
+	}
+	if g := spdx.Packages[2]; g.Name != "G" || g.LicenseDeclared != "MIT" || g.DownloadLocation != fmt.Sprintf("git+%s@%s", gSpecs.GitURL, gSpecs.SHA1) {
+		t.Errorf("Unexpected SPDX package for G: %+v", g)
+	}
+
+	if _, _, err := runCommand(t, projectDir, "sbom", "--format", "xml"); err == nil {
+		t.Errorf("Expected error for an unknown format")
+	}
+}
+
+// TestLicenses tests the license report of the build list and the allow and deny lists
+func TestLicenses(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+
+	// G declares its license in Project.json, F only has a LICENSE file
+	t.Setenv("COSM_LICENSE", "MIT")
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.1.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	os.Unsetenv("COSM_LICENSE")
+	packageDir, gitURL = setupPackageWithGit(t, tempDir, "F", "v1.1.0")
+	addDependencyToProject(t, packageDir, "G", "v1.1.0")
+	license := "                                 Apache License\n                           Version 2.0, January 2004\n"
+	if err := os.WriteFile(filepath.Join(packageDir, "LICENSE"), []byte(license), 0644); err != nil {
+		t.Fatalf("Failed to write LICENSE: %v", err)
+	}
+	commitAndPushPackageChanges(t, packageDir, "added G@v1.1.0 and a license")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, "F", "v1.1.0")
+	stdout, stderr, err := runCommand(t, projectDir, "licenses")
+	checkOutput(t, stdout, stderr, "F v1.1.0: unknown\nG v1.1.0: MIT\n", err, false, 0)
+
+	// The license file is read from the cached package once the project is activated
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "licenses")
+	checkOutput(t, stdout, stderr, "F v1.1.0: Apache-2.0 (detected from LICENSE)\nG v1.1.0: MIT\n", err, false, 0)
+
+	stdout, stderr, err = runCommand(t, projectDir, "licenses", "--allow", "MIT")
+	checkOutput(t, stdout, stderr, "F v1.1.0: Apache-2.0 (detected from LICENSE) [not allowed]\nG v1.1.0: MIT\n", err, true, 1)
+	stdout, stderr, err = runCommand(t, projectDir, "licenses", "--deny", "apache-2.0")
+	checkOutput(t, stdout, stderr, "F v1.1.0: Apache-2.0 (detected from LICENSE) [denied]\nG v1.1.0: MIT\n", err, true, 1)
+	stdout, stderr, err = runCommand(t, projectDir, "licenses", "--allow", "MIT,Apache-2.0")
+	checkOutput(t, stdout, stderr, "F v1.1.0: Apache-2.0 (detected from LICENSE)\nG v1.1.0: MIT\nAll 2 package(s) comply with the license policy\n", err, false, 0)
+}
+
+// TestDaemon tests the JSON-RPC API of the daemon and the pre-warming of watched projects
+func TestDaemon(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	for _, packageName := range []string{"pkga", "pkgb"} {
+		packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	}
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, "pkga", "v1.0.0")
+
+	socketPath := filepath.Join(tempDir, "daemon.sock")
+	var stdout bytes.Buffer
+	daemon := exec.Command(binaryPath, "daemon", "--socket", socketPath, "--poll", "100ms")
+	daemon.Stdout = &stdout
+	daemon.Stderr = &stdout
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Failed to start daemon: %v", err)
+	}
+	defer daemon.Process.Kill()
+	var conn net.Conn
+	for i := 0; i < 100 && conn == nil; i++ {
+		conn, _ = net.Dial("unix", socketPath)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatalf("Daemon did not listen on %s; output: %s", socketPath, stdout.String())
+	}
+	defer conn.Close()
+	responses := bufio.NewScanner(conn)
+	call := func(method string, params map[string]any) (json.RawMessage, map[string]any) {
+		t.Helper()
+		request, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		if _, err := conn.Write(append(request, '\n')); err != nil {
+			t.Fatalf("Failed to send %s request: %v", method, err)
+		}
+		if !responses.Scan() {
+			t.Fatalf("No response to %s request: %v", method, responses.Err())
+		}
+		var response struct {
+			Result json.RawMessage `json:"result"`
+			Error  map[string]any  `json:"error"`
+		}
+		if err := json.Unmarshal(responses.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response %q: %v", responses.Text(), err)
+		}
+		return response.Result, response.Error
+	}
+
+	result, rpcErr := call("search", map[string]any{"query": "pkg"})
+	var found []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(result, &found); rpcErr != nil || err != nil || len(found) != 2 || found[0].Name != "pkga" || found[1].Version != "v1.0.0" {
+		t.Errorf("Unexpected search result %s (error: %v)", result, rpcErr)
+	}
+
+	result, rpcErr = call("resolve", map[string]any{"project": projectDir})
+	var buildList types.BuildList
+	if err := json.Unmarshal(result, &buildList); rpcErr != nil || err != nil || len(buildList.Dependencies) != 1 {
+		t.Errorf("Unexpected build list %s (error: %v)", result, rpcErr)
+	}
+
+	result, rpcErr = call("add", map[string]any{"project": projectDir, "name": "pkgb"})
+	if rpcErr != nil || !strings.Contains(string(result), `"version":"v1.0.0"`) {
+		t.Errorf("Unexpected add result %s (error: %v)", result, rpcErr)
+	}
+	verifyProjectDependencies(t, filepath.Join(projectDir, "Project.json"), "pkgb", "v1.0.0")
+
+	// The request is recorded in the journal as an operation of its own while the daemon runs
+	journal, err := os.ReadFile(filepath.Join(tempDir, ".cosm", "logs", "journal.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to read the journal: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(journal)), "\n")
+	var entry struct {
+		Command string `json:"command"`
+		Dir     string `json:"dir"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry); err != nil || entry.Command != "cosm daemon add pkgb" || entry.Dir != projectDir {
+		t.Errorf("Expected the add request as the last operation in the journal, got %+v (err: %v)", entry, err)
+	}
+
+	if _, rpcErr = call("resolve", map[string]any{"project": "myproject"}); rpcErr == nil || rpcErr["data"].(map[string]any)["exitcode"] != float64(2) {
+		t.Errorf("Expected a validation error for a relative project, got %v", rpcErr)
+	}
+	if _, rpcErr = call("build", nil); rpcErr == nil || rpcErr["code"] != float64(-32601) {
+		t.Errorf("Expected method not found, got %v", rpcErr)
+	}
+
+	// A watched project gets its packages in the depot without being activated
+	if _, rpcErr = call("watch", map[string]any{"project": projectDir}); rpcErr != nil {
+		t.Fatalf("Failed to watch project: %v", rpcErr)
+	}
+	specs := loadSpecs(t, tempDir, registryName, "pkgb", "v1.0.0")
+	pkgPath := filepath.Join(tempDir, ".cosm", "packages", "pkgb", specs.SHA1)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(pkgPath); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := os.Stat(pkgPath); err != nil {
+		t.Errorf("Expected the daemon to pre-warm %s: %v\nOutput: %s", pkgPath, err, stdout.String())
+	}
+
+	if err := daemon.Process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("Failed to interrupt daemon: %v", err)
+	}
+	if err := daemon.Wait(); err != nil {
+		t.Errorf("Expected the daemon to exit cleanly: %v\nOutput: %s", err, stdout.String())
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed, got %v", err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	_, registryDir := setupRegistry(t, tempDir, registryName)
+
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	releasePackage(t, packageDir, "v1.1.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, "G", "v1.0.0")
+
+	stdout, stderr, err := runCommand(t, projectDir, "audit")
+	checkOutput(t, stdout, stderr, "No known vulnerabilities in 1 package(s)\n", err, false, 0)
+
+	// Publish an advisory for G in the registry
+	advisory := types.Advisory{
+		ID:       "COSM-2026-0001",
+		Summary:  "Remote code execution",
+		Severity: "high",
+		Affected: []string{">=v1.0.0, <v1.1.0"},
+		Patched:  "v1.1.0",
+	}
+	data, _ := json.MarshalIndent(advisory, "", "  ")
+	if err := os.MkdirAll(filepath.Join(registryDir, "advisories", "G"), 0755); err != nil {
+		t.Fatalf("Failed to create advisories directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(registryDir, "advisories", "G", "COSM-2026-0001.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write advisory: %v", err)
+	}
+	gitOutput(t, registryDir, "add", ".")
+	gitOutput(t, registryDir, "commit", "-m", "Add advisory")
+	gitOutput(t, registryDir, "push", "origin", "HEAD")
+
+	stdout, stderr, err = runCommand(t, projectDir, "audit")
+	checkOutput(t, stdout, stderr, "G@v1.0.0: COSM-2026-0001 (high) Remote code execution [myreg]; fixed in v1.1.0\n", err, true, 1)
+	if stderr != "Error: found 1 advisory(ies) affecting 1 package(s)\n" {
+		t.Errorf("Unexpected stderr %q", stderr)
+	}
+
+	// The patched version is not affected, and advisories are not orphaned registry directories
+	patchedDir, _ := setupPackageWithGit(t, tempDir, "patched", "v0.1.0")
+	addDependencyToProject(t, patchedDir, "G", "v1.1.0")
+	stdout, stderr, err = runCommand(t, patchedDir, "audit")
+	checkOutput(t, stdout, stderr, "No known vulnerabilities in 1 package(s)\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, tempDir, "registry", "audit", registryName)
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Audit of registry '%s' found no problems\n", registryName), err, false, 0)
+}
+
+// TestCacheArchive tests archiving packages, uploading them to an artifact store and installing them from it
+func TestCacheArchive(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "pkgA", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	addDependencyToProject(t, projectDir, "pkgA", "v1.0.0")
+	specs := loadSpecs(t, tempDir, registryName, "pkgA", "v1.0.0")
+	depotDir := filepath.Join(tempDir, ".cosm")
+
+	// Without an artifact store the archives are only written to the depot
+	if _, _, err := runCommand(t, projectDir, "cache", "archive", "--upload"); err == nil {
+		t.Errorf("Expected --upload to fail without archiveurl")
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "cache", "archive")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Archived 1 package version(s) in %s\n", filepath.Join(depotDir, "archives")), err, false, 0)
+	if _, err := os.Stat(filepath.Join(depotDir, "archives", specs.UUID, specs.SHA1+".tar.gz")); err != nil {
+		t.Errorf("Expected archive in the depot: %v", err)
+	}
+
+	storeDir := filepath.Join(tempDir, "store")
+	t.Setenv("COSM_ARCHIVE_URL", "file://"+storeDir)
+	stdout, stderr, err = runCommand(t, projectDir, "cache", "archive", "--upload")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("Archived 0 package version(s) in %s\nUploaded 1 archive(s) to file://%s\n", filepath.Join(depotDir, "archives"), storeDir), err, false, 0)
+	if _, err := os.Stat(filepath.Join(storeDir, specs.UUID, specs.SHA1+".tar.gz")); err != nil {
+		t.Errorf("Expected archive in the store: %v", err)
+	}
+
+	// A fresh depot installs the package from the store without cloning it
+	for _, dir := range []string{"packages", "clones", "archives"} {
+		if err := os.RemoveAll(filepath.Join(depotDir, dir)); err != nil {
+			t.Fatalf("Failed to remove %s: %v", dir, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	_, stderr, err = runCommand(t, projectDir, "activate", "-v")
+	if err != nil || strings.Contains(stderr, "Ran 'git clone") || !strings.Contains(stderr, "Downloaded file://") {
+		t.Errorf("Expected the package to be installed from the store, got stderr %q (err: %v)", stderr, err)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "packages", "pkgA", specs.SHA1, "Project.json")); err != nil {
+		t.Errorf("Expected the package to be extracted: %v", err)
+	}
+
+	// An archive in the store that does not match the digest in the registry is not installed
+	if specs.Digest == "" {
+		t.Fatalf("Expected a digest in the specs of pkgA")
+	}
+	tamperedDir := filepath.Join(tempDir, "tampered")
+	if err := os.MkdirAll(tamperedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tamperedDir, "Project.json"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command("tar", "-czf", filepath.Join(storeDir, specs.UUID, specs.SHA1+".tar.gz"), "-C", tamperedDir, "Project.json").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to write the tampered archive: %v\n%s", err, output)
+	}
+	for _, dir := range []string{"packages", "archives"} {
+		if err := os.RemoveAll(filepath.Join(depotDir, dir)); err != nil {
+			t.Fatalf("Failed to remove %s: %v", dir, err)
+		}
+	}
+	_, stderr, err = runCommand(t, projectDir, "activate")
+	if err != nil || !strings.Contains(stderr, "does not match the digest") {
+		t.Errorf("Expected the tampered archive to be rejected, got stderr %q (err: %v)", stderr, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(depotDir, "packages", "pkgA", specs.SHA1, "Project.json")); err != nil || string(data) == "{}\n" {
+		t.Errorf("Expected the package to be installed from its clone, got %q (err: %v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "archives", specs.UUID, specs.SHA1+".tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("Expected the tampered archive to be removed from the depot (err: %v)", err)
+	}
+
+	t.Setenv("COSM_ARCHIVE_URL", "ftp://example.com")
+	if _, _, err := runCommand(t, projectDir, "cache", "archive"); err == nil {
+		t.Errorf("Expected an error for an invalid archiveurl")
+	}
+}
+
+// TestUndo tests that operations are recorded in the journal and reverted by cosm undo, most recent first
+func TestUndo(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, packageGitURL := setupPackageWithGit(t, tempDir, "pkga", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	projectDir := initPackage(t, tempDir, "myproject")
+	projectFile := filepath.Join(projectDir, "Project.json")
+
+	if _, stderr, err := runCommand(t, projectDir, "add", "pkga", "v1.0.0"); err != nil {
+		t.Fatalf("Failed to add pkga: %v\nStderr: %s", err, stderr)
+	}
+
+	// Files changed after the operation are not overwritten without --force
+	data, err := os.ReadFile(projectFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(projectFile, append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "undo")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	if !strings.Contains(stderr, "was changed after 'cosm add pkga v1.0.0'") {
+		t.Errorf("Expected the changed file to be reported, got %q", stderr)
+	}
+
+	// The last operation is undone first, also when it changed the depot
+	if _, stderr, err := runCommand(t, projectDir, "config", "set", "license", "MIT"); err != nil {
+		t.Fatalf("Failed to set the license: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "undo")
+	if err != nil || !strings.HasPrefix(stdout, "Undid 'cosm config set license MIT'") {
+		t.Errorf("Expected the license to be undone, got %q (err: %v, stderr: %q)", stdout, err, stderr)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "config", "get", "license")
+	checkOutput(t, stdout, stderr, "\n", err, false, 0)
+
+	stdout, stderr, err = runCommand(t, projectDir, "undo", "--force")
+	checkOutput(t, stdout, stderr, "Undid 'cosm add pkga v1.0.0' (Project.json)\n", err, false, 0)
+	if project := loadProjectFile(t, projectFile); len(project.Deps) != 0 {
+		t.Errorf("Expected no dependencies after undo, got %+v", project.Deps)
+	}
+
+	// Undoing init removes the created Project.json
+	stdout, stderr, err = runCommand(t, projectDir, "undo")
+	checkOutput(t, stdout, stderr, "Undid 'cosm init myproject' (Project.json)\n", err, false, 0)
+	if _, err := os.Stat(projectFile); !os.IsNotExist(err) {
+		t.Errorf("Expected Project.json to be removed, got err %v", err)
+	}
+
+	// Registry changes are committed and cannot be undone
+	stdout, stderr, err = runCommand(t, projectDir, "undo")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	if !strings.Contains(stderr, "cannot undo 'cosm registry add") {
+		t.Errorf("Expected the registry operation to be refused, got %q", stderr)
+	}
+
+	stdout, stderr, err = runCommand(t, projectDir, "undo", "--list")
+	if err != nil {
+		t.Fatalf("Failed to list the journal: %v\nStderr: %s", err, stderr)
+	}
+	for _, expected := range []string{"cosm add pkga v1.0.0 (undone)", "cosm undo --force (undoes ", "cosm registry add " + registryName + " " + packageGitURL + " (cannot be undone)"} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("Expected %q in the journal, got:\n%s", expected, stdout)
+		}
+	}
+}
+
+// TestAddPathDependency tests path dependencies on local trees and releasing projects that have them
+func TestImportManifest(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	for _, packageName := range []string{"pkga", "pkgb"} {
+		packageDir, packageGitURL := setupPackageWithGit(t, tempDir, packageName, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		releasePackage(t, packageDir, "v1.1.0")
+		releasePackage(t, packageDir, "v2.0.0")
+		addPackageToRegistry(t, tempDir, registryName, packageGitURL)
+	}
+	projectDir := initPackage(t, tempDir, "myproject")
+	projectFile := filepath.Join(projectDir, "Project.json")
+
+	// Unregistered versions fall back to the latest version with the same major version
+	goMod := `module example.com/myproject
+
+require (
+	github.com/acme/pkga v1.0.5
+	example.com/pkgb v1.0.0
+	github.com/acme/missing v1.0.0
+	golang.org/x/text v0.14.0 // indirect
+)
+`
+	if err := os.WriteFile(filepath.Join(projectDir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatalf("Failed to write go.mod: %v", err)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "import", "--from", "go.mod")
+	expectedOutput := fmt.Sprintf("Imported 'github.com/acme/pkga' as dependency 'pkga' v1.1.0 from registry '%s'\nImported 'example.com/pkgb' as dependency 'pkgb' v1.0.0 from registry '%s'\nImported 2 of 3 dependencies from go.mod\n", registryName, registryName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+	if !strings.Contains(stderr, "github.com/acme/missing v1.0.0") {
+		t.Errorf("Expected the unmatched requirement to be reported, got %q", stderr)
+	}
+	verifyProjectDependencies(t, projectFile, "pkga", "v1.1.0")
+	verifyProjectDependencies(t, projectFile, "pkgb", "v1.0.0")
+
+	// Existing dependencies are skipped and devDependencies go to the dev group
+	packageJSON := `{"dependencies": {"pkgb": "^1.0.0"}, "devDependencies": {"pkga": "^2.0.0"}}`
+	if err := os.WriteFile(filepath.Join(projectDir, "package.json"), []byte(packageJSON), 0644); err != nil {
+		t.Fatalf("Failed to write package.json: %v", err)
+	}
+	before, err := os.ReadFile(projectFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "import", "--from", "package.json", "--dry-run")
+	expectedOutput = fmt.Sprintf("Skipped 'pkgb': 'pkgb' v1.0.0 is already a dependency\nImported 'pkga' as dependency 'pkga' v2.0.0 from registry '%s' in group 'dev'\nWould import 1 of 2 dependencies from package.json\n", registryName)
+	checkOutput(t, stdout, stderr, expectedOutput, err, false, 0)
+	if after, _ := os.ReadFile(projectFile); string(after) != string(before) {
+		t.Errorf("Expected --dry-run to leave Project.json unchanged, got %s", after)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "import", "--from", "package.json")
+	if err != nil || !strings.Contains(stdout, "Imported 1 of 2 dependencies from package.json") {
+		t.Errorf("Expected pkga v2.0.0 to be imported, got %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+	project := loadProjectFile(t, projectFile)
+	var groups []string
+	for _, dep := range project.Deps {
+		if dep.Name == "pkga" {
+			groups = append(groups, dep.Version+":"+dep.Group)
+		}
+	}
+	slices.Sort(groups)
+	if !slices.Equal(groups, []string{"v1.1.0:", "v2.0.0:dev"}) {
+		t.Errorf("Expected pkga v1.1.0 and v2.0.0 in group dev, got %v", groups)
+	}
+
+	// Unsupported manifests are rejected
+	stdout, stderr, err = runCommand(t, projectDir, "import", "--from", "Cargo.toml")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+}
+
+// TestWhich tests printing the paths of the dependencies in the build list
+func TestWhich(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	specs := loadSpecs(t, tempDir, registryName, "G", "v1.0.0")
+
+	libDir := initPackage(t, tempDir, "mylib")
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, "G", "v1.0.0")
+	if _, stderr, err := runCommand(t, projectDir, "add", "--path", "../mylib"); err != nil {
+		t.Fatalf("Failed to add path dependency: %v\nStderr: %s", err, stderr)
+	}
+
+	// A package that is not in the depot yet is reported as such
+	stdout, stderr, err := runCommand(t, projectDir, "which", "G")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+	packagePath := filepath.Join(tempDir, ".cosm", "packages", "G", specs.SHA1)
+	stdout, stderr, err = runCommand(t, projectDir, "which", "G")
+	checkOutput(t, stdout, stderr, packagePath+"\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "which", "mylib@v0")
+	checkOutput(t, stdout, stderr, libDir+"\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "which", "--all")
+	checkOutput(t, stdout, stderr, fmt.Sprintf("G@v1.0.0 %s\nmylib@v0.1.0 %s\n", packagePath, libDir), err, false, 0)
+
+	// Unknown packages and major versions are not found; the arguments are validated
+	stdout, stderr, err = runCommand(t, projectDir, "which", "H")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, projectDir, "which", "G@v2")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, projectDir, "which", "G", "--all")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+}
+
+func TestAddPathDependency(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+
+	libDir := initPackage(t, tempDir, "mylib")
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	stdout, stderr, err := runCommand(t, projectDir, "add", "--path", "../mylib")
+	checkOutput(t, stdout, stderr, "Added path dependency 'mylib' v0.1.0 from ../mylib to project\n", err, false, 0)
+	project := loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	libProject := loadProjectFile(t, filepath.Join(libDir, "Project.json"))
+	if dep := project.Deps[libProject.UUID+"@v0"]; dep.Name != "mylib" || dep.Version != "v0.1.0" || dep.Path != "../mylib" {
+		t.Errorf("Unexpected path dependency: %+v", project.Deps)
+	}
+	if _, _, err := runCommand(t, projectDir, "add", "G", "--path", "../mylib"); err == nil {
+		t.Errorf("Expected an error for package arguments with --path")
+	}
+
+	// The build list uses the local tree and follows changes to its dependencies
+	buildList := loadBuildList(t, filepath.Join(projectDir, ".cosm", "buildlist.json"))
+	if dep := buildList.Dependencies[libProject.UUID+"@v0"]; dep.Path != libDir || dep.SHA1 != "" {
+		t.Errorf("Expected the build list to refer to %s, got %+v", libDir, dep)
+	}
+	addDependencyToProject(t, libDir, "G", "v1.0.0")
+	if _, stderr, err := runCommand(t, projectDir, "activate"); err != nil {
+		t.Fatalf("Failed to activate: %v\nStderr: %s", err, stderr)
+	}
+	buildList = loadBuildList(t, filepath.Join(projectDir, ".cosm", "buildlist.json"))
+	if len(buildList.Dependencies) != 2 {
+		t.Errorf("Expected mylib and G in the build list, got %+v", buildList.Dependencies)
+	}
+
+	// Releases refuse path dependencies unless they are allowed
+	commitAndPushPackageChanges(t, projectDir, "added mylib")
+	_, stderr, err = runCommand(t, projectDir, "release", "--patch")
+	if err == nil || !strings.Contains(stderr, "has path dependencies: 'mylib' at ../mylib") {
+		t.Errorf("Expected the release to be refused, got stderr %q (err: %v)", stderr, err)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "release", "--patch", "--allow-path-deps", "--dry-run")
+	if err != nil || !strings.Contains(stderr, "path dependency 'mylib' at ../mylib is published as version v0.1.0") {
+		t.Errorf("Expected the release to be allowed, got %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+}
+
+func TestDependencyGroups(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	uuids := make(map[string]string)
+	for _, name := range []string{"G", "H"} {
+		packageDir, gitURL := setupPackageWithGit(t, tempDir, name, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, gitURL)
+		uuids[name] = loadProjectFile(t, filepath.Join(packageDir, "Project.json")).UUID
+	}
+	uuidG, uuidH := uuids["G"], uuids["H"]
+
+	projectDir, projectGitURL := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, "G", "v1.0.0")
+	stdout, stderr, err := runCommand(t, projectDir, "add", "H", "v1.0.0", "--group", "dev")
+	checkOutput(t, stdout, stderr, "Added dependency 'H' v1.0.0 from registry 'myreg' to project in group 'dev'\n", err, false, 0)
+	project := loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	if dep := project.Deps[uuidH+"@v1"]; dep.Group != "dev" {
+		t.Errorf("Expected H in group 'dev', got %+v", dep)
+	}
+	if _, _, err := runCommand(t, projectDir, "add", "H", "--group", "no good"); err == nil {
+		t.Errorf("Expected an error for an invalid group name")
+	}
+
+	// Only the main group is resolved by default
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+	checkGroups := func(want ...string) {
+		t.Helper()
+		buildList := loadBuildList(t, buildListFile)
+		if len(buildList.Dependencies) != len(want) {
+			t.Errorf("Expected %v in the build list, got %+v", want, buildList.Dependencies)
+		}
+		for _, key := range want {
+			if _, ok := buildList.Dependencies[key]; !ok {
+				t.Errorf("Expected %s in the build list, got %+v", key, buildList.Dependencies)
+			}
+		}
+	}
+	checkGroups(uuidG + "@v1")
+	if _, stderr, err := runCommand(t, projectDir, "activate", "--with", "dev"); err != nil {
+		t.Fatalf("Failed to activate with dev: %v\nStderr: %s", err, stderr)
+	}
+	checkGroups(uuidG+"@v1", uuidH+"@v1")
+	if _, stderr, err := runCommand(t, projectDir, "activate", "--only", "dev"); err != nil {
+		t.Fatalf("Failed to activate only dev: %v\nStderr: %s", err, stderr)
+	}
+	checkGroups(uuidH + "@v1")
+	stdout, stderr, err = runCommand(t, projectDir, "activate", "--with", "test")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	stdout, stderr, err = runCommand(t, projectDir, "activate", "--with", "dev", "--only", "main")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+
+	// Published specs only include the main group
+	commitAndPushPackageChanges(t, projectDir, "added dependencies")
+	releasePackage(t, projectDir, "--patch")
+	addPackageToRegistry(t, tempDir, registryName, projectGitURL)
+	specs := loadSpecs(t, tempDir, registryName, "myproject", "v0.1.1")
+	if _, ok := specs.Deps[uuidH+"@v1"]; ok || len(specs.Deps) != 1 {
+		t.Errorf("Expected only G in the published specs, got %+v", specs.Deps)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	uuids := make(map[string]string)
+	publish := func(name string, prepare func(packageDir string)) {
+		t.Helper()
+		packageDir, gitURL := setupPackageWithGit(t, tempDir, name, "v1.0.0")
+		if prepare != nil {
+			prepare(packageDir)
+			commitAndPushPackageChanges(t, packageDir, "added dependencies")
+		}
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, gitURL)
+		uuids[name] = loadProjectFile(t, filepath.Join(packageDir, "Project.json")).UUID
+	}
+
+	// F has an optional dependency on J, enabled by its feature 'extra'; K enables that feature
+	publish("J", nil)
+	publish("F", func(packageDir string) {
+		stdout, stderr, err := runCommand(t, packageDir, "add", "J", "v1.0.0", "--optional")
+		checkOutput(t, stdout, stderr, "Added dependency 'J' v1.0.0 from registry 'myreg' to project as optional dependency\n", err, false, 0)
+		projectFile := filepath.Join(packageDir, "Project.json")
+		project := loadProjectFile(t, projectFile)
+		project.Features = map[string][]string{"extra": {"J"}}
+		data, _ := json.MarshalIndent(project, "", "  ")
+		if err := os.WriteFile(projectFile, data, 0644); err != nil {
+			t.Fatalf("Failed to write Project.json: %v", err)
+		}
+	})
+	specs := loadSpecs(t, tempDir, registryName, "F", "v1.0.0")
+	if !specs.Deps[uuids["J"]+"@v1"].Optional || !slices.Equal(specs.Features["extra"], []string{"J"}) {
+		t.Errorf("Expected the optional dependency and features in the specs, got %+v", specs)
+	}
+	publish("K", func(packageDir string) {
+		stdout, stderr, err := runCommand(t, packageDir, "add", "F", "v1.0.0", "--features", "extra")
+		checkOutput(t, stdout, stderr, "Added dependency 'F' v1.0.0 from registry 'myreg' to project with features 'extra'\n", err, false, 0)
+	})
+
+	// Optional dependencies are only resolved if a feature enables them
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+	addDependencyToProject(t, projectDir, "F", "v1.0.0")
+	buildList := loadBuildList(t, buildListFile)
+	if _, ok := buildList.Dependencies[uuids["J"]+"@v1"]; ok || len(buildList.Dependencies) != 1 {
+		t.Errorf("Expected only F in the build list, got %+v", buildList.Dependencies)
+	}
+	stdout, stderr, err := runCommand(t, projectDir, "add", "F", "v1.0.0", "--features", "nope")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	if !strings.Contains(stderr, "package 'F' v1.0.0 has no feature 'nope'") {
+		t.Errorf("Expected an unknown feature error, got %q", stderr)
+	}
+
+	// The features that dependencies request are added to those of the project
+	addDependencyToProject(t, projectDir, "K", "v1.0.0")
+	buildList = loadBuildList(t, buildListFile)
+	if _, ok := buildList.Dependencies[uuids["J"]+"@v1"]; !ok || len(buildList.Dependencies) != 3 {
+		t.Errorf("Expected F, J and K in the build list, got %+v", buildList.Dependencies)
+	}
+	if features := buildList.Dependencies[uuids["F"]+"@v1"].Features; !slices.Equal(features, []string{"extra"}) {
+		t.Errorf("Expected feature 'extra' of F to be enabled, got %v", features)
+	}
+}
+
+func TestPlatformDependencies(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	uuids := make(map[string]string)
+	for _, name := range []string{"L", "M"} {
+		packageDir, gitURL := setupPackageWithGit(t, tempDir, name, "v1.0.0")
+		releasePackage(t, packageDir, "v1.0.0")
+		addPackageToRegistry(t, tempDir, registryName, gitURL)
+		uuids[name] = loadProjectFile(t, filepath.Join(packageDir, "Project.json")).UUID
+	}
+
+	t.Setenv("COSM_PLATFORM", "linux/amd64")
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	stdout, stderr, err := runCommand(t, projectDir, "add", "L", "v1.0.0", "--platform", "linux")
+	checkOutput(t, stdout, stderr, "Added dependency 'L' v1.0.0 from registry 'myreg' to project on linux\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "add", "M", "v1.0.0", "--platform", "darwin/arm64")
+	checkOutput(t, stdout, stderr, "Added dependency 'M' v1.0.0 from registry 'myreg' to project on darwin/arm64\n", err, false, 0)
+	if _, _, err := runCommand(t, projectDir, "add", "M", "--platform", "Darwin"); err == nil {
+		t.Errorf("Expected an error for an invalid platform")
+	}
+
+	// The build list only has the dependencies of the platform it was resolved for, and records it
+	buildListFile := filepath.Join(projectDir, ".cosm", "buildlist.json")
+	buildList := loadBuildList(t, buildListFile)
+	if _, ok := buildList.Dependencies[uuids["L"]+"@v1"]; !ok || len(buildList.Dependencies) != 1 || buildList.Platform != "linux/amd64" {
+		t.Errorf("Expected only L in the build list for linux/amd64, got %+v", buildList)
+	}
+	t.Setenv("COSM_PLATFORM", "darwin/arm64")
+	stdout, stderr, err = runCommand(t, projectDir, "activate")
+	if err != nil || !strings.Contains(stdout, "Generated build list") {
+		t.Fatalf("Expected the build list to be regenerated for another platform, got %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+	buildList = loadBuildList(t, buildListFile)
+	if _, ok := buildList.Dependencies[uuids["M"]+"@v1"]; !ok || len(buildList.Dependencies) != 1 || buildList.Platform != "darwin/arm64" {
+		t.Errorf("Expected only M in the build list for darwin/arm64, got %+v", buildList)
+	}
+}
+
+func TestExec(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, "G", "v1.0.0")
+	buildList := loadBuildList(t, filepath.Join(projectDir, ".cosm", "buildlist.json"))
+	var depPath string
+	for _, dep := range buildList.Dependencies {
+		depPath = filepath.Join(tempDir, ".cosm", dep.Path)
+	}
+
+	// The command runs in the environment, and only its output goes to stdout
+	stdout, stderr, err := runCommand(t, projectDir, "exec", "--", "sh", "-c", "echo $G_PATH")
+	checkOutput(t, stdout, stderr, depPath+"\n", err, false, 0)
+	if !strings.Contains(stderr, "Build list up-to-date") {
+		t.Errorf("Expected the messages of cosm on stderr, got %q", stderr)
+	}
+	if _, err := os.Stat(depPath); err != nil {
+		t.Errorf("Expected G to be made available: %v", err)
+	}
+
+	// The exit code of the command is propagated without an error message
+	stdout, stderr, err = runCommand(t, projectDir, "exec", "sh", "-c", "exit 7")
+	checkOutput(t, stdout, stderr, "", err, true, 7)
+	if strings.Contains(stderr, "Error:") {
+		t.Errorf("Expected no error message for a failing command, got %q", stderr)
+	}
+	stdout, stderr, err = runCommand(t, projectDir, "exec", "no-such-command")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+}
+
+// TestProjectEnv tests the environment variables defined in Project.json
+func TestProjectEnv(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	registryName := "myreg"
+	setupRegistry(t, tempDir, registryName)
+	packageDir, gitURL := setupPackageWithGit(t, tempDir, "G", "v1.0.0")
+	releasePackage(t, packageDir, "v1.0.0")
+	addPackageToRegistry(t, tempDir, registryName, gitURL)
+	projectDir, _ := setupPackageWithGit(t, tempDir, "myproject", "v0.1.0")
+	addDependencyToProject(t, projectDir, "G", "v1.0.0")
+	specs := loadSpecs(t, tempDir, registryName, "G", "v1.0.0")
+	depPath := filepath.Join(tempDir, ".cosm", "packages", "G", specs.SHA1)
+
+	projectFile := filepath.Join(projectDir, "Project.json")
+	setEnv := func(env map[string]string) {
+		t.Helper()
+		project := loadProjectFile(t, projectFile)
+		project.Env = env
+		data, _ := json.MarshalIndent(project, "", "  ")
+		if err := os.WriteFile(projectFile, data, 0644); err != nil {
+			t.Fatalf("Failed to write Project.json: %v", err)
+		}
+	}
+
+	// Dependency references are replaced by the path of the dependency, and a defined variable
+	// overrides the variable of the same name that cosm computes
+	setEnv(map[string]string{"CFLAGS": "-I${dep:G}/include -O2", "G_PATH": "custom"})
+	stdout, stderr, err := runCommand(t, projectDir, "exec", "--", "sh", "-c", "echo \"$CFLAGS|$G_PATH\"")
+	checkOutput(t, stdout, stderr, "-I"+depPath+"/include -O2|custom\n", err, false, 0)
+	stdout, stderr, err = runCommand(t, projectDir, "activate")
+	checkOutput(t, stdout, stderr, "Build list up-to-date in .cosm/buildlist.json\n"+activatedMessage, err, false, 0)
+	envFile, err := os.ReadFile(filepath.Join(projectDir, ".cosm", ".env"))
+	if err != nil {
+		t.Fatalf("Failed to read .cosm/.env: %v", err)
+	}
+	if !strings.Contains(string(envFile), "CFLAGS=") || !strings.Contains(string(envFile), depPath+"/include") {
+		t.Errorf("Expected .cosm/.env to export CFLAGS, got:\n%s", envFile)
+	}
+
+	// References to packages outside the build list and reserved or invalid names are rejected
+	setEnv(map[string]string{"CFLAGS": "-I${dep:H}/include"})
+	stdout, stderr, err = runCommand(t, projectDir, "exec", "true")
+	checkOutput(t, stdout, stderr, "", err, true, 3)
+	setEnv(map[string]string{"COSM_ACTIVE": "yes"})
+	stdout, stderr, err = runCommand(t, projectDir, "exec", "true")
+	checkOutput(t, stdout, stderr, "", err, true, 2)
+	setEnv(map[string]string{"MY-FLAGS": "yes"})
+	stdout, stderr, err = runCommand(t, projectDir, "exec", "true")
+	checkOutput(t, stdout, stderr, "", err, true, 1)
+}
+
+func TestInitFromGit(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// An existing repository without Project.json, with release tags and a prerelease tag
+	sourceDir := filepath.Join(tempDir, "legacy-src")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", sourceDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "src", "legacy.lua"), []byte("return {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	gitURL := createBareRepo(t, tempDir, "legacy.git")
+	gitOutput(t, sourceDir, "init")
+	gitOutput(t, sourceDir, "add", ".")
+	gitOutput(t, sourceDir, "commit", "-m", "Initial commit")
+	gitOutput(t, sourceDir, "branch", "-m", "main")
+	for _, tag := range []string{"v1.0.0", "v1.2.0", "v2.0.0-rc.1", "nightly"} {
+		gitOutput(t, sourceDir, "tag", tag)
+	}
+	gitOutput(t, sourceDir, "remote", "add", "origin", gitURL)
+	gitOutput(t, sourceDir, "push", "origin", "main", "--tags")
+
+	workDir := filepath.Join(tempDir, "work")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", workDir, err)
+	}
+	stdout, stderr, err := runCommand(t, workDir, "init", "--from-git", gitURL)
+	checkOutput(t, stdout, stderr, "Initialized project 'legacy' with version v1.2.0 in legacy; push the commit with Project.json or run cosm release to publish it\n", err, false, 0)
+	projectDir := filepath.Join(workDir, "legacy")
+	project := loadProjectFile(t, filepath.Join(projectDir, "Project.json"))
+	if project.Name != "legacy" || project.Version != "v1.2.0" || project.UUID == "" {
+		t.Errorf("Unexpected Project.json: %+v", project)
+	}
+	if subject := gitOutput(t, projectDir, "log", "-1", "--format=%s"); subject != "Add Project.json" {
+		t.Errorf("Expected Project.json to be committed, got commit %q", subject)
+	}
+
+	// The next release continues from the latest release tag
+	stdout, stderr, err = runCommand(t, projectDir, "release", "--patch")
+	if err != nil || !strings.Contains(stdout, "v1.2.1") {
+		t.Errorf("Expected release v1.2.1, got %q (stderr: %q, err: %v)", stdout, stderr, err)
+	}
+
+	// Existing destinations and repositories that are already packages are refused
+	stdout, stderr, err = runCommand(t, workDir, "init", "--from-git", gitURL)
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	stdout, stderr, err = runCommand(t, workDir, "init", "--from-git", gitURL, "again")
+	checkOutput(t, stdout, stderr, "", err, true, 4)
+	if _, err := os.Stat(filepath.Join(workDir, "again")); !os.IsNotExist(err) {
+		t.Errorf("Expected the clone of a package to be removed, got %v", err)
+	}
+}
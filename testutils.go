@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -163,7 +164,8 @@ func setupTestEnv(t *testing.T) (tempDir string, cleanup func()) {
 	os.Setenv("HOME", tempDir)
 	_ = setupTempGitConfig(t, tempDir)
 	os.Setenv("COSM_DEPOT_PATH", filepath.Join(tempDir, ".cosm"))
-	commands.InitializeCosm()
+	t.Setenv("SHELL", "/bin/bash") // Activation output depends on the user's shell
+	commands.InitializeCosm(context.Background())
 	cleanup = func() { os.Unsetenv("HOME"); os.Unsetenv("COSM_DEPOT_PATH") }
 	return tempDir, cleanup
 }
@@ -175,10 +177,10 @@ func createBareRepo(t *testing.T, dir string, name string) string {
 	if err := os.Mkdir(bareRepoPath, 0755); err != nil {
 		t.Fatalf("Failed to create package dir %s: %v", bareRepoPath, err)
 	}
-	if _, err := commands.GitCommand(bareRepoPath, "init", "--bare"); err != nil {
+	if _, err := commands.GitCommand(context.Background(), bareRepoPath, "init", "--bare"); err != nil {
 		t.Fatalf("Failed to init bare Git repo in %s: %v", bareRepoPath, err)
 	}
-	if _, err := commands.GitCommand(bareRepoPath, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+	if _, err := commands.GitCommand(context.Background(), bareRepoPath, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
 		t.Fatalf("Failed to set HEAD in bare repo %s: %v", bareRepoPath, err)
 	}
 
@@ -239,6 +241,9 @@ func releasePackage(t *testing.T, packageDir, releaseArg string) (string, string
 	return stdout, stderr
 }
 
+// activatedMessage is printed by cosm activate when no shell is started
+const activatedMessage = "Environment written to .cosm; activate it with 'source .cosm/activate' or run 'cosm activate --shell'\n"
+
 // runCommand runs the cosm binary with given args in a directory and returns output and error
 func runCommand(t *testing.T, dir string, args ...string) (stdout, stderr string, err error) {
 	t.Helper()
@@ -268,6 +273,20 @@ func loadProjectFile(t *testing.T, projectFile string) types.Project {
 	return project
 }
 
+// loadRegistryFile reads and parses the registry.json of a registry clone
+func loadRegistryFile(t *testing.T, registryDir string) types.Registry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(registryDir, "registry.json"))
+	if err != nil {
+		t.Fatalf("Failed to read registry.json: %v", err)
+	}
+	var registry types.Registry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		t.Fatalf("Failed to parse registry.json: %v", err)
+	}
+	return registry
+}
+
 // removeFromRegistry executes the cosm registry rm command and verifies its output
 func removeFromRegistry(t *testing.T, dir, registryName, packageName string, version string) (stdout, stderr string) {
 	t.Helper()
@@ -338,6 +357,31 @@ func loadBuildList(t *testing.T, buildListFile string) types.BuildList {
 	return buildList
 }
 
+// rejectPushes installs or removes a pre-receive hook that rejects all pushes to a bare repository
+func rejectPushes(t *testing.T, gitURL string, reject bool) {
+	t.Helper()
+	hookFile := filepath.Join(strings.TrimPrefix(gitURL, "file://"), "hooks", "pre-receive")
+	if !reject {
+		if err := os.Remove(hookFile); err != nil {
+			t.Fatalf("Failed to remove hook %s: %v", hookFile, err)
+		}
+		return
+	}
+	if err := os.WriteFile(hookFile, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook %s: %v", hookFile, err)
+	}
+}
+
+// gitOutput runs a git command in dir and returns its output
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	output, err := commands.GitCommand(context.Background(), dir, args[0], args[1:]...)
+	if err != nil {
+		t.Fatalf("git %v failed in %s: %v", args, dir, err)
+	}
+	return output
+}
+
 /////////////////////// Check HELPER FUNCTIONS ///////////////////////
 
 // verifyProjectDependencies checks the Project.json dependencies
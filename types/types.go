@@ -1,9 +1,14 @@
 package types
 
+import "time"
+
 // PackageInfo represents metadata for a package in a registry
 type PackageInfo struct {
-	UUID   string `json:"uuid"`
-	GitURL string `json:"giturl"`
+	UUID        string   `json:"uuid"`
+	GitURL      string   `json:"giturl"`
+	Subdir      string   `json:"subdir,omitempty"`      // Package subdirectory within a monorepo
+	Mirrors     []string `json:"mirrors,omitempty"`     // Fallback Git URLs, tried in order
+	Maintainers []string `json:"maintainers,omitempty"` // Authors ([name]email) allowed to publish the package
 }
 
 // packageLocation represents a package found in a registry
@@ -17,38 +22,130 @@ type Registry struct {
 	Name     string                 `json:"name"`
 	UUID     string                 `json:"uuid"`
 	GitURL   string                 `json:"giturl"`
+	Mirrors  []string               `json:"mirrors,omitempty"`  // Fallback Git URLs of the registry, tried in order
+	Webhooks []string               `json:"webhooks,omitempty"` // URLs notified when a package version is published
 	Packages map[string]PackageInfo `json:"packages"`
 }
 
 type Dependency struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
+	Alias   string `json:"alias,omitempty"`   // Name under which the dependency is imported, if not its package name
 	Develop bool   `json:"develop,omitempty"` // Indicates development mode
+	Path    string `json:"path,omitempty"`    // Local tree of a path dependency, relative to the project
+	Group   string `json:"group,omitempty"`   // Dependency group, e.g. dev or test; empty for the main group
+
+	// Registry is the UUID of the registry the dependency is resolved from; any registry if empty
+	Registry string `json:"registry,omitempty"`
+
+	// SHA1 pins the dependency to a commit instead of the release of Version, e.g. for an unreleased fix
+	SHA1 string `json:"sha1,omitempty"`
+
+	Optional bool     `json:"optional,omitempty"` // Only resolved for dependents if one of the package features enables it
+	Features []string `json:"features,omitempty"` // Features of the dependency that are enabled
+
+	// Platforms restricts the dependency to platforms <os> or <os>/<arch>, e.g. linux or darwin/arm64
+	Platforms []string `json:"platforms,omitempty"`
 }
 
 // Project represents a project configuration
 type Project struct {
-	Name     string                `json:"name"`
-	UUID     string                `json:"uuid"`
-	Authors  []string              `json:"authors"`
-	Language string                `json:"language,omitempty"`
-	Version  string                `json:"version"`
-	Deps     map[string]Dependency `json:"deps,omitempty"` // Changed from []Dependency to map[string]string
+	Name        string                `json:"name"`
+	UUID        string                `json:"uuid"`
+	Authors     []string              `json:"authors"`
+	Language    string                `json:"language,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Keywords    []string              `json:"keywords,omitempty"`
+	License     string                `json:"license,omitempty"`
+	Homepage    string                `json:"homepage,omitempty"`
+	Version     string                `json:"version"`
+	Deps        map[string]Dependency `json:"deps,omitempty"` // Changed from []Dependency to map[string]string
+
+	// PublishGroups are the dependency groups that are published in the registries along with the main group
+	PublishGroups []string `json:"publishgroups,omitempty"`
+
+	// Features maps every feature to what it enables: optional dependencies by import name, other
+	// features, or features of dependencies as <dependency>/<feature>
+	Features map[string][]string `json:"features,omitempty"`
+
+	// Checks are run by cosm release before the release is tagged
+	Checks *ReleaseChecks `json:"checks,omitempty"`
+
+	// Env are environment variables that cosm activate and cosm exec inject; ${dep:<name>} in a
+	// value is replaced by the path of that dependency in the build list
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// ReleaseChecks are shell commands that validate a package before a release, run in this order in
+// the package root; empty commands are skipped
+type ReleaseChecks struct {
+	Build string `json:"build,omitempty"`
+	Test  string `json:"test,omitempty"`
+	Lint  string `json:"lint,omitempty"`
+}
+
+// Workspace groups multiple local projects that share a single build list
+type Workspace struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"` // Member project directories relative to the workspace root
+}
+
+// ActivationState records the environment variables injected by an activation
+type ActivationState struct {
+	Variables []string `json:"variables"`
+}
+
+// EditorPaths describes where the sources of an activated project and its dependencies live on
+// disk, written to .cosm/paths.json for editor plugins and language servers
+type EditorPaths struct {
+	Root         string             `json:"root"`         // Project or workspace root
+	Sources      []string           `json:"sources"`      // Source directories of the project or workspace members
+	Dependencies []EditorDependency `json:"dependencies"` // Sorted by import name
+	SearchPaths  map[string]string  `json:"searchpaths"`  // Module search path variables of the project languages, with absolute paths
+}
+
+// EditorDependency is a resolved dependency in .cosm/paths.json
+type EditorDependency struct {
+	Name    string `json:"name"`
+	Import  string `json:"import"` // Name under which the dependency is imported
+	UUID    string `json:"uuid"`
+	Version string `json:"version"`
+	Path    string `json:"path"` // Package tree in the depot, or a vendored copy
+	Src     string `json:"src"`
+}
+
+// TrustPolicy configures signing and provenance verification for a registry
+type TrustPolicy struct {
+	SignCommits       bool   `json:"signcommits,omitempty"`       // Sign registry commits made by release and registry add
+	RequireSigned     bool   `json:"requiresigned,omitempty"`     // Fail verification if the registry commit has no valid signature
+	RequireSignedTags bool   `json:"requiresignedtags,omitempty"` // Fail verification if the release tag was not signed
+	AllowedSigners    string `json:"allowedsigners,omitempty"`    // SSH allowed signers file, relative to the registries directory
 }
 
 // Specs represents the metadata for a package version
 type Specs struct {
-	Name    string                `json:"name"`
-	UUID    string                `json:"uuid"`
-	Version string                `json:"version"`
-	GitURL  string                `json:"giturl"`
-	SHA1    string                `json:"sha1"`
-	Deps    map[string]Dependency `json:"deps"`
+	Name        string                `json:"name"`
+	UUID        string                `json:"uuid"`
+	Version     string                `json:"version"`
+	GitURL      string                `json:"giturl"`
+	SHA1        string                `json:"sha1"`
+	Subdir      string                `json:"subdir,omitempty"`      // Package subdirectory within a monorepo
+	Mirrors     []string              `json:"mirrors,omitempty"`     // Fallback Git URLs, tried in order
+	Yanked      bool                  `json:"yanked,omitempty"`      // Skipped when selecting versions for new dependencies
+	Signer      string                `json:"signer,omitempty"`      // Tagger of the signed release tag, as "Name <email>"
+	Digest      string                `json:"digest,omitempty"`      // Digest of the package files, checked when installing from an archive
+	Description string                `json:"description,omitempty"` // Descriptive metadata copied from Project.json
+	Keywords    []string              `json:"keywords,omitempty"`
+	License     string                `json:"license,omitempty"`
+	Homepage    string                `json:"homepage,omitempty"`
+	Deps        map[string]Dependency `json:"deps"`
+	Features    map[string][]string   `json:"features,omitempty"` // Copied from Project.json
 }
 
 // BuildList represents the minimum version dependencies for a package version
 type BuildList struct {
 	Dependencies map[string]BuildListDependency `json:"dependencies"`
+	Platform     string                         `json:"platform,omitempty"` // <os>/<arch> that platform-specific dependencies were resolved for
 }
 
 // BuildListDependency represents a single dependency in the build list
@@ -59,4 +156,83 @@ type BuildListDependency struct {
 	GitURL  string `json:"giturl"`
 	SHA1    string `json:"sha1"`
 	Path    string `json:"path"`
+	Alias   string `json:"alias,omitempty"` // Name under which the dependency is imported, if not its package name
+
+	Features []string `json:"features,omitempty"` // Features enabled by the project or other dependencies
+}
+
+// Dependent is a version of a package that depends on another package in the same registry,
+// as recorded in the dependents.json file of the dependency
+type Dependent struct {
+	Name     string `json:"name"`
+	UUID     string `json:"uuid"`
+	Version  string `json:"version"`
+	Requires string `json:"requires"` // Version of the dependency required by the dependent
+}
+
+// VendorManifest records the dependencies copied into vendor/ by cosm vendor
+type VendorManifest struct {
+	Deps         map[string]Dependency          `json:"deps"`         // Direct dependencies of the project when it was vendored
+	Dependencies map[string]BuildListDependency `json:"dependencies"` // Build list of the vendored packages
+}
+
+// Config holds the user defaults in config.json in the depot; environment variables override them
+type Config struct {
+	DefaultRegistry string `json:"defaultregistry,omitempty"` // Registry preferred when a package is found in several registries
+	Author          string `json:"author,omitempty"`          // Author of new projects ([name]email), instead of the git user
+	Offline         bool   `json:"offline,omitempty"`         // Do not pull registries or clone templates
+	Parallelism     int    `json:"parallelism,omitempty"`     // Number of registries updated or published to concurrently
+	Timeout         string `json:"timeout,omitempty"`         // Timeout of git commands that contact a remote, e.g. 5m
+	Retries         *int   `json:"retries,omitempty"`         // Retries of git commands that contact a remote after transient failures
+	RefreshInterval string `json:"refreshinterval,omitempty"` // Minimum time between pulls of a registry when packages are looked up, e.g. 5m
+	TemplatesURL    string `json:"templatesurl,omitempty"`    // Repository of the default template source
+	Platform        string `json:"platform,omitempty"`        // Platform <os>/<arch> that platform-specific dependencies are resolved for
+	ArchiveURL      string `json:"archiveurl,omitempty"`      // Artifact store with package archives, an http, https or file URL
+	License         string `json:"license,omitempty"`         // License of new projects
+	StageRegistry   bool   `json:"stageregistry,omitempty"`   // Commit registry changes locally until cosm registry push
+}
+
+// Advisory describes a vulnerability in some versions of a package, stored in a registry as
+// advisories/<package name>/<id>.json
+type Advisory struct {
+	ID       string   `json:"id"`
+	Package  string   `json:"package"`
+	UUID     string   `json:"uuid,omitempty"` // Restricts the advisory to the package with this UUID
+	Summary  string   `json:"summary"`
+	Severity string   `json:"severity,omitempty"`
+	Affected []string `json:"affected"`          // Version ranges, e.g. ">=v1.0.0, <v1.2.3"
+	Patched  string   `json:"patched,omitempty"` // First version with a fix
+	URL      string   `json:"url,omitempty"`
+}
+
+// PackageMeta describes a package version materialized in packages/<name>/<sha1> of the depot, so
+// that the package store can be audited without the registries; it is stored in .cosm-meta.json
+type PackageMeta struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	UUID      string    `json:"uuid"`
+	SHA1      string    `json:"sha1"`
+	Subdir    string    `json:"subdir,omitempty"`  // Package subdirectory within a monorepo
+	Source    string    `json:"source"`            // Git URL of the package
+	Archive   string    `json:"archive,omitempty"` // Archive the files were extracted from instead of a clone
+	Installed time.Time `json:"installed"`
+}
+
+// JournalEntry records an operation that changed metadata files in logs/journal.jsonl in the depot
+type JournalEntry struct {
+	ID           int           `json:"id"`
+	Time         time.Time     `json:"time"`
+	Command      string        `json:"command"`
+	Dir          string        `json:"dir"`                    // Working directory of the command
+	Failed       bool          `json:"failed,omitempty"`       // The command failed after changing files
+	Files        []JournalFile `json:"files"`                  // Metadata files changed by the operation
+	Repositories []string      `json:"repositories,omitempty"` // Git repositories the operation committed, tagged or pushed in
+	Undoes       int           `json:"undoes,omitempty"`       // ID of the operation reverted by cosm undo
+}
+
+// JournalFile records the content of a metadata file before and after an operation
+type JournalFile struct {
+	Path     string  `json:"path"`
+	Previous *string `json:"previous"` // Null if the operation created the file
+	Result   string  `json:"result"`
 }